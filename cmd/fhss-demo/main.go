@@ -17,25 +17,101 @@
 //
 //	# Manual hopping test (no sync, just hop through channels)
 //	./fhss-demo -mode manual -d '#0' -c tests/etc/433-2fsk-std-4.8k.json -channels 5
+//
+//	# Follow a third-party hopper rf-scanner detected, learning its hop order
+//	./fhss-demo -mode sniff -d '#1' -c tests/etc/433-2fsk-std-4.8k.json -hopper scan.json
+//
+//	# Pseudo-random 50-channel sequence checked against FCC 15.247
+//	./fhss-demo -mode master -d '#0' -c tests/etc/915-fhss-100k-master.json -channels 50 -sequence fcc -seed 42
+//
+//	# Adaptive hopping: the master drops noisy channels and the client follows
+//	./fhss-demo -mode master -d '#0' -c tests/etc/433-2fsk-std-4.8k.json -channels 30 -afh
+//	./fhss-demo -mode client -d '#1' -c tests/etc/433-2fsk-std-4.8k.json -channels 30 -afh
+//
+// With -output json every event is written to stdout as one object per
+// line, told apart by its "type": tx, rx, hop, afh, stats, packet and
+// summary.
 package main
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/gousb"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
 	"github.com/herlein/gocat/pkg/fhss"
+	"github.com/herlein/gocat/pkg/output"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
+var (
+	format output.Format
+	out    io.Writer = os.Stdout // Progress and text results
+)
+
+// txRecord is a master beacon in -output json mode
+type txRecord struct {
+	Type  string    `json:"type"` // "tx"
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+	Seq   int       `json:"seq"`
+	Data  string    `json:"data"` // Hex
+}
+
+// rxRecord is a packet the client received in -output json mode
+type rxRecord struct {
+	Type  string    `json:"type"` // "rx"
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+	Data  string    `json:"data"` // Hex
+}
+
+// hopRecord is a manual hop in -output json mode
+type hopRecord struct {
+	Type    string    `json:"type"` // "hop"
+	Time    time.Time `json:"time"`
+	Hop     int       `json:"hop"`
+	Channel uint8     `json:"channel"`
+}
+
+// afhRecord is an adaptive hopping channel map event in -output json mode
+type afhRecord struct {
+	Type     string    `json:"type"` // "afh"
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"` // announce (master), offer (client) or apply
+	Version  uint8     `json:"version"`
+	Instant  int       `json:"instant"`
+	Blocked  []uint8   `json:"blocked"`
+	Channels []uint8   `json:"channels,omitempty"` // The hop sequence, for apply
+}
+
+// statsRecord is the client's link statistics in -output json mode
+type statsRecord struct {
+	Type string    `json:"type"` // "stats"
+	Time time.Time `json:"time"`
+	*fhss.Stats
+}
+
+// writeAFH writes an afh record for m
+func writeAFH(event string, m *fhss.ChannelMap, channels []uint8) {
+	blocked := m.Blocked
+	if blocked == nil {
+		blocked = []uint8{}
+	}
+	output.WriteLine(&afhRecord{Type: "afh", Time: time.Now(), Event: event, Version: m.Version, Instant: m.Instant, Blocked: blocked, Channels: channels})
+}
+
 func main() {
-	mode := flag.String("mode", "", "Mode: 'master', 'client', or 'manual' (required)")
+	mode := flag.String("mode", "", "Mode: 'master', 'client', 'manual' or 'sniff' (required)")
 	configPath := flag.String("c", "", "Configuration file path (required)")
 	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
 	verbose := flag.Bool("v", false, "Verbose output")
@@ -44,14 +120,27 @@ func main() {
 	numChannels := flag.Int("channels", 20, "Number of channels in hop sequence")
 	dwellMs := flag.Int("dwell", 100, "Dwell time per channel in milliseconds")
 	cellID := flag.Uint("cell", 0, "Cell ID for synchronization (0-65535)")
+	pattern := flag.String("sequence", fhss.PatternLinear, "Hop sequence: "+strings.Join(fhss.Patterns, ", ")+" (master and client must match)")
+	seed := flag.Uint("seed", 1, "Seed for the lfsr and fcc sequences")
+	stride := flag.Int("stride", 0, "Prime stride for the prime sequence (0 = smallest prime above sqrt(channels) not dividing it)")
+	statsEvery := flag.Duration("stats", 10*time.Second, "Client: print link statistics this often (0 = only at exit)")
+	fccBwKHz := flag.Float64("fcc-bw", 0, "20 dB bandwidth in kHz the fcc sequence is checked with (0 = the channel spacing)")
+	afhOn := flag.Bool("afh", false, "Adaptive hopping: the master blocks noisy channels and announces the channel map in its beacons, the client follows it")
+	afhNoise := flag.Float64("afh-noise", -80, "AFH: block channels whose average RSSI between beacons is above this (dBm)")
+	afhMin := flag.Int("afh-min", 20, "AFH: never hop over fewer channels than this")
+	hopFreqs := flag.String("hop-freqs", "", "Sniff: the hopper's frequencies in MHz, comma separated (default: the -channels/-sequence hop sequence)")
+	ordered := flag.Bool("ordered", false, "Sniff: -hop-freqs are in hop order; otherwise the order is learned")
+	hopperFile := flag.String("hopper", "", "Sniff: rf-scanner -output json file to take the last detected hopper from")
+	flag.Var(&format, "output", output.FlagUsage+" (json: one event per line)")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s -mode <master|client|manual> -c <config.json> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s -mode <master|client|manual|sniff> -c <config.json> [options]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "FHSS demonstration for YardStick One devices\n\n")
 		fmt.Fprintf(os.Stderr, "Modes:\n")
 		fmt.Fprintf(os.Stderr, "  master  - Act as sync master, transmit beacons\n")
 		fmt.Fprintf(os.Stderr, "  client  - Synchronize to master and receive\n")
-		fmt.Fprintf(os.Stderr, "  manual  - Manual channel hopping (no sync)\n\n")
+		fmt.Fprintf(os.Stderr, "  manual  - Manual channel hopping (no sync)\n")
+		fmt.Fprintf(os.Stderr, "  sniff   - Follow a third-party hopper and print its packets\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -61,45 +150,62 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -mode client -d '#1' -c tests/etc/433-2fsk-std-4.8k.json\n", os.Args[0])
 	}
 	flag.Parse()
+	out = format.Progress()
 
 	if *mode == "" {
 		fmt.Fprintln(os.Stderr, "Error: Mode (-mode) is required")
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
 	if *configPath == "" {
 		fmt.Fprintln(os.Stderr, "Error: Configuration file (-c) is required")
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
 	*mode = strings.ToLower(*mode)
-	if *mode != "master" && *mode != "client" && *mode != "manual" {
-		fmt.Fprintf(os.Stderr, "Error: Invalid mode '%s'. Use 'master', 'client', or 'manual'\n", *mode)
-		os.Exit(1)
+	if *mode != "master" && *mode != "client" && *mode != "manual" && *mode != "sniff" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid mode '%s'. Use 'master', 'client', 'manual' or 'sniff'\n", *mode)
+		os.Exit(exitcode.Usage)
 	}
 
-	if *numChannels < 2 || *numChannels > yardstick.FHSSMaxChannels {
-		fmt.Fprintf(os.Stderr, "Error: channels must be between 2 and %d\n", yardstick.FHSSMaxChannels)
-		os.Exit(1)
+	*pattern = strings.ToLower(*pattern)
+	if !slices.Contains(fhss.Patterns, *pattern) {
+		fmt.Fprintf(os.Stderr, "Error: Invalid sequence '%s'. Use %s\n", *pattern, strings.Join(fhss.Patterns, ", "))
+		os.Exit(exitcode.Usage)
+	}
+
+	if *numChannels < 2 || *numChannels > fhss.MaxSequenceChannels {
+		fmt.Fprintf(os.Stderr, "Error: channels must be between 2 and %d\n", fhss.MaxSequenceChannels)
+		os.Exit(exitcode.Usage)
+	}
+
+	if *hopFreqs != "" && *hopperFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: -hop-freqs and -hopper cannot be combined")
+		os.Exit(exitcode.Usage)
+	}
+
+	if *afhOn && *afhMin < 2 {
+		fmt.Fprintln(os.Stderr, "Error: -afh-min must be at least 2")
+		os.Exit(exitcode.Usage)
 	}
 
 	// Load configuration
 	if *verbose {
-		fmt.Printf("Loading configuration from: %s\n", *configPath)
+		fmt.Fprintf(out, "Loading configuration from: %s\n", *configPath)
 	}
 
 	configuration, err := config.LoadFromFile(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if *verbose {
-		fmt.Printf("Configuration loaded:\n")
-		fmt.Printf("  Base Frequency: %.6f MHz\n", configuration.GetFrequencyMHz())
-		fmt.Printf("  Modulation:     %s\n", configuration.GetModulationString())
+		fmt.Fprintf(out, "Configuration loaded:\n")
+		fmt.Fprintf(out, "  Base Frequency: %.6f MHz\n", configuration.GetFrequencyMHz())
+		fmt.Fprintf(out, "  Modulation:     %s\n", configuration.GetModulationString())
 	}
 
 	// Create USB context
@@ -110,21 +216,21 @@ func main() {
 	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	defer device.Close()
 
-	fmt.Printf("Connected to: %s (Serial: %s)\n", device.Product, device.Serial)
+	fmt.Fprintf(out, "Connected to: %s (Serial: %s)\n", device.Product, device.Serial)
 
 	// Test connectivity
 	if err := device.Ping([]byte("FHSS")); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Device ping failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Apply radio configuration
 	if *verbose {
-		fmt.Println("Applying radio configuration...")
+		fmt.Fprintln(out, "Applying radio configuration...")
 	}
 
 	// Force IDLE state first
@@ -135,7 +241,7 @@ func main() {
 
 	if err := config.ApplyToDevice(device, configuration); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to apply configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Enable amplifiers
@@ -147,53 +253,113 @@ func main() {
 	fh := fhss.New(device)
 
 	// Generate channel sequence
-	channels := make([]uint8, *numChannels)
-	for i := range channels {
-		channels[i] = uint8(i)
+	var plan *fhss.FCCPlan
+	if *pattern == fhss.PatternFCC {
+		spacing, err := device.GetChannelSpacing()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to read channel spacing: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		plan = &fhss.FCCPlan{
+			BaseHz:      uint32(configuration.GetFrequencyMHz()*1e6 + 0.5),
+			SpacingHz:   spacing,
+			BandwidthHz: spacing,
+			Dwell:       time.Duration(*dwellMs) * time.Millisecond,
+		}
+		if *fccBwKHz > 0 {
+			plan.BandwidthHz = uint32(*fccBwKHz * 1e3)
+		}
+	}
+	channels, err := hopSequence(*pattern, *numChannels, uint16(*seed), *stride, plan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Usage)
 	}
 
 	if *verbose {
-		fmt.Printf("Setting up %d-channel hop sequence\n", *numChannels)
+		fmt.Fprintf(out, "Setting up %d-channel %s hop sequence: %v\n", *numChannels, *pattern, channels)
 	}
 
 	if err := fh.SetChannels(channels); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to set channels: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Set up signal handling for clean shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	var afh *fhss.AFH
+	if *afhOn {
+		opts := fhss.DefaultAFHOptions()
+		opts.MaxNoiseDBm = float32(*afhNoise)
+		opts.MinChannels = *afhMin
+		afh = fhss.NewAFH(channels, opts)
+	}
+
 	switch *mode {
 	case "master":
-		runMaster(fh, device, *dwellMs, *verbose, sigChan)
+		runMaster(fh, device, afh, *dwellMs, *verbose, sigChan)
 	case "client":
-		runClient(fh, device, uint16(*cellID), *verbose, sigChan)
+		monitor := fhss.NewMonitor(channels, time.Duration(*dwellMs)*time.Millisecond)
+		runClient(fh, device, uint16(*cellID), monitor, afh, *dwellMs, *statsEvery, *verbose, sigChan)
+	case "sniff":
+		dwellSet := false
+		flag.Visit(func(f *flag.Flag) { dwellSet = dwellSet || f.Name == "dwell" })
+		baseHz := uint32(configuration.GetFrequencyMHz()*1e6 + 0.5)
+		sniffer, err := newSniffer(device, *hopFreqs, *hopperFile, *ordered, baseHz, channels, time.Duration(*dwellMs)*time.Millisecond, dwellSet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		runSniff(sniffer, *verbose, sigChan)
 	case "manual":
 		runManual(fh, device, *dwellMs, *verbose, sigChan)
 	}
 }
 
-func runMaster(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose bool, sigChan chan os.Signal) {
-	fmt.Println("=== FHSS Master Mode ===")
-	fmt.Printf("Dwell time: %d ms\n", dwellMs)
-	fmt.Println("Press Ctrl+C to stop")
-	fmt.Println()
+// hopSequence generates the channel sequence for a -sequence pattern;
+// plan is only used for fcc
+func hopSequence(pattern string, n int, seed uint16, stride int, plan *fhss.FCCPlan) ([]uint8, error) {
+	switch pattern {
+	case fhss.PatternLinear:
+		return fhss.LinearSequence(n)
+	case fhss.PatternLFSR:
+		return fhss.LFSRSequence(n, seed)
+	case fhss.PatternPrime:
+		return fhss.PrimeStrideSequence(n, stride)
+	case fhss.PatternFCC:
+		seq, err := plan.Sequence(n, seed)
+		if err != nil {
+			return nil, fmt.Errorf("not FCC 15.247 compliant: %w", err)
+		}
+		return seq, nil
+	}
+	return nil, fmt.Errorf("unknown sequence '%s' (known: %s)", pattern, strings.Join(fhss.Patterns, ", "))
+}
+
+func runMaster(fh *fhss.FHSS, device *yardstick.Device, afh *fhss.AFH, dwellMs int, verbose bool, sigChan chan os.Signal) {
+	fmt.Fprintln(out, "=== FHSS Master Mode ===")
+	fmt.Fprintf(out, "Dwell time: %d ms\n", dwellMs)
+	if afh != nil {
+		fmt.Fprintln(out, "Adaptive hopping: on")
+	}
+	fmt.Fprintln(out, "Press Ctrl+C to stop")
+	fmt.Fprintln(out)
 
 	// Set as sync master
 	if err := fh.BecomeMaster(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to become master: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Start hopping
 	if err := fh.StartHopping(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to start hopping: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	fmt.Println("Master started - hopping and transmitting beacons")
+	fmt.Fprintln(out, "Master started - hopping and transmitting beacons")
 
 	// Main loop - transmit beacon messages
 	msgNum := 0
@@ -203,7 +369,7 @@ func runMaster(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose boo
 	for {
 		select {
 		case <-sigChan:
-			fmt.Println("\nShutting down master...")
+			fmt.Fprintln(out, "\nShutting down master...")
 			fh.Stop()
 			return
 		case <-ticker.C:
@@ -211,86 +377,206 @@ func runMaster(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose boo
 			state, err := fh.GetState()
 			if err != nil {
 				if verbose {
-					fmt.Printf("Warning: Failed to get state: %v\n", err)
+					fmt.Fprintf(out, "Warning: Failed to get state: %v\n", err)
 				}
 				continue
 			}
 
+			beacon := fhss.Beacon(msgNum)
+			if afh != nil {
+				// Switch at the announced beacon, then listen to the
+				// channel before transmitting on it
+				if seq, ok := afh.Due(msgNum); ok {
+					applyChannelMap(fh, nil, afh, seq)
+				}
+				measureNoise(fh, device, afh)
+				beacon = fhss.BeaconWithMap(msgNum, afh.Announce())
+			}
+
 			// Transmit beacon
-			beacon := fmt.Sprintf("BEACON:%06d", msgNum)
-			if err := fh.Transmit([]byte(beacon)); err != nil {
+			if err := fh.Transmit(beacon); err != nil {
 				if verbose {
-					fmt.Printf("Warning: Failed to transmit: %v\n", err)
+					fmt.Fprintf(out, "Warning: Failed to transmit: %v\n", err)
 				}
 			} else {
-				fmt.Printf("[%s] TX: %s\n", state, beacon)
+				fmt.Fprintf(out, "[%s] TX: %s\n", state, beacon)
+				if format.IsJSON() {
+					output.WriteLine(&txRecord{Type: "tx", Time: time.Now(), State: state.String(), Seq: msgNum, Data: hex.EncodeToString(beacon)})
+				}
 				msgNum++
 			}
+
+			if afh != nil {
+				if m := afh.Evaluate(time.Now(), msgNum); m != nil {
+					fmt.Fprintf(out, "AFH: announcing channel map %s\n", m)
+					if format.IsJSON() {
+						writeAFH("announce", m, nil)
+					}
+				}
+			}
 		}
 	}
 }
 
-func runClient(fh *fhss.FHSS, device *yardstick.Device, cellID uint16, verbose bool, sigChan chan os.Signal) {
-	fmt.Println("=== FHSS Client Mode ===")
-	fmt.Printf("Cell ID: %d\n", cellID)
-	fmt.Println("Press Ctrl+C to stop")
-	fmt.Println()
+func runClient(fh *fhss.FHSS, device *yardstick.Device, cellID uint16, monitor *fhss.Monitor, afh *fhss.AFH, dwellMs int, statsEvery time.Duration, verbose bool, sigChan chan os.Signal) {
+	fmt.Fprintln(out, "=== FHSS Client Mode ===")
+	fmt.Fprintf(out, "Cell ID: %d\n", cellID)
+	fmt.Fprintln(out, "Press Ctrl+C to stop")
+	fmt.Fprintln(out)
 
 	// Start synchronization
-	fmt.Println("Attempting to synchronize with master...")
+	fmt.Fprintln(out, "Attempting to synchronize with master...")
 	if err := fh.StartSync(cellID); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to start sync: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	// Put radio in RX mode
-	if err := device.SetModeRX(); err != nil {
+	// Put radio in RX mode; the radio is leased for hopping now
+	if err := fh.Device().SetModeRX(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to set RX mode: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	fmt.Println("Client started - listening for beacons")
+	fmt.Fprintln(out, "Client started - listening for beacons")
 
 	// Main loop - receive and display
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
+	var report <-chan time.Time
+	if statsEvery > 0 {
+		reportTicker := time.NewTicker(statsEvery)
+		defer reportTicker.Stop()
+		report = reportTicker.C
+	}
+
+	// The last beacon heard, to tell which one the master sends next
+	lastSeq := -1
+	var lastAt time.Time
+	dwell := time.Duration(dwellMs) * time.Millisecond
 
 	for {
 		select {
 		case <-sigChan:
-			fmt.Println("\nShutting down client...")
+			fmt.Fprintln(out, "\nShutting down client...")
 			fh.Stop()
+			printStats(monitor.Stats())
 			return
+		case <-report:
+			stats := monitor.Stats()
+			fmt.Fprintf(out, "STATS: %s\n", &stats)
+			if format.IsJSON() {
+				output.WriteLine(&statsRecord{Type: "stats", Time: time.Now(), Stats: &stats})
+			}
 		case <-ticker.C:
 			// Check state
-			state, err := fh.GetState()
+			macData, err := fh.GetMACData()
 			if err != nil {
 				continue
 			}
+			monitor.Update(macData)
+			state := macData.State
+
+			if afh != nil && lastSeq >= 0 {
+				next := lastSeq + 1 + int(time.Since(lastAt)/dwell)
+				if seq, ok := afh.Due(next); ok {
+					applyChannelMap(fh, monitor, afh, seq)
+				}
+			}
 
 			// Try to receive
 			data, err := device.RFRecv(50*time.Millisecond, 255)
 			if err != nil {
 				// Timeout is normal
 				if verbose {
-					fmt.Printf("[%s] Waiting...\n", state)
+					fmt.Fprintf(out, "[%s] Waiting...\n", state)
 				}
 				continue
 			}
 
 			if len(data) > 0 {
-				fmt.Printf("[%s] RX: %s\n", state, string(data))
+				if seq, ok := fhss.ParseBeacon(data); ok {
+					var rssi float32
+					if raw, err := device.GetRSSI(); err == nil {
+						rssi = float32(yardstick.RSSIToDBm(raw))
+					}
+					monitor.Beacon(time.Now(), seq, rssi)
+					lastSeq, lastAt = seq, time.Now()
+				}
+				if afh != nil {
+					if m, ok := fhss.ParseChannelMap(data); ok && afh.Offer(m) {
+						fmt.Fprintf(out, "AFH: master announced channel map %s\n", m)
+						if format.IsJSON() {
+							writeAFH("offer", m, nil)
+						}
+					}
+				}
+				fmt.Fprintf(out, "[%s] RX: %s\n", state, string(data))
+				if format.IsJSON() {
+					output.WriteLine(&rxRecord{Type: "rx", Time: time.Now(), State: state.String(), Data: hex.EncodeToString(data)})
+				}
 			}
 		}
 	}
 }
 
+// applyChannelMap loads the hop sequence of the channel map AFH just
+// switched to
+func applyChannelMap(fh *fhss.FHSS, monitor *fhss.Monitor, afh *fhss.AFH, seq []uint8) {
+	if err := fh.SetChannels(seq); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load channel map: %v\n", err)
+		return
+	}
+	if monitor != nil {
+		monitor.SetChannels(seq)
+	}
+	m := afh.Map()
+	fmt.Fprintf(out, "AFH: hopping over %d channels, map %s\n", len(seq), &m)
+	if format.IsJSON() {
+		writeAFH("apply", &m, seq)
+	}
+}
+
+// measureNoise reads the RSSI of the master's current channel into AFH
+func measureNoise(fh *fhss.FHSS, device *yardstick.Device, afh *fhss.AFH) {
+	md, err := fh.GetMACData()
+	if err != nil {
+		return
+	}
+	raw, err := device.GetRSSI()
+	if err != nil {
+		return
+	}
+	seq := afh.Channels()
+	afh.Noise(seq[int(md.CurChanIdx)%len(seq)], float32(yardstick.RSSIToDBm(raw)))
+}
+
+// printStats prints the client's link statistics in full
+func printStats(s fhss.Stats) {
+	if format.IsJSON() {
+		output.WriteLine(&statsRecord{Type: "stats", Time: time.Now(), Stats: &s})
+		return
+	}
+	fmt.Fprintf(out, "\n--- Link statistics (%v) ---\n", time.Since(s.Since).Round(time.Second))
+	fmt.Fprintf(out, "State:        %s\n", s.State)
+	fmt.Fprintf(out, "Beacons:      %d received, %d lost\n", s.Beacons, s.LostBeacons)
+	fmt.Fprintf(out, "Hops:         %d while synched, %d without a beacon (%.0f%% heard)\n", s.Hops, s.MissedHops, s.BeaconRate()*100)
+	fmt.Fprintf(out, "Drift:        %d ms now, %d ms at most since the last sync\n", s.DriftMs, s.MaxDriftMs)
+	fmt.Fprintf(out, "Sync:         lost %d times, regained %d times\n", s.SyncLosses, s.Resyncs)
+	if len(s.Channels) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "Channel  Beacons  Avg RSSI  Min RSSI  Max RSSI")
+	for _, c := range s.Channels {
+		fmt.Fprintf(out, "%7d  %7d  %8.1f  %8.1f  %8.1f\n", c.Channel, c.Beacons, c.RSSI, c.MinRSSI, c.MaxRSSI)
+	}
+}
+
 func runManual(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose bool, sigChan chan os.Signal) {
-	fmt.Println("=== FHSS Manual Mode ===")
-	fmt.Printf("Dwell time: %d ms\n", dwellMs)
-	fmt.Println("Manually hopping through channels (no sync)")
-	fmt.Println("Press Ctrl+C to stop")
-	fmt.Println()
+	fmt.Fprintln(out, "=== FHSS Manual Mode ===")
+	fmt.Fprintf(out, "Dwell time: %d ms\n", dwellMs)
+	fmt.Fprintln(out, "Manually hopping through channels (no sync)")
+	fmt.Fprintln(out, "Press Ctrl+C to stop")
+	fmt.Fprintln(out)
 
 	hopCount := 0
 	ticker := time.NewTicker(time.Duration(dwellMs) * time.Millisecond)
@@ -299,7 +585,7 @@ func runManual(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose boo
 	for {
 		select {
 		case <-sigChan:
-			fmt.Println("\nStopping manual hopping...")
+			fmt.Fprintln(out, "\nStopping manual hopping...")
 			return
 		case <-ticker.C:
 			// Hop to next channel
@@ -310,13 +596,16 @@ func runManual(fh *fhss.FHSS, device *yardstick.Device, dwellMs int, verbose boo
 			}
 
 			hopCount++
-			fmt.Printf("Hop #%d -> Channel %d\n", hopCount, ch)
+			fmt.Fprintf(out, "Hop #%d -> Channel %d\n", hopCount, ch)
+			if format.IsJSON() {
+				output.WriteLine(&hopRecord{Type: "hop", Time: time.Now(), Hop: hopCount, Channel: ch})
+			}
 
 			// Optionally get MAC data for debugging
 			if verbose {
 				macData, err := fh.GetMACData()
 				if err == nil {
-					fmt.Printf("  State: %s, ChanIdx: %d, Hops: %d\n",
+					fmt.Fprintf(out, "  State: %s, ChanIdx: %d, Hops: %d\n",
 						macData.State, macData.CurChanIdx, macData.NumChannelHops)
 				}
 			}
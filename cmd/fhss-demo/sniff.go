@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/fhss"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// sniffRecord is a sniffed packet in -output json mode
+type sniffRecord struct {
+	Type string `json:"type"` // "packet"
+	*fhss.SniffedPacket
+	Data string `json:"data"` // Hex
+}
+
+// sniffSummary ends a sniff in -output json mode
+type sniffSummary struct {
+	Type string `json:"type"` // "summary"
+	fhss.SnifferStats
+	Channels int      `json:"channels"`
+	Ordered  bool     `json:"ordered"`
+	HopOrder []uint32 `json:"hop_order_hz,omitempty"` // Learned so far, when not given in order
+}
+
+// parseFrequencies parses a comma-separated list of MHz values
+func parseFrequencies(list string) ([]uint32, error) {
+	var freqs []uint32
+	for _, f := range strings.Split(list, ",") {
+		mhz, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || mhz <= 0 {
+			return nil, fmt.Errorf("invalid frequency %q in -hop-freqs", f)
+		}
+		freqs = append(freqs, uint32(mhz*1e6+0.5))
+	}
+	return freqs, nil
+}
+
+// loadHopper returns the last frequency hopper in an rf-scanner
+// -output json file
+func loadHopper(path string) (*scanner.FHSSSignal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+	}
+	defer f.Close()
+
+	var last *scanner.FHSSSignal
+	lines := bufio.NewScanner(f)
+	lines.Buffer(nil, 1<<20)
+	for lines.Scan() {
+		var rec struct {
+			Type string `json:"type"`
+			scanner.FHSSSignal
+		}
+		if json.Unmarshal(lines.Bytes(), &rec) != nil || rec.Type != "fhss" {
+			continue
+		}
+		sig := rec.FHSSSignal
+		last = &sig
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, exitcode.Errorf(exitcode.ConfigInvalid, "no frequency hopper (type \"fhss\") in %s", path)
+	}
+	return last, nil
+}
+
+func runSniff(sniffer *fhss.Sniffer, verbose bool, sigChan chan os.Signal) {
+	fmt.Fprintln(out, "=== FHSS Sniffer Mode ===")
+	fmt.Fprintf(out, "Channels: %d", len(sniffer.Channels))
+	if sniffer.Ordered {
+		fmt.Fprint(out, " in hop order")
+	}
+	fmt.Fprintf(out, ", dwell time: %v\n", sniffer.Dwell)
+	fmt.Fprintln(out, "Press Ctrl+C to stop")
+	fmt.Fprintln(out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-sigChan
+		fmt.Fprintln(out, "\nStopping sniffer...")
+		cancel()
+	}()
+
+	lastSyncs := 0
+	err := sniffer.Run(ctx, func(p *fhss.SniffedPacket) error {
+		if s := sniffer.Stats(); s.Syncs != lastSyncs {
+			lastSyncs = s.Syncs
+			if verbose {
+				fmt.Fprintf(out, "Caught the hopper on %.3f MHz\n", float64(p.FrequencyHz)/1e6)
+			}
+		}
+		fmt.Fprintf(out, "[hop %d] %.3f MHz %.1f dBm: %q\n", p.Slot, float64(p.FrequencyHz)/1e6, p.RSSI, p.Data)
+		if format.IsJSON() {
+			output.WriteLine(&sniffRecord{Type: "packet", SniffedPacket: p, Data: hex.EncodeToString(p.Data)})
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+
+	s := sniffer.Stats()
+	if format.IsJSON() {
+		sum := &sniffSummary{Type: "summary", SnifferStats: s, Channels: len(sniffer.Channels), Ordered: sniffer.Ordered}
+		if !sniffer.Ordered {
+			sum.HopOrder = sniffer.Sequence()
+		}
+		output.WriteLine(sum)
+		return
+	}
+	fmt.Fprintf(out, "\n--- Sniffer statistics ---\n")
+	fmt.Fprintf(out, "Packets:      %d (%d repeats dropped)\n", s.Packets, s.Duplicates)
+	fmt.Fprintf(out, "Hops:         %d followed, %d missed, caught %d times\n", s.Follows, s.Misses, s.Syncs)
+	if !sniffer.Ordered {
+		seq := sniffer.Sequence()
+		mhz := make([]string, len(seq))
+		for i, f := range seq {
+			mhz[i] = fmt.Sprintf("%.3f", float64(f)/1e6)
+		}
+		fmt.Fprintf(out, "Hop order:    %d of %d channels learned: %s\n", len(seq), len(sniffer.Channels), strings.Join(mhz, " "))
+	}
+}
+
+// sniffChannels returns the frequencies of a gocat hop sequence: channel
+// numbers over the configured base frequency and channel spacing
+func sniffChannels(device *yardstick.Device, baseHz uint32, channels []uint8) ([]uint32, error) {
+	spacing, err := device.GetChannelSpacing()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channel spacing: %w", err)
+	}
+	freqs := make([]uint32, len(channels))
+	for i, ch := range channels {
+		freqs[i] = baseHz + uint32(ch)*spacing
+	}
+	return freqs, nil
+}
+
+// newSniffer sets up -mode sniff from -hop-freqs, -hopper or else the
+// configured hop sequence
+func newSniffer(device *yardstick.Device, hopFreqs, hopperFile string, ordered bool, baseHz uint32, channels []uint8, dwell time.Duration, dwellSet bool) (*fhss.Sniffer, error) {
+	var s *fhss.Sniffer
+	switch {
+	case hopFreqs != "":
+		freqs, err := parseFrequencies(hopFreqs)
+		if err != nil {
+			return nil, exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+		s = fhss.NewSniffer(device, freqs, ordered, dwell)
+	case hopperFile != "":
+		sig, err := loadHopper(hopperFile)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Hopper from %s: %s\n", hopperFile, sig)
+		s = fhss.NewSnifferFromHopper(device, sig)
+		if dwellSet {
+			s.Dwell = dwell
+		}
+	default:
+		freqs, err := sniffChannels(device, baseHz, channels)
+		if err != nil {
+			return nil, err
+		}
+		s = fhss.NewSniffer(device, freqs, true, dwell)
+	}
+	return s, s.Validate()
+}
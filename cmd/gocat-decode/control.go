@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/annotate"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/control"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// monitor feeds live packets to the pipeline and holds the runtime state
+// that can be changed over the control socket
+type monitor struct {
+	pipeline *annotate.Pipeline
+	started  time.Time
+
+	mu          sync.Mutex
+	device      *yardstick.Device
+	partNum     uint8
+	paused      bool
+	received    int
+	passed      int
+	lastPacket  time.Time
+	protocols   map[string]*protocolStats
+	watchlist   map[string]*watchStats          // Protocols that raise an alert, by name
+	noise       map[string]*rxstream.NoiseStats // Per configuration
+	current     *rxstream.NoiseStats
+	stream      *rxstream.Stream
+	window      string
+	config      string
+	capture     *annotate.JSONSink
+	capturePath string
+	captureLeft int
+}
+
+// protocolStats is the history of one decoded protocol
+type protocolStats struct {
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// watchStats counts the packets of a watched protocol since it was added
+type watchStats struct {
+	Hits     int       `json:"hits"`
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+// monitorState is the part of the monitor saved by -state checkpoints
+type monitorState struct {
+	Received   int                       `json:"received"`
+	Passed     int                       `json:"passed"`
+	LastPacket time.Time                 `json:"last_packet,omitempty"`
+	Protocols  map[string]*protocolStats `json:"protocols,omitempty"`
+	Watchlist  map[string]*watchStats    `json:"watchlist,omitempty"`
+}
+
+// status is the reply to the "status" command
+type status struct {
+	Uptime      string                    `json:"uptime"`
+	Paused      bool                      `json:"paused"`
+	Received    int                       `json:"received"`
+	Passed      int                       `json:"passed"`
+	LastPacket  time.Time                 `json:"last_packet,omitempty"`
+	Window      string                    `json:"window,omitempty"`
+	Config      string                    `json:"config,omitempty"`
+	Stages      []string                  `json:"stages"`
+	Protocols   map[string]*protocolStats `json:"protocols,omitempty"`
+	Watchlist   map[string]*watchStats    `json:"watchlist,omitempty"`
+	Noise       []rxstream.NoiseReport    `json:"noise,omitempty"`
+	Capture     string                    `json:"capture,omitempty"`
+	CaptureLeft int                       `json:"capture_left,omitempty"`
+}
+
+// radioStatus is the reply to the "radio" command
+type radioStatus struct {
+	FrequencyMHz float64 `json:"frequency_mhz"`
+	DataRateBaud float64 `json:"data_rate_baud"`
+	Modulation   string  `json:"modulation"`
+	SyncWord     string  `json:"sync_word"`
+	PktLen       uint8   `json:"pkt_len"`
+	LengthMode   uint8   `json:"length_mode"`
+}
+
+// thresholdArgs are the arguments to and reply of the "threshold" command
+type thresholdArgs struct {
+	SquelchDBm *int `json:"squelch_dbm"` // Drop packets below this RSSI (0 = off)
+}
+
+// watchlistArgs are the arguments to the "watchlist" command
+type watchlistArgs struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// captureArgs are the arguments to the "capture" command
+type captureArgs struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"` // Records to write (0 = until stop-capture)
+}
+
+func newMonitor(pipeline *annotate.Pipeline) *monitor {
+	return &monitor{
+		pipeline:  pipeline,
+		started:   time.Now(),
+		protocols: make(map[string]*protocolStats),
+		watchlist: make(map[string]*watchStats),
+		noise:     make(map[string]*rxstream.NoiseStats),
+	}
+}
+
+// snapshot returns the state to checkpoint
+func (m *monitor) snapshot() interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &monitorState{
+		Received:   m.received,
+		Passed:     m.passed,
+		LastPacket: m.lastPacket,
+		Protocols:  m.copyProtocolsLocked(),
+		Watchlist:  m.copyWatchlistLocked(),
+	}
+}
+
+// copyProtocolsLocked copies the protocol history so it can be encoded
+// after the lock is released
+func (m *monitor) copyProtocolsLocked() map[string]*protocolStats {
+	protocols := make(map[string]*protocolStats, len(m.protocols))
+	for name, st := range m.protocols {
+		copied := *st
+		protocols[name] = &copied
+	}
+	return protocols
+}
+
+// copyWatchlistLocked copies the watchlist, like copyProtocolsLocked
+func (m *monitor) copyWatchlistLocked() map[string]*watchStats {
+	watchlist := make(map[string]*watchStats, len(m.watchlist))
+	for name, st := range m.watchlist {
+		copied := *st
+		watchlist[name] = &copied
+	}
+	return watchlist
+}
+
+// restore resumes from a checkpoint
+func (m *monitor) restore(st *monitorState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received = st.Received
+	m.passed = st.Passed
+	m.lastPacket = st.LastPacket
+	if st.Protocols != nil {
+		m.protocols = st.Protocols
+	}
+	if st.Watchlist != nil {
+		m.watchlist = st.Watchlist
+	}
+}
+
+// run processes packets until the channel closes
+func (m *monitor) run(packets <-chan *rxstream.Packet) {
+	for pkt := range packets {
+		m.mu.Lock()
+		if m.paused {
+			m.mu.Unlock()
+			continue
+		}
+		m.received++
+		m.lastPacket = pkt.Timestamp
+		m.mu.Unlock()
+
+		rec := annotate.NewRecord(pkt)
+		ok, err := m.pipeline.Process(rec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if ok {
+			m.recordPassed(rec)
+		} else if err == nil {
+			m.recordNoMatch(pkt)
+		}
+	}
+}
+
+func (m *monitor) recordPassed(rec *annotate.Record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.passed++
+	if rec.Protocol != "" {
+		st := m.protocols[rec.Protocol]
+		if st == nil {
+			st = &protocolStats{FirstSeen: rec.Timestamp}
+			m.protocols[rec.Protocol] = st
+		}
+		st.Count++
+		st.LastSeen = rec.Timestamp
+		if w := m.watchlist[rec.Protocol]; w != nil {
+			w.Hits++
+			w.LastSeen = rec.Timestamp
+			fmt.Fprintf(os.Stderr, "%s: watchlist: %s heard\n", rec.Timestamp.Format("15:04:05"), rec.Protocol)
+		}
+	}
+	if m.capture == nil {
+		return
+	}
+	if err := m.capture.Write(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: capture: %v\n", err)
+	}
+	if m.captureLeft > 0 {
+		m.captureLeft--
+		if m.captureLeft == 0 {
+			m.stopCaptureLocked()
+		}
+	}
+}
+
+func (m *monitor) recordNoMatch(pkt *rxstream.Packet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != nil {
+		m.current.NoMatch(pkt)
+	}
+}
+
+// setDevice records the radio for the "radio" command
+func (m *monitor) setDevice(device *yardstick.Device) {
+	partNum, _ := device.GetPartNum()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.device = device
+	m.partNum = partNum
+}
+
+// setWindow records the active schedule window for status and switches
+// the stream's noise counters to the window's configuration
+func (m *monitor) setWindow(stream *rxstream.Stream, window, config string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.window = window
+	m.config = config
+
+	noise := m.noise[config]
+	if noise == nil {
+		noise = rxstream.NewNoiseStats(config)
+		m.noise[config] = noise
+	}
+	m.current = noise
+	m.stream = stream
+	stream.SetNoiseStats(noise)
+}
+
+func (m *monitor) stopCaptureLocked() int {
+	if m.capture == nil {
+		return 0
+	}
+	m.capture.Close()
+	m.capture = nil
+	m.capturePath = ""
+	left := m.captureLeft
+	m.captureLeft = 0
+	return left
+}
+
+// noiseReportsLocked returns noise statistics for every configuration used
+func (m *monitor) noiseReportsLocked() []rxstream.NoiseReport {
+	reports := make([]rxstream.NoiseReport, 0, len(m.noise))
+	for _, n := range m.noise {
+		reports = append(reports, n.Report())
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Profile < reports[j].Profile })
+	return reports
+}
+
+// register adds the monitor's commands to a control server
+func (m *monitor) register(s *control.Server) {
+	s.Handle("status", "Show counters and current state", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return &status{
+			Uptime:      time.Since(m.started).Round(time.Second).String(),
+			Paused:      m.paused,
+			Received:    m.received,
+			Passed:      m.passed,
+			LastPacket:  m.lastPacket,
+			Window:      m.window,
+			Config:      m.config,
+			Stages:      m.pipeline.Stages(),
+			Protocols:   m.copyProtocolsLocked(),
+			Watchlist:   m.copyWatchlistLocked(),
+			Noise:       m.noiseReportsLocked(),
+			Capture:     m.capturePath,
+			CaptureLeft: m.captureLeft,
+		}, nil
+	})
+
+	s.Handle("radio", "Show the configuration last applied to the radio", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		device, partNum := m.device, m.partNum
+		m.mu.Unlock()
+		if device == nil {
+			return nil, fmt.Errorf("no device open")
+		}
+		// Answered from the host-side cache; the receive loop owns the USB link
+		regs, ok := config.Cached(device)
+		if !ok {
+			return nil, fmt.Errorf("radio configuration unknown (registers changed since last apply)")
+		}
+		cfg := &config.DeviceConfig{PartNum: partNum, Registers: *regs}
+		return &radioStatus{
+			FrequencyMHz: cfg.GetFrequencyMHz(),
+			DataRateBaud: cfg.GetDataRateBaud(),
+			Modulation:   cfg.GetModulationString(),
+			SyncWord:     fmt.Sprintf("0x%04X", cfg.GetSyncWord()),
+			PktLen:       regs.PKTLEN,
+			LengthMode:   regs.PKTCTRL0 & 0x03,
+		}, nil
+	})
+
+	s.Handle("threshold", `Show or set the RSSI squelch: {"squelch_dbm": N} (0 = off)`, func(raw json.RawMessage) (interface{}, error) {
+		var args thresholdArgs
+		if raw != nil {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+		m.mu.Lock()
+		stream := m.stream
+		m.mu.Unlock()
+		if stream == nil {
+			return nil, fmt.Errorf("not receiving")
+		}
+		_, maxDBm := stream.Squelch()
+		if args.SquelchDBm != nil {
+			stream.SetSquelch(*args.SquelchDBm, maxDBm)
+		}
+		minDBm, _ := stream.Squelch()
+		return &thresholdArgs{SquelchDBm: &minDBm}, nil
+	})
+
+	s.Handle("watchlist", `Show or change the protocols that raise an alert: {"add": [...], "remove": [...]}`, func(raw json.RawMessage) (interface{}, error) {
+		var args watchlistArgs
+		if raw != nil {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+		for _, name := range args.Add {
+			if name == "" {
+				return nil, fmt.Errorf("empty protocol name")
+			}
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, name := range args.Add {
+			if m.watchlist[name] == nil {
+				m.watchlist[name] = &watchStats{}
+			}
+		}
+		for _, name := range args.Remove {
+			delete(m.watchlist, name)
+		}
+		return m.copyWatchlistLocked(), nil
+	})
+
+	s.Handle("pause", "Stop decoding received packets", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.paused = true
+		return nil, nil
+	})
+
+	s.Handle("resume", "Resume decoding", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.paused = false
+		return nil, nil
+	})
+
+	s.Handle("flush", "Reset packet counters, protocol history, watchlist hits and noise statistics", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.received, m.passed = 0, 0
+		m.lastPacket = time.Time{}
+		m.protocols = make(map[string]*protocolStats)
+		for name := range m.watchlist {
+			m.watchlist[name] = &watchStats{}
+		}
+		for name, n := range m.noise {
+			fresh := rxstream.NewNoiseStats(name)
+			m.noise[name] = fresh
+			if n == m.current {
+				m.current = fresh
+				m.stream.SetNoiseStats(fresh)
+			}
+		}
+		return nil, nil
+	})
+
+	s.Handle("capture", `Write decoded records to a file: {"path": "...", "count": N}`, func(raw json.RawMessage) (interface{}, error) {
+		var args captureArgs
+		if raw != nil {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+		if args.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		sink, err := annotate.CreateJSONSink(args.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.stopCaptureLocked()
+		m.capture = sink
+		m.capturePath = args.Path
+		m.captureLeft = args.Count
+		return nil, nil
+	})
+
+	s.Handle("stop-capture", "Close the capture file", func(json.RawMessage) (interface{}, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.capture == nil {
+			return nil, fmt.Errorf("no capture in progress")
+		}
+		m.stopCaptureLocked()
+		return nil, nil
+	})
+}
+
+// close ends any capture in progress
+func (m *monitor) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopCaptureLocked()
+}
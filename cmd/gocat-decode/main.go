@@ -0,0 +1,380 @@
+// gocat-decode: Run the packet annotation pipeline on live or captured traffic
+//
+// In live mode packets are received from a YardStick One configured from a
+// JSON configuration file. In offline mode packets are read from a capture
+// file instead, so a single field capture can be re-analyzed repeatedly as
+// decoders improve. Both modes use the same pipeline declaration.
+//
+// With -output json each decoded frame is written to stdout as one
+// annotate.Record object per line; progress and warnings go to stderr.
+//
+// Examples:
+//
+//	# Live decode
+//	./gocat-decode -c etc/defaults.json -p etc/annotate/example.json
+//
+//	# Offline decode of send-recv -raw output
+//	./gocat-decode -i capture.hex -p etc/annotate/example.json
+//
+//	# Offline decode of a Flipper Zero RAW capture, JSON output
+//	./gocat-decode -i remote.sub -p etc/annotate/example.json -output json
+//
+//	# Inspect repeated button presses with diff highlighting
+//	./gocat-decode -i remote.sub -inspect -color
+//
+//	# Unattended monitoring with per-window configurations
+//	./gocat-decode -c etc/defaults.json -schedule etc/schedule/example.json
+//
+//	# Live decode with a control socket for runtime commands
+//	./gocat-decode -c etc/defaults.json -control /tmp/decode.sock
+//	./gocat ctl -s /tmp/decode.sock status
+//	./gocat ctl -s /tmp/decode.sock threshold '{"squelch_dbm":-90}'
+//	./gocat ctl -s /tmp/decode.sock watchlist '{"add":["somfy"]}'
+//
+//	# Forward decoded records to an external sink plugin
+//	./gocat-decode -i capture.hex -p etc/annotate/example.json -sink-plugin ./my-uploader
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/annotate"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/checkpoint"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/control"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/inspect"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/plugin"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/schedule"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func main() {
+	inputPath := flag.String("i", "", "Capture file to decode (offline mode)")
+	inFormat := flag.String("format", "auto", "Capture format: auto, "+strings.Join(capture.Formats, ", "))
+	pipelinePath := flag.String("p", "", "Annotation pipeline config (JSON); empty = no stages")
+	configPath := flag.String("c", "", "Radio configuration file (live mode)")
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage+" (json: one record per line)")
+	jsonOutput := flag.Bool("json", false, "Same as -output json (deprecated)")
+	inspectOutput := flag.Bool("inspect", false, "Output hex/ASCII/binary/pulse inspector view with diff against previous packet")
+	color := flag.Bool("color", false, "Highlight inspector diffs with ANSI colors")
+	schedPath := flag.String("schedule", "", "Schedule file (JSON) with active windows for live mode")
+	controlPath := flag.String("control", "", "Control socket path for runtime commands in live mode (see 'gocat ctl')")
+	dedupe := flag.Duration("dedupe", 0, "Drop repeats of the same frame within this window in live mode (e.g. 500ms)")
+	squelch := flag.Int("squelch", 0, "Drop packets received below this RSSI in dBm in live mode (0 = off)")
+	statePath := flag.String("state", "", "Checkpoint file for live-mode counters and protocol history")
+	sinkPlugin := flag.String("sink-plugin", "", "External sink plugin command (with arguments) to receive decoded records")
+	verbose := flag.Bool("v", false, "Verbose output")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s (-i <capture> | -c <config.json>) [-p <pipeline.json>] [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Decode live or captured packets through an annotation pipeline\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -c etc/defaults.json -p etc/annotate/example.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i capture.hex -p etc/annotate/example.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i remote.sub -output json\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if *inputPath == "" && *configPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: Either a capture file (-i) or a configuration file (-c) is required")
+		flag.Usage()
+		os.Exit(exitcode.Usage)
+	}
+	if *inputPath != "" && *configPath != "" {
+		fmt.Fprintln(os.Stderr, "Error: -i and -c are mutually exclusive")
+		os.Exit(exitcode.Usage)
+	}
+	if *jsonOutput {
+		format = output.JSON
+	}
+	if *inspectOutput && format.IsJSON() {
+		fmt.Fprintln(os.Stderr, "Error: -inspect is a text view and can't be combined with -output json")
+		os.Exit(exitcode.Usage)
+	}
+
+	var sink annotate.Sink
+	switch {
+	case *inspectOutput:
+		opts := inspect.DefaultOptions()
+		opts.Color = *color
+		opts.ShowPulses = true
+		sink = inspect.NewSink(os.Stdout, opts)
+	case format.IsJSON():
+		sink = annotate.NewJSONSink(os.Stdout)
+	default:
+		sink = annotate.NewTextSink(os.Stdout)
+	}
+
+	pipeline, err := buildPipeline(*pipelinePath, sink)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to load pipeline: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer pipeline.Close()
+
+	if strings.TrimSpace(*sinkPlugin) != "" {
+		parts := strings.Fields(*sinkPlugin)
+		ps, err := plugin.NewSink(parts[0], parts[1:]...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		pipeline.AddSink(ps)
+	}
+
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "Pipeline stages: %s\n", strings.Join(pipeline.Stages(), " -> "))
+	}
+
+	if *inputPath != "" {
+		err = runOffline(pipeline, *inputPath, *inFormat, *verbose)
+	} else {
+		var sched *schedule.Schedule
+		if *schedPath != "" {
+			if sched, err = schedule.LoadConfig(*schedPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to load schedule: %v\n", err)
+				os.Exit(exitcode.Of(err))
+			}
+		}
+		mon := newMonitor(pipeline)
+		defer mon.close()
+		if *statePath != "" {
+			var st monitorState
+			if ok, err := checkpoint.Load(*statePath, &st); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to restore state: %v\n", err)
+			} else if ok {
+				mon.restore(&st)
+				if *verbose {
+					fmt.Fprintf(os.Stderr, "Restored state: %d packets, %d protocols\n", st.Received, len(st.Protocols))
+				}
+			}
+			saver := checkpoint.NewSaver(*statePath, 0, mon.snapshot, func(err error) {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to save state: %v\n", err)
+			})
+			saver.Start()
+			// The error exits below go through checkpoint.Exit, which
+			// also stops the saver
+			defer func() {
+				if err := saver.Stop(); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Failed to save state: %v\n", err)
+				}
+			}()
+		}
+		if *controlPath != "" {
+			server := control.NewServer()
+			mon.register(server)
+			if err := server.Listen(*controlPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				checkpoint.Exit(exitcode.Of(err))
+			}
+			defer server.Close()
+		}
+		err = runLive(mon, *configPath, *deviceSel, sched, &rxstream.Options{Dedupe: *dedupe, SquelchMin: *squelch}, *verbose)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		checkpoint.Exit(exitcode.Of(err))
+	}
+}
+
+func buildPipeline(path string, sink annotate.Sink) (*annotate.Pipeline, error) {
+	pipeline := annotate.NewPipeline()
+	if path != "" {
+		cfg, err := annotate.LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		pipeline, err = annotate.Build(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pipeline.AddSink(sink)
+	return pipeline, nil
+}
+
+func runOffline(pipeline *annotate.Pipeline, path, format string, verbose bool) error {
+	reader, err := capture.Open(path, format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	total, passed := 0, 0
+	for {
+		pkt, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read capture: %w", err)
+		}
+		total++
+
+		rec := annotate.NewRecordFromBytes(pkt.Data, pkt.Timestamp)
+		rec.Pulses = pkt.Pulses
+		if pkt.Frequency != 0 {
+			rec.Set("frequency_hz", pkt.Frequency)
+		}
+		ok, err := pipeline.Process(rec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: packet %d: %v\n", total, err)
+		}
+		if ok {
+			passed++
+		}
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Decoded %d of %d packets\n", passed, total)
+	}
+	return nil
+}
+
+func runLive(mon *monitor, configPath, deviceSel string, sched *schedule.Schedule, opts *rxstream.Options, verbose bool) error {
+	configuration, err := config.LoadFromFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create USB context
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(deviceSel))
+	if err != nil {
+		return err
+	}
+	defer device.Close()
+	mon.setDevice(device)
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Connected to: %s (Serial: %s)\n", device.Product, device.Serial)
+	}
+
+	// Force IDLE state first
+	if err := device.PokeByte(0xDFE1, 0x04); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to strobe IDLE: %v\n", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := config.ApplyToDevice(device, configuration); err != nil {
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+
+	if err := device.EnableAmplifier(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to enable amplifiers: %v\n", err)
+	}
+
+	stream := rxstream.New(device, opts)
+	if sched != nil {
+		return runScheduled(mon, device, stream, configPath, sched, verbose)
+	}
+	mon.setWindow(stream, "", configPath)
+	if err := stream.Start(); err != nil {
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		stream.Stop()
+	}()
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Listening on %.6f MHz (Ctrl+C to stop)...\n", configuration.GetFrequencyMHz())
+	}
+
+	mon.run(stream.Packets())
+	return nil
+}
+
+// runScheduled receives only while a schedule window is active, applying
+// each window's configuration as it opens
+func runScheduled(mon *monitor, device *yardstick.Device, stream *rxstream.Stream, defaultConfig string, sched *schedule.Schedule, verbose bool) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	current := defaultConfig
+	var done chan struct{}
+	stop := func() {
+		if done != nil {
+			stream.Stop()
+			<-done
+			done = nil
+		}
+	}
+	defer stop()
+
+	for {
+		now := time.Now()
+		want := sched.Monitoring(now)
+		configPath := defaultConfig
+		name := "default"
+		if w := sched.Active(now); w != nil {
+			name = w.Name
+			if w.Config != "" {
+				configPath = w.Config
+			}
+		}
+
+		if done != nil && (!want || configPath != current) {
+			stop()
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s: monitoring paused\n", now.Format("15:04:05"))
+			}
+		}
+
+		if want && done == nil {
+			if configPath != current {
+				configuration, err := config.LoadFromFile(configPath)
+				if err != nil {
+					return fmt.Errorf("window %s: failed to load configuration: %w", name, err)
+				}
+				if err := config.ApplyToDevice(device, configuration); err != nil {
+					return fmt.Errorf("window %s: failed to apply configuration: %w", name, err)
+				}
+				current = configPath
+			}
+			mon.setWindow(stream, name, configPath)
+			if err := stream.Start(); err != nil {
+				return err
+			}
+			done = make(chan struct{})
+			go func(packets <-chan *rxstream.Packet, done chan struct{}) {
+				defer close(done)
+				mon.run(packets)
+			}(stream.Packets(), done)
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s: monitoring (%s, %s)\n", now.Format("15:04:05"), name, configPath)
+			}
+		}
+
+		select {
+		case <-sigChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
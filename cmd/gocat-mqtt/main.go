@@ -0,0 +1,301 @@
+// gocat-mqtt: Bridge a YardStick One to an MQTT broker
+//
+// Each received packet runs through an optional annotation pipeline
+// (-p, as in gocat-decode) and is published as JSON to <prefix>/rx; every
+// protocol pkg/identify recognizes in it with at least -min-confidence is
+// published to <prefix>/decoded/<protocol>. Payloads published to
+// <prefix>/tx, as bare hex or {"data": "<hex>", "repeat": n}, are
+// transmitted. <prefix>/status is a retained "online" or "offline".
+// Topic names, credentials and QoS can be set in a JSON file (-bridge,
+// see pkg/bridge/mqtt.Config).
+//
+// Examples:
+//
+//	# Keyfob presses into Home Assistant's broker
+//	./gocat-mqtt -broker tcp://homeassistant.local:1883 -profile 433-ook-keyfob-2.4k -prefix gocat/garage
+//
+//	# Receive only, topics from a file
+//	./gocat-mqtt -bridge etc/mqtt/example.json -c etc/defaults.json -no-tx
+//
+//	# Send a payload through the bridge
+//	mosquitto_pub -t gocat/tx -m '{"data": "aaaa5555", "repeat": 3}'
+//
+// With -output json a status object is written to stdout once bridging
+// starts and again, with the final counters, when it stops.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/annotate"
+	mqttbridge "github.com/herlein/gocat/pkg/bridge/mqtt"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/identify"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// pollInterval is how long each receive waits before queued transmits run
+const pollInterval = 100 * time.Millisecond
+
+// bridgeStatus is the -output json status, one object per line
+type bridgeStatus struct {
+	State       string `json:"state"` // bridging, then stopped
+	Device      string `json:"device"`
+	Broker      string `json:"broker"`
+	Prefix      string `json:"prefix"`
+	Transmit    bool   `json:"transmit"`
+	Received    int    `json:"received"`
+	Decoded     int    `json:"decoded"` // Decoded candidates published
+	Transmitted int    `json:"transmitted"`
+}
+
+func main() {
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := flag.String("c", "", "Configuration file to apply")
+	profileName := flag.String("profile", "", "Built-in profile name or profile file to apply")
+	freqMHz := flag.Float64("f", 0, "Frequency in MHz (default: keep the configured frequency)")
+	bridgePath := flag.String("bridge", "", "Bridge configuration (JSON): broker, credentials, topics")
+	broker := flag.String("broker", "", "Broker URL, e.g. tcp://localhost:1883 (overrides -bridge)")
+	prefix := flag.String("prefix", "", "Topic prefix (default: gocat)")
+	pipelinePath := flag.String("p", "", "Annotation pipeline config (JSON); empty = no stages")
+	minConfidence := flag.Float64("min-confidence", 0.5, "Publish decoded candidates at least this confident (0-1)")
+	noTX := flag.Bool("no-tx", false, "Don't subscribe to the transmit topic")
+	verbose := flag.Bool("v", false, "Print each packet and transmit")
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage+" (json writes status when bridging starts and stops)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Bridge a YardStick One to an MQTT broker\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -broker tcp://localhost:1883 -profile 433-ook-keyfob-2.4k\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -bridge etc/mqtt/example.json -c etc/defaults.json -no-tx\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if (*configPath == "") == (*profileName == "") {
+		fmt.Fprintf(os.Stderr, "Error: Exactly one of -c or -profile is required\n")
+		os.Exit(exitcode.Usage)
+	}
+	bridgeCfg := &mqttbridge.Config{}
+	if *bridgePath != "" {
+		var err error
+		if bridgeCfg, err = mqttbridge.LoadConfig(*bridgePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.ConfigInvalid)
+		}
+	}
+	if *broker != "" {
+		bridgeCfg.Broker = *broker
+	}
+	if *prefix != "" {
+		bridgeCfg.Prefix = *prefix
+	}
+	if bridgeCfg.Broker == "" {
+		fmt.Fprintf(os.Stderr, "Error: -broker or a -bridge file naming one is required\n")
+		os.Exit(exitcode.Usage)
+	}
+
+	pipeline := annotate.NewPipeline()
+	if *pipelinePath != "" {
+		pcfg, err := annotate.LoadConfig(*pipelinePath)
+		if err == nil {
+			pipeline, err = annotate.Build(pcfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid pipeline: %v\n", err)
+			os.Exit(exitcode.ConfigInvalid)
+		}
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	if err := apply(device, *configPath, *profileName, *freqMHz); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.ConfigInvalid)
+	}
+	burst, err := burstTemplate(device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read radio settings: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+
+	bridge, err := mqttbridge.Connect(bridgeCfg, !*noTX, func(err error) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Failure)
+	}
+	pipeline.AddSink(bridge)
+	defer pipeline.Close()
+
+	lease, err := device.Acquire(yardstick.ModeRX, "gocat-mqtt")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer lease.Release()
+	device = lease.Device()
+	if err := device.SetModeRX(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to enter RX mode: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg := bridge.Config()
+	fmt.Fprintf(os.Stderr, "Bridging %s to %s as %s/# (Ctrl+C to stop)\n", device, cfg.Broker, cfg.Prefix)
+	st := &bridgeStatus{State: "bridging", Device: device.Serial, Broker: cfg.Broker, Prefix: cfg.Prefix, Transmit: !*noTX}
+	if format.IsJSON() {
+		output.WriteLine(st)
+	}
+	received, decoded, sent := 0, 0, 0
+	for sigCtx.Err() == nil {
+		select {
+		case t := <-bridge.Transmits():
+			if err := transmit(device, t); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			} else {
+				sent++
+				if *verbose {
+					fmt.Fprintf(os.Stderr, "%s TX %X (repeat %d)\n", time.Now().Format("15:04:05.000"), t.Data, t.Repeat)
+				}
+			}
+			continue
+		default:
+		}
+
+		data, err := device.RFRecv(pollInterval, 0)
+		if err != nil || len(data) == 0 {
+			// Timeout is normal
+			continue
+		}
+		pkt := rxstream.Process(data, nil)
+		pkt.Timestamp = time.Now()
+		if rssi, err := device.GetRSSI(); err == nil {
+			pkt.RSSI = yardstick.RSSIToDBm(rssi)
+			pkt.RSSIValid = true
+		}
+		received++
+
+		rec := annotate.NewRecord(pkt)
+		ok, err := pipeline.Process(rec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if !ok {
+			continue
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "%s RX %X\n", rec.Timestamp.Format("15:04:05.000"), rec.Raw)
+		}
+		b := *burst
+		b.Data = rec.Data
+		for _, c := range identify.Identify(&b) {
+			if c.Confidence < *minConfidence {
+				continue
+			}
+			decoded++
+			if err := bridge.PublishDecoded(rec, c); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "%s %s %s\n", rec.Timestamp.Format("15:04:05.000"), c.Protocol, c.Summary)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\nReceived %d packets, published %d decoded, transmitted %d\n", received, decoded, sent)
+	if format.IsJSON() {
+		st.State, st.Received, st.Decoded, st.Transmitted = "stopped", received, decoded, sent
+		output.WriteLine(st)
+	}
+}
+
+// apply configures the radio from a configuration or profile
+func apply(device *yardstick.Device, configPath, profileName string, freqMHz float64) error {
+	switch {
+	case configPath != "":
+		c, err := config.LoadFromFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := config.ApplyToDevice(device, c); err != nil {
+			return fmt.Errorf("failed to apply configuration: %w", err)
+		}
+	case profiles.Find(profileName) != nil:
+		if err := config.ApplyProfile(device, profiles.Find(profileName)); err != nil {
+			return fmt.Errorf("failed to apply profile: %w", err)
+		}
+	default:
+		pc, err := profiles.LoadProfileFromFile(profileName)
+		if err != nil {
+			return fmt.Errorf("unknown profile '%s': %w", profileName, err)
+		}
+		if err := config.ApplyToDevice(device, &config.DeviceConfig{Serial: device.Serial, Registers: pc.Registers}); err != nil {
+			return fmt.Errorf("failed to apply profile: %w", err)
+		}
+	}
+	if freqMHz > 0 {
+		if err := device.Retune(uint32(freqMHz * 1e6)); err != nil {
+			return fmt.Errorf("failed to set frequency: %w", err)
+		}
+	}
+	return nil
+}
+
+// burstTemplate describes packets as the radio is now configured to
+// receive them: the data rate OOK decoders sample at and the sync word
+// FSK decoders look behind
+func burstTemplate(device *yardstick.Device) (*identify.Burst, error) {
+	rate, err := device.GetDataRate()
+	if err != nil {
+		return nil, err
+	}
+	regs, err := config.Current(device)
+	if err != nil {
+		return nil, err
+	}
+	b := &identify.Burst{SampleRate: rate}
+	// Modes 4 (carrier sense only) and 0 match no sync word
+	if registers.GetSyncMode(regs)&0x03 != registers.SyncNone {
+		b.SyncWord = registers.GetSyncWord(regs)
+	}
+	return b, nil
+}
+
+// transmit sends a request and returns the radio to RX
+func transmit(device *yardstick.Device, t *mqttbridge.Transmit) error {
+	var err error
+	if len(t.Data) > yardstick.RFMaxTXBlock {
+		err = device.RFXmitLong(t.Data)
+	} else {
+		err = device.RFXmit(t.Data, uint16(t.Repeat), 0)
+	}
+	if err != nil {
+		return fmt.Errorf("transmit failed: %w", err)
+	}
+	return device.SetModeRX()
+}
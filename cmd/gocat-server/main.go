@@ -0,0 +1,175 @@
+// gocat-server: Serve a YardStick One over gRPC
+//
+// Exposes the dongle's configure, transmit, receive, scan and spectrum
+// analyzer operations to remote clients, so a dongle on a Raspberry Pi
+// can be driven from another machine. The service is defined in
+// pkg/rpc/gocatpb/gocat.proto and pkg/rpc provides a Go client. Server
+// reflection is enabled, so tools such as grpcurl work without the proto.
+//
+// The server listens on localhost only unless told otherwise, and has no
+// authentication: anyone who can reach the port can drive the radio. Use
+// -no-tx on shared networks, and TLS (-tls-cert, -tls-key) off the host.
+//
+// Examples:
+//
+//	# Local clients only
+//	./gocat-server
+//
+//	# Any host on the network, receive and scan only
+//	./gocat-server -listen :50051 -no-tx
+//
+//	# TLS
+//	./gocat-server -listen :50051 -tls-cert server.crt -tls-key server.key
+//
+// With -output json a status object is written to stdout once serving
+// starts and again when it stops.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/rpc"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// serverStatus is the -output json status, one object per line
+type serverStatus struct {
+	State    string `json:"state"` // serving, then stopped
+	Device   string `json:"device"`
+	Address  string `json:"address"`
+	Transmit bool   `json:"transmit"`
+	TLS      bool   `json:"tls"`
+	Error    string `json:"error,omitempty"`
+}
+
+func main() {
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	listen := flag.String("listen", fmt.Sprintf("localhost:%d", rpc.DefaultPort), "Address to listen on (host:port)")
+	noTX := flag.Bool("no-tx", false, "Refuse Transmit calls")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (PEM)")
+	tlsKey := flag.String("tls-key", "", "TLS private key file (PEM)")
+	verbose := flag.Bool("v", false, "Log each call")
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage+" (json writes status when serving starts and stops)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serve a YardStick One over gRPC\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :50051 -no-tx\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintf(os.Stderr, "Error: -tls-cert and -tls-key must be given together\n")
+		os.Exit(exitcode.Usage)
+	}
+	var opts []grpc.ServerOption
+	if *tlsCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(*tlsCert, *tlsKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to load TLS key pair: %v\n", err)
+			os.Exit(exitcode.ConfigInvalid)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if *verbose {
+		opts = append(opts, grpc.ChainUnaryInterceptor(logUnary), grpc.ChainStreamInterceptor(logStream))
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to listen on %s: %v\n", *listen, err)
+		os.Exit(exitcode.Failure)
+	}
+
+	g := grpc.NewServer(opts...)
+	rpc.NewServer(device, &rpc.Options{NoTransmit: *noTX}).Register(g)
+	reflection.Register(g)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Fprintf(os.Stderr, "\nShutting down\n")
+		// Streams run until cancelled, so don't wait on them for long
+		done := make(chan struct{})
+		go func() {
+			g.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			g.Stop()
+		}
+	}()
+
+	mode := "transmit enabled"
+	if *noTX {
+		mode = "transmit disabled"
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on %s, %s (Ctrl+C to stop)\n", device, lis.Addr(), mode)
+	st := &serverStatus{State: "serving", Device: device.Serial, Address: lis.Addr().String(), Transmit: !*noTX, TLS: *tlsCert != ""}
+	if format.IsJSON() {
+		output.WriteLine(st)
+	}
+	err = g.Serve(lis)
+
+	st.State = "stopped"
+	if err != nil {
+		st.Error = err.Error()
+	}
+	if format.IsJSON() {
+		output.WriteLine(st)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Failure)
+	}
+}
+
+func logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+func logStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+func logCall(method string, start time.Time, err error) {
+	fmt.Fprintf(os.Stderr, "%s %s %s %v\n", start.Format("15:04:05.000"), method, status.Code(err), time.Since(start).Round(time.Millisecond))
+}
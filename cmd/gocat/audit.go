@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/audit"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+)
+
+func init() {
+	register(&command{
+		name:    "audit",
+		summary: "Show what was transmitted, from the transmit audit log",
+		setup:   setupAudit,
+	})
+}
+
+func setupAudit(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	serial := fs.String("d", "", "Only this device serial")
+	since := fs.String("since", "", "Only transmits after this time: RFC 3339 or a duration ago, e.g. 24h")
+	until := fs.String("until", "", "Only transmits before this time: RFC 3339 or a duration ago")
+	freq := fs.String("f", "", "Only this frequency or range in MHz, e.g. 433.92 or 433-435")
+	command := fs.String("command", "", "Only transmits whose invoking command contains this text")
+	failed := fs.Bool("failed", false, "Only transmits that failed")
+	last := fs.Int("n", 0, "Show only the last N matching transmits (0 = all)")
+	file := fs.String("file", "", "Audit log to read (default: GOCAT_AUDIT_LOG or <config dir>/gocat/audit.jsonl)")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s audit [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List transmissions recorded in the transmit audit log. Every transmit made\n")
+		fmt.Fprintf(os.Stderr, "by gocat tools, scripts and library users is logged with its device,\n")
+		fmt.Fprintf(os.Stderr, "frequency, power, payload hash, duration and invoking command. Set\n")
+		fmt.Fprintf(os.Stderr, "GOCAT_AUDIT_LOG to move the log, or to 'off' to disable it.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s audit -since 1h\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s audit -f 433-435 -command fuzz -output json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		f := &audit.Filter{Serial: *serial, Command: *command, Failed: *failed}
+		var err error
+		if f.Since, err = parseAuditTime(*since); err != nil {
+			return exitcode.Errorf(exitcode.Usage, "invalid -since: %v", err)
+		}
+		if f.Until, err = parseAuditTime(*until); err != nil {
+			return exitcode.Errorf(exitcode.Usage, "invalid -until: %v", err)
+		}
+		if *freq != "" {
+			lo, hi, found := strings.Cut(*freq, "-")
+			if !found {
+				hi = lo
+			}
+			a, err1 := strconv.ParseFloat(lo, 64)
+			b, err2 := strconv.ParseFloat(hi, 64)
+			if err1 != nil || err2 != nil || a <= 0 || b < a {
+				return exitcode.Errorf(exitcode.Usage, "invalid -f '%s'", *freq)
+			}
+			// A single frequency matches anything that rounds to it in kHz
+			f.LowHz, f.HighHz = uint32(a*1e6-500), uint32(b*1e6+500)
+		}
+
+		path := *file
+		if path == "" {
+			if path, err = audit.Path(); err != nil {
+				return err
+			}
+			if path == "" {
+				return exitcode.Errorf(exitcode.Usage, "the audit log is disabled (GOCAT_AUDIT_LOG=off); use -file")
+			}
+		}
+		records, err := audit.Query(path, f)
+		if err != nil {
+			return err
+		}
+		if *last > 0 && len(records) > *last {
+			records = records[len(records)-*last:]
+		}
+
+		if format.IsJSON() {
+			if records == nil {
+				records = []*audit.Record{}
+			}
+			return output.Write(records)
+		}
+		if len(records) == 0 {
+			fmt.Printf("No transmits recorded in %s\n", path)
+			return nil
+		}
+		fmt.Printf("%-25s %-12s %11s %8s %6s %10s %-16s %s\n", "Time", "Serial", "MHz", "Power", "Bytes", "Duration", "SHA-256", "Command")
+		for _, r := range records {
+			mhz, power := "-", "-"
+			if r.FrequencyHz > 0 {
+				mhz = fmt.Sprintf("%.4f", float64(r.FrequencyHz)/1e6)
+			}
+			switch {
+			case r.PowerDBm != nil:
+				power = fmt.Sprintf("%.0f dBm", *r.PowerDBm)
+			case r.PA != 0:
+				power = fmt.Sprintf("PA 0x%02X", r.PA)
+			}
+			bytes := strconv.Itoa(r.Bytes)
+			if r.Repeat > 0 {
+				bytes += fmt.Sprintf("x%d", r.Repeat+1)
+			}
+			command := r.Command
+			if r.Error != "" {
+				command = "FAILED: " + r.Error + " | " + command
+			}
+			fmt.Printf("%-25s %-12s %11s %8s %6s %10s %-16s %s\n",
+				r.Time.Local().Format(time.RFC3339), r.Serial, mhz, power, bytes,
+				time.Duration(r.DurationUs)*time.Microsecond, r.SHA256[:min(16, len(r.SHA256))], command)
+		}
+		return nil
+	}
+}
+
+// parseAuditTime accepts an RFC 3339 time or a duration before now
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/autobaud"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "autobaud",
+		summary: "Detect an OOK transmitter's data rate and lock the radio to it",
+		setup:   setupAutobaud,
+	})
+}
+
+func setupAutobaud(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file to apply first (no-sync OOK)")
+	profileName := fs.String("profile", "433-ook-pwm-2.4k", "Built-in profile name or profile file to apply first (no-sync OOK)")
+	freqMHz := fs.Float64("f", 0, "Frequency in MHz (default: keep the configured frequency)")
+	method := fs.String("method", string(autobaud.Oversample), "Detection method: oversample or sweep")
+	rate := fs.Float64("rate", autobaud.DefaultOversampleRate, "oversample: receive rate in baud")
+	candidates := fs.String("candidates", "", "Comma-separated rates to sweep and snap to (default: common OOK rates)")
+	dwell := fs.Duration("dwell", autobaud.DefaultDwell, "Listening time (per rate with -method sweep)")
+	squelch := fs.Int("squelch", 0, "Ignore blocks received below this RSSI in dBm (0 = off)")
+	save := fs.String("save", "", "Write the locked radio configuration to this file (load it with -c)")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s autobaud [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Listen for an unknown OOK remote and find its data rate, then lock the radio\n")
+		fmt.Fprintf(os.Stderr, "to it. Hold the remote's button down while it listens.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s autobaud -f 433.92 -save remote.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s autobaud -profile 315-ook-low-2.4k -method sweep -squelch -80\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		opts := &autobaud.Options{
+			Method:         autobaud.Method(*method),
+			OversampleRate: *rate,
+			Dwell:          *dwell,
+			SquelchMin:     *squelch,
+		}
+		if opts.Method != autobaud.Oversample && opts.Method != autobaud.Sweep {
+			return exitcode.Errorf(exitcode.Usage, "unknown -method '%s'", *method)
+		}
+		if *candidates != "" {
+			for _, s := range strings.Split(*candidates, ",") {
+				v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil || v <= 0 {
+					return exitcode.Errorf(exitcode.Usage, "invalid rate '%s' in -candidates", s)
+				}
+				opts.Candidates = append(opts.Candidates, v)
+			}
+		}
+		if *configPath != "" {
+			// -c replaces the default profile
+			*profileName = ""
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		if *freqMHz > 0 {
+			if err := device.Retune(uint32(*freqMHz * 1e6)); err != nil {
+				return fmt.Errorf("failed to set frequency: %w", err)
+			}
+		}
+		freq, err := device.GetFrequency()
+		if err != nil {
+			return err
+		}
+
+		progress := format.Progress()
+		if opts.Method == autobaud.Sweep {
+			fmt.Fprintf(progress, "Sweeping data rates at %.3f MHz, %s per rate (Ctrl+C to stop)\n", float64(freq)/1e6, *dwell)
+		} else {
+			fmt.Fprintf(progress, "Oversampling at %.0f baud on %.3f MHz for %s (Ctrl+C to stop)\n", *rate, float64(freq)/1e6, *dwell)
+		}
+		fmt.Fprintf(progress, "Hold the remote's button down now\n")
+		opts.Step = func(s autobaud.Step) {
+			fmt.Fprintf(progress, "  %8.0f baud: %5d pulses, symbol %.2f samples, %d widths, %3.0f%% fit\n",
+				s.RateBaud, s.Pulses, s.Width, s.Widths, s.Fit*100)
+		}
+
+		sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		result, err := autobaud.Detect(sigCtx, device, opts)
+		switch {
+		case errors.Is(err, autobaud.ErrNotOOK), errors.Is(err, autobaud.ErrSyncWord):
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		case errors.Is(err, autobaud.ErrNoSignal):
+			return exitcode.Errorf(exitcode.RFTestFailed, "%v", err)
+		case err != nil:
+			return err
+		}
+
+		if *save != "" {
+			c, err := config.DumpFromDevice(device)
+			if err != nil {
+				return err
+			}
+			if err := config.SaveToFile(c, *save); err != nil {
+				return err
+			}
+			fmt.Fprintf(progress, "Saved locked configuration to %s\n", *save)
+		}
+
+		if format.IsJSON() {
+			return output.Write(result)
+		}
+		snapped := ""
+		if result.Snapped {
+			snapped = fmt.Sprintf(" (measured %.0f)", result.Measured)
+		}
+		fmt.Printf("Data rate: %.0f baud%s, %d pulses, %.0f%% fit\n", result.Baud, snapped, result.Pulses, result.Fit*100)
+		if *save == "" {
+			fmt.Printf("Use -save to keep the locked configuration for send-recv -c and other tools\n")
+		}
+		return nil
+	}
+}
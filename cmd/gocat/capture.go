@@ -0,0 +1,452 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/decoders/keeloq"
+	"github.com/herlein/gocat/pkg/decoders/weather"
+	"github.com/herlein/gocat/pkg/demod"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/identify"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/princeton"
+	"github.com/herlein/gocat/pkg/profiles"
+)
+
+func init() {
+	register(&command{
+		name:    "capture",
+		summary: "Convert capture files between native, hex, pcap, sub and SigMF, decode their OOK timings, identify protocols or track KeeLoq codes",
+		setup:   setupCapture,
+		args:    completeFile,
+	})
+}
+
+// conversionResult is the summary of a capture conversion
+type conversionResult struct {
+	Input   string          `json:"input"`
+	From    string          `json:"from"`
+	Output  string          `json:"output"`
+	To      string          `json:"to"`
+	Packets int             `json:"packets"`
+	Header  *capture.Header `json:"header"`
+}
+
+// demodFrame is one decoded frame in -output json mode
+type demodFrame struct {
+	Packet    int             `json:"packet"`
+	Timestamp time.Time       `json:"timestamp"`
+	Princeton *princeton.Code `json:"princeton,omitempty"` // Set when the frame is a PT2262/EV1527 code word
+	KeeLoq    *keeloq.Frame   `json:"keeloq,omitempty"`    // Set when the frame is a KeeLoq code word
+	*demod.Frame
+}
+
+// keeloqRecord is a KeeLoq code word in -output json mode
+type keeloqRecord struct {
+	File      string        `json:"file"`
+	Packet    int           `json:"packet"`
+	Timestamp time.Time     `json:"timestamp"`
+	Status    keeloq.Status `json:"status"`
+	KeeLoq    *keeloq.Frame `json:"keeloq"`
+}
+
+// keeloqSummary is the per-transmitter summary in -output json mode
+type keeloqSummary struct {
+	Transmitter *keeloq.Transmitter `json:"transmitter"`
+}
+
+// identifyRecord is one packet's candidates in -output json mode
+type identifyRecord struct {
+	Packet     int                   `json:"packet"`
+	Timestamp  time.Time             `json:"timestamp"`
+	Candidates []*identify.Candidate `json:"candidates"`
+}
+
+// weatherRecord is a decoded weather sensor reading in -output json mode
+type weatherRecord struct {
+	Packet    int              `json:"packet"`
+	Timestamp time.Time        `json:"timestamp"`
+	Weather   *weather.Reading `json:"weather"`
+}
+
+func setupCapture(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	formats := "auto, " + strings.Join(capture.Formats, ", ")
+	from := fs.String("from", "auto", "Input format: "+formats)
+	to := fs.String("to", "auto", "Output format: "+formats)
+	freq := fs.Uint("freq", 0, "Frequency in Hz to record when the input has none")
+	rate := fs.Float64("rate", 0, "Data rate in baud to record when the input has none (needed for .sub output of byte captures, and demod of them)")
+	profile := fs.String("profile", "", "Profile name to record in the header")
+	window := fs.Duration("window", keeloq.DefaultRepeatWindow, "keeloq: how long the same hopping code counts as one press")
+	top := fs.Int("top", 3, "identify: candidates to show per packet (0 for all)")
+	sync := fs.Uint("sync", 0, "identify: sync word the radio stripped from FSK packets (default: the header profile's)")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s capture convert [options] <input> <output>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s capture demod [options] <input>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s capture identify [options] <input>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s capture keeloq [options] <input>...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "convert translates a capture between formats, carrying over timestamps, pulse\n")
+		fmt.Fprintf(os.Stderr, "timings and the capture header where the output format can hold them.\n")
+		fmt.Fprintf(os.Stderr, "Converting a legacy headerless native capture to native upgrades it to schema\n")
+		fmt.Fprintf(os.Stderr, "version %d.\n\n", capture.SchemaVersion)
+		fmt.Fprintf(os.Stderr, "demod splits OOK captures (raw no-sync bits or pulse timings) into frames,\n")
+		fmt.Fprintf(os.Stderr, "classifies each as PWM, PPM or Manchester and prints the decoded bits.\n")
+		fmt.Fprintf(os.Stderr, "PT2262/EV1527 fixed codes are also shown as their address and data, and\n")
+		fmt.Fprintf(os.Stderr, "Oregon Scientific, Nexus and Acurite weather sensors as their readings.\n\n")
+		fmt.Fprintf(os.Stderr, "identify runs every packet through all registered decoders (line codes, remotes,\n")
+		fmt.Fprintf(os.Stderr, "weather and TPMS sensors, wM-Bus meters) and ranks what they recognize by\n")
+		fmt.Fprintf(os.Stderr, "confidence.\n\n")
+		fmt.Fprintf(os.Stderr, "keeloq finds KeeLoq rolling-code words in one or more captures, in order,\n")
+		fmt.Fprintf(os.Stderr, "splits them into serial number, buttons and encrypted hopping code, and marks\n")
+		fmt.Fprintf(os.Stderr, "each as a transmitter's first, a new press, a repeat or a replayed code.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s capture convert burst.jsonl burst.pcap\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s capture convert remote.sub remote.sigmf-meta\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s capture convert -rate 2400 -freq 433920000 old.jsonl replay.sub\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s capture demod remote.jsonl\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s capture identify -top 1 unknown.sub\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s capture keeloq monday.sub tuesday.sub\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a capture command is required")
+		}
+		cmd := fs.Arg(0)
+		if cmd != "convert" && cmd != "demod" && cmd != "identify" && cmd != "keeloq" {
+			return exitcode.Errorf(exitcode.Usage, "unknown capture command '%s'", cmd)
+		}
+		// Options may follow the subcommand
+		fs.Parse(fs.Args()[1:])
+		if cmd == "demod" {
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return exitcode.Errorf(exitcode.Usage, "an input file is required")
+			}
+			return captureDemod(fs.Arg(0), resolveCaptureFormat(fs.Arg(0), *from), *rate, format)
+		}
+		if cmd == "identify" {
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return exitcode.Errorf(exitcode.Usage, "an input file is required")
+			}
+			return captureIdentify(fs.Arg(0), resolveCaptureFormat(fs.Arg(0), *from), *rate, uint16(*sync), *top, format)
+		}
+		if cmd == "keeloq" {
+			if fs.NArg() < 1 {
+				fs.Usage()
+				return exitcode.Errorf(exitcode.Usage, "at least one input file is required")
+			}
+			return captureKeeLoq(fs.Args(), *from, *rate, *window, format)
+		}
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "input and output files are required")
+		}
+		inPath, outPath := fs.Arg(0), fs.Arg(1)
+
+		inFormat := resolveCaptureFormat(inPath, *from)
+		outFormat := resolveCaptureFormat(outPath, *to)
+
+		in, err := capture.Open(inPath, inFormat)
+		if err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%v", err)
+		}
+		defer in.Close()
+
+		hdr := capture.HeaderOf(in)
+		if hdr == nil {
+			hdr = capture.NewHeader()
+		}
+		hdr.Tool = "gocat capture convert"
+		if hdr.FrequencyHz == 0 {
+			hdr.FrequencyHz = uint32(*freq)
+		}
+		if hdr.DataRate == 0 {
+			hdr.DataRate = *rate
+		}
+		if *profile != "" {
+			hdr.Profile = *profile
+		}
+
+		out, err := capture.Create(outPath, outFormat, hdr)
+		if err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%v", err)
+		}
+
+		count := 0
+		for {
+			p, err := in.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				out.Close()
+				return exitcode.Errorf(exitcode.Failure, "%s: %v", inPath, err)
+			}
+			if p.Frequency == 0 {
+				p.Frequency = hdr.FrequencyHz
+			}
+			if err := out.Write(p); err != nil {
+				out.Close()
+				return exitcode.Errorf(exitcode.Failure, "%s: %v", outPath, err)
+			}
+			count++
+		}
+		if err := out.Close(); err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%s: %v", outPath, err)
+		}
+
+		if format.IsJSON() {
+			return output.Write(&conversionResult{
+				Input: inPath, From: inFormat, Output: outPath, To: outFormat, Packets: count, Header: hdr,
+			})
+		}
+		fmt.Printf("Converted %d packets: %s (%s) -> %s (%s)\n", count, inPath, inFormat, outPath, outFormat)
+		return nil
+	}
+}
+
+// captureDemod decodes every packet of a capture. Packets with pulse
+// timings are decoded from those; byte packets are taken as raw OOK bits
+// at the capture's data rate, or -rate
+func captureDemod(path, inFormat string, rate float64, format output.Format) error {
+	in, err := capture.Open(path, inFormat)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Failure, "%v", err)
+	}
+	defer in.Close()
+	if hdr := capture.HeaderOf(in); hdr != nil && rate == 0 {
+		rate = hdr.DataRate
+	}
+
+	packets, decoded := 0, 0
+	for {
+		p, err := in.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%s: %v", path, err)
+		}
+		packets++
+
+		var frames []*demod.Frame
+		var readings []*weather.Reading
+		switch {
+		case len(p.Pulses) > 0:
+			readings = weather.DecodePulses(p.Pulses)
+			for _, pulses := range demod.Split(p.Pulses) {
+				f, err := demod.Decode(pulses)
+				if err != nil {
+					f = &demod.Frame{Encoding: demod.Unknown, Pulses: pulses}
+				}
+				frames = append(frames, f)
+			}
+		case rate > 0:
+			frames = demod.Demodulate(p.Data, rate)
+			readings = weather.Demodulate(p.Data, rate)
+		default:
+			return exitcode.Errorf(exitcode.Usage, "%s has no data rate; give the rate it was received at with -rate", path)
+		}
+
+		for _, f := range frames {
+			if f.Encoding != demod.Unknown {
+				decoded++
+			}
+			code, _ := princeton.Decode(f)
+			kl, _ := keeloq.Decode(f)
+			if format.IsJSON() {
+				if err := output.WriteLine(&demodFrame{Packet: packets, Timestamp: p.Timestamp, Princeton: code, KeeLoq: kl, Frame: f}); err != nil {
+					return err
+				}
+				continue
+			}
+			printDemodFrame(packets, f)
+			if code != nil {
+				fmt.Printf("   %s\n", code)
+			}
+			if kl != nil {
+				fmt.Printf("   %s\n", kl)
+			}
+		}
+		for _, r := range readings {
+			if format.IsJSON() {
+				if err := output.WriteLine(&weatherRecord{Packet: packets, Timestamp: p.Timestamp, Weather: r}); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("#%d weather    %s\n", packets, r)
+		}
+	}
+	fmt.Fprintf(format.Progress(), "%d packets, %d frames decoded\n", packets, decoded)
+	return nil
+}
+
+// captureIdentify ranks the protocols each packet of a capture may hold.
+// The sync word, needed by FSK decoders, comes from the header's profile
+// unless given
+func captureIdentify(path, inFormat string, rate float64, sync uint16, top int, format output.Format) error {
+	in, err := capture.Open(path, inFormat)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Failure, "%v", err)
+	}
+	defer in.Close()
+	if hdr := capture.HeaderOf(in); hdr != nil {
+		if rate == 0 {
+			rate = hdr.DataRate
+		}
+		if p := profiles.Find(hdr.Profile); p != nil && sync == 0 && p.SyncMode != profiles.SyncNone {
+			sync = p.SyncWord
+		}
+	}
+
+	packets, identified := 0, 0
+	for {
+		p, err := in.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%s: %v", path, err)
+		}
+		packets++
+
+		candidates := identify.Identify(&identify.Burst{Pulses: p.Pulses, Data: p.Data, SampleRate: rate, SyncWord: sync})
+		if len(candidates) > 0 {
+			identified++
+		}
+		if top > 0 && len(candidates) > top {
+			candidates = candidates[:top]
+		}
+		if format.IsJSON() {
+			if err := output.WriteLine(&identifyRecord{Packet: packets, Timestamp: p.Timestamp, Candidates: candidates}); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(candidates) == 0 {
+			fmt.Printf("#%d nothing recognized\n", packets)
+			continue
+		}
+		for _, c := range candidates {
+			repeats := ""
+			if c.Count > 1 {
+				repeats = fmt.Sprintf(" (x%d)", c.Count)
+			}
+			fmt.Printf("#%d %3.0f%% %-10s %s%s\n", packets, c.Confidence*100, c.Protocol, c.Summary, repeats)
+		}
+	}
+	fmt.Fprintf(format.Progress(), "%d packets, %d with a candidate\n", packets, identified)
+	return nil
+}
+
+// captureKeeLoq tracks KeeLoq code words through captures taken in time
+// order, so presses, repeats and replays are told apart across files
+func captureKeeLoq(paths []string, from string, rate float64, window time.Duration, format output.Format) error {
+	tracker := keeloq.NewTracker()
+	tracker.RepeatWindow = window
+	words := 0
+	for _, path := range paths {
+		in, err := capture.Open(path, resolveCaptureFormat(path, from))
+		if err != nil {
+			return exitcode.Errorf(exitcode.Failure, "%v", err)
+		}
+		fileRate := rate
+		if hdr := capture.HeaderOf(in); hdr != nil && fileRate == 0 {
+			fileRate = hdr.DataRate
+		}
+
+		for packets := 1; ; packets++ {
+			p, err := in.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				in.Close()
+				return exitcode.Errorf(exitcode.Failure, "%s: %v", path, err)
+			}
+
+			var frames []*keeloq.Frame
+			switch {
+			case len(p.Pulses) > 0:
+				frames = keeloq.DecodePulses(p.Pulses)
+			case fileRate > 0:
+				frames = keeloq.Demodulate(p.Data, fileRate)
+			default:
+				in.Close()
+				return exitcode.Errorf(exitcode.Usage, "%s has no data rate; give the rate it was received at with -rate", path)
+			}
+
+			for _, f := range frames {
+				words++
+				status := tracker.Observe(f, p.Timestamp)
+				if format.IsJSON() {
+					if err := output.WriteLine(&keeloqRecord{File: path, Packet: packets, Timestamp: p.Timestamp, Status: status, KeeLoq: f}); err != nil {
+						in.Close()
+						return err
+					}
+					continue
+				}
+				fmt.Printf("%s #%d %-7s %s\n", path, packets, status, f)
+			}
+		}
+		in.Close()
+	}
+
+	transmitters := tracker.Transmitters()
+	if format.IsJSON() {
+		for _, tx := range transmitters {
+			if err := output.WriteLine(&keeloqSummary{Transmitter: tx}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fmt.Printf("\n%d code words from %d transmitters\n", words, len(transmitters))
+	for _, tx := range transmitters {
+		fmt.Printf("  serial 0x%07X: %d presses, %d repeats, %d replays, last hopping code 0x%08X\n",
+			tx.Serial, tx.Presses, tx.Repeats, tx.Replays, tx.LastCode)
+	}
+	return nil
+}
+
+// printDemodFrame prints one frame as text
+func printDemodFrame(packet int, f *demod.Frame) {
+	if f.Encoding == demod.Unknown {
+		fmt.Printf("#%d %-10s %d pulses\n", packet, f.Encoding, len(f.Pulses))
+		return
+	}
+	timing := fmt.Sprintf("%d/%d us", f.ShortUs, f.LongUs)
+	if f.PeriodUs > 0 {
+		timing += fmt.Sprintf(", period %d us", f.PeriodUs)
+	}
+	errs := ""
+	if f.Errors > 0 {
+		errs = fmt.Sprintf(", %d errors", f.Errors)
+	}
+	fmt.Printf("#%d %-10s %3d bits %x (%s%s)\n", packet, f.Encoding, len(f.Bits), f.Bits.Bytes(), timing, errs)
+	fmt.Printf("   %s\n", f.Bits)
+}
+
+// resolveCaptureFormat resolves a -from/-to value, detecting "auto" from
+// the file extension
+func resolveCaptureFormat(path, format string) string {
+	if format == "" || format == "auto" {
+		return capture.DetectFormat(path)
+	}
+	return format
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+)
+
+// Completion kinds for command flags and arguments
+const (
+	completeValue   = ""        // Free-form value, nothing to offer
+	completeBool    = "bool"    // Boolean flag, takes no value
+	completeFile    = "file"    // File path
+	completeDevice  = "device"  // Device serial from etc/yardsticks
+	completeProfile = "profile" // Built-in profile name
+	completeShell   = "shell"   // Shell name for the completion command
+	completeFormat  = "format"  // -output format
+)
+
+func init() {
+	register(&command{
+		name:    "completion",
+		summary: "Print a shell completion script (bash, zsh, fish)",
+		setup:   setupCompletion,
+		args:    completeShell,
+	})
+}
+
+func setupCompletion(fs *flag.FlagSet) func(args []string) error {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s completion <bash|zsh|fish>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print a shell completion script. Device serials and profile names\n")
+		fmt.Fprintf(os.Stderr, "are looked up when completing, so the script never goes stale.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  source <(%s completion bash)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s completion zsh > \"${fpath[1]}/_gocat\"\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s completion fish > ~/.config/fish/completions/gocat.fish\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("shell is required")
+		}
+
+		prog := filepath.Base(os.Args[0])
+		switch fs.Arg(0) {
+		case "bash":
+			writeBashCompletion(os.Stdout, prog)
+		case "zsh":
+			fmt.Printf("#compdef %s\n\nautoload -U +X bashcompinit && bashcompinit\n\n", prog)
+			writeBashCompletion(os.Stdout, prog)
+		case "fish":
+			writeFishCompletion(os.Stdout, prog)
+		default:
+			return fmt.Errorf("unknown shell '%s' (want bash, zsh or fish)", fs.Arg(0))
+		}
+		return nil
+	}
+}
+
+// completeCandidates prints the dynamic candidates for a completion kind,
+// one per line; it backs the hidden "__complete" command the scripts call
+func completeCandidates(kind string) {
+	var out []string
+	switch kind {
+	case completeDevice:
+		paths, _ := filepath.Glob(config.GetConfigPath("*"))
+		for _, p := range paths {
+			out = append(out, strings.TrimSuffix(filepath.Base(p), ".json"))
+		}
+	case completeProfile:
+		out = profiles.Names()
+	case completeShell:
+		out = []string{"bash", "zsh", "fish"}
+	case completeFormat:
+		out = []string{string(output.Text), string(output.JSON)}
+	}
+	for _, s := range out {
+		fmt.Println(s)
+	}
+}
+
+// sortedCommands returns the registered commands sorted by name
+func sortedCommands() []*command {
+	out := make([]*command, 0, len(commands))
+	for _, c := range commands {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// commandFlag is a flag of a command and how its value completes
+type commandFlag struct {
+	name string
+	kind string
+}
+
+// commandFlags returns a command's flags, sorted, read from the FlagSet it
+// parses so completion offers exactly what the command accepts
+func commandFlags(c *command) []commandFlag {
+	fs, _ := c.flagSet()
+	var out []commandFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		out = append(out, commandFlag{name: f.Name, kind: flagKind(f)})
+	})
+	return out
+}
+
+// flagKind returns the completion kind of a flag's value. Flags that take
+// a device, profile or file are named the same way by every command
+func flagKind(f *flag.Flag) string {
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return completeBool
+	}
+	if _, ok := f.Value.(*output.Format); ok {
+		return completeFormat
+	}
+	switch f.Name {
+	case "d", "tx", "rx":
+		return completeDevice
+	case "profile":
+		return completeProfile
+	case "c", "o", "s", "db", "file", "report", "save", "schedule", "symbols":
+		return completeFile
+	}
+	return completeValue
+}
+
+// bashWords returns the bash expression that completes a kind
+func bashWords(prog, kind string) string {
+	switch kind {
+	case completeFile:
+		return `compgen -f -- "$cur"`
+	case completeValue, completeBool:
+		return ""
+	default:
+		return fmt.Sprintf(`compgen -W "$(%s __complete %s 2>/dev/null)" -- "$cur"`, prog, kind)
+	}
+}
+
+func writeBashCompletion(w *os.File, prog string) {
+	fn := "_" + strings.ReplaceAll(prog, "-", "_")
+	var names []string
+	for _, c := range sortedCommands() {
+		names = append(names, c.name)
+	}
+
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(w, "    COMPREPLY=()\n")
+	fmt.Fprintf(w, "    if [ \"$COMP_CWORD\" -eq 1 ] || [ \"${COMP_WORDS[1]}\" = help ]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"help %s\" -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    case \"${COMP_WORDS[1]}\" in\n")
+	for _, c := range sortedCommands() {
+		fmt.Fprintf(w, "    %s)\n", c.name)
+		flags := commandFlags(c)
+		if len(flags) > 0 {
+			var names []string
+			fmt.Fprintf(w, "        case \"$prev\" in\n")
+			for _, f := range flags {
+				names = append(names, f.name)
+				if f.kind == completeBool {
+					continue
+				}
+				if words := bashWords(prog, f.kind); words != "" {
+					fmt.Fprintf(w, "        -%s) COMPREPLY=($(%s)); return ;;\n", f.name, words)
+				} else {
+					// Free-form value: offer nothing rather than flags
+					fmt.Fprintf(w, "        -%s) return ;;\n", f.name)
+				}
+			}
+			fmt.Fprintf(w, "        esac\n")
+			fmt.Fprintf(w, "        if [[ \"$cur\" == -* ]]; then\n")
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"-%s\" -- \"$cur\"))\n", strings.Join(names, " -"))
+			fmt.Fprintf(w, "            return\n")
+			fmt.Fprintf(w, "        fi\n")
+		}
+		if words := bashWords(prog, c.args); words != "" {
+			fmt.Fprintf(w, "        COMPREPLY=($(%s))\n", words)
+		}
+		fmt.Fprintf(w, "        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, prog)
+}
+
+// fishArgs returns the fish complete options that complete a kind
+func fishArgs(prog, kind string) string {
+	switch kind {
+	case completeBool:
+		return ""
+	case completeFile:
+		return " -r -F"
+	case completeValue:
+		return " -x"
+	default:
+		return fmt.Sprintf(" -x -a '(%s __complete %s)'", prog, kind)
+	}
+}
+
+func writeFishCompletion(w *os.File, prog string) {
+	fmt.Fprintf(w, "complete -c %s -f\n", prog)
+	fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -a help -d 'Show help for a command'\n", prog)
+	for _, c := range sortedCommands() {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -a %s -d '%s'\n", prog, c.name, strings.ReplaceAll(c.summary, "'", "\\'"))
+		fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from help' -a %s\n", prog, c.name)
+		cond := fmt.Sprintf("__fish_seen_subcommand_from %s", c.name)
+		for _, f := range commandFlags(c) {
+			fmt.Fprintf(w, "complete -c %s -n '%s' -o %s%s\n", prog, cond, f.name, fishArgs(prog, f.kind))
+		}
+		if c.args == completeFile {
+			fmt.Fprintf(w, "complete -c %s -n '%s' -F\n", prog, cond)
+		} else if c.args != completeValue {
+			fmt.Fprintf(w, "complete -c %s -n '%s' -a '(%s __complete %s)'\n", prog, cond, prog, c.args)
+		}
+	}
+}
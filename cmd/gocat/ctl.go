@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/herlein/gocat/pkg/control"
+	"github.com/herlein/gocat/pkg/output"
+)
+
+func init() {
+	register(&command{
+		name:    "ctl",
+		summary: "Send a command to a running tool's control socket",
+		setup:   setupCtl,
+	})
+}
+
+func setupCtl(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	socket := fs.String("s", "", "Control socket path")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s ctl -s <socket> <command> [json-args]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Send a command to a tool started with -control. Use 'help' to list commands.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s ctl -s /tmp/decode.sock status\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s ctl -s /tmp/decode.sock capture '{\"path\":\"burst.jsonl\",\"count\":50}'\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if *socket == "" || fs.NArg() < 1 {
+			fs.Usage()
+			return fmt.Errorf("socket and command are required")
+		}
+
+		var cmdArgs interface{}
+		if fs.NArg() > 1 {
+			raw := json.RawMessage(fs.Arg(1))
+			if !json.Valid(raw) {
+				return fmt.Errorf("arguments must be valid JSON")
+			}
+			cmdArgs = raw
+		}
+
+		result, err := control.Call(*socket, fs.Arg(0), cmdArgs)
+		if err != nil {
+			return err
+		}
+
+		var value interface{}
+		if len(result) > 0 {
+			json.Unmarshal(result, &value)
+		}
+		if format.IsJSON() {
+			// Commands without a result encode as null
+			return output.Write(value)
+		}
+		if value == nil {
+			fmt.Println("ok")
+			return nil
+		}
+		printValue("", value)
+		return nil
+	}
+}
+
+// printValue writes a decoded JSON result as "key: value" lines, with
+// nested keys joined by dots
+func printValue(prefix string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			printValue(joinKey(prefix, k), v[k])
+		}
+	case []interface{}:
+		for i, item := range v {
+			printValue(joinKey(prefix, fmt.Sprint(i)), item)
+		}
+	case float64:
+		// Avoid exponent notation for large counters
+		printLeaf(prefix, strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		printLeaf(prefix, fmt.Sprint(v))
+	}
+}
+
+func printLeaf(key, value string) {
+	if key == "" {
+		fmt.Println(value)
+	} else {
+		fmt.Printf("%s: %s\n", key, value)
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "devices",
+		summary: "List connected YardStick One devices",
+		setup:   setupDevices,
+	})
+}
+
+func setupDevices(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	verbose := fs.Bool("v", false, "Query firmware build and chip for each device")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s devices [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List connected YardStick One devices.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		devices, err := yardstick.FindAllDevices(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to enumerate devices: %w", err)
+		}
+
+		infos := make([]yardstick.DeviceInfo, len(devices))
+		for i, device := range devices {
+			infos[i] = device.Info(*verbose || format.IsJSON())
+			device.Close()
+		}
+
+		if format.IsJSON() {
+			return output.Write(infos)
+		}
+
+		if len(infos) == 0 {
+			fmt.Println("No YardStick One or other RfCat devices found")
+			return nil
+		}
+		for i, info := range infos {
+			fmt.Printf("  #%d  %s  %d:%d  %s", i, info.Serial, info.Bus, info.Address, info.Capabilities.Model)
+			if *verbose {
+				fmt.Printf("  %s  %s", info.Chip, info.Firmware)
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+}
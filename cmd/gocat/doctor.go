@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "doctor",
+		summary: "Diagnose the USB setup: permissions, udev rules, drivers and devices",
+		setup:   setupDoctor,
+	})
+}
+
+// Check results
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is one line of the diagnosis
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+	err    error
+}
+
+// doctorReport is the -output json result
+type doctorReport struct {
+	Checks []*doctorCheck `json:"checks"`
+	Failed int            `json:"failed"`
+}
+
+// udevDirs are searched for a rule matching the YardStick One
+var udevDirs = []string{"/etc/udev/rules.d", "/lib/udev/rules.d", "/usr/lib/udev/rules.d"}
+
+func setupDoctor(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s doctor [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Check libusb, the dongles on the bus, udev rules and device node permissions,\n")
+		fmt.Fprintf(os.Stderr, "then open each YardStick One and talk to its firmware. Every failed check says\n")
+		fmt.Fprintf(os.Stderr, "how to fix it.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		report := &doctorReport{}
+		add := func(c *doctorCheck) {
+			report.Checks = append(report.Checks, c)
+			if c.Status == checkFail {
+				report.Failed++
+			}
+			if !format.IsJSON() {
+				printDoctorCheck(c)
+			}
+		}
+
+		add(platformCheck())
+
+		ctx, err := newUSBContext()
+		if err != nil {
+			add(&doctorCheck{Name: "libusb", Status: checkFail, Detail: err.Error(),
+				Hint: "install libusb-1.0 (apt install libusb-1.0-0, brew install libusb)", err: err})
+			return finishDoctor(format, report)
+		}
+		defer ctx.Close()
+		add(&doctorCheck{Name: "libusb", Status: checkOK, Detail: "initialised"})
+
+		found, err := yardstick.Enumerate(ctx)
+		add(busCheck(found, err))
+		if runtime.GOOS == "linux" {
+			add(udevCheck())
+			for _, d := range found {
+				if yardstick.IsSupported(d.ProductID) {
+					add(nodeCheck(d))
+				}
+			}
+		}
+		for _, c := range openChecks(ctx) {
+			add(c)
+		}
+		add(lockCheck())
+
+		return finishDoctor(format, report)
+	}
+}
+
+// newUSBContext creates a gousb context, which panics if libusb cannot
+// be initialised
+func newUSBContext() (ctx *gousb.Context, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("libusb initialisation failed: %v", r)
+		}
+	}()
+	return gousb.NewContext(), nil
+}
+
+// finishDoctor prints the summary and picks the exit code of the first
+// failure
+func finishDoctor(format output.Format, report *doctorReport) error {
+	if format.IsJSON() {
+		output.Write(report)
+	} else if report.Failed == 0 {
+		fmt.Println("\nNo problems found")
+	}
+	if report.Failed == 0 {
+		return nil
+	}
+	for _, c := range report.Checks {
+		if c.Status == checkFail && c.err != nil {
+			return exitcode.Errorf(exitcode.Of(c.err), "%d checks failed", report.Failed)
+		}
+	}
+	return exitcode.Errorf(exitcode.Failure, "%d checks failed", report.Failed)
+}
+
+// printDoctorCheck prints a check with its hint indented below it
+func printDoctorCheck(c *doctorCheck) {
+	fmt.Printf("[%-4s] %-10s %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+	if c.Hint != "" {
+		for _, line := range strings.Split(strings.TrimRight(c.Hint, "\n"), "\n") {
+			fmt.Printf("       %-10s %s\n", "", line)
+		}
+	}
+}
+
+// platformCheck reports the OS and whether gocat is running as root
+func platformCheck() *doctorCheck {
+	detail := runtime.GOOS + "/" + runtime.GOARCH
+	if u, err := user.Current(); err == nil {
+		detail += ", user " + u.Username
+	}
+	if os.Geteuid() == 0 {
+		detail += " (root)"
+	}
+	return &doctorCheck{Name: "platform", Status: checkOK, Detail: detail}
+}
+
+// busCheck reports the RfCat-family devices seen on the bus
+func busCheck(found []yardstick.USBDevice, err error) *doctorCheck {
+	if err != nil && len(found) == 0 {
+		return &doctorCheck{Name: "bus", Status: checkFail, Detail: err.Error(), err: err}
+	}
+	var ys1, boot, other []string
+	for _, d := range found {
+		loc := fmt.Sprintf("%d:%d", d.Bus, d.Address)
+		switch d.Kind {
+		case "YardStick One":
+			ys1 = append(ys1, loc)
+		case "bootloader":
+			boot = append(boot, fmt.Sprintf("%s (0x%04X)", loc, d.ProductID))
+		default:
+			other = append(other, fmt.Sprintf("%s %s", d.Kind, loc))
+		}
+	}
+
+	c := &doctorCheck{Name: "bus", Status: checkOK}
+	switch {
+	case len(ys1) > 0:
+		c.Detail = fmt.Sprintf("%d YardStick One at %s", len(ys1), strings.Join(ys1, ", "))
+		if len(other) > 0 {
+			c.Detail += "; also " + strings.Join(other, ", ")
+		}
+	case len(other) > 0:
+		c.Detail = strings.Join(other, ", ")
+	case len(boot) > 0:
+		c.Status = checkFail
+		c.Detail = "no dongle running its application firmware"
+		c.err = yardstick.ErrBootloader
+	default:
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("no YardStick One (USB %04x:%04x) or other RfCat dongle on the bus", yardstick.VendorID, yardstick.ProductID)
+		c.Hint = "plug the dongle in directly or through a powered hub; in a VM, pass the USB device through"
+		c.err = yardstick.ErrDeviceNotFound
+	}
+	if len(boot) > 0 {
+		if c.Status == checkOK {
+			c.Status = checkWarn
+		}
+		c.Detail += "; in bootloader mode: " + strings.Join(boot, ", ")
+		c.Hint = (&yardstick.OpenError{Class: yardstick.ErrBootloader}).Hint()
+	}
+	return c
+}
+
+// udevRulePattern matches a rule line for the YardStick One product ID
+var udevRulePattern = regexp.MustCompile(`(?i)idVendor}=="1d50".*idProduct}=="605b"|idProduct}=="605b".*idVendor}=="1d50"`)
+
+// udevCheck looks for an installed rule granting access to the dongle and
+// checks the user is in the group it names
+func udevCheck() *doctorCheck {
+	hint := fmt.Sprintf("create %s containing:\n%s", yardstick.UdevRulesPath, yardstick.UdevRules) +
+		"then run: sudo udevadm control --reload-rules && sudo udevadm trigger, and replug"
+
+	for _, dir := range udevDirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.rules"))
+		for _, path := range files {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			for _, line := range bytes.Split(data, []byte("\n")) {
+				if bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) || !udevRulePattern.Match(line) {
+					continue
+				}
+				c := &doctorCheck{Name: "udev", Status: checkOK, Detail: "rule found in " + path}
+				if group := udevGroup(string(line)); group != "" && !inGroup(group) && os.Geteuid() != 0 {
+					c.Status = checkWarn
+					c.Detail += fmt.Sprintf(", but you are not in its group '%s'", group)
+					c.Hint = fmt.Sprintf("sudo usermod -aG %s $USER, then log out and back in", group)
+				}
+				return c
+			}
+		}
+	}
+
+	if os.Geteuid() == 0 {
+		return &doctorCheck{Name: "udev", Status: checkWarn, Detail: "no YardStick One rule installed (running as root, so not needed now)", Hint: hint}
+	}
+	return &doctorCheck{Name: "udev", Status: checkFail, Detail: "no YardStick One rule installed", Hint: hint, err: yardstick.ErrPermission}
+}
+
+// udevGroupPattern captures the GROUP a rule assigns
+var udevGroupPattern = regexp.MustCompile(`GROUP\s*=\s*"([^"]+)"`)
+
+// udevGroup returns the GROUP a rule line assigns, or ""
+func udevGroup(line string) string {
+	m := udevGroupPattern.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// inGroup reports whether the current user is a member of group
+func inGroup(name string) bool {
+	u, err := user.Current()
+	if err != nil {
+		return false
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return false
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return false
+	}
+	for _, id := range ids {
+		if id == g.Gid {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeCheck tries the usbfs device node libusb opens
+func nodeCheck(d yardstick.USBDevice) *doctorCheck {
+	path := fmt.Sprintf("/dev/bus/usb/%03d/%03d", d.Bus, d.Address)
+	name := fmt.Sprintf("node %d:%d", d.Bus, d.Address)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err == nil {
+		f.Close()
+		return &doctorCheck{Name: name, Status: checkOK, Detail: path + " is read/write"}
+	}
+	if errors.Is(err, os.ErrPermission) {
+		mode := ""
+		if fi, serr := os.Stat(path); serr == nil {
+			mode = " (" + fi.Mode().Perm().String() + ")"
+		}
+		oe := &yardstick.OpenError{Bus: d.Bus, Address: d.Address, Class: yardstick.ErrPermission, Err: err}
+		return &doctorCheck{Name: name, Status: checkFail, Detail: path + " is not writable" + mode, Hint: oe.Hint(), err: oe}
+	}
+	return &doctorCheck{Name: name, Status: checkWarn, Detail: err.Error()}
+}
+
+// openChecks opens every supported dongle and queries its firmware
+func openChecks(ctx *gousb.Context) []*doctorCheck {
+	devices, err := yardstick.FindAllDevices(ctx)
+	if err != nil {
+		c := &doctorCheck{Name: "open", Status: checkFail, Detail: err.Error(), err: err}
+		var oe *yardstick.OpenError
+		if errors.As(err, &oe) {
+			c.Detail = fmt.Sprintf("%v: %v", oe.Class, oe.Err)
+			c.Hint = oe.Hint()
+		}
+		return []*doctorCheck{c}
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	var checks []*doctorCheck
+	for _, d := range devices {
+		name := fmt.Sprintf("open %d:%d", d.Bus, d.Address)
+		c := &doctorCheck{Name: name, Status: checkOK}
+		if err := d.Ping([]byte("gocat")); err != nil {
+			c.Status, c.Detail, c.err = checkFail, fmt.Sprintf("serial %s opened but firmware did not answer a ping: %v", d.Serial, err), err
+			c.Hint = "replug the dongle; if it persists, reflash the firmware"
+		} else {
+			build, _ := d.GetBuildType()
+			part, _ := d.GetPartNum()
+			c.Detail = fmt.Sprintf("%s, serial %s, firmware %s, part 0x%02X", d.Capabilities().Model, d.Serial, strings.TrimSpace(build), part)
+		}
+		checks = append(checks, c)
+		d.Close()
+	}
+	return checks
+}
+
+// lockCheck lists device reservations held by other gocat processes
+func lockCheck() *doctorCheck {
+	locks, err := yardstick.ListLocks()
+	if err != nil {
+		return &doctorCheck{Name: "locks", Status: checkWarn, Detail: err.Error()}
+	}
+	if len(locks) == 0 {
+		return &doctorCheck{Name: "locks", Status: checkOK, Detail: "no devices reserved"}
+	}
+	var held []string
+	for _, l := range locks {
+		s := fmt.Sprintf("%s by process %d", l.Device, l.PID)
+		if l.Stale {
+			s += " (stale)"
+		}
+		held = append(held, s)
+	}
+	return &doctorCheck{Name: "locks", Status: checkOK, Detail: "reserved: " + strings.Join(held, ", ")}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/farm"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "farm",
+		summary: "Run the profile matrix and link tests across all attached device pairs",
+		setup:   setupFarm,
+	})
+}
+
+func setupFarm(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	defaults := farm.DefaultOptions()
+	band := fs.String("band", "", "Only run built-in profiles for this band (315, 433, 868, 915)")
+	profileList := fs.String("profiles", "", "Comma-separated built-in profiles to run (default: all for -band)")
+	repeat := fs.Int("repeat", defaults.Repeat, "Loopback iterations per profile")
+	link := fs.Bool("link", true, "Also run a link test on every packet profile with sync and CRC")
+	linkPackets := fs.Int("link-packets", defaults.LinkPackets, "Packets per link test (1-256)")
+	linkDelay := fs.Duration("link-delay", defaults.LinkDelay, "Delay between link test packets")
+	timeout := fs.Duration("timeout", defaults.Timeout, "Receive timeout (raised to cover the packet airtime)")
+	maxPER := fs.Float64("max-per", defaults.MaxPER, "Highest packet error rate a job may show and pass (0-1)")
+	maxPairs := fs.Int("pairs", 0, "Use at most this many pairs (0 = all)")
+	reportPath := fs.String("report", "", "Also write the JSON report to this file")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s farm [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lock every attached YardStick One not reserved by another process, pair them\n")
+		fmt.Fprintf(os.Stderr, "in bus:address order and spread the test matrix across the pairs. Jobs on the\n")
+		fmt.Fprintf(os.Stderr, "same frequency never run at once. Lock files live in %s.\n\n", yardstick.LockDir())
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s farm -band 433\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s farm -profiles 433-2fsk-fast-38.4k,915-gfsk-std-38.4k -link=false\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s farm -output json -report farm.json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		list, err := farmProfiles(*band, *profileList)
+		if err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+		if *repeat < 1 {
+			return exitcode.Errorf(exitcode.Usage, "-repeat must be at least 1")
+		}
+		if *linkPackets < 1 || *linkPackets > 256 {
+			return exitcode.Errorf(exitcode.Usage, "-link-packets must be 1-256")
+		}
+		if *maxPER < 0 || *maxPER > 1 {
+			return exitcode.Errorf(exitcode.Usage, "-max-per must be 0-1")
+		}
+
+		usbCtx := gousb.NewContext()
+		defer usbCtx.Close()
+
+		devices, err := yardstick.FindAllDevices(usbCtx)
+		if err != nil {
+			return err
+		}
+		pairs, skipped := farm.Reserve(devices)
+		if *maxPairs > 0 && len(pairs) > *maxPairs {
+			for _, p := range pairs[*maxPairs:] {
+				skipped = append(skipped, fmt.Sprintf("%s: over -pairs limit", p))
+				p.Release()
+			}
+			pairs = pairs[:*maxPairs]
+		}
+		defer func() {
+			for _, p := range pairs {
+				p.Release()
+			}
+		}()
+		if len(pairs) == 0 {
+			return exitcode.Errorf(exitcode.DeviceNotFound, "no free device pairs (%d devices found)", len(devices))
+		}
+
+		progress := format.Progress()
+		for _, s := range skipped {
+			fmt.Fprintf(progress, "Skipped %s\n", s)
+		}
+		jobs := farm.Matrix(list, *link)
+		fmt.Fprintf(progress, "Running %d jobs on %d pairs\n", len(jobs), len(pairs))
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		opts := &farm.Options{
+			Repeat:      *repeat,
+			LinkPackets: *linkPackets,
+			LinkDelay:   *linkDelay,
+			Timeout:     *timeout,
+			MaxPER:      *maxPER,
+			Progress:    progress,
+		}
+		report := farm.Run(ctx, pairs, jobs, opts)
+		report.Skipped = skipped
+
+		if *reportPath != "" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(*reportPath, append(data, '\n'), 0o644); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+		}
+		if format.IsJSON() {
+			output.Write(report)
+		} else {
+			printFarmReport(report)
+		}
+
+		switch {
+		case report.Failed > 0:
+			return exitcode.Errorf(exitcode.RFTestFailed, "%d of %d jobs failed", report.Failed, len(jobs))
+		case report.NotRun > 0:
+			return exitcode.Errorf(exitcode.Partial, "%d of %d jobs not run", report.NotRun, len(jobs))
+		}
+		return nil
+	}
+}
+
+// farmProfiles resolves -profiles, or every built-in profile for -band;
+// with no -band, profiles the YardStick One's CC1111 can't tune are left out
+func farmProfiles(band, names string) ([]*profiles.Profile, error) {
+	var list []*profiles.Profile
+	if names != "" {
+		for _, name := range strings.Split(names, ",") {
+			p := profiles.Find(strings.TrimSpace(name))
+			if p == nil {
+				return nil, fmt.Errorf("unknown profile '%s'", name)
+			}
+			list = append(list, p)
+		}
+		return list, nil
+	}
+	for _, p := range profiles.All() {
+		if band == "" && profiles.CrystalMHzFor(p.FrequencyHz) != profiles.CrystalMHz {
+			continue
+		}
+		if band == "" || strings.HasPrefix(p.Name, band+"-") {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no built-in profiles for band '%s'", band)
+	}
+	return list, nil
+}
+
+// printFarmReport prints the aggregated results
+func printFarmReport(r *farm.Report) {
+	fmt.Printf("\n%-5s %-7s %-32s %6s %6s %7s %s\n", "Pair", "Kind", "Profile", "Sent", "Recv", "PER", "Result")
+	for _, res := range r.Results {
+		status := "PASS"
+		if !res.Passed {
+			status = "FAIL"
+		}
+		if res.Error != "" {
+			status += " (" + res.Error + ")"
+		}
+		fmt.Printf("%-5d %-7s %-32s %6d %6d %6.1f%% %s\n",
+			res.Pair, res.Kind, res.Profile, res.Sent, res.Received, res.PER*100, status)
+	}
+	fmt.Println()
+	for _, p := range r.Pairs {
+		fmt.Printf("Pair %d: %s -> %s, %d jobs\n", p.ID, p.TX, p.RX, p.Jobs)
+	}
+	fmt.Printf("%d passed, %d failed", r.Passed, r.Failed)
+	if r.NotRun > 0 {
+		fmt.Printf(", %d not run", r.NotRun)
+	}
+	fmt.Printf(" in %s\n", (time.Duration(r.DurationMS) * time.Millisecond).Round(time.Second))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/fwstate"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "fwstate",
+		summary: "Print firmware runtime state from a device",
+		setup:   setupFwstate,
+	})
+}
+
+func setupFwstate(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	symbols := fs.String("symbols", "", "JSON symbol table of firmware variable addresses per build")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s fwstate [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print radio state, RF interrupt flags, last error codes and FHSS MAC state.\n")
+		fmt.Fprintf(os.Stderr, "Firmware variables such as rf_status are read when -symbols lists them for\n")
+		fmt.Fprintf(os.Stderr, "the device's build.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		var syms *fwstate.SymbolTable
+		if *symbols != "" {
+			var err error
+			if syms, err = fwstate.LoadSymbols(*symbols); err != nil {
+				return err
+			}
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		state, err := fwstate.Read(device, syms)
+		if err != nil {
+			return err
+		}
+
+		if format.IsJSON() {
+			return output.Write(state)
+		}
+		fmt.Print(state)
+		return nil
+	}
+}
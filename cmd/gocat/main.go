@@ -0,0 +1,95 @@
+// gocat: Unified command-line interface for YardStick One tools
+//
+// Each subcommand has its own flags; run "gocat help <command>" for details.
+//
+// Examples:
+//
+//	# Run an automation script
+//	./gocat run scripts/scan-and-capture.star
+//
+//	# Enable shell completion
+//	source <(./gocat completion bash)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+)
+
+// command is a gocat subcommand
+type command struct {
+	name    string
+	summary string
+	setup   setupFunc
+	args    string // Completion kind for positional arguments
+}
+
+// setupFunc defines a command's flags on fs and returns the function that
+// runs the command with them; completion calls it only to read the flags
+type setupFunc func(fs *flag.FlagSet) func(args []string) error
+
+// flagSet returns the command's flags and the function that runs it
+func (c *command) flagSet() (*flag.FlagSet, func(args []string) error) {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	return fs, c.setup(fs)
+}
+
+var commands = map[string]*command{}
+
+func register(c *command) {
+	commands[c.name] = c
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [options]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Unified command-line interface for YardStick One tools\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+
+	for _, c := range sortedCommands() {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for command options\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitcode.Usage)
+	}
+
+	name := os.Args[1]
+	switch name {
+	case "__complete":
+		// Called by the completion scripts
+		if len(os.Args) > 2 {
+			completeCandidates(os.Args[2])
+		}
+		return
+	case "help", "-h", "-help", "--help":
+		if len(os.Args) > 2 {
+			if c, ok := commands[os.Args[2]]; ok {
+				_, run := c.flagSet()
+				run([]string{"-h"})
+				return
+			}
+		}
+		usage()
+		return
+	}
+
+	c, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Unknown command '%s'\n\n", name)
+		usage()
+		os.Exit(exitcode.Usage)
+	}
+
+	_, run := c.flagSet()
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
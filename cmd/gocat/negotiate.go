@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/linkrate"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "negotiate",
+		summary: "Find the fastest data rate that works between two nodes",
+		setup:   setupNegotiate,
+	})
+}
+
+func setupNegotiate(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	respond := fs.Bool("respond", false, "Wait for an initiator instead of starting the negotiation")
+	band := fs.String("band", "433", "Band for the built-in profile ladder (315, 433, 868, 915)")
+	profileList := fs.String("profiles", "", "Comma-separated profile ladder (default: built-in ladder for -band)")
+	per := fs.Float64("per", 0.05, "Highest acceptable packet error rate (0-1)")
+	probes := fs.Int("n", 50, "Probe packets per profile")
+	interval := fs.Duration("interval", 20*time.Millisecond, "Delay between probe packets")
+	timeout := fs.Duration("timeout", 60*time.Second, "How long the responder waits for an initiator")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s negotiate [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Probe progressively faster profiles with a peer node and switch both to the\n")
+		fmt.Fprintf(os.Stderr, "fastest one meeting the PER target. Start the responder first; both nodes\n")
+		fmt.Fprintf(os.Stderr, "must use the same ladder.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s negotiate -respond -band 433\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s negotiate -band 433 -per 0.01 -n 100\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		cfg := &linkrate.Config{
+			Ladder:    linkrate.Ladder(*band),
+			Probes:    *probes,
+			Interval:  *interval,
+			TargetPER: *per,
+		}
+		if *profileList != "" {
+			ladder, err := linkrate.ParseLadder(strings.Split(*profileList, ","))
+			if err != nil {
+				return exitcode.Errorf(exitcode.Usage, "%v", err)
+			}
+			cfg.Ladder = ladder
+		}
+		if len(cfg.Ladder) == 0 {
+			return exitcode.Errorf(exitcode.Usage, "no profiles for band '%s'", *band)
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		progress := format.Progress()
+		names := make([]string, len(cfg.Ladder))
+		for i, p := range cfg.Ladder {
+			names[i] = p.Name
+		}
+		fmt.Fprintf(progress, "Ladder: %s\n", strings.Join(names, ", "))
+
+		var result *linkrate.Result
+		if *respond {
+			fmt.Fprintf(progress, "Waiting for initiator on %s (timeout %s)\n", cfg.Ladder[0].Name, *timeout)
+			result, err = linkrate.Respond(device, cfg, *timeout)
+		} else {
+			fmt.Fprintf(progress, "Negotiating with %d probes per profile, PER target %.1f%%\n", cfg.Probes, cfg.TargetPER*100)
+			result, err = linkrate.Initiate(device, cfg)
+		}
+
+		if format.IsJSON() && result != nil {
+			if werr := output.Write(result); werr != nil {
+				return werr
+			}
+		} else if result != nil {
+			printNegotiation(result)
+		}
+
+		switch {
+		case errors.Is(err, linkrate.ErrNoRate):
+			return exitcode.Errorf(exitcode.RFTestFailed, "%v", err)
+		case err != nil:
+			return exitcode.Errorf(exitcode.RFTestFailed, "negotiation failed: %v", err)
+		}
+		return nil
+	}
+}
+
+// printNegotiation prints the per-profile results and the selection
+func printNegotiation(r *linkrate.Result) {
+	if len(r.Steps) > 0 {
+		fmt.Printf("\n%-28s %10s %6s %6s %7s\n", "Profile", "Baud", "Sent", "Recv", "PER")
+		for _, s := range r.Steps {
+			status := passFail(s.Passed)
+			if s.Error != "" {
+				status += " (" + s.Error + ")"
+			}
+			if s.Sent == 0 {
+				// The responder doesn't know how many were sent
+				fmt.Printf("%-28s %10.0f %6s %6d %7s\n", s.Profile, s.DataRate, "-", s.Received, "-")
+				continue
+			}
+			fmt.Printf("%-28s %10.0f %6d %6d %6.1f%% %s\n", s.Profile, s.DataRate, s.Sent, s.Received, s.PER*100, status)
+		}
+	}
+	fmt.Printf("\nLink: %d sent, %d retransmissions, %d received, %d duplicates\n",
+		r.Link.Sent, r.Link.Retransmissions, r.Link.Received, r.Link.Duplicates)
+	if r.Selected != "" {
+		fmt.Printf("Selected: %s (%.0f baud)\n", r.Selected, r.DataRate)
+	}
+}
+
+func passFail(ok bool) string {
+	if ok {
+		return "PASS"
+	}
+	return "FAIL"
+}
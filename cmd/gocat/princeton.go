@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/princeton"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "princeton",
+		summary: "Encode and send PT2262/EV1527 fixed-code remote signals",
+		setup:   setupPrinceton,
+	})
+}
+
+// maxPrincetonRepeat is how many 16-byte code words fit in one fixed-length packet
+const maxPrincetonRepeat = 255 / (princeton.WordUnits / 8)
+
+// princetonEncoding is the encode command's result in -output json mode
+type princetonEncoding struct {
+	*princeton.Code
+	Repeat    int     `json:"repeat"`
+	DataRate  float64 `json:"data_rate_baud"`
+	Bitstream string  `json:"bitstream"` // Hex
+}
+
+func setupPrinceton(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	profileName := fs.String("profile", "433-ook-pwm-2.4k", "send: no-sync OOK profile to send with; its data rate is replaced")
+	freqMHz := fs.Float64("f", 0, "send: frequency in MHz (default: the profile's)")
+	power := fs.Int("power", 10, "send: transmit power in dBm")
+	address := fs.String("address", "", "EV1527 20-bit address, e.g. 0xA5C3E")
+	data := fs.Uint("data", 0, "EV1527 4 data bits (buttons)")
+	tristate := fs.String("pt2262", "", "PT2262 code as 12 pins of 0, 1 and F, e.g. 0F1F00110FF1")
+	pulse := fs.Int("pulse", princeton.DefaultPulseUs, "Short pulse width in microseconds")
+	repeat := fs.Int("repeat", princeton.DefaultRepeat, fmt.Sprintf("Code words to send (1-%d)", maxPrincetonRepeat))
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s princeton [options] <command>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  encode   Print the on-air OOK bitstream of a code and the rate to send it at\n")
+		fmt.Fprintf(os.Stderr, "  send     Transmit a code\n\n")
+		fmt.Fprintf(os.Stderr, "Give the code with -address and -data (EV1527) or -pt2262. To find the code\n")
+		fmt.Fprintf(os.Stderr, "of a remote, capture it and decode it with 'capture demod'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s princeton encode -address 0xA5C3E -data 0x9\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s princeton send -pt2262 0F1F00110FF1 -pulse 330 -f 433.92\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a princeton command is required")
+		}
+		cmd := fs.Arg(0)
+		// Options may follow the command
+		fs.Parse(fs.Args()[1:])
+		if cmd != "encode" && cmd != "send" {
+			return exitcode.Errorf(exitcode.Usage, "unknown princeton command '%s'", cmd)
+		}
+		if *repeat < 1 || *repeat > maxPrincetonRepeat {
+			return exitcode.Errorf(exitcode.Usage, "-repeat must be 1-%d", maxPrincetonRepeat)
+		}
+
+		var code *princeton.Code
+		var err error
+		switch {
+		case *tristate != "" && *address != "":
+			return exitcode.Errorf(exitcode.Usage, "give either -address or -pt2262, not both")
+		case *tristate != "":
+			code, err = princeton.NewPT2262(*tristate, *pulse)
+		case *address != "":
+			var addr uint64
+			if addr, err = strconv.ParseUint(*address, 0, 32); err != nil {
+				return exitcode.Errorf(exitcode.Usage, "invalid -address '%s'", *address)
+			}
+			if *data > 0xF {
+				return exitcode.Errorf(exitcode.Usage, "-data %d does not fit in 4 bits", *data)
+			}
+			code, err = princeton.NewEV1527(uint32(addr), uint8(*data), *pulse)
+		default:
+			return exitcode.Errorf(exitcode.Usage, "a code is required: -address and -data, or -pt2262")
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+		stream := code.Bitstream(*repeat)
+
+		if cmd == "encode" {
+			if format.IsJSON() {
+				return output.Write(&princetonEncoding{Code: code, Repeat: *repeat, DataRate: code.DataRate(), Bitstream: hex.EncodeToString(stream)})
+			}
+			fmt.Printf("Code:      %s\n", code)
+			fmt.Printf("Bits:      %s\n", code.Bits)
+			fmt.Printf("Data rate: %.1f baud (%d us per bit)\n", code.DataRate(), code.PulseUs)
+			fmt.Printf("Bitstream: %d bytes, %d code words\n", len(stream), *repeat)
+			fmt.Printf("%s\n", hex.EncodeToString(stream))
+			return nil
+		}
+
+		base := profiles.Find(*profileName)
+		if base == nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "unknown profile '%s'", *profileName)
+		}
+		if base.Modulation != profiles.ModASKOOK || base.SyncMode != profiles.SyncNone {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "profile '%s' is not a no-sync OOK profile", *profileName)
+		}
+		p := *base
+		p.DataRateBaud = code.DataRate()
+		p.PktLenMode = profiles.PktLenFixed
+		p.PktLen = uint8(len(stream))
+		p.SetTXPower(*power)
+		if *freqMHz > 0 {
+			p.FrequencyHz = *freqMHz * 1e6
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := config.ApplyProfile(device, &p); err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		if err := device.SetModeTX(); err != nil {
+			return err
+		}
+		defer device.SetModeIDLE()
+		if err := device.RFXmit(stream, 0, 0); err != nil {
+			return err
+		}
+		fmt.Fprintf(format.Progress(), "Sent %s %d times at %.3f MHz\n", code, *repeat, p.FrequencyHz/1e6)
+		if format.IsJSON() {
+			return output.Write(&princetonEncoding{Code: code, Repeat: *repeat, DataRate: code.DataRate(), Bitstream: hex.EncodeToString(stream)})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+)
+
+func init() {
+	register(&command{
+		name:    "profiles",
+		summary: "Check profile files and migrate them to the current schema",
+		setup:   setupProfiles,
+		args:    completeFile,
+	})
+}
+
+// profileFileResult is one file of the -output json result
+type profileFileResult struct {
+	File     string   `json:"file"`
+	Version  *int     `json:"version,omitempty"` // Schema version the file was written with, unless it failed to load
+	Warnings []string `json:"warnings,omitempty"`
+	Changed  bool     `json:"changed"` // migrate rewrote the file, or would have with -n
+	Error    string   `json:"error,omitempty"`
+}
+
+func setupProfiles(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	dryRun := fs.Bool("n", false, "migrate: report what would change without writing")
+	strict := fs.Bool("strict", false, "Reject unknown fields and newer schema versions")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s profiles check [options] file...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s profiles migrate [options] file...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "check loads profile files and prints their schema version and anything\n")
+		fmt.Fprintf(os.Stderr, "loading them had to migrate or ignore. migrate rewrites files written\n")
+		fmt.Fprintf(os.Stderr, "with an older schema in the current one (version %d).\n\n", profiles.SchemaVersion)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s profiles check -strict tests/etc/*.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s profiles migrate -n etc/profiles/*.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s profiles check -output json etc/profiles/*.json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		if len(args) == 0 || (args[0] != "check" && args[0] != "migrate") {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "profiles needs check or migrate")
+		}
+		action := args[0]
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "no profile files given")
+		}
+
+		mode := profiles.LoadLenient
+		if *strict {
+			mode = profiles.LoadStrict
+		}
+
+		results := []*profileFileResult{}
+		failed := 0
+		for _, path := range fs.Args() {
+			res := &profileFileResult{File: path}
+			results = append(results, res)
+			var pc *profiles.ProfileConfig
+			var err error
+			if action == "migrate" && !*dryRun {
+				pc, err = profiles.MigrateProfileFile(path, mode)
+			} else {
+				pc, err = profiles.LoadProfileFile(path, mode)
+			}
+			if err != nil {
+				failed++
+				res.Error = err.Error()
+				if !format.IsJSON() {
+					fmt.Printf("%s: %v\n", path, err)
+				}
+				continue
+			}
+			res.Version, res.Warnings = &pc.FileVersion, pc.Warnings
+			res.Changed = action == "migrate" && pc.FileVersion < profiles.SchemaVersion
+			if format.IsJSON() {
+				continue
+			}
+
+			status := fmt.Sprintf("version %d", pc.FileVersion)
+			if res.Changed {
+				verb := "migrated"
+				if *dryRun {
+					verb = "would migrate"
+				}
+				status = fmt.Sprintf("%s from version %d to %d", verb, pc.FileVersion, profiles.SchemaVersion)
+			}
+			fmt.Printf("%s: %s\n", path, status)
+			for _, w := range pc.Warnings {
+				fmt.Printf("  %s\n", w)
+			}
+		}
+		if format.IsJSON() {
+			if err := output.Write(results); err != nil {
+				return err
+			}
+		}
+
+		if failed > 0 {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%d of %d profile files failed to load", failed, fs.NArg())
+		}
+		return nil
+	}
+}
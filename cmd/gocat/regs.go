@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "regs",
+		summary: "Decode radio registers into annotated, human-readable fields",
+		setup:   setupRegs,
+	})
+}
+
+func setupRegs(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file to decode instead of reading the device")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file to decode instead of reading the device")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s regs decode [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "decode prints what a register set adds up to (frequency, data rate, filter,\n")
+		fmt.Fprintf(os.Stderr, "packet format), then every register with its address, value and bitfields.\n")
+		fmt.Fprintf(os.Stderr, "The registers come from the device, a configuration file or a profile.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s regs decode -d 009a\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s regs decode -c etc/yardsticks/009a.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s regs decode -profile 433-gfsk-crc-19.2k-fec\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s regs decode -c etc/yardsticks/009a.json -output json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		if len(args) == 0 || args[0] != "decode" {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "regs needs decode")
+		}
+		fs.Parse(args[1:])
+		if *configPath != "" && *profileName != "" {
+			return exitcode.Errorf(exitcode.Usage, "-c and -profile are mutually exclusive")
+		}
+
+		regs, err := regsToDecode(*deviceSel, *configPath, *profileName)
+		if err != nil {
+			return err
+		}
+		if format.IsJSON() {
+			return output.Write(regs.Decode())
+		}
+		fmt.Print(regs.Describe())
+		return nil
+	}
+}
+
+// regsToDecode loads the -c configuration or -profile, or dumps the device
+func regsToDecode(deviceSel, configPath, profileName string) (*registers.RegisterMap, error) {
+	switch {
+	case configPath != "":
+		c, err := config.LoadFromFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		regs := c.Registers
+		return &regs, nil
+	case profileName != "":
+		if p := profiles.Find(profileName); p != nil {
+			return p.ToRegisters(), nil
+		}
+		pc, err := profiles.LoadProfileFromFile(profileName)
+		if err != nil {
+			return nil, exitcode.Errorf(exitcode.Usage, "unknown profile '%s': %v", profileName, err)
+		}
+		return &pc.Registers, nil
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(deviceSel))
+	if err != nil {
+		return nil, err
+	}
+	defer device.Close()
+
+	c, err := config.DumpFromDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	return &c.Registers, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/regulatory"
+)
+
+func init() {
+	register(&command{
+		name:    "regulatory",
+		summary: "Check profiles against a region's licence-exempt band rules",
+		setup:   setupRegulatory,
+		args:    completeProfile,
+	})
+}
+
+// regulatoryReport is the -output json result
+type regulatoryReport struct {
+	Region   string              `json:"region"`
+	GainDB   float64             `json:"gain_db"`
+	Profiles []*regulatoryResult `json:"profiles"`
+}
+
+// regulatoryResult is one profile's check: the band it fits, or why it
+// fits none
+type regulatoryResult struct {
+	Profile     string   `json:"profile"`
+	FrequencyHz float64  `json:"frequency_hz"`
+	EIRPDBm     float64  `json:"eirp_dbm"`
+	OK          bool     `json:"ok"`
+	Band        string   `json:"band,omitempty"`
+	Rule        string   `json:"rule,omitempty"`
+	MaxEIRPDBm  float64  `json:"max_eirp_dbm,omitempty"` // The band's limit at the profile's frequency
+	DutyCycle   float64  `json:"duty_cycle,omitempty"`
+	Problems    []string `json:"problems,omitempty"`
+}
+
+func setupRegulatory(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	regionName := fs.String("region", "fcc", "Region to check against: fcc or etsi")
+	gain := fs.Float64("gain", 0, "Amplifier and antenna gain in dB added to the radio output (negative for losses)")
+	hopping := fs.Bool("hopping", false, "Profiles are used by a frequency-hopping system")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s regulatory [options] [profile ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Check the frequency, bandwidth and power of built-in profiles or profile\n")
+		fmt.Fprintf(os.Stderr, "files against the bands of a region, and print the band each fits with its\n")
+		fmt.Fprintf(os.Stderr, "duty cycle. With no profiles, every built-in profile is checked.\n")
+		fmt.Fprintf(os.Stderr, "The limits are a summary for test planning, not legal advice.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s regulatory -region etsi 868-gfsk-smart-38.4k\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s regulatory -gain 12 etc/profiles/009a.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s regulatory -region fcc -output json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		region, err := regulatory.Lookup(*regionName)
+		if err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+
+		list := profiles.All()
+		if fs.NArg() > 0 {
+			list = nil
+			for _, name := range fs.Args() {
+				p := profiles.Find(name)
+				if p == nil {
+					pc, err := profiles.LoadProfileFromFile(name)
+					if err != nil {
+						return exitcode.Errorf(exitcode.Usage, "unknown profile '%s': %v", name, err)
+					}
+					p = &pc.Profile
+				}
+				list = append(list, p)
+			}
+		}
+
+		opts := regulatory.Options{GainDB: *gain, Hopping: *hopping}
+		report := &regulatoryReport{Region: region.Name, GainDB: *gain, Profiles: []*regulatoryResult{}}
+		failed := 0
+		for _, p := range list {
+			b, problems := region.Fit(p, opts)
+			res := &regulatoryResult{Profile: p.Name, FrequencyHz: p.FrequencyHz, EIRPDBm: regulatory.EIRP(p, opts), OK: b != nil, Problems: problems}
+			report.Profiles = append(report.Profiles, res)
+			if b == nil {
+				failed++
+				if !format.IsJSON() {
+					fmt.Printf("FAIL %-32s %v: %s\n", p.Name, regulatory.ErrNonCompliant, strings.Join(problems, "; "))
+				}
+				continue
+			}
+			res.Band, res.Rule, res.MaxEIRPDBm, res.DutyCycle = b.Name, b.Rule, b.MaxEIRP(p.FrequencyHz), b.DutyCycle
+			if !format.IsJSON() {
+				fmt.Printf("OK   %-32s %s\n", p.Name, b)
+			}
+		}
+		if format.IsJSON() {
+			if err := output.Write(report); err != nil {
+				return err
+			}
+		}
+
+		if failed > 0 {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%d of %d profiles fit no %s band", failed, len(list), region.Name)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/remotes"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "remote",
+		summary: "Encode and send Somfy RTS and Chamberlain DIP-switch remote frames",
+		setup:   setupRemote,
+	})
+}
+
+// remoteEncoding is the result in -output json mode
+type remoteEncoding struct {
+	*remotes.Transmission
+	DataRate  float64 `json:"data_rate_baud"`
+	Bitstream string  `json:"bitstream"` // Hex
+	Bytes     int     `json:"bytes"`
+}
+
+func setupRemote(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	protocol := fs.String("protocol", "", "Remote protocol: somfy or chamberlain (required)")
+	freqMHz := fs.Float64("f", 0, "send: frequency in MHz (default: the protocol's)")
+	power := fs.Int("power", 10, "send: transmit power in dBm")
+	address := fs.String("address", "", "somfy: 24-bit remote address, e.g. 0x1A2B3C")
+	rolling := fs.Uint("rolling", 0, "somfy: rolling code; use the next one on every press")
+	cmdName := fs.String("command", "my", "somfy: button: my, up, down, my-up, my-down, up-down, prog, sun-flag or flag")
+	switches := fs.String("switches", "", "chamberlain: DIP switches as 1/0 or +/-, first switch first, e.g. 101100110")
+	unit := fs.Int("unit", 0, "chamberlain: time unit in microseconds (default 500)")
+	repeat := fs.Int("repeat", -1, "Repeats: frames after the first for somfy (default 2), words for chamberlain (default 8)")
+	subPath := fs.String("o", "", "encode: also write the transmission to a Flipper .sub file")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s remote [options] <command>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  encode   Print the on-air OOK bitstream of a press and the rate to send it at\n")
+		fmt.Fprintf(os.Stderr, "  send     Transmit a press\n\n")
+		fmt.Fprintf(os.Stderr, "Somfy RTS receivers only accept a rolling code ahead of the last one they\n")
+		fmt.Fprintf(os.Stderr, "saw, so count -rolling up on every press. PT2262/EV1527 remotes are sent\n")
+		fmt.Fprintf(os.Stderr, "with 'princeton'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s remote encode -protocol somfy -address 0x1A2B3C -rolling 42 -command up\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s remote send -protocol chamberlain -switches 101100110\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s remote encode -protocol chamberlain -switches +-++--++- -o door.sub\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a remote command is required")
+		}
+		cmd := fs.Arg(0)
+		// Options may follow the command
+		fs.Parse(fs.Args()[1:])
+		if cmd != "encode" && cmd != "send" {
+			return exitcode.Errorf(exitcode.Usage, "unknown remote command '%s'", cmd)
+		}
+
+		var t *remotes.Transmission
+		var err error
+		switch *protocol {
+		case "somfy":
+			addr, perr := strconv.ParseUint(*address, 0, 32)
+			if perr != nil {
+				return exitcode.Errorf(exitcode.Usage, "invalid or missing -address '%s'", *address)
+			}
+			if *rolling > 0xFFFF {
+				return exitcode.Errorf(exitcode.Usage, "-rolling %d does not fit in 16 bits", *rolling)
+			}
+			c, perr := remotes.ParseSomfyCommand(*cmdName)
+			if perr != nil {
+				return exitcode.Errorf(exitcode.Usage, "%v", perr)
+			}
+			n := *repeat
+			if n < 0 {
+				n = 2
+			}
+			t, err = remotes.Somfy(uint32(addr), uint16(*rolling), c, n)
+		case "chamberlain":
+			sw, perr := remotes.ParseSwitches(*switches)
+			if perr != nil {
+				return exitcode.Errorf(exitcode.Usage, "%v", perr)
+			}
+			n := *repeat
+			if n < 0 {
+				n = remotes.DefaultChamberlainRepeat
+			}
+			t, err = remotes.Chamberlain(sw, n, *unit)
+		case "":
+			return exitcode.Errorf(exitcode.Usage, "-protocol is required: somfy or chamberlain")
+		default:
+			return exitcode.Errorf(exitcode.Usage, "unknown protocol '%s': want somfy or chamberlain", *protocol)
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+		if *freqMHz > 0 {
+			t.FrequencyHz = *freqMHz * 1e6
+		}
+		result := &remoteEncoding{Transmission: t, DataRate: t.DataRate(), Bitstream: hex.EncodeToString(t.Bitstream), Bytes: len(t.Bitstream)}
+
+		if cmd == "encode" {
+			if *subPath != "" {
+				if err := writeRemoteSub(*subPath, t); err != nil {
+					return exitcode.Errorf(exitcode.Failure, "%v", err)
+				}
+				fmt.Fprintf(format.Progress(), "Wrote %s\n", *subPath)
+			}
+			if format.IsJSON() {
+				return output.Write(result)
+			}
+			fmt.Printf("Transmission: %s\n", t.Description)
+			fmt.Printf("Frequency:    %.3f MHz\n", t.FrequencyHz/1e6)
+			fmt.Printf("Data rate:    %.1f baud (%d us per bit)\n", t.DataRate(), t.UnitUs)
+			fmt.Printf("Bitstream:    %d bytes, %.1f ms on air\n", len(t.Bitstream), float64(t.Duration())/1000)
+			fmt.Printf("%s\n", result.Bitstream)
+			return nil
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := remotes.Send(device, t, *power); err != nil {
+			return err
+		}
+		fmt.Fprintf(format.Progress(), "Sent %s at %.3f MHz\n", t.Description, t.FrequencyHz/1e6)
+		if *protocol == "somfy" {
+			fmt.Fprintf(format.Progress(), "Use -rolling %d for the next press\n", (*rolling+1)&0xFFFF)
+		}
+		if format.IsJSON() {
+			return output.Write(result)
+		}
+		return nil
+	}
+}
+
+// writeRemoteSub writes a transmission as a Flipper RAW file
+func writeRemoteSub(path string, t *remotes.Transmission) error {
+	w, err := capture.Create(path, capture.FormatSub, capture.NewHeader())
+	if err != nil {
+		return err
+	}
+	if err := w.Write(&capture.Packet{Frequency: uint32(t.FrequencyHz), Pulses: t.Pulses()}); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/repl"
+	"github.com/herlein/gocat/pkg/sessionstate"
+	"github.com/herlein/gocat/pkg/yardstick"
+	"golang.org/x/term"
+)
+
+func init() {
+	register(&command{
+		name:    "repl",
+		summary: "Interactive console: tune the radio, peek/poke registers, send and watch packets",
+		setup:   setupREPL,
+	})
+}
+
+func setupREPL(fs *flag.FlagSet) func(args []string) error {
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file to apply first")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file to apply first")
+	sessionName := fs.String("session", "", "Session to resume and keep saved (default: the -profile or -c name, else \""+sessionstate.DefaultName+"\")")
+	noSession := fs.Bool("no-session", false, "Don't resume or save a session")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s repl [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Interactive console in the spirit of 'rfcat -r'. Type 'help' for commands;\n")
+		fmt.Fprintf(os.Stderr, "Tab completes and up/down recall history. When stdin is not a terminal,\n")
+		fmt.Fprintf(os.Stderr, "commands are read one per line, so a console session can be scripted.\n\n")
+		fmt.Fprintf(os.Stderr, "The device, profile, frequency, marked frequencies and recent commands\n")
+		fmt.Fprintf(os.Stderr, "are saved to the session after every command; starting the same session\n")
+		fmt.Fprintf(os.Stderr, "again without -c or -profile resumes where it left off.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s repl -profile 433-ook-keyfob-2.4k\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s repl -session 433-ook-keyfob-2.4k   # resume it later\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  printf 'freq 433.92\\ntx aa55aa55\\n' | %s repl\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		applied := *configPath
+		if applied == "" {
+			applied = *profileName
+		}
+		var session *sessionstate.State
+		if !*noSession {
+			name := *sessionName
+			if name == "" {
+				name = applied
+			}
+			if name == "" {
+				name = sessionstate.DefaultName
+			}
+			var err error
+			if session, err = sessionstate.Load(name); err != nil {
+				return err
+			}
+			if *deviceSel == "" {
+				*deviceSel = session.Device
+			}
+			// A profile given on the command line starts the session afresh
+			if applied != "" {
+				session.Profile = applied
+				session.FrequencyHz = 0
+			}
+		}
+
+		usbCtx := gousb.NewContext()
+		defer usbCtx.Close()
+
+		device, err := yardstick.SelectDevice(usbCtx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if session == nil {
+			if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+				return err
+			}
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			sh := repl.New(device, os.Stdout)
+			defer sh.Close()
+			if session != nil {
+				if err := sh.Resume(session); err != nil {
+					return err
+				}
+			}
+			return scriptREPL(sh, os.Stdin)
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, "gocat> ")
+		if w, h, err := term.GetSize(fd); err == nil {
+			t.SetSize(w, h)
+		}
+
+		// The terminal redraws the prompt around output written through it,
+		// so packets printed by "watch" don't garble the line being edited
+		sh := repl.New(device, t)
+		defer sh.Close()
+		if session != nil {
+			if err := sh.Resume(session); err != nil {
+				return err
+			}
+		}
+		t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+			if key != '\t' || pos != len(line) {
+				return "", 0, false
+			}
+			completed, options := sh.Complete(line)
+			if len(options) > 1 {
+				fmt.Fprintf(t, "%s\n", strings.Join(options, "  "))
+			}
+			return completed, len(completed), true
+		}
+
+		fmt.Fprintf(t, "Connected to %s. Type 'help' for commands, 'quit' to leave.\n", device)
+		if session != nil && len(session.RecentCommands) > 0 {
+			fmt.Fprintf(t, "Resumed session '%s'; 'history' lists its commands.\n", session.Name)
+		}
+		for {
+			line, err := t.ReadLine()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := sh.Exec(line); errors.Is(err, repl.ErrQuit) {
+				return nil
+			} else if err != nil {
+				fmt.Fprintf(t, "Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// scriptREPL runs commands from a non-interactive stdin; the first error
+// stops the script
+func scriptREPL(sh *repl.Shell, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if err := sh.Exec(scanner.Text()); errors.Is(err, repl.ErrQuit) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return scanner.Err()
+}
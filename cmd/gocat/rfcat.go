@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "rfcat",
+		summary: "Convert between rfcat reprRadioConfig() dumps and gocat configurations",
+		setup:   setupRFCat,
+		args:    completeFile,
+	})
+}
+
+// rfcatSaved is the -output json result of import -o
+type rfcatSaved struct {
+	Path         string  `json:"path"`
+	FrequencyHz  float64 `json:"frequency_hz"`
+	Modulation   string  `json:"modulation"`
+	DataRateBaud float64 `json:"data_rate_baud"`
+	SyncWord     uint16  `json:"sync_word"`
+}
+
+// rfcatExport is the -output json result of export
+type rfcatExport struct {
+	Serial string `json:"serial,omitempty"`
+	Repr   string `json:"repr"` // The reprRadioConfig() text
+}
+
+func setupRFCat(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "export: configuration file to convert instead of reading the device")
+	outputFile := fs.String("o", "", "import: write the configuration to this file instead of stdout")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s rfcat import [options] [dump.txt]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s rfcat export [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "import reads the text rfcat's d.reprRadioConfig() prints, from a file or\n")
+		fmt.Fprintf(os.Stderr, "stdin, and writes a configuration for ys1-load-config and -c options.\n")
+		fmt.Fprintf(os.Stderr, "Registers the dump doesn't show, such as AGC and PA, get profile defaults.\n")
+		fmt.Fprintf(os.Stderr, "export prints a device's configuration, or a configuration file's, in the\n")
+		fmt.Fprintf(os.Stderr, "same format. With -output json, export wraps the text in a JSON result and\n")
+		fmt.Fprintf(os.Stderr, "import -o reports the saved configuration.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s rfcat import -o etc/yardsticks/from-rfcat.json dump.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s rfcat export -c etc/yardsticks/009a.json\n", os.Args[0])
+	}
+	return func(args []string) error {
+		if len(args) == 0 || (args[0] != "import" && args[0] != "export") {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "rfcat needs import or export")
+		}
+		action := args[0]
+		fs.Parse(args[1:])
+		out := format.Progress()
+
+		if action == "import" {
+			in := io.Reader(os.Stdin)
+			if fs.NArg() > 0 && fs.Arg(0) != "-" {
+				f, err := os.Open(fs.Arg(0))
+				if err != nil {
+					return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+				}
+				defer f.Close()
+				in = f
+			}
+			c, err := config.ParseRFCat(in, nil)
+			if err != nil {
+				return err
+			}
+			if *outputFile != "" {
+				if err := config.SaveToFile(c, *outputFile); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "Configuration saved to: %s\n", *outputFile)
+				if format.IsJSON() {
+					return output.Write(&rfcatSaved{
+						Path:         *outputFile,
+						FrequencyHz:  c.Registers.GetFrequency(),
+						Modulation:   c.GetModulationString(),
+						DataRateBaud: c.Registers.GetDataRate(),
+						SyncWord:     c.GetSyncWord(),
+					})
+				}
+				return nil
+			}
+			data, err := json.MarshalIndent(c, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		var c *config.DeviceConfig
+		if *configPath != "" {
+			var err error
+			if c, err = config.LoadFromFile(*configPath); err != nil {
+				return err
+			}
+		} else {
+			ctx := gousb.NewContext()
+			defer ctx.Close()
+
+			device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+			if err != nil {
+				return err
+			}
+			defer device.Close()
+
+			if c, err = config.DumpFromDevice(device); err != nil {
+				return err
+			}
+		}
+		if format.IsJSON() {
+			return output.Write(&rfcatExport{Serial: c.Serial, Repr: config.FormatRFCat(c)})
+		}
+		fmt.Print(config.FormatRFCat(c))
+		return nil
+	}
+}
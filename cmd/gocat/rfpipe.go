@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/rfcatnet"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "rfpipe",
+		summary: "Pipe the radio over TCP with rfcat's rf_redirection framing",
+		setup:   setupRFPipe,
+	})
+}
+
+func setupRFPipe(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file to apply first")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file to apply first")
+	freqMHz := fs.Float64("f", 0, "Frequency in MHz (default: keep the configured frequency)")
+	listen := fs.String("listen", rfcatnet.DefaultAddr, "Address to listen on (host:port)")
+	printable := fs.Bool("printable", false, "Send packets as text lines, like rf_redirection(printable=True)")
+	noTX := fs.Bool("no-tx", false, "Discard data from clients instead of transmitting it")
+	blockSize := fs.Uint("blocksize", 0, "Receive block size (0 = firmware default)")
+	fs.Var(&format, "output", output.FlagUsage+" (json writes the final counters)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s rfpipe [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serve the radio over TCP as rfcat's d.rf_redirection does, so rfcat network\n")
+		fmt.Fprintf(os.Stderr, "clients can use this dongle. Bytes a client sends are transmitted, one packet\n")
+		fmt.Fprintf(os.Stderr, "per read; every received packet goes to all clients behind a \"<fH\" header\n")
+		fmt.Fprintf(os.Stderr, "(float32 time, uint16 length).\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s rfpipe -profile 433-2fsk-std-4.8k\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s rfpipe -profile 433-ook-keyfob-2.4k -listen :1900 -no-tx -printable\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if *configPath != "" && *profileName != "" {
+			return fmt.Errorf("-c and -profile are mutually exclusive")
+		}
+		if *blockSize > yardstick.RFMaxRXBlock {
+			return fmt.Errorf("-blocksize %d exceeds maximum %d", *blockSize, yardstick.RFMaxRXBlock)
+		}
+
+		usbCtx := gousb.NewContext()
+		defer usbCtx.Close()
+
+		device, err := yardstick.SelectDevice(usbCtx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+			return err
+		}
+		if *freqMHz > 0 {
+			if err := device.Retune(uint32(*freqMHz * 1e6)); err != nil {
+				return fmt.Errorf("failed to set frequency: %w", err)
+			}
+		}
+		freq, err := device.GetFrequency()
+		if err != nil {
+			return err
+		}
+
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", *listen, err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		server := rfcatnet.New(device, &rfcatnet.Options{
+			Printable:  *printable,
+			NoTransmit: *noTX,
+			BlockSize:  uint16(*blockSize),
+		})
+		fmt.Fprintf(format.Progress(), "Piping %.6f MHz on %s (Ctrl+C to stop)\n", float64(freq)/1e6, ln.Addr())
+		err = server.Serve(ctx, ln)
+
+		st := server.Stats()
+		if format.IsJSON() {
+			output.WriteLine(st)
+		} else {
+			fmt.Printf("\nClients: %d  Received: %d  Transmitted: %d  Dropped: %d\n", st.Clients, st.Received, st.Transmitted, st.Dropped)
+		}
+		return err
+	}
+}
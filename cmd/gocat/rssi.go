@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rssimeter"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "rssi",
+		summary: "Continuously measure received signal strength",
+		setup:   setupRSSI,
+	})
+}
+
+func setupRSSI(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file to apply first")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file to apply first")
+	freqMHz := fs.Float64("f", 0, "Frequency in MHz (default: keep the configured frequency)")
+	rate := fs.Float64("rate", 10, "Samples per second")
+	count := fs.Int("n", 0, "Number of samples (0 = until interrupted)")
+	floor := fs.Int("floor", -110, "Bar graph floor in dBm")
+	ceil := fs.Int("ceil", -20, "Bar graph ceiling in dBm")
+	width := fs.Int("width", 50, "Bar graph width in characters (0 = no graph)")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s rssi [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print RSSI with running min/max/avg, for antenna aiming and TX checks.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s rssi -f 433.92\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s rssi -profile 433-2fsk-std-4.8k -rate 20\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if *configPath != "" && *profileName != "" {
+			return fmt.Errorf("-c and -profile are mutually exclusive")
+		}
+		if *rate <= 0 {
+			return fmt.Errorf("-rate must be positive")
+		}
+
+		ctx := gousb.NewContext()
+		defer ctx.Close()
+
+		device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+			return err
+		}
+		if *freqMHz > 0 {
+			if err := device.Retune(uint32(*freqMHz * 1e6)); err != nil {
+				return fmt.Errorf("failed to set frequency: %w", err)
+			}
+		}
+
+		freq, err := device.GetFrequency()
+		if err != nil {
+			return err
+		}
+		progress := format.Progress()
+		fmt.Fprintf(progress, "Measuring RSSI at %.6f MHz, %.1f samples/s (Ctrl+C to stop)\n", float64(freq)/1e6, *rate)
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+		meter := rssimeter.New(device, time.Duration(float64(time.Second) / *rate))
+		if err := meter.Start(); err != nil {
+			return err
+		}
+		defer meter.Stop()
+
+		var last *rssimeter.Reading
+		for {
+			select {
+			case <-sigChan:
+				printRSSISummary(format, last)
+				return nil
+			case r, ok := <-meter.Readings():
+				if !ok {
+					return nil
+				}
+				last = r
+				if format.IsJSON() {
+					output.WriteLine(r)
+				} else {
+					fmt.Printf("%s %4d dBm  min %4d  max %4d  avg %6.1f  %s\n",
+						r.Timestamp.Format("15:04:05.000"), r.DBm, r.Min, r.Max, r.Avg,
+						rssimeter.Bar(r.DBm, *floor, *ceil, *width))
+				}
+				if *count > 0 && r.Count >= *count {
+					printRSSISummary(format, last)
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// applyConfigOrProfile applies the -c configuration or -profile, if given
+func applyConfigOrProfile(device *yardstick.Device, configPath, profileName string) error {
+	switch {
+	case configPath != "":
+		c, err := config.LoadFromFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		return config.ApplyToDevice(device, c)
+	case profileName != "":
+		if p := profiles.Find(profileName); p != nil {
+			return config.ApplyProfile(device, p)
+		}
+		pc, err := profiles.LoadProfileFromFile(profileName)
+		if err != nil {
+			return fmt.Errorf("unknown profile '%s': %w", profileName, err)
+		}
+		for _, w := range pc.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", profileName, w)
+		}
+		return config.ApplyToDevice(device, &config.DeviceConfig{Serial: device.Serial, Registers: pc.Registers})
+	}
+	return nil
+}
+
+// printRSSISummary prints the final statistics in text mode
+func printRSSISummary(format output.Format, last *rssimeter.Reading) {
+	if format.IsJSON() || last == nil {
+		return
+	}
+	fmt.Printf("\n--- Summary ---\n")
+	fmt.Printf("Samples: %d\n", last.Count)
+	fmt.Printf("Min:     %d dBm\n", last.Min)
+	fmt.Printf("Max:     %d dBm\n", last.Max)
+	fmt.Printf("Avg:     %.1f dBm\n", last.Avg)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/herlein/gocat/pkg/plugin" // plugin stage type for decode()
+	"github.com/herlein/gocat/pkg/schedule"
+	"github.com/herlein/gocat/pkg/script"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "run",
+		summary: "Run a Starlark automation script",
+		setup:   setupScript,
+		args:    completeFile,
+	})
+}
+
+func setupScript(fs *flag.FlagSet) func(args []string) error {
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	schedPath := fs.String("schedule", "", "Schedule file (JSON); radio.tx fails during quiet hours")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s run [options] <script.star> [args...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Run a Starlark automation script. Script arguments are available as argv.\n\n")
+		fmt.Fprintf(os.Stderr, "Builtins:\n")
+		fmt.Fprintf(os.Stderr, "  radio.apply(path)                 Apply a device configuration file\n")
+		fmt.Fprintf(os.Stderr, "  radio.set_frequency(hz)           Tune the radio\n")
+		fmt.Fprintf(os.Stderr, "  radio.precalibrate(freqs)         Cache calibration for a list of frequencies\n")
+		fmt.Fprintf(os.Stderr, "  radio.frequency()                 Current frequency in Hz\n")
+		fmt.Fprintf(os.Stderr, "  radio.rssi()                      Current RSSI in dBm\n")
+		fmt.Fprintf(os.Stderr, "  radio.tx(data, repeat=0)          Transmit bytes or string\n")
+		fmt.Fprintf(os.Stderr, "  radio.rx(timeout_ms=1000)         Receive one packet (None on timeout)\n")
+		fmt.Fprintf(os.Stderr, "  radio.capture(duration_ms)        Receive all packets in a window\n")
+		fmt.Fprintf(os.Stderr, "  scan(center_hz, bandwidth_hz, chans=100, duration_ms=1000, threshold=-70, snapshot=0)\n")
+		fmt.Fprintf(os.Stderr, "                                    Peak-hold spectrum scan, returns [{freq, rssi, snapshot}]\n")
+		fmt.Fprintf(os.Stderr, "  decode(packets, pipeline=\"\")       Run packets through an annotation pipeline\n")
+		fmt.Fprintf(os.Stderr, "  log(...), alert(...), sleep(ms), now(), hex(data)\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return fmt.Errorf("script file is required")
+		}
+
+		env := script.NewEnv(*deviceSel)
+		defer env.Close()
+
+		if *schedPath != "" {
+			sched, err := schedule.LoadConfig(*schedPath)
+			if err != nil {
+				return fmt.Errorf("failed to load schedule: %w", err)
+			}
+			env.Schedule = sched
+		}
+
+		return env.RunFile(fs.Arg(0), fs.Args()[1:])
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/sigdb"
+)
+
+func init() {
+	register(&command{
+		name:    "sigdb",
+		summary: "Import frequency-allocation lists and look up what a frequency is",
+		setup:   setupSigDB,
+		args:    completeFile,
+	})
+}
+
+// lookupResult is the answer for one frequency in -output json mode
+type lookupResult struct {
+	FrequencyHz uint32             `json:"frequency_hz"`
+	Matches     []sigdb.Allocation `json:"matches"`
+}
+
+func setupSigDB(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	dbPaths := fs.String("db", "", "Comma-separated CSV lists to use with the built-in table")
+	outPath := fs.String("o", "", "import: write the normalized list here instead of stdout")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s sigdb [options] <command> [args]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  lookup <MHz>...     List the known allocations containing each frequency\n")
+		fmt.Fprintf(os.Stderr, "  list                List every allocation\n")
+		fmt.Fprintf(os.Stderr, "  import <csv>...     Check public CSV lists and merge them into one normalized\n")
+		fmt.Fprintf(os.Stderr, "                      list for rf-scanner -sigdb and -db\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s sigdb lookup 433.92 868.3\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s sigdb import -o etc/sigdb/local.csv allocations.csv devices.csv\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s sigdb -db etc/sigdb/local.csv lookup 314.98\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a sigdb command is required")
+		}
+		cmd := fs.Arg(0)
+		// Options may follow the command
+		fs.Parse(fs.Args()[1:])
+
+		switch cmd {
+		case "import":
+			return sigdbImport(fs.Args(), *outPath, format)
+		case "lookup", "list":
+		default:
+			return exitcode.Errorf(exitcode.Usage, "unknown sigdb command '%s'", cmd)
+		}
+
+		var files []string
+		for _, p := range strings.Split(*dbPaths, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				files = append(files, p)
+			}
+		}
+		db, err := sigdb.Load(files...)
+		if err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+
+		if cmd == "list" {
+			if format.IsJSON() {
+				return output.Write(db.All())
+			}
+			for _, a := range db.All() {
+				printAllocation(a)
+			}
+			return nil
+		}
+
+		if fs.NArg() < 1 {
+			return exitcode.Errorf(exitcode.Usage, "lookup needs at least one frequency in MHz")
+		}
+		var results []lookupResult
+		for _, arg := range fs.Args() {
+			mhz, err := strconv.ParseFloat(arg, 64)
+			if err != nil || mhz <= 0 {
+				return exitcode.Errorf(exitcode.Usage, "invalid frequency '%s'", arg)
+			}
+			freq := uint32(mhz*1e6 + 0.5)
+			matches := db.Lookup(freq)
+			if matches == nil {
+				matches = []sigdb.Allocation{}
+			}
+			results = append(results, lookupResult{FrequencyHz: freq, Matches: matches})
+		}
+
+		if format.IsJSON() {
+			return output.Write(results)
+		}
+		for _, r := range results {
+			fmt.Printf("%.3f MHz:\n", float64(r.FrequencyHz)/1e6)
+			if len(r.Matches) == 0 {
+				fmt.Println("  no known allocation")
+			}
+			for _, a := range r.Matches {
+				fmt.Print("  ")
+				printAllocation(a)
+			}
+		}
+		return nil
+	}
+}
+
+// sigdbImport parses CSV lists and writes them out in the canonical format
+func sigdbImport(paths []string, outPath string, format output.Format) error {
+	if len(paths) == 0 {
+		return exitcode.Errorf(exitcode.Usage, "import needs at least one CSV file")
+	}
+
+	db := sigdb.New()
+	progress := format.Progress()
+	for _, path := range paths {
+		n, err := db.ImportFile(path)
+		if err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		fmt.Fprintf(progress, "%s: %d entries\n", path, n)
+	}
+
+	if format.IsJSON() && outPath == "" {
+		return output.Write(db.All())
+	}
+
+	w := os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", outPath, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := db.WriteCSV(w); err != nil {
+		return fmt.Errorf("failed to write list: %w", err)
+	}
+	if outPath != "" {
+		fmt.Fprintf(progress, "Wrote %d entries to %s\n", db.Len(), outPath)
+	}
+	return nil
+}
+
+// printAllocation prints one allocation as a text line
+func printAllocation(a sigdb.Allocation) {
+	region := ""
+	if a.Region != "" {
+		region = " [" + a.Region + "]"
+	}
+	fmt.Printf("%9.3f - %9.3f MHz  %s%s\n", float64(a.StartHz)/1e6, float64(a.EndHz)/1e6, a.Label, region)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/sigstore"
+)
+
+func init() {
+	register(&command{
+		name:    "signals",
+		summary: "Query and annotate the known-signal history kept by rf-scanner -history-db",
+		setup:   setupSignals,
+	})
+}
+
+func setupSignals(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	dbPath := fs.String("db", "", "History file written by rf-scanner -history-db (required)")
+	freq := fs.String("f", "", "list: frequency range in MHz, e.g. 433.8-434.0")
+	since := fs.Duration("since", 0, "list: only signals seen in this long, e.g. 24h")
+	text := fs.String("grep", "", "list: only signals whose label or annotation contains this")
+	annotated := fs.Bool("annotated", false, "list: only annotated signals")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s signals -db <file> [options] <command> [args]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  list                      Known signals, by frequency\n")
+		fmt.Fprintf(os.Stderr, "  show <signal>             One signal in full\n")
+		fmt.Fprintf(os.Stderr, "  annotate <signal> <text>  Name a signal, e.g. \"garage remote\" (\"\" removes the name)\n")
+		fmt.Fprintf(os.Stderr, "  forget <signal>           Remove a signal from the history\n\n")
+		fmt.Fprintf(os.Stderr, "A signal is its ID or a frequency in MHz with a decimal point.\n")
+		fmt.Fprintf(os.Stderr, "Record the history with 'rf-scanner -history-db <file>'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s signals -db known.db list -since 24h\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s signals -db known.db annotate 433.92 garage remote\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s signals -db known.db list -grep garage\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a signals command is required")
+		}
+		cmd := fs.Arg(0)
+		// Options may follow the command
+		fs.Parse(fs.Args()[1:])
+
+		switch cmd {
+		case "list":
+		case "show", "forget":
+			if fs.NArg() != 1 {
+				return exitcode.Errorf(exitcode.Usage, "%s needs one signal", cmd)
+			}
+		case "annotate":
+			if fs.NArg() < 2 {
+				return exitcode.Errorf(exitcode.Usage, "annotate needs a signal and its annotation")
+			}
+		default:
+			return exitcode.Errorf(exitcode.Usage, "unknown signals command '%s'", cmd)
+		}
+		if *dbPath == "" {
+			return exitcode.Errorf(exitcode.Usage, "-db is required")
+		}
+		if _, err := os.Stat(*dbPath); err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "no signal history: %v", err)
+		}
+
+		store, err := sigstore.Open(*dbPath)
+		if err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		defer store.Close()
+
+		if cmd == "list" {
+			q := &sigstore.Query{Text: *text, Annotated: *annotated}
+			if *freq != "" {
+				_, ranges, err := scanner.ParseFrequencies(*freq)
+				if err != nil || len(ranges) != 1 {
+					return exitcode.Errorf(exitcode.Usage, "invalid -f '%s'", *freq)
+				}
+				q.StartHz, q.EndHz = ranges[0].StartHz, ranges[0].EndHz
+			}
+			if *since > 0 {
+				q.Since = time.Now().Add(-*since)
+			}
+			entries := store.Query(q)
+			if format.IsJSON() {
+				if entries == nil {
+					entries = []sigstore.Entry{}
+				}
+				return output.Write(entries)
+			}
+			if len(entries) == 0 {
+				fmt.Println("No signals")
+				return nil
+			}
+			fmt.Println("  ID  Frequency (MHz)  Best RSSI  Seen  Last seen             Name")
+			for _, e := range entries {
+				fmt.Printf("%4d  %15.3f  %5.1f dBm  %4d  %-20s  %s\n", e.ID, float64(e.FrequencyHz)/1e6, e.RSSI,
+					e.Sightings, e.LastSeen.Local().Format("2006-01-02 15:04:05"), e.Name())
+			}
+			return nil
+		}
+
+		e, err := findSignal(store, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		switch cmd {
+		case "annotate":
+			annotation := strings.TrimSpace(strings.Join(fs.Args()[1:], " "))
+			if err := store.Annotate(e.ID, annotation); err != nil {
+				return err
+			}
+		case "forget":
+			if err := store.Remove(e.ID); err != nil {
+				return err
+			}
+			if !format.IsJSON() {
+				fmt.Printf("Forgot signal %d at %.3f MHz\n", e.ID, float64(e.FrequencyHz)/1e6)
+			}
+			return nil
+		}
+
+		if format.IsJSON() {
+			return output.Write(e)
+		}
+		printSignal(e)
+		return nil
+	}
+}
+
+// findSignal resolves an ID, or a frequency in MHz with a decimal point,
+// to an entry
+func findSignal(store *sigstore.Store, arg string) (*sigstore.Entry, error) {
+	if !strings.Contains(arg, ".") {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, exitcode.Errorf(exitcode.Usage, "invalid signal '%s': want an ID or MHz", arg)
+		}
+		if e := store.Get(id); e != nil {
+			return e, nil
+		}
+		return nil, exitcode.Errorf(exitcode.Usage, "no signal with ID %d", id)
+	}
+	mhz, err := strconv.ParseFloat(arg, 64)
+	if err != nil || mhz <= 0 {
+		return nil, exitcode.Errorf(exitcode.Usage, "invalid signal '%s': want an ID or MHz", arg)
+	}
+	if e := store.Lookup(uint32(mhz*1e6 + 0.5)); e != nil {
+		return e, nil
+	}
+	return nil, exitcode.Errorf(exitcode.Usage, "no known signal within %.0f kHz of %.3f MHz", float64(store.ToleranceHz)/1e3, mhz)
+}
+
+// printSignal prints an entry in full
+func printSignal(e *sigstore.Entry) {
+	fmt.Printf("Signal:     %d\n", e.ID)
+	fmt.Printf("Frequency:  %.3f MHz\n", float64(e.FrequencyHz)/1e6)
+	if e.Annotation != "" {
+		fmt.Printf("Annotation: %s\n", e.Annotation)
+	}
+	if e.Label != "" {
+		fmt.Printf("Likely:     %s\n", e.Label)
+	}
+	fmt.Printf("RSSI:       %.1f dBm at best, %.1f dBm last\n", e.RSSI, e.LastRSSI)
+	fmt.Printf("Seen:       %d times, in %d sweeps\n", e.Sightings, e.Sweeps)
+	fmt.Printf("First seen: %s\n", e.FirstSeen.Local().Format(time.RFC3339))
+	fmt.Printf("Last seen:  %s\n", e.LastSeen.Local().Format(time.RFC3339))
+	if e.Class != nil {
+		fmt.Printf("Class:      %s\n", e.Class)
+	}
+}
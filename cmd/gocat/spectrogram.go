@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/capture/sigmf"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/spectrogram"
+)
+
+func init() {
+	register(&command{
+		name:    "spectrogram",
+		summary: "Browse long-term spectrum history recorded with rf-scanner -db, and convert it to and from SigMF",
+		setup:   setupSpectrogram,
+		args:    completeFile,
+	})
+}
+
+// spectrogramInfo is the info command's result in -output json mode
+type spectrogramInfo struct {
+	File    string           `json:"file"`
+	Plan    spectrogram.Plan `json:"plan"`
+	Created time.Time        `json:"created"`
+	Rows    int              `json:"rows"`
+	First   *time.Time       `json:"first,omitempty"`
+	Last    *time.Time       `json:"last,omitempty"`
+}
+
+func setupSpectrogram(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	listen := fs.String("http", "localhost:8080", "serve: address to listen on")
+	above := fs.Float64("above", -70, "first: RSSI threshold in dBm")
+	freq := fs.String("f", "", "first: frequency or range in MHz, e.g. 433.92 or 433.8-434.0 (default: whole plan)")
+	mean := fs.Bool("mean", false, "export: write each row's mean RSSI instead of its peak")
+	bin := fs.Duration("bin", time.Minute, "import: time resolution of the rows created")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s spectrogram [options] <command> <file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  serve <file>   Web viewer: a zoomable waterfall over the whole history\n")
+		fmt.Fprintf(os.Stderr, "  first <file>   When a signal was first seen above -above dBm\n")
+		fmt.Fprintf(os.Stderr, "  info <file>    Frequency plan and time range\n")
+		fmt.Fprintf(os.Stderr, "  export <file> <out.sigmf-meta|out.csv>\n")
+		fmt.Fprintf(os.Stderr, "                 Write every row as a sweep of a SigMF spectrum recording,\n")
+		fmt.Fprintf(os.Stderr, "                 or as a CSV row for plot-spectrum\n")
+		fmt.Fprintf(os.Stderr, "  import <in.sigmf-meta> <file>\n")
+		fmt.Fprintf(os.Stderr, "                 Add the sweeps of a SigMF spectrum recording (rf-scanner -sigmf)\n\n")
+		fmt.Fprintf(os.Stderr, "Record the history with 'rf-scanner -db <file>'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s spectrogram serve 433.spec\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s spectrogram first -f 433.4-433.5 -above -65 433.spec\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s spectrogram export 433.spec 433.sigmf-meta\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return exitcode.Errorf(exitcode.Usage, "a spectrogram command is required")
+		}
+		cmd := fs.Arg(0)
+		// Options may follow the command
+		fs.Parse(fs.Args()[1:])
+
+		switch cmd {
+		case "serve", "first", "info":
+			if fs.NArg() != 1 {
+				return exitcode.Errorf(exitcode.Usage, "%s needs one spectrogram file", cmd)
+			}
+		case "export", "import":
+			if fs.NArg() != 2 {
+				return exitcode.Errorf(exitcode.Usage, "%s needs an input and an output file", cmd)
+			}
+			if cmd == "import" {
+				return spectrogramImport(fs.Arg(0), fs.Arg(1), *bin)
+			}
+		default:
+			return exitcode.Errorf(exitcode.Usage, "unknown spectrogram command '%s'", cmd)
+		}
+		path := fs.Arg(0)
+
+		db, err := spectrogram.Open(path)
+		if err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		defer db.Close()
+
+		switch cmd {
+		case "serve":
+			return spectrogramServe(db, path, *listen)
+		case "first":
+			return spectrogramFirst(db, *freq, float32(*above), format)
+		case "export":
+			return spectrogramExport(db, fs.Arg(1), *mean)
+		}
+
+		info := spectrogramInfo{File: path, Plan: db.Plan(), Created: db.Created()}
+		if info.Rows, err = db.Len(); err != nil {
+			return err
+		}
+		first, last, ok, err := db.Range()
+		if err != nil {
+			return err
+		}
+		if ok {
+			info.First, info.Last = &first, &last
+		}
+		if format.IsJSON() {
+			return output.Write(info)
+		}
+		p := info.Plan
+		fmt.Printf("File:      %s\n", path)
+		fmt.Printf("Channels:  %d, %.3f - %.3f MHz every %.1f kHz\n", p.Channels,
+			float64(p.FrequencyHz(0))/1e6, float64(p.FrequencyHz(p.Channels-1))/1e6, float64(p.SpacingHz)/1e3)
+		fmt.Printf("Bins:      %v\n", p.Bin)
+		fmt.Printf("Rows:      %d\n", info.Rows)
+		if ok {
+			fmt.Printf("Covers:    %s to %s\n", first.Format(time.RFC3339), last.Add(p.Bin).Format(time.RFC3339))
+		}
+		return nil
+	}
+}
+
+func spectrogramServe(db *spectrogram.DB, path, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/ (Ctrl+C to stop)\n", path, ln.Addr())
+	return http.Serve(ln, spectrogram.Handler(db))
+}
+
+func spectrogramFirst(db *spectrogram.DB, freq string, above float32, format output.Format) error {
+	p := db.Plan()
+	low, high := p.FrequencyHz(0), p.FrequencyHz(p.Channels-1)
+	if freq != "" {
+		lo, hi, found := strings.Cut(freq, "-")
+		if !found {
+			hi = lo
+		}
+		a, err1 := strconv.ParseFloat(lo, 64)
+		b, err2 := strconv.ParseFloat(hi, 64)
+		if err1 != nil || err2 != nil || a <= 0 || b < a {
+			return exitcode.Errorf(exitcode.Usage, "invalid -f '%s'", freq)
+		}
+		low, high = uint32(a*1e6+0.5), uint32(b*1e6+0.5)
+	}
+
+	s, ok, err := db.FirstAbove(low, high, above)
+	if err != nil {
+		return err
+	}
+	if format.IsJSON() {
+		if !ok {
+			return output.Write(nil)
+		}
+		return output.Write(s)
+	}
+	if !ok {
+		fmt.Printf("Never above %.1f dBm between %.3f and %.3f MHz\n", above, float64(low)/1e6, float64(high)/1e6)
+		return nil
+	}
+	fmt.Printf("First seen %s at %.3f MHz, %.1f dBm\n", s.Time.Format(time.RFC3339), float64(s.FrequencyHz)/1e6, s.RSSI)
+	return nil
+}
+
+// spectrogramExport writes every row as one sweep, at the row's start time
+func spectrogramExport(db *spectrogram.DB, out string, mean bool) error {
+	var rows []*spectrogram.Row
+	first, last, ok, err := db.Range()
+	if err == nil && ok {
+		rows, err = db.Rows(first, last.Add(time.Second), 0)
+	}
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(out, ".csv") {
+		return spectrogramExportCSV(db, rows, out, mean)
+	}
+	w, err := sigmf.CreateSpectrum(out, "")
+	if err != nil {
+		return err
+	}
+	p := db.Plan()
+	for _, row := range rows {
+		rssi := row.Peak
+		if mean {
+			rssi = row.Mean
+		}
+		if err := w.Write(&sigmf.Sweep{Time: row.Time, BaseHz: p.BaseHz, SpacingHz: p.SpacingHz, RSSI: rssi}); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d sweeps to %s\n", len(rows), out)
+	return nil
+}
+
+// spectrogramExportCSV writes the rows as waterfall CSV, for plot-spectrum
+func spectrogramExportCSV(db *spectrogram.DB, rows []*spectrogram.Row, out string, mean bool) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer f.Close()
+	w := specan.NewWaterfallWriter(f)
+	p := db.Plan()
+	for _, row := range rows {
+		rssi := row.Peak
+		if mean {
+			rssi = row.Mean
+		}
+		if err := w.Write(row.Time, p.BaseHz, p.SpacingHz, rssi); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d sweeps to %s\n", len(rows), out)
+	return nil
+}
+
+// spectrogramImport bins the sweeps of a SigMF recording into a spectrogram
+// file, creating it with the recording's plan if needed
+func spectrogramImport(in, out string, bin time.Duration) error {
+	r, err := sigmf.OpenSpectrum(in)
+	if err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+	}
+	defer r.Close()
+
+	var db *spectrogram.DB
+	var rec *spectrogram.Recorder
+	n := 0
+	for {
+		sw, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+		if db == nil {
+			db, err = spectrogram.Create(out, spectrogram.Plan{BaseHz: sw.BaseHz, SpacingHz: sw.SpacingHz, Channels: len(sw.RSSI), Bin: bin})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			if rec, err = spectrogram.NewRecorder(db); err != nil {
+				return err
+			}
+		}
+		if err := rec.Add(sw.Time, sw.BaseHz, sw.SpacingHz, sw.RSSI); err != nil {
+			return err
+		}
+		n++
+	}
+	if rec == nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%s has no sweeps", in)
+	}
+	if err := rec.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d sweeps into %s\n", n, out)
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/tdma"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "tdma",
+		summary: "Run a TDMA master or node for shared-channel multi-node tests",
+		setup:   setupTDMA,
+	})
+}
+
+func setupTDMA(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	deviceSel := fs.String("d", "", yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file shared by all nodes")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file shared by all nodes")
+	master := fs.Bool("master", false, "Run as the master: send beacons and assign slots")
+	nodeList := fs.String("nodes", "", "Master: comma-separated node IDs (1-255) in slot order")
+	id := fs.Uint("id", 0, "Node: this node's ID")
+	payloadLen := fs.Int("payload", 16, "Master: node payload size in bytes the slots are sized for")
+	margin := fs.Duration("margin", tdma.DefaultMargin, "Master: latency margin added to each guard interval")
+	frames := fs.Int("frames", 0, "Number of frames (0 = until interrupted)")
+	wait := fs.Duration("wait", 10*time.Second, "Node: how long to wait for a beacon")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s tdma [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "The master beacons every frame with the slot plan; each node transmits once per\n")
+		fmt.Fprintf(os.Stderr, "frame in its own slot. Slots are sized from the profile's packet airtime plus a\n")
+		fmt.Fprintf(os.Stderr, "guard interval. All nodes must use the same profile.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s tdma -master -profile 433-2fsk-fast-38.4k -nodes 1,2,3\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s tdma -profile 433-2fsk-fast-38.4k -id 2\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if *configPath != "" && *profileName != "" {
+			return exitcode.Errorf(exitcode.Usage, "-c and -profile are mutually exclusive")
+		}
+		if *configPath == "" && *profileName == "" {
+			return exitcode.Errorf(exitcode.Usage, "a shared -c or -profile is required")
+		}
+		var nodes []uint8
+		if *master {
+			var err error
+			if nodes, err = parseNodeIDs(*nodeList); err != nil {
+				return exitcode.Errorf(exitcode.Usage, "%v", err)
+			}
+		} else if *id < 1 || *id > 255 {
+			return exitcode.Errorf(exitcode.Usage, "-id must be 1-255")
+		}
+
+		usbCtx := gousb.NewContext()
+		defer usbCtx.Close()
+
+		device, err := yardstick.SelectDevice(usbCtx, yardstick.DeviceSelector(*deviceSel))
+		if err != nil {
+			return err
+		}
+		defer device.Close()
+
+		if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		progress := format.Progress()
+
+		if *master {
+			plan, err := tdma.NewPlan(device.Airtime, nodes, *payloadLen, *margin)
+			if err != nil {
+				return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+			}
+			fmt.Fprintf(progress, "Frame %s: beacon %s, %d slots of %s (airtime %s, guard %s)\n",
+				plan.FrameLen(), plan.BeaconSlot, len(plan.Nodes), plan.SlotLen, plan.Airtime, plan.Guard)
+
+			stats, err := tdma.RunMaster(ctx, device, plan, *frames, func(p *tdma.Packet) {
+				if format.IsJSON() {
+					output.WriteLine(p)
+					return
+				}
+				late := ""
+				if p.Late {
+					late = " LATE"
+				}
+				fmt.Printf("%s frame %d slot %d node %d: %s%s\n",
+					p.Timestamp.Format("15:04:05.000"), p.Frame, p.Slot, p.Node, hex.EncodeToString(p.Payload), late)
+			})
+			if stats != nil {
+				printTDMAStats(format, stats)
+			}
+			return err
+		}
+
+		fmt.Fprintf(progress, "Node %d waiting for beacons (Ctrl+C to stop)\n", *id)
+		result, err := tdma.RunNode(ctx, device, uint8(*id), *frames, *wait, func(frame uint32) []byte {
+			payload := make([]byte, 4)
+			binary.LittleEndian.PutUint32(payload, frame)
+			return payload
+		})
+		if result != nil {
+			if format.IsJSON() {
+				output.Write(result)
+			} else {
+				fmt.Printf("\nNode %d slot %d: %d beacons, %d sent, %d frames missed\n",
+					result.Node, result.Slot, result.Beacons, result.Sent, result.Missed)
+			}
+		}
+		if err != nil {
+			return exitcode.Errorf(exitcode.RFTestFailed, "%v", err)
+		}
+		return nil
+	}
+}
+
+// parseNodeIDs parses the -nodes list
+func parseNodeIDs(s string) ([]uint8, error) {
+	if s == "" {
+		return nil, fmt.Errorf("-master needs -nodes")
+	}
+	var ids []uint8
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 || n > 255 {
+			return nil, fmt.Errorf("invalid node ID '%s' (1-255)", f)
+		}
+		ids = append(ids, uint8(n))
+	}
+	return ids, nil
+}
+
+// printTDMAStats prints the per-node delivery summary
+func printTDMAStats(format output.Format, stats *tdma.MasterStats) {
+	if format.IsJSON() {
+		output.Write(stats)
+		return
+	}
+	fmt.Printf("\n--- %d frames ---\n", stats.Frames)
+	fmt.Printf("%-6s %-6s %8s %6s %7s\n", "Node", "Slot", "Received", "Late", "PER")
+	for _, ns := range stats.Nodes {
+		fmt.Printf("%-6d %-6d %8d %6d %6.1f%%\n", ns.Node, ns.Slot, ns.Received, ns.Late, ns.PER*100)
+	}
+	if stats.Other > 0 {
+		fmt.Printf("Other packets: %d\n", stats.Other)
+	}
+}
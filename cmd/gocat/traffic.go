@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/trafficgen"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func init() {
+	register(&command{
+		name:    "traffic",
+		summary: "Stress a receiver with synthetic traffic from a second device",
+		setup:   setupTraffic,
+	})
+}
+
+func setupTraffic(fs *flag.FlagSet) func(args []string) error {
+	var format output.Format
+	txSel := fs.String("tx", "#0", "Transmitting device: "+yardstick.DeviceFlagUsage())
+	rxSel := fs.String("rx", "#1", "Receiving device: "+yardstick.DeviceFlagUsage())
+	configPath := fs.String("c", "", "Configuration file applied to both devices")
+	profileName := fs.String("profile", "", "Built-in profile name or profile file applied to both devices")
+	frames := fs.Int("n", trafficgen.DefaultFrames, "Frames to offer")
+	duration := fs.Duration("duration", 0, "Offer traffic for this long instead of -n frames")
+	rate := fs.Float64("rate", trafficgen.DefaultRate, "Mean frames per second")
+	burst := fs.Int("burst", 1, "Frames sent back-to-back before pausing")
+	size := fs.String("size", strconv.Itoa(trafficgen.DefaultSize), "Frame size or range in bytes, e.g. 16 or 12-60 (fixed length profiles use the packet length)")
+	badCRC := fs.Float64("bad-crc", 0, "Fraction of frames with a corrupted CRC (0-1)")
+	wrongSync := fs.Float64("wrong-sync", 0, "Fraction of frames sent on the wrong sync word (0-1)")
+	repeat := fs.Float64("repeat", 0, "Fraction of frames that repeat the last good frame (0-1)")
+	dedupe := fs.Duration("dedupe", 0, "Receiver dedupe window, e.g. 1s (0 = off)")
+	squelch := fs.Int("squelch", 0, "Receiver squelch: drop packets below this RSSI in dBm (0 = off)")
+	seed := fs.Int64("seed", 0, "Random seed for sizes and the mix (0 = time based)")
+	fs.Var(&format, "output", output.FlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s traffic [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "One device offers a mix of frame sizes, rates and bursts, with corrupted CRCs,\n")
+		fmt.Fprintf(os.Stderr, "wrong sync words and repeats mixed in, while the other receives through the\n")
+		fmt.Fprintf(os.Stderr, "streaming pipeline. The report compares offered with received load and counts\n")
+		fmt.Fprintf(os.Stderr, "lost, corrupted, duplicated, reordered and leaked frames.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s traffic -profile 433-2fsk-std-9.6k -n 500 -rate 50 -burst 5 -size 12-60\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s traffic -profile 915-gfsk-std-38.4k -duration 1m -repeat 0.2 -dedupe 1s -wrong-sync 0.1\n", os.Args[0])
+	}
+	return func(args []string) error {
+		fs.Parse(args)
+
+		if *configPath != "" && *profileName != "" {
+			return exitcode.Errorf(exitcode.Usage, "-c and -profile are mutually exclusive")
+		}
+		if *configPath == "" && *profileName == "" {
+			return exitcode.Errorf(exitcode.Usage, "a shared -c or -profile is required")
+		}
+		if *txSel == *rxSel {
+			return exitcode.Errorf(exitcode.Usage, "-tx and -rx must be different devices")
+		}
+		opts := &trafficgen.Options{
+			Frames:   *frames,
+			Duration: *duration,
+			Rate:     *rate,
+			Burst:    *burst,
+			Mix:      trafficgen.Mix{BadCRC: *badCRC, WrongSync: *wrongSync, Repeat: *repeat},
+			Seed:     *seed,
+		}
+		lo, hi, found := strings.Cut(*size, "-")
+		if !found {
+			hi = lo
+		}
+		var err1, err2 error
+		opts.MinSize, err1 = strconv.Atoi(lo)
+		opts.MaxSize, err2 = strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || opts.MinSize < trafficgen.MinFrame || opts.MaxSize < opts.MinSize {
+			return exitcode.Errorf(exitcode.Usage, "invalid -size '%s' (at least %d bytes)", *size, trafficgen.MinFrame)
+		}
+		if m := opts.Mix; m.BadCRC < 0 || m.WrongSync < 0 || m.Repeat < 0 || m.BadCRC+m.WrongSync+m.Repeat > 1 {
+			return exitcode.Errorf(exitcode.Usage, "-bad-crc, -wrong-sync and -repeat must be 0-1 and add up to at most 1")
+		}
+		opts.Receive.Dedupe = *dedupe
+		opts.Receive.SquelchMin = *squelch
+
+		usbCtx := gousb.NewContext()
+		defer usbCtx.Close()
+
+		tx, err := yardstick.SelectDevice(usbCtx, yardstick.DeviceSelector(*txSel))
+		if err != nil {
+			return err
+		}
+		defer tx.Close()
+		rx, err := yardstick.SelectDevice(usbCtx, yardstick.DeviceSelector(*rxSel))
+		if err != nil {
+			return err
+		}
+		defer rx.Close()
+
+		for _, device := range []*yardstick.Device{tx, rx} {
+			if err := applyConfigOrProfile(device, *configPath, *profileName); err != nil {
+				return err
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(format.Progress(), "Offering traffic from %s to %s (Ctrl+C to stop)\n", tx.Serial, rx.Serial)
+
+		rep, err := trafficgen.Run(ctx, tx, rx, opts)
+		if err != nil {
+			return err
+		}
+		printTrafficReport(format, rep)
+		if rep.Kinds[trafficgen.Good].Offered > 0 && rep.Delivered == 0 {
+			return exitcode.Errorf(exitcode.RFTestFailed, "no frames were delivered")
+		}
+		return nil
+	}
+}
+
+// printTrafficReport prints the offered versus received summary
+func printTrafficReport(format output.Format, rep *trafficgen.Report) {
+	if format.IsJSON() {
+		output.Write(rep)
+		return
+	}
+	fmt.Printf("\n--- %d frames in %d ms ---\n", rep.Offered, rep.DurationMS)
+	fmt.Printf("Offered:  %6d frames %8d bytes  %8.1f frames/s %9.1f bytes/s\n", rep.Offered, rep.OfferedBytes, rep.OfferedRate, rep.OfferedBps)
+	fmt.Printf("Received: %6d frames %8d bytes  %8.1f frames/s %9.1f bytes/s\n", rep.Received, rep.ReceivedBytes, rep.ReceivedRate, rep.ReceivedBps)
+	if rep.TxErrors > 0 {
+		fmt.Printf("Transmit errors: %d\n", rep.TxErrors)
+	}
+	fmt.Printf("\n%-12s %8s %8s %8s\n", "Kind", "Offered", "Bytes", "Received")
+	for _, k := range trafficgen.Kinds {
+		ks := rep.Kinds[k]
+		fmt.Printf("%-12s %8d %8d %8d\n", k, ks.Offered, ks.Bytes, ks.Received)
+	}
+	fmt.Printf("\nDelivered:  %d (%.1f%%)\n", rep.Delivered, rep.Delivery*100)
+	fmt.Printf("Lost:       %d\n", rep.Lost)
+	fmt.Printf("Corrupted:  %d\n", rep.Corrupted)
+	fmt.Printf("Duplicates: %d (dedupe dropped %d)\n", rep.Duplicates, rep.DedupeDropped)
+	fmt.Printf("Reordered:  %d\n", rep.Reordered)
+	fmt.Printf("Leaked:     %d\n", rep.Leaked)
+	fmt.Printf("Foreign:    %d\n", rep.Foreign)
+	if rep.Squelched > 0 {
+		fmt.Printf("Squelched:  %d\n", rep.Squelched)
+	}
+}
@@ -1,7 +1,8 @@
 // lsys1: List all connected YardStick One devices
 //
-// This tool enumerates all YardStick One devices connected to the system
-// and displays their serial numbers and basic information.
+// This tool enumerates all YardStick One devices, and other RfCat dongles
+// (Dons dongle, Chronos dongle, SRF stick), connected to the system and
+// displays their serial numbers and basic information.
 package main
 
 import (
@@ -10,41 +11,62 @@ import (
 	"os"
 
 	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
 func main() {
+	var format output.Format
 	verbose := flag.Bool("v", false, "Verbose output (show additional device details)")
+	flag.Var(&format, "output", output.FlagUsage)
 	flag.Parse()
 
 	// Create USB context
 	context := gousb.NewContext()
 	defer context.Close()
 
-	// Find all YardStick One devices
+	// Find all YardStick One and other RfCat dongles
 	devices, err := yardstick.FindAllDevices(context)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to enumerate devices: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
+	}
+	for _, device := range devices {
+		defer device.Close()
+	}
+
+	if format.IsJSON() {
+		infos := make([]yardstick.DeviceInfo, len(devices))
+		for i, device := range devices {
+			infos[i] = device.Info(true)
+		}
+		output.Write(infos)
+		return
 	}
 
 	if len(devices) == 0 {
-		fmt.Println("No YardStick One devices found")
+		fmt.Println("No YardStick One or other RfCat devices found")
 		os.Exit(0)
 	}
 
-	fmt.Printf("Found %d YardStick One device(s):\n", len(devices))
+	fmt.Printf("Found %d device(s):\n", len(devices))
 	fmt.Println()
 
 	for i, device := range devices {
-		defer device.Close()
-
 		if *verbose {
 			fmt.Printf("Device #%d:\n", i)
 			fmt.Printf("  Serial:       %s\n", device.Serial)
 			fmt.Printf("  Bus:Address:  %d:%d\n", device.Bus, device.Address)
 			fmt.Printf("  Manufacturer: %s\n", device.Manufacturer)
 			fmt.Printf("  Product:      %s\n", device.Product)
+			caps := device.Capabilities()
+			fmt.Printf("  Model:        %s (0x%04X)\n", caps.Model, device.ProductID)
+			if caps.Amplifier {
+				fmt.Printf("  Amplifier:    yes, up to %.0f dBm\n", caps.MaxPowerDBm)
+			} else {
+				fmt.Printf("  Amplifier:    none, up to %.0f dBm\n", caps.MaxPowerDBm)
+			}
 
 			// Try to get firmware info
 			buildType, err := device.GetBuildType()
@@ -57,24 +79,13 @@ func main() {
 			// Try to get chip info
 			partNum, err := device.GetPartNum()
 			if err == nil {
-				chipName := "Unknown"
-				switch partNum {
-				case yardstick.PartNumCC1110:
-					chipName = "CC1110"
-				case yardstick.PartNumCC1111:
-					chipName = "CC1111"
-				case yardstick.PartNumCC2510:
-					chipName = "CC2510"
-				case yardstick.PartNumCC2511:
-					chipName = "CC2511"
-				}
-				fmt.Printf("  Chip:         %s (0x%02X)\n", chipName, partNum)
+				fmt.Printf("  Chip:         %s (0x%02X)\n", yardstick.ChipName(partNum), partNum)
 			} else {
 				fmt.Printf("  Chip:         (error: %v)\n", err)
 			}
 			fmt.Println()
 		} else {
-			fmt.Printf("  #%d  %s  %d:%d\n", i, device.Serial, device.Bus, device.Address)
+			fmt.Printf("  #%d  %s  %d:%d  %s\n", i, device.Serial, device.Bus, device.Address, device.Capabilities().Model)
 		}
 	}
 
@@ -1,16 +1,21 @@
 // plot-spectrum generates spectrogram images from rf-scanner CSV output
+//
+// The input is waterfall CSV (see pkg/specan.ReadWaterfall), as written by
+// 'rf-scanner -csv' or 'gocat spectrogram export <file> out.csv'
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"math"
 	"os"
-	"strconv"
-	"strings"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/specan"
 )
 
 var (
@@ -20,8 +25,24 @@ var (
 	vmax       = flag.Float64("vmax", -30, "Maximum RSSI for color scale (dBm)")
 	height     = flag.Int("height", 0, "Output image height (0 = auto, one pixel per frame)")
 	colormap   = flag.String("cmap", "viridis", "Colormap: viridis, plasma, inferno, magma, turbo, grayscale")
+	format     output.Format
 )
 
+// plotResult is the -output json result
+type plotResult struct {
+	Input    string  `json:"input"`
+	Output   string  `json:"output"`
+	Frames   int     `json:"frames"`
+	Bins     int     `json:"bins"`
+	StartMHz float64 `json:"start_mhz"`
+	StopMHz  float64 `json:"stop_mhz"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	VMinDBm  float64 `json:"vmin_dbm"`
+	VMaxDBm  float64 `json:"vmax_dbm"`
+	Colormap string  `json:"colormap"`
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s -i spectrum.csv [options]\n\n", os.Args[0])
@@ -33,21 +54,24 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -i spectrum.csv -o out.png -vmin -70 -vmax -40\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i spectrum.csv -cmap turbo        # Use turbo colormap\n", os.Args[0])
 	}
+	flag.Var(&format, "output", output.FlagUsage)
 	flag.Parse()
 
 	if *inputFile == "" {
 		fmt.Fprintln(os.Stderr, "Error: -i input file required")
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 }
 
 func run() error {
+	out := format.Progress()
+
 	// Read CSV file
 	file, err := os.Open(*inputFile)
 	if err != nil {
@@ -55,59 +79,27 @@ func run() error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-
-	// Read header
-	if !scanner.Scan() {
-		return fmt.Errorf("empty CSV file")
-	}
-	header := scanner.Text()
-	cols := strings.Split(header, ",")
-	if len(cols) < 2 {
-		return fmt.Errorf("invalid header: need at least timestamp and one frequency column")
-	}
-
-	freqs := make([]float64, len(cols)-1)
-	for i, col := range cols[1:] {
-		f, err := strconv.ParseFloat(col, 64)
-		if err != nil {
-			return fmt.Errorf("invalid frequency in header column %d: %w", i+1, err)
-		}
-		freqs[i] = f
+	wf, err := specan.ReadWaterfall(file)
+	if err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%s: %v", *inputFile, err)
 	}
-
-	// Read data rows
-	var rows [][]float64
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ",")
-		if len(parts) < 2 {
-			continue
-		}
-
-		// Skip timestamp, parse RSSI values
-		rssi := make([]float64, len(parts)-1)
-		for i, p := range parts[1:] {
-			v, err := strconv.ParseFloat(p, 64)
-			if err != nil {
-				rssi[i] = *vmin // Default to minimum if parse fails
-			} else {
-				rssi[i] = v
+	freqs := wf.FreqsMHz
+	rows := make([][]float64, len(wf.Rows))
+	for i, r := range wf.Rows {
+		rows[i] = r.RSSI
+		for j, v := range r.RSSI {
+			if math.IsNaN(v) {
+				rows[i][j] = *vmin // Default to minimum if parse fails
 			}
 		}
-		rows = append(rows, rssi)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading CSV: %w", err)
 	}
 
 	if len(rows) == 0 {
 		return fmt.Errorf("no data rows in CSV")
 	}
 
-	fmt.Printf("Loaded %d frames, %d frequency bins\n", len(rows), len(freqs))
-	fmt.Printf("Frequency range: %.3f - %.3f MHz\n", freqs[0], freqs[len(freqs)-1])
+	fmt.Fprintf(out, "Loaded %d frames, %d frequency bins\n", len(rows), len(freqs))
+	fmt.Fprintf(out, "Frequency range: %.3f - %.3f MHz\n", freqs[0], freqs[len(freqs)-1])
 
 	// Determine image dimensions
 	imgWidth := len(freqs)
@@ -156,9 +148,24 @@ func run() error {
 		return fmt.Errorf("failed to encode PNG: %w", err)
 	}
 
-	fmt.Printf("Wrote %dx%d spectrogram to %s\n", imgWidth, imgHeight, *outputFile)
-	fmt.Printf("Color scale: %.1f to %.1f dBm\n", *vmin, *vmax)
-
+	fmt.Fprintf(out, "Wrote %dx%d spectrogram to %s\n", imgWidth, imgHeight, *outputFile)
+	fmt.Fprintf(out, "Color scale: %.1f to %.1f dBm\n", *vmin, *vmax)
+
+	if format.IsJSON() {
+		output.Write(&plotResult{
+			Input:    *inputFile,
+			Output:   *outputFile,
+			Frames:   len(rows),
+			Bins:     len(freqs),
+			StartMHz: freqs[0],
+			StopMHz:  freqs[len(freqs)-1],
+			Width:    imgWidth,
+			Height:   imgHeight,
+			VMinDBm:  *vmin,
+			VMaxDBm:  *vmax,
+			Colormap: *colormap,
+		})
+	}
 	return nil
 }
 
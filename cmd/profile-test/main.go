@@ -7,12 +7,15 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/google/gousb"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
 	"github.com/herlein/gocat/pkg/profiles"
 	"github.com/herlein/gocat/pkg/registers"
 	"github.com/herlein/gocat/pkg/yardstick"
@@ -21,7 +24,7 @@ import (
 var (
 	profileName  = flag.String("profile", "", "Profile name to test (e.g., 315-ook-low-1k2)")
 	generateAll  = flag.Bool("generate", false, "Generate all profile configs for specified band")
-	generateBand = flag.String("band", "315", "Band to generate: 315, 433, 868, 915, or all")
+	generateBand = flag.String("band", "315", "Band to generate: 315, 433, 868, 915, 2400, or all")
 	listDevices  = flag.Bool("list", false, "List available YS1 devices")
 	txDevice     = flag.String("tx", "", "TX device selector (index, bus:addr, or serial)")
 	rxDevice     = flag.String("rx", "", "RX device selector (index, bus:addr, or serial)")
@@ -30,10 +33,47 @@ var (
 	timeout      = flag.Duration("timeout", 5*time.Second, "Receive timeout")
 	repeat       = flag.Int("repeat", 3, "Number of times to repeat each test")
 	validateOnly = flag.Bool("validate", false, "Only validate config (single device, no RF test)")
+	strictLoad   = flag.Bool("strict", false, "Reject config files with unknown fields or a newer schema version")
+	maskCheck    = flag.Bool("mask", false, "Spectral mask check: TX on the profile while RX sweeps adjacent channels")
+	maskSpacing  = flag.Float64("mask-spacing", 0, "Adjacent channel spacing in Hz (0 = profile channel bandwidth)")
+	maskChannels = flag.Int("mask-channels", 2, "Adjacent channels to measure on each side")
+	maskLimit    = flag.Float64("mask-limit", -20, "Maximum adjacent channel power relative to the carrier (dBc)")
+	maskDuration = flag.Duration("mask-duration", 3*time.Second, "Peak-hold sweep duration")
+
+	format output.Format
+	out    io.Writer  = os.Stdout // Progress and text results
+	report testReport             // Filled in as the test runs, written in -output json mode
 )
 
+// testReport is the -output json result of a validation or loopback test
+type testReport struct {
+	Profile    string            `json:"profile"`
+	Mode       string            `json:"mode"` // "validate", "loopback" or "mask"
+	TXDevice   string            `json:"tx_device,omitempty"`
+	RXDevice   string            `json:"rx_device,omitempty"`
+	PayloadLen int               `json:"payload_len,omitempty"`
+	AirtimeUS  int64             `json:"airtime_us,omitempty"`
+	Iterations []iterationResult `json:"iterations,omitempty"`
+	Mask       *maskReport       `json:"mask,omitempty"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// iterationResult is one loopback iteration
+type iterationResult struct {
+	Iteration int    `json:"iteration"`
+	Passed    bool   `json:"passed"`
+	Received  string `json:"received,omitempty"` // Hex
+	RSSIdBm   *int   `json:"rssi_dbm,omitempty"`
+	LQI       *uint8 `json:"lqi,omitempty"`
+	CRCOk     *bool  `json:"crc_ok,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
 func main() {
+	flag.Var(&format, "output", output.FlagUsage+" (applies to test results)")
 	flag.Parse()
+	out = format.Progress()
 
 	if *listDevices {
 		doListDevices()
@@ -43,7 +83,7 @@ func main() {
 	if *generateAll {
 		if err := doGenerateProfiles(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error generating profiles: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitcode.Of(err))
 		}
 		return
 	}
@@ -51,22 +91,37 @@ func main() {
 	if *profileName == "" {
 		fmt.Fprintln(os.Stderr, "Usage: profile-test -profile <name> [-tx <device>] [-rx <device>]")
 		fmt.Fprintln(os.Stderr, "       profile-test -profile <name> -validate  (config validation only)")
+		fmt.Fprintln(os.Stderr, "       profile-test -profile <name> -mask      (adjacent channel power check)")
 		fmt.Fprintln(os.Stderr, "       profile-test -generate  (generate all 315 MHz configs)")
 		fmt.Fprintln(os.Stderr, "       profile-test -list      (list available devices)")
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
 	var err error
+	report.Profile = *profileName
 	if *validateOnly {
+		report.Mode = "validate"
 		err = doConfigValidation()
+	} else if *maskCheck {
+		report.Mode = "mask"
+		err = doProfileTest()
 	} else {
+		report.Mode = "loopback"
 		err = doProfileTest()
 	}
 
+	report.Passed = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if format.IsJSON() {
+		output.Write(&report)
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Test FAILED: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 }
 
@@ -77,17 +132,17 @@ func doListDevices() {
 	devices, err := yardstick.FindAllDevices(ctx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error finding devices: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if len(devices) == 0 {
-		fmt.Println("No YardStick One devices found")
+		fmt.Fprintln(out, "No YardStick One devices found")
 		return
 	}
 
-	fmt.Printf("Found %d YardStick One device(s):\n\n", len(devices))
+	fmt.Fprintf(out, "Found %d YardStick One device(s):\n\n", len(devices))
 	for i, dev := range devices {
-		fmt.Printf("  #%d  %s  %d:%d\n", i, dev.Serial, dev.Bus, dev.Address)
+		fmt.Fprintf(out, "  #%d  %s  %d:%d\n", i, dev.Serial, dev.Bus, dev.Address)
 		dev.Close()
 	}
 }
@@ -95,17 +150,17 @@ func doListDevices() {
 func doConfigValidation() error {
 	// Load profile config
 	configPath := filepath.Join(*configDir, *profileName+".json")
-	fmt.Printf("Loading profile: %s\n", configPath)
+	fmt.Fprintf(out, "Loading profile: %s\n", configPath)
 
-	profileCfg, err := profiles.LoadProfileFromFile(configPath)
+	profileCfg, err := loadProfileConfig(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to load profile: %w", err)
+		return err
 	}
 
-	fmt.Printf("Profile: %s\n", profileCfg.Profile.Name)
-	fmt.Printf("  Frequency: %.3f MHz\n", profileCfg.Profile.FrequencyHz/1e6)
-	fmt.Printf("  Data Rate: %.0f baud\n", profileCfg.Profile.DataRateBaud)
-	fmt.Printf("  Modulation: 0x%02X\n", profileCfg.Profile.Modulation)
+	fmt.Fprintf(out, "Profile: %s\n", profileCfg.Profile.Name)
+	fmt.Fprintf(out, "  Frequency: %.3f MHz\n", profileCfg.Profile.FrequencyHz/1e6)
+	fmt.Fprintf(out, "  Data Rate: %.0f baud\n", profileCfg.Profile.DataRateBaud)
+	fmt.Fprintf(out, "  Modulation: 0x%02X\n", profileCfg.Profile.Modulation)
 
 	// Open USB context
 	ctx := gousb.NewContext()
@@ -118,14 +173,14 @@ func doConfigValidation() error {
 			return desc.Vendor == gousb.ID(0x1d50) && desc.Product == gousb.ID(0x605b)
 		})
 		if err != nil {
-			fmt.Printf("Attempt %d: enumeration error: %v\n", attempt+1, err)
+			fmt.Fprintf(out, "Attempt %d: enumeration error: %v\n", attempt+1, err)
 			time.Sleep(time.Second)
 		}
 		if len(devs) > 0 {
 			// Wrap the first device
 			usbDev := devs[0]
 			serial, _ := usbDev.SerialNumber()
-			fmt.Printf("Found device: %s\n", serial)
+			fmt.Fprintf(out, "Found device: %s\n", serial)
 
 			// Use the existing device opening function
 			for _, d := range devs[1:] {
@@ -138,33 +193,34 @@ func doConfigValidation() error {
 			if err == nil {
 				break
 			}
-			fmt.Printf("Failed to open device: %v\n", err)
+			fmt.Fprintf(out, "Failed to open device: %v\n", err)
 		}
 	}
 
 	if dev == nil {
-		return fmt.Errorf("could not find any YS1 device")
+		return exitcode.Errorf(exitcode.DeviceNotFound, "could not find any YS1 device")
 	}
 	defer dev.Close()
 
-	fmt.Printf("Using device: %s (%d:%d)\n", dev.Serial, dev.Bus, dev.Address)
+	fmt.Fprintf(out, "Using device: %s (%d:%d)\n", dev.Serial, dev.Bus, dev.Address)
+	report.RXDevice = dev.Serial
 
 	// Test connectivity
-	fmt.Println("Testing connectivity...")
+	fmt.Fprintln(out, "Testing connectivity...")
 	if err := dev.Ping([]byte("TEST")); err != nil {
 		return fmt.Errorf("device ping failed: %w", err)
 	}
-	fmt.Println("Ping OK")
+	fmt.Fprintln(out, "Ping OK")
 
 	// Force IDLE state
-	fmt.Println("Setting device to IDLE state...")
+	fmt.Fprintln(out, "Setting device to IDLE state...")
 	if err := dev.PokeByte(0xDFE1, 0x04); err != nil {
-		fmt.Printf("Warning: IDLE strobe failed: %v\n", err)
+		fmt.Fprintf(out, "Warning: IDLE strobe failed: %v\n", err)
 	}
 	time.Sleep(50 * time.Millisecond)
 
 	// Apply configuration
-	fmt.Println("Applying configuration...")
+	fmt.Fprintln(out, "Applying configuration...")
 	devCfg := &config.DeviceConfig{
 		Serial:    dev.Serial,
 		Timestamp: time.Now(),
@@ -176,22 +232,22 @@ func doConfigValidation() error {
 	}
 
 	// Enable amplifiers
-	fmt.Println("Enabling amplifiers...")
-	if err := dev.SetAmpMode(1); err != nil {
-		fmt.Printf("Warning: amplifier enable failed: %v\n", err)
+	fmt.Fprintln(out, "Enabling amplifiers...")
+	if err := dev.EnableAmplifier(); err != nil {
+		fmt.Fprintf(out, "Warning: amplifier enable failed: %v\n", err)
 	}
 
 	// Verify configuration
-	fmt.Println("Verifying configuration...")
+	fmt.Fprintln(out, "Verifying configuration...")
 	if err := verifyConfig(dev, &profileCfg.Registers); err != nil {
-		return fmt.Errorf("config verification failed: %w", err)
+		return exitcode.Errorf(exitcode.VerifyFailed, "config verification failed: %w", err)
 	}
 
 	// Test mode transitions
-	fmt.Println("Testing mode transitions...")
+	fmt.Fprintln(out, "Testing mode transitions...")
 
 	// Test IDLE -> RX
-	fmt.Println("  Testing RX mode...")
+	fmt.Fprintln(out, "  Testing RX mode...")
 	if err := dev.SetModeRX(); err != nil {
 		return fmt.Errorf("failed to enter RX mode: %w", err)
 	}
@@ -202,10 +258,10 @@ func doConfigValidation() error {
 	if state != 0x0D {
 		return fmt.Errorf("not in RX mode: MARCSTATE=0x%02X", state)
 	}
-	fmt.Printf("    MARCSTATE=0x%02X (RX) OK\n", state)
+	fmt.Fprintf(out, "    MARCSTATE=0x%02X (RX) OK\n", state)
 
 	// Test RX -> IDLE
-	fmt.Println("  Testing IDLE mode...")
+	fmt.Fprintln(out, "  Testing IDLE mode...")
 	if err := dev.SetModeIDLE(); err != nil {
 		return fmt.Errorf("failed to enter IDLE mode: %w", err)
 	}
@@ -217,10 +273,10 @@ func doConfigValidation() error {
 	if state != 0x01 {
 		return fmt.Errorf("not in IDLE mode: MARCSTATE=0x%02X", state)
 	}
-	fmt.Printf("    MARCSTATE=0x%02X (IDLE) OK\n", state)
+	fmt.Fprintf(out, "    MARCSTATE=0x%02X (IDLE) OK\n", state)
 
-	fmt.Println("\n=== Config Validation PASSED ===")
-	fmt.Printf("Profile: %s\n", profileCfg.Profile.Name)
+	fmt.Fprintln(out, "\n=== Config Validation PASSED ===")
+	fmt.Fprintf(out, "Profile: %s\n", profileCfg.Profile.Name)
 	return nil
 }
 
@@ -235,49 +291,55 @@ func doGenerateProfiles() error {
 
 	switch band {
 	case "315":
-		fmt.Printf("Generating 315 MHz profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating 315 MHz profiles to %s\n", absPath)
 		if err := profiles.Generate315Profiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 9
 	case "433":
-		fmt.Printf("Generating 433 MHz profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating 433 MHz profiles to %s\n", absPath)
 		if err := profiles.Generate433Profiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 21
 	case "868":
-		fmt.Printf("Generating 868 MHz profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating 868 MHz profiles to %s\n", absPath)
 		if err := profiles.Generate868Profiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 15
 	case "915":
-		fmt.Printf("Generating 915 MHz profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating 915 MHz profiles to %s\n", absPath)
 		if err := profiles.Generate915Profiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 18
+	case "2400":
+		fmt.Fprintf(out, "Generating 2.4 GHz (CC2511) profiles to %s\n", absPath)
+		if err := profiles.Generate2400Profiles(absPath); err != nil {
+			return err
+		}
+		totalCount += 4
 	case "special":
-		fmt.Printf("Generating special profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating special profiles to %s\n", absPath)
 		if err := profiles.GenerateSpecialProfiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 26
 	case "encoding":
-		fmt.Printf("Generating encoding profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating encoding profiles to %s\n", absPath)
 		if err := profiles.GenerateEncodingProfiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 14
 	case "packet":
-		fmt.Printf("Generating packet profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating packet profiles to %s\n", absPath)
 		if err := profiles.GeneratePacketProfiles(absPath); err != nil {
 			return err
 		}
 		totalCount += 15
 	case "all":
-		fmt.Printf("Generating all profiles to %s\n", absPath)
+		fmt.Fprintf(out, "Generating all profiles to %s\n", absPath)
 		if err := profiles.Generate315Profiles(absPath); err != nil {
 			return fmt.Errorf("315 MHz: %w", err)
 		}
@@ -307,7 +369,7 @@ func doGenerateProfiles() error {
 		}
 		totalCount += 15
 	default:
-		return fmt.Errorf("unknown band: %s (use 315, 433, 868, 915, special, encoding, packet, or all)", band)
+		return fmt.Errorf("unknown band: %s (use 315, 433, 868, 915, 2400, special, encoding, packet, or all)", band)
 	}
 
 	// List generated files
@@ -321,9 +383,9 @@ func doGenerateProfiles() error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Generated %d profile configs:\n", len(files))
+	fmt.Fprintf(out, "Generated %d profile configs:\n", len(files))
 	for _, f := range files {
-		fmt.Printf("  %s\n", filepath.Base(f))
+		fmt.Fprintf(out, "  %s\n", filepath.Base(f))
 	}
 
 	return nil
@@ -332,18 +394,18 @@ func doGenerateProfiles() error {
 func doProfileTest() error {
 	// Load profile config
 	configPath := filepath.Join(*configDir, *profileName+".json")
-	fmt.Printf("Loading profile: %s\n", configPath)
+	fmt.Fprintf(out, "Loading profile: %s\n", configPath)
 
-	profileCfg, err := profiles.LoadProfileFromFile(configPath)
+	profileCfg, err := loadProfileConfig(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to load profile: %w", err)
+		return err
 	}
 
 	if *verbose {
-		fmt.Printf("Profile: %s\n", profileCfg.Profile.Name)
-		fmt.Printf("  Frequency: %.3f MHz\n", profileCfg.Profile.FrequencyHz/1e6)
-		fmt.Printf("  Data Rate: %.0f baud\n", profileCfg.Profile.DataRateBaud)
-		fmt.Printf("  Modulation: 0x%02X\n", profileCfg.Profile.Modulation)
+		fmt.Fprintf(out, "Profile: %s\n", profileCfg.Profile.Name)
+		fmt.Fprintf(out, "  Frequency: %.3f MHz\n", profileCfg.Profile.FrequencyHz/1e6)
+		fmt.Fprintf(out, "  Data Rate: %.0f baud\n", profileCfg.Profile.DataRateBaud)
+		fmt.Fprintf(out, "  Modulation: 0x%02X\n", profileCfg.Profile.Modulation)
 	}
 
 	// Open USB context
@@ -359,7 +421,7 @@ func doProfileTest() error {
 		for _, d := range devices {
 			d.Close()
 		}
-		return fmt.Errorf("need at least 2 YS1 devices, found %d", len(devices))
+		return exitcode.Errorf(exitcode.DeviceNotFound, "need at least 2 YS1 devices, found %d", len(devices))
 	}
 
 	// Select TX and RX devices
@@ -387,11 +449,12 @@ func doProfileTest() error {
 	defer txDev.Close()
 	defer rxDev.Close()
 
-	fmt.Printf("TX Device: %s (%d:%d)\n", txDev.Serial, txDev.Bus, txDev.Address)
-	fmt.Printf("RX Device: %s (%d:%d)\n", rxDev.Serial, rxDev.Bus, rxDev.Address)
+	fmt.Fprintf(out, "TX Device: %s (%d:%d)\n", txDev.Serial, txDev.Bus, txDev.Address)
+	fmt.Fprintf(out, "RX Device: %s (%d:%d)\n", rxDev.Serial, rxDev.Bus, rxDev.Address)
+	report.TXDevice, report.RXDevice = txDev.Serial, rxDev.Serial
 
 	// Test connectivity
-	fmt.Println("Testing device connectivity...")
+	fmt.Fprintln(out, "Testing device connectivity...")
 	if err := txDev.Ping([]byte("TX")); err != nil {
 		return fmt.Errorf("TX device ping failed: %w", err)
 	}
@@ -400,17 +463,17 @@ func doProfileTest() error {
 	}
 
 	// Force IDLE state on both devices first
-	fmt.Println("Setting devices to IDLE state...")
+	fmt.Fprintln(out, "Setting devices to IDLE state...")
 	if err := txDev.PokeByte(0xDFE1, 0x04); err != nil {
-		fmt.Printf("Warning: TX IDLE strobe failed: %v\n", err)
+		fmt.Fprintf(out, "Warning: TX IDLE strobe failed: %v\n", err)
 	}
 	if err := rxDev.PokeByte(0xDFE1, 0x04); err != nil {
-		fmt.Printf("Warning: RX IDLE strobe failed: %v\n", err)
+		fmt.Fprintf(out, "Warning: RX IDLE strobe failed: %v\n", err)
 	}
 	time.Sleep(50 * time.Millisecond)
 
 	// Apply configuration to both devices
-	fmt.Println("Applying configuration to devices...")
+	fmt.Fprintln(out, "Applying configuration to devices...")
 
 	devCfg := &config.DeviceConfig{
 		Serial:    txDev.Serial,
@@ -428,35 +491,40 @@ func doProfileTest() error {
 	}
 
 	// Enable amplifiers for better TX power and RX sensitivity
-	fmt.Println("Enabling amplifiers...")
-	if err := txDev.SetAmpMode(1); err != nil {
-		fmt.Printf("Warning: TX amplifier enable failed: %v\n", err)
+	fmt.Fprintln(out, "Enabling amplifiers...")
+	if err := txDev.EnableAmplifier(); err != nil {
+		fmt.Fprintf(out, "Warning: TX amplifier enable failed: %v\n", err)
 	}
-	if err := rxDev.SetAmpMode(1); err != nil {
-		fmt.Printf("Warning: RX amplifier enable failed: %v\n", err)
+	if err := rxDev.EnableAmplifier(); err != nil {
+		fmt.Fprintf(out, "Warning: RX amplifier enable failed: %v\n", err)
 	}
 
 	// Verify configuration was applied
 	if *verbose {
-		fmt.Println("Verifying TX device configuration...")
+		fmt.Fprintln(out, "Verifying TX device configuration...")
 		if err := verifyConfig(txDev, &profileCfg.Registers); err != nil {
-			return fmt.Errorf("TX config verification failed: %w", err)
+			return exitcode.Errorf(exitcode.VerifyFailed, "TX config verification failed: %w", err)
 		}
-		fmt.Println("Verifying RX device configuration...")
+		fmt.Fprintln(out, "Verifying RX device configuration...")
 		if err := verifyConfig(rxDev, &profileCfg.Registers); err != nil {
-			return fmt.Errorf("RX config verification failed: %w", err)
+			return exitcode.Errorf(exitcode.VerifyFailed, "RX config verification failed: %w", err)
 		}
 	}
 
 	// Warm up devices with a dummy TX/RX cycle
 	// This ensures both devices are fully initialized before the real tests
-	fmt.Println("\nWarming up devices...")
+	fmt.Fprintln(out, "\nWarming up devices...")
 	if err := warmupDevices(txDev, rxDev); err != nil {
-		fmt.Printf("Warning: warmup failed: %v (continuing anyway)\n", err)
+		fmt.Fprintf(out, "Warning: warmup failed: %v (continuing anyway)\n", err)
+	}
+
+	if *maskCheck {
+		fmt.Fprintln(out, "\nRunning spectral mask check...")
+		return runMaskTest(txDev, rxDev, profileCfg)
 	}
 
 	// Run loopback test
-	fmt.Println("\nRunning loopback test...")
+	fmt.Fprintln(out, "\nRunning loopback test...")
 	return runLoopbackTest(txDev, rxDev, &profileCfg.Profile)
 }
 
@@ -486,7 +554,7 @@ func warmupDevices(txDev, rxDev *yardstick.Device) error {
 	txDev.SetModeIDLE()
 	time.Sleep(100 * time.Millisecond)
 
-	fmt.Println("Warmup complete")
+	fmt.Fprintln(out, "Warmup complete")
 	return nil
 }
 
@@ -565,37 +633,16 @@ func selectDevices(devices []*yardstick.Device, txSel, rxSel string) (*yardstick
 }
 
 func verifyConfig(dev *yardstick.Device, expected *registers.RegisterMap) error {
-	actual, err := registers.ReadAllRegisters(dev)
+	check, err := registers.VerifyRegisters(dev, expected)
 	if err != nil {
 		return fmt.Errorf("failed to read registers: %w", err)
 	}
-
-	// Compare key registers
-	checks := []struct {
-		name     string
-		expected uint8
-		actual   uint8
-	}{
-		{"FREQ2", expected.FREQ2, actual.FREQ2},
-		{"FREQ1", expected.FREQ1, actual.FREQ1},
-		{"FREQ0", expected.FREQ0, actual.FREQ0},
-		{"MDMCFG4", expected.MDMCFG4, actual.MDMCFG4},
-		{"MDMCFG3", expected.MDMCFG3, actual.MDMCFG3},
-		{"MDMCFG2", expected.MDMCFG2, actual.MDMCFG2},
-		{"MDMCFG1", expected.MDMCFG1, actual.MDMCFG1},
-		{"PKTCTRL0", expected.PKTCTRL0, actual.PKTCTRL0},
-		{"PKTLEN", expected.PKTLEN, actual.PKTLEN},
+	if bad := check.Mismatches(); len(bad) > 0 {
+		return fmt.Errorf("%s", bad[0])
 	}
-
-	for _, c := range checks {
-		if c.expected != c.actual {
-			return fmt.Errorf("%s mismatch: expected 0x%02X, got 0x%02X", c.name, c.expected, c.actual)
-		}
-		if *verbose {
-			fmt.Printf("  %s: 0x%02X OK\n", c.name, c.actual)
-		}
+	if *verbose {
+		fmt.Fprintln(out, "  Registers OK")
 	}
-
 	return nil
 }
 
@@ -636,17 +683,30 @@ func runLoopbackTest(txDev, rxDev *yardstick.Device, profile *profiles.Profile)
 		}
 	}
 
-	fmt.Printf("Test payload (%d bytes): %s\n", len(testPayload), hex.EncodeToString(testPayload[:min(16, len(testPayload))]))
+	fmt.Fprintf(out, "Test payload (%d bytes): %s\n", len(testPayload), hex.EncodeToString(testPayload[:min(16, len(testPayload))]))
+
+	// Never wait less than the packet actually takes on air
+	airtime := profiles.Airtime(profile, len(testPayload))
+	rxTimeout := *timeout
+	if floor := 2*airtime + 100*time.Millisecond; rxTimeout < floor {
+		rxTimeout = floor
+	}
+	fmt.Fprintf(out, "Estimated airtime: %v\n", airtime.Round(time.Microsecond))
+	report.PayloadLen = len(testPayload)
+	report.AirtimeUS = airtime.Microseconds()
 
 	// Run multiple test iterations
 	successCount := 0
 	for i := 0; i < *repeat; i++ {
-		fmt.Printf("\nTest iteration %d/%d\n", i+1, *repeat)
+		fmt.Fprintf(out, "\nTest iteration %d/%d\n", i+1, *repeat)
+		report.Iterations = append(report.Iterations, iterationResult{Iteration: i + 1})
+		result := &report.Iterations[len(report.Iterations)-1]
 
 		// Put RX device in receive mode fresh for each iteration
-		fmt.Println("  Setting RX device to receive mode...")
+		fmt.Fprintln(out, "  Setting RX device to receive mode...")
 		if err := rxDev.SetModeRX(); err != nil {
-			fmt.Printf("  RX Mode Error: %v\n", err)
+			fmt.Fprintf(out, "  RX Mode Error: %v\n", err)
+			result.Error = fmt.Sprintf("RX mode: %v", err)
 			continue
 		}
 
@@ -654,17 +714,19 @@ func runLoopbackTest(txDev, rxDev *yardstick.Device, profile *profiles.Profile)
 		time.Sleep(200 * time.Millisecond)
 
 		// Transmit
-		fmt.Printf("  Transmitting %d bytes...\n", len(testPayload))
+		fmt.Fprintf(out, "  Transmitting %d bytes...\n", len(testPayload))
 		if err := txDev.RFXmit(testPayload, 0, 0); err != nil {
-			fmt.Printf("  TX Error: %v\n", err)
+			fmt.Fprintf(out, "  TX Error: %v\n", err)
+			result.Error = fmt.Sprintf("TX: %v", err)
 			continue
 		}
 
 		// Receive
-		fmt.Printf("  Waiting for RX (timeout: %v)...\n", *timeout)
-		rxData, err := rxDev.RFRecv(*timeout, 0)
+		fmt.Fprintf(out, "  Waiting for RX (timeout: %v)...\n", rxTimeout)
+		rxData, err := rxDev.RFRecv(rxTimeout, 0)
 		if err != nil {
-			fmt.Printf("  RX Error: %v\n", err)
+			fmt.Fprintf(out, "  RX Error: %v\n", err)
+			result.Error = fmt.Sprintf("RX: %v", err)
 			// Return to IDLE before next iteration
 			rxDev.SetModeIDLE()
 			time.Sleep(50 * time.Millisecond)
@@ -672,20 +734,23 @@ func runLoopbackTest(txDev, rxDev *yardstick.Device, profile *profiles.Profile)
 		}
 
 		// Check received data
-		fmt.Printf("  Received %d bytes: %s\n", len(rxData), hex.EncodeToString(rxData[:min(16, len(rxData))]))
+		fmt.Fprintf(out, "  Received %d bytes: %s\n", len(rxData), hex.EncodeToString(rxData[:min(16, len(rxData))]))
+		result.Received = hex.EncodeToString(rxData)
 
 		// Get RSSI/LQI
 		status, err := rxDev.GetRadioStatus()
 		if err == nil {
-			fmt.Printf("  RSSI: %d dBm, LQI: %d, CRC OK: %v\n", status.RSSIdBm, status.LQI, status.CRCOk)
+			fmt.Fprintf(out, "  RSSI: %d dBm, LQI: %d, CRC OK: %v\n", status.RSSIdBm, status.LQI, status.CRCOk)
+			result.RSSIdBm, result.LQI, result.CRCOk = &status.RSSIdBm, &status.LQI, &status.CRCOk
 		}
 
 		// Compare payloads
 		if comparePayloads(testPayload, rxData, profile) {
-			fmt.Println("  PASS: Payload matched!")
+			fmt.Fprintln(out, "  PASS: Payload matched!")
+			result.Passed = true
 			successCount++
 		} else {
-			fmt.Println("  FAIL: Payload mismatch")
+			fmt.Fprintln(out, "  FAIL: Payload mismatch")
 		}
 
 		// Return to IDLE before next iteration
@@ -694,18 +759,18 @@ func runLoopbackTest(txDev, rxDev *yardstick.Device, profile *profiles.Profile)
 	}
 
 	// Summary
-	fmt.Printf("\n=== Test Summary ===\n")
-	fmt.Printf("Profile: %s\n", profile.Name)
-	fmt.Printf("Passed: %d/%d iterations\n", successCount, *repeat)
+	fmt.Fprintf(out, "\n=== Test Summary ===\n")
+	fmt.Fprintf(out, "Profile: %s\n", profile.Name)
+	fmt.Fprintf(out, "Passed: %d/%d iterations\n", successCount, *repeat)
 
 	if successCount == 0 {
-		return fmt.Errorf("all test iterations failed")
+		return exitcode.Errorf(exitcode.RFTestFailed, "all test iterations failed")
 	}
 	if successCount < *repeat {
-		return fmt.Errorf("%d/%d iterations failed", *repeat-successCount, *repeat)
+		return exitcode.Errorf(exitcode.Partial, "%d/%d iterations failed", *repeat-successCount, *repeat)
 	}
 
-	fmt.Println("All tests PASSED!")
+	fmt.Fprintln(out, "All tests PASSED!")
 	return nil
 }
 
@@ -736,3 +801,20 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+// loadProfileConfig loads a profile config file, printing anything that
+// had to be migrated or ignored
+func loadProfileConfig(path string) (*profiles.ProfileConfig, error) {
+	mode := profiles.LoadLenient
+	if *strictLoad {
+		mode = profiles.LoadStrict
+	}
+	profileCfg, err := profiles.LoadProfileFile(path, mode)
+	if err != nil {
+		return nil, exitcode.Errorf(exitcode.ConfigInvalid, "failed to load profile: %w", err)
+	}
+	for _, w := range profileCfg.Warnings {
+		fmt.Fprintf(out, "Warning: %s: %s\n", path, w)
+	}
+	return profileCfg, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// maskReport is the -output json result of a spectral mask check
+type maskReport struct {
+	CarrierDBm float32       `json:"carrier_dbm"`
+	SpacingHz  float64       `json:"spacing_hz"`
+	LimitDBc   float64       `json:"limit_dbc"`
+	Channels   []maskChannel `json:"channels"`
+}
+
+// maskChannel is the peak power measured in one adjacent channel
+type maskChannel struct {
+	OffsetHz float64 `json:"offset_hz"`
+	RSSIdBm  float32 `json:"rssi_dbm"`
+	DBc      float32 `json:"dbc"`
+	Passed   bool    `json:"passed"`
+}
+
+// maskNoiseMargin is how far the carrier must be above the quietest
+// channel for the measurement to mean anything
+const maskNoiseMargin = 10
+
+// runMaskTest transmits continuously on txDev while rxDev peak-holds a
+// firmware sweep across the carrier and its adjacent channels, then
+// compares each adjacent channel's power with the carrier
+// This is a rough check with the receiver's channel filter as the
+// resolution bandwidth, not a calibrated spectral mask measurement
+func runMaskTest(txDev, rxDev *yardstick.Device, profileCfg *profiles.ProfileConfig) error {
+	profile := &profileCfg.Profile
+	spacing := *maskSpacing
+	if spacing <= 0 {
+		spacing = profile.ChannelBWHz
+	}
+	if *maskChannels < 1 {
+		return exitcode.Errorf(exitcode.Usage, "-mask-channels must be at least 1")
+	}
+
+	center := uint32(profile.FrequencyHz)
+	span := spacing * float64(2**maskChannels+1)
+	fmt.Fprintf(out, "Carrier %.3f MHz, %d adjacent channels each side at %.1f kHz spacing\n",
+		profile.FrequencyHz/1e6, *maskChannels, spacing/1e3)
+
+	sa := specan.New(rxDev)
+	if err := sa.Configure(&specan.Config{
+		CenterFreq: center,
+		Bandwidth:  uint32(span),
+		NumChans:   255,
+		Base:       &profileCfg.Registers,
+	}); err != nil {
+		return fmt.Errorf("failed to configure sweep: %w", err)
+	}
+
+	// Keep the transmitter busy for the whole sweep
+	payloadLen := int(profile.PktLen)
+	if payloadLen < 1 || payloadLen > 64 {
+		payloadLen = 64
+	}
+	payload := make([]byte, payloadLen)
+	for i := range payload {
+		payload[i] = byte(i*37 + 11)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var txErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := txDev.RFXmit(payload, 0, 0); err != nil {
+				txErr = err
+				return
+			}
+		}
+	}()
+
+	peak, sweepErr := peakHold(sa, *maskDuration)
+	close(stop)
+	wg.Wait()
+	txDev.SetModeIDLE()
+
+	if sweepErr != nil {
+		return sweepErr
+	}
+	if txErr != nil {
+		return fmt.Errorf("transmit failed during sweep: %w", txErr)
+	}
+	if peak == nil {
+		return exitcode.Errorf(exitcode.RFTestFailed, "no sweep frames received")
+	}
+
+	half := uint32(profile.ChannelBWHz / 2)
+	carrier, ok := specan.MaxInRange(peak, center-half, center+half)
+	_, _, floor := specan.MinRSSI(peak)
+	if !ok || carrier < floor+maskNoiseMargin {
+		return exitcode.Errorf(exitcode.RFTestFailed, "carrier not detected (%.1f dBm, noise floor %.1f dBm)", carrier, floor)
+	}
+
+	rep := &maskReport{CarrierDBm: carrier, SpacingHz: spacing, LimitDBc: *maskLimit}
+	report.Mask = rep
+
+	fmt.Fprintf(out, "\nCarrier:  %6.1f dBm (noise floor %.1f dBm)\n", carrier, floor)
+	fmt.Fprintf(out, "%10s %10s %8s\n", "Offset", "Peak", "dBc")
+	failed := 0
+	for n := -*maskChannels; n <= *maskChannels; n++ {
+		if n == 0 {
+			continue
+		}
+		offset := float64(n) * spacing
+		f := uint32(profile.FrequencyHz + offset)
+		rssi, ok := specan.MaxInRange(peak, f-half, f+half)
+		if !ok {
+			continue
+		}
+		ch := maskChannel{OffsetHz: offset, RSSIdBm: rssi, DBc: rssi - carrier}
+		ch.Passed = float64(ch.DBc) <= *maskLimit
+		if !ch.Passed {
+			failed++
+		}
+		rep.Channels = append(rep.Channels, ch)
+		fmt.Fprintf(out, "%+8.1fkHz %6.1fdBm %+8.1f  %s\n", offset/1e3, rssi, ch.DBc, passFail(ch.Passed))
+	}
+
+	fmt.Fprintln(out)
+	if failed > 0 {
+		return exitcode.Errorf(exitcode.RFTestFailed, "%d of %d adjacent channels above %.1f dBc", failed, len(rep.Channels), *maskLimit)
+	}
+	fmt.Fprintf(out, "All adjacent channels at or below %.1f dBc\n", *maskLimit)
+	return nil
+}
+
+// peakHold runs the analyzer for d and returns the peak-hold frame
+func peakHold(sa *specan.SpecAn, d time.Duration) (*specan.Frame, error) {
+	if err := sa.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start sweep: %w", err)
+	}
+
+	var peak *specan.Frame
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+loop:
+	for {
+		select {
+		case frame, ok := <-sa.Frames():
+			if !ok {
+				break loop
+			}
+			peak = specan.PeakHold(peak, frame)
+		case <-timer.C:
+			break loop
+		}
+	}
+
+	if err := sa.Stop(); err != nil {
+		return peak, err
+	}
+	return peak, nil
+}
+
+func passFail(ok bool) string {
+	if ok {
+		return "PASS"
+	}
+	return "FAIL"
+}
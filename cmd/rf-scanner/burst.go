@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/scanner/orchestrator"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// burstRecord is a -burst capture in -output json mode
+type burstRecord struct {
+	Type        string    `json:"type"` // "burst"
+	Time        time.Time `json:"time"`
+	FrequencyHz uint32    `json:"frequency_hz"`
+	RSSI        float32   `json:"rssi_dbm"`
+	Profile     string    `json:"profile"`
+	Packets     int       `json:"packets"`
+	DurationMs  int64     `json:"duration_ms"`
+	Path        string    `json:"path,omitempty"` // Empty when nothing was received
+}
+
+// newCapturer sets up -burst; nil if it isn't given
+func newCapturer() (*scanner.Capturer, error) {
+	if *burstDir == "" {
+		if *burstDev != "" {
+			return nil, exitcode.Errorf(exitcode.Usage, "-burst-device needs -burst")
+		}
+		return nil, nil
+	}
+	if *captureOn {
+		return nil, exitcode.Errorf(exitcode.Usage, "-capture and -burst are mutually exclusive")
+	}
+	bands, err := scanner.ParseBandProfiles(*burstBands)
+	if err != nil {
+		return nil, exitcode.Errorf(exitcode.Usage, "%v", err)
+	}
+	c := scanner.NewCapturer(*burstDir)
+	c.Packets = *burstPkts
+	c.Duration = *burstTime
+	c.Format = *burstFmt
+	c.Bands = bands
+	c.Modulation = captureModulation(*captureMod)
+	c.SymbolRateBaud = *captureBd
+	c.Holdoff = *burstHold
+	c.Tool = "rf-scanner"
+	if err := c.Validate(); err != nil {
+		return nil, exitcode.Errorf(exitcode.Usage, "%v", err)
+	}
+	return c, nil
+}
+
+// openRecorder opens the -burst-device and sets it up to receive with
+// -burst-profile, tuned to tuneHz until the first capture
+func openRecorder(usb *gousb.Context, scan *yardstick.Device, c *scanner.Capturer, tuneHz uint32) (*orchestrator.Orchestrator, error) {
+	device, err := yardstick.SelectDevice(usb, yardstick.DeviceSelector(*burstDev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture device: %w", err)
+	}
+	if device.Serial == scan.Serial {
+		device.Close()
+		return nil, exitcode.Errorf(exitcode.Usage, "-burst-device selects the scanning device %s", scan.Serial)
+	}
+	profile, err := c.Prepare(device, *burstProf, tuneHz)
+	if err != nil {
+		device.Close()
+		return nil, err
+	}
+	return orchestrator.New(device, c, profile), nil
+}
+
+// nextDue picks the strongest peak due reports is due, as a detection;
+// nil if there is none. due is a Capturer's or Classifier's Due
+func nextDue(due func(*scanner.Detection) bool, frame *specan.Frame, peaks []specan.Peak) *scanner.Detection {
+	var best *scanner.Detection
+	for _, p := range peaks {
+		if best != nil && p.RSSI <= best.RSSI {
+			continue
+		}
+		d := &scanner.Detection{
+			Time:        frame.Timestamp,
+			FrequencyHz: p.FrequencyHz,
+			BandwidthHz: specan.PeakBandwidth(frame, p.ChannelIndex, 6),
+			RSSI:        p.RSSI,
+		}
+		if due(d) {
+			best = d
+		}
+	}
+	return best
+}
+
+// captureBurst pauses the sweep, captures d and resumes the sweep
+func captureBurst(ctx context.Context, c *scanner.Capturer, device *yardstick.Device, d *scanner.Detection, pause, resume func() error) (*scanner.Burst, error) {
+	if err := pause(); err != nil {
+		return nil, err
+	}
+	b, err := c.Capture(ctx, device, d)
+	if rerr := resume(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("burst capture at %.3f MHz failed: %w", float64(d.FrequencyHz)/1e6, err)
+	}
+	return b, nil
+}
+
+// printBurst reports a burst capture
+func printBurst(b *scanner.Burst, signals *sigdb.DB) {
+	if format.IsJSON() {
+		output.WriteLine(&burstRecord{
+			Type:        "burst",
+			Time:        b.Time,
+			FrequencyHz: b.FrequencyHz,
+			RSSI:        b.RSSI,
+			Profile:     b.Profile,
+			Packets:     b.Packets,
+			DurationMs:  b.Duration.Milliseconds(),
+			Path:        b.Path,
+		})
+		return
+	}
+	saved := "nothing received"
+	if b.Path != "" {
+		saved = "saved to " + b.Path
+	}
+	fmt.Fprintf(out, "BURST: %.3f MHz @ %.1f dBm%s with %s: %d packets in %.1fs, %s\n",
+		float64(b.FrequencyHz)/1e6, b.RSSI, likely(signals, b.FrequencyHz), b.Profile,
+		b.Packets, b.Duration.Seconds(), saved)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// calibrationRecord is a noise floor measurement in -output json mode
+type calibrationRecord struct {
+	Type     string    `json:"type"` // "calibration"
+	Time     time.Time `json:"time"`
+	Sweeps   int       `json:"sweeps"`
+	FloorMin float32   `json:"floor_min_dbm"`
+	FloorMax float32   `json:"floor_max_dbm"`
+	MarginDB float32   `json:"margin_db"`
+}
+
+// newCalibrator sets up -calibrate, from the flags or the -scanner
+// configuration sc; nil if neither asks for calibration
+func newCalibrator(sc *scanner.Config) *scanner.Calibrator {
+	var c *scanner.Calibrator
+	switch {
+	case sc != nil && (sc.Calibration.Enabled || *calSweeps > 0):
+		c = scanner.NewCalibratorFromConfig(&sc.Calibration)
+	case *calSweeps > 0:
+		c = scanner.NewCalibrator()
+	default:
+		return nil
+	}
+	if *calSweeps > 0 {
+		c.Sweeps = *calSweeps
+	}
+	if *calMargin > 0 {
+		c.MarginDB = float32(*calMargin)
+		// Recompute a stored floor's thresholds with the new margin
+		c.SetFloor(c.Floor())
+	}
+	if *calRefresh > 0 {
+		c.Refresh = *calRefresh
+	}
+	return c
+}
+
+// calibrated reports a new noise floor and stores it in the -scanner
+// configuration, if there is one, for the next scan to start from
+func calibrated(floor *specan.NoiseFloor, marginDB float32) {
+	low, high := floor.Range()
+	if format.IsJSON() {
+		output.WriteLine(&calibrationRecord{
+			Type:     "calibration",
+			Time:     floor.Measured,
+			Sweeps:   floor.Sweeps,
+			FloorMin: low,
+			FloorMax: high,
+			MarginDB: marginDB,
+		})
+	} else {
+		fmt.Fprintf(out, "CALIBRATED: noise floor %.1f to %.1f dBm over %d sweeps, detecting at +%.1f dB\n",
+			low, high, floor.Sweeps, marginDB)
+	}
+	if *scannerCfg != "" {
+		if err := scanner.SaveNoiseFloor(*scannerCfg, floor); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to store the noise floor: %v\n", err)
+		}
+	}
+}
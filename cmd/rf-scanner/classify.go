@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// classRecord is a -classify result in -output json mode
+type classRecord struct {
+	Type string    `json:"type"` // "class"
+	Time time.Time `json:"time"`
+	RSSI float32   `json:"rssi_dbm"`
+	*scanner.SignalClass
+}
+
+// newClassifier sets up -classify; nil if it isn't given
+func newClassifier() *scanner.Classifier {
+	if !*classifyOn {
+		return nil
+	}
+	c := scanner.NewClassifier()
+	if *classTime > 0 {
+		c.EnvelopeTime = *classTime
+	}
+	return c
+}
+
+// classifySignal pauses the sweep, characterizes d and resumes the sweep
+func classifySignal(ctx context.Context, c *scanner.Classifier, sa *specan.SpecAn, device *yardstick.Device, d *scanner.Detection, pause, resume func() error) (*scanner.SignalClass, error) {
+	if err := pause(); err != nil {
+		return nil, err
+	}
+	class, err := c.Classify(ctx, sa, device, d)
+	if rerr := resume(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("classifying %.3f MHz failed: %w", float64(d.FrequencyHz)/1e6, err)
+	}
+	return class, nil
+}
+
+// printClass reports a characterization pass
+func printClass(d *scanner.Detection, class *scanner.SignalClass, signals *sigdb.DB) {
+	if format.IsJSON() {
+		output.WriteLine(&classRecord{Type: "class", Time: d.Time, RSSI: d.RSSI, SignalClass: class})
+		return
+	}
+	fmt.Fprintf(out, "CLASS: %.3f MHz @ %.1f dBm%s: %s\n",
+		float64(class.FrequencyHz)/1e6, d.RSSI, likely(signals, class.FrequencyHz), class)
+}
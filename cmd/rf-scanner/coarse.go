@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/sigstore"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// coarseIncompatible are the flags that need the sweep scanner's spectrum
+// and have no meaning for -coarse
+var coarseIncompatible = []string{
+	"start", "stop", "csv", "db", "sigmf", "snapshot", "capture", "burst", "burst-device",
+	"classify", "confirm", "confirm-band", "calibrate", "hopper",
+}
+
+// checkCoarseFlags rejects flags -coarse can't honour
+func checkCoarseFlags() error {
+	var bad []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range coarseIncompatible {
+			if f.Name == name {
+				bad = append(bad, "-"+name)
+			}
+		}
+	})
+	if len(bad) > 0 {
+		return fmt.Errorf("-coarse can't be combined with %s", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// runCoarse opens the -coarse devices and runs the two-stage scan on
+// them
+func runCoarse(usb *gousb.Context, sc *scanner.Config, signals *sigdb.DB, filter *scanner.ScanConfig, tracker *signalLog, store *sigstore.Store, state *scanStats) error {
+	selectors := []string{*deviceSel}
+	if *coarseDevs != "" {
+		if *deviceSel != "" {
+			return exitcode.Errorf(exitcode.Usage, "-d and -coarse-devices are mutually exclusive")
+		}
+		selectors = strings.Split(*coarseDevs, ",")
+	}
+	fmt.Fprintln(out, "Opening YardStick One...")
+	var devices []*yardstick.Device
+	defer func() {
+		for _, d := range devices {
+			d.Close()
+		}
+	}()
+	for _, sel := range selectors {
+		d, err := yardstick.SelectDevice(usb, yardstick.DeviceSelector(strings.TrimSpace(sel)))
+		if err != nil {
+			return fmt.Errorf("failed to open device %s: %w", sel, err)
+		}
+		devices = append(devices, d)
+		fmt.Fprintf(out, "Connected to: %s\n", d)
+	}
+
+	m, err := newTwoStage(devices, sc)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Usage, "%v", err)
+	}
+	return runTwoStage(m, signals, filter, tracker, store, state)
+}
+
+// newTwoStage sets up -coarse on devices, from the -scanner configuration
+// sc if there is one
+func newTwoStage(devices []*yardstick.Device, sc *scanner.Config) (*scanner.MultiScanner, error) {
+	var m *scanner.MultiScanner
+	var err error
+	if sc != nil {
+		m, err = scanner.NewMultiScannerFromConfig(devices, sc)
+	} else {
+		m, err = scanner.NewMultiScanner(devices, scanner.DefaultFrequencies)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// An explicit -threshold wins over the configuration
+	thresholdSet := false
+	flag.Visit(func(f *flag.Flag) { thresholdSet = thresholdSet || f.Name == "threshold" })
+	for _, s := range m.Scanners {
+		s.Backend = *coarseBack
+		s.SpacingHz = uint32(*resKHz * 1e3)
+		if thresholdSet {
+			s.ThresholdDBm = float32(*threshold)
+		}
+	}
+	return m, m.Validate()
+}
+
+// runTwoStage runs the -coarse scan until -duration or Ctrl+C, reporting
+// each cycle's fine-scan result as a signal
+func runTwoStage(m *scanner.MultiScanner, signals *sigdb.DB, filter *scanner.ScanConfig, tracker *signalLog, store *sigstore.Store, state *scanStats) error {
+	s := m.Scanners[0]
+	fmt.Fprintf(out, "\nConfiguration:\n")
+	for _, sd := range m.Scanners {
+		fmt.Fprintf(out, "  Two-stage:  %d coarse frequencies, %.3f-%.3f MHz, %s backend on %s\n", len(sd.Frequencies),
+			float64(sd.Frequencies[0])/1e6, float64(sd.Frequencies[len(sd.Frequencies)-1])/1e6, sd.Backend, sd.Device().Serial)
+	}
+	fmt.Fprintf(out, "  Fine scan:  +/- %.0f kHz in %.0f kHz steps, %v dwell\n",
+		float64(s.FineRangeHz)/1e3, float64(s.FineStepHz)/1e3, s.Dwell)
+	fmt.Fprintf(out, "  Threshold:  %.1f dBm\n", s.ThresholdDBm)
+	if filter != nil {
+		printScanFilter(filter)
+	}
+	if tracker != nil && tracker.Path != "" {
+		fmt.Fprintf(out, "  Signal log: %s\n", tracker.Path)
+	}
+	if store != nil {
+		fmt.Fprintf(out, "  Known:      %d signals in %s\n", len(store.Query(nil)), store.Path())
+	}
+	if state != nil {
+		printState(state)
+	}
+	fmt.Fprintln(out)
+
+	// Every device's cycles end up in the one tracker, so a signal is
+	// lost after as many cycles of its own device as with one
+	if tracker != nil {
+		tracker.LostSweeps *= len(m.Scanners)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+		fmt.Fprintf(out, "Scanning for %v...\n", *duration)
+	} else {
+		fmt.Fprintln(out, "Scanning... (Press Ctrl+C to stop)")
+	}
+
+	cycles, found, ignored := 0, 0, 0
+	started := time.Now()
+	err := m.Run(ctx, func(r *scanner.ScanResult) error {
+		cycles++
+		if *verbose && !format.IsJSON() {
+			fmt.Fprintf(out, " %5d | %s | coarse %.3f MHz @ %.1f dBm\n", cycles, r.Device, float64(r.CoarseFrequency)/1e6, r.CoarseRSSI)
+		}
+		var peaks []specan.Peak
+		if r.SignalDetected {
+			peaks = []specan.Peak{{ChannelIndex: -1, FrequencyHz: r.FineFrequency, RSSI: r.FineRSSI}}
+		}
+		if filter != nil {
+			n := len(peaks)
+			peaks = filter.Filter(peaks)
+			ignored += n - len(peaks)
+		}
+		if tracker != nil {
+			if err := tracker.Sweep(r.Timestamp, peaks); err != nil {
+				return err
+			}
+		}
+		if state != nil {
+			state.Add(r.Timestamp, nil, peaks)
+		}
+		for _, p := range peaks {
+			found++
+			if format.IsJSON() {
+				rec := &signalRecord{
+					Type:        "signal",
+					Time:        r.Timestamp,
+					Frame:       cycles,
+					FrequencyHz: p.FrequencyHz,
+					RSSI:        p.RSSI,
+					Label:       signals.Label(p.FrequencyHz),
+				}
+				if len(m.Scanners) > 1 {
+					rec.Device = r.Device
+				}
+				if store != nil {
+					if e := store.Lookup(p.FrequencyHz); e != nil {
+						rec.Known, rec.Annotation = e.ID, e.Annotation
+					}
+				}
+				output.WriteLine(rec)
+				continue
+			}
+			fmt.Fprintf(out, "SIGNAL: %.3f MHz @ %.1f dBm (coarse %.3f MHz)%s%s\n",
+				float64(p.FrequencyHz)/1e6, p.RSSI, float64(r.CoarseFrequency)/1e6, known(store, p.FrequencyHz), likely(signals, p.FrequencyHz))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.Err() == context.Canceled {
+		fmt.Fprintln(out, "\n\nStopping...")
+	}
+
+	elapsed := time.Since(started).Seconds()
+	if format.IsJSON() {
+		output.WriteLine(&summaryRecord{Type: "summary", Frames: cycles, Signals: found, Threshold: float64(s.ThresholdDBm), Ignored: ignored})
+		return nil
+	}
+	fmt.Fprintf(out, "\n--- Summary ---\n")
+	fmt.Fprintf(out, "Cycles:  %d (%.1f/s)\n", cycles, float64(cycles)/max(elapsed, 1e-3))
+	fmt.Fprintf(out, "Signals: %d (above %.1f dBm)\n", found, s.ThresholdDBm)
+	if filter != nil {
+		fmt.Fprintf(out, "Ignored: %d\n", ignored)
+	}
+	if tracker != nil && tracker.Path != "" {
+		fmt.Fprintf(out, "Logged:  %d signals to %s\n", tracker.Logged()+len(tracker.Open()), tracker.Path)
+	}
+	if state != nil {
+		printStateSummary(state)
+	}
+	return nil
+}
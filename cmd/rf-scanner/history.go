@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/herlein/gocat/pkg/siglog"
+	"github.com/herlein/gocat/pkg/sigstore"
+)
+
+// historyWriter merges the signals the tracker ends into the -history-db
+type historyWriter struct {
+	*sigstore.Store
+}
+
+func (h historyWriter) Write(s *siglog.Signal) error {
+	_, err := h.Add(s)
+	return err
+}
+
+// openHistory opens -history-db; nil if it isn't given
+func openHistory() (*sigstore.Store, error) {
+	if *historyDB == "" {
+		return nil, nil
+	}
+	return sigstore.Open(*historyDB)
+}
+
+// known names a detection after the history entry at its frequency, if
+// the user annotated it or it has a label
+func known(history *sigstore.Store, freqHz uint32) string {
+	if history == nil {
+		return ""
+	}
+	if e := history.Lookup(freqHz); e != nil && e.Annotation != "" {
+		return " [" + e.Annotation + "]"
+	}
+	return ""
+}
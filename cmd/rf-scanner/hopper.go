@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/siglog"
+)
+
+// fhssRecord is a frequency hopper in -output json mode
+type fhssRecord struct {
+	Type string    `json:"type"` // "fhss"
+	Time time.Time `json:"time"`
+	*scanner.FHSSSignal
+}
+
+// newHopperDetector sets up -hopper, from the flags or the -scanner
+// configuration sc; nil if neither asks for it
+func newHopperDetector(sc *scanner.Config) *scanner.HopperDetector {
+	var h *scanner.HopperDetector
+	switch {
+	case sc != nil && (sc.HopperDetection.Enabled || *hopperOn):
+		h = scanner.NewHopperDetectorFromConfig(&sc.HopperDetection)
+	case *hopperOn:
+		h = scanner.NewHopperDetector()
+	default:
+		return nil
+	}
+	if *hopperWin > 0 {
+		h.Window = *hopperWin
+	}
+	if *hopperChs > 0 {
+		h.MinChannels = *hopperChs
+	}
+	return h
+}
+
+// reportHopper prints a frequency hopper and logs it as one signal at
+// the center of its channels
+func reportHopper(at time.Time, f *scanner.FHSSSignal, signals *sigdb.DB, tracker *signalLog) {
+	if format.IsJSON() {
+		output.WriteLine(&fhssRecord{Type: "fhss", Time: at, FHSSSignal: f})
+	} else {
+		fmt.Fprintf(out, "FHSS: %.3f MHz @ %.1f dBm%s: %s\n",
+			float64(f.CenterHz)/1e6, f.RSSI, likely(signals, f.CenterHz), f)
+	}
+	if tracker == nil {
+		return
+	}
+	err := tracker.Write(&siglog.Signal{
+		FrequencyHz: f.CenterHz,
+		RSSI:        f.RSSI,
+		LastRSSI:    f.RSSI,
+		FirstSeen:   f.FirstSeen,
+		LastSeen:    f.LastSeen,
+		Count:       f.Hops,
+		Label:       "FHSS: " + f.String(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to log FHSS signal: %v\n", err)
+	}
+}
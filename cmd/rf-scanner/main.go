@@ -2,17 +2,32 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/capture/sigmf"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/scanner/orchestrator"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/siglog"
+	"github.com/herlein/gocat/pkg/sigstore"
 	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/spectrogram"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
@@ -20,15 +35,98 @@ var (
 	centerFreq = flag.Float64("center", 433.92, "Center frequency in MHz")
 	bandwidth  = flag.Float64("bw", 2.0, "Bandwidth in MHz")
 	numChans   = flag.Int("chans", 100, "Number of channels (1-255)")
+	startMHz   = flag.Float64("start", 0, "Wideband scan from this frequency in MHz, in as many sweeps as needed (with -stop; replaces -center/-bw/-chans)")
+	stopMHz    = flag.Float64("stop", 0, "Wideband scan up to this frequency in MHz")
+	resKHz     = flag.Float64("res", 100, "Channel spacing in kHz for -start/-stop (23.438-374.267)")
 	threshold  = flag.Float64("threshold", -70.0, "RSSI threshold in dBm for peak detection")
 	duration   = flag.Duration("duration", 0, "Scan duration (0 = indefinite)")
 	deviceSel  = flag.String("d", "", yardstick.DeviceFlagUsage())
 	listOnly   = flag.Bool("l", false, "List devices only")
 	verbose    = flag.Bool("v", false, "Verbose output - show all frames")
 	quiet      = flag.Bool("q", false, "Quiet mode - only show detected signals")
-	csvOut     = flag.String("csv", "", "Output CSV file for spectrogram data")
+	csvOut     = flag.String("csv", "", "Output CSV file for spectrogram data (timestamped RSSI rows, as plot-spectrum reads)")
+	baseConfig = flag.String("c", "", "Device configuration (JSON) to seed scan settings from")
+	baseProf   = flag.String("profile", "", "Profile configuration (JSON) to seed scan settings from")
+	snapshotN  = flag.Int("snapshot", 0, "Attach +/- N channels of surrounding spectrum to each detected signal")
+	captureOn  = flag.Bool("capture", false, "On the first detected signal, switch to a listen-only profile and capture packets")
+	captureMod = flag.String("mod", "ook", "Modulation assumed for -capture and -burst: ook, 2fsk, gfsk")
+	captureBd  = flag.Float64("baud", 0, "Symbol rate estimate for -capture and -burst (0 = default)")
+	burstDir   = flag.String("burst", "", "Capture a burst of traffic at each detected signal into this directory, then resume scanning")
+	burstPkts  = flag.Int("burst-packets", scanner.DefaultBurstPackets, "End a -burst capture after this many packets (0 = only -burst-time)")
+	burstTime  = flag.Duration("burst-time", scanner.DefaultBurstTime, "End a -burst capture after this long")
+	burstFmt   = flag.String("burst-format", scanner.DefaultBurstFormat, "-burst capture format: native, hex, pcap or sigmf")
+	burstBands = flag.String("burst-band", "", "Receive profiles for -burst as low-high:profile in MHz, comma-separated, e.g. 433-434.8:etc/433-tx.json (default: listen-only, from -mod/-baud)")
+	burstHold  = flag.Duration("burst-holdoff", scanner.DefaultHoldoff, "Don't capture again within 100 kHz of a -burst capture for this long")
+	burstDev   = flag.String("burst-device", "", "Make -burst captures on this second device, so the scan never pauses (same formats as -d)")
+	burstProf  = flag.String("burst-profile", "", "Profile (built-in name or file) -burst-device receives with outside the -burst-band bands (default: listen-only, from -mod/-baud)")
+	classifyOn = flag.Bool("classify", false, "Characterize each detected signal: fine sweep for shape and bandwidth, then OOK vs FSK and burst length from the RSSI envelope and frequency estimate")
+	classTime  = flag.Duration("classify-time", scanner.DefaultEnvelopeTime, "How long -classify samples the envelope; long enough to see a transmission's gaps")
+	sigdbPaths = flag.String("sigdb", "", "Comma-separated CSV signal lists used with the built-in table to label detections")
+	dbPath     = flag.String("db", "", "Append sweeps to a spectrogram history file (view with 'gocat spectrogram serve')")
+	dbBin      = flag.Duration("db-bin", time.Minute, "Time resolution of -db rows; each row keeps the peak and mean of its sweeps")
+	sigmfOut   = flag.String("sigmf", "", "Write every sweep to a SigMF recording (.sigmf-meta), with detected signals annotated")
+	confirm    = flag.String("confirm", "", "Report a signal only once seen in N of the last M sweeps, e.g. 2/3 (2/2 = confirmed by the next sweep)")
+	confirmBnd = flag.String("confirm-band", "", "Per-band -confirm rules as low-high:N/M in MHz, comma-separated, e.g. 433-434.8:3/4")
+	scannerCfg = flag.String("scanner", "", "Scanner configuration (JSON, etc/scanner) whose signal_tracking and output sections set up -log, calibration section -calibrate, hopper_detection section -hopper and frequencies, scan_parameters and radio_presets sections -coarse")
+	logPath    = flag.String("log", "", "Log each detected signal (frequency, RSSI, first/last seen, count) when it ends")
+	logFormat  = flag.String("log-format", "", "Signal log format: csv, json or sqlite (default: from the -log extension, else json)")
+	logSize    = flag.Int64("log-rotate-size", 0, "Rotate the signal log once it reaches this many bytes (0 = never)")
+	logAge     = flag.Duration("log-rotate-age", 0, "Rotate the signal log once it is this old, e.g. 24h (0 = never)")
+	logKeep    = flag.Int("log-keep", siglog.DefaultKeep, "Rotated signal logs to keep")
+	statePath  = flag.String("state", "", "Checkpoint the signals detected and each channel's occupancy (at -threshold) to this file, resuming from it on the next run")
+	historyDB  = flag.String("history-db", "", "Merge each signal into a history of known signals kept across runs (JSON, or SQLite for .db); query and annotate it with 'gocat signals'")
+	ignoreList = flag.String("ignore", "", "Never report signals at these frequencies or ranges in MHz, comma-separated, e.g. 433.92,434.0-434.2")
+	allowList  = flag.String("allow", "", "Only report signals in these ranges in MHz, comma-separated, e.g. 433.05-434.79,868-870")
+	ignoreTol  = flag.Float64("ignore-tolerance", 0, "kHz either side of an -ignore frequency that is also ignored (0 = the scanner config's ignore_tolerance_hz, else 50)")
+	calSweeps  = flag.Int("calibrate", 0, "Measure each channel's noise floor over N sweeps and detect at floor + -margin instead of -threshold (0 = only if the -scanner calibration section is enabled)")
+	calMargin  = flag.Float64("margin", 0, "dB above the noise floor a -calibrate detection must be (0 = the scanner config's margin_db, else 10)")
+	hopperOn   = flag.Bool("hopper", false, "Detect frequency hoppers: short bursts on many channels within -hopper-window, reported as one FHSS signal")
+	hopperWin  = flag.Duration("hopper-window", 0, "Window -hopper correlates bursts over (0 = the scanner config's window_ms, else 5s)")
+	hopperChs  = flag.Int("hopper-channels", 0, "Channels a -hopper must use within the window (0 = the scanner config's min_channels, else 5)")
+	calRefresh = flag.Duration("recalibrate", 0, "Measure the noise floor again this often, e.g. 10m (0 = the scanner config's refresh_interval_ms, else never)")
+	coarseOn   = flag.Bool("coarse", false, "Two-stage scan as the Flipper does: a coarse pass over the -scanner coarse frequencies (default: 17 common sub-GHz channels), then tuned RSSI steps around the strongest")
+	coarseDevs = flag.String("coarse-devices", "", "Run -coarse on these devices, comma-separated selectors as for -d, e.g. #0,#1; the coarse frequencies are split between them, a band each where possible (default: -d)")
+	coarseBack = flag.String("coarse-backend", scanner.BackendSpecan, "-coarse pass: specan (spectrum analyzer sweeps at -res spacing) or rssi (tune and read RSSI per frequency)")
+
+	format output.Format
+	out    io.Writer = os.Stdout // Progress and text results
 )
 
+// signalRecord is a detected signal in -output json mode
+type signalRecord struct {
+	Type        string           `json:"type"` // "signal"
+	Time        time.Time        `json:"time"`
+	Frame       int              `json:"frame"`
+	FrequencyHz uint32           `json:"frequency_hz"`
+	RSSI        float32          `json:"rssi_dbm"`
+	Label       string           `json:"label,omitempty"`      // Known allocation the frequency falls in
+	Known       int              `json:"known_id,omitempty"`   // -history-db entry at the frequency
+	Annotation  string           `json:"annotation,omitempty"` // The entry's annotation
+	Device      string           `json:"device,omitempty"`     // -coarse-devices device that found it
+	Snapshot    *specan.Snapshot `json:"snapshot,omitempty"`
+}
+
+// summaryRecord ends a scan in -output json mode
+type summaryRecord struct {
+	Type      string  `json:"type"` // "summary"
+	Frames    int     `json:"frames"`
+	Signals   int     `json:"signals"`
+	Threshold float64 `json:"threshold_dbm"`
+
+	Unconfirmed int `json:"unconfirmed,omitempty"` // Detections -confirm held back
+	Bursts      int `json:"bursts,omitempty"`      // -burst captures made
+	Ignored     int `json:"ignored,omitempty"`     // Detections -ignore/-allow dropped
+	Classified  int `json:"classified,omitempty"`  // -classify passes made
+	Hoppers     int `json:"hoppers,omitempty"`     // -hopper detections
+}
+
+// packetRecord is a -capture packet in -output json mode
+type packetRecord struct {
+	Type string    `json:"type"` // "packet"
+	Time time.Time `json:"time"`
+	Data string    `json:"data"` // Hex
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
@@ -38,14 +136,34 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s -center 433.92 -bw 2           # Scan 432.92-434.92 MHz\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -center 915 -bw 10 -chans 200  # Wide scan at 915 MHz\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -start 902 -stop 928 -res 50     # 902-928 MHz stitched from 3 sweeps\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -threshold -80 -q              # Only show signals above -80 dBm\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -csv spectrum.csv -duration 10s # Save spectrogram data to CSV\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -profile etc/433-tx.json         # Scan with a profile's filter/AGC\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -threshold -60 -capture -baud 2400 # Capture the first signal found\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -duration 30s -output json > signals.jsonl # One JSON object per signal\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -sigdb etc/sigdb/example.csv   # Label signals from a local list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -db 433.spec                    # Keep a long-term spectrogram history\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -duration 1m -sigmf scan.sigmf-meta # Share sweeps as SigMF\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -threshold -60 -q -confirm 2/3     # Ignore single-sweep spikes\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -log signals.db -log-rotate-age 24h # Log signals to SQLite, a file per day\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -ignore 433.92 -allow 433.05-434.79 # Skip a known transmitter, report only LPD433\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -calibrate 20 -margin 8 -recalibrate 10m # Thresholds from the measured noise floor\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -confirm 2/3 -burst bursts -burst-band 433-434.8:etc/433-tx.json # Capture traffic at each signal\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -start 902 -stop 928 -q -hopper       # Find frequency hoppers across the ISM band\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -history-db known.db            # Recognize signals seen in earlier runs\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -coarse -scanner etc/scanner/default.json # Flipper-style two-stage scan of its coarse list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -coarse -coarse-devices #0,#1,#2 -q     # Split the coarse list across three devices\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -q -classify -log signals.csv       # Log each signal's modulation and burst length\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -d #0 -q -burst bursts -burst-device #1 -burst-profile etc/433-tx.json # Scan on one device, capture on another\n", os.Args[0])
 	}
+	flag.Var(&format, "output", output.FlagUsage+" (json writes one object per line)")
 	flag.Parse()
+	out = format.Progress()
 
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 }
 
@@ -61,16 +179,108 @@ func run() error {
 	if *numChans < 1 || *numChans > 255 {
 		return fmt.Errorf("chans must be 1-255")
 	}
+	if *coarseOn {
+		if err := checkCoarseFlags(); err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+	} else if *coarseDevs != "" {
+		return exitcode.Errorf(exitcode.Usage, "-coarse-devices needs -coarse")
+	}
+
+	signals, err := loadSignalDB(*sigdbPaths)
+	if err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+	}
+
+	confirmer, err := newConfirmer(*confirm, *confirmBnd)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Usage, "%v", err)
+	}
+
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	classifier := newClassifier()
+
+	var plan *specan.SweepPlan
+	if *startMHz != 0 || *stopMHz != 0 {
+		plan, err = specan.NewSweepPlan(uint32(*startMHz*1e6), uint32(*stopMHz*1e6), uint32(*resKHz*1e3))
+		if err != nil {
+			return exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+	}
+
+	var sc *scanner.Config
+	if *scannerCfg != "" {
+		if sc, err = scanner.LoadConfig(*scannerCfg); err != nil {
+			return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+		}
+	}
+	calibrator := newCalibrator(sc)
+	hopper := newHopperDetector(sc)
+	filter, err := newScanFilter(sc)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Usage, "%v", err)
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+	}
+	tracker, err := openSignalLog(signals, sc, store)
+	if err != nil {
+		return err
+	}
+	if tracker != nil {
+		defer func() {
+			if err := tracker.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			tracker.Close()
+		}()
+	}
+
+	state, err := openState(signals, float32(*threshold))
+	if err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%v", err)
+	}
+	if state != nil {
+		defer func() {
+			if err := state.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to save state: %v\n", err)
+			}
+		}()
+	}
+
+	if *coarseOn {
+		return runCoarse(ctx, sc, signals, filter, tracker, store, state)
+	}
 
 	// Open device
-	fmt.Println("Opening YardStick One...")
+	fmt.Fprintln(out, "Opening YardStick One...")
 	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
 	if err != nil {
 		return fmt.Errorf("failed to open device: %w", err)
 	}
 	defer device.Close()
 
-	fmt.Printf("Connected to: %s\n", device)
+	fmt.Fprintf(out, "Connected to: %s\n", device)
+
+	// With a second device for -burst, the scan hands detections over to
+	// it instead of pausing
+	var orch *orchestrator.Orchestrator
+	if *burstDev != "" {
+		tuneHz := uint32(*centerFreq * 1e6)
+		if plan != nil {
+			tuneHz = plan.StartHz
+		}
+		if orch, err = openRecorder(ctx, device, capturer, tuneHz); err != nil {
+			return err
+		}
+		defer orch.Device.Close()
+		fmt.Fprintf(out, "Capturing on:  %s with %s\n", orch.Device, orch.Profile)
+	}
 
 	// Create spectrum analyzer
 	sa := specan.New(device)
@@ -82,87 +292,242 @@ func run() error {
 		NumChans:   uint8(*numChans),
 	}
 
-	fmt.Printf("\nConfiguration:\n")
-	fmt.Printf("  Center:     %.3f MHz\n", *centerFreq)
-	fmt.Printf("  Bandwidth:  %.3f MHz\n", *bandwidth)
-	fmt.Printf("  Channels:   %d\n", *numChans)
-	fmt.Printf("  Range:      %.3f - %.3f MHz\n",
-		*centerFreq-*bandwidth/2, *centerFreq+*bandwidth/2)
-	fmt.Printf("  Resolution: %.3f kHz per channel\n", *bandwidth*1000/float64(*numChans))
-	fmt.Printf("  Threshold:  %.1f dBm\n", *threshold)
+	base, baseName, err := loadBase(*baseConfig, *baseProf)
+	if err != nil {
+		return err
+	}
+	cfg.Base = base
+
+	fmt.Fprintf(out, "\nConfiguration:\n")
+	if plan != nil {
+		plan.Base = base
+		fmt.Fprintf(out, "  Channels:   %d in %d sweeps\n", plan.NumChans, len(plan.Segments))
+		fmt.Fprintf(out, "  Range:      %.3f - %.3f MHz\n", float64(plan.StartHz)/1e6, float64(plan.StopHz())/1e6)
+		fmt.Fprintf(out, "  Resolution: %.3f kHz per channel\n", float64(plan.SpacingHz)/1e3)
+	} else {
+		fmt.Fprintf(out, "  Center:     %.3f MHz\n", *centerFreq)
+		fmt.Fprintf(out, "  Bandwidth:  %.3f MHz\n", *bandwidth)
+		fmt.Fprintf(out, "  Channels:   %d\n", *numChans)
+		fmt.Fprintf(out, "  Range:      %.3f - %.3f MHz\n",
+			*centerFreq-*bandwidth/2, *centerFreq+*bandwidth/2)
+		fmt.Fprintf(out, "  Resolution: %.3f kHz per channel\n", *bandwidth*1000/float64(*numChans))
+	}
+	if calibrator != nil {
+		fmt.Fprintf(out, "  Threshold:  noise floor + %.1f dB, measured over %d sweeps", calibrator.MarginDB, calibrator.Sweeps)
+		if calibrator.Refresh > 0 {
+			fmt.Fprintf(out, " every %v", calibrator.Refresh)
+		}
+		if f := calibrator.Floor(); f != nil {
+			fmt.Fprintf(out, " (stored floor from %s)\n", f.Measured.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(out, " (%.1f dBm until then)\n", *threshold)
+		}
+	} else {
+		fmt.Fprintf(out, "  Threshold:  %.1f dBm\n", *threshold)
+	}
+	if baseName != "" {
+		fmt.Fprintf(out, "  Base:       %s\n", baseName)
+	}
+	if filter != nil {
+		printScanFilter(filter)
+	}
+	if hopper != nil {
+		fmt.Fprintf(out, "  Hoppers:    %d+ channels and %d+ hops within %v\n", hopper.MinChannels, hopper.MinHops, hopper.Window)
+	}
+	if confirmer != nil {
+		fmt.Fprintf(out, "  Confirm:    %s sweeps", confirmer.Default)
+		for _, b := range confirmer.Bands {
+			fmt.Fprintf(out, ", %s at %.3f-%.3f MHz", b.Rule, float64(b.LowHz)/1e6, float64(b.HighHz)/1e6)
+		}
+		fmt.Fprintln(out)
+	}
 	if *csvOut != "" {
-		fmt.Printf("  CSV Output: %s\n", *csvOut)
+		fmt.Fprintf(out, "  CSV Output: %s\n", *csvOut)
+	}
+	if *dbPath != "" {
+		fmt.Fprintf(out, "  History:    %s (%v bins)\n", *dbPath, *dbBin)
+	}
+	if *sigmfOut != "" {
+		fmt.Fprintf(out, "  SigMF:      %s\n", *sigmfOut)
+	}
+	if tracker != nil && tracker.Path != "" {
+		fmt.Fprintf(out, "  Signal log: %s\n", tracker.Path)
+	}
+	if store != nil {
+		fmt.Fprintf(out, "  Known:      %d signals in %s\n", len(store.Query(nil)), store.Path())
+	}
+	if state != nil {
+		printState(state)
+	}
+	if capturer != nil {
+		fmt.Fprintf(out, "  Bursts:     %d packets or %v into %s\n", capturer.Packets, capturer.Duration, capturer.Dir)
+	}
+	if classifier != nil {
+		fmt.Fprintf(out, "  Classify:   %v of envelope per signal\n", classifier.EnvelopeTime)
 	}
-	fmt.Println()
+	fmt.Fprintln(out)
 
-	if err := sa.Configure(cfg); err != nil {
-		return fmt.Errorf("configure failed: %w", err)
+	if plan == nil {
+		if err := sa.Configure(cfg); err != nil {
+			return fmt.Errorf("configure failed: %w", err)
+		}
 	}
 
-	// Set up CSV output if requested
-	var csvFile *os.File
-	var csvWriter *bufio.Writer
+	// Set up CSV output if requested; the header comes from the first
+	// sweep, which has the frequencies the firmware actually settled on
+	var waterfall *specan.WaterfallWriter
 	if *csvOut != "" {
-		var err error
-		csvFile, err = os.Create(*csvOut)
+		csvFile, err := os.Create(*csvOut)
 		if err != nil {
 			return fmt.Errorf("failed to create CSV file: %w", err)
 		}
 		defer csvFile.Close()
-		csvWriter = bufio.NewWriter(csvFile)
-		defer csvWriter.Flush()
+		waterfall = specan.NewWaterfallWriter(csvFile)
+		defer waterfall.Flush()
+	}
+
+	// The history file's plan comes from the first sweep, which has the
+	// frequencies the firmware actually settled on
+	var history *spectrogram.DB
+	var recorder *spectrogram.Recorder
+	defer func() {
+		if recorder != nil {
+			if err := recorder.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to write spectrogram history: %v\n", err)
+			}
+		}
+		if history != nil {
+			history.Close()
+		}
+	}()
 
-		// Write header: timestamp_ms, freq1, freq2, freq3, ...
-		freqs := make([]string, *numChans)
-		baseFreq := *centerFreq - *bandwidth/2
-		chanSpacing := *bandwidth / float64(*numChans)
-		for i := 0; i < *numChans; i++ {
-			freqs[i] = fmt.Sprintf("%.6f", baseFreq+float64(i)*chanSpacing)
+	var recording *sigmf.SpectrumWriter
+	if *sigmfOut != "" {
+		recording, err = sigmf.CreateSpectrum(*sigmfOut, strings.TrimSpace("YARD Stick One "+device.Serial))
+		if err != nil {
+			return err
 		}
-		fmt.Fprintf(csvWriter, "timestamp_ms,%s\n", strings.Join(freqs, ","))
+		defer func() {
+			if err := recording.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to finish SigMF recording: %v\n", err)
+			}
+		}()
 	}
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start analyzer
-	if err := sa.Start(); err != nil {
-		return fmt.Errorf("start failed: %w", err)
-	}
-	defer sa.Stop()
-
 	// Set up timeout if specified
 	var timeoutCtx context.Context
 	var cancel context.CancelFunc
 	if *duration > 0 {
 		timeoutCtx, cancel = context.WithTimeout(context.Background(), *duration)
-		fmt.Printf("Scanning for %v...\n", *duration)
 	} else {
 		timeoutCtx, cancel = context.WithCancel(context.Background())
-		fmt.Println("Scanning... (Press Ctrl+C to stop)")
 	}
 	defer cancel()
 
+	// Start analyzer; a wideband plan runs its sweeps in turn and
+	// delivers one stitched frame per pass. pauseSweep and resumeSweep
+	// free the radio for a -burst capture or -classify pass and take it
+	// back
+	var frames <-chan *specan.Frame
+	var pauseSweep, resumeSweep func() error
+	sweepErr := make(chan error, 1)
+	if plan != nil {
+		stitched := make(chan *specan.Frame, 1)
+		frames = stitched
+		// Held through each pass, so a capture waits for the pass to end
+		var radio sync.Mutex
+		pauseSweep = func() error { radio.Lock(); return nil }
+		resumeSweep = func() error { radio.Unlock(); return nil }
+		go func() {
+			defer close(stitched)
+			for timeoutCtx.Err() == nil {
+				radio.Lock()
+				f, err := plan.Sweep(timeoutCtx, sa)
+				radio.Unlock()
+				if err != nil {
+					if timeoutCtx.Err() == nil {
+						sweepErr <- err
+						return
+					}
+					break
+				}
+				select {
+				case stitched <- f:
+				case <-timeoutCtx.Done():
+				}
+			}
+			sweepErr <- nil
+		}()
+	} else {
+		if err := sa.Start(); err != nil {
+			return fmt.Errorf("start failed: %w", err)
+		}
+		defer sa.Stop()
+		frames = sa.Frames()
+		sweepErr <- nil
+		pauseSweep = sa.Stop
+		resumeSweep = func() error {
+			if err := sa.Configure(cfg); err != nil {
+				return fmt.Errorf("configure failed: %w", err)
+			}
+			if err := sa.Start(); err != nil {
+				return fmt.Errorf("start failed: %w", err)
+			}
+			frames = sa.Frames()
+			return nil
+		}
+	}
+	if *duration > 0 {
+		fmt.Fprintf(out, "Scanning for %v...\n", *duration)
+	} else {
+		fmt.Fprintln(out, "Scanning... (Press Ctrl+C to stop)")
+	}
+
 	// Display header
-	if !*quiet {
-		fmt.Println("\n Frame | Max Freq (MHz) | Max RSSI | Avg RSSI | Peaks")
-		fmt.Println("-------+----------------+----------+----------+-------")
+	if !*quiet && !format.IsJSON() {
+		fmt.Fprintln(out, "\n Frame | Max Freq (MHz) | Max RSSI | Avg RSSI | Peaks")
+		fmt.Fprintln(out, "-------+----------------+----------+----------+-------")
 	}
 
 	frameCount := 0
 	peakCount := 0
+	burstCount := 0
+	ignored := 0
+	classified := 0
+	hoppers := 0
+
+	var bursts <-chan *scanner.Burst
+	orchErr := make(chan error, 1)
+	if orch != nil {
+		bursts = orch.Bursts()
+		go func() { orchErr <- orch.Run(timeoutCtx) }()
+	} else {
+		orchErr <- nil
+	}
+	var captureEst *profiles.SignalEstimate
 
 	for {
 		select {
 		case <-sigChan:
-			fmt.Println("\n\nStopping...")
+			fmt.Fprintln(out, "\n\nStopping...")
 			goto done
 
 		case <-timeoutCtx.Done():
 			goto done
 
-		case frame, ok := <-sa.Frames():
+		case b, ok := <-bursts:
+			if !ok {
+				// The capture device failed
+				goto done
+			}
+			burstCount++
+			printBurst(b, signals)
+
+		case frame, ok := <-frames:
 			if !ok {
 				goto done
 			}
@@ -170,70 +535,493 @@ func run() error {
 			frameCount++
 			maxIdx, maxFreq, maxRSSI := specan.MaxRSSI(frame)
 			avgRSSI := specan.AverageRSSI(frame)
-			peaks := specan.FindPeaks(frame, float32(*threshold))
+			var peaks []specan.Peak
+			if calibrator != nil {
+				if floor := calibrator.Add(frame); floor != nil {
+					calibrated(floor, calibrator.MarginDB)
+				}
+				peaks = calibrator.Peaks(frame, float32(*threshold))
+			} else {
+				peaks = specan.FindPeaks(frame, float32(*threshold))
+			}
+			if filter != nil {
+				n := len(peaks)
+				peaks = filter.Filter(peaks)
+				ignored += n - len(peaks)
+			}
+			// Hops are single-sweep bursts, which -confirm drops
+			if hopper != nil {
+				if f := hopper.Sweep(frame.Timestamp, peaks); f != nil {
+					hoppers++
+					reportHopper(frame.Timestamp, f, signals, tracker)
+				}
+			}
+			if confirmer != nil {
+				peaks = confirmer.Confirm(frame, peaks)
+			}
+			if tracker != nil {
+				if err := tracker.Sweep(frame.Timestamp, peaks); err != nil {
+					return err
+				}
+			}
+			if state != nil {
+				state.Add(frame.Timestamp, frame, peaks)
+			}
 
 			// Write CSV row if output file specified
-			if csvWriter != nil {
-				// timestamp in milliseconds since Unix epoch
-				tsMs := frame.Timestamp.UnixMilli()
-				rssiStrs := make([]string, len(frame.RSSI))
-				for i, rssi := range frame.RSSI {
-					rssiStrs[i] = fmt.Sprintf("%.1f", rssi)
+			if waterfall != nil {
+				if err := waterfall.WriteFrame(frame); err != nil {
+					return err
+				}
+			}
+
+			if *dbPath != "" {
+				if recorder == nil {
+					history, err = spectrogram.Create(*dbPath, spectrogram.Plan{
+						BaseHz:    frame.BaseFreq,
+						SpacingHz: frame.ChanSpacing,
+						Channels:  frame.NumChans,
+						Bin:       *dbBin,
+					})
+					if err != nil {
+						return err
+					}
+					if recorder, err = spectrogram.NewRecorder(history); err != nil {
+						return err
+					}
+				}
+				if err := recorder.Add(frame.Timestamp, frame.BaseFreq, frame.ChanSpacing, frame.RSSI); err != nil {
+					return err
+				}
+			}
+
+			if recording != nil {
+				if err := recording.Write(&sigmf.Sweep{Time: frame.Timestamp, BaseHz: frame.BaseFreq, SpacingHz: frame.ChanSpacing, RSSI: frame.RSSI}); err != nil {
+					return err
+				}
+				for _, p := range peaks {
+					half := specan.PeakBandwidth(frame, p.ChannelIndex, 6) / 2
+					recording.Mark(p.FrequencyHz-half, p.FrequencyHz+half, fmt.Sprintf("%.1f dBm%s", p.RSSI, likely(signals, p.FrequencyHz)))
 				}
-				fmt.Fprintf(csvWriter, "%d,%s\n", tsMs, strings.Join(rssiStrs, ","))
+			}
+
+			if len(peaks) > 0 && *captureOn {
+				captureEst = &profiles.SignalEstimate{
+					FrequencyHz:    float64(maxFreq),
+					BandwidthHz:    float64(specan.PeakBandwidth(frame, maxIdx, 6)),
+					SymbolRateBaud: *captureBd,
+					Modulation:     captureModulation(*captureMod),
+				}
+				fmt.Fprintf(out, "\nSignal at %.3f MHz @ %.1f dBm, ~%.0f kHz wide%s\n",
+					captureEst.FrequencyHz/1e6, maxRSSI, captureEst.BandwidthHz/1e3, likely(signals, maxFreq))
+				goto done
 			}
 
 			if len(peaks) > 0 {
 				peakCount += len(peaks)
-				if *quiet {
+				if *snapshotN > 0 {
+					specan.AttachSnapshots(frame, peaks, *snapshotN)
+				}
+				if format.IsJSON() {
+					for _, p := range peaks {
+						rec := &signalRecord{
+							Type:        "signal",
+							Time:        frame.Timestamp,
+							Frame:       frameCount,
+							FrequencyHz: p.FrequencyHz,
+							RSSI:        p.RSSI,
+							Label:       signals.Label(p.FrequencyHz),
+							Snapshot:    p.Snapshot,
+						}
+						if store != nil {
+							if e := store.Lookup(p.FrequencyHz); e != nil {
+								rec.Known, rec.Annotation = e.ID, e.Annotation
+							}
+						}
+						output.WriteLine(rec)
+					}
+				} else if *quiet {
 					// Quiet mode: only show peaks
 					for _, p := range peaks {
-						fmt.Printf("SIGNAL: %.3f MHz @ %.1f dBm\n",
-							float64(p.FrequencyHz)/1e6, p.RSSI)
+						fmt.Fprintf(out, "SIGNAL: %.3f MHz @ %.1f dBm%s%s\n",
+							float64(p.FrequencyHz)/1e6, p.RSSI, known(store, p.FrequencyHz), likely(signals, p.FrequencyHz))
+						if p.Snapshot != nil {
+							printSnapshot(p.Snapshot)
+						}
 					}
 				}
 			}
 
-			if !*quiet {
+			if !*quiet && !format.IsJSON() {
 				if *verbose || len(peaks) > 0 {
-					fmt.Printf(" %5d | %14.3f | %8.1f | %8.1f | %d\n",
+					fmt.Fprintf(out, " %5d | %14.3f | %8.1f | %8.1f | %d\n",
 						frameCount, float64(maxFreq)/1e6, maxRSSI, avgRSSI, len(peaks))
 				} else if frameCount%50 == 0 {
 					// Periodic status update
-					fmt.Printf(" %5d | %14.3f | %8.1f | %8.1f | scanning...\n",
+					fmt.Fprintf(out, " %5d | %14.3f | %8.1f | %8.1f | scanning...\n",
 						frameCount, float64(maxFreq)/1e6, maxRSSI, avgRSSI)
 				}
 			}
 
 			// Debug: print full spectrum on verbose with signal
 			if *verbose && len(peaks) > 0 && maxIdx >= 0 {
-				fmt.Printf("        Channel %d: raw index in spectrum\n", maxIdx)
+				fmt.Fprintf(out, "        Channel %d: raw index in spectrum\n", maxIdx)
+			}
+
+			if classifier != nil {
+				if d := nextDue(classifier.Due, frame, peaks); d != nil {
+					class, err := classifySignal(timeoutCtx, classifier, sa, device, d, pauseSweep, resumeSweep)
+					if err != nil {
+						return err
+					}
+					classified++
+					printClass(d, class, signals)
+					if tracker != nil {
+						tracker.Classify(d.FrequencyHz, class)
+					}
+				}
+			}
+
+			if capturer != nil {
+				if d := nextDue(capturer.Due, frame, peaks); d != nil {
+					if orch != nil {
+						// Dropped if the capture device is still busy
+						orch.Offer(d)
+					} else {
+						b, err := captureBurst(timeoutCtx, capturer, device, d, pauseSweep, resumeSweep)
+						if err != nil {
+							return err
+						}
+						burstCount++
+						printBurst(b, signals)
+					}
+				}
 			}
 		}
 	}
 
 done:
-	fmt.Printf("\n--- Summary ---\n")
-	fmt.Printf("Frames:  %d\n", frameCount)
-	fmt.Printf("Signals: %d (above %.1f dBm)\n", peakCount, *threshold)
+	// Wait for a wideband plan to finish its sweep and free the radio
+	cancel()
+	if err := <-sweepErr; err != nil {
+		return err
+	}
+	// Let the capture device finish its capture
+	if orch != nil {
+		for b := range bursts {
+			burstCount++
+			printBurst(b, signals)
+		}
+	}
+	if err := <-orchErr; err != nil {
+		return err
+	}
+
+	unconfirmed := 0
+	if confirmer != nil {
+		unconfirmed = confirmer.Suppressed()
+	}
+	if format.IsJSON() {
+		output.WriteLine(&summaryRecord{Type: "summary", Frames: frameCount, Signals: peakCount, Threshold: *threshold, Unconfirmed: unconfirmed, Bursts: burstCount, Ignored: ignored, Classified: classified, Hoppers: hoppers})
+	} else {
+		fmt.Fprintf(out, "\n--- Summary ---\n")
+		fmt.Fprintf(out, "Frames:  %d\n", frameCount)
+		fmt.Fprintf(out, "Signals: %d (above %.1f dBm)\n", peakCount, *threshold)
+		if confirmer != nil {
+			fmt.Fprintf(out, "Unconfirmed: %d\n", unconfirmed)
+		}
+		if filter != nil {
+			fmt.Fprintf(out, "Ignored: %d\n", ignored)
+		}
+		if classifier != nil {
+			fmt.Fprintf(out, "Classified: %d\n", classified)
+		}
+		if hopper != nil {
+			fmt.Fprintf(out, "Hoppers: %d\n", hoppers)
+		}
+		if capturer != nil {
+			fmt.Fprintf(out, "Bursts:  %d captured into %s\n", burstCount, capturer.Dir)
+		}
+		if tracker != nil && tracker.Path != "" {
+			// Signals still open are logged as the scan ends
+			fmt.Fprintf(out, "Logged:  %d signals to %s\n", tracker.Logged()+len(tracker.Open()), tracker.Path)
+		}
+		if state != nil {
+			printStateSummary(state)
+		}
+	}
+
+	if captureEst != nil {
+		sa.Stop()
+		return runCapture(device, captureEst, sigChan)
+	}
 	return nil
 }
 
+// newConfirmer builds the -confirm and -confirm-band rules; nil if neither is set
+func newConfirmer(rule, bands string) (*specan.Confirmer, error) {
+	if rule == "" && bands == "" {
+		return nil, nil
+	}
+	def := specan.Rule{N: 1, M: 1}
+	if rule != "" {
+		var err error
+		if def, err = specan.ParseRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	bandRules, err := specan.ParseBandRules(bands)
+	if err != nil {
+		return nil, err
+	}
+	c := specan.NewConfirmer(def, bandRules)
+	// A peak moving by a channel between sweeps is still the same signal
+	c.Tolerance = 1
+	return c, nil
+}
+
+// newScanFilter combines -ignore and -allow with the -scanner
+// configuration's lists; nil if nothing is filtered
+func newScanFilter(sc *scanner.Config) (*scanner.ScanConfig, error) {
+	var f scanner.ScanConfig
+	if sc != nil {
+		f = sc.ScanParameters
+	}
+	freqs, ranges, err := scanner.ParseFrequencies(*ignoreList)
+	if err != nil {
+		return nil, err
+	}
+	f.IgnoreFrequencies = append(f.IgnoreFrequencies, freqs...)
+	f.IgnoreRanges = append(f.IgnoreRanges, ranges...)
+
+	freqs, ranges, err = scanner.ParseFrequencies(*allowList)
+	if err != nil {
+		return nil, err
+	}
+	if len(freqs) > 0 {
+		return nil, fmt.Errorf("-allow takes ranges, not single frequencies")
+	}
+	f.AllowRanges = append(f.AllowRanges, ranges...)
+	if *ignoreTol > 0 {
+		f.IgnoreToleranceHz = uint32(*ignoreTol * 1e3)
+	}
+	if !f.Filters() {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// printScanFilter lists what the scan won't report
+func printScanFilter(f *scanner.ScanConfig) {
+	var ignored []string
+	for _, freq := range f.IgnoreFrequencies {
+		ignored = append(ignored, fmt.Sprintf("%.3f MHz", float64(freq)/1e6))
+	}
+	for _, r := range f.IgnoreRanges {
+		ignored = append(ignored, r.String())
+	}
+	if len(ignored) > 0 {
+		fmt.Fprintf(out, "  Ignore:     %s\n", strings.Join(ignored, ", "))
+	}
+	if len(f.AllowRanges) > 0 {
+		allowed := make([]string, len(f.AllowRanges))
+		for i, r := range f.AllowRanges {
+			allowed[i] = r.String()
+		}
+		fmt.Fprintf(out, "  Only:       %s\n", strings.Join(allowed, ", "))
+	}
+}
+
+// signalLog is the -log tracker and the file it writes; Path is empty
+// when it only feeds the -history-db
+type signalLog struct {
+	*siglog.Tracker
+	siglog.Writer
+	Path string
+}
+
+// openSignalLog sets up -log, from the flags or the -scanner configuration
+// sc, and feeds the signals it ends to history; nil if there is neither a
+// log nor a history
+func openSignalLog(signals *sigdb.DB, sc *scanner.Config, history *sigstore.Store) (*signalLog, error) {
+	path, logFmt := *logPath, *logFormat
+	resolution, lost := uint32(0), 0
+	if sc != nil {
+		if sc.Output.LogSignals {
+			if path == "" {
+				path = sc.Output.LogPath
+			}
+			if logFmt == "" {
+				logFmt = sc.Output.LogFormat
+			}
+		}
+		resolution, lost = sc.SignalTracking.FrequencyResolutionHz, sc.SignalTracking.LostThreshold
+	}
+	if path == "" && history == nil {
+		return nil, nil
+	}
+
+	var w siglog.Writer
+	if path != "" {
+		var err error
+		w, err = siglog.Open(path, &siglog.Options{Format: logFmt, MaxBytes: *logSize, MaxAge: *logAge, Keep: *logKeep})
+		if err != nil {
+			return nil, exitcode.Errorf(exitcode.Usage, "%v", err)
+		}
+	}
+	if history != nil {
+		// The tracker closes the history with the log
+		if w == nil {
+			w = historyWriter{history}
+		} else {
+			w = siglog.MultiWriter(w, historyWriter{history})
+		}
+	}
+	t := siglog.NewTracker(w)
+	if resolution > 0 {
+		t.ResolutionHz = resolution
+	}
+	if lost > 0 {
+		t.LostSweeps = lost
+	}
+	t.Label = signals.Label
+	return &signalLog{Tracker: t, Writer: w, Path: path}, nil
+}
+
+// printSnapshot prints the spectrum around a signal, one channel per column
+func printSnapshot(snap *specan.Snapshot) {
+	vals := make([]string, len(snap.RSSI))
+	for i, v := range snap.RSSI {
+		vals[i] = fmt.Sprintf("%.0f", v)
+	}
+	fmt.Fprintf(out, "        %.3f MHz +%.1f kHz/ch: %s\n",
+		float64(snap.StartHz)/1e6, float64(snap.SpacingHz)/1e3, strings.Join(vals, " "))
+}
+
+// loadSignalDB builds the table used to label detections
+func loadSignalDB(paths string) (*sigdb.DB, error) {
+	var files []string
+	for _, p := range strings.Split(paths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			files = append(files, p)
+		}
+	}
+	return sigdb.Load(files...)
+}
+
+// likely formats the known allocation of a frequency for text output
+func likely(signals *sigdb.DB, freqHz uint32) string {
+	if label := signals.Label(freqHz); label != "" {
+		return " (likely " + label + ")"
+	}
+	return ""
+}
+
+// loadBase reads the optional register set the scan is seeded from
+func loadBase(configPath, profilePath string) (*registers.RegisterMap, string, error) {
+	switch {
+	case configPath != "" && profilePath != "":
+		return nil, "", fmt.Errorf("-c and -profile are mutually exclusive")
+	case configPath != "":
+		c, err := config.LoadFromFile(configPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load configuration: %w", err)
+		}
+		return &c.Registers, configPath, nil
+	case profilePath != "":
+		p, err := profiles.LoadProfileFromFile(profilePath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load profile: %w", err)
+		}
+		return &p.Registers, p.Profile.Name, nil
+	}
+	return nil, "", nil
+}
+
+// captureModulation maps the -mod flag to a profile modulation
+func captureModulation(name string) uint8 {
+	switch strings.ToLower(name) {
+	case "2fsk", "fsk":
+		return profiles.Mod2FSK
+	case "gfsk":
+		return profiles.ModGFSK
+	default:
+		return profiles.ModASKOOK
+	}
+}
+
+// runCapture applies a promiscuous profile for the detected signal and
+// prints every received burst as a hex line until interrupted
+func runCapture(device *yardstick.Device, est *profiles.SignalEstimate, sigChan chan os.Signal) error {
+	profile := profiles.NewPromiscuous(*est)
+	fmt.Fprintf(out, "\nCapturing with %s: %s\n", profile.Name, profile.Description)
+	fmt.Fprintf(out, "  Channel BW: %.0f kHz, sync: carrier sense, length: %d bytes fixed\n",
+		profile.ChannelBWHz/1e3, profile.PktLen)
+
+	// Force IDLE state first
+	if err := device.PokeByte(0xDFE1, 0x04); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to strobe IDLE: %v\n", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := config.ApplyProfile(device, profile); err != nil {
+		return fmt.Errorf("failed to apply capture profile: %w", err)
+	}
+	if err := device.EnableAmplifier(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to enable amplifiers: %v\n", err)
+	}
+
+	stream := rxstream.New(device, nil)
+	if err := stream.Start(); err != nil {
+		return err
+	}
+	defer stream.Stop()
+
+	fmt.Fprintln(out, "Listening... (Press Ctrl+C to stop)")
+	count := 0
+	for {
+		select {
+		case <-sigChan:
+			fmt.Fprintf(out, "\nCaptured %d packets\n", count)
+			return nil
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				return nil
+			}
+			count++
+			if format.IsJSON() {
+				output.WriteLine(&packetRecord{Type: "packet", Time: pkt.Timestamp, Data: fmt.Sprintf("%X", pkt.Raw)})
+				continue
+			}
+			fmt.Fprintf(out, "%s %X\n", pkt.Timestamp.Format("15:04:05.000"), pkt.Raw)
+		}
+	}
+}
+
 func listDevices(ctx *gousb.Context) error {
 	devices, err := yardstick.FindAllDevices(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list devices: %w", err)
 	}
 
+	if format.IsJSON() {
+		infos := make([]yardstick.DeviceInfo, len(devices))
+		for i, d := range devices {
+			infos[i] = d.Info(false)
+			d.Close()
+		}
+		return output.Write(infos)
+	}
+
 	if len(devices) == 0 {
-		fmt.Println("No YardStick One devices found")
+		fmt.Fprintln(out, "No YardStick One devices found")
 		return nil
 	}
 
-	fmt.Printf("Found %d YardStick One device(s):\n\n", len(devices))
+	fmt.Fprintf(out, "Found %d YardStick One device(s):\n\n", len(devices))
 	for i, d := range devices {
 		defer d.Close()
-		fmt.Printf("  #%d  %s  %d:%d\n", i, d.Serial, d.Bus, d.Address)
+		fmt.Fprintf(out, "  #%d  %s  %d:%d\n", i, d.Serial, d.Bus, d.Address)
 	}
 	return nil
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/checkpoint"
+	"github.com/herlein/gocat/pkg/sigdb"
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// scanState is what -state checkpoints: every frequency a signal was
+// detected at and how often each channel was occupied, over all runs
+type scanState struct {
+	Updated   time.Time          `json:"updated"`
+	Sweeps    int                `json:"sweeps"`
+	Signals   []heardSignal      `json:"signals"`
+	Occupancy []channelOccupancy `json:"occupancy"`
+}
+
+// heardSignal is the detection history of one frequency
+type heardSignal struct {
+	FrequencyHz uint32    `json:"frequency_hz"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Detections  int       `json:"detections"`
+	PeakRSSI    float32   `json:"peak_rssi_dbm"`
+	Label       string    `json:"label,omitempty"`
+}
+
+// channelOccupancy counts the sweeps that covered a channel and those it
+// was at or above -threshold in
+type channelOccupancy struct {
+	FrequencyHz uint32 `json:"frequency_hz"`
+	Sweeps      int    `json:"sweeps"`
+	Occupied    int    `json:"occupied"`
+}
+
+// Percent returns the share of sweeps the channel was occupied in
+func (c *channelOccupancy) Percent() float64 {
+	if c.Sweeps == 0 {
+		return 0
+	}
+	return 100 * float64(c.Occupied) / float64(c.Sweeps)
+}
+
+// scanStats accumulates the -state as the scan runs; the saver snapshots
+// it from its own goroutine
+type scanStats struct {
+	Path string
+
+	signals   *sigdb.DB
+	threshold float32
+	saver     *checkpoint.Saver
+
+	mu        sync.Mutex
+	sweeps    int
+	heard     map[uint32]*heardSignal
+	occupancy map[uint32]*channelOccupancy
+}
+
+// openState restores -state and starts checkpointing it; nil if -state
+// isn't given
+func openState(signals *sigdb.DB, thresholdDBm float32) (*scanStats, error) {
+	if *statePath == "" {
+		return nil, nil
+	}
+	s := &scanStats{
+		Path:      *statePath,
+		signals:   signals,
+		threshold: thresholdDBm,
+		heard:     make(map[uint32]*heardSignal),
+		occupancy: make(map[uint32]*channelOccupancy),
+	}
+	var st scanState
+	if _, err := checkpoint.Load(s.Path, &st); err != nil {
+		return nil, fmt.Errorf("failed to restore state: %w", err)
+	}
+	s.sweeps = st.Sweeps
+	for i := range st.Signals {
+		s.heard[st.Signals[i].FrequencyHz] = &st.Signals[i]
+	}
+	for i := range st.Occupancy {
+		s.occupancy[st.Occupancy[i].FrequencyHz] = &st.Occupancy[i]
+	}
+
+	s.saver = checkpoint.NewSaver(s.Path, 0, s.snapshot, func(err error) {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save state: %v\n", err)
+	})
+	s.saver.Start()
+	return s, nil
+}
+
+// Add records a sweep's detections, and its channels' occupancy when
+// there is a frame; -coarse cycles only have detections
+func (s *scanStats) Add(at time.Time, frame *specan.Frame, peaks []specan.Peak) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweeps++
+	for _, p := range peaks {
+		h := s.heard[p.FrequencyHz]
+		if h == nil {
+			h = &heardSignal{FrequencyHz: p.FrequencyHz, FirstSeen: at, PeakRSSI: p.RSSI, Label: s.signals.Label(p.FrequencyHz)}
+			s.heard[p.FrequencyHz] = h
+		}
+		h.LastSeen = at
+		h.Detections++
+		h.PeakRSSI = max(h.PeakRSSI, p.RSSI)
+	}
+	if frame == nil {
+		return
+	}
+	for i, v := range frame.RSSI {
+		freq := specan.FrequencyForChannel(frame, i)
+		c := s.occupancy[freq]
+		if c == nil {
+			c = &channelOccupancy{FrequencyHz: freq}
+			s.occupancy[freq] = c
+		}
+		c.Sweeps++
+		if v >= s.threshold {
+			c.Occupied++
+		}
+	}
+}
+
+// Counts returns the sweeps and signal frequencies recorded so far
+func (s *scanStats) Counts() (sweeps, signals int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweeps, len(s.heard)
+}
+
+// Busiest returns the most occupied channel, or nil before any sweep
+func (s *scanStats) Busiest() *channelOccupancy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best *channelOccupancy
+	for _, c := range s.occupancy {
+		if best == nil || c.Percent() > best.Percent() {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	out := *best
+	return &out
+}
+
+// Close stops the saver, writing the final checkpoint
+func (s *scanStats) Close() error {
+	return s.saver.Stop()
+}
+
+func (s *scanStats) snapshot() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &scanState{
+		Updated:   time.Now(),
+		Sweeps:    s.sweeps,
+		Signals:   make([]heardSignal, 0, len(s.heard)),
+		Occupancy: make([]channelOccupancy, 0, len(s.occupancy)),
+	}
+	for _, h := range s.heard {
+		st.Signals = append(st.Signals, *h)
+	}
+	for _, c := range s.occupancy {
+		st.Occupancy = append(st.Occupancy, *c)
+	}
+	sort.Slice(st.Signals, func(i, j int) bool { return st.Signals[i].FrequencyHz < st.Signals[j].FrequencyHz })
+	sort.Slice(st.Occupancy, func(i, j int) bool { return st.Occupancy[i].FrequencyHz < st.Occupancy[j].FrequencyHz })
+	return st
+}
+
+// printState prints the -state line of the configuration
+func printState(s *scanStats) {
+	sweeps, signals := s.Counts()
+	if sweeps == 0 {
+		fmt.Fprintf(out, "  State:      %s (new)\n", s.Path)
+		return
+	}
+	fmt.Fprintf(out, "  State:      %s (%d signals over %d sweeps restored)\n", s.Path, signals, sweeps)
+}
+
+// printStateSummary prints the -state totals at the end of a scan
+func printStateSummary(s *scanStats) {
+	sweeps, signals := s.Counts()
+	fmt.Fprintf(out, "State:   %d signals over %d sweeps in %s\n", signals, sweeps, s.Path)
+	if c := s.Busiest(); c != nil && c.Occupied > 0 {
+		fmt.Fprintf(out, "Busiest: %.3f MHz, occupied in %.1f%% of %d sweeps\n", float64(c.FrequencyHz)/1e6, c.Percent(), c.Sweeps)
+	}
+}
@@ -12,16 +12,47 @@
 //	./send-recv -m send -c etc/defaults.json -data "Hello World"
 //
 //	# Send mode - transmit hex data
-//	./send-recv -m send -c etc/defaults.json -hex "DEADBEEF"
+//	./send-recv -m send -c etc/defaults.json -hex "DE:AD:BE:EF"
+//
+//	# Send mode - preamble pattern, then a 2-byte counter that increments per send
+//	./send-recv -m send -c etc/sniff.json -template "AAAA {seq:2} 0102" -n 10 -soft-crc -whiten
 //
 //	# Send mode - repeat transmission 10 times
 //	./send-recv -m send -c etc/defaults.json -data "test" -repeat 10
+//
+//	# Receive mode - software de-whitening and CRC check (hardware features off)
+//	./send-recv -m recv -c etc/sniff.json -dewhiten -soft-crc
+//
+//	# Receive mode - run packets through an annotation pipeline
+//	./send-recv -m recv -c etc/defaults.json -annotate etc/annotate/example.json
+//
+//	# Receive mode - inspector view with diff against the previous packet
+//	./send-recv -m recv -c etc/defaults.json -inspect
+//
+//	# Receive mode - keep going across unplug/replug of the YS1
+//	./send-recv -m recv -c etc/defaults.json -reconnect
+//
+//	# Record received packets with RSSI, LQI and the register setup...
+//	./send-recv -m recv -c etc/defaults.json -record garage.jsonl
+//
+//	# ...and transmit them again later with the original timing
+//	./send-recv -m send -replay garage.jsonl
+//
+//	# Receive mode - follow a drifting FSK sensor and save its drift profile
+//	./send-recv -m recv -c etc/sniff.json -drift widen -drift-log drift.json
+//
+//	# Receive mode - one JSON object per packet, then a summary, for scripts
+//	./send-recv -m recv -c etc/defaults.json -count 10 -output json
 package main
 
 import (
+	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
@@ -29,68 +60,184 @@ import (
 	"time"
 
 	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/annotate"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/checkpoint"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/inspect"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/payload"
+	"github.com/herlein/gocat/pkg/rxstream"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
+// Set from -output
+var (
+	format output.Format
+	out    io.Writer = os.Stdout // Progress and text results
+)
+
+// packetRecord is a received packet in -output json mode
+type packetRecord struct {
+	Type             string    `json:"type"` // "packet"
+	Time             time.Time `json:"time"`
+	Seq              int       `json:"seq"`
+	Data             string    `json:"data"`          // Hex, after any software processing
+	Raw              string    `json:"raw,omitempty"` // Hex as received, when processing changed it
+	RSSI             *int      `json:"rssi_dbm,omitempty"`
+	LQI              *uint8    `json:"lqi,omitempty"`
+	CRCOk            *bool     `json:"crc_ok,omitempty"`      // Radio CRC
+	SoftCRCOk        *bool     `json:"soft_crc_ok,omitempty"` // -soft-crc
+	ManchesterErrors int       `json:"manchester_errors,omitempty"`
+	FreqOffsetHz     *float64  `json:"freq_offset_hz,omitempty"`
+	Delta            int64     `json:"delta_ns"` // Since the previous packet
+	Burst            int       `json:"burst"`
+	BurstIndex       int       `json:"burst_index"`
+}
+
+// sentRecord is a transmitted packet in -output json mode
+type sentRecord struct {
+	Type string    `json:"type"` // "sent"
+	Time time.Time `json:"time"`
+	Seq  int       `json:"seq"`
+	Data string    `json:"data"` // Hex
+}
+
+// summaryRecord ends a send, replay or receive in -output json mode
+type summaryRecord struct {
+	Type       string                `json:"type"` // "summary"
+	Mode       string                `json:"mode"` // "send", "replay" or "recv"
+	Packets    int                   `json:"packets"`
+	Stopped    bool                  `json:"stopped,omitempty"` // Interrupted before the end
+	Timeouts   int                   `json:"timeouts,omitempty"`
+	Duplicates int                   `json:"duplicates,omitempty"`
+	Squelched  int                   `json:"squelched,omitempty"`
+	Noise      *rxstream.NoiseReport `json:"noise,omitempty"`
+}
+
 func main() {
 	// Parse command line flags
 	mode := flag.String("m", "", "Mode: 'send' or 'recv' (required)")
-	configPath := flag.String("c", "", "Configuration file path (required)")
+	configPath := flag.String("c", "", "Configuration file path (required, except with -replay of a capture that recorded its registers)")
 	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
 	verbose := flag.Bool("v", false, "Verbose output")
+	reconnect := flag.Bool("reconnect", false, "Reopen the device and reapply the configuration if it is unplugged and plugged back in")
 
 	// Send mode options
-	dataStr := flag.String("data", "", "Data to send (ASCII string)")
-	hexStr := flag.String("hex", "", "Data to send (hex encoded)")
+	dataStr := flag.String("data", "", "Data to send (text, with \\n \\t \\xNN escapes)")
+	hexStr := flag.String("hex", "", "Data to send (hex, separators like ' ' ':' '-' allowed)")
+	base64Str := flag.String("base64", "", "Data to send (base64)")
+	patternStr := flag.String("pattern", "", "Data to send as repeated hex segments, e.g. 'AA*8 2DD4'")
+	templateStr := flag.String("template", "", "Hex template with counters, e.g. 'AA55 {seq:2}'; the counter advances each iteration")
+	whiten := flag.Bool("whiten", false, "Apply PN9 data whitening in software before sending")
 	repeat := flag.Uint("repeat", 0, "Number of times to repeat transmission (0 = once)")
 	offset := flag.Uint("offset", 0, "Offset for repeat transmissions")
 	numSends := flag.Int("n", 1, "Number of send iterations (0 = infinite)")
 	delayMs := flag.Int("delay", 0, "Delay in milliseconds between send iterations")
+	maxRate := flag.Float64("rate", 0, "Maximum packets per second (0 = unlimited)")
+	dutyPct := flag.Float64("duty", 0, "Maximum transmit duty cycle in percent (0 = unlimited)")
+	limitState := flag.String("limit-state", "", "File to persist the -rate/-duty budget across restarts")
+	replayPath := flag.String("replay", "", "Send the packets of a capture file with their original timing")
+	speed := flag.Float64("speed", 1, "Replay speed factor (2 = twice as fast, 0 = back to back)")
 
 	// Receive mode options
 	timeout := flag.Duration("timeout", 1*time.Second, "Receive timeout per packet")
 	count := flag.Int("count", 0, "Number of packets to receive (0 = infinite)")
 	rawOutput := flag.Bool("raw", false, "Output raw hex only (for piping)")
+	softCRC := flag.Bool("soft-crc", false, "Verify and strip (recv) or append (send) CRC16 in software, for profiles with CRC disabled")
+	dewhiten := flag.Bool("dewhiten", false, "Remove PN9 data whitening in software")
+	manchester := flag.Bool("manchester", false, "Manchester decode received data in software")
+	dedupe := flag.Duration("dedupe", 0, "Drop repeats of the same frame within this window (e.g. 500ms)")
+	squelch := flag.Int("squelch", 0, "Drop packets received below this RSSI in dBm (0 = off)")
+	burstGap := flag.Duration("burst-gap", rxstream.DefaultBurstGap, "Packets closer than this are grouped into one burst")
+	inspectOutput := flag.Bool("inspect", false, "Inspector output: hex/ASCII/binary (and pulses for OOK) with diff against previous packet")
+	annotatePath := flag.String("annotate", "", "Annotation pipeline config (JSON); output is JSON lines with -raw")
+	driftMode := flag.String("drift", "off", "Follow a signal drifting towards the RX filter edge: widen, retune or off (FSK only)")
+	driftMaxBW := flag.Float64("drift-max-bw", 0, "Widest channel filter in Hz -drift widen may select before retuning (0 = widest)")
+	driftLog := flag.String("drift-log", "", "Write the recorded drift profile (JSON) to this file on exit")
+	recordPath := flag.String("record", "", "Record received packets to a capture file (format from the extension: .jsonl, .pcap, .sigmf-meta, ...)")
+	flag.Var(&format, "output", output.FlagUsage+" (json writes one object per line)")
 
 	flag.Parse()
+	out = format.Progress()
 
 	// Validate required arguments
 	if *mode == "" {
 		fmt.Fprintln(os.Stderr, "Error: Mode (-m) is required. Use 'send' or 'recv'")
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
-	if *configPath == "" {
+	if *configPath == "" && *replayPath == "" {
 		fmt.Fprintln(os.Stderr, "Error: Configuration file (-c) is required")
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
 	}
 
 	*mode = strings.ToLower(*mode)
 	if *mode != "send" && *mode != "recv" {
 		fmt.Fprintf(os.Stderr, "Error: Invalid mode '%s'. Use 'send' or 'recv'\n", *mode)
-		os.Exit(1)
+		os.Exit(exitcode.Usage)
+	}
+	if *replayPath != "" && *mode != "send" {
+		fmt.Fprintln(os.Stderr, "Error: -replay is only valid in send mode")
+		os.Exit(exitcode.Usage)
+	}
+	if *recordPath != "" && *mode != "recv" {
+		fmt.Fprintln(os.Stderr, "Error: -record is only valid in receive mode")
+		os.Exit(exitcode.Usage)
+	}
+	if format.IsJSON() && (*rawOutput || *inspectOutput) {
+		fmt.Fprintln(os.Stderr, "Error: -raw and -inspect have their own output; they cannot be combined with -output json")
+		os.Exit(exitcode.Usage)
 	}
 
-	// Load configuration
-	if *verbose {
-		fmt.Printf("Loading configuration from: %s\n", *configPath)
+	driftAction, err := rxstream.ParseDriftAction(*driftMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Usage)
+	}
+	if (driftAction != rxstream.DriftOff || *driftLog != "") && *mode != "recv" {
+		fmt.Fprintln(os.Stderr, "Error: -drift and -drift-log are only valid in receive mode")
+		os.Exit(exitcode.Usage)
+	}
+
+	var replay *capture.File
+	if *replayPath != "" {
+		replay, err = capture.Open(*replayPath, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		defer replay.Close()
 	}
 
-	configuration, err := config.LoadFromFile(*configPath)
+	// Load configuration, from the capture's register snapshot if no
+	// file was given for a replay
+	var configuration *config.DeviceConfig
+	if *configPath != "" {
+		if *verbose {
+			fmt.Fprintf(out, "Loading configuration from: %s\n", *configPath)
+		}
+		configuration, err = config.LoadFromFile(*configPath)
+	} else {
+		if *verbose {
+			fmt.Fprintf(out, "Using the configuration recorded in: %s\n", *replayPath)
+		}
+		configuration, err = captureConfig(capture.HeaderOf(replay))
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if *verbose {
-		fmt.Printf("Configuration loaded:\n")
-		fmt.Printf("  Frequency:    %.6f MHz\n", configuration.GetFrequencyMHz())
-		fmt.Printf("  Modulation:   %s\n", configuration.GetModulationString())
-		fmt.Printf("  Sync Word:    0x%04X\n", configuration.GetSyncWord())
-		fmt.Printf("  Packet Len:   %d\n", configuration.Registers.PKTLEN)
+		fmt.Fprintf(out, "Configuration loaded:\n")
+		fmt.Fprintf(out, "  Frequency:    %.6f MHz\n", configuration.GetFrequencyMHz())
+		fmt.Fprintf(out, "  Modulation:   %s\n", configuration.GetModulationString())
+		fmt.Fprintf(out, "  Sync Word:    0x%04X\n", configuration.GetSyncWord())
+		fmt.Fprintf(out, "  Packet Len:   %d\n", configuration.Registers.PKTLEN)
 	}
 
 	// Create USB context
@@ -98,27 +245,57 @@ func main() {
 	defer context.Close()
 
 	// Select device
-	device, err := yardstick.SelectDevice(context, yardstick.DeviceSelector(*deviceSel))
+	var device *yardstick.Device
+	if *reconnect {
+		monitor := yardstick.NewMonitor(context, yardstick.DeviceSelector(*deviceSel), 0)
+		monitor.Replay = config.Replay
+		monitor.OnDisconnect = func(d *yardstick.Device) {
+			fmt.Fprintf(os.Stderr, "Device %s disconnected, waiting for it to return...\n", d.Serial)
+		}
+		connects := 0
+		monitor.OnConnect = func(d *yardstick.Device, replayErr error) {
+			if connects++; connects == 1 {
+				return
+			}
+			if replayErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to reapply configuration: %v\n", replayErr)
+			}
+			// The amplifiers power up off like the radio
+			if err := d.EnableAmplifier(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to enable amplifiers: %v\n", err)
+			}
+			if *mode == "recv" {
+				d.SetModeRX()
+			}
+			fmt.Fprintf(os.Stderr, "Device %s reconnected (Bus %d, Addr %d)\n", d.Serial, d.Bus, d.Address)
+		}
+		device, err = monitor.Start()
+		if err == nil {
+			defer monitor.Stop()
+		}
+	} else {
+		device, err = yardstick.SelectDevice(context, yardstick.DeviceSelector(*deviceSel))
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	defer device.Close()
 
 	if *verbose {
-		fmt.Printf("Connected to: %s (Bus %d, Addr %d)\n", device.Serial, device.Bus, device.Address)
+		fmt.Fprintf(out, "Connected to: %s (Bus %d, Addr %d)\n", device.Serial, device.Bus, device.Address)
 	}
 
 	// Test connectivity
 	if err := device.Ping([]byte("TEST")); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Device ping failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Apply configuration
 	if *verbose {
-		fmt.Println("Applying radio configuration...")
-		fmt.Println("  Setting IDLE state...")
+		fmt.Fprintln(out, "Applying radio configuration...")
+		fmt.Fprintln(out, "  Setting IDLE state...")
 	}
 
 	// Force IDLE state first with direct strobe
@@ -128,23 +305,23 @@ func main() {
 	time.Sleep(50 * time.Millisecond)
 
 	if *verbose {
-		fmt.Println("  Writing registers...")
+		fmt.Fprintln(out, "  Writing registers...")
 	}
 
 	if err := config.ApplyToDevice(device, configuration); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to apply configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if *verbose {
-		fmt.Println("  Configuration applied.")
+		fmt.Fprintln(out, "  Configuration applied.")
 	}
 
 	// Enable YS1 front-end amplifiers for better TX power and RX sensitivity
-	if err := device.SetAmpMode(1); err != nil {
+	if err := device.EnableAmplifier(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to enable amplifiers: %v\n", err)
 	} else if *verbose {
-		fmt.Println("Amplifiers enabled")
+		fmt.Fprintln(out, "Amplifiers enabled")
 	}
 
 	// Verify configuration by reading back key registers
@@ -157,60 +334,234 @@ func main() {
 		freq1, _ := device.PeekByte(0xDF0A)
 		freq0, _ := device.PeekByte(0xDF0B)
 		pa0, _ := device.PeekByte(0xDF2E)
-		fmt.Printf("Verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
+		fmt.Fprintf(out, "Verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
 			sync1, sync0, pktlen, mdmcfg2, freq2, freq1, freq0, pa0)
 	}
 
+	// Enforce transmit limits at the device so every RFXmit is covered
+	if *maxRate > 0 || *dutyPct > 0 {
+		limiter, err := yardstick.NewTxLimiter(yardstick.TxLimitConfig{
+			PacketsPerSec: *maxRate,
+			DutyCycle:     *dutyPct / 100,
+			BitRate:       configuration.GetDataRateBaud(),
+			Block:         true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		device.SetTxLimiter(limiter)
+		if *verbose {
+			fmt.Fprintf(out, "Transmit limits: %.2f pkt/s, %.2f%% duty cycle\n", *maxRate, *dutyPct)
+		}
+
+		if *limitState != "" {
+			var st yardstick.TxLimiterState
+			if ok, err := checkpoint.Load(*limitState, &st); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to restore transmit budget: %v\n", err)
+			} else if ok {
+				limiter.Restore(st)
+			}
+			saver := checkpoint.NewSaver(*limitState, 0, func() interface{} {
+				return limiter.State()
+			}, func(err error) {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to save transmit budget: %v\n", err)
+			})
+			saver.Start()
+			// The error exits below go through checkpoint.Exit, which
+			// also stops the saver
+			defer func() {
+				if err := saver.Stop(); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Failed to save transmit budget: %v\n", err)
+				}
+			}()
+		}
+	}
+
 	// Run appropriate mode
 	switch *mode {
 	case "send":
-		runSendMode(device, *dataStr, *hexStr, uint16(*repeat), uint16(*offset), *numSends, *delayMs, *verbose)
+		if replay != nil {
+			if *dataStr+*hexStr+*base64Str+*patternStr+*templateStr != "" {
+				fmt.Fprintln(os.Stderr, "Error: -replay sends the capture; it cannot be combined with -data, -hex, -base64, -pattern or -template")
+				checkpoint.Exit(exitcode.Usage)
+			}
+			runReplayMode(device, replay, *speed, *verbose)
+			return
+		}
+		tmpl, err := sendTemplate(map[string]string{
+			"data":     *dataStr,
+			"hex":      *hexStr,
+			"base64":   *base64Str,
+			"pattern":  *patternStr,
+			"template": *templateStr,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			checkpoint.Exit(exitcode.Usage)
+		}
+		finish := payload.Options{CRC: *softCRC, Whiten: *whiten}
+		runSendMode(device, tmpl, finish, uint16(*repeat), uint16(*offset), *numSends, *delayMs, *verbose)
 	case "recv":
-		runRecvMode(device, *timeout, *count, *verbose, *rawOutput)
+		opts := &rxstream.Options{
+			SoftCRC:    *softCRC,
+			Dewhiten:   *dewhiten,
+			Manchester: *manchester,
+			Dedupe:     *dedupe,
+			BurstGap:   *burstGap,
+			SquelchMin: *squelch,
+		}
+		if driftAction != rxstream.DriftOff || *driftLog != "" {
+			opts.Drift = &rxstream.DriftOptions{Action: driftAction, MaxBWHz: *driftMaxBW}
+		}
+		var pipeline *annotate.Pipeline
+		if *annotatePath != "" {
+			pipeline, err = loadPipeline(*annotatePath, *rawOutput || format.IsJSON())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to load annotation pipeline: %v\n", err)
+				checkpoint.Exit(exitcode.Of(err))
+			}
+			defer pipeline.Close()
+		}
+		if *inspectOutput && pipeline == nil {
+			inspectOpts := inspect.DefaultOptions()
+			inspectOpts.ShowPulses = configuration.GetModulationString() == "ASK/OOK"
+			pipeline = annotate.NewPipeline()
+			pipeline.AddSink(inspect.NewSink(os.Stdout, inspectOpts))
+		}
+		var recorder capture.Writer
+		if *recordPath != "" {
+			recorder, err = startRecording(device, *recordPath, *configPath, configuration)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				checkpoint.Exit(exitcode.Of(err))
+			}
+		}
+		runRecvMode(device, *timeout, *count, *verbose, *rawOutput, opts, pipeline, recorder, *driftLog)
+		if recorder != nil {
+			if err := recorder.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to finish capture: %v\n", err)
+				checkpoint.Exit(exitcode.Failure)
+			}
+		}
+	}
+}
+
+// captureConfig rebuilds a configuration from the register snapshot in a
+// capture header
+func captureConfig(hdr *capture.Header) (*config.DeviceConfig, error) {
+	if hdr == nil || len(hdr.Registers) == 0 {
+		return nil, exitcode.Errorf(exitcode.Usage, "the capture has no register snapshot; give the configuration with -c")
+	}
+	cfg := &config.DeviceConfig{Timestamp: hdr.Created}
+	if hdr.Device != nil {
+		cfg.PartNum = hdr.Device.PartNum
+	}
+	if err := json.Unmarshal(hdr.Registers, &cfg.Registers); err != nil {
+		return nil, exitcode.Errorf(exitcode.ConfigInvalid, "invalid register snapshot in capture: %v", err)
+	}
+	return cfg, nil
+}
+
+// startRecording creates a capture file whose header records the radio
+// setup, including a register snapshot a later -replay can apply
+func startRecording(device *yardstick.Device, path, configPath string, configuration *config.DeviceConfig) (*capture.FileWriter, error) {
+	hdr := capture.NewHeader()
+	hdr.Profile = configPath
+	hdr.FrequencyHz = uint32(configuration.GetFrequencyMHz()*1e6 + 0.5)
+	hdr.DataRate = configuration.GetDataRateBaud()
+	hdr.Modulation = configuration.GetModulationString()
+	hdr.Tool = "send-recv"
+	build, _ := device.GetBuildType()
+	hdr.Device = &capture.DeviceInfo{
+		Serial:  device.Serial,
+		Product: device.Product,
+		Build:   build,
+		PartNum: configuration.PartNum,
+	}
+
+	regs, err := config.Current(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registers for the capture header: %w", err)
+	}
+	if hdr.Registers, err = json.Marshal(regs); err != nil {
+		return nil, err
 	}
+	return capture.Create(path, "", hdr)
 }
 
-func runSendMode(device *yardstick.Device, dataStr, hexStr string, repeat, offset uint16, numSends, delayMs int, verbose bool) {
-	// Determine data to send
-	var data []byte
+// sendTemplate builds the payload template from whichever data flag was
+// given; exactly one is required
+func sendTemplate(sources map[string]string) (*payload.Template, error) {
+	formats := map[string]string{
+		"data":    payload.FormatText,
+		"hex":     payload.FormatHex,
+		"base64":  payload.FormatBase64,
+		"pattern": payload.FormatPattern,
+	}
+
+	var tmpl *payload.Template
+	var set []string
+	for _, name := range []string{"data", "hex", "base64", "pattern", "template"} {
+		value := sources[name]
+		if value == "" {
+			continue
+		}
+		set = append(set, "-"+name)
 
-	if hexStr != "" {
-		var err error
-		data, err = hex.DecodeString(hexStr)
+		if name == "template" {
+			t, err := payload.ParseTemplate(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -template: %w", err)
+			}
+			tmpl = t
+			continue
+		}
+		data, err := payload.Parse(formats[name], value)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Invalid hex string: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("invalid -%s: %w", name, err)
 		}
-	} else if dataStr != "" {
-		data = []byte(dataStr)
-	} else {
-		fmt.Fprintln(os.Stderr, "Error: Must specify -data or -hex for send mode")
-		os.Exit(1)
+		tmpl = payload.Static(data)
 	}
 
+	switch {
+	case len(set) == 0:
+		return nil, fmt.Errorf("must specify -data, -hex, -base64, -pattern or -template for send mode")
+	case len(set) > 1:
+		return nil, fmt.Errorf("%s are mutually exclusive", strings.Join(set, ", "))
+	}
+	return tmpl, nil
+}
+
+// reconnectPoll is how often the send and receive loops retry while the
+// device is unplugged
+const reconnectPoll = 200 * time.Millisecond
+
+func runSendMode(device *yardstick.Device, tmpl *payload.Template, finish payload.Options, repeat, offset uint16, numSends, delayMs int, verbose bool) {
+	data := finish.Finish(tmpl.Build(0))
 	if len(data) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: No data to send")
-		os.Exit(1)
+		checkpoint.Exit(exitcode.Usage)
 	}
 
 	if verbose {
-		fmt.Printf("Transmitting %d bytes", len(data))
+		fmt.Fprintf(out, "Transmitting %d bytes", len(data))
 		if repeat > 0 {
-			fmt.Printf(" (hw repeat %d times, offset %d)", repeat, offset)
+			fmt.Fprintf(out, " (hw repeat %d times, offset %d)", repeat, offset)
 		}
 		if numSends != 1 {
 			if numSends == 0 {
-				fmt.Printf(" (infinite iterations")
+				fmt.Fprintf(out, " (infinite iterations")
 			} else {
-				fmt.Printf(" (%d iterations", numSends)
+				fmt.Fprintf(out, " (%d iterations", numSends)
 			}
 			if delayMs > 0 {
-				fmt.Printf(", %dms delay", delayMs)
+				fmt.Fprintf(out, ", %dms delay", delayMs)
 			}
-			fmt.Printf(")")
+			fmt.Fprintf(out, ")")
 		}
-		fmt.Println()
-		fmt.Printf("Data (hex): %s\n", hex.EncodeToString(data))
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Data (hex): %s\n", hex.EncodeToString(data))
 	}
 
 	// Set up signal handler for graceful shutdown
@@ -225,22 +576,36 @@ func runSendMode(device *yardstick.Device, dataStr, hexStr string, repeat, offse
 		// Check for shutdown signal (non-blocking)
 		select {
 		case <-sigChan:
-			fmt.Printf("\nStopped after %d transmissions\n", iteration)
+			fmt.Fprintf(out, "\nStopped after %d transmissions\n", iteration)
+			if format.IsJSON() {
+				output.WriteLine(&summaryRecord{Type: "summary", Mode: "send", Packets: iteration, Stopped: true})
+			}
 			return
 		default:
 		}
 
 		// Transmit data
+		if tmpl.HasCounter() {
+			data = finish.Finish(tmpl.Build(uint64(iteration)))
+		}
 		err := device.RFXmit(data, repeat, offset)
+		if errors.Is(err, yardstick.ErrDisconnected) {
+			// -reconnect: wait for the device to come back
+			time.Sleep(reconnectPoll)
+			continue
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Transmit failed: %v\n", err)
-			os.Exit(1)
+			checkpoint.Exit(exitcode.Of(err))
 		}
 
 		iteration++
+		if format.IsJSON() {
+			output.WriteLine(&sentRecord{Type: "sent", Time: time.Now(), Seq: iteration, Data: hex.EncodeToString(data)})
+		}
 
 		if verbose && (iteration%100 == 0 || numSends <= 10) {
-			fmt.Printf("Transmitted iteration %d\n", iteration)
+			fmt.Fprintf(out, "Transmitted iteration %d\n", iteration)
 		}
 
 		// Delay between iterations (if not the last one)
@@ -249,120 +614,358 @@ func runSendMode(device *yardstick.Device, dataStr, hexStr string, repeat, offse
 		}
 	}
 
-	fmt.Printf("Transmission complete (%d iterations)\n", iteration)
+	fmt.Fprintf(out, "Transmission complete (%d iterations)\n", iteration)
+	if format.IsJSON() {
+		output.WriteLine(&summaryRecord{Type: "summary", Mode: "send", Packets: iteration})
+	}
 }
 
-func runRecvMode(device *yardstick.Device, timeout time.Duration, count int, verbose, rawOutput bool) {
-	// Set up signal handler for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+func runRecvMode(device *yardstick.Device, timeout time.Duration, count int, verbose, rawOutput bool, opts *rxstream.Options, pipeline *annotate.Pipeline, recorder capture.Writer, driftLog string) {
+	// Ctrl+C cancels the receive in progress for a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Enter receive mode
 	if verbose {
-		fmt.Println("Entering receive mode...")
+		fmt.Fprintln(out, "Entering receive mode...")
 	}
 
 	if err := device.SetModeRX(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to enter RX mode: %v\n", err)
-		os.Exit(1)
+		checkpoint.Exit(exitcode.Of(err))
 	}
 
 	// Show initial radio status in verbose mode
 	if verbose {
 		status, err := device.GetRadioStatus()
 		if err == nil {
-			fmt.Printf("Initial radio state: MARCSTATE=0x%02X RSSI=%d dBm\n",
+			fmt.Fprintf(out, "Initial radio state: MARCSTATE=0x%02X RSSI=%d dBm\n",
 				status.MARCSTATE, status.RSSIdBm)
 		}
 	}
 
 	if !rawOutput {
-		fmt.Println("Listening for packets (Ctrl+C to stop)...")
-		fmt.Println()
+		fmt.Fprintln(out, "Listening for packets (Ctrl+C to stop)...")
+		fmt.Fprintln(out)
 	}
 
 	packetsReceived := 0
 	timeouts := 0
+	duplicates := 0
+	squelched := 0
 	startTime := time.Now()
 
-	// Use shorter internal timeout for more responsive signal handling
-	recvTimeout := 200 * time.Millisecond
-	if timeout < recvTimeout {
-		recvTimeout = timeout
+	var deduper *rxstream.Deduper
+	if opts.Dedupe > 0 {
+		deduper = rxstream.NewDeduper(opts.Dedupe)
+	}
+	timing := rxstream.NewTiming(opts.BurstGap)
+	noise := rxstream.NewNoiseStats("")
+	var drift *rxstream.Drift
+	if opts.Drift != nil {
+		drift = rxstream.NewDrift(device, opts.Drift)
+		if driftLog != "" {
+			defer writeDriftLog(drift, driftLog)
+		}
+	}
+
+	summary := func(stopped bool) {
+		if !format.IsJSON() {
+			return
+		}
+		r := noise.Report()
+		output.WriteLine(&summaryRecord{
+			Type:       "summary",
+			Mode:       "recv",
+			Packets:    packetsReceived,
+			Stopped:    stopped,
+			Timeouts:   timeouts,
+			Duplicates: duplicates,
+			Squelched:  squelched,
+			Noise:      &r,
+		})
 	}
 
 	for {
-		// Check for shutdown signal (non-blocking)
-		select {
-		case <-sigChan:
+		if ctx.Err() != nil {
+			summary(true)
 			if !rawOutput {
-				fmt.Printf("\n\nReceived %d packets, %d timeouts in %v\n",
+				fmt.Fprintf(out, "\n\nReceived %d packets, %d timeouts in %v\n",
 					packetsReceived, timeouts, time.Since(startTime).Round(time.Second))
+				if deduper != nil {
+					fmt.Fprintf(out, "Dropped %d repeated frames\n", duplicates)
+				}
+				if opts.SquelchEnabled() {
+					fmt.Fprintf(out, "Squelched %d packets below %d dBm\n", squelched, opts.SquelchMin)
+				}
+				r := noise.Report()
+				fmt.Fprintf(out, "Noise: %d of %d frames rejected (%d CRC, %d no match, %d squelch), %.1f/min\n",
+					r.Total-r.Good, r.Total, r.CRCFail, r.NoMatch, r.Squelched, r.FalsePerMinute)
+				if drift != nil {
+					if p := drift.Profile(); len(p.Samples) > 0 {
+						fmt.Fprintf(out, "Drift: signal %.6f-%.6f MHz, %+.0f Hz/min, %d adjustments\n",
+							p.MinHz/1e6, p.MaxHz/1e6, p.RateHzPerMin, len(p.Events))
+					}
+				}
 			}
 			return
-		default:
 		}
 
-		// Try to receive a packet with short timeout for responsive Ctrl+C
-		data, err := device.RFRecv(recvTimeout, 0)
+		recvCtx, cancel := context.WithTimeout(ctx, timeout)
+		data, err := device.RFRecvCtx(recvCtx, 0)
+		cancel()
 		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			if errors.Is(err, yardstick.ErrDisconnected) {
+				// -reconnect: wait for the device to come back
+				time.Sleep(reconnectPoll)
+				continue
+			}
 			// Timeout is normal, continue
 			timeouts++
 			if verbose && timeouts%5 == 0 {
-				// Periodic status update every 5 timeouts (1 second)
+				// Periodic status update every 5 timeouts
 				status, serr := device.GetRadioStatus()
 				if serr == nil {
-					fmt.Printf("  [waiting] timeouts=%d MARCSTATE=0x%02X RSSI=%d dBm PKTSTATUS=0x%02X\n",
+					fmt.Fprintf(out, "  [waiting] timeouts=%d MARCSTATE=0x%02X RSSI=%d dBm PKTSTATUS=0x%02X\n",
 						timeouts, status.MARCSTATE, status.RSSIdBm, status.PKTSTATUS)
 				}
 			}
 			continue
 		}
 
-		packetsReceived++
 		timestamp := time.Now()
 
 		// Get radio status immediately after receiving
 		status, _ := device.GetRadioStatus()
 
-		if rawOutput {
+		// Apply software processing stages (no-op if none enabled)
+		pkt := rxstream.Process(data, opts)
+		data = pkt.Processed
+		pkt.Timestamp = timestamp
+		noise.Received(pkt)
+		if !pkt.ReadStatus(device.PacketFormat()) && status != nil {
+			pkt.RSSI = status.RSSIdBm
+			pkt.RSSIValid = true
+		}
+		if drift != nil {
+			if err := drift.Observe(pkt); err != nil && verbose {
+				fmt.Fprintf(os.Stderr, "Warning: drift: %v\n", err)
+			}
+		}
+		if !opts.PassSquelch(pkt) {
+			squelched++
+			noise.Squelched(pkt)
+			continue
+		}
+
+		if deduper != nil && deduper.Duplicate(data, timestamp) {
+			duplicates++
+			continue
+		}
+		timing.Mark(pkt)
+		packetsReceived++
+
+		if recorder != nil {
+			// Record the bytes as received so a replay reproduces them exactly
+			rec := &capture.Packet{Timestamp: timestamp, Data: pkt.Raw}
+			rec.Frequency, _ = device.CurrentFrequency()
+			if pkt.RSSIValid {
+				rec.RSSI = pkt.RSSI
+			}
+			if status != nil {
+				rec.LQI = status.LQI
+			}
+			if err := recorder.Write(rec); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to record packet: %v\n", err)
+			}
+		}
+
+		if pipeline != nil {
+			// Pipeline sinks own the output format
+			if ok, err := pipeline.Process(annotate.NewRecord(pkt)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			} else if !ok {
+				noise.NoMatch(pkt)
+			}
+		} else if format.IsJSON() {
+			output.WriteLine(newPacketRecord(pkt, status, packetsReceived))
+		} else if rawOutput {
 			// Raw hex output for piping
-			fmt.Println(hex.EncodeToString(data))
+			fmt.Fprintln(out, hex.EncodeToString(data))
 		} else {
 			// Formatted output with radio diagnostics
-			fmt.Printf("[%s] Packet #%d (%d bytes):\n",
+			fmt.Fprintf(out, "[%s] Packet #%d (%d bytes):\n",
 				timestamp.Format("15:04:05.000"),
 				packetsReceived,
 				len(data))
+			if pkt.Delta > 0 {
+				fmt.Fprintf(out, "  Delta: %v, burst %d #%d\n",
+					pkt.Delta.Round(time.Microsecond), pkt.Burst, pkt.BurstIndex)
+			}
 
 			if status != nil {
 				crcStr := "NO"
 				if status.CRCOk {
 					crcStr = "OK"
 				}
-				fmt.Printf("  RSSI: %d dBm, LQI: %d, CRC: %s, PKTSTATUS: 0x%02X\n",
-					status.RSSIdBm, status.LQI, crcStr, status.PKTSTATUS)
+				fmt.Fprintf(out, "  RSSI: %d dBm, LQI: %d, CRC: %s, PKTSTATUS: 0x%02X\n",
+					pkt.RSSI, status.LQI, crcStr, status.PKTSTATUS)
+			}
+			if pkt.FreqOffsetValid {
+				fmt.Fprintf(out, "  Freq offset: %+.0f Hz\n", pkt.FreqOffsetHz)
+			}
+
+			if opts.Enabled() {
+				fmt.Fprintf(out, "  Raw: %s\n", hex.EncodeToString(pkt.Raw))
+				if pkt.CRCChecked {
+					softStr := "BAD"
+					if pkt.CRCOk {
+						softStr = "OK"
+					}
+					fmt.Fprintf(out, "  Soft CRC: %s\n", softStr)
+				}
+				if pkt.ManchesterErrors > 0 {
+					fmt.Fprintf(out, "  Manchester errors: %d\n", pkt.ManchesterErrors)
+				}
 			}
 
-			fmt.Printf("  Hex: %s\n", hex.EncodeToString(data))
+			fmt.Fprintf(out, "  Hex: %s\n", hex.EncodeToString(data))
 			if len(data) <= 64 {
-				fmt.Printf("  ASCII: %s\n", makePrintable(data))
+				fmt.Fprintf(out, "  ASCII: %s\n", makePrintable(data))
 			} else {
-				fmt.Printf("  ASCII: %s... (truncated)\n", makePrintable(data[:64]))
+				fmt.Fprintf(out, "  ASCII: %s... (truncated)\n", makePrintable(data[:64]))
 			}
-			fmt.Println()
+			fmt.Fprintln(out)
 		}
 
 		// Check packet count limit
 		if count > 0 && packetsReceived >= count {
+			summary(false)
 			if !rawOutput {
-				fmt.Printf("Received requested %d packets\n", count)
+				fmt.Fprintf(out, "Received requested %d packets\n", count)
 			}
 			return
 		}
 	}
 }
 
+// newPacketRecord describes a received packet for -output json
+func newPacketRecord(pkt *rxstream.Packet, status *yardstick.RadioStatus, seq int) *packetRecord {
+	rec := &packetRecord{
+		Type:             "packet",
+		Time:             pkt.Timestamp,
+		Seq:              seq,
+		Data:             hex.EncodeToString(pkt.Processed),
+		ManchesterErrors: pkt.ManchesterErrors,
+		Delta:            int64(pkt.Delta),
+		Burst:            pkt.Burst,
+		BurstIndex:       pkt.BurstIndex,
+	}
+	if raw := hex.EncodeToString(pkt.Raw); raw != rec.Data {
+		rec.Raw = raw
+	}
+	if pkt.RSSIValid {
+		rec.RSSI = &pkt.RSSI
+	}
+	if status != nil {
+		rec.LQI, rec.CRCOk = &status.LQI, &status.CRCOk
+	}
+	if pkt.CRCChecked {
+		rec.SoftCRCOk = &pkt.CRCOk
+	}
+	if pkt.FreqOffsetValid {
+		rec.FreqOffsetHz = &pkt.FreqOffsetHz
+	}
+	return rec
+}
+
+// runReplayMode transmits the packets of a capture, spaced as they were
+// received (scaled by speed), retuning for packets recorded on another
+// frequency
+func runReplayMode(device *yardstick.Device, in capture.Reader, speed float64, verbose bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sent := 0
+	err := capture.Play(ctx, in, speed, func(p *capture.Packet) error {
+		if p.Frequency != 0 {
+			if err := retune(device, p.Frequency); err != nil {
+				return err
+			}
+		}
+		for {
+			err := device.RFXmitCtx(ctx, p.Data, 0, 0)
+			if errors.Is(err, yardstick.ErrDisconnected) {
+				// -reconnect: wait for the device to come back
+				time.Sleep(reconnectPoll)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("transmit failed: %w", err)
+			}
+			break
+		}
+		sent++
+		if format.IsJSON() {
+			output.WriteLine(&sentRecord{Type: "sent", Time: time.Now(), Seq: sent, Data: hex.EncodeToString(p.Data)})
+		}
+		if verbose {
+			fmt.Fprintf(out, "[%s] Sent packet #%d (%d bytes): %s\n",
+				time.Now().Format("15:04:05.000"), sent, len(p.Data), hex.EncodeToString(p.Data))
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		fmt.Fprintf(out, "\nStopped after %d packets\n", sent)
+		if format.IsJSON() {
+			output.WriteLine(&summaryRecord{Type: "summary", Mode: "replay", Packets: sent, Stopped: true})
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Replay failed after %d packets: %v\n", sent, err)
+		checkpoint.Exit(exitcode.Of(err))
+	}
+	fmt.Fprintf(out, "Replay complete (%d packets)\n", sent)
+	if format.IsJSON() {
+		output.WriteLine(&summaryRecord{Type: "summary", Mode: "replay", Packets: sent})
+	}
+}
+
+// retune sets the frequency unless the radio is already within one
+// synthesizer step of it
+func retune(device *yardstick.Device, hz uint32) error {
+	step := device.CrystalHz() / 65536
+	if current, ok := device.CurrentFrequency(); ok && current+step >= hz && hz+step >= current {
+		return nil
+	}
+	if err := device.SetFrequency(hz); err != nil {
+		return fmt.Errorf("failed to tune to %d Hz: %w", hz, err)
+	}
+	return nil
+}
+
+// loadPipeline builds an annotation pipeline writing to stdout
+func loadPipeline(path string, jsonOutput bool) (*annotate.Pipeline, error) {
+	cfg, err := annotate.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := annotate.Build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if jsonOutput {
+		pipeline.AddSink(annotate.NewJSONSink(os.Stdout))
+	} else {
+		pipeline.AddSink(annotate.NewTextSink(os.Stdout))
+	}
+	return pipeline, nil
+}
+
 // makePrintable converts bytes to a printable string, replacing non-printable characters
 func makePrintable(data []byte) string {
 	result := make([]byte, len(data))
@@ -375,3 +978,14 @@ func makePrintable(data []byte) string {
 	}
 	return string(result)
 }
+
+// writeDriftLog saves the drift profile recorded during a receive session
+func writeDriftLog(drift *rxstream.Drift, path string) {
+	data, err := json.MarshalIndent(drift.Profile(), "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write drift log: %v\n", err)
+	}
+}
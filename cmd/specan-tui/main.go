@@ -0,0 +1,367 @@
+// specan-tui: Live spectrum analyzer in the terminal
+//
+// Drives the firmware spectrum analyzer (pkg/specan) and draws each sweep,
+// or their average, as a bar graph with optional peak and min holds,
+// above a scrolling waterfall of past sweeps. The status line shows the
+// strongest channel and how often it was above -threshold. The keyboard retunes the sweep while it runs:
+//
+//	Left/Right   move the center frequency by a tenth of the span
+//	Up/Down      halve/double the span (also + and -)
+//	[ ]          fewer/more channels
+//	a            toggle the averaged trace (pkg/specan.Accumulator)
+//	p m          toggle peak/min hold  c  clear the holds and average
+//	w            mark or unmark the center frequency in the session
+//	Space        pause the display     q  quit
+//
+// The device, center frequency, seed profile and marked frequencies are
+// kept in a session (pkg/sessionstate), shared with 'gocat repl', so
+// starting the same session again without -center resumes the last
+// sweep. Marked frequencies in the span are flagged on the axis.
+//
+// There is no -output json: the screen is the output. 'rf-scanner
+// -output json' reports sweeps for scripts.
+//
+// Examples:
+//
+//	# 433 MHz ISM band
+//	./specan-tui -center 433.92 -bw 2
+//
+//	# Wider, finer sweep with a profile's filter and AGC, peak hold on
+//	./specan-tui -center 433.92 -bw 4 -chans 255 -profile etc/433-tx.json -peak
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/sessionstate"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Limits of the keyboard controls
+const (
+	minSpanHz = 50000
+	maxSpanHz = 100000000
+)
+
+// chanSteps are the channel counts [ and ] step through
+var chanSteps = []int{25, 50, 100, 150, 200, 255}
+
+func main() {
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	centerMHz := flag.Float64("center", 433.92, "Center frequency in MHz")
+	bwMHz := flag.Float64("bw", 2.0, "Span in MHz")
+	chans := flag.Int("chans", 100, "Number of channels (1-255)")
+	configPath := flag.String("c", "", "Device configuration (JSON) to seed scan settings from")
+	profilePath := flag.String("profile", "", "Profile configuration (JSON) to seed scan settings from")
+	vmin := flag.Float64("vmin", -100, "Bottom of the RSSI scale (dBm)")
+	vmax := flag.Float64("vmax", -30, "Top of the RSSI scale (dBm)")
+	threshold := flag.Float64("threshold", -70, "RSSI in dBm at which a channel counts as busy")
+	peakHold := flag.Bool("peak", false, "Start with peak hold on")
+	average := flag.Bool("avg", false, "Start with the averaged trace")
+	sessionName := flag.String("session", "", "Session to resume and keep saved (default: the -profile or -c path, else \""+sessionstate.DefaultName+"\")")
+	noSession := flag.Bool("no-session", false, "Don't resume or save a session")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Live spectrum analyzer in the terminal\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nKeys: Left/Right center, Up/Down span, [ ] channels, a average, p peak hold, m min hold, c clear, w mark, Space pause, q quit\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -center 433.92 -bw 2\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -center 868.3 -bw 1 -chans 200 -peak\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if *chans < 1 || *chans > 255 {
+		fmt.Fprintf(os.Stderr, "Error: -chans must be 1-255\n")
+		os.Exit(exitcode.Usage)
+	}
+	if *vmax <= *vmin {
+		fmt.Fprintf(os.Stderr, "Error: -vmax must be above -vmin\n")
+		os.Exit(exitcode.Usage)
+	}
+	base, err := loadBase(*configPath, *profilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.ConfigInvalid)
+	}
+
+	seed := *configPath
+	if seed == "" {
+		seed = *profilePath
+	}
+	var session *sessionstate.State
+	if !*noSession {
+		name := *sessionName
+		if name == "" {
+			name = seed
+		}
+		if name == "" {
+			name = sessionstate.DefaultName
+		}
+		if session, err = sessionstate.Load(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Failure)
+		}
+		if *deviceSel == "" {
+			*deviceSel = session.Device
+		}
+		centerSet := false
+		flag.Visit(func(f *flag.Flag) { centerSet = centerSet || f.Name == "center" })
+		if !centerSet && session.FrequencyHz != 0 {
+			*centerMHz = float64(session.FrequencyHz) / 1e6
+		}
+		if seed != "" {
+			session.Profile = seed
+		} else if session.Profile != "" {
+			if base, err = sessionBase(session.Profile); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: not restoring the session's profile: %v\n", err)
+			}
+		}
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	sa := specan.New(device)
+	cfg := &specan.Config{
+		CenterFreq: uint32(*centerMHz * 1e6),
+		Bandwidth:  uint32(*bwMHz * 1e6),
+		NumChans:   uint8(*chans),
+		Base:       base,
+	}
+	if err := restart(sa, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	// The base settings stay in the radio across retunes
+	cfg.Base = nil
+
+	screen, err := tcell.NewScreen()
+	if err == nil {
+		err = screen.Init()
+	}
+	if err != nil {
+		sa.Stop()
+		fmt.Fprintf(os.Stderr, "Error: Failed to open terminal: %v\n", err)
+		os.Exit(exitcode.Failure)
+	}
+
+	v := newView(screen, float32(*vmin), float32(*vmax), float32(*threshold))
+	v.peakOn, v.average = *peakHold, *average
+	v.device = device.String()
+	if session != nil {
+		session.Device = device.Serial
+		v.session = session
+	}
+	err = run(sa, cfg, v)
+	screen.Fini()
+	sa.Stop()
+	if serr := v.save(); serr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", serr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+// run draws sweeps and handles keys until the user quits
+func run(sa *specan.SpecAn, cfg *specan.Config, v *view) error {
+	events := make(chan tcell.Event, 16)
+	go func() {
+		for {
+			ev := v.screen.PollEvent()
+			if ev == nil {
+				return
+			}
+			events <- ev
+		}
+	}()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	v.cfg = *cfg
+	v.draw()
+	for {
+		select {
+		case <-sigChan:
+			return nil
+
+		case frame, ok := <-sa.Frames():
+			if !ok {
+				return fmt.Errorf("spectrum analyzer stopped")
+			}
+			v.add(frame)
+			v.draw()
+
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				v.screen.Sync()
+				v.draw()
+			case *tcell.EventKey:
+				quit, retune := v.key(ev, cfg)
+				if quit {
+					return nil
+				}
+				if retune {
+					if err := restart(sa, cfg); err != nil {
+						return err
+					}
+					v.cfg = *cfg
+					v.reset()
+					// Errors show on exit, when the session is saved again
+					v.save()
+				}
+				v.draw()
+			}
+		}
+	}
+}
+
+// key applies a keypress to cfg or the view; retune is true when cfg
+// changed and the sweep must restart
+func (v *view) key(ev *tcell.EventKey, cfg *specan.Config) (quit, retune bool) {
+	span := cfg.Bandwidth
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		return true, false
+	case tcell.KeyLeft:
+		if cfg.CenterFreq-span/2 > span/10 {
+			cfg.CenterFreq -= span / 10
+			return false, true
+		}
+	case tcell.KeyRight:
+		cfg.CenterFreq += span / 10
+		return false, true
+	case tcell.KeyUp:
+		return false, setSpan(cfg, span/2)
+	case tcell.KeyDown:
+		return false, setSpan(cfg, span*2)
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q', 'Q':
+			return true, false
+		case '+', '=':
+			return false, setSpan(cfg, span/2)
+		case '-', '_':
+			return false, setSpan(cfg, span*2)
+		case '[':
+			return false, stepChans(cfg, -1)
+		case ']':
+			return false, stepChans(cfg, 1)
+		case 'a', 'A':
+			v.average = !v.average
+		case 'p', 'P':
+			v.peakOn = !v.peakOn
+		case 'm', 'M':
+			v.minOn = !v.minOn
+		case 'c', 'C':
+			v.acc.Reset()
+		case 'w', 'W':
+			if v.session != nil && !v.session.Unwatch(cfg.CenterFreq) {
+				v.session.Watch(cfg.CenterFreq, "")
+			}
+		case ' ':
+			v.paused = !v.paused
+		}
+	}
+	return false, false
+}
+
+// setSpan sets the span within its limits, keeping the center
+func setSpan(cfg *specan.Config, spanHz uint32) bool {
+	spanHz = max(minSpanHz, min(maxSpanHz, spanHz))
+	if spanHz == cfg.Bandwidth || spanHz/2 >= cfg.CenterFreq {
+		return false
+	}
+	cfg.Bandwidth = spanHz
+	return true
+}
+
+// stepChans moves to the next channel count up or down
+func stepChans(cfg *specan.Config, dir int) bool {
+	n := int(cfg.NumChans)
+	for i := range chanSteps {
+		step := chanSteps[i]
+		if dir < 0 {
+			step = chanSteps[len(chanSteps)-1-i]
+		}
+		if (dir > 0 && step > n) || (dir < 0 && step < n) {
+			cfg.NumChans = uint8(step)
+			return true
+		}
+	}
+	return false
+}
+
+// restart stops the sweep if it is running and starts it with cfg
+func restart(sa *specan.SpecAn, cfg *specan.Config) error {
+	if err := sa.Stop(); err != nil {
+		return err
+	}
+	if err := sa.Configure(cfg); err != nil {
+		return fmt.Errorf("configure failed: %w", err)
+	}
+	if err := sa.Start(); err != nil {
+		return fmt.Errorf("start failed: %w", err)
+	}
+	return nil
+}
+
+// loadBase reads the optional register set the scan is seeded from
+func loadBase(configPath, profilePath string) (*registers.RegisterMap, error) {
+	switch {
+	case configPath != "" && profilePath != "":
+		return nil, fmt.Errorf("-c and -profile are mutually exclusive")
+	case configPath != "":
+		c, err := config.LoadFromFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		return &c.Registers, nil
+	case profilePath != "":
+		p, err := profiles.LoadProfileFromFile(profilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load profile: %w", err)
+		}
+		return &p.Registers, nil
+	}
+	return nil, nil
+}
+
+// sessionBase reads the register set a session was seeded from: a
+// built-in profile, as 'gocat repl' records, a profile file or a
+// configuration
+func sessionBase(name string) (*registers.RegisterMap, error) {
+	if p := profiles.Find(name); p != nil {
+		return p.ToRegisters(), nil
+	}
+	if p, err := profiles.LoadProfileFromFile(name); err == nil {
+		return &p.Registers, nil
+	}
+	c, err := config.LoadFromFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a built-in profile, profile file or configuration: %w", name, err)
+	}
+	return &c.Registers, nil
+}
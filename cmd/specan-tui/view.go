@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/herlein/gocat/pkg/sessionstate"
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// bars are the eighth blocks a bar's top is drawn with
+var bars = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// view is the screen: a status line, the bar graph, a frequency axis,
+// the waterfall and a key help line
+type view struct {
+	screen     tcell.Screen
+	vmin, vmax float32
+	device     string
+	session    *sessionstate.State // Holds the marks; nil without a session
+
+	cfg     specan.Config
+	acc     *specan.Accumulator
+	history []*specan.Frame // Newest first, as many as the waterfall shows
+	peakOn  bool
+	minOn   bool
+	average bool // Bars show the average rather than the latest sweep
+	paused  bool
+
+	rate float64 // Sweeps per second
+	last time.Time
+}
+
+func newView(screen tcell.Screen, vmin, vmax, threshold float32) *view {
+	return &view{screen: screen, vmin: vmin, vmax: vmax, acc: specan.NewAccumulator(threshold)}
+}
+
+// add records a sweep
+func (v *view) add(frame *specan.Frame) {
+	if !v.last.IsZero() {
+		if dt := frame.Timestamp.Sub(v.last).Seconds(); dt > 0 {
+			// Smoothed so the display doesn't flicker
+			v.rate = 0.9*v.rate + 0.1/dt
+		}
+	}
+	v.last = frame.Timestamp
+	if v.paused {
+		return
+	}
+	v.acc.Add(frame)
+	_, h := v.screen.Size()
+	v.history = append([]*specan.Frame{frame}, v.history...)
+	if len(v.history) > h {
+		v.history = v.history[:h]
+	}
+}
+
+// reset forgets sweeps from before a retune
+func (v *view) reset() {
+	v.acc.Reset()
+	v.history = nil
+	v.last, v.rate = time.Time{}, 0
+}
+
+// level maps RSSI to 0-1 on the scale
+func (v *view) level(rssi float32) float32 {
+	return max(0, min(1, (rssi-v.vmin)/(v.vmax-v.vmin)))
+}
+
+// color is the waterfall color of an RSSI: blue through cyan, green and
+// yellow to red
+func (v *view) color(rssi float32) tcell.Color {
+	t := v.level(rssi)
+	stops := [][3]float32{{0, 0, 40}, {0, 0, 255}, {0, 255, 255}, {0, 255, 0}, {255, 255, 0}, {255, 0, 0}}
+	pos := t * float32(len(stops)-1)
+	i := min(int(pos), len(stops)-2)
+	f := pos - float32(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(k int) int32 { return int32(a[k] + (b[k]-a[k])*f) }
+	return tcell.NewRGBColor(mix(0), mix(1), mix(2))
+}
+
+// column returns the highest RSSI of the channels column x of width w
+// covers, so narrow signals stay visible when channels outnumber columns
+func column(rssi []float32, x, w int) float32 {
+	n := len(rssi)
+	lo := x * n / w
+	hi := max(lo+1, (x+1)*n/w)
+	best := rssi[lo]
+	for _, r := range rssi[lo:min(hi, n)] {
+		best = max(best, r)
+	}
+	return best
+}
+
+func (v *view) draw() {
+	s := v.screen
+	s.Clear()
+	w, h := s.Size()
+	if w < 20 || h < 8 {
+		v.text(0, 0, tcell.StyleDefault, "Terminal too small")
+		s.Show()
+		return
+	}
+
+	// Bar graph gets about 40% of the rows between the status and help
+	// lines, the waterfall the rest
+	graphH := max(3, (h-3)*2/5)
+	axisY := 1 + graphH
+	waterY := axisY + 1
+	waterH := h - 1 - waterY
+
+	v.status()
+	if v.acc.Last() != nil {
+		v.graph(w, graphH)
+	}
+	v.axis(axisY, w)
+	for y := 0; y < waterH && y < len(v.history); y++ {
+		f := v.history[y]
+		for x := 0; x < w; x++ {
+			s.SetContent(x, waterY+y, ' ', nil, tcell.StyleDefault.Background(v.color(column(f.RSSI, x, w))))
+		}
+	}
+
+	help := "←/→ center  ↑/↓ span  [ ] chans  a average  p peak  m min  c clear  w mark  space pause  q quit"
+	v.text(0, h-1, tcell.StyleDefault.Reverse(true), fmt.Sprintf("%-*s", w, help))
+	s.Show()
+}
+
+// status draws the settings and the strongest channel
+func (v *view) status() {
+	c := v.cfg
+	line := fmt.Sprintf("%s  center %.3f MHz  span %.3f MHz  %d ch (%.1f kHz)  %.1f sweeps/s",
+		v.device, float64(c.CenterFreq)/1e6, float64(c.Bandwidth)/1e6, c.NumChans,
+		float64(c.Bandwidth)/float64(c.NumChans)/1e3, v.rate)
+	if f := v.trace(); f != nil {
+		i, freq, rssi := specan.MaxRSSI(f)
+		line += fmt.Sprintf("  max %.3f MHz %.1f dBm, %.0f%% busy", float64(freq)/1e6, rssi, v.acc.Occupancy()[i])
+	}
+	if v.average {
+		line += "  [AVG]"
+	}
+	if v.peakOn {
+		line += "  [PEAK]"
+	}
+	if v.minOn {
+		line += "  [MIN]"
+	}
+	if v.paused {
+		line += "  [PAUSED]"
+	}
+	v.text(0, 0, tcell.StyleDefault.Bold(true), line)
+}
+
+// trace is the sweep the bars show
+func (v *view) trace() *specan.Frame {
+	if v.average {
+		return v.acc.Average()
+	}
+	return v.acc.Last()
+}
+
+// graph draws one bar per column with the holds as markers
+func (v *view) graph(w, graphH int) {
+	barStyle := tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	trace := v.trace()
+	var peak, low *specan.Frame
+	if v.peakOn {
+		peak = v.acc.Peak()
+	}
+	if v.minOn {
+		low = v.acc.Min()
+	}
+	for x := 0; x < w; x++ {
+		eighths := int(v.level(column(trace.RSSI, x, w)) * float32(graphH*8))
+		for row := 0; row < graphH; row++ {
+			// row 0 is the bottom of the graph
+			n := min(8, max(0, eighths-row*8))
+			if n > 0 {
+				v.screen.SetContent(x, graphH-row, bars[n], nil, barStyle)
+			}
+		}
+		v.marker(x, graphH, low, w, tcell.ColorBlue)
+		v.marker(x, graphH, peak, w, tcell.ColorRed)
+	}
+	v.text(0, 1, tcell.StyleDefault.Dim(true), fmt.Sprintf("%.0f dBm", v.vmax))
+	v.text(0, graphH, tcell.StyleDefault.Dim(true), fmt.Sprintf("%.0f dBm", v.vmin))
+}
+
+// marker draws a hold's level in column x
+func (v *view) marker(x, graphH int, hold *specan.Frame, w int, color tcell.Color) {
+	if hold == nil {
+		return
+	}
+	top := int(v.level(column(hold.RSSI, x, w)) * float32(graphH))
+	if top > 0 {
+		v.screen.SetContent(x, graphH-min(top, graphH)+1, '▔', nil, tcell.StyleDefault.Foreground(color))
+	}
+}
+
+// axis labels the edges and center of the span
+func (v *view) axis(y, w int) {
+	c := v.cfg
+	low := float64(c.CenterFreq-c.Bandwidth/2) / 1e6
+	high := float64(c.CenterFreq+c.Bandwidth/2) / 1e6
+	style := tcell.StyleDefault.Dim(true)
+	for x := 0; x < w; x++ {
+		v.screen.SetContent(x, y, '─', nil, style)
+	}
+	left := fmt.Sprintf("%.3f", low)
+	mid := fmt.Sprintf("%.3f MHz", float64(c.CenterFreq)/1e6)
+	right := fmt.Sprintf("%.3f", high)
+	v.text(0, y, style, left)
+	v.text((w-len(mid))/2, y, style, mid)
+	v.text(w-len(right), y, style, right)
+
+	if v.session == nil {
+		return
+	}
+	lowHz := c.CenterFreq - c.Bandwidth/2
+	for _, m := range v.session.Watchlist {
+		if m.FrequencyHz < lowHz || m.FrequencyHz >= lowHz+c.Bandwidth {
+			continue
+		}
+		x := int(uint64(m.FrequencyHz-lowHz) * uint64(w) / uint64(c.Bandwidth))
+		v.screen.SetContent(x, y, '▼', nil, tcell.StyleDefault.Foreground(tcell.ColorYellow))
+	}
+}
+
+// save records the sweep's center frequency in the session and saves it
+func (v *view) save() error {
+	if v.session == nil {
+		return nil
+	}
+	v.session.FrequencyHz = v.cfg.CenterFreq
+	return v.session.Save()
+}
+
+func (v *view) text(x, y int, style tcell.Style, s string) {
+	for _, r := range s {
+		v.screen.SetContent(x, y, r, nil, style)
+		x++
+	}
+}
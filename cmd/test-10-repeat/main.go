@@ -12,6 +12,7 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"sync"
@@ -20,21 +21,32 @@ import (
 
 	"github.com/google/gousb"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
 type TestResult struct {
-	Delay        time.Duration
-	Sent         int
-	Received     int
-	Matched      int
-	Mismatched   int
-	SuccessRate  float64
-	AvgRSSI      int
-	MinRSSI      int
-	MaxRSSI      int
-	AvgLatency   time.Duration
-	RecvTimeouts int
+	Delay        time.Duration `json:"delay_ns"`
+	Sent         int           `json:"sent"`
+	Received     int           `json:"received"`
+	Matched      int           `json:"matched"`
+	Mismatched   int           `json:"mismatched"`
+	SuccessRate  float64       `json:"success_rate"` // Percent of sent packets matched
+	AvgRSSI      int           `json:"avg_rssi_dbm"`
+	MinRSSI      int           `json:"min_rssi_dbm"`
+	MaxRSSI      int           `json:"max_rssi_dbm"`
+	AvgLatency   time.Duration `json:"avg_latency_ns"`
+	RecvTimeouts int           `json:"recv_timeouts"`
+}
+
+// report is the -output json result
+type report struct {
+	Config   string       `json:"config"`
+	Sender   string       `json:"sender"`
+	Receiver string       `json:"receiver"`
+	Runs     []TestResult `json:"runs"`
+	Verdict  string       `json:"verdict"` // pass, partial or fail, judged on the slowest run
 }
 
 func main() {
@@ -43,22 +55,25 @@ func main() {
 	initialDelay := flag.Duration("delay", 1*time.Second, "Initial delay between packets")
 	minDelay := flag.Duration("min-delay", 10*time.Millisecond, "Minimum delay between packets")
 	verbose := flag.Bool("v", false, "Verbose output")
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage)
 	flag.Parse()
+	out := format.Progress()
 
 	// Load configuration
-	fmt.Printf("Loading configuration from: %s\n", *configPath)
+	fmt.Fprintf(out, "Loading configuration from: %s\n", *configPath)
 	configuration, err := config.LoadFromFile(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	fmt.Printf("Configuration:\n")
-	fmt.Printf("  Frequency:  %.6f MHz\n", configuration.GetFrequencyMHz())
-	fmt.Printf("  Modulation: %s\n", configuration.GetModulationString())
-	fmt.Printf("  Sync Word:  0x%04X\n", configuration.GetSyncWord())
-	fmt.Printf("  Packet Len: %d\n", configuration.Registers.PKTLEN)
-	fmt.Println()
+	fmt.Fprintf(out, "Configuration:\n")
+	fmt.Fprintf(out, "  Frequency:  %.6f MHz\n", configuration.GetFrequencyMHz())
+	fmt.Fprintf(out, "  Modulation: %s\n", configuration.GetModulationString())
+	fmt.Fprintf(out, "  Sync Word:  0x%04X\n", configuration.GetSyncWord())
+	fmt.Fprintf(out, "  Packet Len: %d\n", configuration.Registers.PKTLEN)
+	fmt.Fprintln(out)
 
 	// Create USB context
 	ctx := gousb.NewContext()
@@ -68,7 +83,7 @@ func main() {
 	devices, err := yardstick.FindAllDevices(ctx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to find devices: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if len(devices) < 2 {
@@ -76,7 +91,7 @@ func main() {
 		for _, d := range devices {
 			d.Close()
 		}
-		os.Exit(1)
+		os.Exit(exitcode.DeviceNotFound)
 	}
 
 	// Sort by bus:address to get consistent assignment
@@ -95,77 +110,77 @@ func main() {
 	sender := devices[0]
 	receiver := devices[1]
 
-	fmt.Printf("Sender:   %s (Bus %d, Addr %d)\n", sender.Serial, sender.Bus, sender.Address)
-	fmt.Printf("Receiver: %s (Bus %d, Addr %d)\n", receiver.Serial, receiver.Bus, receiver.Address)
-	fmt.Println()
+	fmt.Fprintf(out, "Sender:   %s (Bus %d, Addr %d)\n", sender.Serial, sender.Bus, sender.Address)
+	fmt.Fprintf(out, "Receiver: %s (Bus %d, Addr %d)\n", receiver.Serial, receiver.Bus, receiver.Address)
+	fmt.Fprintln(out)
 
 	defer sender.Close()
 	defer receiver.Close()
 
 	// Configure both devices
-	fmt.Println("Configuring devices...")
+	fmt.Fprintln(out, "Configuring devices...")
 
 	// Force both devices to IDLE state and clear any pending data
-	fmt.Println("  Setting devices to IDLE...")
+	fmt.Fprintln(out, "  Setting devices to IDLE...")
 	if err := sender.SetModeIDLE(); err != nil {
-		fmt.Printf("  Warning: sender SetModeIDLE failed: %v\n", err)
+		fmt.Fprintf(out, "  Warning: sender SetModeIDLE failed: %v\n", err)
 	}
 	if err := receiver.SetModeIDLE(); err != nil {
-		fmt.Printf("  Warning: receiver SetModeIDLE failed: %v\n", err)
+		fmt.Fprintf(out, "  Warning: receiver SetModeIDLE failed: %v\n", err)
 	}
 	time.Sleep(100 * time.Millisecond)
 
 	if err := config.ApplyToDevice(sender, configuration); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to configure sender: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	if err := config.ApplyToDevice(receiver, configuration); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to configure receiver: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	// Enable amplifiers
-	if err := sender.SetAmpMode(1); err != nil {
+	if err := sender.EnableAmplifier(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to enable sender amplifiers: %v\n", err)
 	}
-	if err := receiver.SetAmpMode(1); err != nil {
+	if err := receiver.EnableAmplifier(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to enable receiver amplifiers: %v\n", err)
 	}
 
 	// Verify configuration
 	if *verbose {
-		verifySenderConfig(sender)
-		verifyReceiverConfig(receiver)
+		verifySenderConfig(out, sender)
+		verifyReceiverConfig(out, receiver)
 	}
 
-	fmt.Println("Configuration complete.")
-	fmt.Println()
+	fmt.Fprintln(out, "Configuration complete.")
+	fmt.Fprintln(out)
 
 	// Run tests at progressively faster rates
 	var results []TestResult
 	delay := *initialDelay
 
 	for delay >= *minDelay {
-		fmt.Printf("========================================\n")
-		fmt.Printf("TEST RUN: %d packets, %v delay\n", *packetCount, delay)
-		fmt.Printf("========================================\n")
+		fmt.Fprintf(out, "========================================\n")
+		fmt.Fprintf(out, "TEST RUN: %d packets, %v delay\n", *packetCount, delay)
+		fmt.Fprintf(out, "========================================\n")
 
-		result := runTest(sender, receiver, *packetCount, delay, *verbose)
+		result := runTest(out, sender, receiver, *packetCount, delay, *verbose)
 		results = append(results, result)
 
-		fmt.Printf("\nResult: %d/%d packets received (%.1f%% success)\n",
+		fmt.Fprintf(out, "\nResult: %d/%d packets received (%.1f%% success)\n",
 			result.Received, result.Sent, result.SuccessRate)
-		fmt.Printf("        Matched: %d, Mismatched: %d, Timeouts: %d\n",
+		fmt.Fprintf(out, "        Matched: %d, Mismatched: %d, Timeouts: %d\n",
 			result.Matched, result.Mismatched, result.RecvTimeouts)
 		if result.Received > 0 {
-			fmt.Printf("        RSSI: avg=%d dBm, min=%d dBm, max=%d dBm\n",
+			fmt.Fprintf(out, "        RSSI: avg=%d dBm, min=%d dBm, max=%d dBm\n",
 				result.AvgRSSI, result.MinRSSI, result.MaxRSSI)
 		}
-		fmt.Println()
+		fmt.Fprintln(out)
 
 		// Stop if success rate drops below 50%
 		if result.SuccessRate < 50.0 {
-			fmt.Println("Success rate below 50%, stopping tests.")
+			fmt.Fprintln(out, "Success rate below 50%, stopping tests.")
 			break
 		}
 
@@ -174,19 +189,43 @@ func main() {
 	}
 
 	// Print summary
-	fmt.Println()
-	fmt.Println("========================================")
-	fmt.Println("SUMMARY")
-	fmt.Println("========================================")
-	fmt.Printf("%-15s %-8s %-8s %-10s %-10s\n", "Delay", "Sent", "Recv", "Success%", "Avg RSSI")
-	fmt.Println("------------------------------------------------------------")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "========================================")
+	fmt.Fprintln(out, "SUMMARY")
+	fmt.Fprintln(out, "========================================")
+	fmt.Fprintf(out, "%-15s %-8s %-8s %-10s %-10s\n", "Delay", "Sent", "Recv", "Success%", "Avg RSSI")
+	fmt.Fprintln(out, "------------------------------------------------------------")
 	for _, r := range results {
-		fmt.Printf("%-15v %-8d %-8d %-10.1f %-10d\n",
+		fmt.Fprintf(out, "%-15v %-8d %-8d %-10.1f %-10d\n",
 			r.Delay, r.Sent, r.Received, r.SuccessRate, r.AvgRSSI)
 	}
+
+	// Judge the link on the slowest run; faster runs are expected to degrade
+	verdict, code := "pass", exitcode.OK
+	if len(results) > 0 {
+		first := results[0]
+		switch {
+		case first.Received == 0:
+			verdict, code = "fail", exitcode.RFTestFailed
+		case first.Matched < first.Sent:
+			verdict, code = "partial", exitcode.Partial
+		}
+	}
+	if format.IsJSON() {
+		output.Write(&report{
+			Config:   *configPath,
+			Sender:   sender.Serial,
+			Receiver: receiver.Serial,
+			Runs:     results,
+			Verdict:  verdict,
+		})
+	}
+	if code != exitcode.OK {
+		os.Exit(code)
+	}
 }
 
-func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration, verbose bool) TestResult {
+func runTest(out io.Writer, sender, receiver *yardstick.Device, count int, delay time.Duration, verbose bool) TestResult {
 	result := TestResult{
 		Delay:   delay,
 		Sent:    count,
@@ -260,18 +299,18 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 	// Send packets
 	sendTimes := make([]time.Time, count)
 	for i := 0; i < count; i++ {
-		fmt.Printf("  TX[%02d/%02d]", i+1, count)
+		fmt.Fprintf(out, "  TX[%02d/%02d]", i+1, count)
 		if verbose {
-			fmt.Printf(": %s", hex.EncodeToString(packets[i]))
+			fmt.Fprintf(out, ": %s", hex.EncodeToString(packets[i]))
 		}
-		fmt.Printf("...")
+		fmt.Fprintf(out, "...")
 
 		sendTimes[i] = time.Now()
 		err := sender.RFXmit(packets[i], 0, 0)
 		if err != nil {
-			fmt.Printf(" ERROR: %v\n", err)
+			fmt.Fprintf(out, " ERROR: %v\n", err)
 		} else {
-			fmt.Printf(" OK (%.0fms)\n", time.Since(sendTimes[i]).Seconds()*1000)
+			fmt.Fprintf(out, " OK (%.0fms)\n", time.Since(sendTimes[i]).Seconds()*1000)
 		}
 
 		if i < count-1 {
@@ -280,7 +319,7 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 	}
 
 	// Wait for remaining packets to arrive
-	fmt.Printf("  Waiting for RX...")
+	fmt.Fprintf(out, "  Waiting for RX...")
 	time.Sleep(500 * time.Millisecond)
 
 	// Stop receiver
@@ -295,17 +334,17 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 
 	select {
 	case <-done:
-		fmt.Printf(" done\n")
+		fmt.Fprintf(out, " done\n")
 	case <-time.After(500 * time.Millisecond):
-		fmt.Printf(" timeout, stopping receiver...\n")
+		fmt.Fprintf(out, " timeout, stopping receiver...\n")
 		// Force receiver to IDLE to unblock RFRecv
 		receiver.SetModeIDLE()
 		// Wait again with another timeout
 		select {
 		case <-done:
-			fmt.Printf("  Receiver stopped\n")
+			fmt.Fprintf(out, "  Receiver stopped\n")
 		case <-time.After(500 * time.Millisecond):
-			fmt.Printf("  Warning: receiver goroutine still blocked, continuing anyway\n")
+			fmt.Fprintf(out, "  Warning: receiver goroutine still blocked, continuing anyway\n")
 		}
 	}
 	close(recvChan)
@@ -324,7 +363,7 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 
 	for _, rpkt := range received {
 		if verbose {
-			fmt.Printf("  RX: %s (RSSI: %d dBm)\n", hex.EncodeToString(rpkt.data), rpkt.rssi)
+			fmt.Fprintf(out, "  RX: %s (RSSI: %d dBm)\n", hex.EncodeToString(rpkt.data), rpkt.rssi)
 		}
 
 		// Check if this is a valid test packet
@@ -347,7 +386,7 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 					} else {
 						result.Mismatched++
 						if verbose {
-							fmt.Printf("       ^ Mismatch at seq %d\n", seqNum)
+							fmt.Fprintf(out, "       ^ Mismatch at seq %d\n", seqNum)
 						}
 					}
 				}
@@ -355,7 +394,7 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 		} else {
 			// Not a test packet (noise)
 			if verbose {
-				fmt.Printf("       ^ Not a test packet (noise)\n")
+				fmt.Fprintf(out, "       ^ Not a test packet (noise)\n")
 			}
 		}
 
@@ -375,7 +414,7 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 	result.SuccessRate = float64(result.Matched) / float64(result.Sent) * 100.0
 
 	// Always show RX summary
-	fmt.Printf("  RX: %d packets received, %d matched, %d mismatched\n",
+	fmt.Fprintf(out, "  RX: %d packets received, %d matched, %d mismatched\n",
 		result.Received, result.Matched, result.Mismatched)
 
 	// Report missing packets
@@ -386,15 +425,15 @@ func runTest(sender, receiver *yardstick.Device, count int, delay time.Duration,
 		}
 	}
 	if len(missing) > 0 && len(missing) <= 10 {
-		fmt.Printf("  Missing packets: %v\n", missing)
+		fmt.Fprintf(out, "  Missing packets: %v\n", missing)
 	} else if len(missing) > 10 {
-		fmt.Printf("  Missing packets: %d total\n", len(missing))
+		fmt.Fprintf(out, "  Missing packets: %d total\n", len(missing))
 	}
 
 	return result
 }
 
-func verifySenderConfig(device *yardstick.Device) {
+func verifySenderConfig(out io.Writer, device *yardstick.Device) {
 	sync1, _ := device.PeekByte(0xDF00)
 	sync0, _ := device.PeekByte(0xDF01)
 	pktlen, _ := device.PeekByte(0xDF02)
@@ -403,11 +442,11 @@ func verifySenderConfig(device *yardstick.Device) {
 	freq1, _ := device.PeekByte(0xDF0A)
 	freq0, _ := device.PeekByte(0xDF0B)
 	pa0, _ := device.PeekByte(0xDF2E)
-	fmt.Printf("Sender verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
+	fmt.Fprintf(out, "Sender verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
 		sync1, sync0, pktlen, mdmcfg2, freq2, freq1, freq0, pa0)
 }
 
-func verifyReceiverConfig(device *yardstick.Device) {
+func verifyReceiverConfig(out io.Writer, device *yardstick.Device) {
 	sync1, _ := device.PeekByte(0xDF00)
 	sync0, _ := device.PeekByte(0xDF01)
 	pktlen, _ := device.PeekByte(0xDF02)
@@ -416,6 +455,6 @@ func verifyReceiverConfig(device *yardstick.Device) {
 	freq1, _ := device.PeekByte(0xDF0A)
 	freq0, _ := device.PeekByte(0xDF0B)
 	pa0, _ := device.PeekByte(0xDF2E)
-	fmt.Printf("Receiver verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
+	fmt.Fprintf(out, "Receiver verified: SYNC=0x%02X%02X PKTLEN=%d MDMCFG2=0x%02X FREQ=0x%02X%02X%02X PA0=0x%02X\n",
 		sync1, sync0, pktlen, mdmcfg2, freq2, freq1, freq0, pa0)
 }
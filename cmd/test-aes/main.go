@@ -0,0 +1,310 @@
+// test-aes: Round-trip test of the firmware AES coprocessor between two
+// YardStick One devices
+//
+// The test checks that AES modes read back as written on both devices,
+// that packets sent over an AES-CBC link arrive decrypted intact, and that
+// a receiver with crypto disabled sees ciphertext rather than plaintext.
+// The configuration must use a fixed packet length that is a multiple of
+// 16 bytes (the AES block size).
+//
+// Usage:
+//
+//	./test-aes -c etc/defaults.json
+//	./test-aes -c etc/defaults.json -key 000102030405060708090a0b0c0d0e0f -n 20
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// report is the -output json result
+type report struct {
+	Config     string        `json:"config"`
+	Sender     string        `json:"sender"`
+	Receiver   string        `json:"receiver"`
+	Modes      []modeCheck   `json:"modes"`
+	Packets    []packetCheck `json:"packets"`
+	Ciphertext *cipherCheck  `json:"ciphertext,omitempty"`
+	Sent       int           `json:"sent"`
+	Matched    int           `json:"matched"`
+	Verdict    string        `json:"verdict"` // pass, partial or fail
+	Error      string        `json:"error,omitempty"`
+}
+
+// modeCheck is one AES mode register round trip
+type modeCheck struct {
+	Device string `json:"device"`
+	Set    uint8  `json:"set"`
+	Read   uint8  `json:"read"`
+	OK     bool   `json:"ok"`
+}
+
+// packetCheck is one packet over the encrypted link
+type packetCheck struct {
+	Seq      int    `json:"seq"`
+	OK       bool   `json:"ok"`
+	Received string `json:"received,omitempty"` // Hex
+	Error    string `json:"error,omitempty"`
+}
+
+// cipherCheck is the packet seen by the receiver with crypto disabled
+type cipherCheck struct {
+	Received   bool   `json:"received"`
+	Ciphertext string `json:"ciphertext,omitempty"` // Hex
+	Error      string `json:"error,omitempty"`
+}
+
+func main() {
+	configPath := flag.String("c", "etc/defaults.json", "Configuration file path")
+	keyHex := flag.String("key", "2b7e151628aed2a6abf7158809cf4f3c", "AES-128 key (hex)")
+	ivHex := flag.String("iv", "000102030405060708090a0b0c0d0e0f", "AES IV (hex)")
+	count := flag.Int("n", 10, "Number of encrypted packets to send")
+	delay := flag.Duration("delay", 200*time.Millisecond, "Delay between packets")
+	timeout := flag.Duration("timeout", time.Second, "Receive timeout per packet")
+	verbose := flag.Bool("v", false, "Verbose output")
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage)
+	flag.Parse()
+
+	key, err := parseBlock("key", *keyHex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Usage)
+	}
+	iv, err := parseBlock("iv", *ivHex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Usage)
+	}
+
+	rep := &report{Config: *configPath, Verdict: "pass"}
+	err = run(format.Progress(), rep, key, iv, *count, *delay, *timeout, *verbose)
+	if err != nil {
+		rep.Verdict, rep.Error = "fail", err.Error()
+		if exitcode.Of(err) == exitcode.Partial {
+			rep.Verdict = "partial"
+		}
+	}
+	// Without a device pair there is no test to report on
+	if format.IsJSON() && rep.Sender != "" {
+		output.Write(rep)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+// parseBlock decodes a 16-byte hex key or IV
+func parseBlock(name, s string) ([16]byte, error) {
+	var block [16]byte
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return block, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	if len(data) != len(block) {
+		return block, fmt.Errorf("-%s must be %d bytes, got %d", name, len(block), len(data))
+	}
+	copy(block[:], data)
+	return block, nil
+}
+
+func run(out io.Writer, rep *report, key, iv [16]byte, count int, delay, timeout time.Duration, verbose bool) error {
+	configuration, err := config.LoadFromFile(rep.Config)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	pktLen := int(configuration.Registers.PKTLEN)
+	if configuration.Registers.PKTCTRL0&0x03 != yardstick.LengthFixed || pktLen == 0 || pktLen%yardstick.AESBlockSize != 0 {
+		return exitcode.Errorf(exitcode.ConfigInvalid,
+			"configuration must use fixed length packets of a multiple of %d bytes (PKTLEN=%d)", yardstick.AESBlockSize, pktLen)
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	sender, receiver, err := openPair(ctx)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	defer receiver.Close()
+	rep.Sender, rep.Receiver = sender.Serial, receiver.Serial
+
+	fmt.Fprintf(out, "Sender:   %s (Bus %d, Addr %d)\n", sender.Serial, sender.Bus, sender.Address)
+	fmt.Fprintf(out, "Receiver: %s (Bus %d, Addr %d)\n", receiver.Serial, receiver.Bus, receiver.Address)
+	fmt.Fprintln(out)
+
+	for _, dev := range []*yardstick.Device{sender, receiver} {
+		if err := config.ApplyToDevice(dev, configuration); err != nil {
+			return fmt.Errorf("failed to configure %s: %w", dev.Serial, err)
+		}
+		if err := dev.EnableAmplifier(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to enable amplifiers on %s: %v\n", dev.Serial, err)
+		}
+		defer dev.DisableAES()
+	}
+
+	// 1. Mode register round trip
+	fmt.Fprintln(out, "Mode readback:")
+	modes := []uint8{
+		yardstick.AESModeECB | yardstick.AESCryptoOutEnable | yardstick.AESCryptoOutEncrypt,
+		yardstick.AESCryptoDefault,
+		yardstick.AESCryptoNone,
+	}
+	for _, dev := range []*yardstick.Device{sender, receiver} {
+		for _, mode := range modes {
+			if err := dev.SetAESMode(mode); err != nil {
+				return err
+			}
+			got, err := dev.GetAESMode()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "  %s: set 0x%02X read 0x%02X\n", dev.Serial, mode, got)
+			rep.Modes = append(rep.Modes, modeCheck{Device: dev.Serial, Set: mode, Read: got, OK: got == mode})
+			if got != mode {
+				return exitcode.Errorf(exitcode.VerifyFailed, "%s: AES mode read back 0x%02X, expected 0x%02X", dev.Serial, got, mode)
+			}
+		}
+	}
+	fmt.Fprintln(out)
+
+	// 2. Encrypted link, both ends configured
+	for _, dev := range []*yardstick.Device{sender, receiver} {
+		if err := dev.EnableEncryptedLink(key, iv); err != nil {
+			return fmt.Errorf("%s: %w", dev.Serial, err)
+		}
+	}
+
+	fmt.Fprintf(out, "Encrypted link (%d packets):\n", count)
+	rep.Sent = count
+	for i := 0; i < count; i++ {
+		plain := testPacket(i, pktLen)
+		got, err := roundTrip(sender, receiver, plain, timeout)
+		ok := err == nil && bytes.HasPrefix(got, plain)
+		if ok {
+			rep.Matched++
+		}
+		check := packetCheck{Seq: i, OK: ok, Received: hex.EncodeToString(got)}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		rep.Packets = append(rep.Packets, check)
+		fmt.Fprintf(out, "  [%02d/%02d] %s", i+1, count, passFail(ok))
+		if err != nil {
+			fmt.Fprintf(out, " (%v)", err)
+		}
+		if verbose && got != nil {
+			fmt.Fprintf(out, " rx %s", hex.EncodeToString(got))
+		}
+		fmt.Fprintln(out)
+		time.Sleep(delay)
+	}
+	fmt.Fprintln(out)
+
+	// 3. Receiver without crypto must see ciphertext
+	if err := receiver.DisableAES(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Ciphertext check (receiver crypto off):")
+	plain := testPacket(0xFF, pktLen)
+	cipher, err := roundTrip(sender, receiver, plain, timeout)
+	switch {
+	case err != nil:
+		fmt.Fprintf(out, "  no packet (%v)\n", err)
+		rep.Ciphertext = &cipherCheck{Error: err.Error()}
+	case bytes.HasPrefix(cipher, plain):
+		return exitcode.Errorf(exitcode.VerifyFailed, "received plaintext with receiver crypto disabled; sender is not encrypting")
+	default:
+		fmt.Fprintf(out, "  PASS ciphertext %s\n", hex.EncodeToString(cipher[:pktLen]))
+		rep.Ciphertext = &cipherCheck{Received: true, Ciphertext: hex.EncodeToString(cipher[:pktLen])}
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Result: %d/%d packets decrypted intact\n", rep.Matched, count)
+	switch {
+	case rep.Matched == 0:
+		return exitcode.Errorf(exitcode.RFTestFailed, "no encrypted packets decrypted intact")
+	case rep.Matched < count:
+		return exitcode.Errorf(exitcode.Partial, "%d of %d encrypted packets failed", count-rep.Matched, count)
+	}
+	return nil
+}
+
+// openPair opens the first two devices ordered by bus and address, the
+// same assignment as test-10-repeat
+func openPair(ctx *gousb.Context) (*yardstick.Device, *yardstick.Device, error) {
+	devices, err := yardstick.FindAllDevices(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find devices: %w", err)
+	}
+	if len(devices) < 2 {
+		for _, d := range devices {
+			d.Close()
+		}
+		return nil, nil, exitcode.Errorf(exitcode.DeviceNotFound, "need at least 2 YardStick One devices, found %d", len(devices))
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Bus != devices[j].Bus {
+			return devices[i].Bus < devices[j].Bus
+		}
+		return devices[i].Address < devices[j].Address
+	})
+	for i := 2; i < len(devices); i++ {
+		devices[i].Close()
+	}
+	return devices[0], devices[1], nil
+}
+
+// testPacket builds a recognizable plaintext with a sequence number
+func testPacket(seq, length int) []byte {
+	pkt := make([]byte, length)
+	for i := range pkt {
+		pkt[i] = byte(i)
+	}
+	pkt[0] = 0xAE
+	pkt[1] = byte(seq)
+	return pkt
+}
+
+// roundTrip sends data from sender and returns what receiver got
+func roundTrip(sender, receiver *yardstick.Device, data []byte, timeout time.Duration) ([]byte, error) {
+	if err := receiver.SetModeRX(); err != nil {
+		return nil, err
+	}
+	defer receiver.SetModeIDLE()
+
+	if err := sender.RFXmit(data, 0, 0); err != nil {
+		return nil, err
+	}
+	got, err := receiver.RFRecv(timeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(got) < len(data) {
+		return got, fmt.Errorf("short packet: %d bytes", len(got))
+	}
+	return got, nil
+}
+
+func passFail(ok bool) string {
+	if ok {
+		return "PASS"
+	}
+	return "FAIL"
+}
@@ -0,0 +1,189 @@
+// tpms-monitor: Print live tyre pressure sensor readings
+//
+// The radio syncs on the end of the sensors' preamble and receives a
+// fixed-length block of raw chips after it, which pkg/decoders/tpms
+// searches for Citroen, Ford and Schrader frames. Sensors send several
+// copies of each frame; each sensor is shown once per -window. Cheap
+// sensors drift with temperature, so by default the receive filter is
+// widened, and then the radio retuned, when a sensor wanders towards its
+// edge (-drift).
+//
+// Examples:
+//
+//	# US sensors
+//	./tpms-monitor -f 315
+//
+//	# European sensors, one JSON object per reading
+//	./tpms-monitor -f 433.92 -output json
+//
+//	# Sensors whose chips arrive inverted
+//	./tpms-monitor -f 433.92 -invert
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/decoders/tpms"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// packetLen holds the longest frame's chips after the sync, with margin
+const packetLen = 24
+
+// readingRecord is a reading in -output json mode
+type readingRecord struct {
+	Time time.Time `json:"time"`
+	*tpms.Reading
+	RSSI *int `json:"rssi_dbm,omitempty"`
+}
+
+func main() {
+	var format output.Format
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	freqMHz := flag.Float64("f", 315, "Frequency in MHz (315 in the US, 433.92 in Europe)")
+	rate := flag.Float64("rate", tpms.ChipRate, "Chip rate in baud")
+	deviation := flag.Float64("deviation", tpms.DeviationHz, "FSK deviation in Hz")
+	invert := flag.Bool("invert", false, "Sync on the inverted preamble, for sensors whose chips arrive inverted")
+	protocolList := flag.String("protocols", "", "Comma-separated protocols to decode (default: all)")
+	window := flag.Duration("window", 2*time.Second, "Show each sensor at most once within this window")
+	drift := flag.String("drift", "widen", "Follow sensors drifting towards the filter edge: widen, retune or off")
+	verbose := flag.Bool("v", false, "Print packets that held no reading")
+	flag.Var(&format, "output", output.FlagUsage+" (json writes one object per line)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print live tyre pressure sensor readings\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -f 315\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -f 433.92 -protocols citroen -output json\n", os.Args[0])
+	}
+	flag.Parse()
+
+	var wanted map[tpms.Protocol]bool
+	if *protocolList != "" {
+		wanted = make(map[tpms.Protocol]bool)
+		for _, name := range strings.Split(*protocolList, ",") {
+			p := tpms.Protocol(strings.ToLower(strings.TrimSpace(name)))
+			if !knownProtocol(p) {
+				fmt.Fprintf(os.Stderr, "Error: unknown protocol '%s' (known: %v)\n", name, tpms.Protocols)
+				os.Exit(exitcode.Usage)
+			}
+			wanted[p] = true
+		}
+	}
+
+	sync := uint16(tpms.SyncWord)
+	if *invert {
+		sync = ^sync
+	}
+	profile := &profiles.Profile{
+		Name:         "tpms",
+		Description:  "TPMS receive: Manchester chips after the preamble",
+		FrequencyHz:  *freqMHz * 1e6,
+		Modulation:   profiles.Mod2FSK,
+		DataRateBaud: *rate,
+		DeviationHz:  *deviation,
+		ChannelBWHz:  135000,
+		SyncWord:     sync,
+		SyncMode:     profiles.Sync16of16,
+		PktLenMode:   profiles.PktLenFixed,
+		PktLen:       packetLen,
+		DriftAction:  *drift,
+		DriftMaxBWHz: 270000,
+	}
+	driftOpts, err := rxstream.DriftFromProfile(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Usage)
+	}
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	if err := config.ApplyProfile(device, profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to apply profile: %v\n", err)
+		os.Exit(exitcode.ConfigInvalid)
+	}
+
+	stream := rxstream.New(device, &rxstream.Options{Drift: driftOpts})
+	if err := stream.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to start receiving: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer stream.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	fmt.Fprintf(format.Progress(), "Listening for TPMS sensors at %.3f MHz, %.0f baud (Ctrl+C to stop)\n", *freqMHz, *rate)
+	lastSeen := make(map[string]time.Time)
+	count := 0
+	for {
+		select {
+		case <-sigChan:
+			fmt.Fprintf(format.Progress(), "\nReceived %d readings from %d sensors\n", count, len(lastSeen))
+			if d := stream.Drift(); d != nil && d.Events() > 0 {
+				p := d.Profile()
+				fmt.Fprintf(format.Progress(), "Followed drift %d times: signal %.3f-%.3f MHz\n", len(p.Events), p.MinHz/1e6, p.MaxHz/1e6)
+			}
+			return
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				return
+			}
+			readings := tpms.DecodePacket(pkt.Raw, sync)
+			if len(readings) == 0 && *verbose {
+				fmt.Fprintf(format.Progress(), "%s no reading in %X\n", pkt.Timestamp.Format("15:04:05.000"), pkt.Raw)
+			}
+			for _, r := range readings {
+				if wanted != nil && !wanted[r.Protocol] {
+					continue
+				}
+				key := string(r.Protocol) + " " + r.IDString()
+				if t, seen := lastSeen[key]; seen && pkt.Timestamp.Sub(t) < *window {
+					continue
+				}
+				lastSeen[key] = pkt.Timestamp
+				count++
+				if format.IsJSON() {
+					rec := &readingRecord{Time: pkt.Timestamp, Reading: r}
+					if pkt.RSSIValid {
+						rec.RSSI = &pkt.RSSI
+					}
+					output.WriteLine(rec)
+					continue
+				}
+				fmt.Printf("%s %s\n", pkt.Timestamp.Format("15:04:05.000"), r)
+			}
+		}
+	}
+}
+
+func knownProtocol(p tpms.Protocol) bool {
+	for _, known := range tpms.Protocols {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
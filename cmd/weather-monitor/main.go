@@ -0,0 +1,158 @@
+// weather-monitor: Print live weather sensor readings
+//
+// The radio receives raw no-sync OOK blocks oversampled at -rate, which
+// pkg/decoders/weather turns back into pulse timings and searches for
+// Oregon Scientific v2.1/v3, Nexus and Acurite 592TXR messages. Sensors
+// send several copies of each reading; each sensor is shown once per
+// -window.
+//
+// Examples:
+//
+//	# Sensors on 433.92 MHz
+//	./weather-monitor
+//
+//	# One JSON object per reading
+//	./weather-monitor -output json
+//
+//	# Only Oregon Scientific sensors
+//	./weather-monitor -protocols oregon-v2.1,oregon-v3
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/decoders/weather"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// readingRecord is a reading in -output json mode
+type readingRecord struct {
+	Time time.Time `json:"time"`
+	*weather.Reading
+	RSSI *int `json:"rssi_dbm,omitempty"`
+}
+
+func main() {
+	var format output.Format
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	freqMHz := flag.Float64("f", 433.92, "Frequency in MHz")
+	rate := flag.Float64("rate", weather.DefaultSampleRate, "Sample rate in baud; each received bit is one sample of the carrier")
+	protocolList := flag.String("protocols", "", "Comma-separated protocols to decode (default: all)")
+	window := flag.Duration("window", 30*time.Second, "Show each sensor at most once within this window")
+	flag.Var(&format, "output", output.FlagUsage+" (json writes one object per line)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print live weather sensor readings\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -f 433.92\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -protocols nexus,acurite -output json\n", os.Args[0])
+	}
+	flag.Parse()
+
+	var wanted map[weather.Protocol]bool
+	if *protocolList != "" {
+		wanted = make(map[weather.Protocol]bool)
+		for _, name := range strings.Split(*protocolList, ",") {
+			p := weather.Protocol(strings.ToLower(strings.TrimSpace(name)))
+			if !knownProtocol(p) {
+				fmt.Fprintf(os.Stderr, "Error: unknown protocol '%s' (known: %v)\n", name, weather.Protocols)
+				os.Exit(exitcode.Usage)
+			}
+			wanted[p] = true
+		}
+	}
+	if *rate <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -rate must be positive\n")
+		os.Exit(exitcode.Usage)
+	}
+
+	profile := profiles.New433OOKPWM(*rate)
+	profile.Name = "weather"
+	profile.Description = "Weather sensor receive: raw OOK samples"
+	profile.FrequencyHz = *freqMHz * 1e6
+	profile.PktLen = 255
+
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	if err := config.ApplyProfile(device, profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to apply profile: %v\n", err)
+		os.Exit(exitcode.ConfigInvalid)
+	}
+
+	stream := rxstream.New(device, &rxstream.Options{})
+	if err := stream.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to start receiving: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer stream.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	fmt.Fprintf(format.Progress(), "Listening for weather sensors at %.3f MHz, %.0f baud (Ctrl+C to stop)\n", *freqMHz, *rate)
+	receiver := weather.NewReceiver(*rate)
+	lastSeen := make(map[string]time.Time)
+	count := 0
+	for {
+		select {
+		case <-sigChan:
+			fmt.Fprintf(format.Progress(), "\nReceived %d readings from %d sensors\n", count, len(lastSeen))
+			return
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				return
+			}
+			for _, r := range receiver.Add(pkt.Raw) {
+				if wanted != nil && !wanted[r.Protocol] {
+					continue
+				}
+				key := r.Key()
+				if t, seen := lastSeen[key]; seen && pkt.Timestamp.Sub(t) < *window {
+					continue
+				}
+				lastSeen[key] = pkt.Timestamp
+				count++
+				if format.IsJSON() {
+					rec := &readingRecord{Time: pkt.Timestamp, Reading: r}
+					if pkt.RSSIValid {
+						rec.RSSI = &pkt.RSSI
+					}
+					output.WriteLine(rec)
+					continue
+				}
+				fmt.Printf("%s %s\n", pkt.Timestamp.Format("15:04:05.000"), r)
+			}
+		}
+	}
+}
+
+func knownProtocol(p weather.Protocol) bool {
+	for _, known := range weather.Protocols {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
@@ -2,35 +2,57 @@
 //
 // This tool connects to a YardStick One device, reads its current radio
 // configuration, and saves it to a JSON file. The configuration can later
-// be loaded using ys1-load-config.
+// be loaded using ys1-load-config. With -profile it is saved as a profile
+// instead, with frequency, modulation, data rate and the other settings
+// in readable units, for editing and loading wherever profiles are used.
 package main
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/google/gousb"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/profiles"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
+// dumpResult is the -output json result
+type dumpResult struct {
+	Serial       string  `json:"serial"`
+	Path         string  `json:"path"`
+	Profile      string  `json:"profile,omitempty"` // Name of the profile saved with -profile
+	FrequencyHz  float64 `json:"frequency_hz"`
+	Modulation   string  `json:"modulation"`
+	DataRateBaud float64 `json:"data_rate_baud"`
+	SyncWord     uint16  `json:"sync_word"`
+}
+
 func main() {
 	// Parse command line flags
+	var format output.Format
 	outputFile := flag.String("o", "", "Output file path (default: etc/yardsticks/<serial>.json)")
 	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
 	verbose := flag.Bool("v", false, "Verbose output")
 	listOnly := flag.Bool("l", false, "List devices only, don't dump config")
 	jsonOutput := flag.Bool("json", false, "Output config to stdout as JSON instead of file")
+	asProfile := flag.Bool("profile", false, "Save as an editable profile (default path: etc/profiles/<serial>.json)")
+	flag.Var(&format, "output", output.FlagUsage+" (-json writes the configuration itself)")
 	flag.Parse()
+	out := format.Progress()
 
 	// Create USB context
 	context := gousb.NewContext()
 	defer context.Close()
 
 	if *listOnly {
-		listDevices(context)
+		listDevices(context, format)
 		return
 	}
 
@@ -38,35 +60,51 @@ func main() {
 	device, err := yardstick.SelectDevice(context, yardstick.DeviceSelector(*deviceSel))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	defer device.Close()
 
 	if *verbose {
-		fmt.Printf("Connected to: %s\n", device)
+		fmt.Fprintf(out, "Connected to: %s\n", device)
 	}
 
 	// Test connectivity with ping
 	if *verbose {
-		fmt.Print("Testing connectivity... ")
+		fmt.Fprint(out, "Testing connectivity... ")
 	}
 	if err := device.Ping([]byte("PING")); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Ping failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	if *verbose {
-		fmt.Println("OK")
+		fmt.Fprintln(out, "OK")
 	}
 
 	// Dump configuration
 	if *verbose {
-		fmt.Println("Reading device configuration...")
+		fmt.Fprintln(out, "Reading device configuration...")
 	}
 
 	configuration, err := config.DumpFromDevice(device)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to dump configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
+	}
+
+	result := &dumpResult{
+		Serial:       device.Serial,
+		FrequencyHz:  configuration.Registers.GetFrequency(),
+		Modulation:   configuration.GetModulationString(),
+		DataRateBaud: configuration.Registers.GetDataRate(),
+		SyncWord:     configuration.GetSyncWord(),
+	}
+
+	if *asProfile {
+		saveProfile(configuration, *outputFile, *jsonOutput, out, result)
+		if format.IsJSON() && !*jsonOutput {
+			output.Write(result)
+		}
+		return
 	}
 
 	// Output to stdout as JSON
@@ -74,7 +112,7 @@ func main() {
 		data, err := json.MarshalIndent(configuration, "", "  ")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Failed to marshal configuration: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitcode.Of(err))
 		}
 		fmt.Println(string(data))
 		return
@@ -89,22 +127,68 @@ func main() {
 	// Save to file
 	if err := config.SaveToFile(configuration, path); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to save configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	fmt.Printf("Configuration saved to: %s\n", path)
+	fmt.Fprintf(out, "Configuration saved to: %s\n", path)
+	result.Path = path
 
 	// Print summary
 	if *verbose {
-		printConfigSummary(configuration)
+		printConfigSummary(out, configuration)
+	}
+	if format.IsJSON() {
+		output.Write(result)
+	}
+}
+
+// saveProfile writes the dumped registers as a profile, recording where
+// in result
+func saveProfile(cfg *config.DeviceConfig, path string, stdout bool, out io.Writer, result *dumpResult) {
+	p := profiles.FromRegisters(&cfg.Registers)
+	if stdout {
+		data, err := json.MarshalIndent(profiles.ProfileConfig{Version: profiles.SchemaVersion, Profile: *p, Registers: *p.ToRegisters(), Timestamp: cfg.Timestamp}, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to marshal profile: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if path == "" {
+		path = filepath.Join("etc", "profiles", result.Serial+".json")
+	}
+	if err := profiles.EnsureDir(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create directory: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	if err := p.SaveToFile(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to save profile: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	fmt.Fprintf(out, "Profile %s saved to: %s\n", p.Name, path)
+	result.Path, result.Profile = path, p.Name
+	if err := p.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
 }
 
-func listDevices(context *gousb.Context) {
+func listDevices(context *gousb.Context, format output.Format) {
 	devices, err := yardstick.FindAllDevices(context)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to enumerate devices: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
+	}
+
+	if format.IsJSON() {
+		infos := make([]yardstick.DeviceInfo, len(devices))
+		for i, device := range devices {
+			infos[i] = device.Info(true)
+			device.Close()
+		}
+		output.Write(infos)
+		return
 	}
 
 	if len(devices) == 0 {
@@ -144,12 +228,16 @@ func listDevices(context *gousb.Context) {
 	}
 }
 
-func printConfigSummary(cfg *config.DeviceConfig) {
-	fmt.Println("\nConfiguration Summary:")
-	fmt.Printf("  Build Type:   %s\n", cfg.BuildType)
-	fmt.Printf("  Frequency:    %.6f MHz\n", cfg.GetFrequencyMHz())
-	fmt.Printf("  Sync Word:    0x%04X\n", cfg.GetSyncWord())
-	fmt.Printf("  Modulation:   %s\n", cfg.GetModulationString())
-	fmt.Printf("  Radio State:  %s\n", cfg.GetRadioStateString())
-	fmt.Printf("  Packet Len:   %d\n", cfg.Registers.PKTLEN)
+func printConfigSummary(out io.Writer, cfg *config.DeviceConfig) {
+	fmt.Fprintln(out, "\nConfiguration Summary:")
+	fmt.Fprintf(out, "  Build Type:   %s\n", cfg.BuildType)
+	fmt.Fprintf(out, "  Frequency:    %.6f MHz\n", cfg.GetFrequencyMHz())
+	fmt.Fprintf(out, "  Sync Word:    0x%04X\n", cfg.GetSyncWord())
+	fmt.Fprintf(out, "  Modulation:   %s\n", cfg.GetModulationString())
+	fmt.Fprintf(out, "  Data Rate:    %.1f kBaud\n", cfg.Registers.GetDataRate()/1e3)
+	fmt.Fprintf(out, "  Channel BW:   %.1f kHz\n", cfg.Registers.GetChannelBW()/1e3)
+	fmt.Fprintf(out, "  Deviation:    %.1f kHz\n", cfg.Registers.GetDeviation()/1e3)
+	fmt.Fprintf(out, "  IF:           %.1f kHz\n", cfg.Registers.GetIFFrequency()/1e3)
+	fmt.Fprintf(out, "  Radio State:  %s\n", cfg.GetRadioStateString())
+	fmt.Fprintf(out, "  Packet Len:   %d\n", cfg.Registers.PKTLEN)
 }
@@ -0,0 +1,522 @@
+// ys1-fuzz: EP5 protocol fuzzer for YardStick One firmware robustness testing
+//
+// This tool sends malformed EP5 packets (bad lengths, unknown apps/cmds,
+// truncated headers) to a device and checks after each one that the firmware
+// still answers a ping. Firmware debug codes are read and cleared around every
+// case so that any error the firmware records can be tied to the packet that
+// caused it. When the device stops responding, recovery is attempted and the
+// offending packet is reported.
+//
+// Commands that could reset the device, enter the bootloader, write memory or
+// key the transmitter are never sent.
+//
+// Examples:
+//
+//	# Run every case class once against the first device
+//	./ys1-fuzz -d '#0'
+//
+//	# 500 random cases from a fixed seed, stopping on the first hang
+//	./ys1-fuzz -n 500 -seed 42 -stop
+//
+//	# Only fuzz the length field
+//	./ys1-fuzz -cases length -n 100 -v
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// fuzzCase is a single malformed packet to send
+type fuzzCase struct {
+	class  string
+	desc   string
+	packet []byte
+}
+
+// caseResult records what the device did after a fuzz case
+type caseResult struct {
+	fc        fuzzCase
+	response  []byte
+	code0     uint8
+	code1     uint8
+	codesErr  error
+	pingErr   error
+	recovered bool
+}
+
+// report is the -output json result
+type report struct {
+	Device       string       `json:"device"`
+	Seed         int64        `json:"seed"`
+	Classes      []string     `json:"classes"`
+	CasesRun     int          `json:"cases_run"`
+	PingFailures int          `json:"ping_failures"`
+	DebugCodes   []codeCount  `json:"debug_codes"`
+	Cases        []caseReport `json:"cases"`  // Cases printed in text mode: all of them with -v
+	Failed       bool         `json:"failed"` // The device did not recover from a case
+}
+
+// codeCount is how often a firmware debug code was seen
+type codeCount struct {
+	Code  uint8  `json:"code"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// caseReport is one case in the JSON result
+type caseReport struct {
+	Num        int    `json:"num"`
+	Class      string `json:"class"`
+	Status     string `json:"status"` // ok, recovered or hung
+	Desc       string `json:"desc"`
+	Packet     string `json:"packet"`             // Hex
+	Response   string `json:"response,omitempty"` // Hex
+	Code0      uint8  `json:"code0"`
+	Code1      uint8  `json:"code1"`
+	CodesError string `json:"codes_error,omitempty"`
+	PingError  string `json:"ping_error,omitempty"`
+}
+
+var caseClasses = []string{"length", "app", "cmd", "truncated"}
+
+// Commands that must never be fuzzed because they change device state
+// in ways that are destructive or put RF on the air
+var unsafeCmds = map[uint8]map[uint8]bool{
+	yardstick.AppSystem: {
+		yardstick.SysCmdPoke:       true,
+		yardstick.SysCmdPokeReg:    true,
+		yardstick.SysCmdBootloader: true,
+		yardstick.SysCmdRFMode:     true,
+		yardstick.SysCmdReset:      true,
+		yardstick.SysCmdLEDMode:    true,
+	},
+	yardstick.AppNIC: {
+		yardstick.NICXmit:             true,
+		yardstick.NICSetID:            true,
+		yardstick.NICSetRecvLarge:     true,
+		yardstick.NICSetAESMode:       true,
+		yardstick.NICSetAESIV:         true,
+		yardstick.NICSetAESKey:        true,
+		yardstick.NICSetAmpMode:       true,
+		yardstick.NICLongXmit:         true,
+		yardstick.NICLongXmitMore:     true,
+		yardstick.SPECANStart:         true,
+		yardstick.FHSSSetChannels:     true,
+		yardstick.FHSSNextChannel:     true,
+		yardstick.FHSSChangeChannel:   true,
+		yardstick.FHSSSetMACThreshold: true,
+		yardstick.FHSSSetMACData:      true,
+		yardstick.FHSSXmit:            true,
+		yardstick.FHSSSetState:        true,
+		yardstick.FHSSStartSync:       true,
+		yardstick.FHSSStartHopping:    true,
+		yardstick.FHSSSetMACPeriod:    true,
+	},
+}
+
+// Commands the firmware is known to implement
+var knownCmds = map[uint8][]uint8{
+	yardstick.AppSystem: {
+		yardstick.SysCmdPeek, yardstick.SysCmdPoke, yardstick.SysCmdPing,
+		yardstick.SysCmdStatus, yardstick.SysCmdPokeReg, yardstick.SysCmdGetClock,
+		yardstick.SysCmdBuildType, yardstick.SysCmdBootloader, yardstick.SysCmdRFMode,
+		yardstick.SysCmdCompiler, yardstick.SysCmdPartNum, yardstick.SysCmdReset,
+		yardstick.SysCmdClearCodes, yardstick.SysCmdDeviceSerialNum, yardstick.SysCmdLEDMode,
+	},
+	yardstick.AppNIC: {
+		yardstick.NICRecv, yardstick.NICXmit, yardstick.NICSetID, yardstick.NICSetRecvLarge,
+		yardstick.NICSetAESMode, yardstick.NICGetAESMode, yardstick.NICSetAESIV,
+		yardstick.NICSetAESKey, yardstick.NICSetAmpMode, yardstick.NICGetAmpMode,
+		yardstick.NICLongXmit, yardstick.NICLongXmitMore,
+		yardstick.FHSSSetChannels, yardstick.FHSSNextChannel, yardstick.FHSSChangeChannel,
+		yardstick.FHSSSetMACThreshold, yardstick.FHSSGetMACThreshold, yardstick.FHSSSetMACData,
+		yardstick.FHSSGetMACData, yardstick.FHSSXmit, yardstick.FHSSGetChannels,
+		yardstick.FHSSSetState, yardstick.FHSSGetState, yardstick.FHSSStartSync,
+		yardstick.FHSSStartHopping, yardstick.FHSSStopHopping, yardstick.FHSSSetMACPeriod,
+		yardstick.SPECANStart, yardstick.SPECANStop,
+	},
+}
+
+var knownApps = []uint8{
+	yardstick.AppGeneric, yardstick.AppNIC, yardstick.AppSPECAN,
+	yardstick.AppDebug, yardstick.AppSystem,
+}
+
+func main() {
+	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
+	count := flag.Int("n", 0, "Number of random cases to run (0 = one of each case class)")
+	seed := flag.Int64("seed", 0, "Random seed (0 = time-based)")
+	cases := flag.String("cases", "all", "Comma-separated case classes: length, app, cmd, truncated, or all")
+	respWait := flag.Duration("wait", 200*time.Millisecond, "Time to collect a response after each case")
+	delay := flag.Duration("delay", 20*time.Millisecond, "Delay between cases")
+	stopOnHang := flag.Bool("stop", false, "Stop at the first case the device cannot recover from")
+	verbose := flag.Bool("v", false, "Verbose output (print every case)")
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Send malformed EP5 packets to a YardStick One and check firmware recovery\n\n")
+		fmt.Fprintf(os.Stderr, "Case classes:\n")
+		fmt.Fprintf(os.Stderr, "  length    - header length field disagrees with payload or exceeds buffer\n")
+		fmt.Fprintf(os.Stderr, "  app       - unknown application IDs\n")
+		fmt.Fprintf(os.Stderr, "  cmd       - unknown commands for the system and NIC apps\n")
+		fmt.Fprintf(os.Stderr, "  truncated - packets shorter than the 4-byte header\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -d '#0'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -n 500 -seed 42 -stop\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -cases length -n 100 -v\n", os.Args[0])
+	}
+	flag.Parse()
+	out := format.Progress()
+
+	classes, err := parseClasses(*cases)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	// Create USB context
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	// Select device
+	device, err := yardstick.SelectDevice(ctx, yardstick.DeviceSelector(*deviceSel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+	defer device.Close()
+
+	fmt.Fprintf(out, "Connected to: %s (Serial: %s)\n", device.Product, device.Serial)
+
+	// Make sure the device is healthy before we start
+	if err := device.Ping([]byte("FUZZ")); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Device ping failed before fuzzing: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+
+	n := *count
+	if n == 0 {
+		n = len(classes)
+	}
+	fmt.Fprintf(out, "Running %d case(s), seed %d, classes: %s\n\n", n, *seed, strings.Join(classes, ","))
+
+	var results []caseResult
+	rep := &report{Device: device.Serial, Seed: *seed, Classes: classes}
+	hangs := 0
+	failed := false
+
+	for i := 0; i < n; i++ {
+		class := classes[i%len(classes)]
+		if *count > 0 {
+			class = classes[rng.Intn(len(classes))]
+		}
+		fc := generateCase(rng, class)
+
+		res := runCase(device, fc, *respWait)
+		results = append(results, res)
+
+		if *verbose || res.pingErr != nil || res.code0 != yardstick.LCENoError || res.code1 != yardstick.LCENoError {
+			printResult(out, i+1, res, *verbose)
+			rep.Cases = append(rep.Cases, newCaseReport(i+1, res))
+		}
+
+		if res.pingErr != nil {
+			hangs++
+			if !res.recovered {
+				failed = true
+				if *stopOnHang {
+					fmt.Fprintln(out, "\nDevice did not recover, stopping")
+					break
+				}
+			}
+		}
+
+		time.Sleep(*delay)
+	}
+
+	// Summary
+	codeCounts := make(map[uint8]int)
+	for _, r := range results {
+		if r.codesErr != nil {
+			continue
+		}
+		if r.code0 != yardstick.LCENoError {
+			codeCounts[r.code0]++
+		}
+		if r.code1 != yardstick.LCENoError {
+			codeCounts[r.code1]++
+		}
+	}
+
+	rep.CasesRun, rep.PingFailures, rep.Failed = len(results), hangs, failed
+	rep.DebugCodes = []codeCount{}
+	for code, c := range codeCounts {
+		rep.DebugCodes = append(rep.DebugCodes, codeCount{Code: code, Name: lceName(code), Count: c})
+	}
+	sort.Slice(rep.DebugCodes, func(i, j int) bool { return rep.DebugCodes[i].Code < rep.DebugCodes[j].Code })
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "=== Fuzz Summary ===")
+	fmt.Fprintf(out, "Cases run:       %d\n", len(results))
+	fmt.Fprintf(out, "Ping failures:   %d\n", hangs)
+	if len(rep.DebugCodes) > 0 {
+		fmt.Fprintln(out, "Debug codes seen:")
+		for _, c := range rep.DebugCodes {
+			fmt.Fprintf(out, "  0x%02X %-32s %d\n", c.Code, c.Name, c.Count)
+		}
+	}
+	fmt.Fprintf(out, "Seed:            %d\n", *seed)
+
+	if format.IsJSON() {
+		if rep.Cases == nil {
+			rep.Cases = []caseReport{}
+		}
+		output.Write(rep)
+	}
+	if failed {
+		fmt.Fprintln(out, "\n*** DEVICE FAILED TO RECOVER ***")
+		os.Exit(exitcode.Failure)
+	}
+}
+
+// parseClasses validates the -cases flag
+func parseClasses(s string) ([]string, error) {
+	if s == "" || s == "all" {
+		return caseClasses, nil
+	}
+
+	var classes []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(strings.ToLower(c))
+		valid := false
+		for _, known := range caseClasses {
+			if c == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown case class '%s'", c)
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// buildPacket assembles an EP5 packet with an arbitrary length field
+func buildPacket(app, cmd uint8, length uint16, payload []byte) []byte {
+	packet := make([]byte, 4+len(payload))
+	packet[0] = app
+	packet[1] = cmd
+	binary.LittleEndian.PutUint16(packet[2:4], length)
+	copy(packet[4:], payload)
+	return packet
+}
+
+func randomPayload(rng *rand.Rand, n int) []byte {
+	payload := make([]byte, n)
+	rng.Read(payload)
+	return payload
+}
+
+// generateCase builds a malformed packet for the given class
+func generateCase(rng *rand.Rand, class string) fuzzCase {
+	switch class {
+	case "length":
+		// Ping is echo-only, so it is safe to lie about its length
+		payload := randomPayload(rng, rng.Intn(32))
+		switch rng.Intn(3) {
+		case 0:
+			// Declared length longer than the data actually sent
+			length := uint16(len(payload) + 1 + rng.Intn(64))
+			return fuzzCase{class, fmt.Sprintf("ping len=%d actual=%d (short)", length, len(payload)),
+				buildPacket(yardstick.AppSystem, yardstick.SysCmdPing, length, payload)}
+		case 1:
+			// Declared length shorter than the data, trailing garbage follows
+			length := uint16(0)
+			if len(payload) > 0 {
+				length = uint16(rng.Intn(len(payload)))
+			}
+			return fuzzCase{class, fmt.Sprintf("ping len=%d actual=%d (trailing)", length, len(payload)),
+				buildPacket(yardstick.AppSystem, yardstick.SysCmdPing, length, payload)}
+		default:
+			// Declared length larger than the firmware's OUT buffer
+			length := uint16(yardstick.EP5OutBufferSize + rng.Intn(0xFFFF-yardstick.EP5OutBufferSize))
+			return fuzzCase{class, fmt.Sprintf("ping len=%d actual=%d (too big)", length, len(payload)),
+				buildPacket(yardstick.AppSystem, yardstick.SysCmdPing, length, payload)}
+		}
+
+	case "app":
+		app := uint8(rng.Intn(256))
+		for isKnownApp(app) {
+			app = uint8(rng.Intn(256))
+		}
+		cmd := uint8(rng.Intn(256))
+		payload := randomPayload(rng, rng.Intn(32))
+		return fuzzCase{class, fmt.Sprintf("app=0x%02X cmd=0x%02X len=%d", app, cmd, len(payload)),
+			buildPacket(app, cmd, uint16(len(payload)), payload)}
+
+	case "cmd":
+		app := uint8(yardstick.AppSystem)
+		if rng.Intn(2) == 1 {
+			app = yardstick.AppNIC
+		}
+		cmd := uint8(rng.Intn(256))
+		for isKnownCmd(app, cmd) || unsafeCmds[app][cmd] {
+			cmd = uint8(rng.Intn(256))
+		}
+		payload := randomPayload(rng, rng.Intn(32))
+		return fuzzCase{class, fmt.Sprintf("app=0x%02X cmd=0x%02X len=%d", app, cmd, len(payload)),
+			buildPacket(app, cmd, uint16(len(payload)), payload)}
+
+	default: // truncated
+		n := 1 + rng.Intn(3)
+		packet := []byte{yardstick.AppSystem, yardstick.SysCmdPing, 0x04}[:n]
+		return fuzzCase{"truncated", fmt.Sprintf("%d-byte header", n), packet}
+	}
+}
+
+func isKnownApp(app uint8) bool {
+	for _, a := range knownApps {
+		if a == app {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownCmd(app, cmd uint8) bool {
+	for _, c := range knownCmds[app] {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// runCase sends one fuzz packet and checks the device afterwards
+func runCase(device *yardstick.Device, fc fuzzCase, respWait time.Duration) caseResult {
+	res := caseResult{fc: fc}
+
+	// Start each case from a clean slate so codes can be attributed
+	device.ClearDebugCodes()
+
+	if _, err := device.WriteRaw(fc.packet, 500*time.Millisecond); err != nil {
+		res.pingErr = fmt.Errorf("write failed: %w", err)
+	} else {
+		res.response, _ = device.ReadRaw(respWait)
+	}
+
+	res.code0, res.code1, res.codesErr = device.GetDebugCodes()
+
+	if res.pingErr == nil {
+		if err := device.Ping([]byte{0x55, 0xAA}); err != nil {
+			res.pingErr = err
+		}
+	}
+
+	if res.pingErr != nil {
+		res.recovered = device.RecoverUSB() == nil
+	}
+
+	return res
+}
+
+// status names how the device came through a case
+func (res caseResult) status() string {
+	switch {
+	case res.pingErr == nil:
+		return "ok"
+	case res.recovered:
+		return "recovered"
+	default:
+		return "hung"
+	}
+}
+
+func printResult(out io.Writer, num int, res caseResult, verbose bool) {
+	fmt.Fprintf(out, "#%-4d %-9s %-10s %s\n", num, res.fc.class, strings.ToUpper(res.status()), res.fc.desc)
+	fmt.Fprintf(out, "      packet: % X\n", res.fc.packet)
+	if verbose && len(res.response) > 0 {
+		fmt.Fprintf(out, "      response: % X\n", res.response)
+	}
+	if res.codesErr != nil {
+		fmt.Fprintf(out, "      debug codes: %v\n", res.codesErr)
+	} else if res.code0 != yardstick.LCENoError || res.code1 != yardstick.LCENoError {
+		fmt.Fprintf(out, "      debug codes: 0x%02X (%s), 0x%02X (%s)\n",
+			res.code0, lceName(res.code0), res.code1, lceName(res.code1))
+	}
+	if res.pingErr != nil {
+		fmt.Fprintf(out, "      ping: %v\n", res.pingErr)
+	}
+}
+
+// newCaseReport converts a case result for the JSON result
+func newCaseReport(num int, res caseResult) caseReport {
+	cr := caseReport{
+		Num:      num,
+		Class:    res.fc.class,
+		Status:   res.status(),
+		Desc:     res.fc.desc,
+		Packet:   hex.EncodeToString(res.fc.packet),
+		Response: hex.EncodeToString(res.response),
+		Code0:    res.code0,
+		Code1:    res.code1,
+	}
+	if res.codesErr != nil {
+		cr.CodesError = res.codesErr.Error()
+	}
+	if res.pingErr != nil {
+		cr.PingError = res.pingErr.Error()
+	}
+	return cr
+}
+
+// lceName returns the firmware name for a last-code-error value
+func lceName(code uint8) string {
+	switch code {
+	case yardstick.LCENoError:
+		return "LCE_NO_ERROR"
+	case yardstick.LCEUSBEP5TXWhileInbufWritten:
+		return "LCE_USB_EP5_TX_WHILE_INBUF_WRITTEN"
+	case yardstick.LCEUSBEP0SentStall:
+		return "LCE_USB_EP0_SENT_STALL"
+	case yardstick.LCEUSBEP5OutWhileOutbufWritten:
+		return "LCE_USB_EP5_OUT_WHILE_OUTBUF_WRITTEN"
+	case yardstick.LCEUSBEP5LenTooBig:
+		return "LCE_USB_EP5_LEN_TOO_BIG"
+	case yardstick.LCEUSBEP5GotCrap:
+		return "LCE_USB_EP5_GOT_CRAP"
+	case yardstick.LCEUSBEP5Stall:
+		return "LCE_USB_EP5_STALL"
+	case yardstick.LCERFRXOverflow:
+		return "LCE_RF_RXOVF"
+	case yardstick.LCERFTXUnderflow:
+		return "LCE_RF_TXUNF"
+	default:
+		return "unknown"
+	}
+}
@@ -11,151 +11,167 @@ import (
 
 	"github.com/google/gousb"
 	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
+	"github.com/herlein/gocat/pkg/registers"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
+// loadResult is the -output json result
+type loadResult struct {
+	Config     string                    `json:"config"`
+	Serial     string                    `json:"serial"`
+	Applied    bool                      `json:"applied"`
+	Verified   bool                      `json:"verified"`
+	Mismatches []registers.RegisterCheck `json:"mismatches,omitempty"`
+}
+
 func main() {
 	// Parse command line flags
+	var format output.Format
 	deviceSel := flag.String("d", "", yardstick.DeviceFlagUsage())
 	verbose := flag.Bool("v", false, "Verbose output")
 	verify := flag.Bool("verify", false, "Verify configuration after writing")
+	sessionName := flag.String("session", "", "Record the device and configuration applied in this session; with no config file, apply the session's again")
+	listSessions := flag.Bool("sessions", false, "List saved sessions and exit")
+	flag.Var(&format, "output", output.FlagUsage)
 	flag.Parse()
+	out := format.Progress()
+
+	if *listSessions {
+		if err := printSessions(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitcode.Of(err))
+		}
+		return
+	}
+
+	session, err := openSession(*sessionName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
 
-	// Get config file path from arguments
+	// Get config file path from arguments, else from the session
 	args := flag.Args()
-	if len(args) < 1 {
+	if len(args) < 1 && (session == nil || session.Profile == "") {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] <config-file>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  %s etc/yardsticks/ABC123.json\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -d \"1:10\" etc/defaults.json\n", os.Args[0])
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "  %s -session keyfob etc/433-ook.json   # later: %s -session keyfob\n", os.Args[0], os.Args[0])
+		os.Exit(exitcode.Usage)
 	}
 
-	configPath := args[0]
+	var configPath string
+	if len(args) > 0 {
+		configPath = args[0]
+	} else {
+		configPath = session.Profile
+	}
 
 	// Load configuration from file
 	if *verbose {
-		fmt.Printf("Loading configuration from: %s\n", configPath)
+		fmt.Fprintf(out, "Loading configuration from: %s\n", configPath)
 	}
 
 	configuration, err := config.LoadFromFile(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
 	if *verbose {
-		fmt.Printf("Configuration loaded:\n")
-		fmt.Printf("  Original Serial:    %s\n", configuration.Serial)
-		fmt.Printf("  Original Product:   %s %s\n", configuration.Manufacturer, configuration.Product)
-		fmt.Printf("  Original Timestamp: %s\n", configuration.Timestamp.Format("2006-01-02 15:04:05"))
-		fmt.Printf("  Build Type:         %s\n", configuration.BuildType)
-		fmt.Printf("  Frequency:          %.6f MHz\n", configuration.GetFrequencyMHz())
-		fmt.Printf("  Sync Word:          0x%04X\n", configuration.GetSyncWord())
-		fmt.Printf("  Modulation:         %s\n", configuration.GetModulationString())
+		fmt.Fprintf(out, "Configuration loaded:\n")
+		fmt.Fprintf(out, "  Original Serial:    %s\n", configuration.Serial)
+		fmt.Fprintf(out, "  Original Product:   %s %s\n", configuration.Manufacturer, configuration.Product)
+		fmt.Fprintf(out, "  Original Timestamp: %s\n", configuration.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(out, "  Build Type:         %s\n", configuration.BuildType)
+		fmt.Fprintf(out, "  Frequency:          %.6f MHz\n", configuration.GetFrequencyMHz())
+		fmt.Fprintf(out, "  Sync Word:          0x%04X\n", configuration.GetSyncWord())
+		fmt.Fprintf(out, "  Modulation:         %s\n", configuration.GetModulationString())
+		fmt.Fprintf(out, "  Radio:              %s\n", configuration.Registers.Summary())
 	}
 
 	// Create USB context
 	context := gousb.NewContext()
 	defer context.Close()
 
-	// Select device
+	// Select device; a session remembers the one it was applied to
+	if *deviceSel == "" && session != nil {
+		*deviceSel = session.Device
+	}
 	device, err := yardstick.SelectDevice(context, yardstick.DeviceSelector(*deviceSel))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	defer device.Close()
 
 	if *verbose {
-		fmt.Printf("\nConnected to: %s\n", device)
+		fmt.Fprintf(out, "\nConnected to: %s\n", device)
 	}
 
 	// Test connectivity with ping
 	if *verbose {
-		fmt.Print("Testing connectivity... ")
+		fmt.Fprint(out, "Testing connectivity... ")
 	}
 	if err := device.Ping([]byte("TEST")); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Ping failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 	if *verbose {
-		fmt.Println("OK")
+		fmt.Fprintln(out, "OK")
 	}
 
 	// Apply configuration
 	if *verbose {
-		fmt.Println("Applying configuration...")
+		fmt.Fprintln(out, "Applying configuration...")
 	}
 
 	if err := config.ApplyToDevice(device, configuration); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to apply configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.Of(err))
 	}
 
-	fmt.Println("Configuration applied successfully")
+	fmt.Fprintln(out, "Configuration applied successfully")
+	result := &loadResult{Config: configPath, Serial: device.Serial, Applied: true}
+
+	if session != nil {
+		if err := saveSession(session, device, configPath, configuration); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save session: %v\n", err)
+		}
+	}
 
 	// Verify if requested
 	if *verify {
 		if *verbose {
-			fmt.Println("\nVerifying configuration...")
+			fmt.Fprintln(out, "\nVerifying configuration...")
 		}
 
-		readBack, err := config.DumpFromDevice(device)
+		check, err := registers.VerifyRegisters(device, &configuration.Registers)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: Failed to read back configuration for verification: %v\n", err)
 		} else {
-			errors := verifyConfig(configuration, readBack)
-			if len(errors) > 0 {
-				fmt.Fprintf(os.Stderr, "Verification failed with %d error(s):\n", len(errors))
-				for _, e := range errors {
-					fmt.Fprintf(os.Stderr, "  - %s\n", e)
+			result.Mismatches = check.Mismatches()
+			result.Verified = len(result.Mismatches) == 0
+			if !result.Verified {
+				fmt.Fprintf(os.Stderr, "Verification failed with %d error(s):\n", len(result.Mismatches))
+				for _, m := range result.Mismatches {
+					fmt.Fprintf(os.Stderr, "  - %s\n", m)
 				}
-				os.Exit(1)
+			} else {
+				fmt.Fprintln(out, "Verification: OK")
 			}
-			fmt.Println("Verification: OK")
 		}
 	}
-}
-
-func verifyConfig(expected, actual *config.DeviceConfig) []string {
-	var errors []string
 
-	// Compare key registers (not all, since some are read-only or volatile)
-	e := &expected.Registers
-	a := &actual.Registers
-
-	if e.SYNC1 != a.SYNC1 || e.SYNC0 != a.SYNC0 {
-		errors = append(errors, fmt.Sprintf("SYNC mismatch: expected 0x%02X%02X, got 0x%02X%02X",
-			e.SYNC1, e.SYNC0, a.SYNC1, a.SYNC0))
+	if format.IsJSON() {
+		output.Write(result)
 	}
-
-	if e.FREQ2 != a.FREQ2 || e.FREQ1 != a.FREQ1 || e.FREQ0 != a.FREQ0 {
-		errors = append(errors, fmt.Sprintf("FREQ mismatch: expected 0x%02X%02X%02X, got 0x%02X%02X%02X",
-			e.FREQ2, e.FREQ1, e.FREQ0, a.FREQ2, a.FREQ1, a.FREQ0))
+	if len(result.Mismatches) > 0 {
+		os.Exit(exitcode.VerifyFailed)
 	}
-
-	if e.MDMCFG2 != a.MDMCFG2 {
-		errors = append(errors, fmt.Sprintf("MDMCFG2 mismatch: expected 0x%02X, got 0x%02X",
-			e.MDMCFG2, a.MDMCFG2))
-	}
-
-	if e.PKTLEN != a.PKTLEN {
-		errors = append(errors, fmt.Sprintf("PKTLEN mismatch: expected %d, got %d",
-			e.PKTLEN, a.PKTLEN))
-	}
-
-	if e.PKTCTRL0 != a.PKTCTRL0 {
-		errors = append(errors, fmt.Sprintf("PKTCTRL0 mismatch: expected 0x%02X, got 0x%02X",
-			e.PKTCTRL0, a.PKTCTRL0))
-	}
-
-	if e.PKTCTRL1 != a.PKTCTRL1 {
-		errors = append(errors, fmt.Sprintf("PKTCTRL1 mismatch: expected 0x%02X, got 0x%02X",
-			e.PKTCTRL1, a.PKTCTRL1))
-	}
-
-	return errors
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/sessionstate"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// openSession loads the -session; nil if none is given
+func openSession(name string) (*sessionstate.State, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return sessionstate.Load(name)
+}
+
+// saveSession records the device and configuration just applied, so the
+// session can be applied again without naming either
+func saveSession(s *sessionstate.State, device *yardstick.Device, configPath string, cfg *config.DeviceConfig) error {
+	// Absolute, so the session works from any directory
+	if abs, err := filepath.Abs(configPath); err == nil {
+		configPath = abs
+	}
+	s.Device = device.Serial
+	s.Profile = configPath
+	s.FrequencyHz = uint32(cfg.GetFrequencyMHz()*1e6 + 0.5)
+	s.AddCommand(strings.Join(os.Args[1:], " "))
+	return s.Save()
+}
+
+// printSessions lists the saved sessions, most recently used first
+func printSessions() error {
+	names, err := sessionstate.List()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Println("No saved sessions")
+		return nil
+	}
+	for _, name := range names {
+		s, err := sessionstate.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("%-20s %-12s %11.6f MHz  %s  %s\n", name, s.Device, float64(s.FrequencyHz)/1e6,
+			s.UpdatedAt.Format("2006-01-02 15:04"), s.Profile)
+	}
+	return nil
+}
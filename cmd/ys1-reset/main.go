@@ -2,14 +2,36 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/output"
 )
 
+// resetResult is the -output json result
+type resetResult struct {
+	Attempts int           `json:"attempts"`
+	Devices  []resetDevice `json:"devices"`
+}
+
+// resetDevice is one device's reset outcome
+type resetDevice struct {
+	Index  int    `json:"index"`
+	Serial string `json:"serial"`
+	Reset  bool   `json:"reset"`
+	Error  string `json:"error,omitempty"`
+}
+
 func main() {
+	var format output.Format
+	flag.Var(&format, "output", output.FlagUsage)
+	flag.Parse()
+	out := format.Progress()
+
 	ctx := gousb.NewContext()
 	defer ctx.Close()
 
@@ -20,33 +42,41 @@ func main() {
 		})
 
 		if err != nil {
-			fmt.Printf("Attempt %d: Error finding devices: %v\n", attempt+1, err)
+			fmt.Fprintf(out, "Attempt %d: Error finding devices: %v\n", attempt+1, err)
 			time.Sleep(time.Second)
 			continue
 		}
 
 		if len(devs) == 0 {
-			fmt.Printf("Attempt %d: No devices found\n", attempt+1)
+			fmt.Fprintf(out, "Attempt %d: No devices found\n", attempt+1)
 			time.Sleep(time.Second)
 			continue
 		}
 
-		fmt.Printf("Found %d device(s)\n", len(devs))
+		result := &resetResult{Attempts: attempt + 1}
+		fmt.Fprintf(out, "Found %d device(s)\n", len(devs))
 		for i, dev := range devs {
 			serial, _ := dev.SerialNumber()
-			fmt.Printf("  Device %d: %s\n", i, serial)
+			fmt.Fprintf(out, "  Device %d: %s\n", i, serial)
 
 			// Reset the device
+			entry := resetDevice{Index: i, Serial: serial}
 			if err := dev.Reset(); err != nil {
-				fmt.Printf("    Reset failed: %v\n", err)
+				fmt.Fprintf(out, "    Reset failed: %v\n", err)
+				entry.Error = err.Error()
 			} else {
-				fmt.Printf("    Reset OK\n")
+				fmt.Fprintf(out, "    Reset OK\n")
+				entry.Reset = true
 			}
+			result.Devices = append(result.Devices, entry)
 			dev.Close()
 		}
+		if format.IsJSON() {
+			output.Write(result)
+		}
 		os.Exit(0)
 	}
 
-	fmt.Println("Failed to find/reset devices after 3 attempts")
-	os.Exit(1)
+	fmt.Fprintln(out, "Failed to find/reset devices after 3 attempts")
+	os.Exit(exitcode.DeviceNotFound)
 }
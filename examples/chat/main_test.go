@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/yardstick/mock"
+)
+
+func TestLoopback(t *testing.T) {
+	if err := run(&link.Flags{Loopback: true}, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	a, b := mock.Pair()
+	defer a.Close()
+	defer b.Close()
+	if err := b.SetModeRX(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := exchange(a, b, []byte("hello"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("received %q, want %q", got, "hello")
+	}
+
+	// Nothing arrives while the far end is idle
+	if err := b.SetModeIDLE(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := exchange(a, b, []byte("lost"), 50*time.Millisecond); err == nil {
+		t.Errorf("idle node received %q", got)
+	}
+}
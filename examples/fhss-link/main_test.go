@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+)
+
+func TestLoopback(t *testing.T) {
+	if err := run(&link.Flags{Loopback: true}, hopSequence(10, 1), 20, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHopSequence(t *testing.T) {
+	seq := hopSequence(25, 7)
+	if !reflect.DeepEqual(seq, hopSequence(25, 7)) {
+		t.Error("the same seed gave different sequences")
+	}
+
+	// Every channel appears exactly once
+	sorted := append([]uint8(nil), seq...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, c := range sorted {
+		if int(c) != i {
+			t.Fatalf("sequence %v is not a permutation of 0-24", seq)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package link opens the two radios an example talks between: a pair of
+// mock dongles sharing one ether for -loopback runs, or two YardStick Ones.
+package link
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+	"github.com/herlein/gocat/pkg/yardstick/mock"
+)
+
+// Role is which radios an example uses on hardware; -loopback always
+// runs both so the result can be checked
+type Role int
+
+// Roles
+const (
+	Both   Role = iota // A transmitter and a receiver, -tx and -rx
+	TXOnly             // One transmitting dongle, -d
+	RXOnly             // One receiving dongle, -d
+)
+
+// Flags are the device selection flags every example shares
+type Flags struct {
+	Loopback bool
+	TX       string
+	RX       string
+
+	role Role
+}
+
+// Register adds -loopback and the device flags for role to the default
+// flag set
+func (f *Flags) Register(role Role) {
+	f.role = role
+	flag.BoolVar(&f.Loopback, "loopback", false, "Run against two mock dongles instead of hardware and check the result")
+	switch role {
+	case Both:
+		flag.StringVar(&f.TX, "tx", "#0", "Transmitting device: "+yardstick.DeviceFlagUsage())
+		flag.StringVar(&f.RX, "rx", "#1", "Receiving device: "+yardstick.DeviceFlagUsage())
+	case TXOnly:
+		flag.StringVar(&f.TX, "d", "", yardstick.DeviceFlagUsage())
+	case RXOnly:
+		flag.StringVar(&f.RX, "d", "", yardstick.DeviceFlagUsage())
+	}
+}
+
+// Link is the opened radios; on hardware the one a TXOnly or RXOnly
+// example does not use is nil
+type Link struct {
+	TX, RX   *yardstick.Device
+	Loopback bool
+
+	usb *gousb.Context
+}
+
+// Open opens the radios the flags select
+func Open(f *Flags) (*Link, error) {
+	if f.Loopback {
+		tx, rx := mock.Pair()
+		return &Link{TX: tx, RX: rx, Loopback: true}, nil
+	}
+
+	l := &Link{usb: gousb.NewContext()}
+	var err error
+	if f.role != RXOnly {
+		if l.TX, err = yardstick.SelectDevice(l.usb, yardstick.DeviceSelector(f.TX)); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("transmitter: %w", err)
+		}
+	}
+	if f.role != TXOnly {
+		if l.RX, err = yardstick.SelectDevice(l.usb, yardstick.DeviceSelector(f.RX)); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("receiver: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Apply configures the opened radios with a profile
+func (l *Link) Apply(p *profiles.Profile) error {
+	for _, d := range []*yardstick.Device{l.TX, l.RX} {
+		if d == nil {
+			continue
+		}
+		if err := config.ApplyProfile(d, p); err != nil {
+			return fmt.Errorf("failed to apply profile '%s' to %s: %w", p.Name, d.Serial, err)
+		}
+	}
+	return nil
+}
+
+// Close releases the radios
+func (l *Link) Close() {
+	if l.TX != nil {
+		l.TX.Close()
+	}
+	if l.RX != nil {
+		l.RX.Close()
+	}
+	if l.usb != nil {
+		l.usb.Close()
+	}
+}
@@ -0,0 +1,168 @@
+// replay-sub: Replay a Flipper Zero .sub RAW recording
+//
+// pkg/capture reads the file into one packet per burst, sliced into OOK
+// bits at the burst's symbol period. Each burst is sent on a no-sync OOK
+// profile at the file's frequency and at the data rate its pulses imply,
+// followed by two bytes of silence so consecutive bursts stay apart.
+//
+// With -loopback and no -file, an EV1527 remote press is encoded with
+// pkg/princeton and written to a temporary .sub file first. The mock
+// receiver must get every burst bit for bit and decode the original code;
+// the program exits non-zero otherwise.
+//
+// Examples:
+//
+//	# Replay a recording
+//	go run ./examples/replay-sub -d '#0' -file garage.sub
+//
+//	# Self-check without hardware
+//	go run ./examples/replay-sub -loopback
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/princeton"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// burstPadding is the silence sent after each burst
+var burstPadding = []byte{0, 0}
+
+func main() {
+	var lf link.Flags
+	lf.Register(link.TXOnly)
+	path := flag.String("file", "", "Flipper .sub RAW file to replay (required unless -loopback)")
+	speed := flag.Float64("speed", 1, "Replay speed for files with timestamps; 0 sends back to back")
+	flag.Parse()
+
+	if *path == "" && !lf.Loopback {
+		fmt.Fprintf(os.Stderr, "Error: -file is required\n")
+		os.Exit(exitcode.Usage)
+	}
+
+	if err := run(&lf, *path, *speed); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+func run(lf *link.Flags, path string, speed float64) error {
+	var want *princeton.Code
+	if path == "" {
+		dir, err := os.MkdirTemp("", "replay-sub")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "remote.sub")
+		if want, err = writeRemote(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s to %s\n", want, path)
+	}
+
+	r, err := capture.Open(path, capture.FormatSub)
+	if err != nil {
+		return exitcode.Errorf(exitcode.Usage, "%w", err)
+	}
+	defer r.Close()
+
+	l, err := link.Open(lf)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	var profile *profiles.Profile
+	bursts, failed, decoded := 0, 0, 0
+	err = capture.Play(context.Background(), r, speed, func(p *capture.Packet) error {
+		if len(p.Pulses) == 0 {
+			fmt.Fprintf(os.Stderr, "Skipping a packet without pulse timings (only RAW files can be replayed)\n")
+			return nil
+		}
+		bursts++
+
+		rate := 1e6 / float64(capture.EstimateSymbolPeriod(p.Pulses))
+		data := append(append([]byte(nil), p.Data...), burstPadding...)
+		pktLen := uint8(min(len(data), yardstick.RFMaxTXBlock))
+		if profile == nil || profile.DataRateBaud != rate || uint32(profile.FrequencyHz) != p.Frequency || profile.PktLen != pktLen {
+			profile = profiles.New433OOKPWM(rate)
+			profile.FrequencyHz = float64(p.Frequency)
+			profile.PktLen = pktLen
+			if err := l.Apply(profile); err != nil {
+				return exitcode.Errorf(exitcode.ConfigInvalid, "%w", err)
+			}
+			if l.RX != nil {
+				if err := l.RX.SetModeRX(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := l.TX.RFXmit(data, 0, 0); err != nil {
+			return fmt.Errorf("transmit failed: %w", err)
+		}
+		fmt.Printf("burst %d: %d bytes at %.3f MHz, %.0f baud\n", bursts, len(data), float64(p.Frequency)/1e6, rate)
+
+		if l.RX == nil {
+			return nil
+		}
+		got, err := l.RX.RFRecv(time.Second, 0)
+		if err != nil || !bytes.Equal(got, data) {
+			failed++
+			fmt.Printf("  not received intact\n")
+			return nil
+		}
+		for _, c := range princeton.Demodulate(got, rate) {
+			fmt.Printf("  received %s\n", c)
+			if want != nil && c.String() == want.String() {
+				decoded++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Replayed %d bursts\n", bursts)
+	if l.Loopback {
+		switch {
+		case bursts == 0:
+			return exitcode.Errorf(exitcode.RFTestFailed, "no RAW bursts to replay in %s", path)
+		case failed > 0:
+			return exitcode.Errorf(exitcode.RFTestFailed, "%d of %d bursts not received intact", failed, bursts)
+		case want != nil && decoded == 0:
+			return exitcode.Errorf(exitcode.RFTestFailed, "received bursts did not decode as %s", want)
+		}
+	}
+	return nil
+}
+
+// writeRemote writes four presses of an EV1527 code to a .sub file
+func writeRemote(path string) (*princeton.Code, error) {
+	code, err := princeton.NewEV1527(0x5A5A5, 0x3, 350)
+	if err != nil {
+		return nil, err
+	}
+	w, err := capture.Create(path, capture.FormatSub, capture.NewHeader())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Write(&capture.Packet{Frequency: 433920000, Pulses: code.Pulses(4)}); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return code, w.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/capture"
+)
+
+func TestLoopback(t *testing.T) {
+	if err := run(&link.Flags{Loopback: true}, "", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoopbackFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remote.sub")
+	if _, err := writeRemote(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(&link.Flags{Loopback: true}, path, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteRemote(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remote.sub")
+	code, err := writeRemote(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := capture.Open(path, capture.FormatSub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Each press reads back as its own burst, without the gap after it
+	press := code.Pulses(1)
+	press = press[:len(press)-1]
+	bursts := 0
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Frequency != 433920000 {
+			t.Errorf("packet at %d Hz", p.Frequency)
+		}
+		if !reflect.DeepEqual(p.Pulses, press) {
+			t.Errorf("burst %d = %v, want %v", bursts+1, p.Pulses, press)
+		}
+		bursts++
+	}
+	if bursts != 4 {
+		t.Errorf("read back %d bursts, want 4", bursts)
+	}
+}
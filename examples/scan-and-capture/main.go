@@ -0,0 +1,246 @@
+// scan-and-capture: Find the strongest signal in a band and record it
+//
+// A pkg/specan sweep around -f holds the peak RSSI of every channel for
+// -scan; the radio is then configured with -profile, tuned to the
+// strongest channel above -threshold and every packet pkg/rxstream
+// receives for -duration is written to a native capture with a header
+// describing the setup, ready for send-recv -replay or gocat capture.
+//
+// With -loopback the sweep is skipped (the mock dongles have no spectrum
+// analyzer) and the mock transmitter sends -count numbered packets at -f.
+// The capture is then read back and the program exits non-zero unless it
+// holds every packet intact, in order.
+//
+// Examples:
+//
+//	# Find and record whatever is loudest around 433.92 MHz
+//	go run ./examples/scan-and-capture -d '#0' -o capture.jsonl
+//
+//	# Self-check without hardware
+//	go run ./examples/scan-and-capture -loopback
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+type options struct {
+	freqMHz   float64
+	bwMHz     float64
+	scan      time.Duration
+	threshold float64
+	profile   string
+	duration  time.Duration
+	out       string
+	count     int
+}
+
+func main() {
+	var lf link.Flags
+	lf.Register(link.RXOnly)
+	var opts options
+	flag.Float64Var(&opts.freqMHz, "f", 433.92, "Centre of the sweep in MHz")
+	flag.Float64Var(&opts.bwMHz, "bw", 2, "Width of the sweep in MHz")
+	flag.DurationVar(&opts.scan, "scan", 2*time.Second, "How long to sweep")
+	flag.Float64Var(&opts.threshold, "threshold", -70, "Weakest peak, in dBm, worth capturing")
+	flag.StringVar(&opts.profile, "profile", profiles.New433GFSKCRC(38400, false).Name, "Built-in profile to capture with")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Second, "How long to capture")
+	flag.StringVar(&opts.out, "o", "", "Capture file to write (required unless -loopback)")
+	flag.IntVar(&opts.count, "count", 10, "Packets the -loopback transmitter sends")
+	flag.Parse()
+
+	if opts.out == "" && !lf.Loopback {
+		fmt.Fprintf(os.Stderr, "Error: -o is required\n")
+		os.Exit(exitcode.Usage)
+	}
+
+	if err := run(&lf, &opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+func run(lf *link.Flags, opts *options) error {
+	profile := profiles.Find(opts.profile)
+	if profile == nil {
+		return exitcode.Errorf(exitcode.Usage, "unknown profile '%s'", opts.profile)
+	}
+
+	l, err := link.Open(lf)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	freqHz := uint32(opts.freqMHz * 1e6)
+	if !l.Loopback {
+		if freqHz, err = strongest(l.RX, opts); err != nil {
+			return err
+		}
+	}
+
+	profile.FrequencyHz = float64(freqHz)
+	if err := l.Apply(profile); err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%w", err)
+	}
+
+	path := opts.out
+	if path == "" {
+		dir, err := os.MkdirTemp("", "scan-and-capture")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "capture.jsonl")
+	}
+	hdr := capture.NewHeader()
+	hdr.Profile = profile.Name
+	hdr.FrequencyHz = freqHz
+	hdr.DataRate = profile.DataRateBaud
+	hdr.Tool = "scan-and-capture"
+	w, err := capture.Create(path, capture.FormatNative, hdr)
+	if err != nil {
+		return err
+	}
+
+	stream := rxstream.New(l.RX, &rxstream.Options{})
+	if err := stream.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to start receiving: %w", err)
+	}
+
+	var sent [][]byte
+	duration := opts.duration
+	if l.Loopback {
+		duration = time.Second
+		for i := 1; i <= opts.count; i++ {
+			msg := []byte(fmt.Sprintf("packet %d of %d", i, opts.count))
+			if err := l.TX.RFXmit(msg, 0, 0); err != nil {
+				stream.Stop()
+				w.Close()
+				return fmt.Errorf("transmit failed: %w", err)
+			}
+			sent = append(sent, msg)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Capturing at %.3f MHz with %s for %s\n", float64(freqHz)/1e6, profile.Name, duration)
+	captured := 0
+	deadline := time.After(duration)
+listen:
+	for {
+		select {
+		case <-deadline:
+			break listen
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				break listen
+			}
+			rec := &capture.Packet{Timestamp: pkt.Timestamp, Data: pkt.Raw, Frequency: freqHz}
+			if pkt.RSSIValid {
+				rec.RSSI = pkt.RSSI
+			}
+			if err := w.Write(rec); err != nil {
+				stream.Stop()
+				w.Close()
+				return fmt.Errorf("failed to record packet: %w", err)
+			}
+			captured++
+		}
+	}
+	stream.Stop()
+	if err := w.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Captured %d packets to %s\n", captured, path)
+
+	if l.Loopback {
+		return verify(path, sent)
+	}
+	return nil
+}
+
+// strongest sweeps the band and returns the frequency of the strongest
+// peak above the threshold
+func strongest(device *yardstick.Device, opts *options) (uint32, error) {
+	sa := specan.New(device)
+	if err := sa.Configure(&specan.Config{
+		CenterFreq: uint32(opts.freqMHz * 1e6),
+		Bandwidth:  uint32(opts.bwMHz * 1e6),
+		NumChans:   100,
+	}); err != nil {
+		return 0, err
+	}
+	if err := sa.Start(); err != nil {
+		return 0, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Sweeping %.3f MHz +/- %.1f MHz for %s\n", opts.freqMHz, opts.bwMHz/2, opts.scan)
+	var peak *specan.Frame
+	timer := time.NewTimer(opts.scan)
+	defer timer.Stop()
+sweep:
+	for {
+		select {
+		case frame, ok := <-sa.Frames():
+			if !ok {
+				break sweep
+			}
+			peak = specan.PeakHold(peak, frame)
+		case <-timer.C:
+			break sweep
+		}
+	}
+	if err := sa.Stop(); err != nil {
+		return 0, err
+	}
+	if peak == nil {
+		return 0, fmt.Errorf("the sweep returned no spectrum")
+	}
+
+	_, freqHz, rssi := specan.MaxRSSI(peak)
+	if rssi < float32(opts.threshold) {
+		return 0, exitcode.Errorf(exitcode.RFTestFailed, "nothing above %.0f dBm (strongest %.1f dBm at %.3f MHz)", opts.threshold, rssi, float64(freqHz)/1e6)
+	}
+	fmt.Fprintf(os.Stderr, "Strongest signal %.1f dBm at %.3f MHz\n", rssi, float64(freqHz)/1e6)
+	return freqHz, nil
+}
+
+// verify reads a capture back and checks it holds exactly the sent packets
+func verify(path string, sent [][]byte) error {
+	r, err := capture.Open(path, capture.FormatNative)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for i := 0; ; i++ {
+		p, err := r.Next()
+		if err == io.EOF {
+			if i != len(sent) {
+				return exitcode.Errorf(exitcode.RFTestFailed, "captured %d of %d packets", i, len(sent))
+			}
+			fmt.Fprintf(os.Stderr, "All %d packets captured intact\n", i)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if i >= len(sent) || string(p.Data) != string(sent[i]) {
+			return exitcode.Errorf(exitcode.RFTestFailed, "captured packet %d is %q, not what was sent", i+1, p.Data)
+		}
+	}
+}
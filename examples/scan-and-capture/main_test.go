@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/profiles"
+)
+
+func loopbackOptions(out string) *options {
+	return &options{
+		freqMHz:  433.92,
+		profile:  profiles.New433GFSKCRC(38400, false).Name,
+		duration: time.Second,
+		out:      out,
+		count:    5,
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	if err := run(&link.Flags{Loopback: true}, loopbackOptions("")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoopbackKeepsCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	if err := run(&link.Flags{Loopback: true}, loopbackOptions(path)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := capture.Open(path, capture.FormatNative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	n := 0
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Frequency != 433920000 {
+			t.Errorf("packet %d at %d Hz", n+1, p.Frequency)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("kept %d packets, want 5", n)
+	}
+}
+
+func TestUnknownProfile(t *testing.T) {
+	opts := loopbackOptions("")
+	opts.profile = "no-such-profile"
+	if err := run(&link.Flags{Loopback: true}, opts); exitcode.Of(err) != exitcode.Usage {
+		t.Errorf("run = %v, want a usage error", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	w, err := capture.Create(path, capture.FormatNative, capture.NewHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"one", "two"} {
+		if err := w.Write(&capture.Packet{Data: []byte(s)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		sent []string
+		ok   bool
+	}{
+		{[]string{"one", "two"}, true},
+		{[]string{"one", "two", "three"}, false},
+		{[]string{"one"}, false},
+		{[]string{"one", "too"}, false},
+	} {
+		var sent [][]byte
+		for _, s := range tc.sent {
+			sent = append(sent, []byte(s))
+		}
+		err := verify(path, sent)
+		if tc.ok && err != nil {
+			t.Errorf("verify(%q) = %v", tc.sent, err)
+		}
+		if !tc.ok && exitcode.Of(err) != exitcode.RFTestFailed {
+			t.Errorf("verify(%q) = %v, want an RF test failure", tc.sent, err)
+		}
+	}
+}
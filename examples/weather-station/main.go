@@ -0,0 +1,187 @@
+// weather-station: Decode 433 MHz weather sensors from raw OOK blocks
+//
+// The receiver runs a no-sync OOK profile oversampled at
+// weather.DefaultSampleRate and streams fixed 255-byte blocks through
+// pkg/rxstream into a weather.Receiver, which reassembles bursts that span
+// blocks and decodes Oregon Scientific, Nexus and Acurite messages.
+//
+// With -loopback the mock transmitter plays the part of a Nexus
+// temperature/humidity sensor: its reading is encoded as pulse positions,
+// sampled at the receive rate and sent block by block. The program exits
+// non-zero unless the receiver decodes exactly that reading.
+//
+// Examples:
+//
+//	# Print sensors heard in the next minute
+//	go run ./examples/weather-station -d '#0'
+//
+//	# Self-check without hardware
+//	go run ./examples/weather-station -loopback
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+	"github.com/herlein/gocat/pkg/decoders/weather"
+	"github.com/herlein/gocat/pkg/exitcode"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rxstream"
+)
+
+// blockLen is the raw block size, the longest fixed packet the radio takes
+const blockLen = 255
+
+// sensor is the reading the -loopback transmitter sends
+var sensor = weather.Reading{
+	Protocol:     weather.Nexus,
+	Model:        "Nexus-TH",
+	ID:           0xA7,
+	Channel:      "2",
+	TemperatureC: -3.4,
+	Humidity:     61,
+}
+
+func main() {
+	var lf link.Flags
+	lf.Register(link.RXOnly)
+	freqMHz := flag.Float64("f", 433.92, "Frequency in MHz")
+	duration := flag.Duration("duration", time.Minute, "How long to listen")
+	flag.Parse()
+
+	if err := run(&lf, *freqMHz, *duration); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+func run(lf *link.Flags, freqMHz float64, duration time.Duration) error {
+	l, err := link.Open(lf)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	profile := profiles.New433OOKPWM(weather.DefaultSampleRate)
+	profile.FrequencyHz = freqMHz * 1e6
+	profile.PktLen = blockLen
+	if err := l.Apply(profile); err != nil {
+		return exitcode.Errorf(exitcode.ConfigInvalid, "%w", err)
+	}
+
+	stream := rxstream.New(l.RX, &rxstream.Options{})
+	if err := stream.Start(); err != nil {
+		return fmt.Errorf("failed to start receiving: %w", err)
+	}
+	defer stream.Stop()
+
+	if l.Loopback {
+		duration = 2 * time.Second
+		if err := transmitNexus(l, &sensor); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Listening at %.3f MHz for %s\n", freqMHz, duration)
+	receiver := weather.NewReceiver(weather.DefaultSampleRate)
+	seen := make(map[string]*weather.Reading)
+	show := func(readings []*weather.Reading) {
+		for _, r := range readings {
+			if _, dup := seen[r.Key()]; dup {
+				continue
+			}
+			seen[r.Key()] = r
+			fmt.Println(r)
+		}
+	}
+
+	deadline := time.After(duration)
+listen:
+	for {
+		select {
+		case <-deadline:
+			break listen
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				break listen
+			}
+			show(receiver.Add(pkt.Raw))
+		}
+	}
+	show(receiver.Flush())
+
+	fmt.Fprintf(os.Stderr, "%d sensors heard\n", len(seen))
+	if !l.Loopback {
+		return nil
+	}
+	for _, r := range seen {
+		if r.Protocol == sensor.Protocol && r.ID == sensor.ID && r.Channel == sensor.Channel &&
+			r.TemperatureC == sensor.TemperatureC && r.Humidity == sensor.Humidity {
+			return nil
+		}
+	}
+	return exitcode.Errorf(exitcode.RFTestFailed, "did not decode the transmitted reading %s", &sensor)
+}
+
+// transmitNexus sends one burst of a Nexus sensor: ten copies of the
+// 36-bit message, then enough silence to end the burst
+func transmitNexus(l *link.Link, r *weather.Reading) error {
+	channel := int(r.Channel[0] - '1')
+	temp := int(math.Round(r.TemperatureC*10)) & 0xFFF
+	fields := []struct{ v, n int }{
+		{int(r.ID), 8}, {1, 1}, {0, 1}, {channel, 2}, {temp, 12}, {0xF, 4}, {r.Humidity, 8},
+	}
+
+	var pulses []int
+	for repeat := 0; repeat < 10; repeat++ {
+		for _, f := range fields {
+			for i := f.n - 1; i >= 0; i-- {
+				gap := 1000
+				if f.v>>uint(i)&1 == 1 {
+					gap = 2000
+				}
+				pulses = append(pulses, 500, -gap)
+			}
+		}
+		pulses = append(pulses, 500, -4000)
+	}
+	pulses[len(pulses)-1] = -2 * weather.QuietUs
+
+	samples := sample(pulses, weather.DefaultSampleRate)
+	for len(samples)%blockLen != 0 {
+		samples = append(samples, 0)
+	}
+	for i := 0; i < len(samples); i += blockLen {
+		if err := l.TX.RFXmit(samples[i:i+blockLen], 0, 0); err != nil {
+			return fmt.Errorf("transmit failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// sample turns signed pulse durations in microseconds into OOK bits at
+// rate baud, MSB first
+func sample(pulses []int, rate float64) []byte {
+	var out []byte
+	n := 0
+	for _, p := range pulses {
+		level := byte(0)
+		if p > 0 {
+			level = 1
+		} else {
+			p = -p
+		}
+		for i := 0; i < int(float64(p)*rate/1e6+0.5); i++ {
+			if n%8 == 0 {
+				out = append(out, 0)
+			}
+			out[len(out)-1] |= level << uint(7-n%8)
+			n++
+		}
+	}
+	return out
+}
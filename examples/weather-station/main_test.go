@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/examples/internal/link"
+)
+
+func TestLoopback(t *testing.T) {
+	if err := run(&link.Flags{Loopback: true}, 433.92, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSample(t *testing.T) {
+	// At 1000 baud each bit is 1 ms
+	got := sample([]int{3000, -2000, 1000, -2000}, 1000)
+	if want := []byte{0xE4}; !bytes.Equal(got, want) {
+		t.Errorf("sample = %X, want %X", got, want)
+	}
+}
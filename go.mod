@@ -2,4 +2,26 @@ module github.com/herlein/gocat
 
 go 1.21
 
-require github.com/google/gousb v1.1.3
+require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/gdamore/tcell/v2 v2.7.4
+	github.com/google/gousb v1.1.3
+	github.com/mattn/go-sqlite3 v1.14.22
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/term v0.18.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/gdamore/encoding v1.0.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sync v0.6.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
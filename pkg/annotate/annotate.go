@@ -0,0 +1,180 @@
+// Package annotate provides a composable annotation pipeline for received packets
+//
+// A Pipeline runs each Record through an ordered list of Stages (decoders,
+// CRC checkers, de-whitening, field extractors) and then hands the annotated
+// Record to every registered Sink. Outputs only ever see Records, so a new
+// protocol is added as a Stage without touching any output.
+package annotate
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/rxstream"
+)
+
+// Record is a received packet together with everything the pipeline learned about it
+type Record struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Raw       []byte                 `json:"raw"`
+	Data      []byte                 `json:"data"`             // Working payload, rewritten by decoding stages
+	Pulses    []int                  `json:"pulses,omitempty"` // Signed pulse timings in microseconds, if captured
+	Protocol  string                 `json:"protocol,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Notes     []string               `json:"notes,omitempty"`
+	Drop      bool                   `json:"-"` // Set by a stage to stop processing and skip sinks
+}
+
+// NewRecord creates a Record from a received packet
+func NewRecord(pkt *rxstream.Packet) *Record {
+	rec := &Record{
+		Timestamp: pkt.Timestamp,
+		Raw:       pkt.Raw,
+		Data:      pkt.Processed,
+		Fields:    make(map[string]interface{}),
+	}
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	if pkt.CRCChecked {
+		rec.Fields["crc_ok"] = pkt.CRCOk
+	}
+	if pkt.RSSIValid {
+		rec.Fields["rssi_dbm"] = pkt.RSSI
+	}
+	if pkt.Burst > 0 {
+		setTiming(rec, pkt.Delta, pkt.Burst, pkt.BurstIndex)
+	}
+	return rec
+}
+
+// NewRecordFromBytes creates a Record from raw packet bytes
+func NewRecordFromBytes(data []byte, timestamp time.Time) *Record {
+	return NewRecord(&rxstream.Packet{Timestamp: timestamp, Raw: data, Processed: data})
+}
+
+// setTiming records inter-packet timing fields
+func setTiming(rec *Record, delta time.Duration, burst, index int) {
+	rec.Set("delta_us", delta.Microseconds())
+	rec.Set("burst", burst)
+	rec.Set("burst_index", index)
+}
+
+// Set records a named field value
+func (r *Record) Set(name string, value interface{}) {
+	if r.Fields == nil {
+		r.Fields = make(map[string]interface{})
+	}
+	r.Fields[name] = value
+}
+
+// Note appends a free-form annotation
+func (r *Record) Note(format string, args ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, args...))
+}
+
+// Stage is a single processing step in the pipeline
+type Stage interface {
+	Name() string
+	Process(rec *Record) error
+}
+
+// Sink receives fully annotated records
+type Sink interface {
+	Write(rec *Record) error
+	Close() error
+}
+
+// Pipeline runs records through stages and fans them out to sinks
+type Pipeline struct {
+	mu     sync.Mutex
+	stages []Stage
+	sinks  []Sink
+}
+
+// NewPipeline creates a pipeline with the given stages
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// AddStage appends a stage to the end of the pipeline
+func (p *Pipeline) AddStage(stage Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = append(p.stages, stage)
+}
+
+// AddSink registers an output for annotated records
+func (p *Pipeline) AddSink(sink Sink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sinks = append(p.sinks, sink)
+}
+
+// Stages returns the names of the configured stages in order
+func (p *Pipeline) Stages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Process runs a record through all stages and, unless dropped, writes it to all sinks
+// Returns true if the record reached the sinks
+func (p *Pipeline) Process(rec *Record) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, stage := range p.stages {
+		if err := stage.Process(rec); err != nil {
+			return false, fmt.Errorf("stage %s: %w", stage.Name(), err)
+		}
+		if rec.Drop {
+			return false, nil
+		}
+	}
+
+	var firstErr error
+	for _, sink := range p.sinks {
+		if err := sink.Write(rec); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("sink write failed: %w", err)
+		}
+	}
+	return true, firstErr
+}
+
+// Run processes packets from a receive stream until the channel closes
+// Processing errors are reported through errFn if non-nil
+func (p *Pipeline) Run(packets <-chan *rxstream.Packet, errFn func(error)) {
+	for pkt := range packets {
+		if _, err := p.Process(NewRecord(pkt)); err != nil && errFn != nil {
+			errFn(err)
+		}
+	}
+}
+
+// Close closes all sinks, and any stages that hold resources
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for _, stage := range p.stages {
+		if c, ok := stage.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for _, sink := range p.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,46 @@
+package annotate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// StageConfig declares one stage by registered type with type-specific parameters
+type StageConfig struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Config declares a pipeline
+type Config struct {
+	Stages []StageConfig `json:"stages"`
+}
+
+// LoadConfig reads a pipeline declaration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pipeline config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Build creates a pipeline from a declaration; sinks are added by the caller
+func Build(cfg *Config) (*Pipeline, error) {
+	p := NewPipeline()
+	for i, sc := range cfg.Stages {
+		stage, err := NewStage(sc.Type, sc.Params)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		p.AddStage(stage)
+	}
+	return p, nil
+}
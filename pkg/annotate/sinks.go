@@ -0,0 +1,90 @@
+package annotate
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// JSONSink writes one JSON object per record
+type JSONSink struct {
+	enc *json.Encoder
+	f   *os.File // Closed by Close when the sink created it
+}
+
+// NewJSONSink creates a JSON-lines sink on w. Closing the sink leaves w
+// open
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// CreateJSONSink creates a JSON-lines sink writing to a new file at path,
+// which Close closes
+func CreateJSONSink(path string) (*JSONSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSink{enc: json.NewEncoder(f), f: f}, nil
+}
+
+func (s *JSONSink) Write(rec *Record) error {
+	return s.enc.Encode(rec)
+}
+
+func (s *JSONSink) Close() error {
+	if s.f != nil {
+		return s.f.Close()
+	}
+	return nil
+}
+
+// TextSink writes a human-readable line per record
+type TextSink struct {
+	w io.Writer
+}
+
+// NewTextSink creates a text sink on w. Closing the sink leaves w open
+func NewTextSink(w io.Writer) *TextSink {
+	return &TextSink{w: w}
+}
+
+func (s *TextSink) Write(rec *Record) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]", rec.Timestamp.Format("15:04:05.000"))
+	if rec.Protocol != "" {
+		fmt.Fprintf(&b, " %s", rec.Protocol)
+	}
+	fmt.Fprintf(&b, " %s", hex.EncodeToString(rec.Data))
+
+	names := make([]string, 0, len(rec.Fields))
+	for name := range rec.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%v", name, rec.Fields[name])
+	}
+	for _, note := range rec.Notes {
+		fmt.Fprintf(&b, " (%s)", note)
+	}
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+func (s *TextSink) Close() error {
+	return nil
+}
+
+// FuncSink adapts a function to the Sink interface
+type FuncSink func(rec *Record) error
+
+func (f FuncSink) Write(rec *Record) error { return f(rec) }
+
+func (f FuncSink) Close() error { return nil }
@@ -0,0 +1,282 @@
+package annotate
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/coding"
+	"github.com/herlein/gocat/pkg/rxstream"
+)
+
+// StageFactory builds a stage from its JSON parameters
+type StageFactory func(params json.RawMessage) (Stage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]StageFactory{}
+)
+
+// RegisterStage makes a stage type available to declarative configs
+// Registering the same type twice replaces the earlier factory
+func RegisterStage(typ string, factory StageFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[typ] = factory
+}
+
+// StageTypes returns the registered stage type names
+func StageTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewStage builds a registered stage type with the given parameters
+func NewStage(typ string, params json.RawMessage) (Stage, error) {
+	registryMu.RLock()
+	factory, ok := registry[typ]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown stage type '%s'", typ)
+	}
+	return factory(params)
+}
+
+func init() {
+	RegisterStage("manchester", func(json.RawMessage) (Stage, error) { return &ManchesterStage{}, nil })
+	RegisterStage("dewhiten", func(json.RawMessage) (Stage, error) { return &DewhitenStage{}, nil })
+	RegisterStage("crc16", func(params json.RawMessage) (Stage, error) {
+		s := &CRC16Stage{Strip: true}
+		return s, unmarshalParams(params, s)
+	})
+	RegisterStage("field", func(params json.RawMessage) (Stage, error) {
+		s := &FieldStage{}
+		if err := unmarshalParams(params, s); err != nil {
+			return nil, err
+		}
+		if s.Field == "" {
+			return nil, fmt.Errorf("field stage requires a name")
+		}
+		return s, nil
+	})
+	RegisterStage("filter", func(params json.RawMessage) (Stage, error) {
+		s := &FilterStage{}
+		return s, unmarshalParams(params, s)
+	})
+	RegisterStage("dedupe", func(params json.RawMessage) (Stage, error) {
+		s := &DedupeStage{WindowMs: 500}
+		if err := unmarshalParams(params, s); err != nil {
+			return nil, err
+		}
+		s.deduper = &rxstream.Deduper{
+			Window:    time.Duration(s.WindowMs) * time.Millisecond,
+			KeyOffset: s.KeyOffset,
+			KeyLength: s.KeyLength,
+		}
+		return s, nil
+	})
+	RegisterStage("timing", func(params json.RawMessage) (Stage, error) {
+		s := &TimingStage{}
+		if err := unmarshalParams(params, s); err != nil {
+			return nil, err
+		}
+		s.timing = rxstream.NewTiming(time.Duration(s.GapMs) * time.Millisecond)
+		return s, nil
+	})
+	RegisterStage("label", func(params json.RawMessage) (Stage, error) {
+		s := &LabelStage{}
+		return s, unmarshalParams(params, s)
+	})
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("invalid stage parameters: %w", err)
+	}
+	return nil
+}
+
+// ManchesterStage Manchester-decodes the working payload
+type ManchesterStage struct{}
+
+func (s *ManchesterStage) Name() string { return "manchester" }
+
+func (s *ManchesterStage) Process(rec *Record) error {
+	var errors int
+	rec.Data, errors = coding.ManchesterDecode(rec.Data)
+	if errors > 0 {
+		rec.Set("manchester_errors", errors)
+	}
+	return nil
+}
+
+// DewhitenStage removes PN9 whitening from the working payload
+type DewhitenStage struct{}
+
+func (s *DewhitenStage) Name() string { return "dewhiten" }
+
+func (s *DewhitenStage) Process(rec *Record) error {
+	rec.Data = coding.Dewhiten(rec.Data)
+	return nil
+}
+
+// CRC16Stage checks a trailing CC1111 CRC16 and records crc_ok
+type CRC16Stage struct {
+	Strip   bool `json:"strip"`    // Remove the CRC bytes from the payload
+	DropBad bool `json:"drop_bad"` // Drop records with a bad CRC
+}
+
+func (s *CRC16Stage) Name() string { return "crc16" }
+
+func (s *CRC16Stage) Process(rec *Record) error {
+	payload, ok := coding.CheckCRC16(rec.Data)
+	rec.Set("crc_ok", ok)
+	if s.Strip && len(rec.Data) >= 2 {
+		rec.Data = payload
+	}
+	if !ok && s.DropBad {
+		rec.Drop = true
+	}
+	return nil
+}
+
+// FieldStage extracts a fixed-position field from the working payload
+type FieldStage struct {
+	Field  string `json:"name"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Format string `json:"format"` // hex (default), uint, int, ascii
+	Endian string `json:"endian"` // big (default) or little
+}
+
+func (s *FieldStage) Name() string { return "field:" + s.Field }
+
+func (s *FieldStage) Process(rec *Record) error {
+	length := s.Length
+	if length <= 0 {
+		length = len(rec.Data) - s.Offset
+	}
+	if s.Offset < 0 || length <= 0 || s.Offset+length > len(rec.Data) {
+		// Short packet; leave the field unset rather than failing the record
+		return nil
+	}
+	raw := rec.Data[s.Offset : s.Offset+length]
+
+	switch s.Format {
+	case "", "hex":
+		rec.Set(s.Field, hex.EncodeToString(raw))
+	case "ascii":
+		rec.Set(s.Field, string(raw))
+	case "uint", "int":
+		if length > 8 {
+			return fmt.Errorf("field %s: %d bytes too long for integer", s.Field, length)
+		}
+		buf := make([]byte, 8)
+		if s.Endian == "little" {
+			copy(buf, raw)
+		} else {
+			copy(buf[8-length:], raw)
+		}
+		var v uint64
+		if s.Endian == "little" {
+			v = binary.LittleEndian.Uint64(buf)
+		} else {
+			v = binary.BigEndian.Uint64(buf)
+		}
+		if s.Format == "int" {
+			// Sign-extend from the field width
+			shift := uint(64 - 8*length)
+			rec.Set(s.Field, int64(v<<shift)>>shift)
+		} else {
+			rec.Set(s.Field, v)
+		}
+	default:
+		return fmt.Errorf("field %s: unknown format '%s'", s.Field, s.Format)
+	}
+	return nil
+}
+
+// FilterStage drops records that do not meet basic criteria
+type FilterStage struct {
+	MinLen     int  `json:"min_len"`
+	MaxLen     int  `json:"max_len"`
+	RequireCRC bool `json:"require_crc"` // Drop unless crc_ok is true
+}
+
+func (s *FilterStage) Name() string { return "filter" }
+
+func (s *FilterStage) Process(rec *Record) error {
+	if s.MinLen > 0 && len(rec.Data) < s.MinLen {
+		rec.Drop = true
+	}
+	if s.MaxLen > 0 && len(rec.Data) > s.MaxLen {
+		rec.Drop = true
+	}
+	if s.RequireCRC {
+		if ok, _ := rec.Fields["crc_ok"].(bool); !ok {
+			rec.Drop = true
+		}
+	}
+	return nil
+}
+
+// DedupeStage drops repeats of a frame within a time window, comparing the
+// whole payload or only a key field such as a sequence number
+type DedupeStage struct {
+	WindowMs  int `json:"window_ms"`
+	KeyOffset int `json:"key_offset"`
+	KeyLength int `json:"key_length"` // 0 = whole payload
+
+	deduper *rxstream.Deduper
+}
+
+func (s *DedupeStage) Name() string { return "dedupe" }
+
+func (s *DedupeStage) Process(rec *Record) error {
+	if s.deduper.Duplicate(rec.Data, rec.Timestamp) {
+		rec.Drop = true
+	}
+	return nil
+}
+
+// TimingStage computes inter-packet deltas and burst grouping from record
+// timestamps, for captures that were recorded without timing metadata
+type TimingStage struct {
+	GapMs int `json:"gap_ms"` // 0 = rxstream.DefaultBurstGap
+
+	timing *rxstream.Timing
+}
+
+func (s *TimingStage) Name() string { return "timing" }
+
+func (s *TimingStage) Process(rec *Record) error {
+	pkt := &rxstream.Packet{Timestamp: rec.Timestamp}
+	s.timing.Mark(pkt)
+	setTiming(rec, pkt.Delta, pkt.Burst, pkt.BurstIndex)
+	return nil
+}
+
+// LabelStage sets the record's protocol name
+type LabelStage struct {
+	Protocol string `json:"protocol"`
+}
+
+func (s *LabelStage) Name() string { return "label" }
+
+func (s *LabelStage) Process(rec *Record) error {
+	rec.Protocol = s.Protocol
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package audit queries the transmit audit log
+//
+// Every transmission made through pkg/yardstick (RFXmit, RFXmitLong and
+// FHSS messages) is appended to the log as one JSON line: time, device
+// serial, frequency, power, payload size and SHA-256, duration and the
+// invoking command. Payloads themselves aren't kept. The log answers
+// "what did my script actually send" after the fact, and documents what a
+// lab or test rig put on air. See yardstick.AuditLogPath for where it
+// lives and how to turn it off.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Record is one logged transmission
+type Record = yardstick.TxRecord
+
+// Filter selects records; zero fields match everything
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Serial  string
+	LowHz   uint32 // Frequency range, inclusive; HighHz 0 means no upper bound
+	HighHz  uint32
+	Command string // Substring of the invoking command
+	Failed  bool   // Only transmits that returned an error
+}
+
+// Match reports whether r passes the filter
+func (f *Filter) Match(r *Record) bool {
+	switch {
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Time.Before(f.Until):
+		return false
+	case f.Serial != "" && r.Serial != f.Serial:
+		return false
+	case f.LowHz > 0 && r.FrequencyHz < f.LowHz:
+		return false
+	case f.HighHz > 0 && r.FrequencyHz > f.HighHz:
+		return false
+	case f.Command != "" && !strings.Contains(r.Command, f.Command):
+		return false
+	case f.Failed && r.Error == "":
+		return false
+	}
+	return true
+}
+
+// Path returns the audit log file, or "" when the log is disabled
+func Path() (string, error) {
+	return yardstick.AuditLogPath()
+}
+
+// Query reads the records in the log at path that match f, oldest first
+// A missing log has no records
+func Query(path string, f *Filter) ([]*Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+	return Scan(file, f)
+}
+
+// Scan reads matching records from an audit log stream
+// A truncated last line, left by a process killed mid-write, is skipped
+func Scan(r io.Reader, f *Filter) ([]*Record, error) {
+	if f == nil {
+		f = &Filter{}
+	}
+	var records []*Record
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		rec := &Record{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", n, err)
+		}
+		if f.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+}
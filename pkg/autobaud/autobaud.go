@@ -0,0 +1,447 @@
+// Package autobaud finds the data rate of an unknown OOK transmitter so a
+// no-sync OOK profile can be locked to it before capturing
+//
+// Two methods are available:
+//   - Oversample receives at a rate well above any remote's and measures
+//     the width of the shortest pulse in samples; the rest of the signal
+//     is then decimated in software (see Decimate)
+//   - Sweep steps through candidate rates. At the transmitter's rate, or a
+//     whole multiple of it, every pulse is a whole number of bits and the
+//     pulses fall into a few exact widths (two for PWM or Manchester);
+//     anywhere else each width smears over neighbouring bit counts. The
+//     highest candidate with the fewest distinct widths gives the rate
+//
+// Hold the remote's button down while detecting so it keeps repeating.
+// Noise demodulates as random bits, so use a carrier-sense profile or
+// SquelchMin when the band is quiet between presses.
+package autobaud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+	"github.com/herlein/gocat/pkg/demod"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Method selects how the rate is found
+type Method string
+
+// Methods
+const (
+	Oversample Method = "oversample"
+	Sweep      Method = "sweep"
+)
+
+// DefaultCandidates are data rates commonly used by OOK remotes, sensors
+// and doorbells; results within Tolerance of one are snapped to it
+var DefaultCandidates = []float64{
+	300, 600, 1000, 1200, 1600, 2000, 2400, 2500, 3000, 3333, 4000, 4800, 5000, 6000, 8000, 9600, 10000,
+}
+
+// Defaults
+const (
+	DefaultOversampleRate = 40000
+	DefaultDwell          = 3 * time.Second
+	DefaultMinPulses      = 32
+	DefaultTolerance      = 0.05
+)
+
+// minSamples is the narrowest pulse, in samples, trusted when
+// oversampling; narrower runs are noise or a transmitter too fast to
+// measure at the oversample rate
+const minSamples = 3
+
+// lockedFit is the fraction of pulses that must be whole multiples of the
+// estimated symbol width for an estimate to be trusted
+const lockedFit = 0.8
+
+// Errors
+var (
+	ErrNotOOK   = errors.New("radio is not configured for ASK/OOK")
+	ErrSyncWord = errors.New("radio waits for a sync word; auto-baud needs a no-sync or carrier-sense profile")
+	ErrNoSignal = errors.New("no OOK signal heard")
+)
+
+// Options controls a detection; zero values use the defaults
+type Options struct {
+	Method         Method        // Oversample (default) or Sweep
+	Candidates     []float64     // Rates to sweep and snap to (default DefaultCandidates)
+	OversampleRate float64       // Receive rate for Oversample (default DefaultOversampleRate)
+	Dwell          time.Duration // Listening time in total for Oversample, per candidate for Sweep
+	MinPulses      int           // Pulses needed before an estimate is trusted (default DefaultMinPulses)
+	Tolerance      float64       // Snap to a candidate within this fraction (default DefaultTolerance)
+
+	// SquelchMin ignores blocks received below this RSSI in dBm (0 = off)
+	SquelchMin int
+
+	// Step is called after each rate is tried, e.g. to show progress
+	Step func(Step)
+}
+
+// Step is what was heard at one receive rate
+type Step struct {
+	RateBaud float64 `json:"rate_baud"`
+	Pulses   int     `json:"pulses"`
+	Width    float64 `json:"width"`  // One symbol in samples at RateBaud
+	Fit      float64 `json:"fit"`    // Fraction of pulses that are whole multiples of Width
+	Widths   int     `json:"widths"` // Distinct pulse widths covering most pulses
+	Locked   bool    `json:"locked"`
+}
+
+// Result is the detected rate
+type Result struct {
+	Method   Method  `json:"method"`
+	Baud     float64 `json:"baud"`          // Rate the radio was locked to
+	Measured float64 `json:"measured_baud"` // Estimate before snapping to a candidate
+	Snapped  bool    `json:"snapped"`       // Baud is a candidate rate
+	Fit      float64 `json:"fit"`
+	Pulses   int     `json:"pulses"`
+	Steps    []Step  `json:"steps,omitempty"`
+}
+
+func (o *Options) withDefaults() Options {
+	opts := Options{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Method == "" {
+		opts.Method = Oversample
+	}
+	if len(opts.Candidates) == 0 {
+		opts.Candidates = DefaultCandidates
+	}
+	opts.Candidates = append([]float64(nil), opts.Candidates...)
+	sort.Float64s(opts.Candidates)
+	if opts.OversampleRate <= 0 {
+		opts.OversampleRate = DefaultOversampleRate
+	}
+	if opts.Dwell <= 0 {
+		opts.Dwell = DefaultDwell
+	}
+	if opts.MinPulses <= 0 {
+		opts.MinPulses = DefaultMinPulses
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = DefaultTolerance
+	}
+	return opts
+}
+
+// Detect listens for an OOK transmitter, determines its data rate and
+// locks the radio to it. The radio must already be configured with a
+// no-sync (or carrier-sense) OOK profile on the right frequency; only the
+// data rate is changed, and it is restored if no signal is found
+func Detect(ctx context.Context, d *yardstick.Device, opts *Options) (*Result, error) {
+	o := opts.withDefaults()
+	if o.Method != Oversample && o.Method != Sweep {
+		return nil, fmt.Errorf("unknown auto-baud method '%s'", o.Method)
+	}
+
+	mod, err := d.GetModulation()
+	if err != nil {
+		return nil, err
+	}
+	if mod != yardstick.ModASKOOK {
+		return nil, fmt.Errorf("%w (modulation is %s)", ErrNotOOK, cc1111.ModulationName(mod))
+	}
+	mdmcfg2, err := d.PeekByte(yardstick.RegMDMCFG2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MDMCFG2: %w", err)
+	}
+	if syncMode := mdmcfg2 & 0x07; syncMode != 0 && syncMode != 4 {
+		return nil, ErrSyncWord
+	}
+	original, err := d.GetDataRate()
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := d.Acquire(yardstick.ModeRX, "autobaud")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	d = lease.Device()
+
+	var result *Result
+	if o.Method == Sweep {
+		result, err = sweep(ctx, d, &o)
+	} else {
+		result, err = oversample(ctx, d, &o)
+	}
+	if err == nil {
+		err = retune(d, result.Baud)
+	}
+	if err != nil {
+		if rerr := retune(d, original); rerr != nil && !errors.Is(err, yardstick.ErrDisconnected) {
+			err = fmt.Errorf("%w (and failed to restore %.0f baud: %v)", err, original, rerr)
+		}
+		return result, err
+	}
+	return result, nil
+}
+
+func oversample(ctx context.Context, d *yardstick.Device, o *Options) (*Result, error) {
+	step, err := listen(ctx, d, o, o.OversampleRate)
+	if err != nil {
+		return nil, err
+	}
+	step.Locked = step.Pulses >= o.MinPulses && step.Width >= minSamples && step.Fit >= lockedFit
+	if o.Step != nil {
+		o.Step(*step)
+	}
+	result := &Result{Method: Oversample, Pulses: step.Pulses, Fit: step.Fit, Steps: []Step{*step}}
+	if !step.Locked {
+		return result, noSignal(step, o)
+	}
+	result.Measured = o.OversampleRate / step.Width
+	result.Baud, result.Snapped = snap(result.Measured, o)
+	return result, nil
+}
+
+func sweep(ctx context.Context, d *yardstick.Device, o *Options) (*Result, error) {
+	result := &Result{Method: Sweep}
+	best := -1
+	for _, rate := range o.Candidates {
+		step, err := listen(ctx, d, o, rate)
+		if err != nil {
+			return result, err
+		}
+		result.Steps = append(result.Steps, *step)
+		if o.Step != nil {
+			o.Step(*step)
+		}
+	}
+
+	// Whole multiples of the rate are as clean, and measure the width more
+	// finely, so keep the highest of the cleanest
+	for i, s := range result.Steps {
+		if s.Pulses < o.MinPulses || s.Widths > maxWidths {
+			continue
+		}
+		if best < 0 || s.Widths <= result.Steps[best].Widths {
+			best = i
+		}
+	}
+	if best < 0 {
+		// Explain with the rate that heard the most
+		loudest := &Step{}
+		for i := range result.Steps {
+			if result.Steps[i].Pulses > loudest.Pulses {
+				loudest = &result.Steps[i]
+			}
+		}
+		return result, noSignal(loudest, o)
+	}
+	result.Steps[best].Locked = true
+	s := result.Steps[best]
+	result.Pulses, result.Fit = s.Pulses, s.Fit
+	result.Measured = s.RateBaud / s.Width
+	result.Baud, result.Snapped = snap(result.Measured, o)
+	return result, nil
+}
+
+// noSignal explains why a step did not lock
+func noSignal(s *Step, o *Options) error {
+	if s.Pulses < o.MinPulses {
+		return fmt.Errorf("%w (%d pulses, need %d)", ErrNoSignal, s.Pulses, o.MinPulses)
+	}
+	if o.Method == Sweep {
+		return fmt.Errorf("%w (pulses look like noise, %d distinct widths)", ErrNoSignal, s.Widths)
+	}
+	if s.Width < minSamples {
+		return fmt.Errorf("%w (pulses under %d samples: noise, or faster than %.0f baud)", ErrNoSignal, minSamples, s.RateBaud/minSamples)
+	}
+	return fmt.Errorf("%w (pulses are not whole symbols, %.0f%% fit)", ErrNoSignal, s.Fit*100)
+}
+
+// listen receives at rate for the dwell time and measures the pulses heard
+func listen(ctx context.Context, d *yardstick.Device, o *Options, rate float64) (*Step, error) {
+	if err := retune(d, rate); err != nil {
+		return nil, err
+	}
+	if err := d.SetModeRX(); err != nil {
+		return nil, fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+
+	var runs []int
+	deadline := time.Now().Add(o.Dwell)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		if remaining > 200*time.Millisecond {
+			remaining = 200 * time.Millisecond
+		}
+		data, err := d.RFRecv(remaining, 0)
+		if errors.Is(err, yardstick.ErrDisconnected) {
+			return nil, err
+		}
+		if err != nil || len(data) == 0 {
+			// Timeout is normal
+			continue
+		}
+		if o.SquelchMin != 0 {
+			if rssi, err := d.GetRSSI(); err == nil && yardstick.RSSIToDBm(rssi) < o.SquelchMin {
+				continue
+			}
+		}
+		block := demod.Runs(data)
+		// The first and last runs are cut short by the block boundaries
+		if len(block) > 2 {
+			runs = append(runs, block[1:len(block)-1]...)
+		}
+	}
+
+	step := &Step{RateBaud: rate, Pulses: len(runs)}
+	step.Width, step.Fit = Estimate(runs)
+	step.Widths = widths(runs, step.Width)
+	return step, nil
+}
+
+// maxWidths is the most distinct pulse widths a signal is expected to
+// have at its own rate; random bits from noise need more
+const maxWidths = 6
+
+// widths returns how many distinct signed run lengths cover 90% of the
+// runs no longer than maxSymbols symbols of width samples
+func widths(runs []int, width float64) int {
+	counts := make(map[int]int)
+	total := 0
+	for _, r := range runs {
+		if math.Abs(float64(r)) > maxSymbols*width+0.5 {
+			continue
+		}
+		counts[r]++
+		total++
+	}
+	sorted := make([]int, 0, len(counts))
+	for _, n := range counts {
+		sorted = append(sorted, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	covered := 0
+	for i, n := range sorted {
+		covered += n
+		if covered*10 >= total*9 {
+			return i + 1
+		}
+	}
+	return len(sorted)
+}
+
+// retune changes the data rate in IDLE
+func retune(d *yardstick.Device, baud float64) error {
+	if err := d.SetModeIDLE(); err != nil {
+		return err
+	}
+	return d.SetDataRate(baud)
+}
+
+// snap returns the candidate within the tolerance of baud, or baud rounded
+func snap(baud float64, o *Options) (float64, bool) {
+	best, bestErr := 0.0, math.Inf(1)
+	for _, c := range o.Candidates {
+		if e := math.Abs(baud-c) / c; e < bestErr {
+			best, bestErr = c, e
+		}
+	}
+	if bestErr <= o.Tolerance {
+		return best, true
+	}
+	return math.Round(baud), false
+}
+
+// maxSymbols is the longest run, in symbols, used to refine the symbol
+// width; longer runs are gaps between frames
+const maxSymbols = 8
+
+// Estimate returns the width of one symbol in samples and the fraction of
+// runs that are within a quarter symbol (or one sample) of a whole number
+// of symbols. runs are signed sample counts as returned by demod.Runs
+func Estimate(runs []int) (width, fit float64) {
+	if len(runs) == 0 {
+		return 0, 0
+	}
+	widths := make([]int, len(runs))
+	for i, r := range runs {
+		if r < 0 {
+			r = -r
+		}
+		widths[i] = r
+	}
+	sort.Ints(widths)
+	// The 10th percentile, so a few glitches don't collapse the estimate
+	first := float64(widths[len(widths)/10])
+
+	// Refine over the pulses that look like data: total width over total
+	// symbols averages out the sampling jitter
+	var total, symbols float64
+	for _, w := range widths {
+		n := math.Round(float64(w) / first)
+		if n < 1 || n > maxSymbols {
+			continue
+		}
+		total += float64(w)
+		symbols += n
+	}
+	if symbols == 0 {
+		return first, 0
+	}
+	width = total / symbols
+
+	tolerance := math.Max(0.25, 1/width)
+	matched, counted := 0, 0
+	for _, w := range widths {
+		x := float64(w) / width
+		if x > maxSymbols+0.5 {
+			continue
+		}
+		counted++
+		if n := math.Round(x); n >= 1 && math.Abs(x-n) <= tolerance {
+			matched++
+		}
+	}
+	if counted == 0 {
+		return width, 0
+	}
+	return width, float64(matched) / float64(counted)
+}
+
+// Decimate resamples an oversampled bitstream to one bit per symbol given
+// the symbol width in samples, rounding each run to whole symbols
+// Bits are packed MSB first; the final byte is zero padded
+func Decimate(data []byte, width float64) []byte {
+	if width <= 0 {
+		return nil
+	}
+	var out []byte
+	nbits := 0
+	for _, r := range demod.Runs(data) {
+		level := byte(0)
+		if r > 0 {
+			level = 1
+		} else {
+			r = -r
+		}
+		n := int(math.Round(float64(r) / width))
+		for i := 0; i < n; i++ {
+			if nbits%8 == 0 {
+				out = append(out, 0)
+			}
+			out[len(out)-1] |= level << uint(7-nbits%8)
+			nbits++
+		}
+	}
+	return out
+}
@@ -0,0 +1,304 @@
+// Package mqtt bridges a dongle to an MQTT broker, for Home Assistant,
+// Node-RED and other home automation tools.
+//
+// Received packets are published as JSON to the packets topic, and every
+// protocol a decoder recognized in them to the decoded topic. Payloads
+// published to the transmit topic are queued for the caller to send. The
+// status topic holds "online" while the bridge is connected and "offline"
+// (the MQTT will) once it is gone, both retained.
+//
+// Topics are templates: {prefix} expands to Config.Prefix and, in the
+// decoded topic, {protocol} and {decoder} to the candidate's.
+package mqtt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/herlein/gocat/pkg/annotate"
+	"github.com/herlein/gocat/pkg/identify"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Default topic templates
+const (
+	DefaultPacketsTopic  = "{prefix}/rx"
+	DefaultDecodedTopic  = "{prefix}/decoded/{protocol}"
+	DefaultTransmitTopic = "{prefix}/tx"
+	DefaultStatusTopic   = "{prefix}/status"
+)
+
+// connectTimeout bounds the first connection and each publish
+const connectTimeout = 10 * time.Second
+
+// Topics are the topic templates; empty ones take the defaults, and "-"
+// turns a topic off
+type Topics struct {
+	Packets  string `json:"packets,omitempty"`
+	Decoded  string `json:"decoded,omitempty"`
+	Transmit string `json:"transmit,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// Config describes the broker and the topics
+type Config struct {
+	Broker   string `json:"broker"`              // e.g. tcp://localhost:1883, ssl://host:8883, ws://host:9001
+	ClientID string `json:"client_id,omitempty"` // Default: gocat-<prefix>
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Prefix   string `json:"prefix,omitempty"` // Default: gocat
+	QoS      byte   `json:"qos,omitempty"`
+	Retain   bool   `json:"retain,omitempty"` // Retain packets and decoded messages
+	Topics   Topics `json:"topics,omitempty"`
+}
+
+// LoadConfig reads a bridge configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bridge config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// topic expands a template, or returns "" when it is turned off
+func (c *Config) topic(template, def string, vars ...string) string {
+	if template == "-" {
+		return ""
+	}
+	if template == "" {
+		template = def
+	}
+	r := strings.NewReplacer(append([]string{"{prefix}", c.Prefix}, vars...)...)
+	return r.Replace(template)
+}
+
+// PacketsTopic returns the topic received packets are published to
+func (c *Config) PacketsTopic() string {
+	return c.topic(c.Topics.Packets, DefaultPacketsTopic)
+}
+
+// DecodedTopic returns the topic a decoded candidate is published to
+func (c *Config) DecodedTopic(cand *identify.Candidate) string {
+	return c.topic(c.Topics.Decoded, DefaultDecodedTopic,
+		"{protocol}", topicLevel(cand.Protocol), "{decoder}", topicLevel(cand.Decoder))
+}
+
+// TransmitTopic returns the topic transmit requests are read from
+func (c *Config) TransmitTopic() string {
+	return c.topic(c.Topics.Transmit, DefaultTransmitTopic)
+}
+
+// StatusTopic returns the topic the bridge's status is kept in
+func (c *Config) StatusTopic() string {
+	return c.topic(c.Topics.Status, DefaultStatusTopic)
+}
+
+// topicLevel makes s safe as one topic level
+func topicLevel(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_", " ", "_").Replace(s)
+}
+
+// PacketMessage is published for each received packet
+type PacketMessage struct {
+	Time     time.Time              `json:"time"`
+	Raw      string                 `json:"raw"`            // Hex
+	Data     string                 `json:"data,omitempty"` // Hex, when the pipeline rewrote it
+	Protocol string                 `json:"protocol,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Notes    []string               `json:"notes,omitempty"`
+}
+
+// DecodedMessage is published for each protocol recognized in a packet
+type DecodedMessage struct {
+	Time time.Time `json:"time"`
+	*identify.Candidate
+	RSSI interface{} `json:"rssi_dbm,omitempty"`
+}
+
+// Transmit is a request read from the transmit topic
+type Transmit struct {
+	Data   []byte
+	Repeat int
+}
+
+// ParseTransmit reads a transmit request: either a bare hex payload or
+// {"data": "<hex>", "repeat": n}
+func ParseTransmit(payload []byte) (*Transmit, error) {
+	text := strings.TrimSpace(string(payload))
+	var req struct {
+		Data   string `json:"data"`
+		Repeat int    `json:"repeat"`
+	}
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &req); err != nil {
+			return nil, fmt.Errorf("invalid transmit request: %w", err)
+		}
+	} else {
+		req.Data = strings.Trim(text, `"`)
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(req.Data), "0x"))
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid hex payload '%s'", req.Data)
+	}
+	// yardstick.RepeatForever would transmit until the radio is reset
+	if req.Repeat < 0 || req.Repeat >= yardstick.RepeatForever {
+		return nil, fmt.Errorf("repeat must be 0-%d", yardstick.RepeatForever-1)
+	}
+	return &Transmit{Data: data, Repeat: req.Repeat}, nil
+}
+
+// Bridge is a connection to the broker
+type Bridge struct {
+	cfg    Config
+	client paho.Client
+	tx     chan *Transmit
+	errFn  func(error)
+}
+
+// Connect connects to the broker and, if transmit is true, subscribes to
+// the transmit topic. errFn, which may be nil, hears about transmit
+// payloads that don't parse
+func Connect(cfg *Config, transmit bool, errFn func(error)) (*Bridge, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("no broker given")
+	}
+	b := &Bridge{cfg: *cfg, tx: make(chan *Transmit, 16), errFn: errFn}
+	if b.cfg.Prefix == "" {
+		b.cfg.Prefix = "gocat"
+	}
+	if b.cfg.ClientID == "" {
+		b.cfg.ClientID = "gocat-" + strings.ReplaceAll(b.cfg.Prefix, "/", "-")
+	}
+	if b.cfg.QoS > 2 {
+		return nil, fmt.Errorf("qos must be 0-2, got %d", b.cfg.QoS)
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(b.cfg.Broker).
+		SetClientID(b.cfg.ClientID).
+		SetUsername(b.cfg.Username).
+		SetPassword(b.cfg.Password).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true).
+		SetOrderMatters(false)
+	status := b.cfg.StatusTopic()
+	if status != "" {
+		opts.SetWill(status, "offline", 1, true)
+	}
+	txTopic := ""
+	if transmit {
+		txTopic = b.cfg.TransmitTopic()
+	}
+	// Runs on every (re)connect, so the status and subscription survive
+	// a broker restart
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		if status != "" {
+			c.Publish(status, 1, true, "online")
+		}
+		if txTopic != "" {
+			c.Subscribe(txTopic, b.cfg.QoS, b.onTransmit)
+		}
+	})
+
+	b.client = paho.NewClient(opts)
+	tok := b.client.Connect()
+	if !tok.WaitTimeout(connectTimeout) {
+		return nil, fmt.Errorf("timed out connecting to %s", b.cfg.Broker)
+	}
+	if err := tok.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", b.cfg.Broker, err)
+	}
+	return b, nil
+}
+
+// Config returns the configuration in use, with defaults filled in
+func (b *Bridge) Config() *Config {
+	return &b.cfg
+}
+
+// Transmits returns the transmit requests read from the broker
+func (b *Bridge) Transmits() <-chan *Transmit {
+	return b.tx
+}
+
+func (b *Bridge) onTransmit(_ paho.Client, m paho.Message) {
+	t, err := ParseTransmit(m.Payload())
+	if err != nil {
+		if b.errFn != nil {
+			b.errFn(fmt.Errorf("%s: %w", m.Topic(), err))
+		}
+		return
+	}
+	select {
+	case b.tx <- t:
+	default:
+		if b.errFn != nil {
+			b.errFn(fmt.Errorf("%s: transmit queue full, request dropped", m.Topic()))
+		}
+	}
+}
+
+// Write publishes a received packet; Bridge is an annotate.Sink
+func (b *Bridge) Write(rec *annotate.Record) error {
+	topic := b.cfg.PacketsTopic()
+	if topic == "" {
+		return nil
+	}
+	msg := &PacketMessage{
+		Time:     rec.Timestamp,
+		Raw:      hex.EncodeToString(rec.Raw),
+		Protocol: rec.Protocol,
+		Fields:   rec.Fields,
+		Notes:    rec.Notes,
+	}
+	if string(rec.Data) != string(rec.Raw) {
+		msg.Data = hex.EncodeToString(rec.Data)
+	}
+	return b.publish(topic, msg)
+}
+
+// PublishDecoded publishes one candidate recognized in rec
+func (b *Bridge) PublishDecoded(rec *annotate.Record, cand *identify.Candidate) error {
+	topic := b.cfg.DecodedTopic(cand)
+	if topic == "" {
+		return nil
+	}
+	return b.publish(topic, &DecodedMessage{Time: rec.Timestamp, Candidate: cand, RSSI: rec.Fields["rssi_dbm"]})
+}
+
+func (b *Bridge) publish(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tok := b.client.Publish(topic, b.cfg.QoS, b.cfg.Retain, payload)
+	if !tok.WaitTimeout(connectTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return tok.Error()
+}
+
+// Close marks the bridge offline and disconnects
+func (b *Bridge) Close() error {
+	if status := b.cfg.StatusTopic(); status != "" {
+		b.client.Publish(status, 1, true, "offline").WaitTimeout(time.Second)
+	}
+	b.client.Disconnect(250)
+	return nil
+}
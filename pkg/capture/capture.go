@@ -0,0 +1,128 @@
+// Package capture reads recorded packets from capture files so they can be
+// re-analyzed offline with the same pipeline used for live reception
+//
+// Supported formats:
+//   - native: JSON lines as written by the annotate JSON sink, optionally
+//     preceded by a versioned Header line
+//   - hex:    one hex-encoded packet per line (send-recv -raw output)
+//   - pcap:   classic libpcap files, one packet per record
+//   - sub:    Flipper Zero SubGHz files (RAW pulse timings or decoded keys)
+//   - sigmf:  SigMF recordings holding packet bytes, one annotation per packet
+//
+// Every format can also be written, see Writer and Create; Play replays a
+// capture with its original inter-packet timing
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/capture/sigmf"
+)
+
+// Packet is a single captured packet
+type Packet struct {
+	Timestamp time.Time
+	Data      []byte
+	Pulses    []int  // Signed pulse durations in microseconds (+high, -low), if known
+	Frequency uint32 // Hz, if known
+	RSSI      int    // dBm, if known (0 = unknown)
+	LQI       uint8  // Link quality indicator, if known
+}
+
+// Reader yields captured packets in order
+// Next returns io.EOF when the capture is exhausted
+type Reader interface {
+	Next() (*Packet, error)
+}
+
+// Format names
+const (
+	FormatNative = "native"
+	FormatHex    = "hex"
+	FormatPcap   = "pcap"
+	FormatSub    = "sub"
+	FormatSigMF  = "sigmf"
+)
+
+// Formats lists the supported capture formats
+var Formats = []string{FormatNative, FormatHex, FormatPcap, FormatSub, FormatSigMF}
+
+// DetectFormat guesses the capture format from the file extension
+func DetectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pcap", ".cap":
+		return FormatPcap
+	case ".sub":
+		return FormatSub
+	case sigmf.MetaExt, sigmf.DataExt, ".sigmf":
+		return FormatSigMF
+	case ".jsonl", ".json", ".ndjson":
+		return FormatNative
+	default:
+		return FormatHex
+	}
+}
+
+// NewReader creates a reader for the given format
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatNative:
+		return newNativeReader(r), nil
+	case FormatHex:
+		return newHexReader(r), nil
+	case FormatPcap:
+		return newPcapReader(r)
+	case FormatSub:
+		return newSubReader(r)
+	case FormatSigMF:
+		return nil, fmt.Errorf("SigMF captures are a file pair; use capture.Open")
+	default:
+		return nil, fmt.Errorf("unknown capture format '%s'", format)
+	}
+}
+
+// File is a capture reader backed by an open file
+type File struct {
+	Reader
+	f *os.File
+}
+
+// Open opens a capture file; format "" or "auto" detects from the extension
+func Open(path string, format string) (*File, error) {
+	if format == "" || format == "auto" {
+		format = DetectFormat(path)
+	}
+	if format == FormatSigMF {
+		r, err := openSigMF(path)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Reader: r}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+
+	r, err := NewReader(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &File{Reader: r, f: f}, nil
+}
+
+// Close closes the underlying file
+func (c *File) Close() error {
+	if c.f == nil {
+		return nil
+	}
+	return c.f.Close()
+}
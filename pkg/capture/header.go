@@ -0,0 +1,89 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the native capture schema written by this package
+// Version 0 is the original headerless JSON lines format
+const SchemaVersion = 1
+
+// Header describes how a capture was made; native captures store it as
+// their first line
+type Header struct {
+	Version     int           `json:"gocat_capture"`
+	Created     time.Time     `json:"created"`
+	Profile     string        `json:"profile,omitempty"` // Built-in profile name or configuration path
+	FrequencyHz uint32        `json:"frequency_hz,omitempty"`
+	DataRate    float64       `json:"data_rate_baud,omitempty"`
+	Modulation  string        `json:"modulation,omitempty"`
+	Device      *DeviceInfo   `json:"device,omitempty"`
+	Calibration []Calibration `json:"calibration,omitempty"`
+	Tool        string        `json:"tool,omitempty"`
+
+	// Registers is the radio register snapshot the capture was made with,
+	// in the same form as a configuration file's "registers" object
+	// (registers.RegisterMap), so a replay can reproduce the exact setup
+	Registers json.RawMessage `json:"registers,omitempty"`
+}
+
+// DeviceInfo identifies the dongle a capture was recorded with
+type DeviceInfo struct {
+	Serial  string `json:"serial,omitempty"`
+	Product string `json:"product,omitempty"`
+	Build   string `json:"build,omitempty"`
+	PartNum uint8  `json:"part_num,omitempty"`
+}
+
+// Calibration is a synthesizer calibration in effect during the capture,
+// in the same form as yardstick.CalEntry
+type Calibration struct {
+	FreqHz uint32 `json:"freq_hz"`
+	FSCAL3 uint8  `json:"fscal3"`
+	FSCAL2 uint8  `json:"fscal2"`
+	FSCAL1 uint8  `json:"fscal1"`
+}
+
+// NewHeader returns a header for a capture made now
+func NewHeader() *Header {
+	return &Header{Version: SchemaVersion, Created: time.Now().UTC()}
+}
+
+// HeaderReader is implemented by readers whose format records a header
+type HeaderReader interface {
+	Header() *Header
+}
+
+// HeaderOf returns the header of r, or nil if the format has none
+func HeaderOf(r Reader) *Header {
+	if f, ok := r.(*File); ok {
+		r = f.Reader
+	}
+	if h, ok := r.(HeaderReader); ok {
+		return h.Header()
+	}
+	return nil
+}
+
+// parseHeader recognises a native header line
+// ok is false for an ordinary packet record
+func parseHeader(raw json.RawMessage) (*Header, bool, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, false, nil
+	}
+	if _, ok := probe["gocat_capture"]; !ok {
+		return nil, false, nil
+	}
+
+	var h Header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, true, fmt.Errorf("invalid capture header: %w", err)
+	}
+	if h.Version < 1 || h.Version > SchemaVersion {
+		return nil, true, fmt.Errorf("capture schema version %d not supported (this build reads up to %d)", h.Version, SchemaVersion)
+	}
+	return &h, true, nil
+}
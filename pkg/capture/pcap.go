@@ -0,0 +1,72 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	pcapMagicMicro = 0xA1B2C3D4
+	pcapMagicNano  = 0xA1B23C4D
+)
+
+// pcapReader reads classic libpcap files
+type pcapReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	nano  bool
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %w", err)
+	}
+
+	p := &pcapReader{r: r}
+	switch {
+	case binary.LittleEndian.Uint32(hdr) == pcapMagicMicro:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr) == pcapMagicMicro:
+		p.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr) == pcapMagicNano:
+		p.order, p.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr) == pcapMagicNano:
+		p.order, p.nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap file (magic 0x%08X)", binary.LittleEndian.Uint32(hdr))
+	}
+
+	return p, nil
+}
+
+func (p *pcapReader) Next() (*Packet, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated pcap record header")
+		}
+		return nil, err
+	}
+
+	sec := p.order.Uint32(hdr[0:4])
+	frac := p.order.Uint32(hdr[4:8])
+	inclLen := p.order.Uint32(hdr[8:12])
+	if inclLen > 0x40000 {
+		return nil, fmt.Errorf("pcap record too large: %d bytes", inclLen)
+	}
+
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, fmt.Errorf("truncated pcap record: %w", err)
+	}
+
+	nsec := int64(frac) * 1000
+	if p.nano {
+		nsec = int64(frac)
+	}
+
+	return &Packet{Timestamp: time.Unix(int64(sec), nsec), Data: data}, nil
+}
@@ -0,0 +1,59 @@
+package capture
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Play calls fn for every packet in r, spaced by the original gaps between
+// their timestamps divided by speed (2 plays twice as fast). speed <= 0
+// sends back to back. Packets without a timestamp, or stamped earlier than
+// the one before, go out immediately
+// Waits are measured from the first packet, so time spent in fn does not
+// accumulate as drift over a long capture
+func Play(ctx context.Context, r Reader, speed float64, fn func(p *Packet) error) error {
+	var start, first, last time.Time
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if speed > 0 && !p.Timestamp.IsZero() {
+			if first.IsZero() {
+				start, first = time.Now(), p.Timestamp
+			} else if !p.Timestamp.Before(last) {
+				at := start.Add(time.Duration(float64(p.Timestamp.Sub(first)) / speed))
+				if err := sleepUntil(ctx, at); err != nil {
+					return err
+				}
+			}
+			last = p.Timestamp
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
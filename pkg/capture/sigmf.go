@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/capture/sigmf"
+)
+
+// sigmfReader yields the annotated packets of a SigMF recording
+// The dataset holds demodulated packet bytes (ru8), one annotation per
+// packet, rather than IQ samples
+type sigmfReader struct {
+	meta   *sigmf.Meta
+	data   []byte
+	header *Header
+	next   int
+}
+
+func openSigMF(path string) (*sigmfReader, error) {
+	meta, err := sigmf.ReadMeta(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+	s := &sigmfReader{meta: meta}
+	if dt := meta.Global.Datatype; dt != sigmf.DatatypeBytes && dt != "ri8" {
+		return nil, fmt.Errorf("SigMF datatype %s not supported (gocat reads byte datasets)", dt)
+	}
+	_, dataPath := sigmf.Paths(path)
+	if s.data, err = os.ReadFile(dataPath); err != nil {
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+
+	if len(meta.Global.Header) > 0 {
+		s.header = &Header{}
+		if err := json.Unmarshal(meta.Global.Header, s.header); err != nil {
+			return nil, fmt.Errorf("invalid capture header in SigMF metadata: %w", err)
+		}
+	} else {
+		s.header = &Header{Version: SchemaVersion, Tool: meta.Global.Recorder}
+	}
+	if len(meta.Captures) > 0 {
+		c := meta.Captures[0]
+		if s.header.FrequencyHz == 0 {
+			s.header.FrequencyHz = uint32(c.Frequency + 0.5)
+		}
+		if s.header.Created.IsZero() && c.Datetime != "" {
+			s.header.Created, _ = time.Parse(time.RFC3339Nano, c.Datetime)
+		}
+	}
+
+	return s, nil
+}
+
+// Header returns the recording's header, rebuilt from core fields when the
+// file was not written by gocat
+func (s *sigmfReader) Header() *Header {
+	return s.header
+}
+
+func (s *sigmfReader) Next() (*Packet, error) {
+	if s.next >= len(s.meta.Annotations) {
+		return nil, io.EOF
+	}
+	a := s.meta.Annotations[s.next]
+	s.next++
+
+	end := a.SampleStart + a.SampleCount
+	if end > uint64(len(s.data)) {
+		return nil, fmt.Errorf("SigMF annotation %d runs past the end of the dataset", s.next-1)
+	}
+
+	p := &Packet{
+		Data:      append([]byte(nil), s.data[a.SampleStart:end]...),
+		Pulses:    a.Pulses,
+		Frequency: a.Frequency,
+		RSSI:      a.RSSI,
+		LQI:       a.LQI,
+	}
+	if a.Timestamp != "" {
+		p.Timestamp, _ = time.Parse(time.RFC3339Nano, a.Timestamp)
+	}
+	if p.Frequency == 0 {
+		p.Frequency = s.header.FrequencyHz
+	}
+	return p, nil
+}
+
+// sigmfWriter streams packet bytes to the dataset and writes the metadata
+// on Close
+type sigmfWriter struct {
+	path   string
+	data   *os.File
+	offset uint64
+	meta   sigmf.Meta
+}
+
+func createSigMF(path string, hdr *Header) (*sigmfWriter, error) {
+	if hdr == nil {
+		hdr = NewHeader()
+	}
+	_, dataPath := sigmf.Paths(path)
+
+	h := *hdr
+	h.Version = SchemaVersion
+	rawHeader, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.Create(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture: %w", err)
+	}
+
+	s := &sigmfWriter{
+		path: path,
+		data: data,
+		meta: sigmf.Meta{
+			Global: sigmf.Global{
+				Datatype:    sigmf.DatatypeBytes,
+				Version:     sigmf.Version,
+				Recorder:    "gocat",
+				Description: "Demodulated packets, one annotation per packet",
+				Header:      rawHeader,
+			},
+		},
+	}
+	if hdr.Device != nil {
+		s.meta.Global.HW = strings.TrimSpace("YARD Stick One " + hdr.Device.Serial)
+	}
+	capture := sigmf.Capture{Frequency: float64(hdr.FrequencyHz)}
+	if !hdr.Created.IsZero() {
+		capture.Datetime = hdr.Created.UTC().Format(time.RFC3339Nano)
+	}
+	s.meta.Captures = []sigmf.Capture{capture}
+
+	return s, nil
+}
+
+func (s *sigmfWriter) Write(p *Packet) error {
+	if _, err := s.data.Write(p.Data); err != nil {
+		return fmt.Errorf("failed to write SigMF dataset: %w", err)
+	}
+	a := sigmf.Annotation{
+		SampleStart: s.offset,
+		SampleCount: uint64(len(p.Data)),
+		Frequency:   p.Frequency,
+		Pulses:      p.Pulses,
+		RSSI:        p.RSSI,
+		LQI:         p.LQI,
+	}
+	if !p.Timestamp.IsZero() {
+		a.Timestamp = p.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	s.meta.Annotations = append(s.meta.Annotations, a)
+	s.offset += uint64(len(p.Data))
+	return nil
+}
+
+func (s *sigmfWriter) Close() error {
+	if err := s.data.Close(); err != nil {
+		return fmt.Errorf("failed to write SigMF dataset: %w", err)
+	}
+	if c := &s.meta.Captures[0]; c.Frequency == 0 && len(s.meta.Annotations) > 0 {
+		c.Frequency = float64(s.meta.Annotations[0].Frequency)
+	}
+	return sigmf.WriteMeta(s.path, &s.meta)
+}
@@ -0,0 +1,137 @@
+// Package sigmf reads and writes SigMF recordings (a .sigmf-meta JSON
+// file plus a .sigmf-data dataset) so gocat results can be shared with
+// GNU Radio, inspectrum and URH users
+//
+// gocat writes two kinds of recording:
+//   - packets: demodulated packet bytes (ru8), one annotation per packet;
+//     pkg/capture reads and writes these through its Reader and Writer
+//   - spectrum: scanner sweeps as RSSI in dBm (rf32_le), one capture
+//     segment per sweep, see SpectrumWriter and SpectrumReader
+//
+// gocat-specific fields use the "gocat:" namespace; other tools ignore them
+package sigmf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File extensions; a recording is a metadata file plus a dataset
+const (
+	MetaExt = ".sigmf-meta"
+	DataExt = ".sigmf-data"
+)
+
+// Version is the SigMF specification version written
+const Version = "1.0.0"
+
+// Datatypes used by gocat
+const (
+	DatatypeBytes = "ru8"     // Packet bytes
+	DatatypeRSSI  = "rf32_le" // RSSI in dBm, one value per channel
+)
+
+// Paths returns the metadata and dataset paths for either file of a pair,
+// or for the shared base name
+func Paths(path string) (meta, data string) {
+	base := path
+	for _, ext := range []string{MetaExt, DataExt, ".sigmf"} {
+		if strings.HasSuffix(strings.ToLower(base), ext) {
+			base = base[:len(base)-len(ext)]
+			break
+		}
+	}
+	return base + MetaExt, base + DataExt
+}
+
+// IsPath reports whether path names a SigMF file by its extension
+func IsPath(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, MetaExt) || strings.HasSuffix(lower, DataExt) || strings.HasSuffix(lower, ".sigmf")
+}
+
+// Meta is the subset of the SigMF metadata schema gocat uses
+type Meta struct {
+	Global      Global       `json:"global"`
+	Captures    []Capture    `json:"captures"`
+	Annotations []Annotation `json:"annotations"`
+}
+
+// Global is the recording-wide metadata
+type Global struct {
+	Datatype    string  `json:"core:datatype"`
+	Version     string  `json:"core:version"`
+	SampleRate  float64 `json:"core:sample_rate,omitempty"`
+	Recorder    string  `json:"core:recorder,omitempty"`
+	Description string  `json:"core:description,omitempty"`
+	HW          string  `json:"core:hw,omitempty"`
+
+	// Header is a pkg/capture Header, kept raw so this package does not
+	// depend on it
+	Header json.RawMessage `json:"gocat:header,omitempty"`
+}
+
+// Capture is a capture segment: where a run of samples starts and the
+// radio setup it was taken with
+type Capture struct {
+	SampleStart uint64  `json:"core:sample_start"`
+	Frequency   float64 `json:"core:frequency,omitempty"` // Centre frequency, Hz
+	Datetime    string  `json:"core:datetime,omitempty"`  // RFC 3339
+
+	// Spectrum sweeps: the frequency of the first channel and the spacing
+	BaseHz    uint32 `json:"gocat:base_hz,omitempty"`
+	SpacingHz uint32 `json:"gocat:spacing_hz,omitempty"`
+}
+
+// Annotation labels a run of samples
+type Annotation struct {
+	SampleStart   uint64  `json:"core:sample_start"`
+	SampleCount   uint64  `json:"core:sample_count"`
+	FreqLowerEdge float64 `json:"core:freq_lower_edge,omitempty"`
+	FreqUpperEdge float64 `json:"core:freq_upper_edge,omitempty"`
+	Label         string  `json:"core:label,omitempty"`
+	Comment       string  `json:"core:comment,omitempty"`
+
+	// Packet recordings
+	Frequency uint32 `json:"gocat:frequency,omitempty"`
+	Timestamp string `json:"gocat:timestamp,omitempty"`
+	Pulses    []int  `json:"gocat:pulses,omitempty"`
+	RSSI      int    `json:"gocat:rssi_dbm,omitempty"`
+	LQI       uint8  `json:"gocat:lqi,omitempty"`
+}
+
+// ReadMeta reads the metadata file of a recording; path may name either
+// file of the pair
+func ReadMeta(path string) (*Meta, error) {
+	metaPath, _ := Paths(path)
+	raw, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SigMF recording: %w", err)
+	}
+	var m Meta
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid SigMF metadata: %w", err)
+	}
+	return &m, nil
+}
+
+// WriteMeta writes the metadata file of a recording
+func WriteMeta(path string, m *Meta) error {
+	metaPath, _ := Paths(path)
+	if m.Annotations == nil {
+		m.Annotations = []Annotation{}
+	}
+	if m.Captures == nil {
+		m.Captures = []Capture{}
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(metaPath, append(raw, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write SigMF metadata: %w", err)
+	}
+	return nil
+}
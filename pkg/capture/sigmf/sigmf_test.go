@@ -0,0 +1,154 @@
+package sigmf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPaths(t *testing.T) {
+	for _, path := range []string{"rec", "rec.sigmf", "rec.sigmf-meta", "rec.sigmf-data", "rec.SIGMF-META"} {
+		meta, data := Paths(path)
+		if meta != "rec"+MetaExt || data != "rec"+DataExt {
+			t.Errorf("Paths(%q) = %q, %q", path, meta, data)
+		}
+	}
+	if IsPath("rec.cap") || !IsPath("rec.sigmf-data") {
+		t.Error("IsPath misreads the extension")
+	}
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets.sigmf-meta")
+	want := &Meta{
+		Global: Global{
+			Datatype:    DatatypeBytes,
+			Version:     Version,
+			Recorder:    "gocat",
+			Description: "test",
+			HW:          "YardStick One",
+			Header:      json.RawMessage(`{"profile":"433-ook-keyfob-2.4k","frequency_hz":433920000}`),
+		},
+		Captures: []Capture{{SampleStart: 0, Frequency: 433.92e6, Datetime: "2024-05-01T12:00:00Z"}},
+		Annotations: []Annotation{
+			{SampleStart: 0, SampleCount: 4, Label: "packet", Frequency: 433920000, RSSI: -57, LQI: 12},
+			{SampleStart: 4, SampleCount: 9, Pulses: []int{350, -1050, 1050, -350}, Timestamp: "2024-05-01T12:00:01Z"},
+		},
+	}
+	if err := WriteMeta(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadMeta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is reindented on write; compare it by content
+	var gotHeader, wantHeader bytes.Buffer
+	if err := json.Compact(&gotHeader, got.Global.Header); err != nil {
+		t.Fatal(err)
+	}
+	json.Compact(&wantHeader, want.Global.Header)
+	if gotHeader.String() != wantHeader.String() {
+		t.Errorf("header = %s, want %s", gotHeader.String(), wantHeader.String())
+	}
+	got.Global.Header, want.Global.Header = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadata = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteMetaEmptyLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty")
+	if err := WriteMeta(path, &Meta{Global: Global{Datatype: DatatypeBytes, Version: Version}}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path + MetaExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The schema requires both arrays, even when empty
+	if !bytes.Contains(raw, []byte(`"captures": []`)) || !bytes.Contains(raw, []byte(`"annotations": []`)) {
+		t.Errorf("empty lists missing from metadata:\n%s", raw)
+	}
+}
+
+func TestSpectrumRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sweeps")
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	want := []*Sweep{
+		{Time: start, BaseHz: 433000000, SpacingHz: 25000, RSSI: []float32{-100, -99.5, -60.25, -98}},
+		{Time: start.Add(250 * time.Millisecond), BaseHz: 433000000, SpacingHz: 25000, RSSI: []float32{-101, -100, -59, -97.75}},
+		{Time: start.Add(500 * time.Millisecond), BaseHz: 868000000, SpacingHz: 50000, RSSI: []float32{-90, -91}},
+	}
+
+	w, err := CreateSpectrum(path, "YardStick One")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sw := range want {
+		if err := w.Write(sw); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			w.Mark(433050000, 433050000, "carrier")
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenSpectrum(path + DataExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m := r.Meta()
+	if m.Global.Datatype != DatatypeRSSI || m.Global.HW != "YardStick One" {
+		t.Errorf("global = %+v", m.Global)
+	}
+	if len(m.Captures) != len(want) {
+		t.Fatalf("%d captures, want %d", len(m.Captures), len(want))
+	}
+	if c := m.Captures[1]; c.SampleStart != 4 || c.Frequency != want[1].CenterHz() {
+		t.Errorf("capture 1 = %+v", c)
+	}
+	wantMark := []Annotation{{SampleStart: 6, SampleCount: 1, FreqLowerEdge: 433050000, FreqUpperEdge: 433050000, Label: "carrier"}}
+	if !reflect.DeepEqual(m.Annotations, wantMark) {
+		t.Errorf("annotations = %+v, want %+v", m.Annotations, wantMark)
+	}
+
+	for i, sw := range want {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("sweep %d: %v", i, err)
+		}
+		if !got.Time.Equal(sw.Time) {
+			t.Errorf("sweep %d time = %v, want %v", i, got.Time, sw.Time)
+		}
+		got.Time = sw.Time
+		if !reflect.DeepEqual(got, sw) {
+			t.Errorf("sweep %d = %+v, want %+v", i, got, sw)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("after the last sweep: %v, want io.EOF", err)
+	}
+}
+
+func TestOpenSpectrumRejectsPackets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets")
+	if err := WriteMeta(path, &Meta{Global: Global{Datatype: DatatypeBytes, Version: Version}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSpectrum(path); err == nil {
+		t.Error("opened a packet recording as a spectrum")
+	}
+}
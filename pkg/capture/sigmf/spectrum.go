@@ -0,0 +1,196 @@
+package sigmf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Sweep is one spectrum sweep: RSSI in dBm for evenly spaced channels
+type Sweep struct {
+	Time      time.Time
+	BaseHz    uint32 // Frequency of the first channel
+	SpacingHz uint32
+	RSSI      []float32
+}
+
+// CenterHz returns the frequency in the middle of the sweep
+func (s *Sweep) CenterHz() float64 {
+	return float64(s.BaseHz) + float64(s.SpacingHz)*float64(len(s.RSSI)-1)/2
+}
+
+// SpectrumWriter streams sweeps to a recording; the metadata is written
+// on Close
+type SpectrumWriter struct {
+	path   string
+	f      *os.File
+	w      *bufio.Writer
+	offset uint64
+	last   *Sweep
+	meta   Meta
+}
+
+// CreateSpectrum creates a spectrum recording; path may name either file
+// of the pair. hw describes the receiver (core:hw), and may be empty
+func CreateSpectrum(path, hw string) (*SpectrumWriter, error) {
+	_, dataPath := Paths(path)
+	f, err := os.Create(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SigMF recording: %w", err)
+	}
+	return &SpectrumWriter{
+		path: path,
+		f:    f,
+		w:    bufio.NewWriter(f),
+		meta: Meta{Global: Global{
+			Datatype:    DatatypeRSSI,
+			Version:     Version,
+			Recorder:    "gocat",
+			Description: "Spectrum sweeps: RSSI in dBm per channel, one capture segment per sweep",
+			HW:          hw,
+		}},
+	}, nil
+}
+
+// Write appends a sweep as a capture segment of len(s.RSSI) samples
+func (s *SpectrumWriter) Write(sw *Sweep) error {
+	buf := make([]byte, 4*len(sw.RSSI))
+	for i, v := range sw.RSSI {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	if _, err := s.w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write SigMF dataset: %w", err)
+	}
+	c := Capture{
+		SampleStart: s.offset,
+		Frequency:   sw.CenterHz(),
+		BaseHz:      sw.BaseHz,
+		SpacingHz:   sw.SpacingHz,
+	}
+	if !sw.Time.IsZero() {
+		c.Datetime = sw.Time.UTC().Format(time.RFC3339Nano)
+	}
+	s.meta.Captures = append(s.meta.Captures, c)
+	s.offset += uint64(len(sw.RSSI))
+	s.last = sw
+	return nil
+}
+
+// Mark annotates the channels between lowHz and highHz of the last sweep
+// written, e.g. with a detected signal's label
+func (s *SpectrumWriter) Mark(lowHz, highHz uint32, label string) {
+	if s.last == nil || s.last.SpacingHz == 0 {
+		return
+	}
+	n := len(s.last.RSSI)
+	first := channelOf(s.last, lowHz)
+	end := channelOf(s.last, highHz) + 1
+	if end > n {
+		end = n
+	}
+	s.meta.Annotations = append(s.meta.Annotations, Annotation{
+		SampleStart:   s.offset - uint64(n) + uint64(first),
+		SampleCount:   uint64(end - first),
+		FreqLowerEdge: float64(lowHz),
+		FreqUpperEdge: float64(highHz),
+		Label:         label,
+	})
+}
+
+func channelOf(sw *Sweep, hz uint32) int {
+	if hz <= sw.BaseHz {
+		return 0
+	}
+	i := int((hz - sw.BaseHz + sw.SpacingHz/2) / sw.SpacingHz)
+	if i >= len(sw.RSSI) {
+		i = len(sw.RSSI) - 1
+	}
+	return i
+}
+
+// Close flushes the dataset and writes the metadata
+func (s *SpectrumWriter) Close() error {
+	err := s.w.Flush()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write SigMF dataset: %w", err)
+	}
+	return WriteMeta(s.path, &s.meta)
+}
+
+// SpectrumReader yields the sweeps of a spectrum recording in order
+type SpectrumReader struct {
+	meta  *Meta
+	f     *os.File
+	total uint64
+	next  int
+}
+
+// OpenSpectrum opens a spectrum recording written by SpectrumWriter, or
+// by another tool that sets gocat:base_hz and gocat:spacing_hz on each
+// capture segment of an rf32_le dataset
+func OpenSpectrum(path string) (*SpectrumReader, error) {
+	m, err := ReadMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	if m.Global.Datatype != DatatypeRSSI {
+		return nil, fmt.Errorf("SigMF datatype %s is not a spectrum recording (want %s)", m.Global.Datatype, DatatypeRSSI)
+	}
+	_, dataPath := Paths(path)
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SigMF recording: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &SpectrumReader{meta: m, f: f, total: uint64(st.Size() / 4)}, nil
+}
+
+// Meta returns the recording's metadata, including any annotations
+func (r *SpectrumReader) Meta() *Meta {
+	return r.meta
+}
+
+// Next returns the next sweep, or io.EOF after the last
+func (r *SpectrumReader) Next() (*Sweep, error) {
+	if r.next >= len(r.meta.Captures) {
+		return nil, io.EOF
+	}
+	c := r.meta.Captures[r.next]
+	end := r.total
+	if r.next+1 < len(r.meta.Captures) {
+		end = r.meta.Captures[r.next+1].SampleStart
+	}
+	r.next++
+	if c.SpacingHz == 0 || end <= c.SampleStart || end > r.total {
+		return nil, fmt.Errorf("SigMF capture %d is not a gocat spectrum sweep", r.next-1)
+	}
+
+	buf := make([]byte, 4*(end-c.SampleStart))
+	if _, err := r.f.ReadAt(buf, int64(4*c.SampleStart)); err != nil {
+		return nil, fmt.Errorf("failed to read SigMF dataset: %w", err)
+	}
+	sw := &Sweep{BaseHz: c.BaseHz, SpacingHz: c.SpacingHz, RSSI: make([]float32, len(buf)/4)}
+	for i := range sw.RSSI {
+		sw.RSSI[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	if c.Datetime != "" {
+		sw.Time, _ = time.Parse(time.RFC3339Nano, c.Datetime)
+	}
+	return sw, nil
+}
+
+// Close closes the dataset
+func (r *SpectrumReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,168 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A gap this many symbol periods long ends a packet in RAW captures
+const subGapSymbols = 10
+
+// subReader reads Flipper Zero SubGHz files
+//
+// Key files (Protocol/Key lines) yield one packet per file with the key
+// bytes. RAW files yield one packet per burst, with the pulse timings sliced
+// into OOK bits at the estimated symbol period.
+type subReader struct {
+	packets []*Packet
+	idx     int
+}
+
+func newSubReader(r io.Reader) (*subReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var freq uint32
+	var pulses []int
+	var key []byte
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(name) {
+		case "Frequency":
+			f, err := strconv.ParseUint(value, 10, 32)
+			if err == nil {
+				freq = uint32(f)
+			}
+		case "RAW_Data":
+			for _, field := range strings.Fields(value) {
+				v, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("invalid RAW_Data value '%s'", field)
+				}
+				pulses = append(pulses, v)
+			}
+		case "Key":
+			b, err := hex.DecodeString(strings.ReplaceAll(value, " ", ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Key: %w", err)
+			}
+			key = b
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	s := &subReader{}
+	if key != nil {
+		s.packets = append(s.packets, &Packet{Data: key, Frequency: freq})
+	}
+	for _, burst := range splitBursts(pulses) {
+		s.packets = append(s.packets, &Packet{
+			Data:      PulsesToBits(burst),
+			Pulses:    burst,
+			Frequency: freq,
+		})
+	}
+
+	return s, nil
+}
+
+func (s *subReader) Next() (*Packet, error) {
+	if s.idx >= len(s.packets) {
+		return nil, io.EOF
+	}
+	p := s.packets[s.idx]
+	s.idx++
+	return p, nil
+}
+
+// EstimateSymbolPeriod returns the shortest typical pulse width in microseconds
+// The 10th percentile is used so a few glitches don't collapse the estimate
+func EstimateSymbolPeriod(pulses []int) int {
+	if len(pulses) == 0 {
+		return 0
+	}
+	widths := make([]int, len(pulses))
+	for i, p := range pulses {
+		if p < 0 {
+			p = -p
+		}
+		widths[i] = p
+	}
+	sort.Ints(widths)
+	period := widths[len(widths)/10]
+	if period <= 0 {
+		period = 1
+	}
+	return period
+}
+
+// splitBursts breaks a pulse train at long low gaps
+func splitBursts(pulses []int) [][]int {
+	period := EstimateSymbolPeriod(pulses)
+	if period == 0 {
+		return nil
+	}
+
+	var bursts [][]int
+	var cur []int
+	for _, p := range pulses {
+		if p < 0 && -p >= period*subGapSymbols {
+			if len(cur) > 0 {
+				bursts = append(bursts, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, p)
+	}
+	if len(cur) > 0 {
+		bursts = append(bursts, cur)
+	}
+	return bursts
+}
+
+// PulsesToBits slices a pulse train into OOK bits at the estimated symbol period
+// Bits are packed MSB first; the final byte is zero padded
+func PulsesToBits(pulses []int) []byte {
+	period := EstimateSymbolPeriod(pulses)
+	if period == 0 {
+		return nil
+	}
+
+	var out []byte
+	nbits := 0
+	for _, p := range pulses {
+		level := byte(0)
+		width := -p
+		if p > 0 {
+			level = 1
+			width = p
+		}
+		n := (width + period/2) / period
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			if nbits%8 == 0 {
+				out = append(out, 0)
+			}
+			out[len(out)-1] |= level << uint(7-nbits%8)
+			nbits++
+		}
+	}
+	return out
+}
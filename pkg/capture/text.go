@@ -0,0 +1,133 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// hexReader reads one hex packet per line, ignoring blank lines and # comments
+type hexReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newHexReader(r io.Reader) *hexReader {
+	return &hexReader{scanner: bufio.NewScanner(r)}
+}
+
+func (h *hexReader) Next() (*Packet, error) {
+	for h.scanner.Scan() {
+		h.line++
+		text := strings.TrimSpace(h.scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.ReplaceAll(text, " ", "")
+		data, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid hex: %w", h.line, err)
+		}
+		return &Packet{Data: data}, nil
+	}
+	if err := h.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// nativeRecord mirrors the fields of annotate.Record that matter for replay
+type nativeRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Raw       []byte    `json:"raw"`
+	Data      []byte    `json:"data"`
+	Pulses    []int     `json:"pulses,omitempty"`
+	Frequency uint32    `json:"frequency_hz,omitempty"`
+	RSSI      int       `json:"rssi_dbm,omitempty"`
+	LQI       uint8     `json:"lqi,omitempty"`
+
+	// The annotate JSON sink records RSSI as a field
+	Fields *struct {
+		RSSI int `json:"rssi_dbm"`
+	} `json:"fields,omitempty"`
+}
+
+// nativeReader reads JSON lines as written by the annotate JSON sink,
+// optionally preceded by a versioned header line
+type nativeReader struct {
+	dec     *json.Decoder
+	header  *Header
+	pending *nativeRecord
+	err     error
+}
+
+func newNativeReader(r io.Reader) *nativeReader {
+	n := &nativeReader{dec: json.NewDecoder(r)}
+
+	// The header, if any, is the first object; otherwise keep the record
+	var raw json.RawMessage
+	if err := n.dec.Decode(&raw); err != nil {
+		n.err = err
+		if err != io.EOF {
+			n.err = fmt.Errorf("invalid native record: %w", err)
+		}
+		return n
+	}
+	h, isHeader, err := parseHeader(raw)
+	switch {
+	case err != nil:
+		n.err = err
+	case isHeader:
+		n.header = h
+	default:
+		var rec nativeRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			n.err = fmt.Errorf("invalid native record: %w", err)
+		} else {
+			n.pending = &rec
+		}
+	}
+	return n
+}
+
+// Header returns the capture header, or nil for a version 0 capture
+func (n *nativeReader) Header() *Header {
+	return n.header
+}
+
+func (n *nativeReader) Next() (*Packet, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+
+	rec := n.pending
+	n.pending = nil
+	if rec == nil {
+		rec = &nativeRecord{}
+		if err := n.dec.Decode(rec); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("invalid native record: %w", err)
+		}
+	}
+
+	// Replay from the raw bytes so decoding stages run again from scratch
+	data := rec.Raw
+	if data == nil {
+		data = rec.Data
+	}
+	freq := rec.Frequency
+	if freq == 0 && n.header != nil {
+		freq = n.header.FrequencyHz
+	}
+	rssi := rec.RSSI
+	if rssi == 0 && rec.Fields != nil {
+		rssi = rec.Fields.RSSI
+	}
+	return &Packet{Timestamp: rec.Timestamp, Data: data, Pulses: rec.Pulses, Frequency: freq, RSSI: rssi, LQI: rec.LQI}, nil
+}
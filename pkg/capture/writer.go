@@ -0,0 +1,263 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Writer records packets in one of the capture formats
+// Close flushes formats that buffer (sub, SigMF); it does not close the
+// underlying io.Writer
+type Writer interface {
+	Write(p *Packet) error
+	Close() error
+}
+
+// NewWriter creates a writer for a stream format; hdr may be nil
+// SigMF needs two files, so use Create for it
+func NewWriter(w io.Writer, format string, hdr *Header) (Writer, error) {
+	if hdr == nil {
+		hdr = NewHeader()
+	}
+	switch format {
+	case FormatNative:
+		return newNativeWriter(w, hdr)
+	case FormatHex:
+		return &hexWriter{w: w}, nil
+	case FormatPcap:
+		return newPcapWriter(w)
+	case FormatSub:
+		return &subWriter{w: w, hdr: hdr}, nil
+	case FormatSigMF:
+		return nil, fmt.Errorf("SigMF captures are a file pair; use capture.Create")
+	default:
+		return nil, fmt.Errorf("unknown capture format '%s'", format)
+	}
+}
+
+// FileWriter is a capture writer backed by a created file
+type FileWriter struct {
+	Writer
+	f *os.File
+}
+
+// Create creates a capture file; format "" or "auto" detects from the
+// extension. For SigMF, path may name either file of the pair
+func Create(path string, format string, hdr *Header) (*FileWriter, error) {
+	if format == "" || format == "auto" {
+		format = DetectFormat(path)
+	}
+	if format == FormatSigMF {
+		w, err := createSigMF(path, hdr)
+		if err != nil {
+			return nil, err
+		}
+		return &FileWriter{Writer: w}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture: %w", err)
+	}
+	w, err := NewWriter(f, format, hdr)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &FileWriter{Writer: w, f: f}, nil
+}
+
+// Close flushes the writer and closes the file
+func (c *FileWriter) Close() error {
+	err := c.Writer.Close()
+	if c.f != nil {
+		if cerr := c.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// nativeWriter writes a header line followed by one JSON record per packet
+type nativeWriter struct {
+	enc *json.Encoder
+}
+
+func newNativeWriter(w io.Writer, hdr *Header) (*nativeWriter, error) {
+	h := *hdr
+	h.Version = SchemaVersion
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(&h); err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+	return &nativeWriter{enc: enc}, nil
+}
+
+func (n *nativeWriter) Write(p *Packet) error {
+	return n.enc.Encode(&nativeRecord{
+		Timestamp: p.Timestamp,
+		Raw:       p.Data,
+		Data:      p.Data,
+		Pulses:    p.Pulses,
+		Frequency: p.Frequency,
+		RSSI:      p.RSSI,
+		LQI:       p.LQI,
+	})
+}
+
+func (n *nativeWriter) Close() error { return nil }
+
+// hexWriter writes one hex packet per line; timing and metadata are lost
+type hexWriter struct {
+	w io.Writer
+}
+
+func (h *hexWriter) Write(p *Packet) error {
+	_, err := fmt.Fprintln(h.w, hex.EncodeToString(p.Data))
+	return err
+}
+
+func (h *hexWriter) Close() error { return nil }
+
+// pcapLinkTypeUser0 is the DLT reserved for private use; gocat writes raw
+// radio payloads with it
+const pcapLinkTypeUser0 = 147
+
+// pcapWriter writes classic microsecond libpcap files
+type pcapWriter struct {
+	w io.Writer
+}
+
+func newPcapWriter(w io.Writer) (*pcapWriter, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2) // Version 2.4
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 0xFFFF) // Snap length
+	binary.LittleEndian.PutUint32(hdr[20:], pcapLinkTypeUser0)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, fmt.Errorf("failed to write pcap header: %w", err)
+	}
+	return &pcapWriter{w: w}, nil
+}
+
+func (p *pcapWriter) Write(pkt *Packet) error {
+	rec := make([]byte, 16, 16+len(pkt.Data))
+	if !pkt.Timestamp.IsZero() {
+		binary.LittleEndian.PutUint32(rec[0:], uint32(pkt.Timestamp.Unix()))
+		binary.LittleEndian.PutUint32(rec[4:], uint32(pkt.Timestamp.Nanosecond()/1000))
+	}
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt.Data)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt.Data)))
+	_, err := p.w.Write(append(rec, pkt.Data...))
+	return err
+}
+
+func (p *pcapWriter) Close() error { return nil }
+
+// subRawValuesPerLine matches the line length Flipper firmware writes
+const subRawValuesPerLine = 512
+
+// subWriter collects pulses and writes a Flipper RAW file on Close
+// Packets without pulse timings are expanded from their bits as OOK at
+// the header's data rate
+type subWriter struct {
+	w      io.Writer
+	hdr    *Header
+	freq   uint32
+	pulses []int
+}
+
+func (s *subWriter) Write(p *Packet) error {
+	if s.freq == 0 {
+		s.freq = p.Frequency
+	}
+	pulses := p.Pulses
+	if len(pulses) == 0 {
+		if s.hdr.DataRate <= 0 {
+			return fmt.Errorf(".sub output needs pulse timings or the capture's data rate")
+		}
+		pulses = BitsToPulses(p.Data, int(1e6/s.hdr.DataRate+0.5))
+	}
+	if len(pulses) == 0 {
+		return nil
+	}
+
+	// Separate packets with a gap the reader will split on, folding any
+	// leading low time into it
+	if len(s.pulses) > 0 {
+		gap := -EstimateSymbolPeriod(pulses) * subGapSymbols * 2
+		if last := len(s.pulses) - 1; s.pulses[last] < 0 {
+			gap += s.pulses[last]
+			s.pulses = s.pulses[:last]
+		}
+		for len(pulses) > 0 && pulses[0] < 0 {
+			gap += pulses[0]
+			pulses = pulses[1:]
+		}
+		s.pulses = append(s.pulses, gap)
+	}
+	s.pulses = append(s.pulses, pulses...)
+	return nil
+}
+
+func (s *subWriter) Close() error {
+	freq := s.freq
+	if freq == 0 {
+		freq = s.hdr.FrequencyHz
+	}
+	if freq == 0 {
+		return fmt.Errorf(".sub output needs the capture frequency")
+	}
+
+	bw := bufio.NewWriter(s.w)
+	fmt.Fprintf(bw, "Filetype: Flipper SubGhz RAW File\n")
+	fmt.Fprintf(bw, "Version: 1\n")
+	fmt.Fprintf(bw, "Frequency: %d\n", freq)
+	fmt.Fprintf(bw, "Preset: FuriHalSubGhzPresetOok650Async\n")
+	fmt.Fprintf(bw, "Protocol: RAW\n")
+	for i := 0; i < len(s.pulses); i += subRawValuesPerLine {
+		end := i + subRawValuesPerLine
+		if end > len(s.pulses) {
+			end = len(s.pulses)
+		}
+		fields := make([]string, end-i)
+		for j, v := range s.pulses[i:end] {
+			fields[j] = strconv.Itoa(v)
+		}
+		fmt.Fprintf(bw, "RAW_Data: %s\n", strings.Join(fields, " "))
+	}
+	return bw.Flush()
+}
+
+// BitsToPulses expands MSB-first OOK bits into signed pulse durations in
+// microseconds, merging runs of the same level; the inverse of PulsesToBits
+func BitsToPulses(data []byte, periodUs int) []int {
+	var pulses []int
+	for i := 0; i < len(data)*8; i++ {
+		bit := data[i/8]>>uint(7-i%8)&1 == 1
+		d := periodUs
+		if !bit {
+			d = -periodUs
+		}
+		n := len(pulses)
+		if n > 0 && (pulses[n-1] > 0) == bit {
+			pulses[n-1] += d
+			continue
+		}
+		pulses = append(pulses, d)
+	}
+	// Trailing low time is idle, not signal
+	if n := len(pulses); n > 0 && pulses[n-1] < 0 {
+		pulses = pulses[:n-1]
+	}
+	return pulses
+}
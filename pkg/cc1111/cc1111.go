@@ -0,0 +1,87 @@
+// Package cc1111 holds radio tables and names of the CC1111 family that
+// need no device access, so data packages such as profiles can use them
+// without pulling in USB
+package cc1111
+
+import (
+	"fmt"
+	"math"
+)
+
+// ModulationName returns the name of a MOD_FORMAT value (MDMCFG2 bits 6:4)
+func ModulationName(mod uint8) string {
+	switch mod & 0x70 {
+	case 0x00:
+		return "2-FSK"
+	case 0x10:
+		return "GFSK"
+	case 0x30:
+		return "ASK/OOK"
+	case 0x40:
+		return "4-FSK"
+	case 0x70:
+		return "MSK"
+	}
+	return fmt.Sprintf("unknown (0x%02X)", mod)
+}
+
+// paSetting is a PA_TABLE value and the CC1111 output power it gives
+type paSetting struct {
+	dBm   float64
+	value uint8
+}
+
+// Recommended PA_TABLE values per band, lowest power first
+// Power is at the CC1111 output, before the YS1 front-end amplifier
+var paTables = []struct {
+	maxHz    uint32
+	settings []paSetting
+}{
+	{400000000, []paSetting{{-30, 0x12}, {-20, 0x0D}, {-10, 0x1C}, {-5, 0x34}, {0, 0x51}, {5, 0x85}, {7, 0xCB}, {10, 0xC2}}},
+	{464000000, []paSetting{{-30, 0x12}, {-20, 0x0E}, {-10, 0x1D}, {-5, 0x34}, {0, 0x60}, {5, 0x84}, {7, 0xC8}, {10, 0xC0}}},
+	{849000000, []paSetting{{-30, 0x03}, {-20, 0x0E}, {-10, 0x27}, {-5, 0x67}, {0, 0x50}, {5, 0x81}, {7, 0xCB}, {10, 0xC2}}},
+	{1000000000, []paSetting{{-30, 0x03}, {-20, 0x0E}, {-10, 0x1E}, {-5, 0x27}, {0, 0x8E}, {5, 0xCD}, {7, 0xC7}, {10, 0xC0}}},
+	// CC2510/CC2511 at 2.4 GHz, which tops out at +1 dBm
+	{math.MaxUint32, []paSetting{{-30, 0x50}, {-20, 0x46}, {-10, 0x97}, {-6, 0x7F}, {-4, 0xA9}, {-2, 0xBB}, {0, 0xFE}, {1, 0xFF}}},
+}
+
+// PATableValue returns the PA_TABLE value for the highest table setting
+// not above dBm in the band of freqHz, and the power it gives
+func PATableValue(freqHz uint32, dBm float64) (uint8, float64, error) {
+	var settings []paSetting
+	for _, t := range paTables {
+		if freqHz <= t.maxHz {
+			settings = t.settings
+			break
+		}
+	}
+	if dBm < settings[0].dBm {
+		return 0, 0, fmt.Errorf("TX power %.1f dBm below minimum %.0f dBm", dBm, settings[0].dBm)
+	}
+	chosen := settings[0]
+	for _, s := range settings {
+		if s.dBm <= dBm {
+			chosen = s
+		}
+	}
+	return chosen.value, chosen.dBm, nil
+}
+
+// PATableDBm returns the power of a PA table setting in the band of freq;
+// false when pa is not one of the recommended table values
+func PATableDBm(freq uint32, pa uint8) (float64, bool) {
+	if freq == 0 {
+		return 0, false
+	}
+	for _, t := range paTables {
+		if freq <= t.maxHz {
+			for _, s := range t.settings {
+				if s.value == pa {
+					return s.dBm, true
+				}
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
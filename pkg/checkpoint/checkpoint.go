@@ -0,0 +1,158 @@
+// Package checkpoint periodically saves the state of long-running tools to
+// disk and restores it on restart, so a crash or reboot doesn't wipe
+// accumulated statistics
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often a Saver writes when no interval is given
+const DefaultInterval = 30 * time.Second
+
+// Save writes v as JSON to path atomically
+func Save(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	return WriteFile(path, data)
+}
+
+// WriteFile replaces path with data, creating its directory if needed
+// It writes a temp file and renames it over path, so a crash mid-write
+// leaves the previous contents rather than a truncated file
+func WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// Load reads a checkpoint into v
+// Returns false without error if no checkpoint exists yet
+func Load(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	return true, nil
+}
+
+// Savers that have been started and not stopped, for Exit
+var (
+	runningMu sync.Mutex
+	running   = make(map[*Saver]bool)
+)
+
+// Saver writes a snapshot to disk at a fixed interval in the background
+type Saver struct {
+	path     string
+	interval time.Duration
+	snapshot func() interface{}
+	errFn    func(error)
+
+	mu       sync.Mutex
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// NewSaver creates a saver; snapshot is called on each tick and must be
+// safe to call concurrently with the tool's own work. errFn may be nil
+func NewSaver(path string, interval time.Duration, snapshot func() interface{}, errFn func(error)) *Saver {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Saver{path: path, interval: interval, snapshot: snapshot, errFn: errFn}
+}
+
+// Start begins periodic saving
+func (s *Saver) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopChan != nil {
+		return
+	}
+	s.stopChan = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop(s.stopChan, s.done)
+
+	runningMu.Lock()
+	running[s] = true
+	runningMu.Unlock()
+}
+
+// Stop halts periodic saving and writes a final checkpoint
+func (s *Saver) Stop() error {
+	s.mu.Lock()
+	stop, done := s.stopChan, s.done
+	s.stopChan, s.done = nil, nil
+	s.mu.Unlock()
+
+	runningMu.Lock()
+	delete(running, s)
+	runningMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return Save(s.path, s.snapshot())
+}
+
+// Exit stops every running Saver, so each writes its final checkpoint,
+// then exits with code. os.Exit skips deferred calls, so a tool with a
+// Saver running exits through here instead
+func Exit(code int) {
+	runningMu.Lock()
+	savers := make([]*Saver, 0, len(running))
+	for s := range running {
+		savers = append(savers, s)
+	}
+	runningMu.Unlock()
+
+	for _, s := range savers {
+		if err := s.Stop(); err != nil && s.errFn != nil {
+			s.errFn(err)
+		}
+	}
+	os.Exit(code)
+}
+
+func (s *Saver) loop(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := Save(s.path, s.snapshot()); err != nil && s.errFn != nil {
+				s.errFn(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package coding provides software implementations of the CC1111 packet
+// engine's line coding (CRC16, PN9 data whitening, Manchester)
+//
+// These are used to process packets received with the corresponding hardware
+// features disabled, e.g. when sniffing traffic from other systems, and to
+// build pre-coded payloads for transmission.
+package coding
@@ -0,0 +1,42 @@
+package coding
+
+// CRC16 polynomial and initial value used by the CC1111 packet engine
+const (
+	CRC16Poly = 0x8005
+	CRC16Init = 0xFFFF
+)
+
+// CRC16 computes the CC1111 hardware CRC over data (x^16 + x^15 + x^2 + 1, init 0xFFFF)
+func CRC16(data []byte) uint16 {
+	crc := uint16(CRC16Init)
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			if ((crc>>8)^uint16(b))&0x80 != 0 {
+				crc = (crc << 1) ^ CRC16Poly
+			} else {
+				crc <<= 1
+			}
+			b <<= 1
+		}
+	}
+	return crc
+}
+
+// AppendCRC16 returns data with its CRC16 appended, MSB first as transmitted by the radio
+func AppendCRC16(data []byte) []byte {
+	crc := CRC16(data)
+	out := make([]byte, len(data), len(data)+2)
+	copy(out, data)
+	return append(out, byte(crc>>8), byte(crc))
+}
+
+// CheckCRC16 verifies a packet whose last two bytes are the CRC16 (MSB first)
+// Returns the payload without the CRC and whether the CRC matched
+func CheckCRC16(packet []byte) ([]byte, bool) {
+	if len(packet) < 2 {
+		return packet, false
+	}
+	payload := packet[:len(packet)-2]
+	got := uint16(packet[len(packet)-2])<<8 | uint16(packet[len(packet)-1])
+	return payload, CRC16(payload) == got
+}
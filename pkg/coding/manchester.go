@@ -0,0 +1,47 @@
+package coding
+
+// Manchester coding follows the CC1111 convention: a 1 bit is sent as
+// the symbol pair 10 and a 0 bit as 01
+
+// ManchesterEncode expands each bit of data into two symbols
+func ManchesterEncode(data []byte) []byte {
+	out := make([]byte, len(data)*2)
+	for i, b := range data {
+		var word uint16
+		for bit := 7; bit >= 0; bit-- {
+			word <<= 2
+			if b&(1<<uint(bit)) != 0 {
+				word |= 0x2 // 10
+			} else {
+				word |= 0x1 // 01
+			}
+		}
+		out[i*2] = byte(word >> 8)
+		out[i*2+1] = byte(word)
+	}
+	return out
+}
+
+// ManchesterDecode collapses symbol pairs back into bits
+// Invalid pairs (00 or 11) decode as 0 and are counted in the returned error count
+// A trailing odd byte is ignored
+func ManchesterDecode(data []byte) ([]byte, int) {
+	out := make([]byte, len(data)/2)
+	errors := 0
+	for i := range out {
+		word := uint16(data[i*2])<<8 | uint16(data[i*2+1])
+		var b byte
+		for bit := 7; bit >= 0; bit-- {
+			b <<= 1
+			switch (word >> uint(bit*2)) & 0x3 {
+			case 0x2:
+				b |= 1
+			case 0x1:
+			default:
+				errors++
+			}
+		}
+		out[i] = b
+	}
+	return out, errors
+}
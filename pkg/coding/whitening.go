@@ -0,0 +1,24 @@
+package coding
+
+// PN9Seed is the initial state of the CC1111 PN9 whitening sequence
+const PN9Seed = 0x1FF
+
+// Whiten XORs data with the CC1111 PN9 sequence (x^9 + x^5 + 1, seed 0x1FF)
+// Whitening is its own inverse, so this also de-whitens
+func Whiten(data []byte) []byte {
+	out := make([]byte, len(data))
+	key := uint16(PN9Seed)
+	for i, b := range data {
+		out[i] = b ^ byte(key)
+		for j := 0; j < 8; j++ {
+			msb := ((key >> 5) ^ key) & 1
+			key = (key >> 1) | (msb << 8)
+		}
+	}
+	return out
+}
+
+// Dewhiten removes CC1111 PN9 whitening from data
+func Dewhiten(data []byte) []byte {
+	return Whiten(data)
+}
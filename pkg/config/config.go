@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/herlein/gocat/pkg/profiles"
 	"github.com/herlein/gocat/pkg/registers"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
@@ -56,6 +57,8 @@ func DumpFromDevice(device *yardstick.Device) (*DeviceConfig, error) {
 		}
 	}
 
+	device.SetApplied(registerMap)
+
 	return &DeviceConfig{
 		Serial:       device.Serial,
 		Manufacturer: device.Manufacturer,
@@ -89,6 +92,9 @@ func ApplyToDevice(device *yardstick.Device, configuration *DeviceConfig) error
 		return fmt.Errorf("failed to write registers: %w", err)
 	}
 
+	applied := configuration.Registers
+	recordApplied(device, &applied, configuration.PartNum)
+
 	// Restore original state
 	if originalState != registers.StateIDLE {
 		switch originalState {
@@ -102,16 +108,87 @@ func ApplyToDevice(device *yardstick.Device, configuration *DeviceConfig) error
 	return nil
 }
 
+// recordApplied notes what was written so Cached can answer without a
+// dump, and points payload validation, transmit timeouts and rate limits
+// at the new packet format. regs must not be modified afterwards; the
+// device keeps both current through later register pokes
+func recordApplied(device *yardstick.Device, regs *registers.RegisterMap, partNum uint8) {
+	device.SetApplied(regs)
+	device.SetPacketFormat(&yardstick.PacketFormat{
+		LengthMode:   regs.PKTCTRL0 & 0x03,
+		PktLen:       regs.PKTLEN,
+		AppendStatus: regs.PKTCTRL1&0x04 != 0,
+	})
+	crystalMHz := GetCrystalFrequency(partNum)
+	device.SetAirtimeFunc(func(n int) time.Duration {
+		// Setters such as SetDataRate replace the applied registers
+		current := regs
+		if now, ok := device.Applied().(*registers.RegisterMap); ok {
+			current = now
+		}
+		return profiles.AirtimeFromRegisters(current, crystalMHz, n)
+	})
+}
+
+// ApplyProfile writes a radio profile to a device
+func ApplyProfile(device *yardstick.Device, profile *profiles.Profile) error {
+	partNum, err := device.GetPartNum()
+	if err == nil && profiles.CrystalMHzFor(profile.FrequencyHz) != GetCrystalFrequency(partNum) {
+		return fmt.Errorf("%w: profile %s is for a %.0f MHz crystal, the %s has %.0f MHz",
+			ErrInvalid, profile.Name, profiles.CrystalMHzFor(profile.FrequencyHz),
+			yardstick.ChipName(partNum), GetCrystalFrequency(partNum))
+	}
+	return ApplyToDevice(device, &DeviceConfig{
+		Serial:    device.Serial,
+		PartNum:   partNum,
+		Timestamp: time.Now(),
+		Registers: *profile.ToRegisters(),
+	})
+}
+
+// Cached returns the registers last applied to or dumped from the device,
+// if nothing has poked the radio registers or reset the device since
+func Cached(device *yardstick.Device) (*registers.RegisterMap, bool) {
+	regs, ok := device.Applied().(*registers.RegisterMap)
+	if !ok {
+		return nil, false
+	}
+	copied := *regs
+	return &copied, true
+}
+
+// Replay reapplies a configuration recorded with SetApplied, for use as a
+// yardstick.Monitor Replay function after the device is plugged back in
+func Replay(device *yardstick.Device, applied interface{}) error {
+	regs, ok := applied.(*registers.RegisterMap)
+	if !ok {
+		return fmt.Errorf("cannot replay configuration of type %T", applied)
+	}
+	partNum, _ := device.GetPartNum()
+	return ApplyToDevice(device, &DeviceConfig{
+		Serial:    device.Serial,
+		PartNum:   partNum,
+		Timestamp: time.Now(),
+		Registers: *regs,
+	})
+}
+
+// Current returns the cached registers, falling back to reading them
+// from the device when the cache has been invalidated
+func Current(device *yardstick.Device) (*registers.RegisterMap, error) {
+	if regs, ok := Cached(device); ok {
+		return regs, nil
+	}
+	cfg, err := DumpFromDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg.Registers, nil
+}
+
 // GetCrystalFrequency returns the crystal frequency in MHz based on part number
 func GetCrystalFrequency(partNum uint8) float64 {
-	switch partNum {
-	case yardstick.PartNumCC1110, yardstick.PartNumCC1111:
-		return 24.0
-	case yardstick.PartNumCC2510, yardstick.PartNumCC2511:
-		return 26.0
-	default:
-		return 24.0 // Default to 24 MHz
-	}
+	return float64(yardstick.CrystalHzFor(partNum)) / 1e6
 }
 
 // GetFrequencyMHz returns the configured frequency in MHz
@@ -120,6 +197,12 @@ func (c *DeviceConfig) GetFrequencyMHz() float64 {
 	return registers.GetFrequency(&c.Registers, crystalMHz) / 1e6
 }
 
+// GetDataRateBaud returns the configured data rate in baud
+func (c *DeviceConfig) GetDataRateBaud() float64 {
+	crystalMHz := GetCrystalFrequency(c.PartNum)
+	return registers.GetDataRate(&c.Registers, crystalMHz)
+}
+
 // GetSyncWord returns the 16-bit sync word
 func (c *DeviceConfig) GetSyncWord() uint16 {
 	return registers.GetSyncWord(&c.Registers)
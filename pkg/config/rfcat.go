@@ -0,0 +1,373 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+)
+
+// Value names rfcat's reprRadioConfig uses, indexed by register field
+var (
+	rfcatModulations = map[uint8]string{
+		registers.Mod2FSK:   "2FSK",
+		registers.ModGFSK:   "GFSK",
+		registers.ModASKOOK: "ASK/OOK",
+		registers.Mod4FSK:   "4FSK",
+		registers.ModMSK:    "MSK",
+	}
+	rfcatSyncModes = []string{
+		"None",
+		"15 of 16 bits must match",
+		"16 of 16 bits must match",
+		"30 of 32 sync bits must match",
+		"Carrier Detect",
+		"Carrier Detect and 15 of 16 sync bits must match",
+		"Carrier Detect and 16 of 16 sync bits must match",
+		"Carrier Detect and 30 of 32 sync bits must match",
+	}
+	rfcatLengthConfigs = []string{
+		"Fixed Packet Mode",
+		"Variable Packet Mode (len=first byte after sync word)",
+		"Infinite Packet Mode",
+		"reserved",
+	}
+	rfcatAddrChecks = []string{
+		"No address check",
+		"Address Check, No Broadcast",
+		"Address Check, 0x00 is broadcast",
+		"Address Check, 0x00 and 0xff are broadcast",
+	}
+	rfcatPktFormats = []string{
+		"Normal mode",
+		"reserved...",
+		"Random TX mode",
+		"reserved",
+	}
+	rfcatPreambles = []int{2, 3, 4, 6, 8, 12, 16, 24}
+)
+
+// FormatRFCat returns the configuration in the text format of rfcat's
+// d.reprRadioConfig(), for rfcat users comparing settings. The AES and
+// client state sections are left out: they are not radio registers
+func FormatRFCat(c *DeviceConfig) string {
+	r := &c.Registers
+	mhz := GetCrystalFrequency(c.PartNum)
+	xtal := mhz * 1e6
+
+	var b strings.Builder
+	line := func(label, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-20s %s\n", label+":", fmt.Sprintf(format, args...))
+	}
+
+	b.WriteString("== Hardware ==\n")
+	dongle, rev, _ := strings.Cut(c.BuildType, " r")
+	line("Dongle", "%s", dongle)
+	if rev != "" {
+		line("Firmware rev", "%s", rev)
+	} else {
+		line("Firmware rev", "Not found! Update needed!")
+	}
+
+	b.WriteString("\n== Software ==\n")
+	line("rflib rev", "gocat")
+
+	b.WriteString("\n== Frequency Configuration ==\n")
+	num := uint32(r.FREQ2)<<16 | uint32(r.FREQ1)<<8 | uint32(r.FREQ0)
+	line("Frequency", "%f hz (0x%x)", registers.GetFrequency(r, mhz), num)
+	line("Channel", "%d", r.CHANNR)
+	line("Intermediate freq", "%d hz", int(xtal/(1<<10)*float64(r.FSCTRL1&0x1F)))
+	line("Frequency Offset", "%d +/-", int(xtal/(1<<14)*float64(int8(r.FSCTRL0))))
+	line("Est. Freq Offset", "%d", int(xtal/(1<<14)*float64(int8(r.FREQEST))))
+
+	b.WriteString("\n== Modem Configuration ==\n")
+	mod, ok := rfcatModulations[registers.GetModulation(r)]
+	if !ok {
+		mod = fmt.Sprintf("unknown (0x%02x)", registers.GetModulation(r))
+	}
+	line("Modulation", "%s", mod)
+	line("DC Filter", "%s", onOff(r.MDMCFG2&0x80 == 0, "enabled", "disabled"))
+	line("Manchester Encoding", "%s", onOff(r.MDMCFG2&0x08 != 0, "enabled", "disabled"))
+	line("Sync Mode", "%s", rfcatSyncModes[registers.GetSyncMode(r)])
+	line("Min TX Preamble", "%d bytes", rfcatPreambles[(r.MDMCFG1>>4)&0x07])
+	line("Chan Spacing", "%.3f hz", xtal/(1<<18)*(256+float64(r.MDMCFG0))*float64(int(1)<<(r.MDMCFG1&0x03)))
+	line("Channel BW", "%.3f hz", xtal/(8*(4+float64((r.MDMCFG4>>4)&0x03))*float64(int(1)<<(r.MDMCFG4>>6))))
+	line("Data Rate", "%.3f hz", registers.GetDataRate(r, mhz))
+	line("Deviation", "%f hz", xtal/(1<<17)*(8+float64(r.DEVIATN&0x07))*float64(int(1)<<((r.DEVIATN>>4)&0x07)))
+	line("FEC", "%s", onOff(r.MDMCFG1&0x80 != 0, "enabled", "disabled"))
+
+	b.WriteString("\n== Packet Configuration ==\n")
+	line("Sync Word", "0x%02X%02X", r.SYNC1, r.SYNC0)
+	line("Packet Length", "%d", r.PKTLEN)
+	line("Length Config", "%s", rfcatLengthConfigs[r.PKTCTRL0&0x03])
+	line("Configured Address", "0x%x", r.ADDR)
+	line("Preamble Quality Threshold", "4 * %d", r.PKTCTRL1>>5)
+	line("Append Status", "%s", onOff(r.PKTCTRL1&0x04 != 0, "Yes", "No"))
+	line("Rcvd Packet Check", "%s", rfcatAddrChecks[r.PKTCTRL1&0x03])
+	line("Data Whitening", "%s", onOff(r.PKTCTRL0&0x40 != 0, "ON (but only with cc2400_en==0)", "off"))
+	line("Packet Format", "%s", rfcatPktFormats[(r.PKTCTRL0>>4)&0x03])
+	line("CRC", "%s", onOff(r.PKTCTRL0&0x04 != 0, "ENABLED", "disabled"))
+
+	b.WriteString("\n== Radio Test Signal Configuration ==\n")
+	line("TEST2", "0x%x", r.TEST2)
+	line("TEST1", "0x%x", r.TEST1)
+	line("TEST0", "0x%x", r.TEST0)
+
+	b.WriteString("\n== Radio State ==\n")
+	line("     MARCSTATE", "%s (%x)", registers.RadioState(r.MARCSTATE&0x1F), r.MARCSTATE&0x1F)
+	return b.String()
+}
+
+func onOff(on bool, yes, no string) string {
+	if on {
+		return yes
+	}
+	return no
+}
+
+// ParseRFCat reads a configuration pasted from rfcat's
+// d.reprRadioConfig() output. The dump leaves out registers such as AGC
+// and PA settings, so those come from base; nil base starts from the
+// profile defaults. Lines it doesn't know, such as the client state, are
+// skipped, and the labels and values are matched loosely so dumps from
+// other rfcat versions load too. The crystal is taken to be 24 MHz
+func ParseRFCat(rd io.Reader, base *registers.RegisterMap) (*DeviceConfig, error) {
+	c := &DeviceConfig{
+		Manufacturer: "Great Scott Gadgets",
+		Product:      "YARD Stick One",
+		PartNum:      0x11, // CC1111
+		Timestamp:    time.Now(),
+	}
+	if base != nil {
+		c.Registers = *base
+	} else {
+		c.Registers = *(&profiles.Profile{PreambleBytes: 4}).ToRegisters()
+	}
+	r := &c.Registers
+	xtal := GetCrystalFrequency(c.PartNum) * 1e6
+
+	var dongle, rev string
+	known := 0
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if !ok || strings.HasPrefix(key, "==") {
+			continue
+		}
+
+		var err error
+		known++
+		switch key {
+		case "dongle":
+			dongle = value
+		case "firmware rev":
+			if !strings.HasPrefix(value, "Not found") {
+				rev = value
+			}
+		case "frequency":
+			err = parseRFCatFrequency(r, value, xtal)
+		case "channel":
+			r.CHANNR, err = rfcatByte(value)
+		case "intermediate freq":
+			var hz float64
+			if hz, err = rfcatFloat(value); err == nil {
+				r.FSCTRL1 = r.FSCTRL1&0xE0 | uint8(math.Round(hz*(1<<10)/xtal))&0x1F
+			}
+		case "frequency offset":
+			var hz float64
+			if hz, err = rfcatFloat(value); err == nil {
+				r.FSCTRL0 = uint8(int8(math.Round(hz * (1 << 14) / xtal)))
+			}
+		case "modulation":
+			err = fmt.Errorf("unknown modulation")
+			name := strings.ToUpper(strings.ReplaceAll(strings.Fields(value + " ")[0], "-", ""))
+			for mod, s := range rfcatModulations {
+				if s == name {
+					registers.SetModulation(r, mod)
+					err = nil
+				}
+			}
+		case "dc filter":
+			r.MDMCFG2 = setBit(r.MDMCFG2, 0x80, !rfcatOn(value))
+		case "manchester encoding":
+			r.MDMCFG2 = setBit(r.MDMCFG2, 0x08, rfcatOn(value))
+		case "sync mode":
+			var mode int
+			if mode, err = rfcatIndex(rfcatSyncModes, value); err == nil {
+				registers.SetSyncMode(r, uint8(mode))
+			}
+		case "min tx preamble":
+			var v float64
+			if v, err = rfcatFloat(value); err == nil {
+				err = fmt.Errorf("preamble must be one of %v bytes", rfcatPreambles)
+				for i, p := range rfcatPreambles {
+					if float64(p) == v {
+						r.MDMCFG1 = r.MDMCFG1&0x8F | uint8(i)<<4
+						err = nil
+					}
+				}
+			}
+		case "chan spacing":
+			var hz float64
+			if hz, err = rfcatFloat(value); err == nil {
+				err = setChanSpacing(r, hz, xtal)
+			}
+		case "channel bw":
+			var hz float64
+			if hz, err = rfcatFloat(value); err == nil {
+				e, m := profiles.CalcChannelBWRegs(hz)
+				r.MDMCFG4 = r.MDMCFG4&0x0F | e<<6 | m<<4
+			}
+		case "data rate", "drate":
+			var baud float64
+			if baud, err = rfcatFloat(value); err == nil {
+				e, m := profiles.CalcDataRateRegs(baud)
+				r.MDMCFG4 = r.MDMCFG4&0xF0 | e
+				r.MDMCFG3 = m
+			}
+		case "deviation":
+			var hz float64
+			if hz, err = rfcatFloat(value); err == nil {
+				r.DEVIATN = profiles.CalcDeviationRegs(hz)
+			}
+		case "fec", "enable fec":
+			r.MDMCFG1 = setBit(r.MDMCFG1, 0x80, rfcatOn(value))
+		case "sync word":
+			var v uint64
+			if v, err = strconv.ParseUint(strings.Fields(value + " ")[0], 0, 16); err == nil {
+				registers.SetSyncWord(r, uint16(v))
+			}
+		case "packet length":
+			r.PKTLEN, err = rfcatByte(value)
+		case "length config":
+			var i int
+			if i, err = rfcatIndex(rfcatLengthConfigs, value); err == nil {
+				r.PKTCTRL0 = r.PKTCTRL0&0xFC | uint8(i)
+			}
+		case "configured address":
+			r.ADDR, err = rfcatByte(value)
+		case "preamble quality threshold":
+			_, pqt, _ := strings.Cut(value, "*")
+			var v uint8
+			if v, err = rfcatByte(pqt); err == nil {
+				r.PKTCTRL1 = r.PKTCTRL1&0x1F | (v&0x07)<<5
+			}
+		case "append status":
+			r.PKTCTRL1 = setBit(r.PKTCTRL1, 0x04, rfcatOn(value))
+		case "rcvd packet check":
+			var i int
+			if i, err = rfcatIndex(rfcatAddrChecks, value); err == nil {
+				r.PKTCTRL1 = r.PKTCTRL1&0xFC | uint8(i)
+			}
+		case "data whitening":
+			r.PKTCTRL0 = setBit(r.PKTCTRL0, 0x40, rfcatOn(value))
+		case "packet format":
+			var i int
+			if i, err = rfcatIndex(rfcatPktFormats, value); err == nil {
+				r.PKTCTRL0 = r.PKTCTRL0&0xCF | uint8(i)<<4
+			}
+		case "crc":
+			r.PKTCTRL0 = setBit(r.PKTCTRL0, 0x04, rfcatOn(value))
+		case "test2":
+			r.TEST2, err = rfcatByte(value)
+		case "test1":
+			r.TEST1, err = rfcatByte(value)
+		case "test0":
+			r.TEST0, err = rfcatByte(value)
+		default:
+			known--
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: rfcat dump line %d: %s %q: %w", ErrInvalid, n, key, value, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if known == 0 {
+		return nil, fmt.Errorf("%w: no rfcat radio configuration found", ErrInvalid)
+	}
+
+	if dongle != "" {
+		c.BuildType = dongle
+		if rev != "" {
+			c.BuildType += " r" + rev
+		}
+	}
+	return c, nil
+}
+
+// parseRFCatFrequency takes the FREQ word from the "(0x...)" rfcat
+// prints after the frequency when it is there, as it is exact
+func parseRFCatFrequency(r *registers.RegisterMap, value string, xtal float64) error {
+	if _, num, ok := strings.Cut(value, "("); ok {
+		if v, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(num), ")"), 0, 24); err == nil {
+			r.FREQ2, r.FREQ1, r.FREQ0 = uint8(v>>16), uint8(v>>8), uint8(v)
+			r.FSCAL2 = profiles.GetVCOSelection(registers.GetFrequency(r, xtal/1e6))
+			return nil
+		}
+	}
+	hz, err := rfcatFloat(value)
+	if err != nil {
+		return err
+	}
+	registers.SetFrequency(r, hz, xtal/1e6)
+	r.FSCAL2 = profiles.GetVCOSelection(hz)
+	return nil
+}
+
+// setChanSpacing sets CHANSPC_E and CHANSPC_M for a channel spacing
+// spacing = Fxtal / 2^18 * (256 + CHANSPC_M) * 2^CHANSPC_E
+func setChanSpacing(r *registers.RegisterMap, hz, xtal float64) error {
+	for e := 0; e < 4; e++ {
+		m := math.Round(hz*(1<<18)/(xtal*float64(int(1)<<e)) - 256)
+		if m >= 0 && m < 256 {
+			r.MDMCFG1 = r.MDMCFG1&0xFC | uint8(e)
+			r.MDMCFG0 = uint8(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("channel spacing out of range")
+}
+
+// rfcatFloat parses the number a value starts with, such as "38383.484 hz"
+func rfcatFloat(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Fields(value + " ")[0], 64)
+}
+
+// rfcatByte parses a decimal or 0x-prefixed byte
+func rfcatByte(value string) (uint8, error) {
+	v, err := strconv.ParseUint(strings.Fields(value + " ")[0], 0, 8)
+	return uint8(v), err
+}
+
+// rfcatIndex finds value among names, ignoring case
+func rfcatIndex(names []string, value string) (int, error) {
+	for i, s := range names {
+		if strings.EqualFold(s, value) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("not one of %q", names)
+}
+
+// rfcatOn reports whether an rfcat flag value means on
+func rfcatOn(value string) bool {
+	v := strings.ToLower(value)
+	return strings.HasPrefix(v, "enabled") || strings.HasPrefix(v, "on") || v == "yes" || v == "true"
+}
+
+func setBit(reg, bit uint8, on bool) uint8 {
+	if on {
+		return reg | bit
+	}
+	return reg &^ bit
+}
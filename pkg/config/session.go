@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// mcsm0AutocalMask is the FS_AUTOCAL field of MCSM0
+const mcsm0AutocalMask = 0x30
+
+// Session holds several configurations staged for one device and switches
+// between them quickly. A switch writes only the registers that differ
+// from what the radio holds, and restores the synthesizer calibration
+// from the device's CalTable instead of recalibrating when the target
+// frequency was precalibrated
+//
+// The session tracks which configuration is active; applying anything
+// else to the device, or poking a radio register, makes Active return ""
+// until the next Switch
+type Session struct {
+	device  *yardstick.Device
+	partNum uint8
+
+	mu      sync.Mutex
+	staged  map[string]*registers.RegisterMap
+	active  string
+	applied *registers.RegisterMap // What the session last recorded with SetApplied
+}
+
+// NewSession starts a session on a device with nothing staged
+func NewSession(device *yardstick.Device) (*Session, error) {
+	partNum, err := device.GetPartNum()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read part number: %w", err)
+	}
+	return &Session{device: device, partNum: partNum, staged: make(map[string]*registers.RegisterMap)}, nil
+}
+
+// Device returns the session's device
+func (s *Session) Device() *yardstick.Device {
+	return s.device
+}
+
+// Stage adds or replaces a named configuration
+func (s *Session) Stage(name string, regs *registers.RegisterMap) {
+	copied := *regs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.staged[name] = &copied
+	if name == s.active {
+		// The radio no longer holds what is staged under this name
+		s.active = ""
+	}
+}
+
+// StageProfile stages a profile under its name
+func (s *Session) StageProfile(p *profiles.Profile) {
+	s.Stage(p.Name, p.ToRegisters())
+}
+
+// StageConfig stages a saved device configuration
+func (s *Session) StageConfig(name string, c *DeviceConfig) {
+	s.Stage(name, &c.Registers)
+}
+
+// Unstage removes a configuration; the radio keeps it if it is active
+func (s *Session) Unstage(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.staged, name)
+	if name == s.active {
+		s.active = ""
+	}
+}
+
+// Names returns the staged configuration names, sorted
+func (s *Session) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.staged))
+	for name := range s.staged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Staged returns a copy of a staged configuration
+func (s *Session) Staged(name string) (*registers.RegisterMap, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	regs, ok := s.staged[name]
+	if !ok {
+		return nil, false
+	}
+	copied := *regs
+	return &copied, true
+}
+
+// Active returns the name of the configuration the radio holds, or "" if
+// none has been switched to or something else has changed the radio since
+func (s *Session) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == "" || s.device.Applied() != interface{}(s.applied) {
+		return ""
+	}
+	return s.active
+}
+
+// FrequencyHz returns the carrier frequency of a staged configuration
+func (s *Session) FrequencyHz(name string) (uint32, bool) {
+	regs, ok := s.Staged(name)
+	if !ok {
+		return 0, false
+	}
+	return s.frequencyHz(regs), true
+}
+
+func (s *Session) frequencyHz(regs *registers.RegisterMap) uint32 {
+	return uint32(registers.GetFrequency(regs, GetCrystalFrequency(s.partNum)) + 0.5)
+}
+
+// Precalibrate calibrates the synthesizer at the frequency of every staged
+// configuration and keeps the results in the device's CalTable, so later
+// switches between them skip calibration. The active configuration is
+// written again afterwards
+func (s *Session) Precalibrate() error {
+	s.mu.Lock()
+	freqs := make([]uint32, 0, len(s.staged))
+	seen := make(map[uint32]bool)
+	for _, regs := range s.staged {
+		if f := s.frequencyHz(regs); !seen[f] {
+			seen[f] = true
+			freqs = append(freqs, f)
+		}
+	}
+	active := s.active
+	s.mu.Unlock()
+	sort.Slice(freqs, func(i, j int) bool { return freqs[i] < freqs[j] })
+
+	table, err := s.device.Precalibrate(freqs)
+	if err != nil {
+		return err
+	}
+	if err := s.device.SetCalTable(table); err != nil {
+		return err
+	}
+	if active != "" {
+		if _, err := s.Switch(active); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", active, err)
+		}
+	}
+	return nil
+}
+
+// Switch makes a staged configuration active and returns how many
+// registers were written. Only registers that differ from the radio's
+// current configuration are written; when that isn't known (nothing
+// applied yet, or dropped by USB recovery or a reconnect) all of them are.
+// The radio is taken to IDLE for the write and returned to RX or TX after
+func (s *Session) Switch(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	staged, ok := s.staged[name]
+	if !ok {
+		return 0, fmt.Errorf("no configuration staged as '%s'", name)
+	}
+	target := *staged
+	if table := s.device.CalTable(); table != nil {
+		if cal, ok := table.Get(s.frequencyHz(&target)); ok {
+			// Precalibrated: load the stored result and keep autocal from
+			// overwriting it, as Retune does
+			target.FSCAL3, target.FSCAL2, target.FSCAL1 = cal.FSCAL3, cal.FSCAL2, cal.FSCAL1
+			target.MCSM0 &^= mcsm0AutocalMask
+		}
+	}
+
+	current, known := Cached(s.device)
+	if known && *current == target {
+		s.active = name
+		s.applied, _ = s.device.Applied().(*registers.RegisterMap)
+		return 0, nil
+	}
+
+	state, err := s.device.GetMARCSTATE()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MARCSTATE: %w", err)
+	}
+	if state != yardstick.MarcStateIdle {
+		if err := s.device.StrobeModeIDLE(); err != nil {
+			return 0, fmt.Errorf("failed to strobe IDLE: %w", err)
+		}
+		if err := s.device.WaitForState(yardstick.MarcStateIdle, 10*time.Millisecond); err != nil {
+			return 0, err
+		}
+	}
+
+	s.active, s.applied = "", nil
+	var written int
+	if known {
+		written, err = registers.WriteChangedRegisters(s.device, current, &target)
+	} else {
+		err = registers.WriteAllRegisters(s.device, &target)
+		written = registers.WritableRegisters
+	}
+	if err != nil {
+		return written, fmt.Errorf("failed to switch to %s: %w", name, err)
+	}
+	recordApplied(s.device, &target, s.partNum)
+	s.active, s.applied = name, &target
+
+	switch state {
+	case yardstick.MarcStateRX:
+		err = s.device.StrobeModeRX()
+	case yardstick.MarcStateTX:
+		err = s.device.StrobeModeTX()
+	}
+	if err != nil {
+		return written, fmt.Errorf("failed to restore radio state: %w", err)
+	}
+	return written, nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,15 +26,18 @@ func SaveToFile(configuration *DeviceConfig, path string) error {
 	return nil
 }
 
+// ErrInvalid is returned when a configuration file can't be read or parsed
+var ErrInvalid = errors.New("invalid configuration")
+
 func LoadFromFile(path string) (*DeviceConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("%w: failed to read file: %w", ErrInvalid, err)
 	}
 
 	var configuration DeviceConfig
 	if err := json.Unmarshal(data, &configuration); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
+		return nil, fmt.Errorf("%w: failed to unmarshal configuration: %w", ErrInvalid, err)
 	}
 
 	return &configuration, nil
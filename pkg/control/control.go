@@ -0,0 +1,230 @@
+// Package control provides a local control socket for long-running tools,
+// so settings can be changed and actions triggered at runtime without a
+// restart that would lose in-memory state
+//
+// Protocol (one JSON object per line over a Unix socket):
+//
+//	client -> {"cmd":"status","args":{...}}
+//	server -> {"ok":true,"result":{...}}
+//	server -> {"ok":false,"error":"message"}
+//
+// A connection may send any number of requests. The "help" command lists
+// the commands the server handles.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a client call
+const DefaultTimeout = 5 * time.Second
+
+// Request is one control command
+type Request struct {
+	Cmd  string          `json:"cmd"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// Response is the reply to one Request
+type Response struct {
+	OK     bool            `json:"ok"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// HandlerFunc runs a command; args is nil when the client sent none
+// The result is JSON-encoded into the response
+type HandlerFunc func(args json.RawMessage) (interface{}, error)
+
+type handler struct {
+	summary string
+	fn      HandlerFunc
+}
+
+// Server dispatches control commands from a Unix socket
+type Server struct {
+	mu       sync.Mutex
+	handlers map[string]handler
+	ln       net.Listener
+	path     string
+	conns    map[net.Conn]struct{} // Open client connections, closed by Close
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a server with only the built-in "help" command
+func NewServer() *Server {
+	s := &Server{handlers: make(map[string]handler), conns: make(map[net.Conn]struct{})}
+	s.Handle("help", "List available commands", func(json.RawMessage) (interface{}, error) {
+		return s.Commands(), nil
+	})
+	return s
+}
+
+// Handle registers a command
+func (s *Server) Handle(cmd, summary string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[cmd] = handler{summary: summary, fn: fn}
+}
+
+// Commands returns command names and summaries
+func (s *Server) Commands() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.handlers))
+	for name, h := range s.handlers {
+		out[name] = h.summary
+	}
+	return out
+}
+
+// Listen starts accepting connections on a Unix socket path
+// A stale socket left by a crashed process is removed first
+func (s *Server) Listen(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use", path)
+	}
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	os.Chmod(path, 0600)
+
+	s.mu.Lock()
+	s.ln = ln
+	s.path = path
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(ln)
+	return nil
+}
+
+// Close stops accepting connections, closes those that are open and
+// removes the socket
+func (s *Server) Close() error {
+	s.mu.Lock()
+	ln := s.ln
+	s.ln = nil
+	s.mu.Unlock()
+
+	if ln == nil {
+		return nil
+	}
+	err := ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) acceptLoop(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.ln == nil {
+			// Accepted as Close ran
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			enc.Encode(&Response{Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+		enc.Encode(s.dispatch(&req))
+	}
+}
+
+func (s *Server) dispatch(req *Request) *Response {
+	s.mu.Lock()
+	h, ok := s.handlers[req.Cmd]
+	s.mu.Unlock()
+	if !ok {
+		return &Response{Error: fmt.Sprintf("unknown command '%s'", req.Cmd)}
+	}
+
+	result, err := h.fn(req.Args)
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	if result == nil {
+		return &Response{OK: true}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return &Response{Error: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	return &Response{OK: true, Result: data}
+}
+
+// Call sends one command to a control socket and returns its result
+// args may be nil, a json.RawMessage, or any JSON-encodable value
+func Call(path, cmd string, args interface{}) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", path, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(DefaultTimeout))
+
+	req := Request{Cmd: cmd}
+	if args != nil {
+		if raw, ok := args.(json.RawMessage); ok {
+			req.Args = raw
+		} else if req.Args, err = json.Marshal(args); err != nil {
+			return nil, fmt.Errorf("failed to encode args: %w", err)
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(&req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.OK {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Result, nil
+}
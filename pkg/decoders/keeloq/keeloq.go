@@ -0,0 +1,232 @@
+// Package keeloq recognizes KeeLoq rolling-code transmissions, sent by
+// the Microchip HCS200/300/301 encoders and their clones in car, gate and
+// garage remotes, and splits each code word into its fixed and encrypted
+// parts
+//
+// A transmission is a preamble of 12 pulses at 50% duty cycle, a header
+// gap of 10 units, then 66 PWM bits of 3 units each, in units of TE
+// (typically 400 us):
+//   - bit 1: 1 unit of carrier, 2 off
+//   - bit 0: 2 units of carrier, 1 off
+//
+// The code word is sent LSB first:
+//
+//	bits  0-31  hopping code, encrypted: buttons, discrimination value and a 16-bit counter
+//	bits 32-59  serial number
+//	bits 60-63  button status
+//	bit  64     battery low
+//	bit  65     repeat, set while the button is held
+//
+// Decrypting the hopping code needs the manufacturer key, so the counter
+// is not read here. Each button press sends a new hopping code, which is
+// what Tracker follows to tell presses, repeats and replays apart.
+package keeloq
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Code word layout, in bits and TE units
+const (
+	CodeBits       = 66
+	EncryptedBits  = 32
+	SerialBits     = 28
+	ButtonBits     = 4
+	PreamblePulses = 12
+	HeaderUnits    = 10
+	BitUnits       = 3
+	GuardUnits     = 39 // Silence after the code word before the next one
+)
+
+// DefaultTEUs is the nominal unit of an HCS301
+const DefaultTEUs = 400
+
+// ErrNotKeeLoq is returned when a frame isn't a KeeLoq code word
+var ErrNotKeeLoq = errors.New("not a KeeLoq code word")
+
+// Frame is one KeeLoq code word
+type Frame struct {
+	Bits       demod.Bits `json:"bits"`      // In the order sent
+	Encrypted  uint32     `json:"encrypted"` // Hopping code
+	Serial     uint32     `json:"serial"`
+	Buttons    uint8      `json:"buttons"`
+	BatteryLow bool       `json:"battery_low"`
+	Repeat     bool       `json:"repeat"`
+	Preamble   bool       `json:"preamble"` // The preamble was seen before the code word
+	TEUs       int        `json:"te_us"`
+}
+
+// Fixed returns the 34 unencrypted bits: serial number, buttons, battery
+// low and repeat, in transmission order from bit 0
+func (f *Frame) Fixed() uint64 {
+	return field(f.Bits, EncryptedBits, CodeBits-EncryptedBits)
+}
+
+// String describes the code word
+func (f *Frame) String() string {
+	s := fmt.Sprintf("KeeLoq serial 0x%07X buttons 0x%X hopping code 0x%08X", f.Serial, f.Buttons, f.Encrypted)
+	if f.BatteryLow {
+		s += ", battery low"
+	}
+	if f.Repeat {
+		s += ", repeat"
+	}
+	return s
+}
+
+// Decode reads a code word from a PWM frame decoded by pkg/demod. demod
+// reads the long pulse as 1, so its bits are the inverse of KeeLoq's
+func Decode(f *demod.Frame) (*Frame, error) {
+	if f.Encoding != demod.PWM || f.Errors > 0 || f.ShortUs <= 0 {
+		return nil, ErrNotKeeLoq
+	}
+	if len(f.Bits) != CodeBits {
+		return nil, fmt.Errorf("%w: %d bits", ErrNotKeeLoq, len(f.Bits))
+	}
+	if ratio := float64(f.LongUs) / float64(f.ShortUs); ratio < 1.5 || ratio > 2.8 {
+		return nil, fmt.Errorf("%w: long/short pulse ratio %.1f", ErrNotKeeLoq, ratio)
+	}
+	te := int(math.Round(float64(f.ShortUs+f.LongUs) / BitUnits))
+	if f.PeriodUs > 0 {
+		te = int(math.Round(float64(f.PeriodUs) / BitUnits))
+	}
+
+	bits := make(demod.Bits, CodeBits)
+	for i, b := range f.Bits {
+		bits[i] = 1 - b
+	}
+	return newFrame(bits, te), nil
+}
+
+// DecodeFrames decodes the code words among consecutive frames of a
+// burst, marking those that follow a preamble
+func DecodeFrames(frames []*demod.Frame) []*Frame {
+	var out []*Frame
+	for i, f := range frames {
+		k, err := Decode(f)
+		if err != nil {
+			continue
+		}
+		k.Preamble = i > 0 && isPreamble(frames[i-1].Pulses, k.TEUs)
+		out = append(out, k)
+	}
+	return out
+}
+
+// DecodePulses decodes the code words in a pulse train in the
+// pkg/capture convention
+func DecodePulses(pulses []int) []*Frame {
+	var frames []*demod.Frame
+	for _, seg := range demod.Split(pulses) {
+		f, err := demod.Decode(seg)
+		if err != nil {
+			f = &demod.Frame{Encoding: demod.Unknown, Pulses: seg}
+		}
+		frames = append(frames, f)
+	}
+	return DecodeFrames(frames)
+}
+
+// Demodulate decodes every code word in a raw OOK bitstream sampled at
+// sampleRate, as received on a no-sync OOK profile
+func Demodulate(data []byte, sampleRate float64) []*Frame {
+	return DecodeFrames(demod.Demodulate(data, sampleRate))
+}
+
+// New returns the code word for its fields, e.g. to build test signals
+// teUs 0 means DefaultTEUs
+func New(encrypted, serial uint32, buttons uint8, batteryLow, repeat bool, teUs int) (*Frame, error) {
+	if serial >= 1<<SerialBits || buttons >= 1<<ButtonBits {
+		return nil, fmt.Errorf("KeeLoq serial 0x%X or buttons 0x%X out of range (28 and 4 bits)", serial, buttons)
+	}
+	if teUs <= 0 {
+		teUs = DefaultTEUs
+	}
+	bits := make(demod.Bits, 0, CodeBits)
+	put := func(v uint64, n int) {
+		for i := 0; i < n; i++ {
+			bits = append(bits, uint8(v>>uint(i)&1))
+		}
+	}
+	put(uint64(encrypted), EncryptedBits)
+	put(uint64(serial), SerialBits)
+	put(uint64(buttons), ButtonBits)
+	put(uint64(boolBit(batteryLow)), 1)
+	put(uint64(boolBit(repeat)), 1)
+	f := newFrame(bits, teUs)
+	f.Preamble = true
+	return f, nil
+}
+
+// Pulses returns the transmission as signed pulse durations in
+// microseconds: preamble, header, code word and guard time
+func (f *Frame) Pulses() []int {
+	te := f.TEUs
+	if te <= 0 {
+		te = DefaultTEUs
+	}
+	var out []int
+	for i := 0; i < PreamblePulses; i++ {
+		out = append(out, te, -te)
+	}
+	out[len(out)-1] = -HeaderUnits * te
+	for _, b := range f.Bits {
+		if b == 1 {
+			out = append(out, te, -2*te)
+		} else {
+			out = append(out, 2*te, -te)
+		}
+	}
+	out[len(out)-1] -= GuardUnits * te
+	return out
+}
+
+// newFrame fills in the fields derived from 66 bits
+func newFrame(bits demod.Bits, te int) *Frame {
+	return &Frame{
+		Bits:       bits,
+		Encrypted:  uint32(field(bits, 0, EncryptedBits)),
+		Serial:     uint32(field(bits, EncryptedBits, SerialBits)),
+		Buttons:    uint8(field(bits, EncryptedBits+SerialBits, ButtonBits)),
+		BatteryLow: bits[CodeBits-2] == 1,
+		Repeat:     bits[CodeBits-1] == 1,
+		TEUs:       te,
+	}
+}
+
+// isPreamble reports whether pulses are a run of alternating pulses and
+// gaps of one unit
+func isPreamble(pulses []int, te int) bool {
+	if len(pulses) < PreamblePulses || te <= 0 {
+		return false
+	}
+	for _, p := range pulses {
+		if p < 0 {
+			p = -p
+		}
+		if r := float64(p) / float64(te); r < 0.6 || r > 1.5 {
+			return false
+		}
+	}
+	return true
+}
+
+// field reads n bits starting at pos, LSB first
+func field(bits demod.Bits, pos, n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v |= uint64(bits[pos+i]) << uint(i)
+	}
+	return v
+}
+
+func boolBit(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package keeloq
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is how a code word relates to what its transmitter sent before
+type Status string
+
+// Statuses
+const (
+	StatusFirst  Status = "first"  // The first code word from this serial number
+	StatusNew    Status = "new"    // A hopping code not seen before: a new button press
+	StatusRepeat Status = "repeat" // The latest hopping code again within the repeat window: the button held
+	StatusReplay Status = "replay" // A hopping code seen before, after a newer one or outside the repeat window
+)
+
+// DefaultRepeatWindow is how long after a code word the same hopping
+// code still counts as part of the same press
+const DefaultRepeatWindow = 2 * time.Second
+
+// Transmitter is what has been seen from one serial number
+type Transmitter struct {
+	Serial     uint32    `json:"serial"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Frames     int       `json:"frames"`
+	Presses    int       `json:"presses"` // Distinct hopping codes
+	Repeats    int       `json:"repeats"`
+	Replays    int       `json:"replays"`
+	LastCode   uint32    `json:"last_hopping_code"`
+	BatteryLow bool      `json:"battery_low"`
+
+	seen map[uint32]bool
+}
+
+// Tracker follows hopping codes per serial number across any number of
+// captures, fed in time order
+type Tracker struct {
+	RepeatWindow time.Duration
+
+	mu           sync.Mutex
+	transmitters map[uint32]*Transmitter
+	order        []uint32
+}
+
+// NewTracker creates a Tracker with DefaultRepeatWindow
+func NewTracker() *Tracker {
+	return &Tracker{RepeatWindow: DefaultRepeatWindow, transmitters: make(map[uint32]*Transmitter)}
+}
+
+// Observe records a code word received at a time and returns its status
+// Captures without timestamps (zero times) count every resend of the
+// latest code as a repeat
+func (t *Tracker) Observe(f *Frame, at time.Time) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.transmitters[f.Serial]
+	if !ok {
+		tx = &Transmitter{Serial: f.Serial, FirstSeen: at, seen: make(map[uint32]bool)}
+		t.transmitters[f.Serial] = tx
+		t.order = append(t.order, f.Serial)
+	}
+
+	var status Status
+	switch {
+	case !ok:
+		status = StatusFirst
+		tx.Presses++
+	case f.Encrypted == tx.LastCode && at.Sub(tx.LastSeen) <= t.RepeatWindow:
+		status = StatusRepeat
+		tx.Repeats++
+	case tx.seen[f.Encrypted]:
+		status = StatusReplay
+		tx.Replays++
+	default:
+		status = StatusNew
+		tx.Presses++
+	}
+
+	tx.seen[f.Encrypted] = true
+	tx.Frames++
+	tx.LastCode = f.Encrypted
+	tx.LastSeen = at
+	tx.BatteryLow = f.BatteryLow
+	return status
+}
+
+// Transmitters returns what has been seen from each serial number, in
+// the order they first appeared
+func (t *Tracker) Transmitters() []*Transmitter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]*Transmitter, len(t.order))
+	for i, serial := range t.order {
+		tx := *t.transmitters[serial]
+		tx.seen = nil
+		out[i] = &tx
+	}
+	return out
+}
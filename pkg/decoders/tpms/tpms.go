@@ -0,0 +1,252 @@
+// Package tpms decodes tyre pressure monitoring sensor frames from raw
+// FSK bitstreams received with RFRecv
+//
+// The supported sensors send Manchester coded frames at 19.2 kchip/s
+// (9.6 kbit/s) after a preamble of alternating chips ending in 0110, so
+// the last 16 chips before the data read 0x5556. Manchester follows IEEE
+// 802.3 (01 is a 1 bit, 10 a 0 bit), the opposite of the CC1111 packet
+// engine, so receive with Manchester off and let the decoder find the
+// frame. Depending on which side of the carrier the sensor puts a 1, the
+// chips may arrive inverted; both polarities are tried.
+//
+// Frame layouts, as published by the rtl_433 project:
+//   - Citroen (also Peugeot, Fiat, VDO): 10 bytes of state, 32-bit ID,
+//     flags and repeat counter, pressure, temperature, battery, and an
+//     XOR checksum over bytes 1-9
+//   - Ford: 8 bytes of 32-bit ID, pressure, temperature, flags, and a
+//     sum of bytes 0-6
+//   - Schrader: 8 bytes of flags, 24-bit ID, pressure, temperature, and
+//     a CRC-8 (polynomial 0x07, initial value 0xF0) over bytes 0-6
+package tpms
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Protocol is a sensor family
+type Protocol string
+
+// Protocols
+const (
+	Citroen  Protocol = "citroen"
+	Ford     Protocol = "ford"
+	Schrader Protocol = "schrader"
+)
+
+// Protocols lists the supported protocols in the order they are tried
+var Protocols = []Protocol{Citroen, Ford, Schrader}
+
+// Over-the-air parameters shared by the supported sensors
+const (
+	ChipRate    = 19200 // Manchester chips per second, the data rate to receive at
+	DeviationHz = 38000
+	SyncWord    = 0x5556 // Last 16 chips of the preamble
+)
+
+// kPaPerPSI converts pressures
+const kPaPerPSI = 6.894757
+
+// maxFrameBits is the longest frame, Citroen's
+const maxFrameBits = 80
+
+// Reading is one decoded sensor frame
+type Reading struct {
+	Protocol     Protocol `json:"protocol"`
+	ID           uint32   `json:"id"`
+	PressureKPa  float64  `json:"pressure_kpa"`
+	TemperatureC float64  `json:"temperature_c"`
+	Flags        uint8    `json:"flags"`
+	Repeat       uint8    `json:"repeat,omitempty"`  // Citroen: which copy of the frame
+	Battery      uint8    `json:"battery,omitempty"` // Citroen: raw battery field
+	Raw          string   `json:"raw"`               // Decoded frame bytes, hex
+}
+
+// PressurePSI returns the pressure in PSI
+func (r *Reading) PressurePSI() float64 {
+	return r.PressureKPa / kPaPerPSI
+}
+
+// IDString formats the ID with as many hex digits as the protocol sends
+func (r *Reading) IDString() string {
+	if r.Protocol == Schrader {
+		return fmt.Sprintf("%06X", r.ID)
+	}
+	return fmt.Sprintf("%08X", r.ID)
+}
+
+// String describes the reading on one line
+func (r *Reading) String() string {
+	return fmt.Sprintf("%s %s: %.1f kPa (%.1f PSI), %.0f C, flags 0x%02X",
+		r.Protocol, r.IDString(), r.PressureKPa, r.PressurePSI(), r.TemperatureC, r.Flags)
+}
+
+// parser reads one protocol's frame from Manchester decoded bytes
+type parser struct {
+	protocol Protocol
+	bits     int
+	parse    func(b []byte) *Reading // nil if the frame doesn't check out
+}
+
+var parsers = map[Protocol]*parser{
+	Citroen:  {Citroen, 80, parseCitroen},
+	Ford:     {Ford, 64, parseFord},
+	Schrader: {Schrader, 64, parseSchrader},
+}
+
+// Decode finds every frame of any supported protocol in a raw bitstream
+func Decode(data []byte) []*Reading {
+	return DecodeProtocols(data, Protocols)
+}
+
+// DecodePacket decodes a packet received with the sync word set to sync,
+// which the radio strips: it is put back so the frame can be found
+func DecodePacket(data []byte, sync uint16) []*Reading {
+	return Decode(append([]byte{byte(sync >> 8), byte(sync)}, data...))
+}
+
+// DecodeProtocols finds frames of the given protocols in a raw bitstream.
+// At each position where the sync chips appear, in either polarity, the
+// protocols are tried in order and the first whose frame checks out wins
+func DecodeProtocols(data []byte, protocols []Protocol) []*Reading {
+	var readings []*Reading
+	nbits := len(data) * 8
+	for pos := 0; pos+16 <= nbits; pos++ {
+		chips := uint16(chipsAt(data, pos, 16))
+		var invert bool
+		switch chips {
+		case SyncWord:
+		case ^uint16(SyncWord):
+			invert = true
+		default:
+			continue
+		}
+		frame, n := manchester(data, pos+16, maxFrameBits, invert)
+		for _, p := range protocols {
+			ps := parsers[p]
+			if ps == nil || n < ps.bits {
+				continue
+			}
+			if r := ps.parse(frame[:ps.bits/8]); r != nil {
+				r.Raw = hex.EncodeToString(frame[:ps.bits/8])
+				readings = append(readings, r)
+				pos += 16 + 2*ps.bits - 1
+				break
+			}
+		}
+	}
+	return readings
+}
+
+// chipsAt reads n bits starting at bit pos, MSB first
+func chipsAt(data []byte, pos, n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | uint32(bitAt(data, pos+i))
+	}
+	return v
+}
+
+func bitAt(data []byte, pos int) uint8 {
+	return data[pos/8] >> (7 - uint(pos%8)) & 1
+}
+
+// manchester decodes up to max bits from the chips at bit pos, stopping at
+// the first invalid chip pair or the end of data. It returns the bits
+// packed MSB first and how many were decoded
+func manchester(data []byte, pos, max int, invert bool) ([]byte, int) {
+	out := make([]byte, (max+7)/8)
+	n := 0
+	for ; n < max && pos+1 < len(data)*8; n, pos = n+1, pos+2 {
+		a, b := bitAt(data, pos), bitAt(data, pos+1)
+		if a == b {
+			break
+		}
+		// IEEE 802.3: 01 is a 1
+		bit := b
+		if invert {
+			bit ^= 1
+		}
+		out[n/8] |= bit << (7 - uint(n%8))
+	}
+	return out, n
+}
+
+// parseCitroen reads UU IIIIIIII FR PP TT BB CC: state, ID, flags and
+// repeat counter, pressure in 1.364 kPa steps, temperature offset by 50 C,
+// battery, and a checksum making the XOR of bytes 1-9 zero
+func parseCitroen(b []byte) *Reading {
+	var x byte
+	for _, v := range b[1:10] {
+		x ^= v
+	}
+	if x != 0 || b[6] == 0 || b[7] == 0 {
+		return nil
+	}
+	return &Reading{
+		Protocol:     Citroen,
+		ID:           be32(b[1:5]),
+		Flags:        b[5] >> 4,
+		Repeat:       b[5] & 0x0F,
+		PressureKPa:  float64(b[6]) * 1.364,
+		TemperatureC: float64(b[7]) - 50,
+		Battery:      b[8],
+	}
+}
+
+// parseFord reads IIIIIIII PP TT FF CC: ID, pressure in quarter PSI with
+// a ninth bit in the flags, temperature offset by 56 C, flags, and the
+// sum of bytes 0-6
+func parseFord(b []byte) *Reading {
+	var sum byte
+	for _, v := range b[:7] {
+		sum += v
+	}
+	if sum != b[7] {
+		return nil
+	}
+	psi := float64(uint16(b[6]&0x20)<<3|uint16(b[4])) * 0.25
+	return &Reading{
+		Protocol:     Ford,
+		ID:           be32(b[0:4]),
+		PressureKPa:  psi * kPaPerPSI,
+		TemperatureC: float64(b[5]) - 56,
+		Flags:        b[6],
+	}
+}
+
+// parseSchrader reads FF FI IIII Ix PP TT CC: flags, 24-bit ID,
+// pressure in 2.5 kPa steps, temperature offset by 50 C, and the CRC-8.
+// Flags holds the first byte
+func parseSchrader(b []byte) *Reading {
+	if crc8(b[:7], 0x07, 0xF0) != b[7] {
+		return nil
+	}
+	return &Reading{
+		Protocol:     Schrader,
+		ID:           uint32(b[1]&0x0F)<<20 | uint32(b[2])<<12 | uint32(b[3])<<4 | uint32(b[4]>>4),
+		PressureKPa:  float64(b[5]) * 2.5,
+		TemperatureC: float64(b[6]) - 50,
+		Flags:        b[0],
+	}
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// crc8 is a plain MSB-first CRC-8
+func crc8(data []byte, poly, init byte) byte {
+	crc := init
+	for _, v := range data {
+		crc ^= v
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
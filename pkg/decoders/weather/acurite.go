@@ -0,0 +1,82 @@
+package weather
+
+import (
+	"encoding/hex"
+	"math/bits"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// The Acurite 592TXR tower sensor sends 56 PWM bits (220 and 400 us
+// pulses) after four 600 us sync pulses, three times back to back
+//
+//	CCII IIII  IIII IIII  PB00 0100  PHHH HHHH  PTTT TTTT  PTTT TTTT  SSSS SSSS
+//
+// C is the channel (3 = A, 2 = B, 0 = C), I the ID, B the battery (1 =
+// good), 000100 the message type, H the humidity, T the temperature in
+// tenths of a degree C plus 1000, and S the sum of the first six bytes.
+// P makes each of bytes 2-5 even parity
+const (
+	acuriteBits   = 56
+	acuriteSyncUs = 500 // Pulses this long are sync, not data
+	acuriteTypeTH = 0x04
+)
+
+// decodeAcurite decodes the copies in a frame
+func decodeAcurite(pulses []int) []*Reading {
+	var out []*Reading
+	for _, seg := range segments(pulses, func(p int) bool { return p >= acuriteSyncUs }) {
+		// The gap after the last sync pulse leads the segment
+		for len(seg) > 0 && seg[0] < 0 {
+			seg = seg[1:]
+		}
+		f, err := demod.Decode(seg)
+		if err != nil || f.Encoding != demod.PWM || len(f.Bits) < acuriteBits {
+			continue
+		}
+		// Which width is a 1 depends on the sensor's convention, not the
+		// demodulator's; the checksum tells
+		for _, b := range []demod.Bits{f.Bits[:acuriteBits], invert(f.Bits[:acuriteBits])} {
+			if r := parseAcurite(b.Bytes()); r != nil {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func parseAcurite(b []byte) *Reading {
+	var sum byte
+	for _, v := range b[:6] {
+		sum += v
+	}
+	if sum != b[6] || b[2]&0x3F != acuriteTypeTH {
+		return nil
+	}
+	for _, v := range b[2:6] {
+		if bits.OnesCount8(v)%2 != 0 {
+			return nil
+		}
+	}
+	channel := "?"
+	switch b[0] >> 6 {
+	case 3:
+		channel = "A"
+	case 2:
+		channel = "B"
+	case 0:
+		channel = "C"
+	}
+	temp := int(b[4]&0x7F)<<7 | int(b[5]&0x7F)
+	return &Reading{
+		Protocol:     Acurite,
+		Model:        "592TXR",
+		ID:           uint16(b[0]&0x3F)<<8 | uint16(b[1]),
+		Channel:      channel,
+		TemperatureC: float64(temp-1000) / 10,
+		Humidity:     int(b[3] & 0x7F),
+		BatteryLow:   b[2]&0x40 == 0,
+		Raw:          hex.EncodeToString(b),
+	}
+}
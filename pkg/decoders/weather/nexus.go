@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Nexus sensors send 36 bits by pulse position: a 500 us pulse followed
+// by a 1000 us gap for 0 or 2000 us for 1, repeated about ten times with
+// 4 ms between copies
+//
+//	IIIIIIII B0CC TTTTTTTTTTTT 1111 HHHHHHHH
+//
+// I is the ID, B the battery (1 = good), C the channel less one, T the
+// temperature in tenths of a degree C (signed), H the humidity; sensors
+// without a hygrometer send 0. There is no checksum
+const (
+	nexusBits  = 36
+	nexusGapUs = 3000 // Gaps this long separate copies
+)
+
+// nexusCandidates returns the 36-bit PPM copies in a frame
+func nexusCandidates(pulses []int) []demod.Bits {
+	var out []demod.Bits
+	for _, seg := range segments(pulses, func(p int) bool { return p <= -nexusGapUs }) {
+		f, err := demod.Decode(seg)
+		if err != nil || f.Encoding != demod.PPM || f.Errors > 0 || len(f.Bits) != nexusBits {
+			continue
+		}
+		out = append(out, f.Bits)
+	}
+	return out
+}
+
+func parseNexus(bits demod.Bits) *Reading {
+	if len(bits) != nexusBits || field(bits, 24, 4) != 0xF || bits[9] != 0 {
+		return nil
+	}
+	temp := field(bits, 12, 12)
+	if temp >= 1<<11 {
+		temp -= 1 << 12
+	}
+	humidity := field(bits, 28, 8)
+	channel := field(bits, 10, 2)
+	if humidity > 100 || channel > 2 || temp < -500 || temp > 700 {
+		return nil
+	}
+	return &Reading{
+		Protocol:     Nexus,
+		Model:        "Nexus-TH",
+		ID:           uint16(field(bits, 0, 8)),
+		Channel:      strconv.Itoa(channel + 1),
+		TemperatureC: float64(temp) / 10,
+		Humidity:     humidity,
+		BatteryLow:   bits[8] == 0,
+		Raw:          hex.EncodeToString(bits.Bytes()),
+	}
+}
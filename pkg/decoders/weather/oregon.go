@@ -0,0 +1,164 @@
+package weather
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Oregon Scientific sensors send Manchester coded messages of 4-bit
+// nibbles, each least significant bit first, after a preamble of 1s and
+// the sync nibble 0xA. Version 2.1 sends every bit twice, inverted and
+// then as is, at 1024 bit/s; version 3 sends each bit once at 1024 bit/s
+//
+// Nibbles after the sync:
+//   - 0-3: sensor type, e.g. 1D20 for the THGR122N
+//   - 4: channel (v2.1: 1, 2 or 4 for channels 1-3)
+//   - 5-6: rolling code
+//   - 7: flags, 0x4 is a low battery
+//   - 8-10: temperature in BCD, tenths first
+//   - 11: sign, non-zero when below zero
+//   - 12-13: humidity in BCD, units first (hygrometer models)
+//
+// The message ends with the 8-bit sum of the nibbles before it
+type oregonModel struct {
+	name     string
+	humidity bool
+}
+
+var oregonModels = map[int]oregonModel{
+	0x1D20: {"THGR122N", true},
+	0x1A2D: {"THGR228N", true},
+	0xEC40: {"THN132N", false},
+	0xF824: {"THGR810", true},
+}
+
+// oregonPreamble is the fewest 1 bits accepted before the sync nibble
+const oregonPreamble = 8
+
+// decodeOregon decodes a Manchester frame holding an Oregon message
+func decodeOregon(pulses []int) *Reading {
+	f, err := demod.Decode(pulses)
+	if err != nil || f.Encoding != demod.Manchester {
+		return nil
+	}
+	// The demodulator's polarity and, for v2.1, which copy of each bit is
+	// the plain one aren't known, so every reading of the bits is tried
+	odd, even := make(demod.Bits, 0, len(f.Bits)/2), make(demod.Bits, 0, len(f.Bits)/2)
+	for i, b := range f.Bits {
+		if i%2 == 1 {
+			odd = append(odd, b)
+		} else {
+			even = append(even, b)
+		}
+	}
+	for _, c := range []struct {
+		version Protocol
+		bits    demod.Bits
+	}{
+		{OregonV3, f.Bits}, {OregonV3, invert(f.Bits)},
+		{OregonV2, odd}, {OregonV2, invert(odd)},
+		{OregonV2, even}, {OregonV2, invert(even)},
+	} {
+		if r := parseOregon(c.version, c.bits); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// parseOregon finds the sync nibble and reads the message after it
+func parseOregon(version Protocol, bits demod.Bits) *Reading {
+	ones := 0
+	for i := 0; i+4 <= len(bits); i++ {
+		if bits[i] == 1 {
+			ones++
+			continue
+		}
+		if ones >= oregonPreamble && bits[i+1] == 1 && bits[i+2] == 0 && bits[i+3] == 1 {
+			if r := parseOregonMessage(version, oregonNibbles(bits[i+4:])); r != nil {
+				return r
+			}
+		}
+		ones = 0
+	}
+	return nil
+}
+
+// oregonNibbles packs bits into nibbles, least significant bit first
+func oregonNibbles(bits demod.Bits) []int {
+	n := make([]int, len(bits)/4)
+	for i := range n {
+		for j := 0; j < 4; j++ {
+			n[i] |= int(bits[i*4+j]) << uint(j)
+		}
+	}
+	return n
+}
+
+func parseOregonMessage(version Protocol, n []int) *Reading {
+	if len(n) < 4 {
+		return nil
+	}
+	sensor := n[0]<<12 | n[1]<<8 | n[2]<<4 | n[3]
+	model, ok := oregonModels[sensor]
+	if !ok {
+		return nil
+	}
+	length := 12 // Nibbles covered by the checksum
+	if model.humidity {
+		length = 15
+	}
+	if len(n) < length+2 {
+		return nil
+	}
+	sum := 0
+	for _, v := range n[:length] {
+		sum += v
+	}
+	if sum&0xFF != n[length]|n[length+1]<<4 {
+		return nil
+	}
+	for _, v := range n[8:11] {
+		if v > 9 {
+			return nil
+		}
+	}
+
+	r := &Reading{
+		Protocol:     version,
+		Model:        model.name,
+		ID:           uint16(n[5]<<4 | n[6]),
+		Channel:      oregonChannel(version, n[4]),
+		TemperatureC: float64(n[10]*10+n[9]) + float64(n[8])/10,
+		BatteryLow:   n[7]&0x4 != 0,
+	}
+	if n[11] != 0 {
+		r.TemperatureC = -r.TemperatureC
+	}
+	if model.humidity {
+		r.Humidity = n[13]*10 + n[12]
+	}
+	packed := make([]byte, (length+2+1)/2)
+	for i, v := range n[:length+2] {
+		packed[i/2] |= byte(v) << uint(4*(1-i%2))
+	}
+	r.Raw = hex.EncodeToString(packed)
+	return r
+}
+
+// oregonChannel maps the channel nibble to the switch setting
+func oregonChannel(version Protocol, v int) string {
+	if version == OregonV2 {
+		switch v {
+		case 1:
+			return "1"
+		case 2:
+			return "2"
+		case 4:
+			return "3"
+		}
+	}
+	return strconv.Itoa(v)
+}
@@ -0,0 +1,236 @@
+// Package weather decodes the common 433 MHz OOK weather sensors from
+// demodulated pulse trains: Oregon Scientific v2.1 and v3, Nexus (and the
+// many rebadged Nexus-protocol sensors) and the Acurite 592TXR tower
+//
+// Input is pulses in the pkg/capture convention, signed microseconds,
+// either from a capture or from raw no-sync OOK blocks sampled at a known
+// rate (see Demodulate and Receiver). Sensors send each reading several
+// times in a burst; a burst is decoded as a whole, so protocols without
+// a checksum can require a repeat, and each distinct reading is returned
+// once.
+package weather
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Protocol is a sensor protocol
+type Protocol string
+
+// Protocols
+const (
+	OregonV2 Protocol = "oregon-v2.1"
+	OregonV3 Protocol = "oregon-v3"
+	Nexus    Protocol = "nexus"
+	Acurite  Protocol = "acurite"
+)
+
+// Protocols lists the supported protocols
+var Protocols = []Protocol{OregonV2, OregonV3, Nexus, Acurite}
+
+// DefaultSampleRate is a receive rate, in baud, that resolves the
+// narrowest pulses of every supported sensor in a few samples
+const DefaultSampleRate = 16000
+
+// Reading is one decoded sensor report
+type Reading struct {
+	Protocol     Protocol `json:"protocol"`
+	Model        string   `json:"model"`
+	ID           uint16   `json:"id"` // Rolling code or house code; most sensors pick a new one on a battery change
+	Channel      string   `json:"channel,omitempty"`
+	TemperatureC float64  `json:"temperature_c"`
+	Humidity     int      `json:"humidity_pct,omitempty"` // 0 when the sensor has no hygrometer
+	BatteryLow   bool     `json:"battery_low"`
+	Raw          string   `json:"raw"` // The decoded message, hex
+}
+
+// TemperatureF returns the temperature in degrees Fahrenheit
+func (r *Reading) TemperatureF() float64 {
+	return r.TemperatureC*9/5 + 32
+}
+
+// String describes the reading on one line
+func (r *Reading) String() string {
+	s := fmt.Sprintf("%s %s", r.Protocol, r.Model)
+	if r.Channel != "" {
+		s += " channel " + r.Channel
+	}
+	s += fmt.Sprintf(" id 0x%X: %.1f C", r.ID, r.TemperatureC)
+	if r.Humidity > 0 {
+		s += fmt.Sprintf(", %d%%", r.Humidity)
+	}
+	if r.BatteryLow {
+		s += ", battery low"
+	}
+	return s
+}
+
+// Key identifies the sensor a reading came from
+func (r *Reading) Key() string {
+	return string(r.Protocol) + "/" + r.Model + "/" + r.Channel + "/" + hex.EncodeToString([]byte{byte(r.ID >> 8), byte(r.ID)})
+}
+
+// DecodeFrames decodes one burst, given as pulse frames such as those
+// returned by demod.Split
+func DecodeFrames(frames [][]int) []*Reading {
+	var readings []*Reading
+	seen := make(map[string]bool)
+	add := func(rs ...*Reading) {
+		for _, r := range rs {
+			if key := string(r.Protocol) + r.Raw; !seen[key] {
+				seen[key] = true
+				readings = append(readings, r)
+			}
+		}
+	}
+
+	nexus := make(map[string]int)
+	for _, pulses := range frames {
+		if r := decodeOregon(pulses); r != nil {
+			add(r)
+		}
+		add(decodeAcurite(pulses)...)
+		for _, bits := range nexusCandidates(pulses) {
+			nexus[bits.String()]++
+		}
+	}
+	// Nexus frames carry no checksum: a reading must be heard twice
+	for s, n := range nexus {
+		if n < 2 {
+			continue
+		}
+		if r := parseNexus(parseBits(s)); r != nil {
+			add(r)
+		}
+	}
+	return readings
+}
+
+// Demodulate decodes a raw OOK bitstream sampled at sampleRate baud,
+// one burst at a time
+func Demodulate(data []byte, sampleRate float64) []*Reading {
+	return DecodePulses(demod.Pulses(data, sampleRate))
+}
+
+// DecodePulses decodes a pulse train, one burst at a time
+func DecodePulses(pulses []int) []*Reading {
+	var readings []*Reading
+	for _, burst := range segments(pulses, func(p int) bool { return p <= -QuietUs }) {
+		readings = append(readings, DecodeFrames(demod.Split(burst))...)
+	}
+	return readings
+}
+
+// Receiver decodes consecutive raw OOK blocks, as returned by RFRecv on a
+// no-sync OOK profile, carrying a burst that spans blocks over to the next
+type Receiver struct {
+	sampleRate float64
+	pending    []int
+	pendingUs  int
+}
+
+// Burst boundaries
+const (
+	QuietUs      = 20000   // A gap this long ends a burst
+	MaxPendingUs = 2000000 // A burst is decoded as it stands when it grows this long
+)
+
+// NewReceiver creates a Receiver for blocks sampled at sampleRate baud
+func NewReceiver(sampleRate float64) *Receiver {
+	return &Receiver{sampleRate: sampleRate}
+}
+
+// Add takes the next block and returns the readings of every burst that
+// ended in it
+func (r *Receiver) Add(data []byte) []*Reading {
+	for _, p := range demod.Pulses(data, r.sampleRate) {
+		if n := len(r.pending); n > 0 && (r.pending[n-1] > 0) == (p > 0) {
+			// The run continues from the previous block
+			r.pending[n-1] += p
+		} else {
+			r.pending = append(r.pending, p)
+		}
+		if p < 0 {
+			p = -p
+		}
+		r.pendingUs += p
+	}
+
+	cut := -1
+	for i := len(r.pending) - 1; i >= 0; i-- {
+		if r.pending[i] <= -QuietUs {
+			cut = i
+			break
+		}
+	}
+	if cut < 0 {
+		if r.pendingUs < MaxPendingUs {
+			return nil
+		}
+		cut = len(r.pending)
+	}
+	burst := r.pending[:cut]
+	r.pending = append([]int(nil), r.pending[min(cut+1, len(r.pending)):]...)
+	r.pendingUs = 0
+	for _, p := range r.pending {
+		if p < 0 {
+			p = -p
+		}
+		r.pendingUs += p
+	}
+	return DecodeFrames(demod.Split(burst))
+}
+
+// Flush decodes whatever is held back
+func (r *Receiver) Flush() []*Reading {
+	burst := r.pending
+	r.pending, r.pendingUs = nil, 0
+	return DecodeFrames(demod.Split(burst))
+}
+
+// segments splits pulses at every element for which split returns true,
+// dropping those elements
+func segments(pulses []int, split func(p int) bool) [][]int {
+	var segs [][]int
+	start := 0
+	for i, p := range pulses {
+		if split(p) {
+			if i > start {
+				segs = append(segs, pulses[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(pulses) {
+		segs = append(segs, pulses[start:])
+	}
+	return segs
+}
+
+func invert(bits demod.Bits) demod.Bits {
+	out := make(demod.Bits, len(bits))
+	for i, b := range bits {
+		out[i] = b ^ 1
+	}
+	return out
+}
+
+func parseBits(s string) demod.Bits {
+	bits := make(demod.Bits, len(s))
+	for i := range s {
+		bits[i] = s[i] - '0'
+	}
+	return bits
+}
+
+// field reads n bits starting at pos as an unsigned integer, MSB first
+func field(bits demod.Bits, pos, n int) int {
+	v := 0
+	for _, b := range bits[pos : pos+n] {
+		v = v<<1 | int(b)
+	}
+	return v
+}
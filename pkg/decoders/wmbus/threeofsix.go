@@ -0,0 +1,63 @@
+package wmbus
+
+// encode3of6 maps each nibble to its 6-chip symbol
+var encode3of6 = [16]uint8{
+	0x16, 0x0D, 0x0E, 0x0B, 0x1C, 0x19, 0x1A, 0x13,
+	0x2C, 0x25, 0x26, 0x23, 0x34, 0x31, 0x32, 0x29,
+}
+
+// decode3of6 maps each 6-chip symbol to its nibble, or 0xFF if invalid
+var decode3of6 [64]uint8
+
+func init() {
+	for i := range decode3of6 {
+		decode3of6[i] = 0xFF
+	}
+	for nibble, symbol := range encode3of6 {
+		decode3of6[symbol] = uint8(nibble)
+	}
+}
+
+// Encode3of6 codes data as T1 chips, 12 per byte, MSB first. A last odd
+// half byte is padded with zero chips
+func Encode3of6(data []byte) []byte {
+	out := make([]byte, (len(data)*12+7)/8)
+	pos := 0
+	for _, b := range data {
+		for _, nibble := range []byte{b >> 4, b & 0xF} {
+			symbol := encode3of6[nibble]
+			for i := 5; i >= 0; i-- {
+				out[pos/8] |= (symbol >> uint(i) & 1) << (7 - uint(pos%8))
+				pos++
+			}
+		}
+	}
+	return out
+}
+
+// Decode3of6 decodes T1 chips up to the first invalid symbol or the end
+// of chips, returning the complete bytes
+func Decode3of6(chips []byte) []byte {
+	out := make([]byte, len(chips)*8/12)
+	n := 0
+	for pos := 0; n < len(out); pos += 12 {
+		hi := decode3of6[symbolAt(chips, pos)]
+		lo := decode3of6[symbolAt(chips, pos+6)]
+		if hi == 0xFF || lo == 0xFF {
+			break
+		}
+		out[n] = hi<<4 | lo
+		n++
+	}
+	return out[:n]
+}
+
+// symbolAt reads the 6 chips starting at bit pos, MSB first
+func symbolAt(chips []byte, pos int) uint8 {
+	var v uint8
+	for i := 0; i < 6; i++ {
+		p := pos + i
+		v = v<<1 | chips[p/8]>>(7-uint(p%8))&1
+	}
+	return v
+}
@@ -0,0 +1,411 @@
+// Package demod recovers pulse timings from raw OOK bitstreams and decodes
+// the line codes used by key fobs and sensors
+//
+// The radio, on a no-sync OOK profile in fixed or infinite packet mode,
+// returns the demodulated carrier as bits sampled at the data rate. Runs
+// of equal bits become pulses (carrier on) and gaps (carrier off), long
+// gaps split the stream into frames, and each frame is classified by the
+// widths it uses:
+//   - PWM: two pulse widths, the bit is in the pulse width; the period is
+//     usually constant, or the gap fixed. Long pulse = 1
+//   - PPM: one pulse width, the bit is in the gap after it. Long gap = 1
+//   - Manchester: pulses and gaps of one or two half-bit widths. A bit is
+//     a high half then a low half for 1, low then high for 0
+//
+// Pulses use the pkg/capture convention: signed durations in
+// microseconds, positive for carrier on and negative for off, so .sub
+// captures can be decoded the same way.
+package demod
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Encoding is a line code
+type Encoding string
+
+// Encodings
+const (
+	Unknown    Encoding = "unknown"
+	PWM        Encoding = "pwm"
+	PPM        Encoding = "ppm"
+	Manchester Encoding = "manchester"
+)
+
+// gapSymbols is the shortest gap, in short widths, that ends a frame
+const gapSymbols = 8
+
+// MinPulses is the fewest pulses and gaps a frame needs to be decoded
+const MinPulses = 8
+
+// clusterRatio is how much wider than the narrowest member of a width
+// cluster a pulse may be and still belong to it
+const clusterRatio = 1.4
+
+// Errors
+var (
+	ErrTooShort = errors.New("frame too short to decode")
+	ErrUnknown  = errors.New("encoding not recognized")
+)
+
+// Bits is a decoded symbol stream, one 0 or 1 per element
+type Bits []uint8
+
+// String returns the bits as a string of 0s and 1s
+func (b Bits) String() string {
+	var s strings.Builder
+	for _, v := range b {
+		s.WriteByte('0' + v)
+	}
+	return s.String()
+}
+
+// Bytes packs the bits MSB first; the final byte is zero padded
+func (b Bits) Bytes() []byte {
+	out := make([]byte, (len(b)+7)/8)
+	for i, v := range b {
+		out[i/8] |= v << uint(7-i%8)
+	}
+	return out
+}
+
+// MarshalJSON writes the bits as a string of 0s and 1s
+func (b Bits) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + b.String() + `"`), nil
+}
+
+// Frame is one decoded frame
+type Frame struct {
+	Encoding Encoding `json:"encoding"`
+	ShortUs  int      `json:"short_us"`            // Short pulse (PWM), short gap (PPM) or half bit (Manchester)
+	LongUs   int      `json:"long_us"`             // The long counterpart
+	PeriodUs int      `json:"period_us,omitempty"` // PWM bit period when constant
+	Bits     Bits     `json:"bits"`
+	Errors   int      `json:"errors"` // Widths that fit neither symbol, or invalid Manchester pairs
+	Pulses   []int    `json:"pulses"`
+}
+
+// Runs returns the lengths of the runs of equal bits in data, MSB first,
+// as signed sample counts: positive for ones (carrier), negative for zeros
+func Runs(data []byte) []int {
+	var runs []int
+	for i := 0; i < len(data)*8; i++ {
+		bit := data[i/8]>>uint(7-i%8)&1 == 1
+		if n := len(runs); n > 0 && (runs[n-1] > 0) == bit {
+			if bit {
+				runs[n-1]++
+			} else {
+				runs[n-1]--
+			}
+			continue
+		}
+		if bit {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, -1)
+		}
+	}
+	return runs
+}
+
+// Pulses converts a bitstream sampled at sampleRate (the radio's data
+// rate in baud) to signed pulse durations in microseconds
+func Pulses(data []byte, sampleRate float64) []int {
+	if sampleRate <= 0 {
+		return nil
+	}
+	runs := Runs(data)
+	us := 1e6 / sampleRate
+	for i, r := range runs {
+		runs[i] = int(math.Round(float64(r) * us))
+	}
+	return runs
+}
+
+// Split breaks a pulse train into frames at gaps of gapSymbols short
+// widths or more; frames with fewer than MinPulses pulses and gaps are
+// dropped, as are the gaps themselves. Glitches under half the narrowest
+// common width are absorbed into the pulse or gap around them first
+func Split(pulses []int) [][]int {
+	pulses = deglitch(pulses)
+	short := shortest(pulses)
+	if short == 0 {
+		return nil
+	}
+	var frames [][]int
+	var cur []int
+	flush := func() {
+		// A frame starts with carrier and ends with it
+		for len(cur) > 0 && cur[0] < 0 {
+			cur = cur[1:]
+		}
+		for len(cur) > 0 && cur[len(cur)-1] < 0 {
+			cur = cur[:len(cur)-1]
+		}
+		if len(cur) >= MinPulses {
+			frames = append(frames, cur)
+		}
+		cur = nil
+	}
+	for _, p := range pulses {
+		if p < 0 && -p >= short*gapSymbols {
+			flush()
+			continue
+		}
+		cur = append(cur, p)
+	}
+	flush()
+	return frames
+}
+
+// Demodulate splits a bitstream sampled at sampleRate into frames and
+// decodes each; frames that can't be classified are returned with
+// Encoding Unknown and their pulses
+func Demodulate(data []byte, sampleRate float64) []*Frame {
+	var frames []*Frame
+	for _, pulses := range Split(Pulses(data, sampleRate)) {
+		f, err := Decode(pulses)
+		if err != nil {
+			f = &Frame{Encoding: Unknown, Pulses: pulses}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// Decode classifies one frame, as returned by Split, and decodes its bits
+func Decode(pulses []int) (*Frame, error) {
+	if len(pulses) < MinPulses {
+		return nil, ErrTooShort
+	}
+	var highs, lows []int
+	for _, p := range pulses {
+		if p > 0 {
+			highs = append(highs, p)
+		} else {
+			lows = append(lows, -p)
+		}
+	}
+	hc, lc := clusters(highs), clusters(lows)
+
+	f := &Frame{Pulses: pulses}
+	switch {
+	case len(hc) == 2 && (len(lc) == 1 || constantPeriod(pulses) > 0):
+		f.Encoding, f.ShortUs, f.LongUs = PWM, hc[0], hc[1]
+		f.PeriodUs = constantPeriod(pulses)
+		decodeWidths(f, highs)
+	case len(hc) == 1 && len(lc) == 2:
+		f.Encoding, f.ShortUs, f.LongUs = PPM, lc[0], lc[1]
+		decodeWidths(f, lows)
+	case manchesterWidths(hc, lc):
+		half := hc[0]
+		if len(lc) > 0 && lc[0] < half {
+			half = lc[0]
+		}
+		f.Encoding, f.ShortUs, f.LongUs = Manchester, half, 2*half
+		decodeManchester(f)
+	default:
+		return nil, ErrUnknown
+	}
+	return f, nil
+}
+
+// decodeWidths makes one bit per width: 1 when nearer the long width
+func decodeWidths(f *Frame, widths []int) {
+	threshold := (f.ShortUs + f.LongUs) / 2
+	for _, w := range widths {
+		if !near(w, f.ShortUs) && !near(w, f.LongUs) {
+			f.Errors++
+		}
+		if w > threshold {
+			f.Bits = append(f.Bits, 1)
+		} else {
+			f.Bits = append(f.Bits, 0)
+		}
+	}
+}
+
+// decodeManchester expands the frame to half bits and pairs them up. The
+// frame starts with carrier, which is either the first half of a 1 or
+// the second half of a 0, so both alignments are tried
+func decodeManchester(f *Frame) {
+	var halves []uint8
+	for _, p := range f.Pulses {
+		level, w := uint8(1), p
+		if p < 0 {
+			level, w = 0, -p
+		}
+		n := int(math.Round(float64(w) / float64(f.ShortUs)))
+		if n < 1 || n > 2 {
+			f.Errors++
+			n = 2
+			if w < f.ShortUs {
+				n = 1
+			}
+		}
+		for i := 0; i < n; i++ {
+			halves = append(halves, level)
+		}
+	}
+
+	var best Bits
+	bestErrors := -1
+	for _, lead := range [][]uint8{nil, {0}} {
+		h := append(append([]uint8(nil), lead...), halves...)
+		if len(h)%2 == 1 {
+			// The carrier ended on the first half of a 1
+			h = append(h, 0)
+		}
+		var bits Bits
+		errs := 0
+		for i := 0; i+1 < len(h); i += 2 {
+			switch {
+			case h[i] == 1 && h[i+1] == 0:
+				bits = append(bits, 1)
+			case h[i] == 0 && h[i+1] == 1:
+				bits = append(bits, 0)
+			default:
+				errs++
+			}
+		}
+		if bestErrors < 0 || errs < bestErrors {
+			best, bestErrors = bits, errs
+		}
+	}
+	f.Bits = best
+	f.Errors += bestErrors
+}
+
+// manchesterWidths reports whether every width cluster is one or two
+// half bits, with at least one of each
+func manchesterWidths(hc, lc []int) bool {
+	all := append(append([]int(nil), hc...), lc...)
+	if len(hc) == 0 || len(lc) == 0 || len(all) < 3 {
+		return false
+	}
+	sort.Ints(all)
+	half := all[0]
+	for _, c := range all {
+		if !near(c, half) && !near(c, 2*half) {
+			return false
+		}
+	}
+	return near(all[len(all)-1], 2*half)
+}
+
+// constantPeriod returns the mean pulse plus following gap when they are
+// all within a quarter of it, or 0
+func constantPeriod(pulses []int) int {
+	var sums []int
+	for i := 0; i+1 < len(pulses); i++ {
+		if pulses[i] > 0 && pulses[i+1] < 0 {
+			sums = append(sums, pulses[i]-pulses[i+1])
+		}
+	}
+	if len(sums) < 2 {
+		return 0
+	}
+	total := 0
+	for _, s := range sums {
+		total += s
+	}
+	mean := total / len(sums)
+	for _, s := range sums {
+		if math.Abs(float64(s-mean)) > float64(mean)/4 {
+			return 0
+		}
+	}
+	return mean
+}
+
+// clusters groups widths that are within clusterRatio of each other and
+// returns the mean of each group holding at least 5% of them, narrowest
+// first
+func clusters(widths []int) []int {
+	if len(widths) == 0 {
+		return nil
+	}
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	minCount := len(sorted) / 20
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	var centers []int
+	start, total := 0, 0
+	for i, w := range sorted {
+		if i > start && float64(w) > float64(sorted[start])*clusterRatio {
+			if n := i - start; n >= minCount {
+				centers = append(centers, total/n)
+			}
+			start, total = i, 0
+		}
+		total += w
+	}
+	if n := len(sorted) - start; n >= minCount {
+		centers = append(centers, total/n)
+	}
+	return centers
+}
+
+// deglitch merges runs narrower than half the narrowest width cluster
+// into the run before them, joining it with the run after
+func deglitch(pulses []int) []int {
+	widths := make([]int, len(pulses))
+	for i, p := range pulses {
+		widths[i] = abs(p)
+	}
+	c := clusters(widths)
+	if len(c) == 0 {
+		return pulses
+	}
+	min := c[0] / 2
+
+	var out []int
+	for _, p := range pulses {
+		n := len(out)
+		if n > 0 && (abs(p) < min || (out[n-1] > 0) == (p > 0)) {
+			if out[n-1] > 0 {
+				out[n-1] += abs(p)
+			} else {
+				out[n-1] -= abs(p)
+			}
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// shortest returns the 10th percentile width, so a few glitches don't
+// collapse the estimate
+func shortest(pulses []int) int {
+	if len(pulses) == 0 {
+		return 0
+	}
+	widths := make([]int, len(pulses))
+	for i, p := range pulses {
+		if p < 0 {
+			p = -p
+		}
+		widths[i] = p
+	}
+	sort.Ints(widths)
+	return widths[len(widths)/10]
+}
+
+// near reports whether w is within a third of want
+func near(w, want int) bool {
+	return math.Abs(float64(w-want)) <= float64(want)/3
+}
@@ -0,0 +1,86 @@
+// Package exitcode defines the process exit codes shared by the
+// command-line tools, so scripts and CI pipelines can branch on the kind
+// of failure instead of parsing error messages
+//
+//	0  OK              Success
+//	1  Failure         Unclassified error
+//	2  Usage           Bad flags or arguments
+//	3  DeviceNotFound  No device matched the selector
+//	4  USB             USB open, claim or transfer failed
+//	5  ConfigInvalid   Configuration or profile file unreadable or invalid
+//	6  VerifyFailed    Registers read back differently than written
+//	7  RFTestFailed    Every RF test iteration failed
+//	8  Partial         Some iterations, packets or devices failed
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Exit codes
+const (
+	OK             = 0
+	Failure        = 1
+	Usage          = 2 // Matches the flag package's exit code on parse errors
+	DeviceNotFound = 3
+	USB            = 4
+	ConfigInvalid  = 5
+	VerifyFailed   = 6
+	RFTestFailed   = 7
+	Partial        = 8
+)
+
+// Error attaches an exit code to an error
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New attaches an exit code to err; nil stays nil
+func New(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Errorf formats an error with an exit code
+func Errorf(code int, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Of returns the exit code for err. An explicit code set with New or
+// Errorf wins; otherwise the code follows the error class
+func Of(err error) int {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	switch {
+	case errors.Is(err, yardstick.ErrDeviceNotFound):
+		return DeviceNotFound
+	case errors.Is(err, yardstick.ErrUSB):
+		return USB
+	case errors.Is(err, config.ErrInvalid):
+		return ConfigInvalid
+	}
+	return Failure
+}
+
+// Exit prints err to stderr with the given prefix and exits with its code
+func Exit(prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+	os.Exit(Of(err))
+}
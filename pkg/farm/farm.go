@@ -0,0 +1,296 @@
+// Package farm runs the profile regression matrix and link tests across
+// every pair of attached dongles in parallel
+//
+// Devices are reserved with yardstick device locks, so several farm runs
+// (or other lock-aware tools) on one host split the dongles between them
+// instead of fighting over them. Each pair takes jobs from a shared queue.
+// Pairs are on the air together, so two jobs on the same frequency never
+// run at once; payloads also carry the pair number so a packet overheard
+// from another pair is counted as crosstalk rather than a pass.
+package farm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Job kinds
+const (
+	KindProfile = "profile" // Single-packet loopback, as profile-test runs it
+	KindLink    = "link"    // Burst of packets at a fixed spacing, as test-10-repeat runs it
+)
+
+// Job is one entry of the test matrix
+type Job struct {
+	Kind    string
+	Profile *profiles.Profile
+}
+
+// Options controls how each job is run
+type Options struct {
+	Repeat      int           // Loopback iterations per profile job
+	LinkPackets int           // Packets per link job
+	LinkDelay   time.Duration // Spacing between link packets
+	Timeout     time.Duration // Receive timeout floor; raised to cover the airtime
+	MaxPER      float64       // Highest packet error rate a job may show and pass (0-1)
+	Progress    io.Writer     // Receives one line per finished job; nil discards
+}
+
+// DefaultOptions returns the options gocat farm uses
+func DefaultOptions() *Options {
+	return &Options{
+		Repeat:      3,
+		LinkPackets: 20,
+		LinkDelay:   50 * time.Millisecond,
+		Timeout:     500 * time.Millisecond,
+		MaxPER:      0,
+	}
+}
+
+// Pair is a reserved transmitter and receiver
+type Pair struct {
+	ID    int
+	TX    *yardstick.Device
+	RX    *yardstick.Device
+	locks []*yardstick.DeviceLock
+}
+
+// String returns "tx->rx" by lock ID
+func (p *Pair) String() string {
+	return p.TX.LockID() + "->" + p.RX.LockID()
+}
+
+// Release unlocks and closes both devices
+func (p *Pair) Release() {
+	for _, l := range p.locks {
+		l.Unlock()
+	}
+	p.TX.Close()
+	p.RX.Close()
+}
+
+// Reserve locks the devices and pairs them in bus:address order
+// Devices locked by another process, and an odd one left over, are closed
+// and returned in skipped with the reason
+func Reserve(devices []*yardstick.Device) (pairs []*Pair, skipped []string) {
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Bus != devices[j].Bus {
+			return devices[i].Bus < devices[j].Bus
+		}
+		return devices[i].Address < devices[j].Address
+	})
+
+	var free []*yardstick.Device
+	var locks []*yardstick.DeviceLock
+	for _, d := range devices {
+		lock, err := d.Lock()
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", d.LockID(), err))
+			d.Close()
+			continue
+		}
+		free = append(free, d)
+		locks = append(locks, lock)
+	}
+
+	for i := 0; i+1 < len(free); i += 2 {
+		pairs = append(pairs, &Pair{
+			ID:    len(pairs) + 1,
+			TX:    free[i],
+			RX:    free[i+1],
+			locks: locks[i : i+2],
+		})
+	}
+	if len(free)%2 == 1 {
+		last := len(free) - 1
+		skipped = append(skipped, fmt.Sprintf("%s: no partner", free[last].LockID()))
+		locks[last].Unlock()
+		free[last].Close()
+	}
+	return pairs, skipped
+}
+
+// Matrix builds the job list: a loopback job for every profile and, when
+// link is set, a link job for every profile with sync, CRC and a bounded
+// packet length
+func Matrix(list []*profiles.Profile, link bool) []Job {
+	var jobs []Job
+	for _, p := range list {
+		jobs = append(jobs, Job{Kind: KindProfile, Profile: p})
+	}
+	if link {
+		for _, p := range list {
+			if p.SyncMode != profiles.SyncNone && p.CRCEn && p.PktLenMode != profiles.PktLenInfinite {
+				jobs = append(jobs, Job{Kind: KindLink, Profile: p})
+			}
+		}
+	}
+	return jobs
+}
+
+// Result is the outcome of one job
+type Result struct {
+	Kind        string  `json:"kind"`
+	Profile     string  `json:"profile"`
+	FrequencyHz float64 `json:"frequency_hz"`
+	Pair        int     `json:"pair"`
+	TX          string  `json:"tx"`
+	RX          string  `json:"rx"`
+	Sent        int     `json:"sent"`
+	Received    int     `json:"received"`
+	Crosstalk   int     `json:"crosstalk,omitempty"` // Packets heard from other pairs
+	PER         float64 `json:"per"`
+	RSSIdBm     *int    `json:"rssi_dbm,omitempty"` // Average over matched loopback packets
+	Passed      bool    `json:"passed"`
+	Error       string  `json:"error,omitempty"`
+	DurationMS  int64   `json:"duration_ms"`
+}
+
+// PairInfo names the devices of a pair in the report
+type PairInfo struct {
+	ID   int    `json:"id"`
+	TX   string `json:"tx"`
+	RX   string `json:"rx"`
+	Jobs int    `json:"jobs"`
+}
+
+// Report aggregates every job of a run
+type Report struct {
+	Started    time.Time  `json:"started"`
+	DurationMS int64      `json:"duration_ms"`
+	Pairs      []PairInfo `json:"pairs"`
+	Skipped    []string   `json:"skipped,omitempty"`
+	Results    []Result   `json:"results"`
+	Passed     int        `json:"passed"`
+	Failed     int        `json:"failed"`
+	NotRun     int        `json:"not_run,omitempty"` // Jobs left when the run was cancelled
+}
+
+// Run distributes jobs across the pairs and waits for them all, or for
+// ctx to be cancelled. Results are ordered as the jobs were
+func Run(ctx context.Context, pairs []*Pair, jobs []Job, opts *Options) *Report {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = io.Discard
+	}
+
+	report := &Report{Started: time.Now().UTC()}
+	sched := newScheduler(ctx, jobs)
+	results := make([]*Result, len(jobs))
+	counts := make([]int, len(pairs))
+	var progressMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, pair := range pairs {
+		wg.Add(1)
+		go func(i int, pair *Pair) {
+			defer wg.Done()
+			for {
+				idx, ok := sched.next()
+				if !ok {
+					return
+				}
+				res := runJob(ctx, pair, jobs[idx], opts)
+				sched.done(idx)
+				results[idx] = res
+				counts[i]++
+
+				status := "PASS"
+				if !res.Passed {
+					status = "FAIL"
+				}
+				progressMu.Lock()
+				fmt.Fprintf(progress, "[pair %d] %-7s %-32s %d/%d %s", pair.ID, res.Kind, res.Profile, res.Received, res.Sent, status)
+				if res.Error != "" {
+					fmt.Fprintf(progress, " (%s)", res.Error)
+				}
+				fmt.Fprintln(progress)
+				progressMu.Unlock()
+			}
+		}(i, pair)
+	}
+	wg.Wait()
+
+	for i, pair := range pairs {
+		report.Pairs = append(report.Pairs, PairInfo{ID: pair.ID, TX: pair.TX.LockID(), RX: pair.RX.LockID(), Jobs: counts[i]})
+	}
+	for _, res := range results {
+		switch {
+		case res == nil:
+			report.NotRun++
+		case res.Passed:
+			report.Passed++
+		default:
+			report.Failed++
+		}
+		if res != nil {
+			report.Results = append(report.Results, *res)
+		}
+	}
+	report.DurationMS = time.Since(report.Started).Milliseconds()
+	return report
+}
+
+// scheduler hands out jobs so no two pairs use one frequency at a time
+type scheduler struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    []Job
+	pending []int
+	busy    map[float64]bool
+}
+
+func newScheduler(ctx context.Context, jobs []Job) *scheduler {
+	s := &scheduler{ctx: ctx, jobs: jobs, busy: make(map[float64]bool)}
+	s.cond = sync.NewCond(&s.mu)
+	for i := range jobs {
+		s.pending = append(s.pending, i)
+	}
+	// Wake waiting pairs on cancellation
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	return s
+}
+
+// next blocks until a job on a free frequency is available; ok is false
+// once the queue is empty or ctx is cancelled
+func (s *scheduler) next() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.ctx.Err() != nil || len(s.pending) == 0 {
+			return 0, false
+		}
+		for i, idx := range s.pending {
+			freq := s.jobs[idx].Profile.FrequencyHz
+			if !s.busy[freq] {
+				s.busy[freq] = true
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				return idx, true
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+// done frees the job's frequency
+func (s *scheduler) done(idx int) {
+	s.mu.Lock()
+	delete(s.busy, s.jobs[idx].Profile.FrequencyHz)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
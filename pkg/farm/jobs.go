@@ -0,0 +1,238 @@
+package farm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// rxSettle lets the receiver reach RX before a loopback packet is sent
+const rxSettle = 200 * time.Millisecond
+
+// payloadMarker starts every test payload; the pair ID and sequence
+// number follow it
+var payloadMarker = []byte{0xFA, 0x57}
+
+// runJob configures the pair for the job's profile and runs it
+func runJob(ctx context.Context, pair *Pair, job Job, opts *Options) *Result {
+	start := time.Now()
+	res := &Result{
+		Kind:        job.Kind,
+		Profile:     job.Profile.Name,
+		FrequencyHz: job.Profile.FrequencyHz,
+		Pair:        pair.ID,
+		TX:          pair.TX.LockID(),
+		RX:          pair.RX.LockID(),
+	}
+
+	err := configure(pair, job.Profile)
+	if err == nil {
+		switch job.Kind {
+		case KindProfile:
+			err = loopback(ctx, pair, job.Profile, opts, res)
+		case KindLink:
+			err = linkTest(ctx, pair, job.Profile, opts, res)
+		default:
+			err = fmt.Errorf("unknown job kind '%s'", job.Kind)
+		}
+	}
+	pair.RX.SetModeIDLE()
+	pair.TX.SetModeIDLE()
+
+	if res.Sent > 0 {
+		res.PER = 1 - float64(res.Received)/float64(res.Sent)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Passed = err == nil && res.Sent > 0 && res.PER <= opts.MaxPER
+	res.DurationMS = time.Since(start).Milliseconds()
+	return res
+}
+
+// configure applies the profile to both radios from IDLE
+func configure(pair *Pair, p *profiles.Profile) error {
+	for _, d := range []*yardstick.Device{pair.TX, pair.RX} {
+		d.SetModeIDLE()
+		if err := config.ApplyProfile(d, p); err != nil {
+			return fmt.Errorf("%s: %w", d.LockID(), err)
+		}
+	}
+	return nil
+}
+
+// payloadLen picks the test payload size the way profile-test does
+func payloadLen(p *profiles.Profile) int {
+	n := int(p.PktLen)
+	if p.PktLenMode == profiles.PktLenVariable {
+		n = 16
+	}
+	if n > 64 {
+		n = 64
+	}
+	if n < len(payloadMarker)+2 {
+		n = len(payloadMarker) + 2
+	}
+	return n
+}
+
+// testPayload builds the payload for one packet of a pair
+func testPayload(pair, seq, n int) []byte {
+	data := make([]byte, n)
+	copy(data, payloadMarker)
+	data[2] = byte(pair)
+	data[3] = byte(seq)
+	for i := 4; i < n; i++ {
+		data[i] = byte(i + 0x42)
+	}
+	return data
+}
+
+// decode finds a test payload in received data. Without a sync word the
+// payload may start anywhere in the capture; otherwise it must lead and
+// match byte for byte. ok is false for anything else
+func decode(p *profiles.Profile, data []byte, n int) (pair, seq int, ok bool) {
+	idx := 0
+	if p.SyncMode == profiles.SyncNone {
+		idx = bytes.Index(data, payloadMarker)
+	}
+	if idx < 0 || len(data) < idx+4 || !bytes.HasPrefix(data[idx:], payloadMarker) {
+		return 0, 0, false
+	}
+	pair, seq = int(data[idx+2]), int(data[idx+3])
+	if p.SyncMode != profiles.SyncNone && !bytes.HasPrefix(data, testPayload(pair, seq, n)) {
+		return 0, 0, false
+	}
+	return pair, seq, true
+}
+
+// rxTimeout never waits less than the packet takes on air
+func rxTimeout(p *profiles.Profile, n int, opts *Options) time.Duration {
+	timeout := opts.Timeout
+	if floor := 2*profiles.Airtime(p, n) + 100*time.Millisecond; timeout < floor {
+		timeout = floor
+	}
+	return timeout
+}
+
+// loopback sends single packets with the receiver re-armed for each
+func loopback(ctx context.Context, pair *Pair, p *profiles.Profile, opts *Options, res *Result) error {
+	n := payloadLen(p)
+	timeout := rxTimeout(p, n, opts)
+	rssiSum, rssiCount := 0, 0
+
+	for i := 0; i < opts.Repeat; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := pair.RX.SetModeRX(); err != nil {
+			return fmt.Errorf("RX mode: %w", err)
+		}
+		time.Sleep(rxSettle)
+
+		payload := testPayload(pair.ID, i, n)
+		if err := pair.TX.RFXmit(payload, 0, 0); err != nil {
+			return fmt.Errorf("TX: %w", err)
+		}
+		res.Sent++
+
+		// Keep listening past packets overheard from other pairs
+		deadline := time.Now().Add(timeout)
+		for remaining := timeout; remaining > 0; remaining = time.Until(deadline) {
+			data, err := pair.RX.RFRecv(remaining, 0)
+			if err != nil {
+				break
+			}
+			from, seq, ok := decode(p, data, n)
+			if !ok {
+				continue
+			}
+			if from != pair.ID {
+				res.Crosstalk++
+				continue
+			}
+			if seq == i {
+				res.Received++
+				if status, err := pair.RX.GetRadioStatus(); err == nil {
+					rssiSum += status.RSSIdBm
+					rssiCount++
+				}
+				break
+			}
+		}
+		pair.RX.SetModeIDLE()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if rssiCount > 0 {
+		avg := rssiSum / rssiCount
+		res.RSSIdBm = &avg
+	}
+	return nil
+}
+
+// linkTest sends a burst with the receiver left in RX throughout
+func linkTest(ctx context.Context, pair *Pair, p *profiles.Profile, opts *Options, res *Result) error {
+	n := payloadLen(p)
+	timeout := rxTimeout(p, n, opts)
+	if err := pair.RX.SetModeRX(); err != nil {
+		return fmt.Errorf("RX mode: %w", err)
+	}
+	time.Sleep(rxSettle)
+
+	rxCtx, stop := context.WithCancel(ctx)
+	seen := make(map[int]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for rxCtx.Err() == nil {
+			data, err := pair.RX.RFRecv(100*time.Millisecond, 0)
+			if err != nil {
+				continue
+			}
+			from, seq, ok := decode(p, data, n)
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			if from != pair.ID {
+				res.Crosstalk++
+			} else {
+				seen[seq] = true
+			}
+			mu.Unlock()
+		}
+	}()
+
+	var err error
+	for i := 0; i < opts.LinkPackets; i++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = pair.TX.RFXmit(testPayload(pair.ID, i, n), 0, 0); err != nil {
+			err = fmt.Errorf("TX: %w", err)
+			break
+		}
+		res.Sent++
+		time.Sleep(opts.LinkDelay)
+	}
+
+	// Give the last packet time to arrive
+	time.Sleep(timeout)
+	stop()
+	wg.Wait()
+	for seq := range seen {
+		if seq < res.Sent {
+			res.Received++
+		}
+	}
+	return err
+}
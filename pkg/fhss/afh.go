@@ -0,0 +1,318 @@
+package fhss
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// afhPrefix starts the channel map extension after a beacon number
+const afhPrefix = " AFH:"
+
+// ChannelMap is the set of channels adaptive frequency hopping has taken
+// out of a hop sequence, as the master announces it in its beacons. Both
+// ends switch to it at beacon number Instant, so the announcement runs a
+// few beacons ahead of the switch
+type ChannelMap struct {
+	Version uint8   // Changes with every new map
+	Instant int     // Beacon number from which the map is used
+	Blocked []uint8 // Channels left out, in order
+}
+
+// IsBlocked reports whether ch is left out
+func (m *ChannelMap) IsBlocked(ch uint8) bool {
+	i := sort.Search(len(m.Blocked), func(i int) bool { return m.Blocked[i] >= ch })
+	return i < len(m.Blocked) && m.Blocked[i] == ch
+}
+
+// Apply returns seq without the blocked channels, in the same order
+func (m *ChannelMap) Apply(seq []uint8) []uint8 {
+	out := make([]uint8, 0, len(seq))
+	for _, ch := range seq {
+		if !m.IsBlocked(ch) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// String lists the blocked channels
+func (m *ChannelMap) String() string {
+	if len(m.Blocked) == 0 {
+		return fmt.Sprintf("v%d from beacon %d, all channels", m.Version, m.Instant)
+	}
+	return fmt.Sprintf("v%d from beacon %d, blocked %v", m.Version, m.Instant, m.Blocked)
+}
+
+// BeaconWithMap returns the payload of beacon number n carrying m, which
+// ParseBeacon still reads as an ordinary beacon. The map is a bitmap of
+// the MaxSequenceChannels channel numbers, so it adds 75 bytes or so
+func BeaconWithMap(n int, m *ChannelMap) []byte {
+	var bits [MaxSequenceChannels / 8]byte
+	for _, ch := range m.Blocked {
+		bits[ch/8] |= 1 << (ch % 8)
+	}
+	return fmt.Appendf(Beacon(n), "%s%d:%d:%s", afhPrefix, m.Version, m.Instant, hex.EncodeToString(bits[:]))
+}
+
+// ParseChannelMap returns the channel map a beacon carries; false if it
+// carries none or the map is malformed
+func ParseChannelMap(data []byte) (*ChannelMap, bool) {
+	s := string(data)
+	i := strings.Index(s, afhPrefix)
+	if i < 0 {
+		return nil, false
+	}
+	fields := strings.SplitN(s[i+len(afhPrefix):], ":", 3)
+	if len(fields) != 3 || len(fields[2]) < 2*MaxSequenceChannels/8 {
+		return nil, false
+	}
+	version, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return nil, false
+	}
+	instant, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, false
+	}
+	bits, err := hex.DecodeString(fields[2][:2*MaxSequenceChannels/8])
+	if err != nil {
+		return nil, false
+	}
+
+	m := &ChannelMap{Version: uint8(version), Instant: instant}
+	for ch := 0; ch < MaxSequenceChannels; ch++ {
+		if bits[ch/8]&(1<<(ch%8)) != 0 {
+			m.Blocked = append(m.Blocked, uint8(ch))
+		}
+	}
+	return m, true
+}
+
+// AFHOptions sets when adaptive frequency hopping takes a channel out
+type AFHOptions struct {
+	MaxNoiseDBm float32       // Block a channel whose average RSSI between transmissions is above this
+	MaxLoss     float64       // Block a channel losing more than this share of frames, 0-1; 0 = off
+	MinSamples  int           // Measurements a channel needs before it is judged
+	MinChannels int           // Never hop over fewer channels than this
+	Hold        time.Duration // How long a channel stays out before it is tried again
+	Lead        int           // Beacons between announcing a map and switching to it
+}
+
+// DefaultAFHOptions returns thresholds for a quiet band with a noise
+// floor around -100 dBm. MinChannels is Bluetooth's 20
+func DefaultAFHOptions() *AFHOptions {
+	return &AFHOptions{
+		MaxNoiseDBm: -80,
+		MaxLoss:     0.5,
+		MinSamples:  5,
+		MinChannels: 20,
+		Hold:        60 * time.Second,
+		Lead:        5,
+	}
+}
+
+// afhChannel accumulates one channel's measurements
+type afhChannel struct {
+	noise   float64 // Sum of RSSI readings
+	samples int
+	sent    int
+	lost    int
+}
+
+func (c *afhChannel) bad(opts *AFHOptions) (float64, bool) {
+	var score float64
+	bad := false
+	if c.samples >= opts.MinSamples {
+		if avg := c.noise / float64(c.samples); avg > float64(opts.MaxNoiseDBm) {
+			score, bad = avg-float64(opts.MaxNoiseDBm), true
+		}
+	}
+	if opts.MaxLoss > 0 && c.sent >= opts.MinSamples {
+		if loss := float64(c.lost) / float64(c.sent); loss > opts.MaxLoss {
+			score, bad = score+100*(loss-opts.MaxLoss), true
+		}
+	}
+	return score, bad
+}
+
+// AFH keeps the channel map of a hopping link, like Bluetooth's adaptive
+// frequency hopping. On the master it collects per-channel noise and
+// loss, and Evaluate blocks the channels over the thresholds and gives
+// blocked ones another try after Hold; the master sends Announce in each
+// beacon. A client passes the maps it hears to Offer. On both ends Due
+// says when to load the new sequence, so they change together. An AFH is
+// not safe for concurrent use
+type AFH struct {
+	opts    AFHOptions
+	base    []uint8 // The full hop sequence
+	current ChannelMap
+	pending *ChannelMap // Announced and not yet in use
+	per     map[uint8]*afhChannel
+	since   map[uint8]time.Time // When each blocked channel was taken out
+}
+
+// NewAFH creates the channel map of a link hopping over channels, with
+// every channel in use; nil opts uses DefaultAFHOptions
+func NewAFH(channels []uint8, opts *AFHOptions) *AFH {
+	if opts == nil {
+		opts = DefaultAFHOptions()
+	}
+	return &AFH{
+		opts:  *opts,
+		base:  append([]uint8(nil), channels...),
+		per:   make(map[uint8]*afhChannel),
+		since: make(map[uint8]time.Time),
+	}
+}
+
+func (a *AFH) channel(ch uint8) *afhChannel {
+	c := a.per[ch]
+	if c == nil {
+		c = &afhChannel{}
+		a.per[ch] = c
+	}
+	return c
+}
+
+// Noise records an RSSI reading taken on ch while the link was quiet
+func (a *AFH) Noise(ch uint8, rssi float32) {
+	c := a.channel(ch)
+	c.noise += float64(rssi)
+	c.samples++
+}
+
+// Delivery records whether a frame sent on ch got through
+func (a *AFH) Delivery(ch uint8, delivered bool) {
+	c := a.channel(ch)
+	c.sent++
+	if !delivered {
+		c.lost++
+	}
+}
+
+// Evaluate decides the channel map from the measurements so far, and
+// returns a new map to announce, starting Lead beacons after beacon
+// next, or nil when nothing changes or a change is already pending
+func (a *AFH) Evaluate(now time.Time, next int) *ChannelMap {
+	if a.pending != nil {
+		return nil
+	}
+
+	blocked := make(map[uint8]bool)
+	for _, ch := range a.current.Blocked {
+		if now.Sub(a.since[ch]) < a.opts.Hold {
+			blocked[ch] = true
+		} else {
+			// Judge it afresh now it is back
+			delete(a.per, ch)
+		}
+	}
+
+	type candidate struct {
+		ch    uint8
+		score float64
+	}
+	var worst []candidate
+	inUse := 0
+	for _, ch := range distinct(a.base) {
+		if blocked[ch] {
+			continue
+		}
+		inUse++
+		if c := a.per[ch]; c != nil {
+			if score, bad := c.bad(&a.opts); bad {
+				worst = append(worst, candidate{ch, score})
+			}
+		}
+	}
+	sort.Slice(worst, func(i, j int) bool { return worst[i].score > worst[j].score })
+	for _, c := range worst {
+		if inUse <= a.opts.MinChannels {
+			break
+		}
+		blocked[c.ch] = true
+		inUse--
+	}
+
+	m := &ChannelMap{Version: a.current.Version + 1, Instant: next + a.opts.Lead}
+	for ch := range blocked {
+		m.Blocked = append(m.Blocked, ch)
+	}
+	sort.Slice(m.Blocked, func(i, j int) bool { return m.Blocked[i] < m.Blocked[j] })
+	if slices.Equal(m.Blocked, a.current.Blocked) {
+		return nil
+	}
+
+	for _, ch := range m.Blocked {
+		if !a.current.IsBlocked(ch) {
+			a.since[ch] = now
+		}
+	}
+	for _, ch := range a.current.Blocked {
+		if !m.IsBlocked(ch) {
+			delete(a.since, ch)
+		}
+	}
+	a.pending = m
+	return m
+}
+
+// Offer takes a channel map heard in a beacon; true if it is new
+func (a *AFH) Offer(m *ChannelMap) bool {
+	if m.Version == a.current.Version || (a.pending != nil && a.pending.Version == m.Version) {
+		return false
+	}
+	cp := *m
+	cp.Blocked = append([]uint8(nil), m.Blocked...)
+	a.pending = &cp
+	return true
+}
+
+// Announce returns the map to send in a beacon: the pending one if there
+// is one, so clients hear it before the switch, else the one in use
+func (a *AFH) Announce() *ChannelMap {
+	if a.pending != nil {
+		return a.pending
+	}
+	return &a.current
+}
+
+// Due switches to the pending map once next, the number of the beacon
+// about to be sent or expected, reaches its instant, and returns the hop
+// sequence to load; false when there is nothing to switch to
+func (a *AFH) Due(next int) ([]uint8, bool) {
+	if a.pending == nil || next < a.pending.Instant {
+		return nil, false
+	}
+	a.current = *a.pending
+	a.pending = nil
+	return a.Channels(), true
+}
+
+// Map returns the channel map in use
+func (a *AFH) Map() ChannelMap {
+	return a.current
+}
+
+// Channels returns the hop sequence in use
+func (a *AFH) Channels() []uint8 {
+	return a.current.Apply(a.base)
+}
+
+// distinct returns the channels of seq, each once, in order
+func distinct(seq []uint8) []uint8 {
+	var seen [MaxSequenceChannels]bool
+	out := make([]uint8, 0, len(seq))
+	for _, ch := range seq {
+		if !seen[ch] {
+			seen[ch] = true
+			out = append(out, ch)
+		}
+	}
+	return out
+}
@@ -3,8 +3,10 @@
 package fhss
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/herlein/gocat/pkg/yardstick"
 )
@@ -13,6 +15,7 @@ import (
 type FHSS struct {
 	device   *yardstick.Device
 	channels []uint8
+	lease    *yardstick.Lease // Held from StartHopping/StartSync until Stop
 	mu       sync.Mutex
 }
 
@@ -20,17 +23,84 @@ type FHSS struct {
 type MACState uint8
 
 // MACData contains MAC layer timing and state information
+// It mirrors the firmware's MAC_DATA_t, little-endian and packed:
+//
+//	offset  size  field
+//	0       1     mac_state
+//	1       1     txMsgIdx
+//	2       1     txMsgIdxDone
+//	3       2     curChanIdx
+//	5       2     NumChannels
+//	7       2     NumChannelHops
+//	9       2     tLastHop
+//	11      4     tLastStateChange
+//	15      4     MAC_threshold
+//	19      4     MAC_timer
+//	23      2     desperatelySeeking
+//	25      2     synched_chans
 type MACData struct {
-	State            MACState // Current MAC state
-	TxMsgIdx         uint8    // Current TX message buffer index
-	TxMsgIdxDone     uint8    // Last completed TX message index
-	CurChanIdx       uint16   // Current channel index in hop sequence
-	NumChannels      uint16   // Total channels in sequence
-	NumChannelHops   uint16   // Number of hops completed
-	TLastHop         uint16   // Timer value at last hop
-	TLastStateChange uint32   // Timer value at last state change
-	MACThreshold     uint32   // MAC timing threshold
-	MACTimer         uint32   // Current MAC timer value
+	State              MACState // Current MAC state
+	TxMsgIdx           uint8    // Current TX message buffer index
+	TxMsgIdxDone       uint8    // Last completed TX message index
+	CurChanIdx         uint16   // Current channel index in hop sequence
+	NumChannels        uint16   // Total channels in sequence
+	NumChannelHops     uint16   // Number of hops completed
+	TLastHop           uint16   // Timer value at last hop
+	TLastStateChange   uint32   // Timer value at last state change
+	MACThreshold       uint32   // MAC timing threshold
+	MACTimer           uint32   // Current MAC timer value
+	DesperatelySeeking uint16   // Sync attempts left before giving up
+	SynchedChans       uint16   // Channels heard the master on while synching
+}
+
+// MACDataLen is the size of MAC_DATA_t
+const MACDataLen = 27
+
+// macDataMinLen covers the fields older firmware returns: state through
+// NumChannels
+const macDataMinLen = 7
+
+// ParseMACData decodes a MAC_DATA_t. Firmware that returns a shorter
+// structure leaves the fields it doesn't cover zero
+func ParseMACData(b []byte) (*MACData, error) {
+	if len(b) < macDataMinLen {
+		return nil, fmt.Errorf("MAC data too short: %d bytes", len(b))
+	}
+	if len(b) < MACDataLen {
+		b = append(append([]byte(nil), b...), make([]byte, MACDataLen-len(b))...)
+	}
+	return &MACData{
+		State:              MACState(b[0]),
+		TxMsgIdx:           b[1],
+		TxMsgIdxDone:       b[2],
+		CurChanIdx:         binary.LittleEndian.Uint16(b[3:5]),
+		NumChannels:        binary.LittleEndian.Uint16(b[5:7]),
+		NumChannelHops:     binary.LittleEndian.Uint16(b[7:9]),
+		TLastHop:           binary.LittleEndian.Uint16(b[9:11]),
+		TLastStateChange:   binary.LittleEndian.Uint32(b[11:15]),
+		MACThreshold:       binary.LittleEndian.Uint32(b[15:19]),
+		MACTimer:           binary.LittleEndian.Uint32(b[19:23]),
+		DesperatelySeeking: binary.LittleEndian.Uint16(b[23:25]),
+		SynchedChans:       binary.LittleEndian.Uint16(b[25:27]),
+	}, nil
+}
+
+// Bytes encodes the MAC data as a MAC_DATA_t
+func (m *MACData) Bytes() []byte {
+	b := make([]byte, MACDataLen)
+	b[0] = uint8(m.State)
+	b[1] = m.TxMsgIdx
+	b[2] = m.TxMsgIdxDone
+	binary.LittleEndian.PutUint16(b[3:5], m.CurChanIdx)
+	binary.LittleEndian.PutUint16(b[5:7], m.NumChannels)
+	binary.LittleEndian.PutUint16(b[7:9], m.NumChannelHops)
+	binary.LittleEndian.PutUint16(b[9:11], m.TLastHop)
+	binary.LittleEndian.PutUint32(b[11:15], m.TLastStateChange)
+	binary.LittleEndian.PutUint32(b[15:19], m.MACThreshold)
+	binary.LittleEndian.PutUint32(b[19:23], m.MACTimer)
+	binary.LittleEndian.PutUint16(b[23:25], m.DesperatelySeeking)
+	binary.LittleEndian.PutUint16(b[25:27], m.SynchedChans)
+	return b
 }
 
 // New creates a new FHSS controller for the given device
@@ -79,6 +149,9 @@ func (f *FHSS) GetChannels() ([]uint8, error) {
 
 // StartHopping begins automatic frequency hopping using the Timer T2 interrupt
 func (f *FHSS) StartHopping() error {
+	if err := f.acquire(); err != nil {
+		return err
+	}
 	_, err := f.device.Send(yardstick.AppNIC, yardstick.FHSSStartHopping, nil, yardstick.USBDefaultTimeout)
 	return err
 }
@@ -135,12 +208,17 @@ func (f *FHSS) Transmit(data []byte) error {
 	msg[0] = byte(len(data))
 	copy(msg[1:], data)
 
+	start := time.Now()
 	_, err := f.device.Send(yardstick.AppNIC, yardstick.FHSSXmit, msg, yardstick.USBDefaultTimeout)
+	f.device.ReportTx("fhss", data, start, err)
 	return err
 }
 
 // StartSync begins synchronization to a hopping network with the given cell ID
 func (f *FHSS) StartSync(cellID uint16) error {
+	if err := f.acquire(); err != nil {
+		return err
+	}
 	data := []byte{byte(cellID & 0xFF), byte(cellID >> 8)}
 	_, err := f.device.Send(yardstick.AppNIC, yardstick.FHSSStartSync, data, yardstick.USBDefaultTimeout)
 	return err
@@ -153,26 +231,15 @@ func (f *FHSS) GetMACData() (*MACData, error) {
 		return nil, err
 	}
 
-	// The MAC_DATA_t structure from firmware is roughly 24 bytes
-	// Parse what we can based on the response size
-	if len(resp) < 10 {
-		return nil, fmt.Errorf("response too short: %d bytes", len(resp))
-	}
-
-	macData := &MACData{
-		State:        MACState(resp[0]),
-		TxMsgIdx:     resp[1],
-		TxMsgIdxDone: resp[2],
-		CurChanIdx:   uint16(resp[3]) | uint16(resp[4])<<8,
-		NumChannels:  uint16(resp[5]) | uint16(resp[6])<<8,
-	}
-
-	if len(resp) >= 12 {
-		macData.NumChannelHops = uint16(resp[7]) | uint16(resp[8])<<8
-		macData.TLastHop = uint16(resp[9]) | uint16(resp[10])<<8
-	}
+	return ParseMACData(resp)
+}
 
-	return macData, nil
+// SetMACData overwrites the firmware's whole MAC_DATA_t, e.g. to restore
+// a saved MAC state or move the hop index. Read it with GetMACData first
+// and change only the fields you mean to
+func (f *FHSS) SetMACData(md *MACData) error {
+	_, err := f.device.Send(yardstick.AppNIC, yardstick.FHSSSetMACData, md.Bytes(), yardstick.USBDefaultTimeout)
+	return err
 }
 
 // SetMACThreshold configures the MAC timing threshold (dwell time related)
@@ -216,12 +283,51 @@ func (f *FHSS) BecomeClient() error {
 	return f.SetState(MACState(yardstick.MACStateSynching))
 }
 
-// Stop returns to non-hopping mode
+// Stop returns to non-hopping mode and releases the radio
 func (f *FHSS) Stop() error {
 	if err := f.StopHopping(); err != nil {
 		return err
 	}
-	return f.SetState(MACState(yardstick.MACStateNonHopping))
+	if err := f.SetState(MACState(yardstick.MACStateNonHopping)); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	lease := f.lease
+	f.lease = nil
+	f.mu.Unlock()
+	if lease != nil {
+		return lease.Release()
+	}
+	return nil
+}
+
+// Device returns the handle to change the radio through: the lease
+// holder's while hopping or syncing, otherwise the one given to New
+func (f *FHSS) Device() *yardstick.Device {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lease != nil {
+		return f.lease.Device()
+	}
+	return f.device
+}
+
+// acquire leases the radio for hopping unless already held
+func (f *FHSS) acquire() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lease != nil {
+		return nil
+	}
+	lease, err := f.device.Acquire(yardstick.ModeFHSS, "fhss")
+	if err != nil {
+		return err
+	}
+	f.lease = lease
+	return nil
 }
 
 // String returns a string representation of the MAC state
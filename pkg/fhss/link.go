@@ -0,0 +1,103 @@
+package fhss
+
+import (
+	"time"
+
+	"github.com/herlein/gocat/pkg/reliable"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// ErrLinkTimeout is returned when nothing arrives before the deadline
+var ErrLinkTimeout = reliable.ErrTimeout
+
+// ErrNoAck is returned when a message was not acknowledged after all retries
+var ErrNoAck = reliable.ErrNoAck
+
+// LinkOptions tunes the retransmission behaviour of a Link
+type LinkOptions struct {
+	AckTimeout  time.Duration // Wait for an ACK after the first attempt
+	MaxBackoff  time.Duration // Longest wait; each retry doubles it up to this
+	Retries     int           // Retransmissions after the first attempt
+	AckDelay    time.Duration // Pause before sending an ACK so the sender is back in RX
+	ReadTimeout time.Duration // How long Read waits for a message; 0 = forever
+}
+
+// DefaultLinkOptions returns settings for dwell times around 100 ms,
+// which give a lost frame a few hops to get through
+func DefaultLinkOptions() *LinkOptions {
+	return &LinkOptions{
+		AckTimeout: 250 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+		Retries:    6,
+		AckDelay:   20 * time.Millisecond,
+	}
+}
+
+// LinkStats counts link activity since the link was created
+type LinkStats = reliable.Stats
+
+// Link is one end of an acknowledged data link over a hopping radio.
+// It is a reliable.Link whose messages go out with FHSS_XMIT, so the
+// firmware sends them on the current channel of the hop sequence; both
+// ends must be hopping in step, as master and synched client. The wait
+// for an ACK doubles with each retransmission, giving a lost frame a few
+// hops to get through. Write and Read make the link an io.ReadWriter:
+// Write splits its data into messages and Read returns them in order.
+// A Link is not safe for concurrent use
+type Link struct {
+	*reliable.Link
+	readTimeout time.Duration
+	partial     []byte // Rest of a message a short Read didn't take
+}
+
+// NewLink creates a link over a hopping FHSS controller; nil opts uses
+// DefaultLinkOptions
+func NewLink(fh *FHSS, opts *LinkOptions) *Link {
+	if opts == nil {
+		opts = DefaultLinkOptions()
+	}
+	return &Link{
+		Link: reliable.New(fh.device, &reliable.Options{
+			AckTimeout: opts.AckTimeout,
+			MaxBackoff: opts.MaxBackoff,
+			Retries:    opts.Retries,
+			AckDelay:   opts.AckDelay,
+			Transmit:   fh.Transmit,
+			MaxFrame:   yardstick.FHSSMaxTXMsgLen,
+		}),
+		readTimeout: opts.ReadTimeout,
+	}
+}
+
+// Write sends p as one or more messages, each acknowledged before the
+// next goes out
+func (l *Link) Write(p []byte) (int, error) {
+	sent := 0
+	for sent < len(p) {
+		n := min(len(p)-sent, l.MaxPayload())
+		if err := l.Send(p[sent : sent+n]); err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return sent, nil
+}
+
+// Read returns the data of the next message, or what is left of one p
+// was too short for, waiting up to ReadTimeout
+func (l *Link) Read(p []byte) (int, error) {
+	if len(l.partial) == 0 {
+		timeout := l.readTimeout
+		if timeout <= 0 {
+			timeout = time.Duration(1<<63 - 1)
+		}
+		msg, err := l.Recv(timeout)
+		if err != nil {
+			return 0, err
+		}
+		l.partial = msg
+	}
+	n := copy(p, l.partial)
+	l.partial = l.partial[n:]
+	return n, nil
+}
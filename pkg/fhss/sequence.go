@@ -0,0 +1,243 @@
+package fhss
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Hop sequence patterns
+const (
+	PatternLinear = "linear" // 0, 1, 2, ...
+	PatternLFSR   = "lfsr"   // Pseudo-random from a seeded LFSR
+	PatternPrime  = "prime"  // Fixed prime stride through the channels
+	PatternFCC    = "fcc"    // Pseudo-random, checked against FCC 15.247
+)
+
+// Patterns lists the hop sequence patterns
+var Patterns = []string{PatternLinear, PatternLFSR, PatternPrime, PatternFCC}
+
+// MaxSequenceChannels is the number of distinct channels a sequence can
+// use: channels are CHANNR values
+const MaxSequenceChannels = 256
+
+// FCC 15.247(a)(1)(i) limits for frequency hoppers in 902-928 MHz
+const (
+	FCCBandLowHz           = 902000000
+	FCCBandHighHz          = 928000000
+	FCCMinChannels         = 50     // 20 dB bandwidth below 250 kHz
+	FCCMinChannelsWide     = 25     // 20 dB bandwidth 250 kHz or more
+	FCCWideBandwidthHz     = 250000 // Where the wide rules start
+	FCCMaxBandwidthHz      = 500000
+	FCCMinSeparationHz     = 25000 // Or the 20 dB bandwidth, if larger
+	FCCMaxOccupancy        = 400 * time.Millisecond
+	FCCOccupancyWindow     = 20 * time.Second // 10 s for wide channels
+	FCCOccupancyWindowWide = 10 * time.Second
+)
+
+// ValidateSequence checks that a hop sequence fits the firmware
+func ValidateSequence(channels []uint8) error {
+	if len(channels) < 2 {
+		return fmt.Errorf("hop sequence needs at least 2 entries, got %d", len(channels))
+	}
+	if len(channels) > yardstick.FHSSMaxChannels {
+		return fmt.Errorf("hop sequence too long: %d > %d", len(channels), yardstick.FHSSMaxChannels)
+	}
+	return nil
+}
+
+// checkChannels checks the channel count a generator is asked for
+func checkChannels(n int) error {
+	if n < 2 || n > MaxSequenceChannels {
+		return fmt.Errorf("channels must be 2-%d, got %d", MaxSequenceChannels, n)
+	}
+	return nil
+}
+
+// LinearSequence returns channels 0 to n-1 in order
+func LinearSequence(n int) ([]uint8, error) {
+	if err := checkChannels(n); err != nil {
+		return nil, err
+	}
+	seq := make([]uint8, n)
+	for i := range seq {
+		seq[i] = uint8(i)
+	}
+	return seq, nil
+}
+
+// lfsrTaps are Galois feedback masks of maximal-length LFSRs by width
+var lfsrTaps = map[int]uint16{
+	2: 0x3, 3: 0x6, 4: 0xC, 5: 0x14, 6: 0x30, 7: 0x60, 8: 0xB8, 9: 0x110,
+}
+
+// LFSRSequence returns each of channels 0 to n-1 once, in the order of a
+// maximal-length LFSR just wide enough for n, started at seed. Both ends
+// of a link derive the same sequence from the same seed
+func LFSRSequence(n int, seed uint16) ([]uint8, error) {
+	if err := checkChannels(n); err != nil {
+		return nil, err
+	}
+	width := 2
+	for 1<<width-1 < n {
+		width++
+	}
+	period := uint16(1<<width - 1)
+	taps := lfsrTaps[width]
+
+	// The LFSR runs through 1..period; states beyond n are skipped
+	state := seed%period + 1
+	seq := make([]uint8, 0, n)
+	for len(seq) < n {
+		if int(state) <= n {
+			seq = append(seq, uint8(state-1))
+		}
+		lsb := state & 1
+		state >>= 1
+		if lsb != 0 {
+			state ^= taps
+		}
+	}
+	return seq, nil
+}
+
+// PrimeStrideSequence returns each of channels 0 to n-1 once, stepping
+// stride channels at a time modulo n. stride must be a prime that does
+// not divide n; 0 picks the smallest such prime above the square root
+// of n, which keeps consecutive hops well apart
+func PrimeStrideSequence(n, stride int) ([]uint8, error) {
+	if err := checkChannels(n); err != nil {
+		return nil, err
+	}
+	if stride == 0 {
+		stride = 2
+		for stride*stride <= n || n%stride == 0 || !isPrime(stride) {
+			stride++
+		}
+	}
+	if !isPrime(stride) {
+		return nil, fmt.Errorf("stride %d is not prime", stride)
+	}
+	if n%stride == 0 {
+		return nil, fmt.Errorf("stride %d divides %d channels, so it would not reach them all", stride, n)
+	}
+	seq := make([]uint8, n)
+	for i := range seq {
+		seq[i] = uint8(i * stride % n)
+	}
+	return seq, nil
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FCCPlan is a frequency hopper in the 902-928 MHz band, as FCC 15.247
+// sees it
+type FCCPlan struct {
+	BaseHz      uint32        // Frequency of channel 0
+	SpacingHz   uint32        // Between channel numbers
+	BandwidthHz uint32        // 20 dB bandwidth of the transmissions
+	Dwell       time.Duration // Time on each hop
+}
+
+// MinChannels returns the number of channels the plan's bandwidth needs
+func (p *FCCPlan) MinChannels() int {
+	if p.BandwidthHz >= FCCWideBandwidthHz {
+		return FCCMinChannelsWide
+	}
+	return FCCMinChannels
+}
+
+// Sequence returns a pseudo-random sequence over n channels, as
+// LFSRSequence, after checking it against the plan
+func (p *FCCPlan) Sequence(n int, seed uint16) ([]uint8, error) {
+	seq, err := LFSRSequence(n, seed)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Check(seq); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+// Check checks a sequence against 15.247(a)(1) for the plan: channel
+// bandwidth and separation, every channel inside the band, enough
+// channels, each used equally, and no channel occupied for more than
+// 400 ms in any 20 s (10 s for wide channels)
+func (p *FCCPlan) Check(seq []uint8) error {
+	if err := ValidateSequence(seq); err != nil {
+		return err
+	}
+	if p.BandwidthHz == 0 || p.BandwidthHz > FCCMaxBandwidthHz {
+		return fmt.Errorf("20 dB bandwidth must be 1-%d kHz, got %.1f kHz", FCCMaxBandwidthHz/1000, float64(p.BandwidthHz)/1e3)
+	}
+	if minSep := max(uint32(FCCMinSeparationHz), p.BandwidthHz); p.SpacingHz < minSep {
+		return fmt.Errorf("channel spacing %.1f kHz is below the %.1f kHz minimum", float64(p.SpacingHz)/1e3, float64(minSep)/1e3)
+	}
+
+	uses := make(map[uint8]int)
+	for _, ch := range seq {
+		uses[ch]++
+		freq := uint64(p.BaseHz) + uint64(ch)*uint64(p.SpacingHz)
+		low, high := freq-uint64(p.BandwidthHz/2), freq+uint64(p.BandwidthHz/2)
+		if low < FCCBandLowHz || high > FCCBandHighHz {
+			return fmt.Errorf("channel %d at %.3f MHz is outside %d-%d MHz", ch, float64(freq)/1e6, FCCBandLowHz/1000000, FCCBandHighHz/1000000)
+		}
+	}
+	if len(uses) < p.MinChannels() {
+		return fmt.Errorf("%d channels, need at least %d at %.0f kHz bandwidth", len(uses), p.MinChannels(), float64(p.BandwidthHz)/1e3)
+	}
+	for ch, n := range uses {
+		if n != uses[seq[0]] {
+			return fmt.Errorf("channel %d is used %d times, channel %d %d times; all must be used equally", ch, n, seq[0], uses[seq[0]])
+		}
+	}
+
+	if p.Dwell > 0 {
+		window := FCCOccupancyWindow
+		if p.BandwidthHz >= FCCWideBandwidthHz {
+			window = FCCOccupancyWindowWide
+		}
+		if occ := time.Duration(worstOccupancy(seq, int(window/p.Dwell))) * p.Dwell; occ > FCCMaxOccupancy {
+			return fmt.Errorf("a channel is occupied for %v in %v, above %v", occ, window, FCCMaxOccupancy)
+		}
+	}
+	return nil
+}
+
+// worstOccupancy returns the most hops any channel gets in a run of
+// hops consecutive hops of the repeating sequence
+func worstOccupancy(seq []uint8, hops int) int {
+	full, rest := hops/len(seq), hops%len(seq)
+	perPass := make(map[uint8]int)
+	for _, ch := range seq {
+		perPass[ch]++
+	}
+	// Slide a window of the remaining hops around the sequence
+	count := make(map[uint8]int)
+	for i := 0; i < rest; i++ {
+		count[seq[i]]++
+	}
+	worst := 0
+	for ch, n := range perPass {
+		worst = max(worst, full*n+count[ch])
+	}
+	for start := 1; start < len(seq) && rest > 0; start++ {
+		count[seq[start-1]]--
+		ch := seq[(start+rest-1)%len(seq)]
+		count[ch]++
+		worst = max(worst, full*perPass[ch]+count[ch])
+	}
+	return worst
+}
@@ -0,0 +1,328 @@
+package fhss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Sniffer defaults
+const (
+	DefaultSniffDwell     = 100 * time.Millisecond
+	DefaultSniffMaxMisses = 3
+)
+
+// SniffedPacket is a packet of a third-party hopper
+type SniffedPacket struct {
+	Time        time.Time `json:"time"`
+	FrequencyHz uint32    `json:"frequency_hz"`
+	Slot        int       `json:"slot"` // Hops since the sniffer caught the hopper
+	RSSI        float32   `json:"rssi_dbm"`
+	Data        []byte    `json:"data"`
+}
+
+// SnifferStats counts what a Sniffer has seen
+type SnifferStats struct {
+	Packets    int `json:"packets"`
+	Duplicates int `json:"duplicates"` // The same frame again within a hop
+	Syncs      int `json:"syncs"`      // Times the hopper was caught while camping
+	Follows    int `json:"follows"`    // Hops predicted and heard
+	Misses     int `json:"misses"`     // Hops predicted and not heard
+	Learned    int `json:"learned"`    // Channel successors found
+}
+
+// Sniffer follows a frequency hopper it does not control. It camps on
+// one channel of the hopper until it hears a packet there, which gives
+// it the hopper's timing, then retunes to the next channel of the
+// sequence at every Dwell. When the order of Channels isn't known it is
+// learned: after each catch the sniffer tries one candidate for the next
+// channel and keeps the one it hears the hopper on. A hop that
+// brings nothing is a miss; after MaxMisses in a row, or a wrong guess,
+// it goes back to camping. Packets heard again within a hop, as hoppers
+// that repeat frames send them, are dropped, so Run delivers each frame
+// once and in order. USB latency limits it to dwell times of tens of ms
+type Sniffer struct {
+	Channels  []uint32      // The hopper's frequencies
+	Ordered   bool          // Channels are in hop order
+	Dwell     time.Duration // Time the hopper spends on each channel
+	MaxMisses int           // Missed hops in a row before camping again
+
+	device *yardstick.Device
+	next   []int          // Successor of each channel index, -1 while unknown
+	tried  []map[int]bool // Candidates tried as successor of each channel
+	stats  SnifferStats
+}
+
+// NewSniffer creates a sniffer of a hopper over channels on device; the
+// device must already have the hopper's modulation, data rate and sync
+// word. ordered says the channels are in hop order
+func NewSniffer(device *yardstick.Device, channels []uint32, ordered bool, dwell time.Duration) *Sniffer {
+	return &Sniffer{
+		Channels:  append([]uint32(nil), channels...),
+		Ordered:   ordered,
+		Dwell:     dwell,
+		MaxMisses: DefaultSniffMaxMisses,
+		device:    device,
+	}
+}
+
+// NewSnifferFromHopper creates a sniffer from a hopper rf-scanner
+// detected: its channels, in unknown order, and a dwell from its hop
+// rate. The scanner's hop rate is a lower bound, so the dwell may need
+// shortening
+func NewSnifferFromHopper(device *yardstick.Device, sig *scanner.FHSSSignal) *Sniffer {
+	dwell := DefaultSniffDwell
+	if sig.HopRateHz > 0 {
+		dwell = time.Duration(float64(time.Second) / sig.HopRateHz)
+	}
+	return NewSniffer(device, sig.Channels, false, dwell)
+}
+
+// Validate checks the sniffer's settings
+func (s *Sniffer) Validate() error {
+	if len(s.Channels) < 2 {
+		return fmt.Errorf("sniffer needs at least 2 channels, got %d", len(s.Channels))
+	}
+	if s.Dwell <= 0 {
+		return fmt.Errorf("dwell time must be positive")
+	}
+	return nil
+}
+
+// Stats returns the sniffer counters
+func (s *Sniffer) Stats() SnifferStats {
+	return s.stats
+}
+
+// Sequence returns the hop order learned so far, starting from the first
+// channel: it stops at the first channel whose successor is unknown
+func (s *Sniffer) Sequence() []uint32 {
+	if s.next == nil {
+		return nil
+	}
+	seq := []uint32{s.Channels[0]}
+	for i := s.next[0]; i > 0 && len(seq) < len(s.Channels); i = s.next[i] {
+		seq = append(seq, s.Channels[i])
+	}
+	return seq
+}
+
+// Run follows the hopper until ctx is done or fn returns an error
+func (s *Sniffer) Run(ctx context.Context, fn func(*SniffedPacket) error) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	n := len(s.Channels)
+	s.next = make([]int, n)
+	s.tried = make([]map[int]bool, n)
+	for i := range s.next {
+		s.next[i] = -1
+		if s.Ordered {
+			s.next[i] = (i + 1) % n
+		}
+		s.tried[i] = make(map[int]bool)
+	}
+
+	lease, err := s.device.Acquire(yardstick.ModeRX, "fhss-sniff")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	// Retuning and mode changes go through the lease while it is held
+	device := s.device
+	s.device = lease.Device()
+	defer func() { s.device = device }()
+	defer s.device.StrobeModeIDLE()
+
+	// The channels are absolute frequencies
+	if err := registers.Poke(s.device, registers.RegCHANNR, 0); err != nil {
+		return fmt.Errorf("failed to reset CHANNR: %w", err)
+	}
+	if _, err := s.device.Precalibrate(s.Channels); err != nil {
+		return err
+	}
+	if err := s.device.SetModeRX(); err != nil {
+		return fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+
+	camp := 0
+	for ctx.Err() == nil {
+		// Camp until the hopper comes by; it visits every channel once a
+		// cycle, so a cycle on one channel is enough
+		pkt, err := s.camp(ctx, camp)
+		if err != nil {
+			return err
+		}
+		if pkt == nil {
+			camp = (camp + 1) % n
+			continue
+		}
+		s.stats.Syncs++
+		var prev []byte
+		if err := s.deliver(pkt, &prev, fn); err != nil {
+			return err
+		}
+		if err := s.follow(ctx, camp, pkt.Time, prev, fn); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// camp listens on channel index ch for a cycle of the hopper and returns
+// the first packet, or nil
+func (s *Sniffer) camp(ctx context.Context, ch int) (*SniffedPacket, error) {
+	if err := s.device.Retune(s.Channels[ch]); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(time.Duration(len(s.Channels)) * s.Dwell)
+	for ctx.Err() == nil && time.Now().Before(deadline) {
+		pkt, err := s.listen(ch, time.Until(deadline), 0)
+		if err != nil || pkt != nil {
+			return pkt, err
+		}
+	}
+	return nil, nil
+}
+
+// follow hops after the hopper from channel index cur, whose hop began
+// around slotStart with the frame prev; hoppers transmit early in a hop,
+// so the first packet marks its start. It returns when the hopper is lost
+func (s *Sniffer) follow(ctx context.Context, cur int, slotStart time.Time, prev []byte, fn func(*SniffedPacket) error) error {
+	misses := 0
+	slot := 0
+	for ctx.Err() == nil {
+		cand, guess := s.next[cur], false
+		if cand < 0 {
+			if cand = s.candidate(cur); cand < 0 {
+				return nil
+			}
+			guess = true
+		}
+
+		// Listen on the rest of the current hop, then move on
+		hopEnd := slotStart.Add(s.Dwell)
+		for time.Now().Before(hopEnd) {
+			pkt, err := s.listen(cur, time.Until(hopEnd), slot)
+			if err != nil {
+				return err
+			}
+			if pkt != nil {
+				if err := s.deliver(pkt, &prev, fn); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := s.device.Retune(s.Channels[cand]); err != nil {
+			return err
+		}
+		slot++
+		slotStart = hopEnd
+		prev = nil
+
+		// Only the first half of the hop counts: a packet later than that
+		// may already be the start of the hop after
+		var heard *SniffedPacket
+		for end := slotStart.Add(s.Dwell / 2); heard == nil && time.Now().Before(end); {
+			pkt, err := s.listen(cand, time.Until(end), slot)
+			if err != nil {
+				return err
+			}
+			heard = pkt
+		}
+		if heard == nil {
+			s.stats.Misses++
+			if guess {
+				return nil
+			}
+			misses++
+			if misses >= s.MaxMisses {
+				return nil
+			}
+			cur = cand
+			continue
+		}
+
+		misses = 0
+		slotStart = heard.Time
+		s.stats.Follows++
+		if guess {
+			s.next[cur] = cand
+			s.stats.Learned++
+		}
+		if err := s.deliver(heard, &prev, fn); err != nil {
+			return err
+		}
+		cur = cand
+	}
+	return nil
+}
+
+// candidate returns the next untried successor for channel index cur,
+// starting over once all have been tried; -1 with only one channel
+func (s *Sniffer) candidate(cur int) int {
+	n := len(s.Channels)
+	if len(s.tried[cur]) >= n-1 {
+		clear(s.tried[cur])
+	}
+	for i := 1; i < n; i++ {
+		c := (cur + i) % n
+		if !s.tried[cur][c] && !s.taken(c) {
+			s.tried[cur][c] = true
+			return c
+		}
+	}
+	for i := 1; i < n; i++ {
+		if c := (cur + i) % n; !s.tried[cur][c] {
+			s.tried[cur][c] = true
+			return c
+		}
+	}
+	return -1
+}
+
+// taken reports whether channel index c is already known to follow some
+// channel, which makes it an unlikely successor of another
+func (s *Sniffer) taken(c int) bool {
+	for _, next := range s.next {
+		if next == c {
+			return true
+		}
+	}
+	return false
+}
+
+// listen waits up to timeout for a packet on channel index ch; nil when
+// none came
+func (s *Sniffer) listen(ch int, timeout time.Duration, slot int) (*SniffedPacket, error) {
+	if timeout <= 0 {
+		return nil, nil
+	}
+	data, err := s.device.RFRecv(timeout, 0)
+	if err != nil || len(data) == 0 {
+		// Timeout is normal
+		return nil, nil
+	}
+	pkt := &SniffedPacket{Time: time.Now(), FrequencyHz: s.Channels[ch], Slot: slot, Data: data}
+	if raw, err := s.device.GetRSSI(); err == nil {
+		pkt.RSSI = float32(yardstick.RSSIToDBm(raw))
+	}
+	return pkt, nil
+}
+
+// deliver passes pkt to fn unless it repeats the hop's previous frame
+func (s *Sniffer) deliver(pkt *SniffedPacket, prev *[]byte, fn func(*SniffedPacket) error) error {
+	if *prev != nil && bytes.Equal(pkt.Data, *prev) {
+		s.stats.Duplicates++
+		return nil
+	}
+	*prev = pkt.Data
+	s.stats.Packets++
+	return fn(pkt)
+}
@@ -0,0 +1,204 @@
+package fhss
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// beaconPrefix starts every beacon payload; the beacon number follows
+const beaconPrefix = "BEACON:"
+
+// Beacon returns the payload of the master's beacon number n
+func Beacon(n int) []byte {
+	return []byte(fmt.Sprintf("%s%06d", beaconPrefix, n))
+}
+
+// ParseBeacon returns the number of the beacon in data, which may carry
+// a length byte or status bytes around it; false if it isn't a beacon
+func ParseBeacon(data []byte) (int, bool) {
+	i := bytes.Index(data, []byte(beaconPrefix))
+	if i < 0 {
+		return 0, false
+	}
+	digits := data[i+len(beaconPrefix):]
+	end := 0
+	for end < len(digits) && digits[end] >= '0' && digits[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(string(digits[:end]))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// ChannelStats is the beacon reception on one channel of the sequence
+type ChannelStats struct {
+	Channel uint8   `json:"channel"`
+	Beacons int     `json:"beacons"`
+	RSSI    float32 `json:"rssi_dbm"` // Average
+	MinRSSI float32 `json:"min_rssi_dbm"`
+	MaxRSSI float32 `json:"max_rssi_dbm"`
+}
+
+// Stats is the health of a hopping link as its client sees it
+type Stats struct {
+	Since       time.Time      `json:"since"`
+	State       string         `json:"state"`
+	Synched     bool           `json:"synched"`
+	Beacons     int            `json:"beacons"`      // Beacons received
+	LostBeacons int            `json:"lost_beacons"` // Gaps in the beacon numbers
+	Hops        int            `json:"hops"`         // Hops made while synched
+	MissedHops  int            `json:"missed_hops"`  // Hops without a beacon
+	DriftMs     int64          `json:"drift_ms"`     // Latest beacon's offset from the master's schedule, + for late
+	MaxDriftMs  int64          `json:"max_drift_ms"` // Largest offset either way since the last sync
+	SyncLosses  int            `json:"sync_losses"`
+	Resyncs     int            `json:"resyncs"` // Syncs after a loss
+	Channels    []ChannelStats `json:"channels,omitempty"`
+}
+
+// BeaconRate returns the share of hops that brought a beacon, 0-1
+func (s *Stats) BeaconRate() float64 {
+	if s.Hops == 0 {
+		return 0
+	}
+	return float64(s.Hops-s.MissedHops) / float64(s.Hops)
+}
+
+// String is a one-line summary
+func (s *Stats) String() string {
+	return fmt.Sprintf("%s, %d beacons (%d lost), %d/%d hops missed, drift %d ms (max %d), %d resyncs",
+		s.State, s.Beacons, s.LostBeacons, s.MissedHops, s.Hops, s.DriftMs, s.MaxDriftMs, s.Resyncs)
+}
+
+// channelAcc accumulates one channel's beacon RSSI
+type channelAcc struct {
+	ChannelStats
+	sum float64
+}
+
+// Monitor follows a hopping link on the client side, from the MAC data
+// it is given on each poll and the beacons it receives. A hop counts as
+// missed when no beacon arrived on it; drift is how far beacons arrive
+// from the schedule the first beacon after a sync sets, one every Dwell.
+// A Monitor is not safe for concurrent use
+type Monitor struct {
+	Dwell time.Duration // The master's beacon interval
+
+	channels []uint8 // The hop sequence
+	stats    Stats
+	per      map[uint8]*channelAcc
+	polled   bool
+	hops     uint16 // NumChannelHops at the last poll
+	chanIdx  uint16 // CurChanIdx at the last poll
+	heard    bool   // A beacon arrived since the last hop
+	synched  bool   // Synched once, so the next sync is a resync
+
+	refTime time.Time // First beacon since the last sync
+	refSeq  int
+	lastSeq int
+}
+
+// NewMonitor creates a monitor for a link hopping over channels with
+// beacons every dwell
+func NewMonitor(channels []uint8, dwell time.Duration) *Monitor {
+	return &Monitor{
+		Dwell:    dwell,
+		channels: append([]uint8(nil), channels...),
+		stats:    Stats{Since: time.Now()},
+		per:      make(map[uint8]*channelAcc),
+	}
+}
+
+// SetChannels changes the hop sequence, as when adaptive hopping takes
+// channels out; the figures for each channel so far are kept
+func (m *Monitor) SetChannels(channels []uint8) {
+	m.channels = append([]uint8(nil), channels...)
+}
+
+// Update takes the MAC data of a poll
+func (m *Monitor) Update(md *MACData) {
+	synched := md.State == MACState(yardstick.MACStateSynched)
+	switch {
+	case synched && !m.stats.Synched:
+		if m.synched {
+			m.stats.Resyncs++
+		}
+		m.synched = true
+		m.stats.DriftMs, m.stats.MaxDriftMs = 0, 0
+		m.refTime = time.Time{}
+	case !synched && m.stats.Synched:
+		m.stats.SyncLosses++
+	}
+
+	if m.polled && synched && m.stats.Synched {
+		// The counter wraps; a jump back is the MAC starting over
+		if n := int(md.NumChannelHops - m.hops); n > 0 && n < 1<<15 {
+			m.stats.Hops += n
+			if m.heard {
+				n--
+			}
+			m.stats.MissedHops += n
+			m.heard = false
+		}
+	}
+	m.polled = true
+	m.hops = md.NumChannelHops
+	m.chanIdx = md.CurChanIdx
+	m.stats.State = md.State.String()
+	m.stats.Synched = synched
+}
+
+// Beacon takes beacon number seq, received at at with rssi on the
+// channel the last Update was on
+func (m *Monitor) Beacon(at time.Time, seq int, rssi float32) {
+	m.stats.Beacons++
+	m.heard = true
+
+	if m.stats.Beacons > 1 && seq > m.lastSeq+1 {
+		m.stats.LostBeacons += seq - m.lastSeq - 1
+	}
+	m.lastSeq = seq
+
+	if m.refTime.IsZero() || seq < m.refSeq {
+		m.refTime, m.refSeq = at, seq
+	}
+	if m.Dwell > 0 {
+		drift := at.Sub(m.refTime) - time.Duration(seq-m.refSeq)*m.Dwell
+		m.stats.DriftMs = drift.Milliseconds()
+		if abs := max(m.stats.DriftMs, -m.stats.DriftMs); abs > max(m.stats.MaxDriftMs, -m.stats.MaxDriftMs) {
+			m.stats.MaxDriftMs = m.stats.DriftMs
+		}
+	}
+
+	if len(m.channels) == 0 {
+		return
+	}
+	ch := m.channels[int(m.chanIdx)%len(m.channels)]
+	acc := m.per[ch]
+	if acc == nil {
+		acc = &channelAcc{ChannelStats: ChannelStats{Channel: ch, MinRSSI: rssi, MaxRSSI: rssi}}
+		m.per[ch] = acc
+	}
+	acc.Beacons++
+	acc.sum += float64(rssi)
+	acc.RSSI = float32(acc.sum / float64(acc.Beacons))
+	acc.MinRSSI = min(acc.MinRSSI, rssi)
+	acc.MaxRSSI = max(acc.MaxRSSI, rssi)
+}
+
+// Stats returns the link statistics, channels by number
+func (m *Monitor) Stats() Stats {
+	s := m.stats
+	s.Channels = make([]ChannelStats, 0, len(m.per))
+	for _, acc := range m.per {
+		s.Channels = append(s.Channels, acc.ChannelStats)
+	}
+	sort.Slice(s.Channels, func(i, j int) bool { return s.Channels[i].Channel < s.Channels[j].Channel })
+	return s
+}
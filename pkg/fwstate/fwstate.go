@@ -0,0 +1,213 @@
+// Package fwstate reads and decodes firmware runtime state from a
+// YardStick One: radio state machine, RF interrupt flags, the last error
+// codes recorded by the USB and RF handlers, the FHSS MAC structure and
+// any firmware variables listed in a per-build symbol table
+package fwstate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/fhss"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// XDATA mirrors of the RF interrupt SFRs
+const (
+	RegRFIF = 0xDFE9
+	RegRFIM = 0xDF91
+)
+
+// RFIF bit names, most significant bit first
+var rfifBits = [8]string{"TXUNF", "RXOVF", "TIMEOUT", "DONE", "CS", "PQT", "CCA", "SFD"}
+
+// State is a snapshot of firmware state
+type State struct {
+	Build     string            `json:"build"`
+	MARCState uint8             `json:"marcstate"`
+	Radio     string            `json:"radio_state"`
+	PktStatus uint8             `json:"pktstatus"`
+	RFIF      uint8             `json:"rfif"`
+	RFIFFlags []string          `json:"rfif_flags"`
+	RFIM      uint8             `json:"rfim"`
+	LastCodes [2]uint8          `json:"last_codes"`
+	LastError string            `json:"last_error"`
+	MAC       *MAC              `json:"fhss_mac,omitempty"`
+	Variables []Variable        `json:"variables,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// MAC is the decoded FHSS MAC structure
+type MAC struct {
+	State          string `json:"state"`
+	TxMsgIdx       uint8  `json:"tx_msg_idx"`
+	TxMsgIdxDone   uint8  `json:"tx_msg_idx_done"`
+	CurChanIdx     uint16 `json:"cur_chan_idx"`
+	NumChannels    uint16 `json:"num_channels"`
+	NumChannelHops uint16 `json:"num_channel_hops"`
+	TLastHop       uint16 `json:"t_last_hop"`
+	TLastChange    uint32 `json:"t_last_state_change"`
+	Threshold      uint32 `json:"mac_threshold"`
+	Timer          uint32 `json:"mac_timer"`
+	Seeking        uint16 `json:"desperately_seeking"`
+	SynchedChans   uint16 `json:"synched_chans"`
+}
+
+// Read collects a state snapshot. Radio registers and debug codes are
+// required; the FHSS MAC data and symbol table variables are best effort
+// and failures are recorded in State.Errors. syms may be nil
+func Read(device *yardstick.Device, syms *SymbolTable) (*State, error) {
+	s := &State{Errors: map[string]string{}}
+
+	build, err := device.GetBuildType()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build type: %w", err)
+	}
+	s.Build = build
+
+	if s.MARCState, err = device.GetMARCSTATE(); err != nil {
+		return nil, fmt.Errorf("failed to read MARCSTATE: %w", err)
+	}
+	s.Radio = registers.RadioState(s.MARCState).String()
+
+	if s.PktStatus, err = device.GetPKTSTATUS(); err != nil {
+		return nil, fmt.Errorf("failed to read PKTSTATUS: %w", err)
+	}
+	if s.RFIF, err = device.PeekByte(RegRFIF); err != nil {
+		return nil, fmt.Errorf("failed to read RFIF: %w", err)
+	}
+	s.RFIFFlags = RFIFFlags(s.RFIF)
+	if s.RFIM, err = device.PeekByte(RegRFIM); err != nil {
+		return nil, fmt.Errorf("failed to read RFIM: %w", err)
+	}
+
+	code0, code1, err := device.GetDebugCodes()
+	if err != nil {
+		return nil, err
+	}
+	s.LastCodes = [2]uint8{code0, code1}
+	s.LastError = LastCodeName(code1)
+
+	if mac, err := fhss.New(device).GetMACData(); err != nil {
+		s.Errors["fhss_mac"] = err.Error()
+	} else {
+		s.MAC = &MAC{
+			State:          mac.State.String(),
+			TxMsgIdx:       mac.TxMsgIdx,
+			TxMsgIdxDone:   mac.TxMsgIdxDone,
+			CurChanIdx:     mac.CurChanIdx,
+			NumChannels:    mac.NumChannels,
+			NumChannelHops: mac.NumChannelHops,
+			TLastHop:       mac.TLastHop,
+			TLastChange:    mac.TLastStateChange,
+			Threshold:      mac.MACThreshold,
+			Timer:          mac.MACTimer,
+			Seeking:        mac.DesperatelySeeking,
+			SynchedChans:   mac.SynchedChans,
+		}
+	}
+
+	if syms != nil {
+		vars, ok := syms.Build(build)
+		if !ok {
+			s.Errors["variables"] = fmt.Sprintf("no symbols for build '%s'", build)
+		}
+		for _, v := range vars {
+			data, err := device.Peek(v.Address, v.Size)
+			if err != nil {
+				s.Errors[v.Name] = err.Error()
+				continue
+			}
+			v.Value = hex.EncodeToString(data)
+			s.Variables = append(s.Variables, v)
+		}
+	}
+
+	if len(s.Errors) == 0 {
+		s.Errors = nil
+	}
+	return s, nil
+}
+
+// RFIFFlags returns the names of the bits set in an RFIF value
+func RFIFFlags(rfif uint8) []string {
+	flags := []string{}
+	for i, name := range rfifBits {
+		if rfif&(0x80>>i) != 0 {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// LastCodeName returns the name of a firmware LCE_* error code
+func LastCodeName(code uint8) string {
+	switch code {
+	case yardstick.LCENoError:
+		return "none"
+	case yardstick.LCEUSBEP5TXWhileInbufWritten:
+		return "USB EP5 TX while IN buffer written"
+	case yardstick.LCEUSBEP0SentStall:
+		return "USB EP0 sent stall"
+	case yardstick.LCEUSBEP5OutWhileOutbufWritten:
+		return "USB EP5 OUT while OUT buffer written"
+	case yardstick.LCEUSBEP5LenTooBig:
+		return "USB EP5 length too big"
+	case yardstick.LCEUSBEP5GotCrap:
+		return "USB EP5 bad data"
+	case yardstick.LCEUSBEP5Stall:
+		return "USB EP5 stall"
+	case yardstick.LCERFRXOverflow:
+		return "RF RX overflow"
+	case yardstick.LCERFTXUnderflow:
+		return "RF TX underflow"
+	default:
+		return fmt.Sprintf("unknown (0x%02X)", code)
+	}
+}
+
+// String formats the snapshot for display
+func (s *State) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Build:      %s\n", s.Build)
+	fmt.Fprintf(&b, "MARCSTATE:  0x%02X (%s)\n", s.MARCState, s.Radio)
+	fmt.Fprintf(&b, "PKTSTATUS:  0x%02X\n", s.PktStatus)
+	fmt.Fprintf(&b, "RFIF:       0x%02X %s\n", s.RFIF, strings.Join(s.RFIFFlags, " "))
+	fmt.Fprintf(&b, "RFIM:       0x%02X\n", s.RFIM)
+	fmt.Fprintf(&b, "Last codes: 0x%02X 0x%02X (%s)\n", s.LastCodes[0], s.LastCodes[1], s.LastError)
+
+	if s.MAC != nil {
+		fmt.Fprintf(&b, "\nFHSS MAC:\n")
+		fmt.Fprintf(&b, "  State:        %s\n", s.MAC.State)
+		fmt.Fprintf(&b, "  TX msg idx:   %d (done %d)\n", s.MAC.TxMsgIdx, s.MAC.TxMsgIdxDone)
+		fmt.Fprintf(&b, "  Channel:      %d of %d\n", s.MAC.CurChanIdx, s.MAC.NumChannels)
+		fmt.Fprintf(&b, "  Channel hops: %d\n", s.MAC.NumChannelHops)
+		fmt.Fprintf(&b, "  T last hop:   %d\n", s.MAC.TLastHop)
+		fmt.Fprintf(&b, "  T last state: %d\n", s.MAC.TLastChange)
+		fmt.Fprintf(&b, "  Threshold:    %d (timer %d)\n", s.MAC.Threshold, s.MAC.Timer)
+		fmt.Fprintf(&b, "  Seeking:      %d, %d channels synched\n", s.MAC.Seeking, s.MAC.SynchedChans)
+	}
+
+	if len(s.Variables) > 0 {
+		fmt.Fprintf(&b, "\nVariables:\n")
+		for _, v := range s.Variables {
+			fmt.Fprintf(&b, "  %-20s 0x%04X  %s\n", v.Name, v.Address, v.Value)
+		}
+	}
+
+	names := make([]string, 0, len(s.Errors))
+	for name := range s.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "\nUnavailable:\n")
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-20s %s\n", name, s.Errors[name])
+	}
+	return b.String()
+}
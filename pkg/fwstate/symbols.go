@@ -0,0 +1,76 @@
+package fwstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Firmware variables such as rf_status live at XDATA addresses assigned by
+// the linker, so they move between firmware builds. A symbol table maps
+// each build string (as reported by GetBuildType) to the addresses taken
+// from that build's .map file:
+//
+//	{
+//	  "YARDSTICKONE r0543": {
+//	    "rf_status": {"address": "0xF4A2", "size": 1},
+//	    "rfif":      {"address": "0xF4A3", "size": 1}
+//	  }
+//	}
+
+// Symbol is the location of a firmware variable
+type Symbol struct {
+	Address string `json:"address"`
+	Size    uint16 `json:"size"`
+}
+
+// Variable is a firmware variable read from the device
+type Variable struct {
+	Name    string `json:"name"`
+	Address uint16 `json:"address"`
+	Size    uint16 `json:"size"`
+	Value   string `json:"value"` // Hex, little-endian as stored
+}
+
+// SymbolTable maps build strings to firmware variables
+type SymbolTable map[string]map[string]Symbol
+
+// LoadSymbols reads a symbol table from a JSON file
+func LoadSymbols(path string) (*SymbolTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbols: %w", err)
+	}
+	var t SymbolTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse symbols: %w", err)
+	}
+	for build, syms := range t {
+		for name, sym := range syms {
+			if _, err := strconv.ParseUint(sym.Address, 0, 16); err != nil {
+				return nil, fmt.Errorf("%s: %s: invalid address '%s'", build, name, sym.Address)
+			}
+			if sym.Size == 0 {
+				return nil, fmt.Errorf("%s: %s: size must be at least 1", build, name)
+			}
+		}
+	}
+	return &t, nil
+}
+
+// Build returns the variables for a firmware build, sorted by address
+func (t *SymbolTable) Build(build string) ([]Variable, bool) {
+	syms, ok := (*t)[build]
+	if !ok {
+		return nil, false
+	}
+	vars := make([]Variable, 0, len(syms))
+	for name, sym := range syms {
+		addr, _ := strconv.ParseUint(sym.Address, 0, 16)
+		vars = append(vars, Variable{Name: name, Address: uint16(addr), Size: sym.Size})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Address < vars[j].Address })
+	return vars, true
+}
@@ -0,0 +1,138 @@
+package identify
+
+import (
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/decoders/keeloq"
+	"github.com/herlein/gocat/pkg/decoders/tpms"
+	"github.com/herlein/gocat/pkg/decoders/weather"
+	"github.com/herlein/gocat/pkg/decoders/wmbus"
+	"github.com/herlein/gocat/pkg/demod"
+	"github.com/herlein/gocat/pkg/princeton"
+)
+
+// Confidence of the built-in decoders, before repeats raise it
+const (
+	lineCodeConfidence = 0.3  // PWM, PPM or Manchester, and nothing more
+	framingConfidence  = 0.8  // Bit count and timing of a known protocol, no checksum
+	checksumConfidence = 0.9  // A known protocol with a passing checksum
+	crcConfidence      = 0.95 // A known protocol with a passing CRC
+	unsummedConfidence = 0.7  // A known protocol without a checksum, heard twice
+)
+
+// shortLineCodeBits is the fewest bits a line code needs to score in full
+const shortLineCodeBits = 12
+
+func init() {
+	Register(NewDecoder("linecode", identifyLineCode))
+	Register(NewDecoder("princeton", identifyPrinceton))
+	Register(NewDecoder("keeloq", identifyKeeLoq))
+	Register(NewDecoder("weather", identifyWeather))
+	Register(NewDecoder("tpms", identifyTPMS))
+	Register(NewDecoder("wmbus", identifyWMBus))
+}
+
+// identifyLineCode reports each frame pkg/demod could classify, scored
+// by the share of widths that fit the line code
+func identifyLineCode(b *Burst) []*Candidate {
+	var out []*Candidate
+	for _, f := range b.Frames() {
+		if f.Encoding == demod.Unknown || len(f.Bits) == 0 {
+			continue
+		}
+		confidence := lineCodeConfidence * (1 - float64(f.Errors)/float64(len(f.Bits)))
+		if len(f.Bits) < shortLineCodeBits {
+			confidence /= 2
+		}
+		out = append(out, &Candidate{
+			Protocol:   string(f.Encoding),
+			Confidence: confidence,
+			Summary:    fmt.Sprintf("%d bits %x", len(f.Bits), f.Bits.Bytes()),
+			Result:     f,
+		})
+	}
+	return out
+}
+
+// identifyPrinceton reports PT2262/EV1527 code words
+func identifyPrinceton(b *Burst) []*Candidate {
+	var out []*Candidate
+	for _, f := range b.Frames() {
+		c, err := princeton.Decode(f)
+		if err != nil {
+			continue
+		}
+		out = append(out, &Candidate{Protocol: string(c.Chip), Confidence: framingConfidence, Summary: c.String(), Result: c})
+	}
+	return out
+}
+
+// identifyKeeLoq reports KeeLoq code words; one after its preamble fits
+// the protocol better
+func identifyKeeLoq(b *Burst) []*Candidate {
+	var out []*Candidate
+	for _, k := range keeloq.DecodeFrames(b.Frames()) {
+		confidence := framingConfidence
+		if k.Preamble {
+			confidence = checksumConfidence
+		}
+		out = append(out, &Candidate{Protocol: "keeloq", Confidence: confidence, Summary: k.String(), Result: k})
+	}
+	return out
+}
+
+// identifyWeather reports weather sensor readings. Nexus readings carry
+// no checksum, so score lower than the others
+func identifyWeather(b *Burst) []*Candidate {
+	var out []*Candidate
+	for _, r := range weather.DecodePulses(b.Timings()) {
+		confidence := checksumConfidence
+		if r.Protocol == weather.Nexus {
+			confidence = unsummedConfidence
+		}
+		out = append(out, &Candidate{Protocol: string(r.Protocol), Confidence: confidence, Summary: r.String(), Result: r})
+	}
+	return out
+}
+
+// identifyTPMS reports tyre pressure sensor frames in raw FSK chips
+func identifyTPMS(b *Burst) []*Candidate {
+	if len(b.Data) == 0 {
+		return nil
+	}
+	var readings []*tpms.Reading
+	if b.SyncWord != 0 {
+		readings = tpms.DecodePacket(b.Data, b.SyncWord)
+	} else {
+		readings = tpms.Decode(b.Data)
+	}
+	var out []*Candidate
+	for _, r := range readings {
+		confidence := checksumConfidence
+		if r.Protocol == tpms.Schrader {
+			confidence = crcConfidence
+		}
+		out = append(out, &Candidate{Protocol: "tpms-" + string(r.Protocol), Confidence: confidence, Summary: r.String(), Result: r})
+	}
+	return out
+}
+
+// identifyWMBus reports a wM-Bus frame in a packet received after one of
+// the wM-Bus sync words
+func identifyWMBus(b *Burst) []*Candidate {
+	var modes []wmbus.Mode
+	switch b.SyncWord {
+	case wmbus.SyncWordS:
+		modes = []wmbus.Mode{wmbus.S1}
+	case wmbus.SyncWordT:
+		modes = []wmbus.Mode{wmbus.T1, wmbus.C1}
+	}
+	for _, mode := range modes {
+		f, err := wmbus.DecodePacket(mode, b.Data)
+		if err != nil {
+			continue
+		}
+		return []*Candidate{{Protocol: "wmbus-" + string(mode), Confidence: crcConfidence, Summary: f.String(), Result: f}}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package identify runs a received burst through every registered
+// decoder and ranks what they recognize
+//
+// Each decoder looks at the burst its own way (line codes, known remote
+// and sensor protocols) and returns candidates with a confidence from 0
+// to 1: a bare line code scores low, a protocol whose framing fits
+// higher, and one whose checksum or CRC checks out highest. The same
+// candidate found in several frames of a burst, as when a remote repeats
+// its code word, is merged and its confidence raised.
+//
+// The built-in decoders are registered in Default. Third-party decoders
+// implement Decoder and are added with Register (or to a registry of
+// their own), after which they take part in every identification.
+package identify
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Burst is one received burst. OOK decoders read its pulse timings,
+// given directly or recovered from raw bits sampled at SampleRate; FSK
+// decoders read the raw bytes, as RFRecv returned them after SyncWord
+type Burst struct {
+	Pulses     []int   // Signed durations in microseconds, the pkg/capture convention
+	Data       []byte  // Raw bytes or bits as received
+	SampleRate float64 // Rate, in baud, Data was received at (0 if unknown)
+	SyncWord   uint16  // Sync word the radio matched and stripped (0 if none)
+
+	frames []*demod.Frame
+	split  bool
+}
+
+// Timings returns the burst's pulse timings, recovering them from Data
+// when none were given and the sample rate is known
+func (b *Burst) Timings() []int {
+	if len(b.Pulses) == 0 && len(b.Data) > 0 && b.SampleRate > 0 {
+		b.Pulses = demod.Pulses(b.Data, b.SampleRate)
+	}
+	return b.Pulses
+}
+
+// Frames returns the burst split into frames and decoded by pkg/demod,
+// computed once and shared by every decoder. Frames that can't be
+// classified have Encoding Unknown
+func (b *Burst) Frames() []*demod.Frame {
+	if !b.split {
+		b.split = true
+		for _, pulses := range demod.Split(b.Timings()) {
+			f, err := demod.Decode(pulses)
+			if err != nil {
+				f = &demod.Frame{Encoding: demod.Unknown, Pulses: pulses}
+			}
+			b.frames = append(b.frames, f)
+		}
+	}
+	return b.frames
+}
+
+// Candidate is one thing a decoder recognized in a burst
+type Candidate struct {
+	Decoder    string  `json:"decoder"`
+	Protocol   string  `json:"protocol"`
+	Confidence float64 `json:"confidence"` // 0 to 1
+	Summary    string  `json:"summary"`
+	Count      int     `json:"count"`            // Times found in the burst
+	Result     any     `json:"result,omitempty"` // The decoder's own result, e.g. a *princeton.Code
+}
+
+// Decoder recognizes protocols in bursts
+// Identify returns nothing when the burst holds nothing it knows; it may
+// call the burst's Timings and Frames but must not modify what they return
+type Decoder interface {
+	Name() string
+	Identify(b *Burst) []*Candidate
+}
+
+// decoderFunc adapts a function to Decoder
+type decoderFunc struct {
+	name     string
+	identify func(b *Burst) []*Candidate
+}
+
+func (d *decoderFunc) Name() string                   { return d.name }
+func (d *decoderFunc) Identify(b *Burst) []*Candidate { return d.identify(b) }
+
+// NewDecoder makes a Decoder from a name and an identify function
+func NewDecoder(name string, identify func(b *Burst) []*Candidate) Decoder {
+	return &decoderFunc{name: name, identify: identify}
+}
+
+// DecoderRegistry is a set of decoders run together
+type DecoderRegistry struct {
+	mu       sync.RWMutex
+	decoders []Decoder
+}
+
+// NewDecoderRegistry creates an empty registry
+func NewDecoderRegistry() *DecoderRegistry {
+	return &DecoderRegistry{}
+}
+
+// Default holds the built-in decoders
+var Default = NewDecoderRegistry()
+
+// Register adds a decoder to Default
+func Register(d Decoder) {
+	Default.Register(d)
+}
+
+// Identify runs a burst through Default
+func Identify(b *Burst) []*Candidate {
+	return Default.Identify(b)
+}
+
+// Register adds a decoder. Registering a name twice replaces the earlier
+// decoder
+func (r *DecoderRegistry) Register(d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.decoders {
+		if existing.Name() == d.Name() {
+			r.decoders[i] = d
+			return
+		}
+	}
+	r.decoders = append(r.decoders, d)
+}
+
+// Unregister removes the decoder with the given name, reporting whether
+// there was one
+func (r *DecoderRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.decoders {
+		if d.Name() == name {
+			r.decoders = append(r.decoders[:i], r.decoders[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the registered decoder names in registration order
+func (r *DecoderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.decoders))
+	for i, d := range r.decoders {
+		names[i] = d.Name()
+	}
+	return names
+}
+
+// Identify runs the burst through every decoder and returns the merged
+// candidates, most confident first
+func (r *DecoderRegistry) Identify(b *Burst) []*Candidate {
+	r.mu.RLock()
+	decoders := append([]Decoder(nil), r.decoders...)
+	r.mu.RUnlock()
+
+	var out []*Candidate
+	index := make(map[string]*Candidate)
+	for _, d := range decoders {
+		for _, c := range d.Identify(b) {
+			c.Decoder = d.Name()
+			if c.Count < 1 {
+				c.Count = 1
+			}
+			c.Confidence = clamp(c.Confidence)
+			key := c.Decoder + "\x00" + c.Protocol + "\x00" + c.Summary
+			if prev, ok := index[key]; ok {
+				// Each repeat closes part of the gap to 1; repeats are not
+				// independent (a mistake in the decoder repeats too), so
+				// only half of its confidence counts
+				prev.Confidence = 1 - (1-prev.Confidence)*(1-c.Confidence/2)
+				prev.Count += c.Count
+				continue
+			}
+			index[key] = c
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
+func clamp(c float64) float64 {
+	return max(0, min(1, c))
+}
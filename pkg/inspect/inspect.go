@@ -0,0 +1,242 @@
+// Package inspect renders received packets as side-by-side hex, ASCII,
+// binary and pulse views, highlighting bytes that changed since the
+// previous packet
+//
+// This is intended for reverse-engineering: press the same remote button
+// repeatedly (or different buttons) and watch which bits move.
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ANSI escapes used for diff highlighting
+const (
+	ansiReverse = "\x1b[7m"
+	ansiReset   = "\x1b[0m"
+)
+
+// Options controls inspector output
+type Options struct {
+	BytesPerRow  int           // Bytes per output row (default 8)
+	Color        bool          // Highlight changed bytes with ANSI reverse video; otherwise mark with ^
+	ShowBinary   bool          // Include the binary column
+	ShowPulses   bool          // Include the pulse-duration view (useful for OOK)
+	SymbolPeriod time.Duration // Duration of one bit for the pulse view (0 = bit units)
+}
+
+// DefaultOptions returns the options used when none are given
+func DefaultOptions() *Options {
+	return &Options{
+		BytesPerRow: 8,
+		ShowBinary:  true,
+	}
+}
+
+// Inspector renders packets and remembers the previous one for diffing
+type Inspector struct {
+	opts  Options
+	prev  []byte
+	count int
+}
+
+// New creates an inspector; opts may be nil for defaults
+func New(opts *Options) *Inspector {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	o := *opts
+	if o.BytesPerRow <= 0 {
+		o.BytesPerRow = 8
+	}
+	return &Inspector{opts: o}
+}
+
+// Reset forgets the previous packet
+func (in *Inspector) Reset() {
+	in.prev = nil
+	in.count = 0
+}
+
+// Write renders a packet to w and makes it the new diff baseline
+// pulses (in microseconds) may be nil, in which case they are derived from the bits
+func (in *Inspector) Write(w io.Writer, timestamp time.Time, data []byte, pulses []int) error {
+	_, err := io.WriteString(w, in.Render(timestamp, data, pulses))
+	return err
+}
+
+// Render formats a packet and makes it the new diff baseline
+func (in *Inspector) Render(timestamp time.Time, data []byte, pulses []int) string {
+	in.count++
+	changed := Diff(in.prev, data)
+
+	var b strings.Builder
+	nChanged := 0
+	for _, c := range changed {
+		if c {
+			nChanged++
+		}
+	}
+	fmt.Fprintf(&b, "[%s] Packet #%d (%d bytes", timestamp.Format("15:04:05.000"), in.count, len(data))
+	if in.prev != nil {
+		fmt.Fprintf(&b, ", %d changed", nChanged)
+	}
+	b.WriteString(")\n")
+
+	per := in.opts.BytesPerRow
+	for off := 0; off < len(data); off += per {
+		end := off + per
+		if end > len(data) {
+			end = len(data)
+		}
+		in.renderRow(&b, off, data[off:end], changed[off:end])
+	}
+
+	if in.opts.ShowPulses {
+		b.WriteString("  pulses: ")
+		if pulses != nil {
+			// Recorded pulse timings are already in microseconds
+			b.WriteString(FormatPulses(pulses, time.Microsecond))
+		} else {
+			b.WriteString(FormatPulses(BitsToPulses(data), in.opts.SymbolPeriod))
+		}
+		b.WriteByte('\n')
+	}
+
+	in.prev = append(in.prev[:0], data...)
+	return b.String()
+}
+
+func (in *Inspector) renderRow(b *strings.Builder, offset int, row []byte, changed []bool) {
+	per := in.opts.BytesPerRow
+	var marks strings.Builder
+	anyChanged := false
+
+	fmt.Fprintf(b, "  %04x  ", offset)
+	marks.WriteString("        ")
+
+	// Hex column
+	for i := 0; i < per; i++ {
+		if i < len(row) {
+			b.WriteString(in.highlight(fmt.Sprintf("%02x", row[i]), changed[i]))
+			b.WriteByte(' ')
+			if changed[i] {
+				marks.WriteString("^^ ")
+				anyChanged = true
+			} else {
+				marks.WriteString("   ")
+			}
+		} else {
+			b.WriteString("   ")
+			marks.WriteString("   ")
+		}
+	}
+
+	// ASCII column
+	b.WriteString(" |")
+	marks.WriteString("  ")
+	for i := 0; i < per; i++ {
+		if i < len(row) {
+			b.WriteString(in.highlight(string(printable(row[i])), changed[i]))
+			marks.WriteString(mark(changed[i], 1))
+		} else {
+			b.WriteByte(' ')
+			marks.WriteByte(' ')
+		}
+	}
+	b.WriteString("|")
+	marks.WriteString(" ")
+
+	// Binary column
+	if in.opts.ShowBinary {
+		b.WriteString("  ")
+		marks.WriteString("  ")
+		for i := 0; i < len(row); i++ {
+			if i > 0 {
+				b.WriteByte(' ')
+				marks.WriteByte(' ')
+			}
+			b.WriteString(in.highlight(fmt.Sprintf("%08b", row[i]), changed[i]))
+			marks.WriteString(mark(changed[i], 8))
+		}
+	}
+	b.WriteByte('\n')
+
+	if anyChanged && !in.opts.Color {
+		b.WriteString(strings.TrimRight(marks.String(), " "))
+		b.WriteByte('\n')
+	}
+}
+
+func (in *Inspector) highlight(s string, changed bool) string {
+	if changed && in.opts.Color {
+		return ansiReverse + s + ansiReset
+	}
+	return s
+}
+
+func mark(changed bool, width int) string {
+	if changed {
+		return strings.Repeat("^", width)
+	}
+	return strings.Repeat(" ", width)
+}
+
+func printable(c byte) byte {
+	if c >= 32 && c < 127 {
+		return c
+	}
+	return '.'
+}
+
+// Diff reports which bytes of cur differ from prev
+// Bytes beyond the end of prev count as changed; a nil prev marks nothing
+func Diff(prev, cur []byte) []bool {
+	changed := make([]bool, len(cur))
+	if prev == nil {
+		return changed
+	}
+	for i := range cur {
+		changed[i] = i >= len(prev) || prev[i] != cur[i]
+	}
+	return changed
+}
+
+// BitsToPulses converts OOK bits (MSB first) into signed run lengths in bits
+// Positive values are high (carrier on), negative values low
+func BitsToPulses(data []byte) []int {
+	var pulses []int
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			high := b&(1<<uint(bit)) != 0
+			n := len(pulses)
+			switch {
+			case n > 0 && high && pulses[n-1] > 0:
+				pulses[n-1]++
+			case n > 0 && !high && pulses[n-1] < 0:
+				pulses[n-1]--
+			case high:
+				pulses = append(pulses, 1)
+			default:
+				pulses = append(pulses, -1)
+			}
+		}
+	}
+	return pulses
+}
+
+// FormatPulses renders a pulse train; with a symbol period the values are in microseconds
+func FormatPulses(pulses []int, period time.Duration) string {
+	parts := make([]string, len(pulses))
+	for i, p := range pulses {
+		v := p
+		if period > 0 {
+			v = p * int(period/time.Microsecond)
+		}
+		parts[i] = fmt.Sprintf("%+d", v)
+	}
+	return strings.Join(parts, " ")
+}
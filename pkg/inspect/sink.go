@@ -0,0 +1,26 @@
+package inspect
+
+import (
+	"io"
+
+	"github.com/herlein/gocat/pkg/annotate"
+)
+
+// Sink adapts an Inspector to the annotate.Sink interface
+type Sink struct {
+	w  io.Writer
+	in *Inspector
+}
+
+// NewSink creates an annotation sink that renders records with an inspector
+func NewSink(w io.Writer, opts *Options) *Sink {
+	return &Sink{w: w, in: New(opts)}
+}
+
+func (s *Sink) Write(rec *annotate.Record) error {
+	return s.in.Write(s.w, rec.Timestamp, rec.Data, rec.Pulses)
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
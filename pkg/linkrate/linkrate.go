@@ -0,0 +1,380 @@
+// Package linkrate negotiates the fastest usable data rate between two
+// gocat nodes
+//
+// Both nodes start on the slowest profile of a shared ladder. The
+// initiator asks the responder over a reliable link to move to each
+// higher-rate profile in turn, sends a burst of probe datagrams there,
+// and both return to the control profile where the responder reports how
+// many probes it heard. The fastest profile whose packet error rate meets
+// the target is then selected and both nodes switch to it, confirmed by
+// one acknowledged exchange on the new profile.
+//
+// A lost ACK during a probe request leaves the two nodes on different
+// profiles; both give up and fall back to the control profile once their
+// timers expire.
+package linkrate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/reliable"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Message types carried over the reliable link
+const (
+	msgProbe   = 0x01 // count(2) interval ms(2) profile name
+	msgReport  = 0x02 // status(1) received(2) profile name
+	msgSelect  = 0x03 // profile name
+	msgConfirm = 0x04
+)
+
+// Report status codes
+const (
+	statusOK             = 0x00
+	statusUnknownProfile = 0x01
+)
+
+// settleTime lets both radios finish reconfiguring before probes start
+const settleTime = 150 * time.Millisecond
+
+// ErrNoRate is returned when no profile on the ladder met the PER target
+var ErrNoRate = errors.New("no profile met the packet error rate target")
+
+// Config controls a negotiation; both nodes must use the same ladder
+type Config struct {
+	Ladder    []*profiles.Profile // Ascending data rate; Ladder[0] is the control profile
+	Probes    int                 // Probe datagrams per step
+	Interval  time.Duration       // Spacing between probes
+	TargetPER float64             // Highest acceptable packet error rate (0-1)
+	Link      *reliable.Options   // nil uses reliable.DefaultOptions
+}
+
+// Step is the measurement for one profile on the ladder
+type Step struct {
+	Profile  string  `json:"profile"`
+	DataRate float64 `json:"data_rate_baud"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	PER      float64 `json:"per"`
+	Passed   bool    `json:"passed"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Result is the outcome of a negotiation
+type Result struct {
+	Selected string         `json:"selected"`
+	DataRate float64        `json:"data_rate_baud"`
+	Steps    []Step         `json:"steps,omitempty"`
+	Link     reliable.Stats `json:"link"`
+}
+
+// Ladder returns the built-in 2-FSK and GFSK packet profiles for a band
+// ("315", "433", "868" or "915") with CRC enabled, one per data rate,
+// slowest first
+func Ladder(band string) []*profiles.Profile {
+	var ladder []*profiles.Profile
+	seen := make(map[float64]bool)
+	all := profiles.All()
+	sort.SliceStable(all, func(i, j int) bool { return all[i].DataRateBaud < all[j].DataRateBaud })
+	for _, p := range all {
+		if !strings.HasPrefix(p.Name, band+"-") || seen[p.DataRateBaud] {
+			continue
+		}
+		if p.Modulation != profiles.Mod2FSK && p.Modulation != profiles.ModGFSK {
+			continue
+		}
+		if p.PktLenMode == profiles.PktLenInfinite || !p.CRCEn || p.FECEn || p.ManchesterEn {
+			continue
+		}
+		seen[p.DataRateBaud] = true
+		ladder = append(ladder, p)
+	}
+	return ladder
+}
+
+// ParseLadder resolves a list of built-in profile names and sorts them by
+// data rate
+func ParseLadder(names []string) ([]*profiles.Profile, error) {
+	var ladder []*profiles.Profile
+	for _, name := range names {
+		p := profiles.Find(strings.TrimSpace(name))
+		if p == nil {
+			return nil, fmt.Errorf("unknown profile '%s'", name)
+		}
+		ladder = append(ladder, p)
+	}
+	sort.SliceStable(ladder, func(i, j int) bool { return ladder[i].DataRateBaud < ladder[j].DataRateBaud })
+	return ladder, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Ladder) == 0 {
+		return fmt.Errorf("empty profile ladder")
+	}
+	if c.Probes < 1 || c.Probes > 0xFFFF {
+		return fmt.Errorf("probe count must be 1-65535")
+	}
+	if c.TargetPER < 0 || c.TargetPER >= 1 {
+		return fmt.Errorf("PER target must be between 0 and 1")
+	}
+	return nil
+}
+
+// window is how long the responder listens for probes on a candidate
+func window(probes int, interval time.Duration) time.Duration {
+	return settleTime + time.Duration(probes)*interval + 500*time.Millisecond
+}
+
+// reportTimeout is how long the initiator waits for a report after its
+// probe window, covering the responder's retransmissions
+func (c *Config) reportTimeout() time.Duration {
+	opts := c.Link
+	if opts == nil {
+		opts = reliable.DefaultOptions()
+	}
+	return time.Duration(opts.Retries+2)*opts.AckTimeout + time.Second
+}
+
+// find returns the ladder profile with the given name
+func (c *Config) find(name string) *profiles.Profile {
+	for _, p := range c.Ladder {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Initiate runs the negotiation from the initiating node and leaves the
+// device on the selected profile
+func Initiate(device *yardstick.Device, cfg *Config) (*Result, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	lease, err := device.Acquire(yardstick.ModeRX, "linkrate")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	device = lease.Device()
+
+	control := cfg.Ladder[0]
+	if err := config.ApplyProfile(device, control); err != nil {
+		return nil, fmt.Errorf("failed to apply control profile: %w", err)
+	}
+	link := reliable.New(device, cfg.Link)
+	result := &Result{}
+
+	var best *profiles.Profile
+	for _, p := range cfg.Ladder {
+		step, err := probe(device, link, cfg, control, p)
+		if err != nil {
+			result.Link = link.Stats()
+			return result, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		result.Steps = append(result.Steps, *step)
+		if !step.Passed {
+			break
+		}
+		best = p
+	}
+	result.Link = link.Stats()
+	if best == nil {
+		return result, ErrNoRate
+	}
+
+	if err := link.Send(append([]byte{msgSelect}, best.Name...)); err != nil {
+		return result, fmt.Errorf("failed to announce %s: %w", best.Name, err)
+	}
+	if err := config.ApplyProfile(device, best); err != nil {
+		return result, fmt.Errorf("failed to apply %s: %w", best.Name, err)
+	}
+	time.Sleep(settleTime)
+	if err := link.Send([]byte{msgConfirm}); err != nil {
+		result.Link = link.Stats()
+		config.ApplyProfile(device, control)
+		return result, fmt.Errorf("no confirmation on %s, reverted to %s: %w", best.Name, control.Name, err)
+	}
+
+	result.Selected = best.Name
+	result.DataRate = best.DataRateBaud
+	result.Link = link.Stats()
+	return result, nil
+}
+
+// probe measures one candidate profile and returns to the control profile
+func probe(device *yardstick.Device, link *reliable.Link, cfg *Config, control, p *profiles.Profile) (*Step, error) {
+	step := &Step{Profile: p.Name, DataRate: p.DataRateBaud}
+
+	msg := make([]byte, 5, 5+len(p.Name))
+	msg[0] = msgProbe
+	binary.LittleEndian.PutUint16(msg[1:], uint16(cfg.Probes))
+	binary.LittleEndian.PutUint16(msg[3:], uint16(cfg.Interval/time.Millisecond))
+	msg = append(msg, p.Name...)
+	if err := link.Send(msg); err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	// Stop short of the responder's window so the last probe isn't lost
+	// to it switching back
+	deadline := time.Now().Add(window(cfg.Probes, cfg.Interval) - 300*time.Millisecond)
+	if err := config.ApplyProfile(device, p); err != nil {
+		return nil, fmt.Errorf("failed to apply profile: %w", err)
+	}
+	time.Sleep(settleTime)
+	payload := make([]byte, 2)
+	for i := 0; i < cfg.Probes && time.Now().Before(deadline); i++ {
+		binary.LittleEndian.PutUint16(payload, uint16(i))
+		if err := link.SendDatagram(uint8(i), payload); err != nil {
+			step.Error = err.Error()
+			break
+		}
+		step.Sent++
+		time.Sleep(cfg.Interval)
+	}
+
+	if err := config.ApplyProfile(device, control); err != nil {
+		return nil, fmt.Errorf("failed to return to control profile: %w", err)
+	}
+	report, err := link.Recv(time.Until(deadline) + cfg.reportTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("no report from responder: %w", err)
+	}
+	if len(report) < 4 || report[0] != msgReport || string(report[4:]) != p.Name {
+		return nil, fmt.Errorf("unexpected report % X", report)
+	}
+	if report[1] == statusUnknownProfile {
+		step.Error = "responder does not know this profile"
+		return step, nil
+	}
+
+	step.Received = int(binary.LittleEndian.Uint16(report[2:]))
+	if step.Sent > 0 {
+		step.PER = 1 - float64(step.Received)/float64(step.Sent)
+		if step.PER < 0 {
+			step.PER = 0
+		}
+		step.Passed = step.PER <= cfg.TargetPER
+	}
+	return step, nil
+}
+
+// Respond waits up to timeout for an initiator, follows the negotiation
+// and leaves the device on the selected profile
+func Respond(device *yardstick.Device, cfg *Config, timeout time.Duration) (*Result, error) {
+	if len(cfg.Ladder) == 0 {
+		return nil, fmt.Errorf("empty profile ladder")
+	}
+	lease, err := device.Acquire(yardstick.ModeRX, "linkrate")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	device = lease.Device()
+
+	control := cfg.Ladder[0]
+	if err := config.ApplyProfile(device, control); err != nil {
+		return nil, fmt.Errorf("failed to apply control profile: %w", err)
+	}
+	link := reliable.New(device, cfg.Link)
+	result := &Result{}
+
+	wait := timeout
+	for {
+		msg, err := link.Recv(wait)
+		result.Link = link.Stats()
+		if err != nil {
+			return result, fmt.Errorf("waiting for initiator: %w", err)
+		}
+		// Once started, the initiator's next message follows promptly
+		wait = cfg.reportTimeout() + 2*time.Second
+		if len(msg) == 0 {
+			continue
+		}
+
+		switch msg[0] {
+		case msgProbe:
+			if len(msg) < 5 {
+				continue
+			}
+			step, err := listen(device, link, cfg, control, msg)
+			if err != nil {
+				return result, err
+			}
+			result.Steps = append(result.Steps, *step)
+
+		case msgSelect:
+			name := string(msg[1:])
+			p := cfg.find(name)
+			if p == nil {
+				return result, fmt.Errorf("initiator selected unknown profile '%s'", name)
+			}
+			if err := config.ApplyProfile(device, p); err != nil {
+				return result, fmt.Errorf("failed to apply %s: %w", name, err)
+			}
+			confirm, err := link.Recv(cfg.reportTimeout() + settleTime)
+			result.Link = link.Stats()
+			if err != nil || len(confirm) == 0 || confirm[0] != msgConfirm {
+				config.ApplyProfile(device, control)
+				return result, fmt.Errorf("no confirmation on %s, reverted to %s", name, control.Name)
+			}
+			result.Selected = p.Name
+			result.DataRate = p.DataRateBaud
+			return result, nil
+		}
+	}
+}
+
+// listen counts probes on the requested profile for the probe window,
+// then reports the count from the control profile
+func listen(device *yardstick.Device, link *reliable.Link, cfg *Config, control *profiles.Profile, msg []byte) (*Step, error) {
+	probes := int(binary.LittleEndian.Uint16(msg[1:]))
+	interval := time.Duration(binary.LittleEndian.Uint16(msg[3:])) * time.Millisecond
+	name := string(msg[5:])
+	deadline := time.Now().Add(window(probes, interval))
+
+	step := &Step{Profile: name}
+	status := uint8(statusOK)
+	if p := cfg.find(name); p == nil {
+		status = statusUnknownProfile
+		step.Error = "unknown profile"
+		time.Sleep(time.Until(deadline))
+	} else {
+		step.DataRate = p.DataRateBaud
+		if err := config.ApplyProfile(device, p); err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+		heard := make(map[uint16]bool)
+		for time.Now().Before(deadline) {
+			_, body, err := link.RecvDatagram(time.Until(deadline))
+			if err != nil {
+				break
+			}
+			if len(body) >= 2 {
+				heard[binary.LittleEndian.Uint16(body)] = true
+			}
+		}
+		step.Received = len(heard)
+		if err := config.ApplyProfile(device, control); err != nil {
+			return nil, fmt.Errorf("failed to return to control profile: %w", err)
+		}
+	}
+
+	report := make([]byte, 4, 4+len(name))
+	report[0] = msgReport
+	report[1] = status
+	binary.LittleEndian.PutUint16(report[2:], uint16(step.Received))
+	report = append(report, name...)
+	if err := link.Send(report); err != nil {
+		return nil, fmt.Errorf("failed to report %s: %w", name, err)
+	}
+	return step, nil
+}
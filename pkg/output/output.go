@@ -0,0 +1,71 @@
+// Package output implements the -output flag shared by the command-line
+// tools, so results can be consumed by scripts as JSON instead of scraped
+// from text tables
+//
+// In JSON mode stdout carries only the result: a single document for
+// one-shot commands, or one object per line for streaming commands.
+// Progress messages go to stderr.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format selects how a command writes its results
+type Format string
+
+// Supported formats
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// FlagUsage is the help text for -output flags
+const FlagUsage = "Output format: text or json"
+
+// String implements flag.Value
+func (f *Format) String() string {
+	if *f == "" {
+		return string(Text)
+	}
+	return string(*f)
+}
+
+// Set implements flag.Value
+func (f *Format) Set(s string) error {
+	switch Format(s) {
+	case Text, JSON:
+		*f = Format(s)
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%s' (want text or json)", s)
+}
+
+// IsJSON reports whether results should be written as JSON
+func (f Format) IsJSON() bool {
+	return f == JSON
+}
+
+// Progress returns where human-readable progress should be written:
+// stdout in text mode, stderr in JSON mode
+func (f Format) Progress() io.Writer {
+	if f.IsJSON() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Write encodes v to stdout as one indented JSON document
+func Write(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// WriteLine encodes v to stdout as a single line, for streamed records
+func WriteLine(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
@@ -0,0 +1,169 @@
+// Package payload builds transmit payloads from text: hex with separators,
+// base64, escape-sequenced strings, repeated patterns and templates with
+// per-packet counters, optionally finished with a software CRC16 and PN9
+// whitening for profiles that have those hardware features disabled
+package payload
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/coding"
+)
+
+// Input formats accepted by Parse
+const (
+	FormatHex     = "hex"
+	FormatBase64  = "base64"
+	FormatText    = "text"
+	FormatPattern = "pattern"
+)
+
+// Parse decodes s according to format
+func Parse(format, s string) ([]byte, error) {
+	switch format {
+	case FormatHex:
+		return ParseHex(s)
+	case FormatBase64:
+		return ParseBase64(s)
+	case FormatText:
+		return ParseEscaped(s)
+	case FormatPattern:
+		return ParsePattern(s)
+	}
+	return nil, fmt.Errorf("unknown payload format '%s'", format)
+}
+
+// ParseHex decodes hex digits, ignoring whitespace, ':', '-', ',' and '_'
+// separators and "0x" prefixes, so "DE AD BE EF", "de:ad:be:ef" and
+// "0xDE,0xAD" all work
+func ParseHex(s string) ([]byte, error) {
+	var digits strings.Builder
+	for _, field := range strings.FieldsFunc(s, isHexSeparator) {
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X")
+		digits.WriteString(field)
+	}
+	data, err := hex.DecodeString(digits.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return data, nil
+}
+
+func isHexSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', ':', '-', ',', '_':
+		return true
+	}
+	return false
+}
+
+// ParseBase64 decodes standard or URL-safe base64, with or without padding
+func ParseBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	encodings := []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	}
+	var err error
+	for _, enc := range encodings {
+		var data []byte
+		if data, err = enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64: %w", err)
+}
+
+// ParseEscaped decodes a string with C-style escapes: \n \r \t \0 \\ \"
+// and \xNN for arbitrary bytes. Other characters are taken as UTF-8
+func ParseEscaped(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, fmt.Errorf("trailing backslash")
+		}
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case '0':
+			out = append(out, 0)
+		case '\\', '"', '\'':
+			out = append(out, s[i])
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("short \\x escape at offset %d", i-1)
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape at offset %d", i-1)
+			}
+			out = append(out, byte(b))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape \\%c at offset %d", s[i], i-1)
+		}
+	}
+	return out, nil
+}
+
+// Repeat returns pattern repeated count times
+func Repeat(pattern []byte, count int) []byte {
+	out := make([]byte, 0, len(pattern)*count)
+	for i := 0; i < count; i++ {
+		out = append(out, pattern...)
+	}
+	return out
+}
+
+// ParsePattern decodes space-separated hex segments, each optionally
+// followed by "*count", e.g. "AA*4 2DD4 55*8"
+func ParsePattern(s string) ([]byte, error) {
+	var out []byte
+	for _, seg := range strings.Fields(s) {
+		count := 1
+		if i := strings.LastIndexByte(seg, '*'); i >= 0 {
+			n, err := strconv.Atoi(seg[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid repeat count in '%s'", seg)
+			}
+			seg, count = seg[:i], n
+		}
+		pattern, err := ParseHex(seg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Repeat(pattern, count)...)
+	}
+	return out, nil
+}
+
+// Options are applied to a payload after it is built
+type Options struct {
+	CRC    bool // Append the CC1111 CRC16, MSB first
+	Whiten bool // PN9-whiten the payload (and CRC), as the radio does
+}
+
+// Finish applies CRC and whitening in the order the packet engine uses
+func (o Options) Finish(data []byte) []byte {
+	if o.CRC {
+		data = coding.AppendCRC16(data)
+	}
+	if o.Whiten {
+		data = coding.Whiten(data)
+	}
+	return data
+}
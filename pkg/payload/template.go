@@ -0,0 +1,116 @@
+package payload
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template is a hex payload with counter fields filled in per packet
+//
+// Counters are written as {seq}, {seq:N} or {seq:N:le}: an N byte
+// (default 1, at most 8) counter, big-endian unless ":le" is given.
+// For example "AA55 {seq:2} 01020304" sends AA55 0000 01020304, then
+// AA55 0001 01020304 and so on. The counter wraps at the field width
+type Template struct {
+	parts []part
+}
+
+type part struct {
+	data   []byte // Literal bytes, or nil for a counter
+	width  int
+	little bool
+}
+
+// ParseTemplate parses a template; see Template for the syntax
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{}
+	for len(s) > 0 {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			open = len(s)
+		}
+		if open > 0 {
+			lit, err := ParseHex(s[:open])
+			if err != nil {
+				return nil, err
+			}
+			if len(lit) > 0 {
+				t.parts = append(t.parts, part{data: lit})
+			}
+		}
+		if open == len(s) {
+			break
+		}
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated field '%s'", s[open:])
+		}
+		p, err := parseField(s[open+1 : open+end])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, p)
+		s = s[open+end+1:]
+	}
+	return t, nil
+}
+
+func parseField(field string) (part, error) {
+	args := strings.Split(field, ":")
+	if args[0] != "seq" {
+		return part{}, fmt.Errorf("unknown template field '{%s}'", field)
+	}
+	p := part{width: 1}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > 8 {
+			return part{}, fmt.Errorf("counter width must be 1-8 in '{%s}'", field)
+		}
+		p.width = n
+	}
+	if len(args) > 2 {
+		if args[2] != "le" && args[2] != "be" {
+			return part{}, fmt.Errorf("counter byte order must be le or be in '{%s}'", field)
+		}
+		p.little = args[2] == "le"
+	}
+	if len(args) > 3 {
+		return part{}, fmt.Errorf("too many arguments in '{%s}'", field)
+	}
+	return p, nil
+}
+
+// Static returns a template that always builds data
+func Static(data []byte) *Template {
+	return &Template{parts: []part{{data: data}}}
+}
+
+// Build returns the payload for the n'th packet, counting from 0
+func (t *Template) Build(n uint64) []byte {
+	var out []byte
+	for _, p := range t.parts {
+		if p.data != nil {
+			out = append(out, p.data...)
+			continue
+		}
+		for i := 0; i < p.width; i++ {
+			shift := 8 * (p.width - 1 - i)
+			if p.little {
+				shift = 8 * i
+			}
+			out = append(out, byte(n>>shift))
+		}
+	}
+	return out
+}
+
+// HasCounter reports whether Build varies with n
+func (t *Template) HasCounter() bool {
+	for _, p := range t.parts {
+		if p.data == nil {
+			return true
+		}
+	}
+	return false
+}
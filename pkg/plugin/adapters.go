@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/annotate"
+)
+
+func init() {
+	// Make plugin decoders available to declarative pipeline configs:
+	// {"type": "plugin", "params": {"command": "acme-decoder", "args": ["-x"]}}
+	annotate.RegisterStage("plugin", func(params json.RawMessage) (annotate.Stage, error) {
+		var cfg struct {
+			Command string   `json:"command"`
+			Args    []string `json:"args"`
+		}
+		if err := json.Unmarshal(params, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid stage parameters: %w", err)
+		}
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("plugin stage requires a command")
+		}
+		return NewStage(cfg.Command, cfg.Args...)
+	})
+}
+
+// Stage is an annotation stage backed by a decoder plugin
+type Stage struct {
+	p *Process
+}
+
+// NewStage starts a decoder plugin
+func NewStage(command string, args ...string) (*Stage, error) {
+	p, err := Start(command, args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind != KindDecoder {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s is a %s, not a decoder", p.Name, p.Kind)
+	}
+	return &Stage{p: p}, nil
+}
+
+func (s *Stage) Name() string { return "plugin:" + s.p.Name }
+
+func (s *Stage) Process(rec *annotate.Record) error {
+	resp, err := s.p.call(&message{Type: "record", Record: rec})
+	if err != nil {
+		return err
+	}
+	if resp.Type != "result" {
+		return fmt.Errorf("unexpected '%s' reply", resp.Type)
+	}
+	if resp.Record != nil {
+		*rec = *resp.Record
+	}
+	rec.Drop = resp.Drop
+	return nil
+}
+
+// Close stops the plugin process
+func (s *Stage) Close() error {
+	return s.p.Close()
+}
+
+// Sink is an annotation sink backed by a sink plugin
+type Sink struct {
+	p *Process
+}
+
+// NewSink starts a sink plugin
+func NewSink(command string, args ...string) (*Sink, error) {
+	p, err := Start(command, args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind != KindSink {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s is a %s, not a sink", p.Name, p.Kind)
+	}
+	return &Sink{p: p}, nil
+}
+
+func (s *Sink) Write(rec *annotate.Record) error {
+	resp, err := s.p.call(&message{Type: "record", Record: rec})
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", s.p.Name, err)
+	}
+	if resp.Type != "ack" {
+		return fmt.Errorf("plugin %s: unexpected '%s' reply", s.p.Name, resp.Type)
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	return s.p.Close()
+}
@@ -0,0 +1,185 @@
+// Package plugin runs external decoders and output sinks as subprocesses
+// speaking a JSON-lines protocol on stdin/stdout
+//
+// This keeps third-party and proprietary protocol support out of the main
+// tree: a plugin is any executable that follows the protocol below.
+//
+// Protocol (one JSON object per line, host writes stdin, plugin writes stdout):
+//
+//	host   -> {"type":"hello","version":1}
+//	plugin -> {"type":"hello","name":"acme","kind":"decoder"}   kind: decoder or sink
+//
+//	host   -> {"type":"record","record":{...}}
+//	plugin -> {"type":"result","record":{...},"drop":false}     decoders
+//	plugin -> {"type":"ack"}                                    sinks
+//	plugin -> {"type":"error","error":"message"}                either
+//
+// Records use the annotate.Record JSON form; byte fields are base64.
+// Decoders return the full record, which replaces the host's copy.
+// Anything a plugin writes to stderr is passed through to the host's stderr.
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/annotate"
+)
+
+// ProtocolVersion is the plugin protocol version spoken by the host
+const ProtocolVersion = 1
+
+// DefaultTimeout bounds how long the host waits for any single plugin reply
+const DefaultTimeout = 5 * time.Second
+
+// Plugin kinds
+const (
+	KindDecoder = "decoder"
+	KindSink    = "sink"
+)
+
+// message is the envelope for every protocol line
+type message struct {
+	Type    string           `json:"type"`
+	Version int              `json:"version,omitempty"`
+	Name    string           `json:"name,omitempty"`
+	Kind    string           `json:"kind,omitempty"`
+	Record  *annotate.Record `json:"record,omitempty"`
+	Drop    bool             `json:"drop,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// Process is a running plugin
+type Process struct {
+	Name    string
+	Kind    string
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	enc     *json.Encoder
+	replies chan reply
+}
+
+type reply struct {
+	msg *message
+	err error
+}
+
+// Start launches a plugin executable and performs the handshake
+func Start(command string, args ...string) (*Process, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", command, err)
+	}
+
+	p := &Process{
+		Name:    command,
+		Timeout: DefaultTimeout,
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		replies: make(chan reply, 1),
+	}
+	go p.readLoop(stdout)
+
+	resp, err := p.call(&message{Type: "hello", Version: ProtocolVersion})
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s handshake failed: %w", command, err)
+	}
+	if resp.Type != "hello" {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s handshake failed: unexpected '%s' message", command, resp.Type)
+	}
+	if resp.Kind != KindDecoder && resp.Kind != KindSink {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s reported unknown kind '%s'", command, resp.Kind)
+	}
+	if resp.Name != "" {
+		p.Name = resp.Name
+	}
+	p.Kind = resp.Kind
+
+	return p, nil
+}
+
+// readLoop decodes plugin replies until stdout closes
+func (p *Process) readLoop(r io.Reader) {
+	defer close(p.replies)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			p.replies <- reply{err: fmt.Errorf("invalid reply: %w", err)}
+			continue
+		}
+		p.replies <- reply{msg: &msg}
+	}
+}
+
+// call sends a message and waits for the reply
+func (p *Process) call(msg *message) (*message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.enc.Encode(msg); err != nil {
+		return nil, fmt.Errorf("failed to write to plugin: %w", err)
+	}
+
+	select {
+	case r, ok := <-p.replies:
+		if !ok {
+			return nil, fmt.Errorf("plugin exited")
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.msg.Type == "error" {
+			return nil, fmt.Errorf("%s", r.msg.Error)
+		}
+		return r.msg, nil
+	case <-time.After(p.Timeout):
+		// A late reply would be paired with the next request, so the
+		// plugin can't be trusted any more
+		p.cmd.Process.Kill()
+		return nil, fmt.Errorf("timeout waiting for plugin reply")
+	}
+}
+
+// Close stops the plugin
+// Closing stdin asks the plugin to exit; it is killed if it hasn't within a second
+func (p *Process) Close() error {
+	p.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- p.cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+		return <-done
+	}
+}
@@ -0,0 +1,248 @@
+// Package princeton decodes and encodes the fixed-code OOK remotes built
+// on the PT2262 and EV1527 encoder chips (and their many clones), the
+// most common 315/433 MHz garage, doorbell and socket remotes
+//
+// Both send 24 PWM bits followed by a sync, in units of one short pulse:
+//   - bit 0: 1 unit of carrier, 3 off
+//   - bit 1: 3 units of carrier, 1 off
+//   - sync:  1 unit of carrier, 31 off
+//
+// The EV1527 sends a 20-bit address burned in at the factory and 4 data
+// bits, one per button. The PT2262 sends 12 tri-state pins, each as a pair
+// of bits: 00 for a pin tied low, 11 for high and 01 for floating (F);
+// usually 8 address pins set with solder bridges and 4 data pins. The
+// code word is repeated for as long as the button is held.
+package princeton
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/demod"
+)
+
+// Chip is the encoder a code was sent by
+type Chip string
+
+// Chips
+const (
+	PT2262 Chip = "pt2262"
+	EV1527 Chip = "ev1527"
+)
+
+// Code word layout, in bits and short-pulse units
+const (
+	CodeBits     = 24
+	AddressBits  = 20 // EV1527
+	Trits        = 12 // PT2262
+	LongUnits    = 3
+	SyncGapUnits = 31
+	WordUnits    = CodeBits*(1+LongUnits) + 1 + SyncGapUnits
+)
+
+// DefaultPulseUs is a typical short pulse width: a PT2262 with a 3.3 MΩ
+// oscillator resistor, or an EV1527 with the usual 330 kΩ
+const DefaultPulseUs = 350
+
+// DefaultRepeat is how many code words a remote sends per button press
+// at least; receivers usually want two or more in a row
+const DefaultRepeat = 8
+
+// ErrNotPrinceton is returned when a frame isn't a PT2262/EV1527 code word
+var ErrNotPrinceton = errors.New("not a PT2262/EV1527 code word")
+
+// Code is one fixed code
+type Code struct {
+	Chip     Chip       `json:"chip"`
+	Bits     demod.Bits `json:"bits"`
+	Address  uint32     `json:"address"`            // First 20 bits, as the EV1527 sends them
+	Data     uint8      `json:"data"`               // Last 4 bits, the buttons
+	Tristate string     `json:"tristate,omitempty"` // The 12 PT2262 pins as 0, 1 and F, when every bit pair is valid
+	PulseUs  int        `json:"pulse_us"`           // Short pulse width: one unit
+}
+
+// Decode reads a code word from a PWM frame decoded by pkg/demod. The
+// frame holds the 24 bits and usually the sync pulse after them, which
+// demod reads as a 25th short bit. The chip is reported as PT2262 when
+// every bit pair is a valid pin state, which happens by chance for about
+// 3% of EV1527 addresses
+func Decode(f *demod.Frame) (*Code, error) {
+	if f.Encoding != demod.PWM || f.Errors > 0 || f.ShortUs <= 0 {
+		return nil, ErrNotPrinceton
+	}
+	bits := f.Bits
+	if len(bits) == CodeBits+1 && bits[CodeBits] == 0 {
+		bits = bits[:CodeBits]
+	}
+	if len(bits) != CodeBits {
+		return nil, fmt.Errorf("%w: %d bits", ErrNotPrinceton, len(bits))
+	}
+	if ratio := float64(f.LongUs) / float64(f.ShortUs); ratio < 2 || ratio > 4.5 {
+		return nil, fmt.Errorf("%w: long/short pulse ratio %.1f", ErrNotPrinceton, ratio)
+	}
+	c := newCode(append(demod.Bits(nil), bits...), int(math.Round(float64(f.ShortUs+f.LongUs)/(1+LongUnits))))
+	return c, nil
+}
+
+// Demodulate decodes every code word in a raw OOK bitstream sampled at
+// sampleRate, as received on a no-sync OOK profile
+func Demodulate(data []byte, sampleRate float64) []*Code {
+	var codes []*Code
+	for _, f := range demod.Demodulate(data, sampleRate) {
+		if c, err := Decode(f); err == nil {
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+// NewEV1527 returns the code for a 20-bit address and 4 data bits
+// pulseUs 0 means DefaultPulseUs
+func NewEV1527(address uint32, data uint8, pulseUs int) (*Code, error) {
+	if address >= 1<<AddressBits || data >= 1<<(CodeBits-AddressBits) {
+		return nil, fmt.Errorf("EV1527 address 0x%X or data 0x%X out of range (20 and 4 bits)", address, data)
+	}
+	bits := make(demod.Bits, CodeBits)
+	word := address<<(CodeBits-AddressBits) | uint32(data)
+	for i := range bits {
+		bits[i] = uint8(word >> uint(CodeBits-1-i) & 1)
+	}
+	c := newCode(bits, pulseUs)
+	c.Chip = EV1527
+	return c, nil
+}
+
+// NewPT2262 returns the code for 12 pin states given as 0, 1 and F
+// pulseUs 0 means DefaultPulseUs
+func NewPT2262(tristate string, pulseUs int) (*Code, error) {
+	tristate = strings.ToUpper(tristate)
+	if len(tristate) != Trits {
+		return nil, fmt.Errorf("PT2262 code '%s' must have %d pins of 0, 1 or F", tristate, Trits)
+	}
+	bits := make(demod.Bits, 0, CodeBits)
+	for _, t := range tristate {
+		switch t {
+		case '0':
+			bits = append(bits, 0, 0)
+		case '1':
+			bits = append(bits, 1, 1)
+		case 'F':
+			bits = append(bits, 0, 1)
+		default:
+			return nil, fmt.Errorf("PT2262 code '%s': pin '%c' is not 0, 1 or F", tristate, t)
+		}
+	}
+	c := newCode(bits, pulseUs)
+	c.Chip = PT2262
+	return c, nil
+}
+
+// newCode fills in the fields derived from 24 bits
+func newCode(bits demod.Bits, pulseUs int) *Code {
+	if pulseUs <= 0 {
+		pulseUs = DefaultPulseUs
+	}
+	c := &Code{Chip: EV1527, Bits: bits, PulseUs: pulseUs}
+	var word uint32
+	for _, b := range bits {
+		word = word<<1 | uint32(b)
+	}
+	c.Address = word >> (CodeBits - AddressBits)
+	c.Data = uint8(word & (1<<(CodeBits-AddressBits) - 1))
+	if t, ok := tristate(bits); ok {
+		c.Chip, c.Tristate = PT2262, t
+	}
+	return c
+}
+
+// tristate reads bit pairs as PT2262 pin states; 10 is not a valid pair
+func tristate(bits demod.Bits) (string, bool) {
+	var s strings.Builder
+	for i := 0; i+1 < len(bits); i += 2 {
+		switch {
+		case bits[i] == 0 && bits[i+1] == 0:
+			s.WriteByte('0')
+		case bits[i] == 1 && bits[i+1] == 1:
+			s.WriteByte('1')
+		case bits[i] == 0 && bits[i+1] == 1:
+			s.WriteByte('F')
+		default:
+			return "", false
+		}
+	}
+	return s.String(), true
+}
+
+// DataRate is the rate, in baud, to send Bitstream at: one bit per unit
+func (c *Code) DataRate() float64 {
+	return 1e6 / float64(c.PulseUs)
+}
+
+// Bitstream returns repeat code words as OOK bits, one per unit, MSB
+// first. Each word is 128 units, so exactly 16 bytes, and ends with the
+// sync gap. Send it at DataRate on a no-sync OOK profile
+func (c *Code) Bitstream(repeat int) []byte {
+	if repeat < 1 {
+		repeat = 1
+	}
+	word := make([]byte, 0, WordUnits/8)
+	var cur byte
+	n := 0
+	put := func(level byte, units int) {
+		for i := 0; i < units; i++ {
+			cur = cur<<1 | level
+			if n++; n%8 == 0 {
+				word = append(word, cur)
+				cur = 0
+			}
+		}
+	}
+	for _, b := range c.Bits {
+		if b == 1 {
+			put(1, LongUnits)
+			put(0, 1)
+		} else {
+			put(1, 1)
+			put(0, LongUnits)
+		}
+	}
+	put(1, 1)
+	put(0, SyncGapUnits)
+
+	out := make([]byte, 0, len(word)*repeat)
+	for i := 0; i < repeat; i++ {
+		out = append(out, word...)
+	}
+	return out
+}
+
+// Pulses returns repeat code words as signed pulse durations in
+// microseconds, the pkg/capture convention, e.g. for a .sub file
+func (c *Code) Pulses(repeat int) []int {
+	if repeat < 1 {
+		repeat = 1
+	}
+	short, long := c.PulseUs, LongUnits*c.PulseUs
+	var out []int
+	for i := 0; i < repeat; i++ {
+		for _, b := range c.Bits {
+			if b == 1 {
+				out = append(out, long, -short)
+			} else {
+				out = append(out, short, -long)
+			}
+		}
+		out = append(out, short, -SyncGapUnits*short)
+	}
+	return out
+}
+
+// String describes the code as its chip would
+func (c *Code) String() string {
+	if c.Chip == PT2262 {
+		return fmt.Sprintf("PT2262 %s", c.Tristate)
+	}
+	return fmt.Sprintf("EV1527 address 0x%05X data 0x%X", c.Address, c.Data)
+}
@@ -0,0 +1,98 @@
+package profiles
+
+import (
+	"time"
+
+	"github.com/herlein/gocat/pkg/registers"
+)
+
+// preambleBytesByReg maps MDMCFG1 NUM_PREAMBLE to byte counts
+var preambleBytesByReg = [8]int{2, 3, 4, 6, 8, 12, 16, 24}
+
+// framing describes what the packet engine puts on air around a payload
+type framing struct {
+	dataRateBaud  float64
+	preambleBytes int
+	syncMode      uint8
+	pktLenMode    uint8
+	addrByte      bool
+	crc           bool
+	fec           bool
+	manchester    bool
+}
+
+// Airtime returns the on-air duration of one packet with payloadLen bytes
+// including preamble, sync word, length/address bytes, CRC, FEC expansion
+// and Manchester encoding as configured by the profile
+func Airtime(p *Profile, payloadLen int) time.Duration {
+	return framing{
+		dataRateBaud:  p.DataRateBaud,
+		preambleBytes: int(p.PreambleBytes),
+		syncMode:      p.SyncMode,
+		pktLenMode:    p.PktLenMode,
+		crc:           p.CRCEn,
+		fec:           p.FECEn,
+		manchester:    p.ManchesterEn,
+	}.airtime(payloadLen)
+}
+
+// AirtimeFromRegisters returns the on-air duration of one packet with
+// payloadLen bytes for a raw register configuration
+// crystalMHz should be 24 for CC1110/CC1111, 26 for CC2510/CC2511
+func AirtimeFromRegisters(reg *registers.RegisterMap, crystalMHz float64, payloadLen int) time.Duration {
+	return framing{
+		dataRateBaud:  registers.GetDataRate(reg, crystalMHz),
+		preambleBytes: preambleBytesByReg[(reg.MDMCFG1>>4)&0x07],
+		syncMode:      registers.GetSyncMode(reg),
+		pktLenMode:    reg.PKTCTRL0 & 0x03,
+		addrByte:      reg.PKTCTRL1&0x03 != 0,
+		crc:           reg.PKTCTRL0&0x04 != 0,
+		fec:           reg.MDMCFG1&0x80 != 0,
+		manchester:    reg.MDMCFG2&0x08 != 0,
+	}.airtime(payloadLen)
+}
+
+func (f framing) airtime(payloadLen int) time.Duration {
+	if f.dataRateBaud <= 0 {
+		return 0
+	}
+
+	// Preamble and sync are only sent when a sync mode with a sync word is set
+	var headerBits int
+	switch f.syncMode & 0x03 {
+	case SyncNone:
+		headerBits = 0
+	case Sync30of32:
+		headerBits = f.preambleBytes*8 + 32
+	default:
+		headerBits = f.preambleBytes*8 + 16
+	}
+
+	// Everything after the sync word goes through FEC
+	body := payloadLen
+	if f.pktLenMode == PktLenVariable {
+		body++
+	}
+	if f.addrByte {
+		body++
+	}
+	if f.crc {
+		body += 2
+	}
+
+	bodyBits := body * 8
+	if f.fec {
+		// Rate 1/2 convolutional code plus 2 termination bytes, interleaved
+		// in 4-byte blocks
+		encoded := (body + 2) * 2
+		encoded = (encoded + 3) / 4 * 4
+		bodyBits = encoded * 8
+	}
+
+	bits := headerBits + bodyBits
+	if f.manchester {
+		bits *= 2
+	}
+
+	return time.Duration(float64(bits) / f.dataRateBaud * float64(time.Second))
+}
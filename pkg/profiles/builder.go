@@ -0,0 +1,190 @@
+package profiles
+
+import (
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+)
+
+// Builder assembles a Profile one setting at a time:
+//
+//	p, err := profiles.NewProfile().Frequency(433.92e6).Modulation(profiles.ModGFSK).DataRate(38400).Build()
+//
+// Frequency and DataRate are required. The deviation defaults to half
+// the data rate, or the smallest the CC1111 can do, and the channel bandwidth to the narrowest filter the
+// signal fits in; the rest starts as variable-length packets of up to
+// 255 bytes with a 4-byte preamble, sync word 0xD391 (16/16) and CRC
+type Builder struct {
+	p      Profile
+	freqOK bool
+	rateOK bool
+}
+
+// NewProfile starts a profile with the Builder defaults
+func NewProfile() *Builder {
+	return &Builder{p: Profile{
+		Name:          "custom",
+		Modulation:    Mod2FSK,
+		SyncWord:      0xD391,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenVariable,
+		PktLen:        255,
+		PreambleBytes: 4,
+		CRCEn:         true,
+	}}
+}
+
+// NewProfileFrom starts a builder from a copy of an existing profile
+func NewProfileFrom(p *Profile) *Builder {
+	return &Builder{p: *p, freqOK: p.FrequencyHz > 0, rateOK: p.DataRateBaud > 0}
+}
+
+// Name sets the profile name
+func (b *Builder) Name(name string) *Builder {
+	b.p.Name = name
+	return b
+}
+
+// Description sets the profile description
+func (b *Builder) Description(desc string) *Builder {
+	b.p.Description = desc
+	return b
+}
+
+// Frequency sets the carrier frequency in Hz
+func (b *Builder) Frequency(hz float64) *Builder {
+	b.p.FrequencyHz = hz
+	b.freqOK = true
+	return b
+}
+
+// Modulation sets the modulation to one of the Mod* values
+func (b *Builder) Modulation(mod uint8) *Builder {
+	b.p.Modulation = mod
+	return b
+}
+
+// DataRate sets the data rate in baud
+func (b *Builder) DataRate(baud float64) *Builder {
+	b.p.DataRateBaud = baud
+	b.rateOK = true
+	return b
+}
+
+// Deviation sets the FSK deviation in Hz
+func (b *Builder) Deviation(hz float64) *Builder {
+	b.p.DeviationHz = hz
+	return b
+}
+
+// Bandwidth sets the receive channel filter bandwidth in Hz
+func (b *Builder) Bandwidth(hz float64) *Builder {
+	b.p.ChannelBWHz = hz
+	return b
+}
+
+// Manchester turns Manchester encoding on or off
+func (b *Builder) Manchester(on bool) *Builder {
+	b.p.ManchesterEn = on
+	return b
+}
+
+// Whitening turns data whitening on or off
+func (b *Builder) Whitening(on bool) *Builder {
+	b.p.DataWhiteningEn = on
+	return b
+}
+
+// Sync sets the sync word and one of the Sync* modes
+func (b *Builder) Sync(word uint16, mode uint8) *Builder {
+	b.p.SyncWord = word
+	b.p.SyncMode = mode
+	return b
+}
+
+// NoSync receives and sends without preamble or sync word detection
+func (b *Builder) NoSync() *Builder {
+	return b.Sync(0, SyncNone)
+}
+
+// FixedLength sends packets of exactly n bytes
+func (b *Builder) FixedLength(n uint8) *Builder {
+	b.p.PktLenMode = PktLenFixed
+	b.p.PktLen = n
+	return b
+}
+
+// VariableLength sends a length byte before packets of up to max bytes
+func (b *Builder) VariableLength(max uint8) *Builder {
+	b.p.PktLenMode = PktLenVariable
+	b.p.PktLen = max
+	return b
+}
+
+// InfiniteLength turns the packet length limit off
+func (b *Builder) InfiniteLength() *Builder {
+	b.p.PktLenMode = PktLenInfinite
+	b.p.PktLen = 0
+	return b
+}
+
+// Preamble sets the preamble length in bytes
+func (b *Builder) Preamble(bytes uint8) *Builder {
+	b.p.PreambleBytes = bytes
+	return b
+}
+
+// CRC turns the hardware CRC on or off
+func (b *Builder) CRC(on bool) *Builder {
+	b.p.CRCEn = on
+	return b
+}
+
+// FEC turns forward error correction on or off
+func (b *Builder) FEC(on bool) *Builder {
+	b.p.FECEn = on
+	return b
+}
+
+// TXPower sets the transmit power in dBm; without it the profile uses the
+// band maximum
+func (b *Builder) TXPower(dBm int) *Builder {
+	b.p.SetTXPower(dBm)
+	return b
+}
+
+// Build fills in the defaults and returns the profile, or an error
+// wrapping ErrInvalidProfile describing every setting the CC1111 can't do
+func (b *Builder) Build() (*Profile, error) {
+	switch {
+	case !b.freqOK:
+		return nil, fmt.Errorf("%w: frequency not set", ErrInvalidProfile)
+	case !b.rateOK:
+		return nil, fmt.Errorf("%w: data rate not set", ErrInvalidProfile)
+	}
+
+	p := b.p
+	xtal := CrystalMHzFor(p.FrequencyHz)
+	fsk := p.Modulation == Mod2FSK || p.Modulation == ModGFSK || p.Modulation == Mod4FSK
+	if fsk && p.DeviationHz == 0 {
+		p.DeviationHz = max(p.deviationHz(), DeviationFromReg(0x00, xtal))
+	}
+	if p.ChannelBWHz == 0 {
+		filters := FilterBandwidths(xtal)
+		p.ChannelBWHz = filters[len(filters)-1]
+		for _, bw := range filters {
+			if bw >= p.SignalBandwidth() {
+				p.ChannelBWHz = bw
+				break
+			}
+		}
+	}
+	if p.Description == "" {
+		p.Description = fmt.Sprintf("%.3f MHz %s at %.0f baud", p.FrequencyHz/1e6, cc1111.ModulationName(p.Modulation), p.DataRateBaud)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,62 @@
+package profiles
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+	"github.com/herlein/gocat/pkg/registers"
+)
+
+// FromRegisters reads a profile back from a register configuration, such
+// as a ys1-dump-config dump, so it can be read, edited and saved with
+// SaveToFile. The frequency includes the CHANNR channel offset. The
+// deviation is only set for the FSK modulations, and TXPowerDBm is left
+// unset, the band maximum, when the PA setting in use is the maximum or
+// isn't one of the recommended table values
+func FromRegisters(reg *registers.RegisterMap) *Profile {
+	// A 24 MHz FREQ word above 1 GHz is a CC2510/CC2511 at 2.4 GHz
+	xtal := CrystalMHz
+	if registers.GetFrequency(reg, CrystalMHz) >= 1e9 {
+		xtal = CrystalMHz2511
+	}
+
+	p := &Profile{
+		Modulation:      registers.GetModulation(reg),
+		DataRateBaud:    math.Round(registers.GetDataRate(reg, xtal)),
+		ChannelBWHz:     xtal * 1e6 / (8 * (4 + float64((reg.MDMCFG4>>4)&0x03)) * float64(int(1)<<(reg.MDMCFG4>>6))),
+		ManchesterEn:    reg.MDMCFG2&0x08 != 0,
+		DataWhiteningEn: reg.PKTCTRL0&0x40 != 0,
+		SyncWord:        registers.GetSyncWord(reg),
+		SyncMode:        registers.GetSyncMode(reg),
+		PktLenMode:      reg.PKTCTRL0 & 0x03,
+		PktLen:          reg.PKTLEN,
+		PreambleBytes:   uint8(preambleBytesByReg[(reg.MDMCFG1>>4)&0x07]),
+		CRCEn:           reg.PKTCTRL0&0x04 != 0,
+		FECEn:           reg.MDMCFG1&0x80 != 0,
+	}
+
+	// CHANSPC_E in MDMCFG1[1:0], CHANSPC_M in MDMCFG0
+	spacing := xtal * 1e6 / (1 << 18) * (256 + float64(reg.MDMCFG0)) * float64(int(1)<<(reg.MDMCFG1&0x03))
+	p.FrequencyHz = registers.GetFrequency(reg, xtal) + float64(reg.CHANNR)*spacing
+
+	switch p.Modulation {
+	case Mod2FSK, ModGFSK, Mod4FSK:
+		p.DeviationHz = math.Round(DeviationFromReg(reg.DEVIATN, xtal))
+	}
+
+	if pa := int(reg.FREND0 & 0x07); pa < len(reg.PA_TABLE) && reg.PA_TABLE[pa] != GetMaxPower(p.FrequencyHz) {
+		if dBm, ok := cc1111.PATableDBm(uint32(p.FrequencyHz), reg.PA_TABLE[pa]); ok {
+			p.SetTXPower(int(dBm))
+		}
+	}
+
+	modName := cc1111.ModulationName(p.Modulation)
+	slug := strings.NewReplacer("-", "", "/", "-").Replace(strings.ToLower(modName))
+	mhz := strconv.FormatFloat(math.Round(p.FrequencyHz/1e3)/1e3, 'f', -1, 64)
+	p.Name = fmt.Sprintf("%s-%s-%s", mhz, slug, formatDataRate(p.DataRateBaud))
+	p.Description = fmt.Sprintf("%.3f MHz %s at %.0f baud, read from registers", p.FrequencyHz/1e6, modName, p.DataRateBaud)
+	return p
+}
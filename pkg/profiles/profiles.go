@@ -11,12 +11,25 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/herlein/gocat/pkg/cc1111"
 	"github.com/herlein/gocat/pkg/registers"
 )
 
 // CrystalMHz is the crystal frequency for CC1111 (YardStick One)
 const CrystalMHz = 24.0
 
+// CrystalMHz2511 is the crystal frequency for the 2.4 GHz CC2510/CC2511
+const CrystalMHz2511 = 26.0
+
+// CrystalMHzFor returns the crystal frequency of the chip that tunes
+// freqHz: only the CC2510/CC2511 tune above 1 GHz, at 2.4 GHz
+func CrystalMHzFor(freqHz float64) float64 {
+	if freqHz >= 1e9 {
+		return CrystalMHz2511
+	}
+	return CrystalMHz
+}
+
 // Modulation types
 const (
 	Mod2FSK   = 0x00 // 2-level FSK
@@ -82,20 +95,33 @@ type Profile struct {
 	CRCEn         bool  `json:"crc_enabled"`
 	FECEn         bool  `json:"fec_enabled,omitempty"`
 
-	// Power settings
-	TXPowerDBm int `json:"tx_power_dbm"`
+	// Power settings; unset leaves the PA at the band's maximum, values
+	// from -30 to +10 dBm pick the nearest PA table setting not above them.
+	// TXPower and SetTXPower read and set it without the pointer
+	TXPowerDBm *int `json:"tx_power_dbm,omitempty"`
+
+	// Drift following, for transmitters whose frequency wanders, such as
+	// cheap SAW-resonator sensors (see rxstream.Drift); not a register
+	// setting, receivers that support it read it from the profile
+	DriftAction  string  `json:"drift_action,omitempty"`           // "widen" or "retune"; empty ignores drift
+	DriftMaxBWHz float64 `json:"drift_max_bandwidth_hz,omitempty"` // Widest filter widening may select
 }
 
 // ProfileConfig is the JSON format for storing profile configurations
 type ProfileConfig struct {
+	Version   int                   `json:"schema_version"` // See SchemaVersion
 	Profile   Profile               `json:"profile"`
 	Registers registers.RegisterMap `json:"registers"`
 	Timestamp time.Time             `json:"timestamp"`
+
+	FileVersion int      `json:"-"` // Schema version the file was written with
+	Warnings    []string `json:"-"` // Migration notes and ignored settings from loading
 }
 
 // CalcFreqRegs calculates FREQ2/1/0 register values for a given frequency
+// with the crystal of the chip that tunes it (see CrystalMHzFor)
 func CalcFreqRegs(freqHz float64) (freq2, freq1, freq0 uint8) {
-	freqMult := (65536.0 / 1000000.0) / CrystalMHz
+	freqMult := (65536.0 / 1000000.0) / CrystalMHzFor(freqHz)
 	num := uint32(freqHz * freqMult)
 	freq2 = uint8((num >> 16) & 0xFF)
 	freq1 = uint8((num >> 8) & 0xFF)
@@ -104,8 +130,14 @@ func CalcFreqRegs(freqHz float64) (freq2, freq1, freq0 uint8) {
 }
 
 // CalcDataRateRegs calculates MDMCFG4[3:0] (DRATE_E) and MDMCFG3 (DRATE_M) for a given data rate
+// on the CC1111; see CalcDataRateRegsCrystal for other chips
 func CalcDataRateRegs(drateBaud float64) (drateE, drateM uint8) {
-	crystalHz := CrystalMHz * 1000000.0
+	return CalcDataRateRegsCrystal(drateBaud, CrystalMHz)
+}
+
+// CalcDataRateRegsCrystal is CalcDataRateRegs for a crystal of crystalMHz
+func CalcDataRateRegsCrystal(drateBaud, crystalMHz float64) (drateE, drateM uint8) {
+	crystalHz := crystalMHz * 1000000.0
 	for e := uint8(0); e < 16; e++ {
 		m := int((drateBaud*math.Pow(2, 28)/(math.Pow(2, float64(e))*crystalHz) - 256) + 0.5)
 		if m >= 0 && m < 256 {
@@ -118,9 +150,15 @@ func CalcDataRateRegs(drateBaud float64) (drateE, drateM uint8) {
 	return 15, 255
 }
 
-// CalcChannelBWRegs calculates MDMCFG4[7:4] for channel bandwidth
+// CalcChannelBWRegs calculates MDMCFG4[7:4] for channel bandwidth on the
+// CC1111; see CalcChannelBWRegsCrystal for other chips
 func CalcChannelBWRegs(bwHz float64) (chanbwE, chanbwM uint8) {
-	crystalHz := CrystalMHz * 1000000.0
+	return CalcChannelBWRegsCrystal(bwHz, CrystalMHz)
+}
+
+// CalcChannelBWRegsCrystal is CalcChannelBWRegs for a crystal of crystalMHz
+func CalcChannelBWRegsCrystal(bwHz, crystalMHz float64) (chanbwE, chanbwM uint8) {
+	crystalHz := crystalMHz * 1000000.0
 	for e := uint8(0); e < 4; e++ {
 		m := int((crystalHz/(bwHz*math.Pow(2, float64(e))*8.0) - 4) + 0.5)
 		if m >= 0 && m < 4 {
@@ -133,9 +171,15 @@ func CalcChannelBWRegs(bwHz float64) (chanbwE, chanbwM uint8) {
 	return 0, 0
 }
 
-// CalcDeviationRegs calculates DEVIATN register for FSK deviation
+// CalcDeviationRegs calculates DEVIATN register for FSK deviation on the
+// CC1111; see CalcDeviationRegsCrystal for other chips
 func CalcDeviationRegs(devHz float64) uint8 {
-	crystalHz := CrystalMHz * 1000000.0
+	return CalcDeviationRegsCrystal(devHz, CrystalMHz)
+}
+
+// CalcDeviationRegsCrystal is CalcDeviationRegs for a crystal of crystalMHz
+func CalcDeviationRegsCrystal(devHz, crystalMHz float64) uint8 {
+	crystalHz := crystalMHz * 1000000.0
 	for e := uint8(0); e < 8; e++ {
 		m := int((devHz*math.Pow(2, 17)/(math.Pow(2, float64(e))*crystalHz) - 8) + 0.5)
 		if m >= 0 && m < 8 {
@@ -154,12 +198,27 @@ func GetMaxPower(freqHz float64) uint8 {
 		return 0xC0
 	} else if freqHz <= 849000000 {
 		return 0xC2
+	} else if freqHz < 1e9 {
+		return 0xC0
+	}
+	return 0xFF // CC2510/CC2511, +1 dBm
+}
+
+// GetPower returns the PA_TABLE value for dBm at a given frequency: the
+// highest setting not above dBm, clamped to the table
+func GetPower(freqHz float64, dBm int) uint8 {
+	value, _, err := cc1111.PATableValue(uint32(freqHz), float64(max(dBm, MinTXPowerDBm)))
+	if err != nil {
+		return GetMaxPower(freqHz)
 	}
-	return 0xC0
+	return value
 }
 
 // GetVCOSelection returns FSCAL2 value based on frequency
 func GetVCOSelection(freqHz float64) uint8 {
+	if freqHz >= 1e9 {
+		return 0x0A // CC2510/CC2511
+	}
 	// VCO selection thresholds for each band
 	if freqHz < 318000000 || (freqHz >= 391000000 && freqHz < 424000000) || (freqHz >= 782000000 && freqHz < 848000000) {
 		return 0x0A // Low VCO
@@ -191,6 +250,20 @@ func PreambleBytesToReg(bytes uint8) uint8 {
 	}
 }
 
+// TXPower returns the transmit power in dBm and whether one is set; an
+// unset power is the band's maximum
+func (p *Profile) TXPower() (int, bool) {
+	if p.TXPowerDBm == nil {
+		return 0, false
+	}
+	return *p.TXPowerDBm, true
+}
+
+// SetTXPower sets the transmit power in dBm
+func (p *Profile) SetTXPower(dBm int) {
+	p.TXPowerDBm = &dBm
+}
+
 // ToRegisters converts a Profile to a RegisterMap
 func (p *Profile) ToRegisters() *registers.RegisterMap {
 	reg := &registers.RegisterMap{}
@@ -205,8 +278,9 @@ func (p *Profile) ToRegisters() *registers.RegisterMap {
 	reg.FSCAL2 = GetVCOSelection(p.FrequencyHz)
 
 	// Data rate and channel bandwidth
-	drateE, drateM := CalcDataRateRegs(p.DataRateBaud)
-	chanbwE, chanbwM := CalcChannelBWRegs(p.ChannelBWHz)
+	xtal := CrystalMHzFor(p.FrequencyHz)
+	drateE, drateM := CalcDataRateRegsCrystal(p.DataRateBaud, xtal)
+	chanbwE, chanbwM := CalcChannelBWRegsCrystal(p.ChannelBWHz, xtal)
 	reg.MDMCFG4 = (chanbwE << 6) | (chanbwM << 4) | drateE
 	reg.MDMCFG3 = drateM
 
@@ -219,10 +293,10 @@ func (p *Profile) ToRegisters() *registers.RegisterMap {
 	// Deviation (for FSK modes)
 	if p.Modulation == Mod2FSK || p.Modulation == ModGFSK || p.Modulation == Mod4FSK {
 		if p.DeviationHz > 0 {
-			reg.DEVIATN = CalcDeviationRegs(p.DeviationHz)
+			reg.DEVIATN = CalcDeviationRegsCrystal(p.DeviationHz, xtal)
 		} else {
 			// Default deviation based on data rate
-			reg.DEVIATN = CalcDeviationRegs(p.DataRateBaud * 0.5)
+			reg.DEVIATN = CalcDeviationRegsCrystal(p.DataRateBaud*0.5, xtal)
 		}
 	}
 
@@ -251,14 +325,17 @@ func (p *Profile) ToRegisters() *registers.RegisterMap {
 	reg.PKTCTRL1 = 0x04 // Append status bytes (RSSI, LQI, CRC OK)
 
 	// Power amplifier
-	maxPower := GetMaxPower(p.FrequencyHz)
+	power := GetMaxPower(p.FrequencyHz)
+	if dBm, ok := p.TXPower(); ok {
+		power = GetPower(p.FrequencyHz, dBm)
+	}
 	if p.Modulation == ModASKOOK {
 		// ASK/OOK uses PA_TABLE0=0x00, PA_TABLE1=power
 		reg.PA_TABLE[0] = 0x00
-		reg.PA_TABLE[1] = maxPower
+		reg.PA_TABLE[1] = power
 		reg.FREND0 = 0x11 // Use PA_TABLE[1] for TX
 	} else {
-		reg.PA_TABLE[0] = maxPower
+		reg.PA_TABLE[0] = power
 		reg.PA_TABLE[1] = 0x00
 		reg.FREND0 = 0x10 // Use PA_TABLE[0] for TX
 	}
@@ -288,6 +365,12 @@ func (p *Profile) ToRegisters() *registers.RegisterMap {
 	reg.FSCAL3 = 0xE9
 	reg.FSCAL1 = 0x00
 	reg.FSCAL0 = 0x1F
+	if xtal == CrystalMHz2511 {
+		// CC2510/CC2511 synthesizer values (SmartRF Studio)
+		reg.FSCAL3 = 0xA9
+		reg.FSCAL0 = 0x11
+		reg.TEST0 = 0x0B
+	}
 
 	// AGC settings (defaults)
 	reg.AGCCTRL2 = 0x03
@@ -318,6 +401,7 @@ func (p *Profile) ToRegisters() *registers.RegisterMap {
 // SaveToFile saves a profile configuration to a JSON file
 func (p *Profile) SaveToFile(filepath string) error {
 	config := ProfileConfig{
+		Version:   SchemaVersion,
 		Profile:   *p,
 		Registers: *p.ToRegisters(),
 		Timestamp: time.Now(),
@@ -331,19 +415,11 @@ func (p *Profile) SaveToFile(filepath string) error {
 	return os.WriteFile(filepath, data, 0644)
 }
 
-// LoadProfileFromFile loads a profile configuration from a JSON file
+// LoadProfileFromFile loads a profile configuration from a JSON file,
+// upgrading older schema versions and ignoring unknown fields
+// (LoadLenient); see LoadProfileFile
 func LoadProfileFromFile(path string) (*ProfileConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read profile file: %w", err)
-	}
-
-	var config ProfileConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal profile: %w", err)
-	}
-
-	return &config, nil
+	return LoadProfileFile(path, LoadLenient)
 }
 
 // EnsureDir ensures the directory for a file path exists
@@ -0,0 +1,85 @@
+package profiles
+
+import "fmt"
+
+// 2.4 GHz Band Profile Factories
+// These create profiles for the 2400-2483.5 MHz ISM band, for CC2510/CC2511
+// dongles (IMME, Chronos) with a 26 MHz crystal.
+
+// New2400MSK creates a 2.4 GHz MSK profile for fast packet links
+// dataRate: 250000 or 500000 baud
+func New2400MSK(dataRate float64) *Profile {
+	bw := 406250.0
+	if dataRate > 250000 {
+		bw = 812500
+	}
+	return &Profile{
+		Name:          fmt.Sprintf("2400-msk-%s", formatDataRate(dataRate)),
+		Description:   fmt.Sprintf("2.4 GHz MSK at %.0f baud for fast packet links", dataRate),
+		FrequencyHz:   2433000000,
+		Modulation:    ModMSK,
+		DataRateBaud:  dataRate,
+		ChannelBWHz:   bw,
+		SyncWord:      0xD391,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenVariable,
+		PktLen:        60,
+		PreambleBytes: 4,
+		CRCEn:         true,
+	}
+}
+
+// New2400GFSK creates a 2.4 GHz GFSK profile for low-rate links
+// dataRate: 10000 or 38400 baud
+func New2400GFSK(dataRate float64) *Profile {
+	deviation, bw := 20000.0, 58000.0
+	if dataRate > 10000 {
+		deviation, bw = 32000, 135000
+	}
+	return &Profile{
+		Name:          fmt.Sprintf("2400-gfsk-%s", formatDataRate(dataRate)),
+		Description:   fmt.Sprintf("2.4 GHz GFSK at %.0f baud for low-rate links", dataRate),
+		FrequencyHz:   2433000000,
+		Modulation:    ModGFSK,
+		DataRateBaud:  dataRate,
+		DeviationHz:   deviation,
+		ChannelBWHz:   bw,
+		SyncWord:      0xD391,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenVariable,
+		PktLen:        60,
+		PreambleBytes: 4,
+		CRCEn:         true,
+	}
+}
+
+// Profiles2400 returns all 2.4 GHz band profile variants
+func Profiles2400() []*Profile {
+	return []*Profile{
+		// 2400-MSK variants
+		New2400MSK(250000),
+		New2400MSK(500000),
+
+		// 2400-GFSK variants
+		New2400GFSK(10000),
+		New2400GFSK(38400),
+	}
+}
+
+// Generate2400Profiles generates all 2.4 GHz band profile configurations
+func Generate2400Profiles(basePath string) error {
+	profiles := Profiles2400()
+
+	if err := EnsureDir(basePath + "/dummy"); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	for _, p := range profiles {
+		filename := fmt.Sprintf("%s/%s.json", basePath, p.Name)
+		if err := p.SaveToFile(filename); err != nil {
+			return fmt.Errorf("failed to save profile %s: %w", p.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -87,9 +87,9 @@ func formatDataRate(rate float64) string {
 	return fmt.Sprintf("%.0f", rate)
 }
 
-// Generate315Profiles generates all 315 MHz band profile configurations
-func Generate315Profiles(basePath string) error {
-	profiles := []*Profile{
+// Profiles315 returns all 315 MHz band profile variants
+func Profiles315() []*Profile {
+	return []*Profile{
 		// 315-OOK-Low variants
 		New315OOKLow(1200),
 		New315OOKLow(2400),
@@ -105,6 +105,11 @@ func Generate315Profiles(basePath string) error {
 		New315FSKSync(9600, false),
 		New315FSKSync(4800, true), // With FEC
 	}
+}
+
+// Generate315Profiles generates all 315 MHz band profile configurations
+func Generate315Profiles(basePath string) error {
+	profiles := Profiles315()
 
 	if err := EnsureDir(basePath + "/dummy"); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
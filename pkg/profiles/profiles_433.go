@@ -161,9 +161,9 @@ func New4334FSK(dataRate float64) *Profile {
 	}
 }
 
-// Generate433Profiles generates all 433 MHz band profile configurations
-func Generate433Profiles(basePath string) error {
-	profiles := []*Profile{
+// Profiles433 returns all 433 MHz band profile variants
+func Profiles433() []*Profile {
+	return []*Profile{
 		// 433-OOK-Keyfob variants
 		New433OOKKeyfob(1200),
 		New433OOKKeyfob(2400),
@@ -198,6 +198,11 @@ func Generate433Profiles(basePath string) error {
 		New4334FSK(100000),
 		New4334FSK(200000),
 	}
+}
+
+// Generate433Profiles generates all 433 MHz band profile configurations
+func Generate433Profiles(basePath string) error {
+	profiles := Profiles433()
 
 	if err := EnsureDir(basePath + "/dummy"); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
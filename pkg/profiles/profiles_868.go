@@ -114,9 +114,79 @@ func New868GFSKFEC(dataRate float64, whitening bool) *Profile {
 	}
 }
 
-// Generate868Profiles generates all 868 MHz band profile configurations
-func Generate868Profiles(basePath string) error {
-	profiles := []*Profile{
+// Wireless M-Bus (EN 13757-4) modes, for receiving smart meters. The
+// radio cannot parse the length field (it is 3-of-6 coded in T1 and
+// counts bytes without the block CRCs), so packets are fixed blocks of
+// 255 bytes from the sync word, with hardware CRC off; pkg/decoders/wmbus
+// finds the frame in them and checks the CRC of every block.
+
+// New868WMBusS1 creates a wM-Bus S1 profile: stationary meters sending
+// rarely, 32.768 kchip/s Manchester 2-FSK at 868.3 MHz, +/-50 kHz, after
+// the chips 0x7696
+func New868WMBusS1() *Profile {
+	return &Profile{
+		Name:          "868-wmbus-s1",
+		Description:   "868.3 MHz wM-Bus S1: 2-FSK+Manchester at 32768 chips/s for smart meters",
+		FrequencyHz:   868300000,
+		Modulation:    Mod2FSK,
+		DataRateBaud:  32768,
+		DeviationHz:   50000,
+		ChannelBWHz:   270000,
+		ManchesterEn:  true,
+		SyncWord:      0x7696,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenFixed,
+		PktLen:        255,
+		PreambleBytes: 4,
+		CRCEn:         false,
+	}
+}
+
+// New868WMBusT1 creates a wM-Bus T1 profile: frequent meter-to-collector
+// readings, 100 kchip/s 2-FSK at 868.95 MHz, +/-50 kHz, 3-of-6 coded
+// after the chips 0x543D
+func New868WMBusT1() *Profile {
+	return &Profile{
+		Name:          "868-wmbus-t1",
+		Description:   "868.95 MHz wM-Bus T1: 2-FSK at 100000 chips/s, 3-of-6 coded, for smart meters",
+		FrequencyHz:   868950000,
+		Modulation:    Mod2FSK,
+		DataRateBaud:  100000,
+		DeviationHz:   50000,
+		ChannelBWHz:   325000,
+		SyncWord:      0x543D,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenFixed,
+		PktLen:        255,
+		PreambleBytes: 4,
+		CRCEn:         false,
+	}
+}
+
+// New868WMBusC1 creates a wM-Bus C1 profile: compact meter-to-collector
+// frames, 100 kbit/s NRZ 2-FSK at 868.95 MHz, +/-45 kHz. The sync word is
+// 0x543D, followed by 0x54CD for frame format A or 0x543D for format B
+func New868WMBusC1() *Profile {
+	return &Profile{
+		Name:          "868-wmbus-c1",
+		Description:   "868.95 MHz wM-Bus C1: 2-FSK at 100000 baud NRZ for smart meters",
+		FrequencyHz:   868950000,
+		Modulation:    Mod2FSK,
+		DataRateBaud:  100000,
+		DeviationHz:   45000,
+		ChannelBWHz:   325000,
+		SyncWord:      0x543D,
+		SyncMode:      Sync16of16,
+		PktLenMode:    PktLenFixed,
+		PktLen:        255,
+		PreambleBytes: 4,
+		CRCEn:         false,
+	}
+}
+
+// Profiles868 returns all 868 MHz band profile variants
+func Profiles868() []*Profile {
+	return []*Profile{
 		// 868-OOK-Simple variants
 		New868OOKSimple(1200),
 		New868OOKSimple(4800),
@@ -141,7 +211,17 @@ func Generate868Profiles(basePath string) error {
 		New868GFSKFEC(19200, false),
 		New868GFSKFEC(38400, false),
 		New868GFSKFEC(19200, true), // With whitening
+
+		// 868-wM-Bus modes
+		New868WMBusS1(),
+		New868WMBusT1(),
+		New868WMBusC1(),
 	}
+}
+
+// Generate868Profiles generates all 868 MHz band profile configurations
+func Generate868Profiles(basePath string) error {
+	profiles := Profiles868()
 
 	if err := EnsureDir(basePath + "/dummy"); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
@@ -148,9 +148,9 @@ func New915Max(dataRate float64) *Profile {
 	}
 }
 
-// Generate915Profiles generates all 915 MHz band profile configurations
-func Generate915Profiles(basePath string) error {
-	profiles := []*Profile{
+// Profiles915 returns all 915 MHz band profile variants
+func Profiles915() []*Profile {
+	return []*Profile{
 		// 915-OOK-TPMS variants
 		New915OOKTPMS(4800, false),
 		New915OOKTPMS(9600, false),
@@ -181,6 +181,11 @@ func Generate915Profiles(basePath string) error {
 		New915Max(250000),
 		New915Max(500000),
 	}
+}
+
+// Generate915Profiles generates all 915 MHz band profile configurations
+func Generate915Profiles(basePath string) error {
+	profiles := Profiles915()
 
 	if err := EnsureDir(basePath + "/dummy"); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
@@ -0,0 +1,81 @@
+package profiles
+
+import "fmt"
+
+// Promiscuous Listen-Only Profiles
+// These turn rough signal estimates from the scanner into a permissive RX
+// configuration so an unknown transmission can be captured without first
+// knowing its sync word, packet format or exact modulation parameters.
+
+// SignalEstimate describes a detected but not yet decoded signal
+// Zero fields are filled with conservative defaults
+type SignalEstimate struct {
+	FrequencyHz    float64 // Center frequency
+	BandwidthHz    float64 // Occupied bandwidth, e.g. specan.PeakBandwidth
+	SymbolRateBaud float64 // Estimated symbol rate (0 = unknown)
+	Modulation     uint8   // One of the Mod* constants
+}
+
+// Promiscuous profile limits
+const (
+	PromiscuousDefaultBaud = 4800   // Used when the symbol rate is unknown
+	PromiscuousMinBWHz     = 58000  // Narrowest CC1111 channel filter
+	PromiscuousMaxBWHz     = 812000 // Widest CC1111 channel filter
+	PromiscuousMaxBaud     = 500000 // CC1111 data rate ceiling
+	PromiscuousMinBaud     = 600    // Practical lower bound
+	PromiscuousPktLen      = 255    // Longest fixed-length capture
+)
+
+// NewPromiscuous creates a listen-only profile for an unknown signal
+// RX triggers on carrier sense instead of a sync word, packets are fixed
+// at the maximum length and CRC/whitening are off so every burst is
+// captured raw for offline analysis
+func NewPromiscuous(est SignalEstimate) *Profile {
+	baud := est.SymbolRateBaud
+	if baud <= 0 {
+		baud = PromiscuousDefaultBaud
+	}
+	if baud < PromiscuousMinBaud {
+		baud = PromiscuousMinBaud
+	}
+	if baud > PromiscuousMaxBaud {
+		baud = PromiscuousMaxBaud
+	}
+
+	// Leave headroom for crystal offset between transmitter and receiver
+	bw := est.BandwidthHz * 1.5
+	if bw < baud*2 {
+		bw = baud * 2
+	}
+	if bw < PromiscuousMinBWHz {
+		bw = PromiscuousMinBWHz
+	}
+	if bw > PromiscuousMaxBWHz {
+		bw = PromiscuousMaxBWHz
+	}
+
+	p := &Profile{
+		Name:          fmt.Sprintf("promisc-%.3f", est.FrequencyHz/1e6),
+		Description:   fmt.Sprintf("Listen-only capture at %.3f MHz, %.0f baud", est.FrequencyHz/1e6, baud),
+		FrequencyHz:   est.FrequencyHz,
+		Modulation:    est.Modulation,
+		DataRateBaud:  baud,
+		ChannelBWHz:   bw,
+		SyncMode:      SyncCarrier,
+		PktLenMode:    PktLenFixed,
+		PktLen:        PromiscuousPktLen,
+		PreambleBytes: 2,
+		CRCEn:         false,
+	}
+
+	// FSK deviation is roughly half the occupied bandwidth minus the
+	// modulation sidebands
+	if est.Modulation != ModASKOOK && est.BandwidthHz > 0 {
+		dev := (est.BandwidthHz - baud) / 2
+		if dev > 0 {
+			p.DeviationHz = dev
+		}
+	}
+
+	return p
+}
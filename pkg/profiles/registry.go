@@ -0,0 +1,35 @@
+package profiles
+
+import "sort"
+
+// All returns every built-in profile across all bands
+func All() []*Profile {
+	var all []*Profile
+	all = append(all, Profiles315()...)
+	all = append(all, Profiles433()...)
+	all = append(all, Profiles868()...)
+	all = append(all, Profiles915()...)
+	all = append(all, Profiles2400()...)
+	return all
+}
+
+// Names returns the sorted names of all built-in profiles
+func Names() []string {
+	all := All()
+	names := make([]string, len(all))
+	for i, p := range all {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Find returns the built-in profile with the given name, or nil
+func Find(name string) *Profile {
+	for _, p := range All() {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
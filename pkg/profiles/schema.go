@@ -0,0 +1,174 @@
+package profiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+)
+
+// SchemaVersion is the profile file schema written by SaveToFile
+// Version 0 is the original unversioned format
+//
+// Version 1: tx_power_dbm is applied by ToRegisters; it is left out for
+// the band maximum
+const SchemaVersion = 1
+
+// ErrProfileSchema is returned by strict loads of profile files with
+// unknown fields or a newer schema version
+var ErrProfileSchema = errors.New("unsupported profile schema")
+
+// LoadMode selects how fields and versions this build doesn't know are
+// treated when loading a profile file
+type LoadMode int
+
+const (
+	// LoadLenient ignores unknown fields and reads files written by newer
+	// versions, noting both in ProfileConfig.Warnings
+	LoadLenient LoadMode = iota
+	// LoadStrict rejects unknown fields and newer versions with
+	// ErrProfileSchema
+	LoadStrict
+)
+
+// migrations[v] upgrades a version v document to version v+1 in place
+// and returns notes on anything it couldn't carry over exactly
+var migrations = []func(doc map[string]interface{}) []string{
+	migrateV0,
+}
+
+// savedPA returns a document's profile and the PA table setting its saved
+// registers transmit with
+func savedPA(doc map[string]interface{}) (profile map[string]interface{}, freq float64, pa uint8, ok bool) {
+	profile, _ = doc["profile"].(map[string]interface{})
+	regs, _ := doc["registers"].(map[string]interface{})
+	if profile == nil || regs == nil {
+		return nil, 0, 0, false
+	}
+	freq, _ = profile["frequency_hz"].(float64)
+	table, _ := regs["pa_table"].([]interface{})
+	frend0, _ := regs["frend0"].(float64)
+	idx := int(frend0) & 0x07
+	if idx >= len(table) {
+		return nil, 0, 0, false
+	}
+	v, _ := table[idx].(float64)
+	return profile, freq, uint8(v), true
+}
+
+// migrateV0 sets tx_power_dbm from the saved PA table, leaving it out for
+// the band maximum. Version 0 never applied tx_power_dbm, so the registers
+// hold the power actually used
+func migrateV0(doc map[string]interface{}) []string {
+	profile, freq, pa, ok := savedPA(doc)
+	if !ok {
+		return nil
+	}
+	dBm, ok := cc1111.PATableDBm(uint32(freq), pa)
+	switch {
+	case !ok:
+		delete(profile, "tx_power_dbm")
+		return []string{fmt.Sprintf("PA setting 0x%02X is not a table value; tx_power_dbm left out", pa)}
+	case pa == GetMaxPower(freq):
+		delete(profile, "tx_power_dbm")
+	default:
+		profile["tx_power_dbm"] = dBm
+	}
+	return nil
+}
+
+// ParseProfileConfig decodes a profile file, upgrading older schema
+// versions to SchemaVersion. Version holds SchemaVersion afterwards and
+// FileVersion the version the file was written with
+func ParseProfileConfig(data []byte, mode LoadMode) (*ProfileConfig, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal profile: %w", err)
+	}
+
+	version := 0
+	if v, ok := doc["schema_version"]; ok {
+		f, isNum := v.(float64)
+		if !isNum || f < 0 || f != float64(int(f)) {
+			return nil, fmt.Errorf("invalid profile schema_version %v", v)
+		}
+		version = int(f)
+	}
+
+	var warnings []string
+	if version > SchemaVersion {
+		if mode == LoadStrict {
+			return nil, fmt.Errorf("%w: version %d (this build reads up to %d)", ErrProfileSchema, version, SchemaVersion)
+		}
+		warnings = append(warnings, fmt.Sprintf("written with schema version %d, newer than %d; settings this build doesn't know are ignored", version, SchemaVersion))
+	}
+	for v := version; v < SchemaVersion; v++ {
+		for _, note := range migrations[v](doc) {
+			warnings = append(warnings, fmt.Sprintf("migrating from version %d: %s", v, note))
+		}
+	}
+	delete(doc, "schema_version")
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate profile: %w", err)
+	}
+	var config ProfileConfig
+	dec := json.NewDecoder(bytes.NewReader(migrated))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		// The decoder reports unknown fields as `json: unknown field "x"`
+		if !strings.HasPrefix(err.Error(), "json: unknown field") {
+			return nil, fmt.Errorf("failed to unmarshal profile: %w", err)
+		}
+		if mode == LoadStrict {
+			return nil, fmt.Errorf("%w: %s", ErrProfileSchema, strings.TrimPrefix(err.Error(), "json: "))
+		}
+		warnings = append(warnings, strings.TrimPrefix(err.Error(), "json: ")+" ignored")
+		config = ProfileConfig{}
+		if err := json.Unmarshal(migrated, &config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal profile: %w", err)
+		}
+	}
+
+	config.Version = max(version, SchemaVersion)
+	config.FileVersion = version
+	config.Warnings = warnings
+	return &config, nil
+}
+
+// LoadProfileFile loads a profile file in the given mode
+func LoadProfileFile(path string, mode LoadMode) (*ProfileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile file: %w", err)
+	}
+	return ParseProfileConfig(data, mode)
+}
+
+// MigrateProfileFile rewrites a profile file in the current schema when
+// it was written with an older one, keeping its registers and timestamp,
+// and returns the loaded configuration. Files from newer versions are
+// left alone
+func MigrateProfileFile(path string, mode LoadMode) (*ProfileConfig, error) {
+	config, err := LoadProfileFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	if config.FileVersion >= SchemaVersion {
+		return config, nil
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal profile: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write profile file: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,201 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+)
+
+// ErrInvalidProfile is returned when a profile asks for something the
+// CC1111 can't do
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// chipLimits are the tuning, data rate and power limits of a chip family
+type chipLimits struct {
+	name        string
+	bands       [][2]float64
+	bandNames   string
+	rates       map[uint8][2]float64 // Data rate range per modulation, in baud
+	maxPowerDBm int
+}
+
+// CC1111 limits (SWRS033)
+var cc1111Limits = &chipLimits{
+	name:      "CC1111",
+	bands:     [][2]float64{{300e6, 348e6}, {391e6, 464e6}, {782e6, 928e6}},
+	bandNames: "300-348, 391-464 and 782-928 MHz",
+	rates: map[uint8][2]float64{
+		Mod2FSK:   {600, 500000},
+		ModGFSK:   {600, 250000},
+		ModASKOOK: {600, 250000},
+		Mod4FSK:   {600, 300000},
+		ModMSK:    {26000, 500000},
+	},
+	maxPowerDBm: MaxTXPowerDBm,
+}
+
+// CC2510/CC2511 limits (SWRS055); there is no ASK/OOK or 4-FSK
+var cc2511Limits = &chipLimits{
+	name:      "CC2511",
+	bands:     [][2]float64{{2400e6, 2483.5e6}},
+	bandNames: "2400-2483.5 MHz",
+	rates: map[uint8][2]float64{
+		Mod2FSK: {1200, 500000},
+		ModGFSK: {1200, 250000},
+		ModMSK:  {26000, 500000},
+	},
+	maxPowerDBm: MaxTXPowerDBm2511,
+}
+
+// TX power range of the CC1111 PA tables, in dBm
+const (
+	MinTXPowerDBm = -30
+	MaxTXPowerDBm = 10
+)
+
+// MaxTXPowerDBm2511 is the highest CC2510/CC2511 PA table setting, in dBm
+const MaxTXPowerDBm2511 = 1
+
+// limits returns the limits of the chip that tunes the profile
+func (p *Profile) limits() *chipLimits {
+	if CrystalMHzFor(p.FrequencyHz) == CrystalMHz2511 {
+		return cc2511Limits
+	}
+	return cc1111Limits
+}
+
+// deviationHz returns the deviation ToRegisters programs: DeviationHz,
+// or half the data rate when it is unset
+func (p *Profile) deviationHz() float64 {
+	if p.DeviationHz > 0 {
+		return p.DeviationHz
+	}
+	return p.DataRateBaud * 0.5
+}
+
+// SignalBandwidth returns the approximate occupied bandwidth of the
+// profile's signal: Carson's rule for FSK, 1.5 times the rate for MSK and
+// twice the rate for ASK/OOK
+func (p *Profile) SignalBandwidth() float64 {
+	switch p.Modulation {
+	case ModASKOOK:
+		return 2 * p.DataRateBaud
+	case ModMSK:
+		return 1.5 * p.DataRateBaud
+	}
+	return p.DataRateBaud + 2*p.deviationHz()
+}
+
+// FilterBandwidth returns the receive filter bandwidth CalcChannelBWRegs
+// selects for bwHz with the given crystal
+func FilterBandwidth(bwHz, crystalMHz float64) float64 {
+	e, m := CalcChannelBWRegsCrystal(bwHz, crystalMHz)
+	return crystalMHz * 1e6 / (8 * (4 + float64(m)) * math.Pow(2, float64(e)))
+}
+
+// FilterBandwidths returns the receive filter bandwidths with the given
+// crystal, narrowest first
+func FilterBandwidths(crystalMHz float64) []float64 {
+	bws := make([]float64, 0, 16)
+	for e := 3; e >= 0; e-- {
+		for m := 3; m >= 0; m-- {
+			bws = append(bws, crystalMHz*1e6/(8*float64(4+m)*float64(int(1)<<e)))
+		}
+	}
+	return bws
+}
+
+// DeviationFromReg returns the deviation a DEVIATN value gives with the
+// given crystal
+func DeviationFromReg(deviatn uint8, crystalMHz float64) float64 {
+	e := float64((deviatn >> 4) & 0x07)
+	m := float64(deviatn & 0x07)
+	return crystalMHz * 1e6 / (1 << 17) * (8 + m) * math.Pow(2, e)
+}
+
+// Validate checks the profile against the limits of the chip that tunes
+// it, the CC1111 or at 2.4 GHz the CC2511, and returns every problem
+// found, wrapped in ErrInvalidProfile
+func (p *Profile) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	modName := cc1111.ModulationName(p.Modulation)
+	chip := p.limits()
+	xtal := CrystalMHzFor(p.FrequencyHz)
+
+	inBand := false
+	for _, b := range chip.bands {
+		if p.FrequencyHz >= b[0] && p.FrequencyHz <= b[1] {
+			inBand = true
+		}
+	}
+	if !inBand {
+		add("frequency %.3f MHz is outside the %s bands %s", p.FrequencyHz/1e6, chip.name, chip.bandNames)
+	}
+
+	limits, ok := chip.rates[p.Modulation]
+	if !ok {
+		add("modulation %s is not supported by the %s", modName, chip.name)
+	} else if p.DataRateBaud < limits[0] || p.DataRateBaud > limits[1] {
+		add("data rate %.0f baud is outside the %s range of %.0f-%.0f baud", p.DataRateBaud, modName, limits[0], limits[1])
+	}
+
+	fsk := p.Modulation == Mod2FSK || p.Modulation == ModGFSK || p.Modulation == Mod4FSK
+	if fsk {
+		minDev, maxDev := DeviationFromReg(0x00, xtal), DeviationFromReg(0x77, xtal)
+		if dev := p.deviationHz(); dev < minDev || dev > maxDev {
+			add("deviation %.0f Hz is outside the %.0f-%.0f Hz range", dev, minDev, maxDev)
+		}
+	}
+
+	filters := FilterBandwidths(xtal)
+	minBW, maxBW := filters[0], filters[len(filters)-1]
+	if p.ChannelBWHz < minBW*0.9 || p.ChannelBWHz > maxBW*1.1 {
+		add("channel bandwidth %.0f Hz is outside the %.0f-%.0f Hz filter range", p.ChannelBWHz, minBW, maxBW)
+	} else if ok {
+		if filter, signal := FilterBandwidth(p.ChannelBWHz, xtal), p.SignalBandwidth(); filter < signal {
+			add("channel filter %.0f Hz is narrower than the %.0f Hz %s signal at %.0f baud", filter, signal, modName, p.DataRateBaud)
+		}
+	}
+
+	if p.ManchesterEn {
+		switch {
+		case p.Modulation == Mod4FSK || p.Modulation == ModMSK:
+			add("Manchester encoding is not supported with %s", modName)
+		case p.FECEn:
+			add("Manchester encoding can't be combined with FEC")
+		}
+	}
+	if p.FECEn && p.PktLenMode != PktLenFixed {
+		add("FEC needs fixed packet length mode")
+	}
+
+	switch p.PktLenMode {
+	case PktLenFixed, PktLenVariable:
+		if p.PktLen == 0 {
+			add("packet length must be at least 1 byte")
+		}
+	case PktLenInfinite:
+	default:
+		add("unknown packet length mode %d", p.PktLenMode)
+	}
+	if p.SyncMode > SyncCarrier30of32 {
+		add("unknown sync mode %d", p.SyncMode)
+	}
+	if PreambleBytesToReg(p.PreambleBytes) == Preamble4 && p.PreambleBytes != 4 {
+		add("preamble of %d bytes is not one of 2, 3, 4, 6, 8, 12, 16 or 24", p.PreambleBytes)
+	}
+	if dBm, ok := p.TXPower(); ok && (dBm < MinTXPowerDBm || dBm > chip.maxPowerDBm) {
+		add("TX power %d dBm is outside the %s range of %d to +%d dBm", dBm, chip.name, MinTXPowerDBm, chip.maxPowerDBm)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidProfile, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -152,47 +152,128 @@ func ReadAllRegisters(device *yardstick.Device) (*RegisterMap, error) {
 	return reg, nil
 }
 
+// WritableRegisters is the number of configuration registers
+// WriteAllRegisters writes
+const WritableRegisters = 32 + 3 + 11
+
+// registerBlock is a run of writable registers starting at addr
+type registerBlock struct {
+	addr uint16
+	data []byte
+	name string
+}
+
+// writableBlocks lays out the writable configuration registers of a
+// RegisterMap as they sit in memory
+func writableBlocks(reg *RegisterMap) []registerBlock {
+	return []registerBlock{
+		// Registers 0xDF00 - 0xDF1F (32 bytes)
+		{0xDF00, []byte{
+			reg.SYNC1, reg.SYNC0,
+			reg.PKTLEN, reg.PKTCTRL1, reg.PKTCTRL0, reg.ADDR, reg.CHANNR,
+			reg.FSCTRL1, reg.FSCTRL0,
+			reg.FREQ2, reg.FREQ1, reg.FREQ0,
+			reg.MDMCFG4, reg.MDMCFG3, reg.MDMCFG2, reg.MDMCFG1, reg.MDMCFG0,
+			reg.DEVIATN,
+			reg.MCSM2, reg.MCSM1, reg.MCSM0,
+			reg.FOCCFG, reg.BSCFG,
+			reg.AGCCTRL2, reg.AGCCTRL1, reg.AGCCTRL0,
+			reg.FREND1, reg.FREND0,
+			reg.FSCAL3, reg.FSCAL2, reg.FSCAL1, reg.FSCAL0,
+		}, "register block 1"},
+		// TEST registers (0xDF23 - 0xDF25)
+		{0xDF23, []byte{reg.TEST2, reg.TEST1, reg.TEST0}, "TEST registers"},
+		// PA_TABLE and IOCFG (0xDF27 - 0xDF31)
+		{0xDF27, []byte{
+			reg.PA_TABLE[7], reg.PA_TABLE[6], reg.PA_TABLE[5], reg.PA_TABLE[4],
+			reg.PA_TABLE[3], reg.PA_TABLE[2], reg.PA_TABLE[1], reg.PA_TABLE[0],
+			reg.IOCFG2, reg.IOCFG1, reg.IOCFG0,
+		}, "PA_TABLE/IOCFG"},
+		// Note: Status registers (0xDF36 - 0xDF3D) are read-only
+	}
+}
+
 // WriteAllRegisters writes all writable radio configuration registers from a RegisterMap
 func WriteAllRegisters(device *yardstick.Device, reg *RegisterMap) error {
-	// Write registers 0xDF00 - 0xDF1F (32 bytes)
-	block1 := []byte{
-		reg.SYNC1, reg.SYNC0,
-		reg.PKTLEN, reg.PKTCTRL1, reg.PKTCTRL0, reg.ADDR, reg.CHANNR,
-		reg.FSCTRL1, reg.FSCTRL0,
-		reg.FREQ2, reg.FREQ1, reg.FREQ0,
-		reg.MDMCFG4, reg.MDMCFG3, reg.MDMCFG2, reg.MDMCFG1, reg.MDMCFG0,
-		reg.DEVIATN,
-		reg.MCSM2, reg.MCSM1, reg.MCSM0,
-		reg.FOCCFG, reg.BSCFG,
-		reg.AGCCTRL2, reg.AGCCTRL1, reg.AGCCTRL0,
-		reg.FREND1, reg.FREND0,
-		reg.FSCAL3, reg.FSCAL2, reg.FSCAL1, reg.FSCAL0,
-	}
-	if err := device.Poke(0xDF00, block1); err != nil {
-		return fmt.Errorf("failed to write register block 1: %w", err)
+	for _, b := range writableBlocks(reg) {
+		if err := device.Poke(b.addr, b.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", b.name, err)
+		}
 	}
+	return nil
+}
 
-	// Write TEST registers (0xDF23 - 0xDF25)
-	block2 := []byte{reg.TEST2, reg.TEST1, reg.TEST0}
-	if err := device.Poke(0xDF23, block2); err != nil {
-		return fmt.Errorf("failed to write TEST registers: %w", err)
+// WriteChangedRegisters writes only the registers that differ between
+// from, what the radio currently holds, and to. Each run of changed
+// registers is one poke; the number of registers written is returned
+func WriteChangedRegisters(device *yardstick.Device, from, to *RegisterMap) (int, error) {
+	old := writableBlocks(from)
+	written := 0
+	for i, b := range writableBlocks(to) {
+		for j := 0; j < len(b.data); j++ {
+			if b.data[j] == old[i].data[j] {
+				continue
+			}
+			end := j + 1
+			for end < len(b.data) && b.data[end] != old[i].data[end] {
+				end++
+			}
+			addr := b.addr + uint16(j)
+			if err := device.Poke(addr, b.data[j:end]); err != nil {
+				return written, fmt.Errorf("failed to write %s at 0x%04X: %w", b.name, addr, err)
+			}
+			written += end - j
+			j = end
+		}
 	}
+	return written, nil
+}
 
-	// Write PA_TABLE and IOCFG (0xDF27 - 0xDF31)
-	block3 := []byte{
-		reg.PA_TABLE[7], reg.PA_TABLE[6], reg.PA_TABLE[5], reg.PA_TABLE[4],
-		reg.PA_TABLE[3], reg.PA_TABLE[2], reg.PA_TABLE[1], reg.PA_TABLE[0],
-		reg.IOCFG2, reg.IOCFG1, reg.IOCFG0,
+// fieldAt returns the writable configuration register at addr, or nil
+// for reserved and read-only addresses
+func (r *RegisterMap) fieldAt(addr uint16) *uint8 {
+	block1 := []*uint8{
+		&r.SYNC1, &r.SYNC0,
+		&r.PKTLEN, &r.PKTCTRL1, &r.PKTCTRL0, &r.ADDR, &r.CHANNR,
+		&r.FSCTRL1, &r.FSCTRL0,
+		&r.FREQ2, &r.FREQ1, &r.FREQ0,
+		&r.MDMCFG4, &r.MDMCFG3, &r.MDMCFG2, &r.MDMCFG1, &r.MDMCFG0,
+		&r.DEVIATN,
+		&r.MCSM2, &r.MCSM1, &r.MCSM0,
+		&r.FOCCFG, &r.BSCFG,
+		&r.AGCCTRL2, &r.AGCCTRL1, &r.AGCCTRL0,
+		&r.FREND1, &r.FREND0,
+		&r.FSCAL3, &r.FSCAL2, &r.FSCAL1, &r.FSCAL0,
 	}
-	if err := device.Poke(0xDF27, block3); err != nil {
-		return fmt.Errorf("failed to write PA_TABLE/IOCFG: %w", err)
+	switch {
+	case addr >= RegSYNC1 && addr <= RegFSCAL0:
+		return block1[addr-RegSYNC1]
+	case addr >= RegTEST2 && addr <= RegTEST0:
+		return []*uint8{&r.TEST2, &r.TEST1, &r.TEST0}[addr-RegTEST2]
+	case addr >= RegPA_TABLE7 && addr <= RegPA_TABLE0:
+		return &r.PA_TABLE[RegPA_TABLE0-addr]
+	case addr >= RegIOCFG2 && addr <= RegIOCFG0:
+		return []*uint8{&r.IOCFG2, &r.IOCFG1, &r.IOCFG0}[addr-RegIOCFG2]
 	}
-
-	// Note: Status registers (0xDF36 - 0xDF3D) are read-only
-
 	return nil
 }
 
+// WithPoke returns a copy of the registers with data written at address,
+// so the configuration a device recorded with SetApplied follows single
+// register writes (see yardstick.PokeTracker). Writes that reach past the
+// writable configuration registers report false
+func (r *RegisterMap) WithPoke(address uint16, data []byte) (interface{}, bool) {
+	next := *r
+	for i, b := range data {
+		f := next.fieldAt(address + uint16(i))
+		if f == nil {
+			return nil, false
+		}
+		*f = b
+	}
+	return &next, true
+}
+
 // GetFrequency calculates the carrier frequency in Hz from the register values
 // crystalMHz should be 24 for CC1110/CC1111, 26 for CC2510/CC2511
 func GetFrequency(reg *RegisterMap, crystalMHz float64) float64 {
@@ -209,6 +290,14 @@ func SetFrequency(reg *RegisterMap, frequencyHz float64, crystalMHz float64) {
 	reg.FREQ0 = uint8(freq & 0xFF)
 }
 
+// GetDataRate calculates the data rate in baud from MDMCFG4/MDMCFG3
+// crystalMHz should be 24 for CC1110/CC1111, 26 for CC2510/CC2511
+func GetDataRate(reg *RegisterMap, crystalMHz float64) float64 {
+	drateE := uint(reg.MDMCFG4 & 0x0F)
+	drateM := float64(reg.MDMCFG3)
+	return (256 + drateM) * float64(uint32(1)<<drateE) * crystalMHz * 1e6 / float64(uint32(1)<<28)
+}
+
 // GetSyncWord returns the 16-bit sync word from the register map
 func GetSyncWord(reg *RegisterMap) uint16 {
 	return uint16(reg.SYNC1)<<8 | uint16(reg.SYNC0)
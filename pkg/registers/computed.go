@@ -0,0 +1,78 @@
+package registers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Radio parameters computed from the registers at CrystalMHz, so a dump
+// from a CC2511 reads right as well as one from a CC1111
+
+// GetFrequency returns the base (channel 0) carrier frequency in Hz
+func (r *RegisterMap) GetFrequency() float64 {
+	return GetFrequency(r, r.CrystalMHz())
+}
+
+// GetDataRate returns the data rate in baud from DRATE_E and DRATE_M
+func (r *RegisterMap) GetDataRate() float64 {
+	return GetDataRate(r, r.CrystalMHz())
+}
+
+// GetChannelBW returns the receive channel filter bandwidth in Hz from
+// CHANBW_E and CHANBW_M
+func (r *RegisterMap) GetChannelBW() float64 {
+	return r.CrystalMHz() * 1e6 / (8 * float64(4+uint32(r.ChanBWM())) * float64(uint32(1)<<r.ChanBWE()))
+}
+
+// GetDeviation returns the FSK frequency deviation in Hz from
+// DEVIATION_E and DEVIATION_M. It is meaningless for ASK/OOK and sets
+// the phase change fraction rather than a deviation for MSK
+func (r *RegisterMap) GetDeviation() float64 {
+	return r.CrystalMHz() * 1e6 / float64(uint32(1)<<17) * float64(8+uint32(r.DeviationM())) * float64(uint32(1)<<r.DeviationE())
+}
+
+// GetIFFrequency returns the receiver IF frequency in Hz from FREQ_IF
+func (r *RegisterMap) GetIFFrequency() float64 {
+	return r.CrystalMHz() * 1e6 / 1024 * float64(r.FreqIF())
+}
+
+// GetChannelSpacing returns the channel spacing in Hz from CHANSPC_E and
+// CHANSPC_M
+func (r *RegisterMap) GetChannelSpacing() float64 {
+	return r.CrystalMHz() * 1e6 / float64(uint32(1)<<18) * float64(256+uint32(r.ChanSpcM())) * float64(uint32(1)<<r.ChanSpcE())
+}
+
+// GetFreqOffset returns the synthesizer frequency offset in Hz from
+// FREQOFF
+func (r *RegisterMap) GetFreqOffset() float64 {
+	return r.CrystalMHz() * 1e6 / 16384 * float64(r.FreqOffset())
+}
+
+// ModulationName returns MOD_FORMAT as text, such as "GFSK"
+func (r *RegisterMap) ModulationName() string {
+	return fieldLayouts["MDMCFG2"][1].values[r.ModFormat()>>4]
+}
+
+// Summary describes the radio settings in one line, such as
+// "433.920 MHz, 38.4 kBaud, 101.6 kHz BW, GFSK, 20.6 kHz deviation"
+func (r *RegisterMap) Summary() string {
+	parts := []string{
+		fmt.Sprintf("%.3f MHz", r.GetFrequency()/1e6),
+		formatBaud(r.GetDataRate()),
+		fmt.Sprintf("%.1f kHz BW", r.GetChannelBW()/1e3),
+		r.ModulationName(),
+	}
+	switch r.ModFormat() {
+	case Mod2FSK, ModGFSK, Mod4FSK:
+		parts = append(parts, fmt.Sprintf("%.1f kHz deviation", r.GetDeviation()/1e3))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBaud prints a data rate in Baud or kBaud
+func formatBaud(baud float64) string {
+	if baud >= 1000 {
+		return fmt.Sprintf("%.1f kBaud", baud/1e3)
+	}
+	return fmt.Sprintf("%.0f Baud", baud)
+}
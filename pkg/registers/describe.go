@@ -0,0 +1,344 @@
+package registers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// bitfield is a named field of a register for Describe
+type bitfield struct {
+	name   string
+	hi, lo uint8
+	values []string // Meaning of each value, when the field is an enumeration
+}
+
+var (
+	offOn      = []string{"off", "on"}
+	radioModes = []string{"IDLE", "FSTXON", "TX", "RX"}
+)
+
+// fieldLayouts are the bitfields Describe decodes, by register name
+var fieldLayouts = map[string][]bitfield{
+	"PKTCTRL1": {
+		{"PQT", 7, 5, nil},
+		{"APPEND_STATUS", 2, 2, offOn},
+		{"ADR_CHK", 1, 0, []string{"none", "address", "address or 0x00", "address, 0x00 or 0xFF"}},
+	},
+	"PKTCTRL0": {
+		{"WHITE_DATA", 6, 6, offOn},
+		{"PKT_FORMAT", 5, 4, []string{"normal", "reserved", "random TX", "reserved"}},
+		{"CRC_EN", 2, 2, offOn},
+		{"LENGTH_CONFIG", 1, 0, []string{"fixed", "variable", "infinite", "reserved"}},
+	},
+	"FSCTRL1": {{"FREQ_IF", 4, 0, nil}},
+	"MDMCFG4": {
+		{"CHANBW_E", 7, 6, nil},
+		{"CHANBW_M", 5, 4, nil},
+		{"DRATE_E", 3, 0, nil},
+	},
+	"MDMCFG3": {{"DRATE_M", 7, 0, nil}},
+	"MDMCFG2": {
+		{"DEM_DCFILT_OFF", 7, 7, nil},
+		{"MOD_FORMAT", 6, 4, []string{"2-FSK", "GFSK", "reserved", "ASK/OOK", "4-FSK", "reserved", "reserved", "MSK"}},
+		{"MANCHESTER_EN", 3, 3, offOn},
+		{"SYNC_MODE", 2, 0, []string{"no sync", "15/16", "16/16", "30/32", "carrier sense", "15/16 + carrier sense", "16/16 + carrier sense", "30/32 + carrier sense"}},
+	},
+	"MDMCFG1": {
+		{"FEC_EN", 7, 7, offOn},
+		{"NUM_PREAMBLE", 6, 4, []string{"2 bytes", "3 bytes", "4 bytes", "6 bytes", "8 bytes", "12 bytes", "16 bytes", "24 bytes"}},
+		{"CHANSPC_E", 1, 0, nil},
+	},
+	"MDMCFG0": {{"CHANSPC_M", 7, 0, nil}},
+	"DEVIATN": {
+		{"DEVIATION_E", 6, 4, nil},
+		{"DEVIATION_M", 2, 0, nil},
+	},
+	"MCSM2": {
+		{"RX_TIME_RSSI", 4, 4, offOn},
+		{"RX_TIME_QUAL", 3, 3, nil},
+		{"RX_TIME", 2, 0, []string{"0", "1", "2", "3", "4", "5", "6", "until end of packet"}},
+	},
+	"MCSM1": {
+		{"CCA_MODE", 5, 4, []string{"always", "below threshold", "unless receiving", "below threshold unless receiving"}},
+		{"RXOFF_MODE", 3, 2, radioModes},
+		{"TXOFF_MODE", 1, 0, radioModes},
+	},
+	"MCSM0": {
+		{"FS_AUTOCAL", 5, 4, []string{"never", "from IDLE", "to IDLE", "every 4th to IDLE"}},
+		{"CLOSE_IN_RX", 1, 0, []string{"0 dB", "6 dB", "12 dB", "18 dB"}},
+	},
+	"FOCCFG": {
+		{"FOC_BS_CS_GATE", 5, 5, offOn},
+		{"FOC_PRE_K", 4, 3, []string{"K", "2K", "3K", "4K"}},
+		{"FOC_POST_K", 2, 2, []string{"same as FOC_PRE_K", "K/2"}},
+		{"FOC_LIMIT", 1, 0, []string{"0", "BW/8", "BW/4", "BW/2"}},
+	},
+	"BSCFG": {
+		{"BS_PRE_KI", 7, 6, nil},
+		{"BS_PRE_KP", 5, 4, nil},
+		{"BS_POST_KI", 3, 3, nil},
+		{"BS_POST_KP", 2, 2, nil},
+		{"BS_LIMIT", 1, 0, []string{"0", "3.125%", "6.25%", "12.5%"}},
+	},
+	"AGCCTRL2": {
+		{"MAX_DVGA_GAIN", 7, 6, []string{"all", "all but highest", "all but 2 highest", "all but 3 highest"}},
+		{"MAX_LNA_GAIN", 5, 3, nil},
+		{"MAGN_TARGET", 2, 0, []string{"24 dB", "27 dB", "30 dB", "33 dB", "36 dB", "38 dB", "40 dB", "42 dB"}},
+	},
+	"AGCCTRL1": {
+		{"AGC_LNA_PRIORITY", 6, 6, nil},
+		{"CARRIER_SENSE_REL_THR", 5, 4, []string{"off", "6 dB", "10 dB", "14 dB"}},
+		{"CARRIER_SENSE_ABS_THR", 3, 0, nil},
+	},
+	"AGCCTRL0": {
+		{"HYST_LEVEL", 7, 6, []string{"none", "low", "medium", "large"}},
+		{"WAIT_TIME", 5, 4, []string{"8 samples", "16 samples", "24 samples", "32 samples"}},
+		{"AGC_FREEZE", 3, 2, nil},
+		{"FILTER_LENGTH", 1, 0, nil},
+	},
+	"FREND1": {
+		{"LNA_CURRENT", 7, 6, nil},
+		{"LNA2MIX_CURRENT", 5, 4, nil},
+		{"LODIV_BUF_CURRENT_RX", 3, 2, nil},
+		{"MIX_CURRENT", 1, 0, nil},
+	},
+	"FREND0": {
+		{"LODIV_BUF_CURRENT_TX", 5, 4, nil},
+		{"PA_POWER", 2, 0, nil},
+	},
+	"FSCAL3": {
+		{"FSCAL3_HI", 7, 6, nil},
+		{"CHP_CURR_CAL_EN", 5, 4, nil},
+		{"FSCAL3_LO", 3, 0, nil},
+	},
+	"FSCAL2": {{"VCO_CORE_H_EN", 5, 5, offOn}},
+	"IOCFG2": {{"GDO2_INV", 6, 6, nil}, {"GDO2_CFG", 5, 0, nil}},
+	"IOCFG1": {{"GDO_DS", 7, 7, []string{"low", "high"}}, {"GDO1_INV", 6, 6, nil}, {"GDO1_CFG", 5, 0, nil}},
+	"IOCFG0": {{"GDO0_INV", 6, 6, nil}, {"GDO0_CFG", 5, 0, nil}},
+	"LQI": {
+		{"CRC_OK", 7, 7, nil},
+		{"LQI_EST", 6, 0, nil},
+	},
+	"PKTSTATUS": {
+		{"CRC_OK", 7, 7, nil},
+		{"CS", 6, 6, nil},
+		{"PQT_REACHED", 5, 5, nil},
+		{"CCA", 4, 4, nil},
+		{"SFD", 3, 3, nil},
+	},
+}
+
+// CrystalMHz returns the crystal frequency the registers are for: 26 MHz
+// when PARTNUM is a CC2510/CC2511, or when it is unset and FREQ is above
+// 1 GHz at 24 MHz as only the 2.4 GHz chips can tune there; 24 MHz
+// otherwise
+func (r *RegisterMap) CrystalMHz() float64 {
+	if r.PARTNUM != 0 {
+		return float64(yardstick.CrystalHzFor(r.PARTNUM)) / 1e6
+	}
+	if GetFrequency(r, 24) >= 1e9 {
+		return float64(yardstick.CrystalFreqHz2511) / 1e6
+	}
+	return float64(yardstick.CrystalFreqHz) / 1e6
+}
+
+// byName returns the register with the given Names entry
+func (r *RegisterMap) byName(name string) uint8 {
+	addr := Names[name]
+	if addr >= RegPA_TABLE7 && addr <= RegPA_TABLE0 {
+		return r.PA_TABLE[RegPA_TABLE0-addr]
+	}
+	v, _ := r.byAddr(addr)
+	return v
+}
+
+// byAddr returns the register at addr, other than PA_TABLE
+func (r *RegisterMap) byAddr(addr uint16) (uint8, bool) {
+	regs := map[uint16]uint8{
+		RegSYNC1: r.SYNC1, RegSYNC0: r.SYNC0,
+		RegPKTLEN: r.PKTLEN, RegPKTCTRL1: r.PKTCTRL1, RegPKTCTRL0: r.PKTCTRL0,
+		RegADDR: r.ADDR, RegCHANNR: r.CHANNR,
+		RegFSCTRL1: r.FSCTRL1, RegFSCTRL0: r.FSCTRL0,
+		RegFREQ2: r.FREQ2, RegFREQ1: r.FREQ1, RegFREQ0: r.FREQ0,
+		RegMDMCFG4: r.MDMCFG4, RegMDMCFG3: r.MDMCFG3, RegMDMCFG2: r.MDMCFG2,
+		RegMDMCFG1: r.MDMCFG1, RegMDMCFG0: r.MDMCFG0, RegDEVIATN: r.DEVIATN,
+		RegMCSM2: r.MCSM2, RegMCSM1: r.MCSM1, RegMCSM0: r.MCSM0,
+		RegFOCCFG: r.FOCCFG, RegBSCFG: r.BSCFG,
+		RegAGCCTRL2: r.AGCCTRL2, RegAGCCTRL1: r.AGCCTRL1, RegAGCCTRL0: r.AGCCTRL0,
+		RegFREND1: r.FREND1, RegFREND0: r.FREND0,
+		RegFSCAL3: r.FSCAL3, RegFSCAL2: r.FSCAL2, RegFSCAL1: r.FSCAL1, RegFSCAL0: r.FSCAL0,
+		RegTEST2: r.TEST2, RegTEST1: r.TEST1, RegTEST0: r.TEST0,
+		RegIOCFG2: r.IOCFG2, RegIOCFG1: r.IOCFG1, RegIOCFG0: r.IOCFG0,
+		RegPARTNUM: r.PARTNUM, RegCHIPID: r.CHIPID, RegFREQEST: r.FREQEST,
+		RegLQI: r.LQI, RegRSSI: r.RSSI, RegMARCSTATE: r.MARCSTATE,
+		RegPKTSTATUS: r.PKTSTATUS, RegVCO_VC_DAC: r.VCO_VC_DAC,
+	}
+	v, ok := regs[addr]
+	return v, ok
+}
+
+// registerNote is what a register's value means beyond its fields
+func (r *RegisterMap) registerNote(name string) string {
+	switch name {
+	case "SYNC1":
+		return fmt.Sprintf("sync word 0x%04X", r.SyncWord())
+	case "PKTLEN":
+		if r.LengthConfig() == PktLenVariable {
+			return fmt.Sprintf("up to %d bytes", r.PKTLEN)
+		}
+		return fmt.Sprintf("%d bytes", r.PKTLEN)
+	case "FSCTRL1":
+		return fmt.Sprintf("%.1f kHz IF", r.GetIFFrequency()/1e3)
+	case "FSCTRL0":
+		return fmt.Sprintf("%+.1f kHz offset", r.GetFreqOffset()/1e3)
+	case "FREQ2":
+		return fmt.Sprintf("FREQ 0x%06X, %.6f MHz", r.FreqWord(), r.GetFrequency()/1e6)
+	case "MDMCFG4":
+		return fmt.Sprintf("%.1f kHz channel filter", r.GetChannelBW()/1e3)
+	case "MDMCFG3":
+		return fmt.Sprintf("%.0f baud", r.GetDataRate())
+	case "MDMCFG0":
+		return fmt.Sprintf("%.1f kHz channel spacing", r.GetChannelSpacing()/1e3)
+	case "DEVIATN":
+		return fmt.Sprintf("%.1f kHz deviation", r.GetDeviation()/1e3)
+	case "AGCCTRL1":
+		if r.CarrierSenseAbsThr() == -8 {
+			return "absolute carrier sense off"
+		}
+		return fmt.Sprintf("absolute carrier sense at %+d dB", r.CarrierSenseAbsThr())
+	case "PARTNUM":
+		return yardstick.ChipName(r.PARTNUM)
+	case "FREQEST":
+		return fmt.Sprintf("%+.1f kHz offset estimate", r.CrystalMHz()*1e6/16384*float64(int8(r.FREQEST))/1e3)
+	case "RSSI":
+		return fmt.Sprintf("%+.1f dB (uncalibrated)", float64(int8(r.RSSI))/2)
+	case "MARCSTATE":
+		return r.MarcState().String()
+	}
+	if strings.HasPrefix(name, "PA_TABLE") && int(name[len(name)-1]-'0') == int(r.PAPower()) {
+		if dBm, ok := cc1111.PATableDBm(uint32(r.GetFrequency()), r.PASetting()); ok {
+			return fmt.Sprintf("in use, %+g dBm", dBm)
+		}
+		return "in use"
+	}
+	return ""
+}
+
+// Description is a register set decoded field by field, as Describe
+// prints it
+type Description struct {
+	FrequencyHz      float64 `json:"frequency_hz"`
+	CrystalMHz       float64 `json:"crystal_mhz"`
+	Modulation       string  `json:"modulation"`
+	DataRateBaud     float64 `json:"data_rate_baud"`
+	ChannelBWHz      float64 `json:"channel_bw_hz"`
+	Channel          uint8   `json:"channel"`
+	ChannelSpacingHz float64 `json:"channel_spacing_hz"`
+	LengthConfig     string  `json:"length_config"`
+	PktLen           uint8   `json:"pktlen"`
+	SyncWord         uint16  `json:"sync_word"`
+	SyncMode         string  `json:"sync_mode"`
+	PreambleBytes    int     `json:"preamble_bytes"`
+	CRC              bool    `json:"crc"`
+	Whitening        bool    `json:"whitening"`
+	Manchester       bool    `json:"manchester"`
+	FEC              bool    `json:"fec"`
+
+	Registers []RegisterDescription `json:"registers"`
+}
+
+// RegisterDescription is one register with its decoded bitfields
+type RegisterDescription struct {
+	Name    string             `json:"name"`
+	Address uint16             `json:"address"`
+	Value   uint8              `json:"value"`
+	Fields  []FieldDescription `json:"fields,omitempty"`
+	Note    string             `json:"note,omitempty"` // What the value means beyond its fields
+}
+
+// FieldDescription is one bitfield of a register
+type FieldDescription struct {
+	Name    string `json:"name"`
+	Value   uint8  `json:"value"`
+	Meaning string `json:"meaning,omitempty"` // Set when the field is an enumeration
+}
+
+// Decode returns the radio settings the registers add up to and every
+// register with its address, value and decoded bitfields
+func (r *RegisterMap) Decode() *Description {
+	d := &Description{
+		FrequencyHz:      r.GetFrequency(),
+		CrystalMHz:       r.CrystalMHz(),
+		Modulation:       r.ModulationName(),
+		DataRateBaud:     r.GetDataRate(),
+		ChannelBWHz:      r.GetChannelBW(),
+		Channel:          r.CHANNR,
+		ChannelSpacingHz: r.GetChannelSpacing(),
+		LengthConfig:     fieldLayouts["PKTCTRL0"][3].values[r.LengthConfig()],
+		PktLen:           r.PKTLEN,
+		SyncWord:         r.SyncWord(),
+		SyncMode:         fieldLayouts["MDMCFG2"][3].values[r.SyncMode()],
+		PreambleBytes:    r.PreambleBytes(),
+		CRC:              r.CRCEnabled(),
+		Whitening:        r.Whitening(),
+		Manchester:       r.Manchester(),
+		FEC:              r.FECEnabled(),
+	}
+	for _, name := range SortedNames() {
+		reg := RegisterDescription{Name: name, Address: Names[name], Value: r.byName(name), Note: r.registerNote(name)}
+		for _, f := range fieldLayouts[name] {
+			field := FieldDescription{Name: f.name, Value: bits(reg.Value, f.lo, f.hi-f.lo+1)}
+			if int(field.Value) < len(f.values) {
+				field.Meaning = f.values[field.Value]
+			}
+			reg.Fields = append(reg.Fields, field)
+		}
+		d.Registers = append(d.Registers, reg)
+	}
+	return d
+}
+
+// Describe renders the registers as annotated text: a summary of the
+// radio settings they add up to, then one line per register with its
+// address, value and decoded bitfields
+func (r *RegisterMap) Describe() string {
+	var b strings.Builder
+	d := r.Decode()
+	fmt.Fprintf(&b, "Frequency:  %.6f MHz (%.0f MHz crystal)\n", d.FrequencyHz/1e6, d.CrystalMHz)
+	fmt.Fprintf(&b, "Modulation: %s, %s\n", d.Modulation, r.registerNote("MDMCFG3"))
+	fmt.Fprintf(&b, "Filter:     %s, channel %d, %s\n", r.registerNote("MDMCFG4"), d.Channel, r.registerNote("MDMCFG0"))
+	fmt.Fprintf(&b, "Packet:     %s length, %s, sync 0x%04X (%s), %d preamble bytes", d.LengthConfig, r.registerNote("PKTLEN"), d.SyncWord, d.SyncMode, d.PreambleBytes)
+	if d.CRC {
+		b.WriteString(", CRC")
+	}
+	if d.Whitening {
+		b.WriteString(", whitening")
+	}
+	if d.Manchester {
+		b.WriteString(", Manchester")
+	}
+	if d.FEC {
+		b.WriteString(", FEC")
+	}
+	b.WriteString("\n\n")
+
+	for _, reg := range d.Registers {
+		var parts []string
+		for _, f := range reg.Fields {
+			part := fmt.Sprintf("%s=%d", f.Name, f.Value)
+			if f.Meaning != "" {
+				part += " (" + f.Meaning + ")"
+			}
+			parts = append(parts, part)
+		}
+		if reg.Note != "" {
+			parts = append(parts, reg.Note)
+		}
+		line := fmt.Sprintf("%-10s 0x%04X  0x%02X  %s", reg.Name, reg.Address, reg.Value, strings.Join(parts, ", "))
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+package registers
+
+// Bitfield accessors for the RegisterMap, named after the CC1111 data
+// sheet fields. Getters return the field right-aligned; setters mask the
+// value to the field width and leave the rest of the register alone.
+// Modulation and sync mode keep the pre-shifted Mod*/Sync* constants
+
+// bits returns the width-bit field of v starting at bit shift
+func bits(v, shift, width uint8) uint8 {
+	return (v >> shift) & (1<<width - 1)
+}
+
+// setBits replaces the width-bit field of *p starting at bit shift
+func setBits(p *uint8, shift, width, val uint8) {
+	mask := uint8(1<<width-1) << shift
+	*p = (*p &^ mask) | ((val << shift) & mask)
+}
+
+// bit is a one-bit field as a bool
+func bit(v, n uint8) bool {
+	return v&(1<<n) != 0
+}
+
+// setBit sets or clears one bit of *p
+func setBit(p *uint8, n uint8, on bool) {
+	if on {
+		*p |= 1 << n
+	} else {
+		*p &^= 1 << n
+	}
+}
+
+// SyncWord returns SYNC1:SYNC0
+func (r *RegisterMap) SyncWord() uint16 { return GetSyncWord(r) }
+
+// SetSyncWord sets SYNC1:SYNC0
+func (r *RegisterMap) SetSyncWord(w uint16) { SetSyncWord(r, w) }
+
+// PQT returns the preamble quality threshold, PKTCTRL1[7:5]
+func (r *RegisterMap) PQT() uint8 { return bits(r.PKTCTRL1, 5, 3) }
+
+// SetPQT sets the preamble quality threshold
+func (r *RegisterMap) SetPQT(v uint8) { setBits(&r.PKTCTRL1, 5, 3, v) }
+
+// AppendStatus reports whether RSSI and LQI are appended to received
+// packets, PKTCTRL1[2]
+func (r *RegisterMap) AppendStatus() bool { return bit(r.PKTCTRL1, 2) }
+
+// SetAppendStatus sets APPEND_STATUS
+func (r *RegisterMap) SetAppendStatus(on bool) { setBit(&r.PKTCTRL1, 2, on) }
+
+// AddrCheck returns the address check mode, PKTCTRL1[1:0]
+func (r *RegisterMap) AddrCheck() uint8 { return bits(r.PKTCTRL1, 0, 2) }
+
+// SetAddrCheck sets ADR_CHK
+func (r *RegisterMap) SetAddrCheck(v uint8) { setBits(&r.PKTCTRL1, 0, 2, v) }
+
+// Whitening reports whether data whitening is on, PKTCTRL0[6]
+func (r *RegisterMap) Whitening() bool { return bit(r.PKTCTRL0, 6) }
+
+// SetWhitening sets WHITE_DATA
+func (r *RegisterMap) SetWhitening(on bool) { setBit(&r.PKTCTRL0, 6, on) }
+
+// PktFormat returns the packet format, PKTCTRL0[5:4]: 0 normal (FIFO),
+// 2 random TX
+func (r *RegisterMap) PktFormat() uint8 { return bits(r.PKTCTRL0, 4, 2) }
+
+// SetPktFormat sets PKT_FORMAT
+func (r *RegisterMap) SetPktFormat(v uint8) { setBits(&r.PKTCTRL0, 4, 2, v) }
+
+// CRCEnabled reports whether CRC is calculated and checked, PKTCTRL0[2]
+func (r *RegisterMap) CRCEnabled() bool { return bit(r.PKTCTRL0, 2) }
+
+// SetCRCEnabled sets CRC_EN
+func (r *RegisterMap) SetCRCEnabled(on bool) { setBit(&r.PKTCTRL0, 2, on) }
+
+// LengthConfig returns the packet length mode, PKTCTRL0[1:0]
+// (PktLenFixed, PktLenVariable or PktLenInfinite)
+func (r *RegisterMap) LengthConfig() uint8 { return bits(r.PKTCTRL0, 0, 2) }
+
+// SetLengthConfig sets LENGTH_CONFIG
+func (r *RegisterMap) SetLengthConfig(v uint8) { setBits(&r.PKTCTRL0, 0, 2, v) }
+
+// FreqIF returns the IF frequency setting, FSCTRL1[4:0]
+func (r *RegisterMap) FreqIF() uint8 { return bits(r.FSCTRL1, 0, 5) }
+
+// SetFreqIF sets FREQ_IF
+func (r *RegisterMap) SetFreqIF(v uint8) { setBits(&r.FSCTRL1, 0, 5, v) }
+
+// FreqOffset returns the frequency offset added to the synthesizer,
+// FSCTRL0, in two's complement
+func (r *RegisterMap) FreqOffset() int8 { return int8(r.FSCTRL0) }
+
+// SetFreqOffset sets FREQOFF
+func (r *RegisterMap) SetFreqOffset(v int8) { r.FSCTRL0 = uint8(v) }
+
+// FreqWord returns the 22-bit FREQ word from FREQ2:FREQ1:FREQ0
+func (r *RegisterMap) FreqWord() uint32 {
+	return uint32(r.FREQ2&0x3F)<<16 | uint32(r.FREQ1)<<8 | uint32(r.FREQ0)
+}
+
+// SetFreqWord sets FREQ2:FREQ1:FREQ0 from a 22-bit FREQ word
+func (r *RegisterMap) SetFreqWord(w uint32) {
+	r.FREQ2 = uint8(w>>16) & 0x3F
+	r.FREQ1 = uint8(w >> 8)
+	r.FREQ0 = uint8(w)
+}
+
+// ChanBWE returns the channel filter bandwidth exponent, MDMCFG4[7:6]
+func (r *RegisterMap) ChanBWE() uint8 { return bits(r.MDMCFG4, 6, 2) }
+
+// SetChanBWE sets CHANBW_E
+func (r *RegisterMap) SetChanBWE(v uint8) { setBits(&r.MDMCFG4, 6, 2, v) }
+
+// ChanBWM returns the channel filter bandwidth mantissa, MDMCFG4[5:4]
+func (r *RegisterMap) ChanBWM() uint8 { return bits(r.MDMCFG4, 4, 2) }
+
+// SetChanBWM sets CHANBW_M
+func (r *RegisterMap) SetChanBWM(v uint8) { setBits(&r.MDMCFG4, 4, 2, v) }
+
+// DataRateE returns the data rate exponent, MDMCFG4[3:0]
+func (r *RegisterMap) DataRateE() uint8 { return bits(r.MDMCFG4, 0, 4) }
+
+// SetDataRateE sets DRATE_E
+func (r *RegisterMap) SetDataRateE(v uint8) { setBits(&r.MDMCFG4, 0, 4, v) }
+
+// DataRateM returns the data rate mantissa, MDMCFG3
+func (r *RegisterMap) DataRateM() uint8 { return r.MDMCFG3 }
+
+// SetDataRateM sets DRATE_M
+func (r *RegisterMap) SetDataRateM(v uint8) { r.MDMCFG3 = v }
+
+// DCFilterOff reports whether the DC blocking filter is off, MDMCFG2[7]
+func (r *RegisterMap) DCFilterOff() bool { return bit(r.MDMCFG2, 7) }
+
+// SetDCFilterOff sets DEM_DCFILT_OFF
+func (r *RegisterMap) SetDCFilterOff(on bool) { setBit(&r.MDMCFG2, 7, on) }
+
+// ModFormat returns the modulation format, MDMCFG2[6:4], pre-shifted as
+// the Mod* constants
+func (r *RegisterMap) ModFormat() uint8 { return GetModulation(r) }
+
+// SetModFormat sets MOD_FORMAT from a Mod* constant
+func (r *RegisterMap) SetModFormat(mod uint8) { SetModulation(r, mod) }
+
+// Manchester reports whether Manchester encoding is on, MDMCFG2[3]
+func (r *RegisterMap) Manchester() bool { return bit(r.MDMCFG2, 3) }
+
+// SetManchester sets MANCHESTER_EN
+func (r *RegisterMap) SetManchester(on bool) { setBit(&r.MDMCFG2, 3, on) }
+
+// SyncMode returns the sync word qualifier mode, MDMCFG2[2:0]
+func (r *RegisterMap) SyncMode() uint8 { return GetSyncMode(r) }
+
+// SetSyncMode sets SYNC_MODE from a Sync* constant
+func (r *RegisterMap) SetSyncMode(mode uint8) { SetSyncMode(r, mode) }
+
+// FECEnabled reports whether forward error correction is on, MDMCFG1[7]
+func (r *RegisterMap) FECEnabled() bool { return bit(r.MDMCFG1, 7) }
+
+// SetFECEnabled sets FEC_EN
+func (r *RegisterMap) SetFECEnabled(on bool) { setBit(&r.MDMCFG1, 7, on) }
+
+// NumPreamble returns the preamble length setting, MDMCFG1[6:4]; see
+// PreambleBytes
+func (r *RegisterMap) NumPreamble() uint8 { return bits(r.MDMCFG1, 4, 3) }
+
+// SetNumPreamble sets NUM_PREAMBLE
+func (r *RegisterMap) SetNumPreamble(v uint8) { setBits(&r.MDMCFG1, 4, 3, v) }
+
+// preambleBytes are the preamble lengths of the NUM_PREAMBLE settings
+var preambleBytes = [8]int{2, 3, 4, 6, 8, 12, 16, 24}
+
+// PreambleBytes returns the number of preamble bytes transmitted
+func (r *RegisterMap) PreambleBytes() int { return preambleBytes[r.NumPreamble()] }
+
+// ChanSpcE returns the channel spacing exponent, MDMCFG1[1:0]
+func (r *RegisterMap) ChanSpcE() uint8 { return bits(r.MDMCFG1, 0, 2) }
+
+// SetChanSpcE sets CHANSPC_E
+func (r *RegisterMap) SetChanSpcE(v uint8) { setBits(&r.MDMCFG1, 0, 2, v) }
+
+// ChanSpcM returns the channel spacing mantissa, MDMCFG0
+func (r *RegisterMap) ChanSpcM() uint8 { return r.MDMCFG0 }
+
+// SetChanSpcM sets CHANSPC_M
+func (r *RegisterMap) SetChanSpcM(v uint8) { r.MDMCFG0 = v }
+
+// DeviationE returns the deviation exponent, DEVIATN[6:4]
+func (r *RegisterMap) DeviationE() uint8 { return bits(r.DEVIATN, 4, 3) }
+
+// SetDeviationE sets DEVIATION_E
+func (r *RegisterMap) SetDeviationE(v uint8) { setBits(&r.DEVIATN, 4, 3, v) }
+
+// DeviationM returns the deviation mantissa, DEVIATN[2:0]
+func (r *RegisterMap) DeviationM() uint8 { return bits(r.DEVIATN, 0, 3) }
+
+// SetDeviationM sets DEVIATION_M
+func (r *RegisterMap) SetDeviationM(v uint8) { setBits(&r.DEVIATN, 0, 3, v) }
+
+// RxTime returns the RX timeout setting, MCSM2[2:0] (7 = no timeout)
+func (r *RegisterMap) RxTime() uint8 { return bits(r.MCSM2, 0, 3) }
+
+// SetRxTime sets RX_TIME
+func (r *RegisterMap) SetRxTime(v uint8) { setBits(&r.MCSM2, 0, 3, v) }
+
+// CCAMode returns the clear channel indication mode, MCSM1[5:4]
+func (r *RegisterMap) CCAMode() uint8 { return bits(r.MCSM1, 4, 2) }
+
+// SetCCAMode sets CCA_MODE
+func (r *RegisterMap) SetCCAMode(v uint8) { setBits(&r.MCSM1, 4, 2, v) }
+
+// RxOffMode returns the state after a packet is received, MCSM1[3:2]:
+// 0 IDLE, 1 FSTXON, 2 TX, 3 RX
+func (r *RegisterMap) RxOffMode() uint8 { return bits(r.MCSM1, 2, 2) }
+
+// SetRxOffMode sets RXOFF_MODE
+func (r *RegisterMap) SetRxOffMode(v uint8) { setBits(&r.MCSM1, 2, 2, v) }
+
+// TxOffMode returns the state after a packet is sent, MCSM1[1:0]:
+// 0 IDLE, 1 FSTXON, 2 TX, 3 RX
+func (r *RegisterMap) TxOffMode() uint8 { return bits(r.MCSM1, 0, 2) }
+
+// SetTxOffMode sets TXOFF_MODE
+func (r *RegisterMap) SetTxOffMode(v uint8) { setBits(&r.MCSM1, 0, 2, v) }
+
+// FSAutoCal returns when the synthesizer calibrates, MCSM0[5:4]
+func (r *RegisterMap) FSAutoCal() uint8 { return bits(r.MCSM0, 4, 2) }
+
+// SetFSAutoCal sets FS_AUTOCAL
+func (r *RegisterMap) SetFSAutoCal(v uint8) { setBits(&r.MCSM0, 4, 2, v) }
+
+// MaxDVGAGain returns the DVGA gain reduction limit, AGCCTRL2[7:6]
+func (r *RegisterMap) MaxDVGAGain() uint8 { return bits(r.AGCCTRL2, 6, 2) }
+
+// SetMaxDVGAGain sets MAX_DVGA_GAIN
+func (r *RegisterMap) SetMaxDVGAGain(v uint8) { setBits(&r.AGCCTRL2, 6, 2, v) }
+
+// MaxLNAGain returns the LNA gain reduction limit, AGCCTRL2[5:3]
+func (r *RegisterMap) MaxLNAGain() uint8 { return bits(r.AGCCTRL2, 3, 3) }
+
+// SetMaxLNAGain sets MAX_LNA_GAIN
+func (r *RegisterMap) SetMaxLNAGain(v uint8) { setBits(&r.AGCCTRL2, 3, 3, v) }
+
+// MagnTarget returns the AGC target amplitude, AGCCTRL2[2:0]
+func (r *RegisterMap) MagnTarget() uint8 { return bits(r.AGCCTRL2, 0, 3) }
+
+// SetMagnTarget sets MAGN_TARGET
+func (r *RegisterMap) SetMagnTarget(v uint8) { setBits(&r.AGCCTRL2, 0, 3, v) }
+
+// CarrierSenseRelThr returns the relative carrier sense threshold,
+// AGCCTRL1[5:4]: 0 disabled, then 6, 10 or 14 dB
+func (r *RegisterMap) CarrierSenseRelThr() uint8 { return bits(r.AGCCTRL1, 4, 2) }
+
+// SetCarrierSenseRelThr sets CARRIER_SENSE_REL_THR
+func (r *RegisterMap) SetCarrierSenseRelThr(v uint8) { setBits(&r.AGCCTRL1, 4, 2, v) }
+
+// CarrierSenseAbsThr returns the absolute carrier sense threshold in dB
+// from MAGN_TARGET, AGCCTRL1[3:0]; -8 disables it
+func (r *RegisterMap) CarrierSenseAbsThr() int8 { return int8(r.AGCCTRL1<<4) >> 4 }
+
+// SetCarrierSenseAbsThr sets CARRIER_SENSE_ABS_THR (-8 to 7)
+func (r *RegisterMap) SetCarrierSenseAbsThr(v int8) { setBits(&r.AGCCTRL1, 0, 4, uint8(v)) }
+
+// PAPower returns the PA_TABLE index used for a 1 when transmitting,
+// FREND0[2:0]
+func (r *RegisterMap) PAPower() uint8 { return bits(r.FREND0, 0, 3) }
+
+// SetPAPower sets PA_POWER
+func (r *RegisterMap) SetPAPower(v uint8) { setBits(&r.FREND0, 0, 3, v) }
+
+// PASetting returns the PA_TABLE entry PA_POWER selects
+func (r *RegisterMap) PASetting() uint8 { return r.PA_TABLE[r.PAPower()] }
+
+// GDOCfg returns the signal routed to GDO pin n (0-2), IOCFGn[5:0]
+func (r *RegisterMap) GDOCfg(n int) uint8 { return bits(*r.iocfg(n), 0, 6) }
+
+// SetGDOCfg sets GDOn_CFG
+func (r *RegisterMap) SetGDOCfg(n int, v uint8) { setBits(r.iocfg(n), 0, 6, v) }
+
+// iocfg returns IOCFG0, IOCFG1 or IOCFG2
+func (r *RegisterMap) iocfg(n int) *uint8 {
+	switch n {
+	case 1:
+		return &r.IOCFG1
+	case 2:
+		return &r.IOCFG2
+	}
+	return &r.IOCFG0
+}
+
+// MarcState returns the radio state from MARCSTATE
+func (r *RegisterMap) MarcState() RadioState { return RadioState(r.MARCSTATE & 0x1F) }
+
+// LQIEstimate returns the link quality estimate of the last packet,
+// LQI[6:0]
+func (r *RegisterMap) LQIEstimate() uint8 { return bits(r.LQI, 0, 7) }
+
+// CRCOK reports whether the last packet passed its CRC, LQI[7]
+func (r *RegisterMap) CRCOK() bool { return bit(r.LQI, 7) }
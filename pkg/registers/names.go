@@ -0,0 +1,55 @@
+package registers
+
+import (
+	"sort"
+	"strings"
+)
+
+// Names maps radio register names to their XDATA addresses
+var Names = map[string]uint16{
+	"SYNC1": RegSYNC1, "SYNC0": RegSYNC0,
+	"PKTLEN": RegPKTLEN, "PKTCTRL1": RegPKTCTRL1, "PKTCTRL0": RegPKTCTRL0,
+	"ADDR": RegADDR, "CHANNR": RegCHANNR,
+	"FSCTRL1": RegFSCTRL1, "FSCTRL0": RegFSCTRL0,
+	"FREQ2": RegFREQ2, "FREQ1": RegFREQ1, "FREQ0": RegFREQ0,
+	"MDMCFG4": RegMDMCFG4, "MDMCFG3": RegMDMCFG3, "MDMCFG2": RegMDMCFG2,
+	"MDMCFG1": RegMDMCFG1, "MDMCFG0": RegMDMCFG0, "DEVIATN": RegDEVIATN,
+	"MCSM2": RegMCSM2, "MCSM1": RegMCSM1, "MCSM0": RegMCSM0,
+	"FOCCFG": RegFOCCFG, "BSCFG": RegBSCFG,
+	"AGCCTRL2": RegAGCCTRL2, "AGCCTRL1": RegAGCCTRL1, "AGCCTRL0": RegAGCCTRL0,
+	"FREND1": RegFREND1, "FREND0": RegFREND0,
+	"FSCAL3": RegFSCAL3, "FSCAL2": RegFSCAL2, "FSCAL1": RegFSCAL1, "FSCAL0": RegFSCAL0,
+	"TEST2": RegTEST2, "TEST1": RegTEST1, "TEST0": RegTEST0,
+	"PA_TABLE7": RegPA_TABLE7, "PA_TABLE6": RegPA_TABLE6, "PA_TABLE5": RegPA_TABLE5, "PA_TABLE4": RegPA_TABLE4,
+	"PA_TABLE3": RegPA_TABLE3, "PA_TABLE2": RegPA_TABLE2, "PA_TABLE1": RegPA_TABLE1, "PA_TABLE0": RegPA_TABLE0,
+	"IOCFG2": RegIOCFG2, "IOCFG1": RegIOCFG1, "IOCFG0": RegIOCFG0,
+	"PARTNUM": RegPARTNUM, "CHIPID": RegCHIPID, "FREQEST": RegFREQEST,
+	"LQI": RegLQI, "RSSI": RegRSSI, "MARCSTATE": RegMARCSTATE,
+	"PKTSTATUS": RegPKTSTATUS, "VCO_VC_DAC": RegVCO_VC_DAC,
+}
+
+// Lookup returns the address of a register name, ignoring case
+func Lookup(name string) (uint16, bool) {
+	addr, ok := Names[strings.ToUpper(name)]
+	return addr, ok
+}
+
+// NameOf returns the name of the register at addr, or ""
+func NameOf(addr uint16) string {
+	for name, a := range Names {
+		if a == addr {
+			return name
+		}
+	}
+	return ""
+}
+
+// SortedNames returns the register names in address order
+func SortedNames() []string {
+	names := make([]string, 0, len(Names))
+	for name := range Names {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return Names[names[i]] < Names[names[j]] })
+	return names
+}
@@ -0,0 +1,99 @@
+package registers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// RegisterSnapshot is the radio configuration and state saved by Snapshot,
+// with the packet format and airtime the device was told they imply
+type RegisterSnapshot struct {
+	Registers RegisterMap
+	State     RadioState
+
+	pktFormat *yardstick.PacketFormat
+	airtime   yardstick.AirtimeFunc
+}
+
+// Snapshot saves the radio's registers and state so Restore can put them
+// back. The registers last recorded with SetApplied are used when the
+// device still holds them, saving a dump
+func Snapshot(device *yardstick.Device) (*RegisterSnapshot, error) {
+	state, err := GetRadioState(device)
+	if err != nil {
+		return nil, err
+	}
+	snap := &RegisterSnapshot{State: state, pktFormat: device.PacketFormat(), airtime: device.AirtimeFunc()}
+	if regs, ok := device.Applied().(*RegisterMap); ok {
+		snap.Registers = *regs
+		return snap, nil
+	}
+	regs, err := ReadAllRegisters(device)
+	if err != nil {
+		return nil, err
+	}
+	device.SetApplied(regs)
+	snap.Registers = *regs
+	return snap, nil
+}
+
+// Restore writes a snapshot's registers back with the radio idle, along
+// with the packet format and airtime recorded for them, then returns the
+// radio to receive if it was receiving when the snapshot was taken
+func Restore(device *yardstick.Device, snap *RegisterSnapshot) error {
+	if err := SetIDLE(device); err != nil {
+		return fmt.Errorf("failed to set IDLE state: %w", err)
+	}
+	// Small delay to ensure state change
+	time.Sleep(10 * time.Millisecond)
+
+	if err := WriteAllRegisters(device, &snap.Registers); err != nil {
+		return err
+	}
+	regs := snap.Registers
+	device.SetApplied(&regs)
+	device.SetPacketFormat(snap.pktFormat)
+	device.SetAirtimeFunc(snap.airtime)
+
+	if snap.State == StateRX {
+		if err := SetRX(device); err != nil {
+			return fmt.Errorf("failed to set RX state: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithTemporaryRegisters saves the radio's registers, applies overrides to
+// a copy of them and writes what changed, runs fn, and restores the saved
+// registers however fn returns. overrides may be nil to only save and
+// restore around fn. A failed restore is returned if fn succeeded
+func WithTemporaryRegisters(device *yardstick.Device, overrides func(*RegisterMap), fn func() error) (err error) {
+	snap, err := Snapshot(device)
+	if err != nil {
+		return fmt.Errorf("failed to save registers: %w", err)
+	}
+	defer func() {
+		if rerr := Restore(device, snap); rerr != nil && err == nil {
+			err = fmt.Errorf("failed to restore registers: %w", rerr)
+		}
+	}()
+
+	if overrides != nil {
+		regs := snap.Registers
+		overrides(&regs)
+		if err := SetIDLE(device); err != nil {
+			return fmt.Errorf("failed to set IDLE state: %w", err)
+		}
+		if _, err := WriteChangedRegisters(device, &snap.Registers, &regs); err != nil {
+			return fmt.Errorf("failed to apply overrides: %w", err)
+		}
+		if snap.State == StateRX {
+			if err := SetRX(device); err != nil {
+				return fmt.Errorf("failed to set RX state: %w", err)
+			}
+		}
+	}
+	return fn()
+}
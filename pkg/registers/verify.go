@@ -0,0 +1,103 @@
+package registers
+
+import (
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// verifyMask holds the bits of a register VerifyRegisters compares, for
+// registers the radio changes on its own. The status registers from
+// PARTNUM up are read-only and never compared
+var verifyMask = map[uint16]uint8{
+	// Synthesizer calibration writes its results over these
+	RegFSCAL3: 0xF0, // FSCAL3[3:0] is the charge pump calibration result
+	RegFSCAL2: 0x20, // FSCAL2[4:0] is the VCO calibration result
+	RegFSCAL1: 0x00,
+	RegFSCAL0: 0x00,
+}
+
+// RegisterCheck is one register compared by VerifyRegisters
+type RegisterCheck struct {
+	Name     string `json:"register"`
+	Address  uint16 `json:"address"`
+	Expected uint8  `json:"expected"`
+	Actual   uint8  `json:"actual"`
+	Mask     uint8  `json:"mask"` // Bits compared; 0 for registers that are skipped
+}
+
+// Match reports whether the compared bits read back as expected
+func (c RegisterCheck) Match() bool {
+	return (c.Expected^c.Actual)&c.Mask == 0
+}
+
+// Skipped reports whether the register is read-only or volatile and was
+// not compared at all
+func (c RegisterCheck) Skipped() bool {
+	return c.Mask == 0
+}
+
+func (c RegisterCheck) String() string {
+	if c.Mask != 0xFF {
+		return fmt.Sprintf("%s (0x%04X) mismatch: expected 0x%02X, got 0x%02X under mask 0x%02X", c.Name, c.Address, c.Expected, c.Actual, c.Mask)
+	}
+	return fmt.Sprintf("%s (0x%04X) mismatch: expected 0x%02X, got 0x%02X", c.Name, c.Address, c.Expected, c.Actual)
+}
+
+// Verification is the result of comparing every register, in address
+// order
+type Verification struct {
+	Checks []RegisterCheck
+}
+
+// Mismatches returns the registers that read back differently than
+// expected
+func (v *Verification) Mismatches() []RegisterCheck {
+	var bad []RegisterCheck
+	for _, c := range v.Checks {
+		if !c.Match() {
+			bad = append(bad, c)
+		}
+	}
+	return bad
+}
+
+// OK reports whether every compared register matched
+func (v *Verification) OK() bool {
+	return len(v.Mismatches()) == 0
+}
+
+// CompareRegisters compares two register sets, ignoring the read-only
+// status registers and the bits calibration changes
+func CompareRegisters(expected, actual *RegisterMap) *Verification {
+	v := &Verification{}
+	for _, name := range SortedNames() {
+		addr := Names[name]
+		mask, ok := verifyMask[addr]
+		if !ok {
+			mask = 0xFF
+		}
+		if addr >= RegPARTNUM {
+			mask = 0
+		}
+		v.Checks = append(v.Checks, RegisterCheck{
+			Name:     name,
+			Address:  addr,
+			Expected: expected.byName(name),
+			Actual:   actual.byName(name),
+			Mask:     mask,
+		})
+	}
+	return v
+}
+
+// VerifyRegisters reads the registers back from the device and compares
+// them with expected. It always reads the radio, never the registers
+// recorded with SetApplied
+func VerifyRegisters(device *yardstick.Device, expected *RegisterMap) (*Verification, error) {
+	actual, err := ReadAllRegisters(device)
+	if err != nil {
+		return nil, err
+	}
+	return CompareRegisters(expected, actual), nil
+}
@@ -0,0 +1,325 @@
+// Package regulatory checks radio profiles against the licence-exempt
+// rules of a region (FCC Part 15, ETSI EN 300 220) and builds transmit
+// governors that hold a device to the duty cycle of the band in use.
+//
+// The limits are a summary for test planning, not legal advice: they
+// cover the bands the CC1111 and CC2511 can tune, assume a continuous carrier when
+// comparing power, and leave out rules such as LBT/AFA alternatives and
+// spurious emissions.
+package regulatory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// ErrNonCompliant is returned when a profile fits no band of a region
+var ErrNonCompliant = errors.New("not compliant")
+
+// ErrUnknownRegion is returned by Lookup for names it doesn't know
+var ErrUnknownRegion = errors.New("unknown region")
+
+// erpToEIRP converts ERP limits, as ETSI states them, to EIRP
+const erpToEIRP = 2.15
+
+// Band is one set of rules for a frequency range
+type Band struct {
+	Name  string
+	Rule  string
+	MinHz float64
+	MaxHz float64
+
+	MaxEIRPDBm float64
+	// Average field strength limit in µV/m at 3 m at MinHz and MaxHz,
+	// linear in between; used instead of MaxEIRPDBm when set
+	FieldStrength [2]float64
+
+	MaxBandwidthHz   float64 // Occupied bandwidth limit (0 = band edges only)
+	MaxBandwidthFrac float64 // Occupied bandwidth limit as a fraction of the centre frequency (0 = none)
+
+	DutyCycle  float64       // Fraction of DutyWindow allowed on air (0 = no limit)
+	DutyWindow time.Duration // Observation period for DutyCycle
+	MaxTxTime  time.Duration // Longest single transmission (0 = no limit)
+
+	Hopping bool // Only for frequency-hopping systems
+}
+
+// Region is a set of bands, tried in order
+type Region struct {
+	Name        string
+	Description string
+	Bands       []*Band
+}
+
+// FCC covers FCC Part 15 in the CC1111 and CC2511 bands
+var FCC = &Region{
+	Name:        "fcc",
+	Description: "United States, FCC Part 15",
+	Bands: []*Band{
+		{
+			Name: "260-470 MHz control signals", Rule: "FCC 15.231(a)",
+			MinHz: 260e6, MaxHz: 470e6,
+			FieldStrength:    [2]float64{3750, 12500},
+			MaxBandwidthFrac: 0.0025,
+			MaxTxTime:        5 * time.Second,
+		},
+		{
+			Name: "902-928 MHz", Rule: "FCC 15.249",
+			MinHz: 902e6, MaxHz: 928e6,
+			FieldStrength: [2]float64{50000, 50000},
+		},
+		{
+			Name: "902-928 MHz frequency hopping", Rule: "FCC 15.247",
+			MinHz: 902e6, MaxHz: 928e6,
+			MaxEIRPDBm:     36, // 1 W conducted into a 6 dBi antenna
+			MaxBandwidthHz: 500e3,
+			DutyCycle:      0.4 / 20, // 0.4 s per channel in 20 s
+			DutyWindow:     20 * time.Second,
+			Hopping:        true,
+		},
+		{
+			Name: "2400-2483.5 MHz", Rule: "FCC 15.249",
+			MinHz: 2400e6, MaxHz: 2483.5e6,
+			FieldStrength: [2]float64{50000, 50000},
+		},
+	},
+}
+
+// ETSI covers the EN 300 220 sub-bands of ERC Recommendation 70-03
+// Annex 1 in the CC1111 bands, and the EN 300 440 2.4 GHz band; narrower
+// sub-bands come first so a profile gets the most permissive band it fits
+var ETSI = &Region{
+	Name:        "etsi",
+	Description: "Europe, ETSI EN 300 220 / EN 300 440 / ERC Rec 70-03",
+	Bands: []*Band{
+		{
+			Name: "434.040-434.790 MHz", Rule: "EN 300 220",
+			MinHz: 434.04e6, MaxHz: 434.79e6,
+			MaxEIRPDBm:     10 + erpToEIRP,
+			MaxBandwidthHz: 25e3,
+		},
+		{
+			Name: "433.050-434.790 MHz", Rule: "EN 300 220",
+			MinHz: 433.05e6, MaxHz: 434.79e6,
+			MaxEIRPDBm: 10 + erpToEIRP,
+			DutyCycle:  0.10,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "868.000-868.600 MHz", Rule: "EN 300 220",
+			MinHz: 868.0e6, MaxHz: 868.6e6,
+			MaxEIRPDBm: 14 + erpToEIRP,
+			DutyCycle:  0.01,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "868.700-869.200 MHz", Rule: "EN 300 220",
+			MinHz: 868.7e6, MaxHz: 869.2e6,
+			MaxEIRPDBm: 14 + erpToEIRP,
+			DutyCycle:  0.001,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "869.400-869.650 MHz", Rule: "EN 300 220",
+			MinHz: 869.4e6, MaxHz: 869.65e6,
+			MaxEIRPDBm: 27 + erpToEIRP,
+			DutyCycle:  0.10,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "869.700-870.000 MHz", Rule: "EN 300 220",
+			MinHz: 869.7e6, MaxHz: 870.0e6,
+			MaxEIRPDBm: 7 + erpToEIRP,
+		},
+		{
+			Name: "865.000-868.000 MHz", Rule: "EN 300 220",
+			MinHz: 865.0e6, MaxHz: 868.0e6,
+			MaxEIRPDBm: 14 + erpToEIRP,
+			DutyCycle:  0.01,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "863.000-870.000 MHz", Rule: "EN 300 220",
+			MinHz: 863.0e6, MaxHz: 870.0e6,
+			MaxEIRPDBm: 14 + erpToEIRP,
+			DutyCycle:  0.001,
+			DutyWindow: time.Hour,
+		},
+		{
+			Name: "2400.000-2483.500 MHz", Rule: "EN 300 440",
+			MinHz: 2400e6, MaxHz: 2483.5e6,
+			MaxEIRPDBm: 10,
+		},
+	},
+}
+
+var regions = map[string]*Region{
+	FCC.Name:  FCC,
+	ETSI.Name: ETSI,
+}
+
+// Names returns the region names Lookup accepts, sorted
+func Names() []string {
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the region with the given name, ignoring case
+func Lookup(name string) (*Region, error) {
+	if r, ok := regions[strings.ToLower(name)]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("%w '%s' (known: %s)", ErrUnknownRegion, name, strings.Join(Names(), ", "))
+}
+
+// Options describe the setup around the radio
+type Options struct {
+	GainDB  float64 // Amplifier and antenna gain added to the radio's output for EIRP
+	Hopping bool    // The profile is used by a frequency-hopping system
+}
+
+// MaxEIRP returns the band's EIRP limit in dBm at freqHz
+func (b *Band) MaxEIRP(freqHz float64) float64 {
+	if b.FieldStrength[0] == 0 {
+		return b.MaxEIRPDBm
+	}
+	frac := (freqHz - b.MinHz) / (b.MaxHz - b.MinHz)
+	uVm := b.FieldStrength[0] + frac*(b.FieldStrength[1]-b.FieldStrength[0])
+	// Far-field EIRP for a field strength at 3 m
+	return 20*math.Log10(uVm) + 20*math.Log10(3) - 104.77
+}
+
+// EIRP returns the power the profile radiates in dBm: its PA table
+// setting, the band maximum when it has none, plus opts.GainDB
+func EIRP(p *profiles.Profile, opts Options) float64 {
+	dBm, _ := cc1111.PATableDBm(uint32(p.FrequencyHz), profiles.GetMaxPower(p.FrequencyHz))
+	if power, ok := p.TXPower(); ok {
+		if _, chosen, err := cc1111.PATableValue(uint32(p.FrequencyHz), float64(max(power, profiles.MinTXPowerDBm))); err == nil {
+			dBm = chosen
+		}
+	}
+	return dBm + opts.GainDB
+}
+
+// problems returns why the profile doesn't fit the band, or nil when it
+// does
+func (b *Band) problems(p *profiles.Profile, opts Options) []string {
+	var problems []string
+	bw := p.SignalBandwidth()
+	lo, hi := p.FrequencyHz-bw/2, p.FrequencyHz+bw/2
+	if lo < b.MinHz || hi > b.MaxHz {
+		return []string{fmt.Sprintf("%.3f-%.3f MHz signal is outside the band", lo/1e6, hi/1e6)}
+	}
+	if b.Hopping && !opts.Hopping {
+		problems = append(problems, "only for frequency hopping")
+	}
+	if b.MaxBandwidthHz > 0 && bw > b.MaxBandwidthHz {
+		problems = append(problems, fmt.Sprintf("%.1f kHz bandwidth exceeds %.1f kHz", bw/1e3, b.MaxBandwidthHz/1e3))
+	}
+	if limit := b.MaxBandwidthFrac * p.FrequencyHz; limit > 0 && bw > limit {
+		problems = append(problems, fmt.Sprintf("%.1f kHz bandwidth exceeds %.1f kHz (%.2f%% of the centre frequency)", bw/1e3, limit/1e3, b.MaxBandwidthFrac*100))
+	}
+	if eirp, limit := EIRP(p, opts), b.MaxEIRP(p.FrequencyHz); eirp > limit {
+		problems = append(problems, fmt.Sprintf("%.1f dBm EIRP exceeds %.1f dBm", eirp, limit))
+	}
+	return problems
+}
+
+// Check returns the first band of the region the profile's frequency,
+// bandwidth and power fit in, or an error wrapping ErrNonCompliant
+// saying why each band in range was rejected
+func (r *Region) Check(p *profiles.Profile, opts Options) (*Band, error) {
+	b, problems := r.Fit(p, opts)
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNonCompliant, strings.Join(problems, "; "))
+	}
+	return b, nil
+}
+
+// Fit is Check returning the reasons a profile fits no band as a list,
+// one per band in range
+func (r *Region) Fit(p *profiles.Profile, opts Options) (*Band, []string) {
+	var rejected []string
+	for _, b := range r.Bands {
+		problems := b.problems(p, opts)
+		if problems == nil {
+			return b, nil
+		}
+		if p.FrequencyHz >= b.MinHz && p.FrequencyHz <= b.MaxHz {
+			rejected = append(rejected, fmt.Sprintf("%s (%s): %s", b.Name, b.Rule, strings.Join(problems, ", ")))
+		}
+	}
+	if len(rejected) == 0 {
+		return nil, []string{fmt.Sprintf("%.3f MHz is in no %s band", p.FrequencyHz/1e6, r.Name)}
+	}
+	return nil, rejected
+}
+
+// Governor returns a blocking transmit limiter holding the profile to
+// the band's duty cycle and transmission time, or nil when the band has
+// neither. The whole duty budget of a window may be used in one burst
+func (b *Band) Governor(p *profiles.Profile) (*yardstick.TxLimiter, error) {
+	if b.DutyCycle == 0 && b.MaxTxTime == 0 {
+		return nil, nil
+	}
+	return yardstick.NewTxLimiter(yardstick.TxLimitConfig{
+		DutyCycle:    b.DutyCycle,
+		AirtimeBurst: time.Duration(b.DutyCycle * float64(b.DutyWindow)),
+		BitRate:      p.DataRateBaud,
+		MaxAirtime:   b.MaxTxTime,
+		Block:        true,
+	})
+}
+
+// Enforce checks the profile against the region and attaches the band's
+// governor to the device, replacing any limiter already set, so every
+// RFXmit on it stays within the band's duty cycle. A band without limits
+// removes the previous band's governor. The profile should be
+// the one applied to the device. The gain of the board's own amplifier
+// is added to opts.GainDB unless the amplifier is known to be bypassed
+func Enforce(device *yardstick.Device, r *Region, p *profiles.Profile, opts Options) (*Band, error) {
+	if caps := device.Capabilities(); caps.Amplifier {
+		if mode, err := device.GetAmpMode(); err != nil || mode != yardstick.AmpModeOff {
+			opts.GainDB += caps.AmpGainDB
+		}
+	}
+	b, err := r.Check(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	gov, err := b.Governor(p)
+	if err != nil {
+		return nil, err
+	}
+	device.SetTxLimiter(gov)
+	return b, nil
+}
+
+// String describes the band's limits in one line
+func (b *Band) String() string {
+	parts := []string{fmt.Sprintf("%s (%s)", b.Name, b.Rule)}
+	if b.FieldStrength[0] == 0 {
+		parts = append(parts, fmt.Sprintf("%.1f dBm EIRP", b.MaxEIRPDBm))
+	} else {
+		parts = append(parts, fmt.Sprintf("%.0f-%.0f µV/m at 3 m", b.FieldStrength[0], b.FieldStrength[1]))
+	}
+	if b.DutyCycle > 0 {
+		parts = append(parts, fmt.Sprintf("%g%% duty cycle per %v", b.DutyCycle*100, b.DutyWindow))
+	}
+	if b.MaxTxTime > 0 {
+		parts = append(parts, fmt.Sprintf("%v per transmission", b.MaxTxTime))
+	}
+	return strings.Join(parts, ", ")
+}
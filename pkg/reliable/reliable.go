@@ -0,0 +1,309 @@
+// Package reliable provides a stop-and-wait acknowledged message link
+// between two radios running the same profile
+//
+// Each message carries a sequence number; the receiver acknowledges every
+// copy it hears and drops duplicates, and the sender retransmits until it
+// sees the matching ACK or runs out of retries. Unacknowledged datagrams
+// share the same framing for traffic such as link probes.
+package reliable
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Frame layout: magic, type, sequence number, payload length, payload
+const (
+	frameMagic  = 0x5A
+	headerLen   = 4
+	typeData    = 0x01
+	typeAck     = 0x02
+	typeDgram   = 0x03
+	recvPollMax = 200 * time.Millisecond
+)
+
+// ErrTimeout is returned when nothing arrives before the deadline
+var ErrTimeout = errors.New("reliable: receive timed out")
+
+// ErrNoAck is returned when a message was not acknowledged after all retries
+var ErrNoAck = errors.New("reliable: no acknowledgement")
+
+// Options tunes the retransmission behaviour
+type Options struct {
+	AckTimeout time.Duration // Time to wait for an ACK before retransmitting
+	MaxBackoff time.Duration // Above AckTimeout, each retry doubles the wait up to this
+	Retries    int           // Retransmissions after the first attempt
+	AckDelay   time.Duration // Pause before sending an ACK so the sender is back in RX
+
+	// Transmit sends one frame; nil uses RFXmit. pkg/fhss sends on the
+	// current hop channel instead
+	Transmit func(frame []byte) error
+	// MaxFrame caps a frame, with its variable mode length byte, below
+	// what the packet format allows; 0 for no cap
+	MaxFrame int
+}
+
+// DefaultOptions returns settings that suit the slower built-in profiles
+func DefaultOptions() *Options {
+	return &Options{
+		AckTimeout: 300 * time.Millisecond,
+		Retries:    5,
+		AckDelay:   20 * time.Millisecond,
+	}
+}
+
+// Stats counts link activity since the link was created
+type Stats struct {
+	Sent            int `json:"sent"`
+	Retransmissions int `json:"retransmissions"`
+	Received        int `json:"received"`
+	Duplicates      int `json:"duplicates"`
+	AcksSent        int `json:"acks_sent"`
+}
+
+// Link is one end of an acknowledged link over a device
+// A Link is not safe for concurrent use
+type Link struct {
+	device  *yardstick.Device
+	opts    Options
+	txSeq   uint8
+	lastRx  int // Sequence number of the last delivered message, -1 for none
+	stats   Stats
+	pending [][]byte // Data frames heard while waiting for an ACK
+}
+
+// New creates a link over device; nil opts uses DefaultOptions
+func New(device *yardstick.Device, opts *Options) *Link {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	return &Link{
+		device: device,
+		opts:   *opts,
+		lastRx: -1,
+	}
+}
+
+// Stats returns the link counters
+func (l *Link) Stats() Stats {
+	return l.stats
+}
+
+// MaxPayload returns the largest message the current packet format, and
+// MaxFrame, let a frame carry
+func (l *Link) MaxPayload() int {
+	frame, lengthByte := 255, 0
+	if f := l.device.PacketFormat(); f != nil && f.LengthMode&0x03 != yardstick.LengthInfinite {
+		frame = int(f.PktLen)
+		if f.LengthMode&0x03 == yardstick.LengthVariable {
+			lengthByte = 1
+		}
+	}
+	if l.opts.MaxFrame > 0 {
+		frame = min(frame, l.opts.MaxFrame-lengthByte)
+	}
+	return frame - headerLen
+}
+
+// transmit sends a frame with the Transmit option, or RFXmit without one
+func (l *Link) transmit(frame []byte) error {
+	if l.opts.Transmit != nil {
+		return l.opts.Transmit(frame)
+	}
+	return l.device.RFXmit(frame, 0, 0)
+}
+
+// Send transmits payload and waits for it to be acknowledged
+func (l *Link) Send(payload []byte) error {
+	seq := l.txSeq
+	frame, err := l.encode(typeData, seq, payload)
+	if err != nil {
+		return err
+	}
+
+	wait := l.opts.AckTimeout
+	for attempt := 0; attempt <= l.opts.Retries; attempt++ {
+		if attempt > 0 {
+			l.stats.Retransmissions++
+			wait = min(2*wait, max(l.opts.MaxBackoff, l.opts.AckTimeout))
+		}
+		if err := l.transmit(frame); err != nil {
+			return fmt.Errorf("transmit failed: %w", err)
+		}
+		if err := l.device.SetModeRX(); err != nil {
+			return fmt.Errorf("failed to enter RX mode: %w", err)
+		}
+
+		deadline := time.Now().Add(wait)
+		for time.Now().Before(deadline) {
+			typ, rseq, body, err := l.recvFrame(time.Until(deadline))
+			if err != nil {
+				if errors.Is(err, ErrTimeout) {
+					break
+				}
+				return err
+			}
+			switch {
+			case typ == typeAck && rseq == seq:
+				l.txSeq++
+				l.stats.Sent++
+				return nil
+			case typ == typeData:
+				// The peer is sending too; acknowledge so it isn't left
+				// retrying, and deliver it from the next Recv
+				if err := l.ack(rseq); err != nil {
+					return err
+				}
+				if int(rseq) != l.lastRx {
+					l.lastRx = int(rseq)
+					l.pending = append(l.pending, body)
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w after %d attempts", ErrNoAck, l.opts.Retries+1)
+}
+
+// Recv waits up to timeout for the next acknowledged message
+// Duplicates caused by lost ACKs are acknowledged again and dropped
+func (l *Link) Recv(timeout time.Duration) ([]byte, error) {
+	if len(l.pending) > 0 {
+		body := l.pending[0]
+		l.pending = l.pending[1:]
+		l.stats.Received++
+		return body, nil
+	}
+	if err := l.device.SetModeRX(); err != nil {
+		return nil, fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		typ, seq, body, err := l.recvFrame(time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if typ != typeData {
+			continue
+		}
+		if err := l.ack(seq); err != nil {
+			return nil, err
+		}
+		if int(seq) == l.lastRx {
+			l.stats.Duplicates++
+			continue
+		}
+		l.lastRx = int(seq)
+		l.stats.Received++
+		return body, nil
+	}
+	return nil, ErrTimeout
+}
+
+// SendDatagram transmits payload once without waiting for an ACK
+func (l *Link) SendDatagram(seq uint8, payload []byte) error {
+	frame, err := l.encode(typeDgram, seq, payload)
+	if err != nil {
+		return err
+	}
+	return l.transmit(frame)
+}
+
+// RecvDatagram waits up to timeout for the next datagram, returning its
+// sequence number and payload; acknowledged messages are ignored
+func (l *Link) RecvDatagram(timeout time.Duration) (uint8, []byte, error) {
+	if err := l.device.SetModeRX(); err != nil {
+		return 0, nil, fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		typ, seq, body, err := l.recvFrame(time.Until(deadline))
+		if err != nil {
+			return 0, nil, err
+		}
+		if typ == typeDgram {
+			return seq, body, nil
+		}
+	}
+	return 0, nil, ErrTimeout
+}
+
+// ack acknowledges seq and returns the radio to RX
+func (l *Link) ack(seq uint8) error {
+	frame, err := l.encode(typeAck, seq, nil)
+	if err != nil {
+		return err
+	}
+	time.Sleep(l.opts.AckDelay)
+	if err := l.transmit(frame); err != nil {
+		return fmt.Errorf("failed to send ACK: %w", err)
+	}
+	l.stats.AcksSent++
+	return l.device.SetModeRX()
+}
+
+// recvFrame reads packets until one parses as a frame or timeout expires
+// Malformed packets, such as FHSS beacons, are skipped. USB failures,
+// including a disconnected device, are returned instead of waiting out
+// the timeout
+func (l *Link) recvFrame(timeout time.Duration) (uint8, uint8, []byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, 0, nil, ErrTimeout
+		}
+		if remaining > recvPollMax {
+			remaining = recvPollMax
+		}
+		raw, err := l.device.RFRecv(remaining, 0)
+		if errors.Is(err, yardstick.ErrUSB) {
+			return 0, 0, nil, fmt.Errorf("receive failed: %w", err)
+		}
+		if err != nil || len(raw) == 0 {
+			// Timeout is normal
+			continue
+		}
+		if typ, seq, body, ok := l.decode(raw); ok {
+			return typ, seq, body, nil
+		}
+	}
+}
+
+// encode builds a frame sized for the current packet format
+func (l *Link) encode(typ, seq uint8, payload []byte) ([]byte, error) {
+	if len(payload) > l.MaxPayload() {
+		return nil, fmt.Errorf("%w: %d byte message exceeds %d byte link maximum",
+			yardstick.ErrPayloadLength, len(payload), l.MaxPayload())
+	}
+	frame := append([]byte{frameMagic, typ, seq, uint8(len(payload))}, payload...)
+
+	f := l.device.PacketFormat()
+	switch {
+	case f == nil:
+	case f.LengthMode&0x03 == yardstick.LengthFixed:
+		frame = append(frame, make([]byte, int(f.PktLen)-len(frame))...)
+	case f.LengthMode&0x03 == yardstick.LengthVariable:
+		frame = append([]byte{uint8(len(frame))}, frame...)
+	}
+	return frame, nil
+}
+
+// decode parses a received packet, skipping the variable mode length byte
+func (l *Link) decode(raw []byte) (uint8, uint8, []byte, bool) {
+	if f := l.device.PacketFormat(); f != nil && f.LengthMode&0x03 == yardstick.LengthVariable && len(raw) > 0 {
+		raw = raw[1:]
+	}
+	if len(raw) < headerLen || raw[0] != frameMagic {
+		return 0, 0, nil, false
+	}
+	n := int(raw[3])
+	if len(raw) < headerLen+n {
+		return 0, 0, nil, false
+	}
+	body := append([]byte{}, raw[headerLen:headerLen+n]...)
+	return raw[1], raw[2], body, true
+}
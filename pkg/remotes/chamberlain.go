@@ -0,0 +1,89 @@
+package remotes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chamberlain, Craftsman and LiftMaster garage door openers made before
+// rolling codes use a fixed code set with 8 to 12 DIP switches (9 on most
+// 390 MHz models, 10 on others). Each switch is sent as 4 units of
+// 500 us: 3 of carrier and 1 off for a switch that is on, 1 of carrier
+// and 3 off for one that is off. The word is followed by 39 units of
+// silence and repeated for as long as the button is held.
+const (
+	ChamberlainFrequencyHz = 390000000
+	ChamberlainUnitUs      = 500
+	ChamberlainMinSwitches = 8
+	ChamberlainMaxSwitches = 12
+
+	chamberlainSymbolUnits = 4
+	chamberlainGapUnits    = 39
+)
+
+// DefaultChamberlainRepeat is how many words a press sends
+const DefaultChamberlainRepeat = 8
+
+// ParseSwitches reads DIP switch positions written as 1 for on and 0 for
+// off (or + and -, as printed on some openers), first switch first
+func ParseSwitches(s string) ([]bool, error) {
+	switches := make([]bool, 0, len(s))
+	for _, c := range s {
+		switch c {
+		case '1', '+':
+			switches = append(switches, true)
+		case '0', '-':
+			switches = append(switches, false)
+		default:
+			return nil, fmt.Errorf("DIP switches '%s': '%c' is not 1, 0, + or -", s, c)
+		}
+	}
+	return switches, nil
+}
+
+// Chamberlain encodes the code set by switches, sent repeat times
+// unitUs 0 means ChamberlainUnitUs
+func Chamberlain(switches []bool, repeat, unitUs int) (*Transmission, error) {
+	if n := len(switches); n < ChamberlainMinSwitches || n > ChamberlainMaxSwitches {
+		return nil, fmt.Errorf("Chamberlain codes have %d-%d switches, not %d", ChamberlainMinSwitches, ChamberlainMaxSwitches, n)
+	}
+	if repeat < 1 {
+		repeat = 1
+	}
+	if unitUs <= 0 {
+		unitUs = ChamberlainUnitUs
+	}
+
+	var b bitstream
+	var code strings.Builder
+	for i := 0; i < repeat; i++ {
+		for _, on := range switches {
+			if on {
+				b.put(1, chamberlainSymbolUnits-1)
+				b.put(0, 1)
+			} else {
+				b.put(1, 1)
+				b.put(0, chamberlainSymbolUnits-1)
+			}
+			if i == 0 {
+				code.WriteByte("01"[boolBit(on)])
+			}
+		}
+		b.put(0, chamberlainGapUnits)
+	}
+
+	return &Transmission{
+		Protocol:    "chamberlain",
+		Description: fmt.Sprintf("Chamberlain %d-switch code %s", len(switches), code.String()),
+		FrequencyHz: ChamberlainFrequencyHz,
+		UnitUs:      unitUs,
+		Bitstream:   b.out,
+	}, nil
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
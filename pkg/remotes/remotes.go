@@ -0,0 +1,104 @@
+// Package remotes encodes the frames of common sub-GHz remote controls
+// into ready-to-send OOK transmissions: a bitstream with one bit per time
+// unit of the protocol, the data rate that makes a bit last one unit and
+// the frequency receivers listen on. Profile gives the matching no-sync
+// OOK radio settings, and Send applies them and transmits in one call.
+package remotes
+
+import (
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/princeton"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Transmission is an encoded remote control transmission
+type Transmission struct {
+	Protocol    string  `json:"protocol"`
+	Description string  `json:"description"`
+	FrequencyHz float64 `json:"frequency_hz"`
+	UnitUs      int     `json:"unit_us"` // Duration of one bit of Bitstream
+	Bitstream   []byte  `json:"bitstream"`
+}
+
+// DataRate is the rate, in baud, that sends one bit per unit
+func (t *Transmission) DataRate() float64 {
+	return 1e6 / float64(t.UnitUs)
+}
+
+// Duration is how long the transmission lasts on air, in microseconds
+func (t *Transmission) Duration() int {
+	return len(t.Bitstream) * 8 * t.UnitUs
+}
+
+// Pulses returns the transmission as signed pulse durations in
+// microseconds, the pkg/capture convention, e.g. for a .sub file
+func (t *Transmission) Pulses() []int {
+	return capture.BitsToPulses(t.Bitstream, t.UnitUs)
+}
+
+// Profile returns the radio settings that send the bitstream as timed:
+// ASK/OOK with no sync word at DataRate, the packet length set to the
+// bitstream (infinite for bitstreams longer than a packet) and the
+// shortest preamble the radio allows
+func (t *Transmission) Profile() *profiles.Profile {
+	p := profiles.New433OOKPWM(t.DataRate())
+	p.Name = "remote-" + t.Protocol
+	p.Description = t.Description
+	p.FrequencyHz = t.FrequencyHz
+	p.PreambleBytes = 2
+	if len(t.Bitstream) > yardstick.RFMaxTXBlock {
+		p.PktLenMode = profiles.PktLenInfinite
+	} else {
+		p.PktLenMode = profiles.PktLenFixed
+		p.PktLen = uint8(len(t.Bitstream))
+	}
+	return p
+}
+
+// Send configures the device with the transmission's profile at the
+// given power and transmits it; the radio is left IDLE
+func Send(device *yardstick.Device, t *Transmission, powerDBm int) error {
+	p := t.Profile()
+	p.SetTXPower(powerDBm)
+	if err := config.ApplyProfile(device, p); err != nil {
+		return fmt.Errorf("failed to apply profile: %w", err)
+	}
+	if err := device.SetModeTX(); err != nil {
+		return err
+	}
+	defer device.SetModeIDLE()
+	return device.RFXmit(t.Bitstream, 0, 0)
+}
+
+// Princeton wraps a PT2262/EV1527 code, repeated repeat times, as a
+// Transmission at 433.92 MHz
+func Princeton(c *princeton.Code, repeat int) *Transmission {
+	return &Transmission{
+		Protocol:    "princeton",
+		Description: c.String(),
+		FrequencyHz: 433920000,
+		UnitUs:      c.PulseUs,
+		Bitstream:   c.Bitstream(repeat),
+	}
+}
+
+// bitstream builds an OOK bitstream one unit at a time, MSB first
+type bitstream struct {
+	out []byte
+	n   int
+}
+
+// put appends units of carrier (level 1) or silence (level 0)
+func (b *bitstream) put(level byte, units int) {
+	for i := 0; i < units; i++ {
+		if b.n%8 == 0 {
+			b.out = append(b.out, 0)
+		}
+		b.out[len(b.out)-1] |= level << uint(7-b.n%8)
+		b.n++
+	}
+}
@@ -0,0 +1,155 @@
+package remotes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Somfy RTS (Radio Technology Somfy) drives roller shutters and awnings
+// at 433.42 MHz. A frame is 7 bytes:
+//
+//	byte 0    0xA0 | key nibble (the low nibble of the rolling code here)
+//	byte 1    command << 4 | checksum, the XOR of every nibble of the frame
+//	bytes 2-3 rolling code, big endian
+//	bytes 4-6 remote address, big endian
+//
+// then obfuscated by XORing each byte with the obfuscated byte before it.
+// On air, in units of 640 us: a wake-up pulse of 15 units and 140 of
+// silence before the first frame, 2 hardware sync pulses of 4 units on
+// and 4 off (7 before repeats), a software sync of 7 on and 1 off, the 56
+// bits Manchester coded with 1 unit per half bit (a rising edge for 1)
+// and 48 units of silence between frames.
+//
+// Receivers accept a rolling code a little ahead of the last one they
+// saw, so every press must use the next code.
+const (
+	SomfyFrequencyHz = 433420000
+	SomfyUnitUs      = 640
+	SomfyFrameBytes  = 7
+
+	somfyWakeupUnits    = 15
+	somfyWakeupGapUnits = 140
+	somfyHWSyncUnits    = 4
+	somfySWSyncUnits    = 7
+	somfyGapUnits       = 48
+)
+
+// SomfyCommand is a Somfy RTS button
+type SomfyCommand uint8
+
+// Somfy RTS commands
+const (
+	SomfyMy      SomfyCommand = 0x1 // Stop, or go to the favourite position
+	SomfyUp      SomfyCommand = 0x2
+	SomfyMyUp    SomfyCommand = 0x3
+	SomfyDown    SomfyCommand = 0x4
+	SomfyMyDown  SomfyCommand = 0x5
+	SomfyUpDown  SomfyCommand = 0x6
+	SomfyProg    SomfyCommand = 0x8 // Pair with, or unpair from, a receiver in programming mode
+	SomfySunFlag SomfyCommand = 0x9
+	SomfyFlag    SomfyCommand = 0xA
+)
+
+var somfyCommandNames = []struct {
+	name string
+	cmd  SomfyCommand
+}{
+	{"my", SomfyMy}, {"up", SomfyUp}, {"my-up", SomfyMyUp}, {"down", SomfyDown}, {"my-down", SomfyMyDown},
+	{"up-down", SomfyUpDown}, {"prog", SomfyProg}, {"sun-flag", SomfySunFlag}, {"flag", SomfyFlag},
+}
+
+// ParseSomfyCommand parses a command name: my, up, my-up, down, my-down,
+// up-down, prog, sun-flag or flag
+func ParseSomfyCommand(s string) (SomfyCommand, error) {
+	var names []string
+	for _, c := range somfyCommandNames {
+		if strings.EqualFold(s, c.name) {
+			return c.cmd, nil
+		}
+		names = append(names, c.name)
+	}
+	return 0, fmt.Errorf("unknown Somfy command '%s' (known: %s)", s, strings.Join(names, ", "))
+}
+
+// String returns the command's name
+func (c SomfyCommand) String() string {
+	for _, n := range somfyCommandNames {
+		if n.cmd == c {
+			return n.name
+		}
+	}
+	return fmt.Sprintf("0x%X", uint8(c))
+}
+
+// SomfyFrame returns the 7 obfuscated frame bytes for a press
+func SomfyFrame(address uint32, rolling uint16, cmd SomfyCommand) ([]byte, error) {
+	if address >= 1<<24 {
+		return nil, fmt.Errorf("Somfy address 0x%X out of range (24 bits)", address)
+	}
+	if cmd > 0xF {
+		return nil, fmt.Errorf("Somfy command 0x%X out of range (4 bits)", uint8(cmd))
+	}
+	frame := []byte{
+		0xA0 | byte(rolling&0xF),
+		byte(cmd) << 4,
+		byte(rolling >> 8), byte(rolling),
+		byte(address >> 16), byte(address >> 8), byte(address),
+	}
+	var checksum byte
+	for _, b := range frame {
+		checksum ^= b ^ b>>4
+	}
+	frame[1] |= checksum & 0xF
+	for i := 1; i < len(frame); i++ {
+		frame[i] ^= frame[i-1]
+	}
+	return frame, nil
+}
+
+// Somfy encodes a press of cmd from the remote at address with the given
+// rolling code, as one frame and repeat repeats
+func Somfy(address uint32, rolling uint16, cmd SomfyCommand, repeat int) (*Transmission, error) {
+	frame, err := SomfyFrame(address, rolling, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if repeat < 0 {
+		repeat = 0
+	}
+
+	var b bitstream
+	for i := 0; i <= repeat; i++ {
+		syncs := 7
+		if i == 0 {
+			b.put(1, somfyWakeupUnits)
+			b.put(0, somfyWakeupGapUnits)
+			syncs = 2
+		}
+		for j := 0; j < syncs; j++ {
+			b.put(1, somfyHWSyncUnits)
+			b.put(0, somfyHWSyncUnits)
+		}
+		b.put(1, somfySWSyncUnits)
+		b.put(0, 1)
+		for _, byt := range frame {
+			for bit := 7; bit >= 0; bit-- {
+				if byt>>uint(bit)&1 == 1 {
+					b.put(0, 1)
+					b.put(1, 1)
+				} else {
+					b.put(1, 1)
+					b.put(0, 1)
+				}
+			}
+		}
+		b.put(0, somfyGapUnits)
+	}
+
+	return &Transmission{
+		Protocol:    "somfy",
+		Description: fmt.Sprintf("Somfy RTS address 0x%06X rolling code %d %s", address, rolling, cmd),
+		FrequencyHz: SomfyFrequencyHz,
+		UnitUs:      SomfyUnitUs,
+		Bitstream:   b.out,
+	}, nil
+}
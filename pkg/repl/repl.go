@@ -0,0 +1,628 @@
+// Package repl implements the commands of the interactive gocat console
+//
+// A Shell runs one command line at a time against an open device: tune
+// the radio, peek and poke registers, transmit hex and receive packets.
+// "watch on" keeps a receiver running between commands and prints
+// packets as they arrive; it is paused while each command runs so the
+// two never share the USB endpoint. The terminal side (line editing,
+// history) lives in the caller, which also uses Complete for tab
+// completion. A shell resumed from a saved session (pkg/sessionstate)
+// keeps it up to date after every command, so an interrupted session
+// can pick up where it left off.
+package repl
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/sessionstate"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// ErrQuit is returned by Exec for "quit" and "exit"
+var ErrQuit = errors.New("quit")
+
+// Shell runs console commands against a device
+type Shell struct {
+	device *yardstick.Device
+	out    io.Writer
+	outMu  sync.Mutex
+
+	session *sessionstate.State // Saved after each command; nil when not resumed
+
+	watchMu sync.Mutex
+	watch   bool          // Set by "watch on"
+	stop    chan struct{} // Closes to pause the receiver
+	done    chan struct{} // Closed when the receiver has stopped
+}
+
+// command is one console command
+type command struct {
+	args     string
+	help     string
+	run      func(s *Shell, args []string) error
+	complete func(arg int) []string // Candidates for argument arg (0-based); may be nil
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"help":    {"[command]", "List commands or show one command's usage", (*Shell).help, func(int) []string { return commandNames() }},
+		"info":    {"", "Show the device and firmware", (*Shell).info, nil},
+		"freq":    {"[MHz|Hz]", "Show or set the frequency (and calibrate)", (*Shell).freq, nil},
+		"mod":     {"[2fsk|gfsk|ook|4fsk|msk]", "Show or set the modulation", (*Shell).mod, func(int) []string { return modNames() }},
+		"rate":    {"[baud]", "Show or set the data rate", (*Shell).rate, nil},
+		"bw":      {"[Hz]", "Show or set the receive channel bandwidth", (*Shell).bw, nil},
+		"dev":     {"[Hz]", "Show or set the FSK deviation", (*Shell).dev, nil},
+		"sync":    {"[hex]", "Show or set the 16-bit sync word", (*Shell).sync, nil},
+		"power":   {"<dBm>", "Set the TX power (nearest setting not above)", (*Shell).power, nil},
+		"profile": {"<name|file>", "Apply a built-in profile or profile/configuration file", (*Shell).profile, func(int) []string { return profiles.Names() }},
+		"peek":    {"<register|address> [count]", "Read registers or XDATA memory", (*Shell).peek, registerArg},
+		"poke":    {"<register|address> <byte>...", "Write registers or XDATA memory", (*Shell).poke, registerArg},
+		"regs":    {"", "Dump the radio registers", (*Shell).regs, nil},
+		"tx":      {"<hex> [repeat]", "Transmit a packet", (*Shell).tx, nil},
+		"rx":      {"[timeout]", "Wait for one packet (default 5s)", (*Shell).rx, nil},
+		"watch":   {"[on|off]", "Print received packets live between commands", (*Shell).watchCmd, func(int) []string { return []string{"on", "off"} }},
+		"rssi":    {"", "Show the current RSSI", (*Shell).rssi, nil},
+		"state":   {"", "Show the radio state (MARCSTATE)", (*Shell).state, nil},
+		"idle":    {"", "Put the radio in IDLE", (*Shell).idle, nil},
+		"mark":    {"[MHz|Hz] [label]", "Add a frequency (default the current one) to the session watchlist", (*Shell).mark, nil},
+		"unmark":  {"<MHz|Hz>", "Remove a frequency from the session watchlist", (*Shell).unmark, nil},
+		"marks":   {"", "List the session watchlist", (*Shell).marks, nil},
+		"history": {"[count]", "List the session's recent commands", (*Shell).history, nil},
+		"quit":    {"", "Leave the console", func(*Shell, []string) error { return ErrQuit }, nil},
+	}
+	commands["exit"] = commands["quit"]
+}
+
+// New returns a shell for device writing to out
+func New(device *yardstick.Device, out io.Writer) *Shell {
+	return &Shell{device: device, out: out}
+}
+
+// printf writes to the output; safe to call from the receiver
+func (s *Shell) printf(format string, args ...interface{}) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	fmt.Fprintf(s.out, format, args...)
+}
+
+// Exec runs one command line; blank lines and # comments are ignored
+func (s *Shell) Exec(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil
+	}
+	c, ok := commands[strings.ToLower(fields[0])]
+	if !ok {
+		return fmt.Errorf("unknown command '%s' (try 'help')", fields[0])
+	}
+
+	s.pause()
+	defer s.resume()
+	err := c.run(s, fields[1:])
+	if !errors.Is(err, ErrQuit) {
+		s.record(line)
+	}
+	return err
+}
+
+// Close stops the live receiver
+func (s *Shell) Close() {
+	s.watchMu.Lock()
+	s.watch = false
+	s.watchMu.Unlock()
+	s.pause()
+}
+
+// Complete completes the last word of line. It returns the line extended
+// by the candidates' common prefix, and the candidates when more than one
+// remains
+func (s *Shell) Complete(line string) (string, []string) {
+	fields := strings.Fields(line)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var pool []string
+	if len(fields) == 0 {
+		pool = commandNames()
+	} else if c, ok := commands[strings.ToLower(fields[0])]; ok && c.complete != nil {
+		pool = c.complete(len(fields) - 1)
+	}
+
+	var matches []string
+	for _, p := range pool {
+		if strings.HasPrefix(strings.ToLower(p), strings.ToLower(word)) {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return line, nil
+	case 1:
+		return line[:len(line)-len(word)] + matches[0] + " ", nil
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) {
+		return line[:len(line)-len(word)] + prefix, matches
+	}
+	return line, matches
+}
+
+// commandNames returns the sorted command names
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// modNames returns the names parseMod accepts
+func modNames() []string {
+	return []string{"2fsk", "gfsk", "ook", "4fsk", "msk"}
+}
+
+// registerArg completes register names for the first argument
+func registerArg(arg int) []string {
+	if arg != 0 {
+		return nil
+	}
+	return registers.SortedNames()
+}
+
+func (s *Shell) help(args []string) error {
+	if len(args) > 0 {
+		c, ok := commands[strings.ToLower(args[0])]
+		if !ok {
+			return fmt.Errorf("unknown command '%s'", args[0])
+		}
+		s.printf("%s %s\n  %s\n", strings.ToLower(args[0]), c.args, c.help)
+		return nil
+	}
+	for _, name := range commandNames() {
+		if name == "exit" {
+			continue
+		}
+		c := commands[name]
+		s.printf("  %-30s %s\n", name+" "+c.args, c.help)
+	}
+	s.printf("Registers may be named (MDMCFG2) or given as addresses (0xDF0E). Tab completes\n")
+	s.printf("commands, profiles and register names; up/down recall earlier lines.\n")
+	return nil
+}
+
+func (s *Shell) info(args []string) error {
+	info := s.device.Info(true)
+	s.printf("%s %s, serial %s, bus %d address %d\n", info.Manufacturer, info.Product, info.Serial, info.Bus, info.Address)
+	s.printf("Firmware %s, chip %s\n", info.Firmware, info.Chip)
+	return nil
+}
+
+// parseFloatArg parses a number allowing k/M suffixes
+func parseFloatArg(s string) (float64, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		mult, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1e6, s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", s)
+	}
+	return v * mult, nil
+}
+
+// parseFreqArg parses a frequency in Hz; small values are MHz
+func parseFreqArg(arg string) (uint32, error) {
+	v, err := parseFloatArg(arg)
+	if err != nil {
+		return 0, err
+	}
+	if v < 10000 {
+		v *= 1e6
+	}
+	return uint32(v + 0.5), nil
+}
+
+func (s *Shell) freq(args []string) error {
+	if len(args) > 0 {
+		hz, err := parseFreqArg(args[0])
+		if err != nil {
+			return err
+		}
+		if err := s.device.Retune(hz); err != nil {
+			return err
+		}
+	}
+	hz, err := s.device.GetFrequency()
+	if err != nil {
+		return err
+	}
+	s.printf("%.6f MHz\n", float64(hz)/1e6)
+	return nil
+}
+
+// parseMod converts a modulation name to a MOD_FORMAT value
+func parseMod(name string) (uint8, error) {
+	switch strings.ToLower(name) {
+	case "2fsk", "fsk":
+		return yardstick.Mod2FSK, nil
+	case "gfsk":
+		return yardstick.ModGFSK, nil
+	case "ook", "ask":
+		return yardstick.ModASKOOK, nil
+	case "4fsk":
+		return yardstick.Mod4FSK, nil
+	case "msk":
+		return yardstick.ModMSK, nil
+	}
+	return 0, fmt.Errorf("unknown modulation '%s' (%s)", name, strings.Join(modNames(), ", "))
+}
+
+func (s *Shell) mod(args []string) error {
+	if len(args) > 0 {
+		m, err := parseMod(args[0])
+		if err != nil {
+			return err
+		}
+		if err := s.device.SetModulation(m); err != nil {
+			return err
+		}
+	}
+	m, err := s.device.GetModulation()
+	if err != nil {
+		return err
+	}
+	s.printf("%s\n", cc1111.ModulationName(m))
+	return nil
+}
+
+// floatSetting shows or sets one float radio parameter
+func (s *Shell) floatSetting(args []string, set func(float64) error, get func() (float64, error), format string) error {
+	if len(args) > 0 {
+		v, err := parseFloatArg(args[0])
+		if err != nil {
+			return err
+		}
+		if err := set(v); err != nil {
+			return err
+		}
+	}
+	v, err := get()
+	if err != nil {
+		return err
+	}
+	s.printf(format+"\n", v)
+	return nil
+}
+
+func (s *Shell) rate(args []string) error {
+	return s.floatSetting(args, s.device.SetDataRate, s.device.GetDataRate, "%.1f baud")
+}
+
+func (s *Shell) bw(args []string) error {
+	return s.floatSetting(args, s.device.SetChannelBW, s.device.GetChannelBW, "%.0f Hz")
+}
+
+func (s *Shell) dev(args []string) error {
+	return s.floatSetting(args, s.device.SetDeviation, s.device.GetDeviation, "%.0f Hz")
+}
+
+func (s *Shell) sync(args []string) error {
+	if len(args) > 0 {
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(args[0]), "0x"), 16, 16)
+		if err != nil {
+			return fmt.Errorf("invalid sync word '%s'", args[0])
+		}
+		if err := s.device.SetSyncWord(uint16(v)); err != nil {
+			return err
+		}
+	}
+	v, err := s.device.GetSyncWord()
+	if err != nil {
+		return err
+	}
+	s.printf("0x%04X\n", v)
+	return nil
+}
+
+func (s *Shell) power(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: power <dBm>")
+	}
+	dBm, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid power '%s'", args[0])
+	}
+	actual, err := s.device.SetTXPowerDBm(dBm)
+	if err != nil {
+		return err
+	}
+	s.printf("%.1f dBm\n", actual)
+	return nil
+}
+
+func (s *Shell) profile(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: profile <name|file>")
+	}
+	if err := s.applyProfile(args[0]); err != nil {
+		return err
+	}
+	if s.session != nil {
+		s.session.Profile = args[0]
+	}
+	return nil
+}
+
+// applyProfile applies a built-in profile, profile file or configuration
+func (s *Shell) applyProfile(name string) error {
+	if p := profiles.Find(name); p != nil {
+		if err := config.ApplyProfile(s.device, p); err != nil {
+			return err
+		}
+		s.printf("Applied %s: %s\n", p.Name, p.Description)
+		return nil
+	}
+	if pc, err := profiles.LoadProfileFromFile(name); err == nil {
+		return config.ApplyToDevice(s.device, &config.DeviceConfig{Serial: s.device.Serial, Registers: pc.Registers})
+	}
+	c, err := config.LoadFromFile(name)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a built-in profile, profile file or configuration: %w", name, err)
+	}
+	return config.ApplyToDevice(s.device, c)
+}
+
+// parseAddress accepts a register name or a hex address
+func parseAddress(arg string) (uint16, error) {
+	if addr, ok := registers.Lookup(arg); ok {
+		return addr, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(arg), "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown register or address '%s'", arg)
+	}
+	return uint16(v), nil
+}
+
+func (s *Shell) peek(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: peek <register|address> [count]")
+	}
+	addr, err := parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	count := 1
+	if len(args) == 2 {
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 || count > 256 {
+			return fmt.Errorf("count must be 1-256")
+		}
+	}
+	data, err := s.device.Peek(addr, uint16(count))
+	if err != nil {
+		return err
+	}
+	if count == 1 {
+		name := registers.NameOf(addr)
+		if name == "" {
+			name = fmt.Sprintf("0x%04X", addr)
+		}
+		s.printf("%s = 0x%02X\n", name, data[0])
+		return nil
+	}
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		s.printf("%04X: % X\n", int(addr)+i, data[i:end])
+	}
+	return nil
+}
+
+func (s *Shell) poke(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: poke <register|address> <byte>...")
+	}
+	addr, err := parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	var data []byte
+	for _, a := range args[1:] {
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(a), "0x"), 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid byte '%s'", a)
+		}
+		data = append(data, byte(v))
+	}
+	return s.device.Poke(addr, data)
+}
+
+func (s *Shell) regs(args []string) error {
+	data, err := s.device.Peek(registers.RegSYNC1, registers.RegVCO_VC_DAC-registers.RegSYNC1+1)
+	if err != nil {
+		return err
+	}
+	col := 0
+	for _, name := range registers.SortedNames() {
+		off := int(registers.Names[name] - registers.RegSYNC1)
+		if off >= len(data) {
+			continue
+		}
+		s.printf("%-10s 0x%02X   ", name, data[off])
+		if col++; col%4 == 0 {
+			s.printf("\n")
+		}
+	}
+	if col%4 != 0 {
+		s.printf("\n")
+	}
+	return nil
+}
+
+func (s *Shell) tx(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: tx <hex> [repeat]")
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(args[0]), "0x"))
+	if err != nil || len(data) == 0 {
+		return fmt.Errorf("invalid hex payload '%s'", args[0])
+	}
+	repeat := 0
+	if len(args) == 2 {
+		if repeat, err = strconv.Atoi(args[1]); err != nil || repeat < 0 || repeat > 65535 {
+			return fmt.Errorf("repeat must be 0-65535")
+		}
+	}
+	if len(data) > yardstick.RFMaxTXBlock {
+		err = s.device.RFXmitLong(data)
+	} else {
+		err = s.device.RFXmit(data, uint16(repeat), 0)
+	}
+	if err != nil {
+		return err
+	}
+	s.printf("Sent %d bytes\n", len(data))
+	return nil
+}
+
+func (s *Shell) rx(args []string) error {
+	timeout := 5 * time.Second
+	if len(args) > 0 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid timeout '%s' (e.g. 10s)", args[0])
+		}
+		timeout = d
+	}
+	if err := s.device.SetModeRX(); err != nil {
+		return err
+	}
+	defer s.device.SetModeIDLE()
+	data, err := s.device.RFRecv(timeout, 0)
+	if err != nil {
+		return err
+	}
+	s.printPacket(data)
+	return nil
+}
+
+// printPacket prints a received packet with the signal strength
+func (s *Shell) printPacket(data []byte) {
+	rssi := ""
+	if status, err := s.device.GetRadioStatus(); err == nil {
+		rssi = fmt.Sprintf("  RSSI %d dBm LQI %d", status.RSSIdBm, status.LQI)
+	}
+	s.printf("RX %s [%d] %s%s\n", time.Now().Format("15:04:05.000"), len(data), hex.EncodeToString(data), rssi)
+}
+
+func (s *Shell) rssi(args []string) error {
+	status, err := s.device.GetRadioStatus()
+	if err != nil {
+		return err
+	}
+	s.printf("%d dBm\n", status.RSSIdBm)
+	return nil
+}
+
+func (s *Shell) state(args []string) error {
+	state, err := s.device.GetMARCSTATE()
+	if err != nil {
+		return err
+	}
+	s.printf("%s (0x%02X)\n", registers.RadioState(state), state)
+	return nil
+}
+
+func (s *Shell) idle(args []string) error {
+	return s.device.SetModeIDLE()
+}
+
+func (s *Shell) watchCmd(args []string) error {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	switch {
+	case len(args) == 0:
+	case args[0] == "on":
+		s.watch = true
+	case args[0] == "off":
+		s.watch = false
+		s.device.SetModeIDLE()
+	default:
+		return fmt.Errorf("usage: watch [on|off]")
+	}
+	if s.watch {
+		s.printf("Watching for packets\n")
+	} else {
+		s.printf("Not watching\n")
+	}
+	return nil
+}
+
+// pause stops the live receiver, if running, and waits for it
+func (s *Shell) pause() {
+	s.watchMu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.watchMu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// resume restarts the live receiver after a command if watch is on
+func (s *Shell) resume() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if !s.watch || s.stop != nil {
+		return
+	}
+	if err := s.device.SetModeRX(); err != nil {
+		s.printf("watch: %v\n", err)
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.stop, s.done = stop, done
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data, err := s.device.RFRecv(100*time.Millisecond, 0)
+			if err == nil {
+				s.printPacket(data)
+			}
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package repl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/sessionstate"
+)
+
+// Resume attaches a saved session: its profile and frequency are applied
+// to the device, and every command from then on updates and saves it
+func (s *Shell) Resume(st *sessionstate.State) error {
+	s.session = st
+	st.Device = s.device.Serial
+	if st.Profile != "" {
+		if err := s.applyProfile(st.Profile); err != nil {
+			return fmt.Errorf("failed to restore profile: %w", err)
+		}
+	}
+	if st.FrequencyHz != 0 {
+		if err := s.device.Retune(st.FrequencyHz); err != nil {
+			return fmt.Errorf("failed to restore frequency: %w", err)
+		}
+	}
+	if err := st.Save(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// record adds a command to the session and saves it with the current
+// frequency; a failed save is reported but does not stop the console
+func (s *Shell) record(line string) {
+	if s.session == nil {
+		return
+	}
+	s.session.AddCommand(line)
+	if hz, err := s.device.GetFrequency(); err == nil {
+		s.session.FrequencyHz = hz
+	}
+	if err := s.session.Save(); err != nil {
+		s.printf("Warning: failed to save session: %v\n", err)
+	}
+}
+
+// needSession returns the session, or an error when there is none
+func (s *Shell) needSession() (*sessionstate.State, error) {
+	if s.session == nil {
+		return nil, fmt.Errorf("no session (the console was started without one)")
+	}
+	return s.session, nil
+}
+
+func (s *Shell) mark(args []string) error {
+	st, err := s.needSession()
+	if err != nil {
+		return err
+	}
+	var hz uint32
+	if len(args) > 0 {
+		if hz, err = parseFreqArg(args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	} else if hz, err = s.device.GetFrequency(); err != nil {
+		return err
+	}
+	st.Watch(hz, strings.Join(args, " "))
+	s.printf("Marked %.6f MHz\n", float64(hz)/1e6)
+	return nil
+}
+
+func (s *Shell) unmark(args []string) error {
+	st, err := s.needSession()
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: unmark <MHz|Hz>")
+	}
+	hz, err := parseFreqArg(args[0])
+	if err != nil {
+		return err
+	}
+	if !st.Unwatch(hz) {
+		return fmt.Errorf("%.6f MHz is not marked", float64(hz)/1e6)
+	}
+	return nil
+}
+
+func (s *Shell) marks(args []string) error {
+	st, err := s.needSession()
+	if err != nil {
+		return err
+	}
+	if len(st.Watchlist) == 0 {
+		s.printf("No marked frequencies\n")
+	}
+	for _, w := range st.Watchlist {
+		s.printf("  %11.6f MHz  %s\n", float64(w.FrequencyHz)/1e6, w.Label)
+	}
+	return nil
+}
+
+func (s *Shell) history(args []string) error {
+	st, err := s.needSession()
+	if err != nil {
+		return err
+	}
+	cmds := st.RecentCommands
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid count '%s'", args[0])
+		}
+		cmds = cmds[max(0, len(cmds)-n):]
+	}
+	first := len(st.RecentCommands) - len(cmds) + 1
+	for i, c := range cmds {
+		s.printf("%5d  %s\n", first+i, c)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+// Package rfcatnet serves a dongle over TCP the way rfcat's
+// d.rf_redirection does, so clients written for an rfcat network pipe
+// can use a dongle managed by gocat.
+//
+// Bytes a client sends are transmitted as they arrive, one packet per
+// read (at most RFMaxTXBlock bytes). Each received packet is sent to every
+// client behind a 6-byte header, struct.pack("<fH", time, len(data)) in
+// Python: the receive time as float32 Unix seconds and the length as a
+// little-endian uint16. Printable mode writes "\n<time>: <repr>" instead,
+// as rf_redirection(printable=True) does.
+package rfcatnet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// HeaderLen is the size of the header before each received packet
+const HeaderLen = 6
+
+// DefaultAddr is where gocat rfpipe listens by default
+const DefaultAddr = "localhost:1900"
+
+// Options controls a Server
+type Options struct {
+	Printable  bool          // Write packets as text lines instead of framed binary
+	NoTransmit bool          // Discard data from clients instead of transmitting it
+	Poll       time.Duration // Receive poll between transmits (default 100ms)
+	BlockSize  uint16        // Receive block size (0 = firmware default)
+}
+
+// Stats counts a server's traffic
+type Stats struct {
+	Clients     int `json:"clients"`     // Connections accepted
+	Received    int `json:"received"`    // Packets received from the radio
+	Transmitted int `json:"transmitted"` // Packets transmitted for clients
+	Dropped     int `json:"dropped"`     // Client writes discarded (NoTransmit or failed transmit)
+	Connected   int `json:"connected"`   // Clients connected now
+}
+
+// Server pipes the radio to TCP clients
+type Server struct {
+	device *yardstick.Device
+	opts   Options
+	tx     chan []byte
+
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+	stats   Stats
+}
+
+// New creates a server for a configured device; opts may be nil
+func New(device *yardstick.Device, opts *Options) *Server {
+	s := &Server{
+		device:  device,
+		tx:      make(chan []byte, 16),
+		clients: make(map[net.Conn]struct{}),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Poll <= 0 {
+		s.opts.Poll = 100 * time.Millisecond
+	}
+	return s
+}
+
+// Serve accepts clients on ln and pipes the radio until ctx is cancelled
+// or the radio fails. It closes ln and every client before returning
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	lease, err := s.device.Acquire(yardstick.ModeRX, "rfcatnet")
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer lease.Release()
+	// Transmitting and mode changes go through the lease while it is held
+	device := s.device
+	s.device = lease.Device()
+	defer func() { s.device = device }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go s.accept(ctx, ln)
+	defer s.closeClients()
+
+	if err := s.device.SetModeRX(); err != nil {
+		return fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case data := <-s.tx:
+			if err := s.transmit(data); err != nil {
+				return err
+			}
+			continue
+		default:
+		}
+
+		data, err := s.device.RFRecv(s.opts.Poll, s.opts.BlockSize)
+		if err != nil || len(data) == 0 {
+			if errors.Is(err, yardstick.ErrDisconnected) {
+				return err
+			}
+			// Timeout is normal
+			continue
+		}
+		s.broadcast(Encode(time.Now(), data, s.opts.Printable))
+	}
+}
+
+// Stats returns the traffic counters so far
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Connected = len(s.clients)
+	return st
+}
+
+// transmit sends one client packet and returns the radio to RX
+func (s *Server) transmit(data []byte) error {
+	if err := s.device.RFXmit(data, 0, 0); err != nil {
+		s.count(func(st *Stats) { st.Dropped++ })
+		if errors.Is(err, yardstick.ErrDisconnected) {
+			return err
+		}
+	} else {
+		s.count(func(st *Stats) { st.Transmitted++ })
+	}
+	if err := s.device.SetModeRX(); err != nil {
+		return fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) accept(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.clients[conn] = struct{}{}
+		s.stats.Clients++
+		s.mu.Unlock()
+		go s.read(ctx, conn)
+	}
+}
+
+// read queues what a client sends for transmission, one packet per read
+func (s *Server) read(ctx context.Context, conn net.Conn) {
+	defer s.drop(conn)
+	buf := make([]byte, yardstick.RFMaxTXBlock)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if s.opts.NoTransmit {
+				s.count(func(st *Stats) { st.Dropped++ })
+			} else {
+				select {
+				case s.tx <- append([]byte(nil), buf[:n]...):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// broadcast writes a frame to every client, dropping those that fail
+func (s *Server) broadcast(frame []byte) {
+	s.mu.Lock()
+	s.stats.Received++
+	conns := make([]net.Conn, 0, len(s.clients))
+	for c := range s.clients {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := c.Write(frame); err != nil {
+			s.drop(c)
+		}
+	}
+}
+
+func (s *Server) drop(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.clients, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+func (s *Server) closeClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.Close()
+		delete(s.clients, c)
+	}
+}
+
+func (s *Server) count(fn func(*Stats)) {
+	s.mu.Lock()
+	fn(&s.stats)
+	s.mu.Unlock()
+}
+
+// Encode frames a received packet as rf_redirection writes it
+func Encode(t time.Time, data []byte, printable bool) []byte {
+	secs := float64(t.Unix()) + float64(t.Nanosecond())/1e9
+	if printable {
+		return []byte("\n" + strconv.FormatFloat(secs, 'f', -1, 64) + ": " + PyRepr(data))
+	}
+	frame := make([]byte, HeaderLen+len(data))
+	binary.LittleEndian.PutUint32(frame, math.Float32bits(float32(secs)))
+	binary.LittleEndian.PutUint16(frame[4:], uint16(len(data)))
+	copy(frame[HeaderLen:], data)
+	return frame
+}
+
+// Packet is a received packet as read back from the pipe
+type Packet struct {
+	Time float32 // Unix seconds; float32 keeps only about 2 minutes' resolution
+	Data []byte
+}
+
+// ReadPacket reads one framed packet from a server connection
+func ReadPacket(r io.Reader) (*Packet, error) {
+	var hdr [HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	p := &Packet{
+		Time: math.Float32frombits(binary.LittleEndian.Uint32(hdr[:])),
+		Data: make([]byte, binary.LittleEndian.Uint16(hdr[4:])),
+	}
+	if _, err := io.ReadFull(r, p.Data); err != nil {
+		return nil, fmt.Errorf("short packet: %w", err)
+	}
+	return p, nil
+}
+
+// PyRepr formats data as Python 3's repr() of a bytes object
+func PyRepr(data []byte) string {
+	quote := byte('\'')
+	if strings.IndexByte(string(data), '\'') >= 0 && strings.IndexByte(string(data), '"') < 0 {
+		quote = '"'
+	}
+	var b strings.Builder
+	b.WriteString("b")
+	b.WriteByte(quote)
+	for _, c := range data {
+		switch {
+		case c == quote || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(quote)
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rpc/gocatpb"
+)
+
+// Client drives a dongle served by gocat-server
+type Client struct {
+	conn *grpc.ClientConn
+	ys   gocatpb.YardStickClient
+}
+
+// Dial connects to a server at addr (host:port). Without options the
+// connection is plaintext; pass grpc.WithTransportCredentials for TLS
+func Dial(addr string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return &Client{conn: conn, ys: gocatpb.NewYardStickClient(conn)}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// YardStick returns the generated client, for calls with options the
+// helpers don't cover
+func (c *Client) YardStick() gocatpb.YardStickClient {
+	return c.ys
+}
+
+// Info describes the remote dongle
+func (c *Client) Info(ctx context.Context) (*gocatpb.InfoResponse, error) {
+	return c.ys.Info(ctx, &gocatpb.InfoRequest{})
+}
+
+// ApplyProfile configures the remote dongle with a profile
+func (c *Client) ApplyProfile(ctx context.Context, p *profiles.Profile) (*gocatpb.ConfigureResponse, error) {
+	return c.ys.Configure(ctx, &gocatpb.ConfigureRequest{Config: &gocatpb.ConfigureRequest_Profile{Profile: ProfileToProto(p)}})
+}
+
+// ApplyProfileName configures the remote dongle with a built-in profile
+func (c *Client) ApplyProfileName(ctx context.Context, name string) (*gocatpb.ConfigureResponse, error) {
+	return c.ys.Configure(ctx, &gocatpb.ConfigureRequest{Config: &gocatpb.ConfigureRequest_ProfileName{ProfileName: name}})
+}
+
+// ApplyConfig configures the remote dongle with a full configuration
+func (c *Client) ApplyConfig(ctx context.Context, cfg *config.DeviceConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = c.ys.Configure(ctx, &gocatpb.ConfigureRequest{Config: &gocatpb.ConfigureRequest_ConfigJson{ConfigJson: data}})
+	return err
+}
+
+// Transmit sends data once and then repeat more times
+func (c *Client) Transmit(ctx context.Context, data []byte, repeat int) error {
+	if repeat < 0 {
+		repeat = 0
+	}
+	_, err := c.ys.Transmit(ctx, &gocatpb.TransmitRequest{Data: data, Repeat: uint32(repeat)})
+	return err
+}
+
+// Receive calls fn with each packet until the stream ends, fn returns an
+// error or ctx is cancelled
+func (c *Client) Receive(ctx context.Context, req *gocatpb.ReceiveRequest, fn func(*gocatpb.Packet) error) error {
+	stream, err := c.ys.Receive(ctx, req)
+	if err != nil {
+		return err
+	}
+	return drain(stream.Recv, fn)
+}
+
+// Scan calls fn with each detection until the stream ends, fn returns an
+// error or ctx is cancelled
+func (c *Client) Scan(ctx context.Context, req *gocatpb.ScanRequest, fn func(*gocatpb.Detection) error) error {
+	stream, err := c.ys.Scan(ctx, req)
+	if err != nil {
+		return err
+	}
+	return drain(stream.Recv, fn)
+}
+
+// Specan calls fn with each sweep until the stream ends, fn returns an
+// error or ctx is cancelled
+func (c *Client) Specan(ctx context.Context, req *gocatpb.SpecanRequest, fn func(*gocatpb.Sweep) error) error {
+	stream, err := c.ys.Specan(ctx, req)
+	if err != nil {
+		return err
+	}
+	return drain(stream.Recv, fn)
+}
+
+// drain reads a server stream to its end
+func drain[T any](recv func() (T, error), fn func(T) error) error {
+	for {
+		msg, err := recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/rpc/gocatpb"
+)
+
+// ProfileToProto converts a profile to its wire form; nil stays nil
+func ProfileToProto(p *profiles.Profile) *gocatpb.Profile {
+	if p == nil {
+		return nil
+	}
+	return &gocatpb.Profile{
+		Name:               p.Name,
+		Description:        p.Description,
+		FrequencyHz:        p.FrequencyHz,
+		Modulation:         uint32(p.Modulation),
+		DataRateBaud:       p.DataRateBaud,
+		DeviationHz:        p.DeviationHz,
+		ChannelBandwidthHz: p.ChannelBWHz,
+		Manchester:         p.ManchesterEn,
+		Whitening:          p.DataWhiteningEn,
+		SyncWord:           uint32(p.SyncWord),
+		SyncMode:           uint32(p.SyncMode),
+		PacketLengthMode:   uint32(p.PktLenMode),
+		PacketLength:       uint32(p.PktLen),
+		PreambleBytes:      uint32(p.PreambleBytes),
+		Crc:                p.CRCEn,
+		Fec:                p.FECEn,
+		TxPowerDbm:         txPowerToProto(p.TXPowerDBm),
+	}
+}
+
+// ProfileFromProto converts a profile from its wire form; nil stays nil
+func ProfileFromProto(p *gocatpb.Profile) *profiles.Profile {
+	if p == nil {
+		return nil
+	}
+	return &profiles.Profile{
+		Name:            p.Name,
+		Description:     p.Description,
+		FrequencyHz:     p.FrequencyHz,
+		Modulation:      uint8(p.Modulation),
+		DataRateBaud:    p.DataRateBaud,
+		DeviationHz:     p.DeviationHz,
+		ChannelBWHz:     p.ChannelBandwidthHz,
+		ManchesterEn:    p.Manchester,
+		DataWhiteningEn: p.Whitening,
+		SyncWord:        uint16(p.SyncWord),
+		SyncMode:        uint8(p.SyncMode),
+		PktLenMode:      uint8(p.PacketLengthMode),
+		PktLen:          uint8(p.PacketLength),
+		PreambleBytes:   uint8(p.PreambleBytes),
+		CRCEn:           p.Crc,
+		FECEn:           p.Fec,
+		TXPowerDBm:      txPowerFromProto(p.TxPowerDbm),
+	}
+}
+
+// txPowerToProto and txPowerFromProto carry an unset power, the band
+// maximum, across as an unset field
+func txPowerToProto(dBm *int) *int32 {
+	if dBm == nil {
+		return nil
+	}
+	v := int32(*dBm)
+	return &v
+}
+
+func txPowerFromProto(dBm *int32) *int {
+	if dBm == nil {
+		return nil
+	}
+	v := int(*dBm)
+	return &v
+}
@@ -0,0 +1,342 @@
+// Package rpc serves a YardStick One over gRPC and provides the matching
+// Go client, so a dongle attached to one machine (say a Raspberry Pi)
+// can be configured, transmit, receive and sweep the spectrum from
+// another. The service is defined in gocatpb/gocat.proto; clients in
+// other languages generate their stubs from it, or use server reflection.
+//
+// The server drives one device and serves one call at a time. A call made
+// while another holds the device, such as a running Receive stream, fails
+// with codes.Unavailable rather than waiting.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/rpc/gocatpb"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// DefaultPort is the port gocat-server listens on
+const DefaultPort = 50051
+
+// Options controls what a Server allows
+type Options struct {
+	NoTransmit bool // Refuse Transmit with codes.PermissionDenied
+}
+
+// Server implements the YardStick service for one device
+type Server struct {
+	gocatpb.UnimplementedYardStickServer
+
+	device *yardstick.Device
+	opts   Options
+
+	busy    sync.Mutex // Held for the whole of each call
+	mu      sync.Mutex
+	holder  string // Call holding busy
+	profile *profiles.Profile
+}
+
+// NewServer creates a server for a device; opts may be nil
+func NewServer(device *yardstick.Device, opts *Options) *Server {
+	s := &Server{device: device}
+	if opts != nil {
+		s.opts = *opts
+	}
+	return s
+}
+
+// Register adds the service to a gRPC server
+func (s *Server) Register(g *grpc.Server) {
+	gocatpb.RegisterYardStickServer(g, s)
+}
+
+// acquire takes the device for a call, or fails if another call has it
+func (s *Server) acquire(call string) (release func(), err error) {
+	if !s.busy.TryLock() {
+		s.mu.Lock()
+		holder := s.holder
+		s.mu.Unlock()
+		return nil, status.Errorf(codes.Unavailable, "device busy with %s", holder)
+	}
+	s.mu.Lock()
+	s.holder = call
+	s.mu.Unlock()
+	return s.busy.Unlock, nil
+}
+
+// Info describes the device and the last profile applied
+func (s *Server) Info(ctx context.Context, req *gocatpb.InfoRequest) (*gocatpb.InfoResponse, error) {
+	release, err := s.acquire("Info")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info := s.device.Info(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &gocatpb.InfoResponse{
+		Serial:          info.Serial,
+		Manufacturer:    info.Manufacturer,
+		Product:         info.Product,
+		Firmware:        info.Firmware,
+		PartNumber:      uint32(info.PartNum),
+		TransmitAllowed: !s.opts.NoTransmit,
+		Profile:         ProfileToProto(s.profile),
+	}, nil
+}
+
+// Configure applies a built-in profile, a profile or a configuration file
+func (s *Server) Configure(ctx context.Context, req *gocatpb.ConfigureRequest) (*gocatpb.ConfigureResponse, error) {
+	release, err := s.acquire("Configure")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var p *profiles.Profile
+	switch c := req.Config.(type) {
+	case *gocatpb.ConfigureRequest_ProfileName:
+		if p = profiles.Find(c.ProfileName); p == nil {
+			return nil, status.Errorf(codes.NotFound, "unknown profile '%s'", c.ProfileName)
+		}
+	case *gocatpb.ConfigureRequest_Profile:
+		p = ProfileFromProto(c.Profile)
+	case *gocatpb.ConfigureRequest_ConfigJson:
+		var cfg config.DeviceConfig
+		if err := json.Unmarshal(c.ConfigJson, &cfg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid configuration: %v", err)
+		}
+		if err := config.ApplyToDevice(s.device, &cfg); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to apply configuration: %v", err)
+		}
+		s.setProfile(nil)
+		return &gocatpb.ConfigureResponse{FrequencyHz: uint32(cfg.GetFrequencyMHz() * 1e6)}, nil
+	default:
+		return nil, status.Error(codes.InvalidArgument, "a profile name, profile or configuration is required")
+	}
+
+	if req.FrequencyHz > 0 {
+		p.FrequencyHz = req.FrequencyHz
+	}
+	if req.TxPowerDbm != nil {
+		p.TXPowerDBm = txPowerFromProto(req.TxPowerDbm)
+	}
+	if err := config.ApplyProfile(s.device, p); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to apply profile: %v", err)
+	}
+	s.setProfile(p)
+	return &gocatpb.ConfigureResponse{Profile: ProfileToProto(p), FrequencyHz: uint32(p.FrequencyHz)}, nil
+}
+
+func (s *Server) setProfile(p *profiles.Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = p
+}
+
+// Transmit sends one packet; the radio is left IDLE
+func (s *Server) Transmit(ctx context.Context, req *gocatpb.TransmitRequest) (*gocatpb.TransmitResponse, error) {
+	if s.opts.NoTransmit {
+		return nil, status.Error(codes.PermissionDenied, "transmit is disabled on this server")
+	}
+	if len(req.Data) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no data to transmit")
+	}
+	// The firmware repeats yardstick.RepeatForever until stopped, which a
+	// remote caller has no way to do
+	if req.Repeat >= yardstick.RepeatForever {
+		return nil, status.Errorf(codes.InvalidArgument, "repeat %d out of range (max %d)", req.Repeat, yardstick.RepeatForever-1)
+	}
+	release, err := s.acquire("Transmit")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.device.SetModeTX(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to enter TX: %v", err)
+	}
+	defer s.device.SetModeIDLE()
+	if err := s.device.RFXmitCtx(ctx, req.Data, uint16(req.Repeat), 0); err != nil {
+		return nil, status.Errorf(codes.Internal, "transmit failed: %v", err)
+	}
+	airtime := s.device.Airtime(len(req.Data)) * time.Duration(req.Repeat+1)
+	return &gocatpb.TransmitResponse{AirtimeUs: airtime.Microseconds()}, nil
+}
+
+// Receive streams packets until max_packets, the idle timeout or the
+// client cancels
+func (s *Server) Receive(req *gocatpb.ReceiveRequest, stream gocatpb.YardStick_ReceiveServer) error {
+	release, err := s.acquire("Receive")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rx := rxstream.New(s.device, &rxstream.Options{BlockSize: uint16(min(req.BlockSize, 0xFFFF))})
+	if err := rx.Start(); err != nil {
+		return status.Errorf(codes.Internal, "failed to start receiving: %v", err)
+	}
+	defer rx.Stop()
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if req.IdleTimeoutMs > 0 {
+		timer = time.NewTimer(time.Duration(req.IdleTimeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	sent := uint32(0)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-idle:
+			return nil
+		case pkt, ok := <-rx.Packets():
+			if !ok {
+				return status.Error(codes.Internal, "receive stream ended")
+			}
+			msg := &gocatpb.Packet{
+				Timestamp: timestamppb.New(pkt.Timestamp),
+				Data:      pkt.Raw,
+				RssiValid: pkt.RSSIValid,
+				RssiDbm:   int32(pkt.RSSI),
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+			sent++
+			if req.MaxPackets > 0 && sent >= req.MaxPackets {
+				return nil
+			}
+			if timer != nil {
+				timer.Reset(time.Duration(req.IdleTimeoutMs) * time.Millisecond)
+			}
+		}
+	}
+}
+
+// Specan streams spectrum analyzer sweeps
+func (s *Server) Specan(req *gocatpb.SpecanRequest, stream gocatpb.YardStick_SpecanServer) error {
+	release, err := s.acquire("Specan")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.sweep(stream.Context(), req.CenterHz, req.BandwidthHz, req.Channels, req.BaseProfile, req.Sweeps, func(f *specan.Frame) error {
+		return stream.Send(&gocatpb.Sweep{
+			Timestamp: timestamppb.New(f.Timestamp),
+			BaseHz:    f.BaseFreq,
+			SpacingHz: f.ChanSpacing,
+			RssiDbm:   f.RSSI,
+		})
+	})
+}
+
+// Scan sweeps a band and streams one detection per signal above the
+// threshold in each sweep: adjacent channels above it count as one
+// signal, reported at its strongest channel
+func (s *Server) Scan(req *gocatpb.ScanRequest, stream gocatpb.YardStick_ScanServer) error {
+	release, err := s.acquire("Scan")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.sweep(stream.Context(), req.CenterHz, req.BandwidthHz, req.Channels, req.BaseProfile, req.Sweeps, func(f *specan.Frame) error {
+		for _, p := range signals(f, req.ThresholdDbm) {
+			err := stream.Send(&gocatpb.Detection{
+				Timestamp:   timestamppb.New(f.Timestamp),
+				FrequencyHz: p.FrequencyHz,
+				RssiDbm:     p.RSSI,
+				BandwidthHz: specan.PeakBandwidth(f, p.ChannelIndex, 6),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sweep runs the spectrum analyzer and hands each frame to fn until
+// sweeps frames (0 for no limit) or ctx ends
+func (s *Server) sweep(ctx context.Context, centerHz, bandwidthHz float64, channels uint32, baseProfile string, sweeps uint32, fn func(*specan.Frame) error) error {
+	if channels < 1 || channels > 255 {
+		return status.Errorf(codes.InvalidArgument, "channels must be 1-255, got %d", channels)
+	}
+	if centerHz <= 0 || bandwidthHz <= 0 {
+		return status.Error(codes.InvalidArgument, "center and bandwidth are required")
+	}
+	var base *registers.RegisterMap
+	if baseProfile != "" {
+		p := profiles.Find(baseProfile)
+		if p == nil {
+			return status.Errorf(codes.NotFound, "unknown profile '%s'", baseProfile)
+		}
+		base = p.ToRegisters()
+	}
+
+	sa := specan.New(s.device)
+	cfg := &specan.Config{CenterFreq: uint32(centerHz), Bandwidth: uint32(bandwidthHz), NumChans: uint8(channels), Base: base}
+	if err := sa.Configure(cfg); err != nil {
+		return status.Errorf(codes.Internal, "failed to configure spectrum analyzer: %v", err)
+	}
+	if err := sa.Start(); err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	defer sa.Stop()
+	// The sweep changed the radio's settings
+	s.setProfile(nil)
+
+	for n := uint32(0); sweeps == 0 || n < sweeps; n++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case f, ok := <-sa.Frames():
+			if !ok {
+				return status.Error(codes.Internal, "spectrum analyzer stopped")
+			}
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// signals groups adjacent channels above the threshold and returns the
+// strongest channel of each group
+func signals(f *specan.Frame, thresholdDBm float32) []specan.Peak {
+	var out []specan.Peak
+	for i := 0; i < len(f.RSSI); i++ {
+		if f.RSSI[i] < thresholdDBm {
+			continue
+		}
+		best := i
+		for ; i+1 < len(f.RSSI) && f.RSSI[i+1] >= thresholdDBm; i++ {
+			if f.RSSI[i+1] > f.RSSI[best] {
+				best = i + 1
+			}
+		}
+		out = append(out, specan.Peak{ChannelIndex: best, FrequencyHz: specan.FrequencyForChannel(f, best), RSSI: f.RSSI[best]})
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+// Package rssimeter samples the received signal strength on the current
+// frequency at a fixed rate, for antenna aiming and checking that a
+// transmitter is on the air
+package rssimeter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Reading is one RSSI sample with running statistics since Start or Reset
+type Reading struct {
+	Timestamp time.Time `json:"time"`
+	DBm       int       `json:"rssi_dbm"`
+	Min       int       `json:"min_dbm"`
+	Max       int       `json:"max_dbm"`
+	Avg       float64   `json:"avg_dbm"`
+	Count     int       `json:"count"`
+}
+
+// Meter samples RSSI in the background while holding an RX lease
+type Meter struct {
+	device   *yardstick.Device
+	interval time.Duration
+
+	mu       sync.Mutex
+	running  bool
+	lease    *yardstick.Lease
+	stopChan chan struct{}
+	dataChan chan *Reading
+	min, max int
+	sum      float64
+	count    int
+}
+
+// New creates a meter sampling every interval
+func New(device *yardstick.Device, interval time.Duration) *Meter {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	return &Meter{
+		device:   device,
+		interval: interval,
+		dataChan: make(chan *Reading, 10),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start puts the radio in RX and begins sampling
+func (m *Meter) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return fmt.Errorf("already running")
+	}
+
+	lease, err := m.device.Acquire(yardstick.ModeRX, "rssimeter")
+	if err != nil {
+		return err
+	}
+	if err := lease.Device().SetModeRX(); err != nil {
+		lease.Release()
+		return fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+
+	m.running = true
+	m.lease = lease
+	m.stopChan = make(chan struct{})
+	m.dataChan = make(chan *Reading, 10)
+	m.reset()
+
+	go m.sampleLoop()
+
+	return nil
+}
+
+// Stop halts sampling and returns the radio to IDLE
+func (m *Meter) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	m.lease.Release()
+	m.lease = nil
+}
+
+// Readings returns a channel that receives samples; it is closed when the meter stops
+func (m *Meter) Readings() <-chan *Reading {
+	return m.dataChan
+}
+
+// Reset clears the min/max/average statistics
+func (m *Meter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reset()
+}
+
+func (m *Meter) reset() {
+	m.min, m.max, m.sum, m.count = 0, 0, 0, 0
+}
+
+// sampleLoop reads RSSI every interval until stopped
+func (m *Meter) sampleLoop() {
+	defer close(m.dataChan)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		raw, err := m.device.GetRSSI()
+		if err != nil {
+			continue
+		}
+		r := m.record(yardstick.RSSIToDBm(raw))
+
+		// Drop samples rather than stall if the reader falls behind
+		select {
+		case m.dataChan <- r:
+		default:
+		}
+	}
+}
+
+// record adds a sample to the statistics
+func (m *Meter) record(dBm int) *Reading {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.count == 0 || dBm < m.min {
+		m.min = dBm
+	}
+	if m.count == 0 || dBm > m.max {
+		m.max = dBm
+	}
+	m.sum += float64(dBm)
+	m.count++
+
+	return &Reading{
+		Timestamp: time.Now(),
+		DBm:       dBm,
+		Min:       m.min,
+		Max:       m.max,
+		Avg:       m.sum / float64(m.count),
+		Count:     m.count,
+	}
+}
+
+// Bar draws dBm as an ASCII bar width characters wide, scaled from floor
+// to ceil dBm, e.g. "[########        ]"
+func Bar(dBm, floor, ceil, width int) string {
+	if width < 1 || ceil <= floor {
+		return ""
+	}
+	n := (dBm - floor) * width / (ceil - floor)
+	if n < 0 {
+		n = 0
+	}
+	if n > width {
+		n = width
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat(" ", width-n) + "]"
+}
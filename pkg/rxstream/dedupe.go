@@ -0,0 +1,77 @@
+package rxstream
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Deduper suppresses repeated frames within a time window
+// Many OOK devices send each frame 3-10 times per button press; only the
+// first copy is passed on
+type Deduper struct {
+	Window time.Duration // Repeats closer than this to the last copy are dropped
+
+	// Key selects the bytes compared; Length 0 means the whole payload
+	// Pointing it at a sequence number or device ID field makes frames with
+	// the same key duplicates even if other bytes differ
+	KeyOffset int
+	KeyLength int
+
+	mu   sync.Mutex
+	seen map[uint64]time.Time
+}
+
+// NewDeduper creates a whole-payload deduper
+func NewDeduper(window time.Duration) *Deduper {
+	return &Deduper{Window: window}
+}
+
+// Duplicate reports whether data repeats a frame seen within the window
+// The window slides: each repeat extends it, so a long burst of repeats
+// counts as one event
+func (d *Deduper) Duplicate(data []byte, at time.Time) bool {
+	key := d.key(data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[uint64]time.Time)
+	}
+
+	// Expire old entries so the map doesn't grow without bound
+	for k, t := range d.seen {
+		if at.Sub(t) > d.Window {
+			delete(d.seen, k)
+		}
+	}
+
+	last, ok := d.seen[key]
+	d.seen[key] = at
+	return ok && at.Sub(last) <= d.Window
+}
+
+// Reset forgets all frames seen so far
+func (d *Deduper) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seen = nil
+}
+
+func (d *Deduper) key(data []byte) uint64 {
+	if d.KeyLength > 0 {
+		start := d.KeyOffset
+		if start > len(data) {
+			start = len(data)
+		}
+		end := start + d.KeyLength
+		if end > len(data) {
+			end = len(data)
+		}
+		data = data[start:end]
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
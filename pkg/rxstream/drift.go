@@ -0,0 +1,334 @@
+package rxstream
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// DriftAction is what a Drift tracker does when a signal is about to
+// leave the receive filter
+type DriftAction string
+
+// Drift actions
+const (
+	DriftOff    DriftAction = ""
+	DriftWiden  DriftAction = "widen"  // Step the channel filter wider; retune once it is at MaxBWHz
+	DriftRetune DriftAction = "retune" // Move the tuned frequency onto the signal
+)
+
+// ParseDriftAction parses "widen", "retune" or "off" (or empty)
+func ParseDriftAction(s string) (DriftAction, error) {
+	switch s {
+	case "", "off":
+		return DriftOff, nil
+	case string(DriftWiden), string(DriftRetune):
+		return DriftAction(s), nil
+	}
+	return DriftOff, fmt.Errorf("invalid drift action '%s': want widen, retune or off", s)
+}
+
+// DriftFromProfile returns the drift following a profile asks for, or nil
+// if it asks for none
+func DriftFromProfile(p *profiles.Profile) (*DriftOptions, error) {
+	action, err := ParseDriftAction(p.DriftAction)
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': %w", p.Name, err)
+	}
+	if action == DriftOff {
+		return nil, nil
+	}
+	return &DriftOptions{Action: action, MaxBWHz: p.DriftMaxBWHz}, nil
+}
+
+// Drift defaults
+const (
+	DefaultDriftEdge    = 0.5
+	DefaultDriftWindow  = 8
+	DefaultDriftHorizon = 10 * time.Second
+	DefaultDriftHistory = 1000
+)
+
+// DriftOptions configures drift following
+type DriftOptions struct {
+	Action DriftAction
+
+	// Edge is how far the signal may be predicted to move from the tuned
+	// frequency before Action is taken, as a fraction of half the filter
+	// bandwidth (default DefaultDriftEdge)
+	Edge float64
+
+	MaxBWHz float64       // Widest filter widening may select (0 = the widest there is)
+	Window  int           // FREQEST readings the trend is fitted over (default DefaultDriftWindow)
+	Horizon time.Duration // How far ahead the trend is projected (default DefaultDriftHorizon)
+	History int           // Most recent readings kept for the profile (default DefaultDriftHistory)
+}
+
+// DriftSample is one FREQEST reading
+type DriftSample struct {
+	Time        time.Time `json:"time"`
+	OffsetHz    float64   `json:"offset_hz"` // From the tuned frequency
+	SignalHz    float64   `json:"signal_hz"` // Tuned frequency plus offset
+	TunedHz     uint32    `json:"tuned_hz"`
+	BandwidthHz float64   `json:"bandwidth_hz"`
+}
+
+// DriftEvent is an adjustment made to follow the signal
+type DriftEvent struct {
+	Time        time.Time   `json:"time"`
+	Action      DriftAction `json:"action"`
+	PredictedHz float64     `json:"predicted_offset_hz"` // The projected offset that triggered it
+	FromTunedHz uint32      `json:"from_tuned_hz"`
+	ToTunedHz   uint32      `json:"to_tuned_hz"`
+	FromBWHz    float64     `json:"from_bandwidth_hz"`
+	ToBWHz      float64     `json:"to_bandwidth_hz"`
+}
+
+// DriftProfile is the recorded drift of the received signal
+type DriftProfile struct {
+	Samples      []DriftSample `json:"samples"` // The most recent readings, oldest first
+	Events       []DriftEvent  `json:"events"`
+	Readings     int           `json:"readings"` // All readings, including those no longer in Samples
+	MinHz        float64       `json:"min_signal_hz"`
+	MaxHz        float64       `json:"max_signal_hz"`
+	RateHzPerMin float64       `json:"rate_hz_per_min"` // Trend over all readings
+}
+
+// Drift reads the demodulator's frequency offset estimate after each
+// packet and, when the trend says the signal is about to reach the edge of
+// the receive filter, widens the filter or retunes onto the signal. The
+// drift profile keeps the most recent readings and every adjustment, with
+// the range and trend over all readings
+type Drift struct {
+	device *yardstick.Device
+	opts   DriftOptions
+
+	mu      sync.Mutex
+	tunedHz uint32
+	bwHz    float64
+	samples []DriftSample // Ring of the last History readings
+	next    int           // Oldest reading once the ring is full
+	events  []DriftEvent
+
+	// Over all readings
+	trend        driftTrend
+	minHz, maxHz float64
+}
+
+// NewDrift creates a tracker for a device; opts may be nil to only record
+func NewDrift(device *yardstick.Device, opts *DriftOptions) *Drift {
+	t := &Drift{device: device}
+	if opts != nil {
+		t.opts = *opts
+	}
+	if t.opts.Edge <= 0 {
+		t.opts.Edge = DefaultDriftEdge
+	}
+	if t.opts.Window < 3 {
+		t.opts.Window = DefaultDriftWindow
+	}
+	if t.opts.Horizon <= 0 {
+		t.opts.Horizon = DefaultDriftHorizon
+	}
+	if t.opts.History <= 0 {
+		t.opts.History = DefaultDriftHistory
+	}
+	t.opts.History = max(t.opts.History, t.opts.Window)
+	return t
+}
+
+// Observe reads FREQEST for a packet just received, fills in its
+// frequency offset and follows the signal if needed
+func (t *Drift) Observe(pkt *Packet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tunedHz == 0 {
+		freq, err := t.device.GetFrequency()
+		if err != nil {
+			return err
+		}
+		bw, err := t.device.GetChannelBW()
+		if err != nil {
+			return err
+		}
+		t.tunedHz, t.bwHz = freq, bw
+	}
+
+	offset, err := t.device.GetFreqEst()
+	if err != nil {
+		return err
+	}
+	pkt.FreqOffsetHz = offset
+	pkt.FreqOffsetValid = true
+	t.addLocked(DriftSample{
+		Time:        pkt.Timestamp,
+		OffsetHz:    offset,
+		SignalHz:    float64(t.tunedHz) + offset,
+		TunedHz:     t.tunedHz,
+		BandwidthHz: t.bwHz,
+	})
+
+	if t.opts.Action == DriftOff || len(t.samples) < t.opts.Window {
+		return nil
+	}
+	now, slope := fitTrend(t.recentLocked(t.opts.Window))
+	predicted := now + slope*t.opts.Horizon.Seconds() - float64(t.tunedHz)
+	if math.Abs(predicted) <= t.opts.Edge*t.bwHz/2 {
+		return nil
+	}
+	// A retune centres the filter on where the signal will be halfway to
+	// the horizon, so a steady drift stays inside it for a while
+	return t.follow(pkt.Timestamp, predicted, now+slope*t.opts.Horizon.Seconds()/2)
+}
+
+// addLocked records a reading, replacing the oldest once the ring is full
+func (t *Drift) addLocked(s DriftSample) {
+	if t.trend.n == 0 || s.SignalHz < t.minHz {
+		t.minHz = s.SignalHz
+	}
+	if t.trend.n == 0 || s.SignalHz > t.maxHz {
+		t.maxHz = s.SignalHz
+	}
+	t.trend.add(s)
+
+	if len(t.samples) < t.opts.History {
+		t.samples = append(t.samples, s)
+		return
+	}
+	t.samples[t.next] = s
+	t.next = (t.next + 1) % len(t.samples)
+}
+
+// recentLocked returns the last n readings, oldest first
+func (t *Drift) recentLocked(n int) []DriftSample {
+	out := make([]DriftSample, 0, n)
+	for i := len(t.samples) - n; i < len(t.samples); i++ {
+		out = append(out, t.samples[(t.next+i)%len(t.samples)])
+	}
+	return out
+}
+
+// follow widens the filter or retunes to signalHz
+func (t *Drift) follow(at time.Time, predicted, signalHz float64) error {
+	ev := DriftEvent{
+		Time:        at,
+		Action:      t.opts.Action,
+		PredictedHz: predicted,
+		FromTunedHz: t.tunedHz,
+		ToTunedHz:   t.tunedHz,
+		FromBWHz:    t.bwHz,
+		ToBWHz:      t.bwHz,
+	}
+
+	if t.opts.Action == DriftWiden {
+		wider := yardstick.WiderChannelBW(t.bwHz, t.device.CrystalHz())
+		if wider > 0 && (t.opts.MaxBWHz == 0 || wider <= t.opts.MaxBWHz) {
+			if err := t.widen(wider); err != nil {
+				return err
+			}
+			ev.ToBWHz = wider
+			t.events = append(t.events, ev)
+			return nil
+		}
+		// At the widest allowed filter: follow the signal instead
+		ev.Action = DriftRetune
+	}
+
+	to := uint32(signalHz + 0.5)
+	if err := t.device.Retune(to); err != nil {
+		return fmt.Errorf("failed to retune to %d Hz: %w", to, err)
+	}
+	t.tunedHz = to
+	ev.ToTunedHz = to
+	t.events = append(t.events, ev)
+	return nil
+}
+
+// widen switches the channel filter, which is only safe to change in IDLE
+func (t *Drift) widen(bwHz float64) error {
+	if err := t.device.StrobeModeIDLE(); err != nil {
+		return fmt.Errorf("failed to strobe IDLE: %w", err)
+	}
+	if err := t.device.WaitForState(yardstick.MarcStateIdle, 10*time.Millisecond); err != nil {
+		return err
+	}
+	if err := t.device.SetChannelBW(bwHz); err != nil {
+		return err
+	}
+	if err := t.device.StrobeModeRX(); err != nil {
+		return fmt.Errorf("failed to restore RX: %w", err)
+	}
+	t.bwHz = bwHz
+	return nil
+}
+
+// Profile returns the drift recorded so far
+func (t *Drift) Profile() *DriftProfile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &DriftProfile{
+		Samples:      t.recentLocked(len(t.samples)),
+		Events:       append([]DriftEvent(nil), t.events...),
+		Readings:     int(t.trend.n),
+		MinHz:        t.minHz,
+		MaxHz:        t.maxHz,
+		RateHzPerMin: t.trend.slope() * 60,
+	}
+}
+
+// Events returns how many adjustments have been made
+func (t *Drift) Events() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.events)
+}
+
+// driftTrend is a running least-squares fit of signal frequency against
+// time. Both are taken from the first reading so the sums keep their
+// precision over a long run
+type driftTrend struct {
+	t0                  time.Time
+	y0                  float64
+	n, sx, sy, sxx, sxy float64
+}
+
+func (tr *driftTrend) add(s DriftSample) {
+	if tr.n == 0 {
+		tr.t0, tr.y0 = s.Time, s.SignalHz
+	}
+	x := s.Time.Sub(tr.t0).Seconds()
+	y := s.SignalHz - tr.y0
+	tr.n++
+	tr.sx += x
+	tr.sy += y
+	tr.sxx += x * x
+	tr.sxy += x * y
+}
+
+// slope returns the fitted slope in Hz per second, 0 until the readings
+// span some time
+func (tr *driftTrend) slope() float64 {
+	den := tr.n*tr.sxx - tr.sx*tr.sx
+	if den == 0 {
+		return 0
+	}
+	return (tr.n*tr.sxy - tr.sx*tr.sy) / den
+}
+
+// fitTrend fits a least-squares line to the signal frequency of samples
+// and returns its value at the last sample and its slope in Hz per second
+func fitTrend(samples []DriftSample) (float64, float64) {
+	var tr driftTrend
+	for _, s := range samples {
+		tr.add(s)
+	}
+	slope := tr.slope()
+	last := samples[len(samples)-1].Time.Sub(tr.t0).Seconds()
+	return tr.y0 + (tr.sy-slope*tr.sx)/tr.n + slope*last, slope
+}
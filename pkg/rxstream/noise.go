@@ -0,0 +1,100 @@
+package rxstream
+
+import (
+	"sync"
+	"time"
+)
+
+// NoiseStats counts received frames that turned out to be noise, as a
+// per-profile "noise susceptibility" metric for comparing sync modes and
+// thresholds. The stream records totals, CRC failures and squelch drops;
+// the consumer records frames its decoders rejected with NoMatch. Each
+// frame counts as noise once, for the first thing that rejected it
+type NoiseStats struct {
+	Profile string
+
+	mu        sync.Mutex
+	start     time.Time
+	total     int
+	crcFail   int
+	noMatch   int
+	squelched int
+}
+
+// NoiseReport is a snapshot of NoiseStats
+type NoiseReport struct {
+	Profile   string        `json:"profile,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Total     int           `json:"total"`
+	Good      int           `json:"good"`
+	CRCFail   int           `json:"crc_fail"`
+	NoMatch   int           `json:"no_match"`
+	Squelched int           `json:"squelched"`
+
+	FalsePerMinute float64 `json:"false_per_minute"` // Noise frames per minute
+	FalseRatio     float64 `json:"false_ratio"`      // Noise frames / total
+}
+
+// NewNoiseStats starts counting for a profile
+func NewNoiseStats(profile string) *NoiseStats {
+	return &NoiseStats{Profile: profile, start: time.Now()}
+}
+
+// Received counts one frame from the radio, and its CRC failure if the
+// software CRC was checked and didn't match
+func (n *NoiseStats) Received(pkt *Packet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.total++
+	if pkt.CRCChecked && !pkt.CRCOk {
+		n.rejectLocked(pkt, &n.crcFail)
+	}
+}
+
+// NoMatch counts a frame no decoder accepted, unless it was already
+// rejected
+func (n *NoiseStats) NoMatch(pkt *Packet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rejectLocked(pkt, &n.noMatch)
+}
+
+// Squelched counts a frame dropped by the RSSI squelch, unless it was
+// already rejected
+func (n *NoiseStats) Squelched(pkt *Packet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rejectLocked(pkt, &n.squelched)
+}
+
+func (n *NoiseStats) rejectLocked(pkt *Packet, count *int) {
+	if pkt.rejected {
+		return
+	}
+	pkt.rejected = true
+	*count++
+}
+
+// Report returns the counts and derived rates so far
+func (n *NoiseStats) Report() NoiseReport {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	r := NoiseReport{
+		Profile:   n.Profile,
+		Duration:  time.Since(n.start),
+		Total:     n.total,
+		CRCFail:   n.crcFail,
+		NoMatch:   n.noMatch,
+		Squelched: n.squelched,
+	}
+	bad := n.crcFail + n.noMatch + n.squelched
+	r.Good = n.total - bad
+	if r.Total > 0 {
+		r.FalseRatio = float64(bad) / float64(r.Total)
+	}
+	if mins := r.Duration.Minutes(); mins > 0 {
+		r.FalsePerMinute = float64(bad) / mins
+	}
+	return r
+}
@@ -0,0 +1,41 @@
+package rxstream
+
+import "testing"
+
+func TestNoiseStatsCountsEachFrameOnce(t *testing.T) {
+	n := NewNoiseStats("test")
+
+	// CRC failure that the squelch also drops
+	crcSquelched := &Packet{CRCChecked: true}
+	n.Received(crcSquelched)
+	n.Squelched(crcSquelched)
+
+	// CRC failure that no decoder matched either
+	crcNoMatch := &Packet{CRCChecked: true}
+	n.Received(crcNoMatch)
+	n.NoMatch(crcNoMatch)
+
+	// Squelched, then reported again as unmatched
+	squelched := &Packet{CRCChecked: true, CRCOk: true}
+	n.Received(squelched)
+	n.Squelched(squelched)
+	n.NoMatch(squelched)
+
+	// Unmatched, reported twice
+	noMatch := &Packet{}
+	n.Received(noMatch)
+	n.NoMatch(noMatch)
+	n.NoMatch(noMatch)
+
+	good := &Packet{CRCChecked: true, CRCOk: true}
+	n.Received(good)
+
+	r := n.Report()
+	if r.Total != 5 || r.CRCFail != 2 || r.Squelched != 1 || r.NoMatch != 1 || r.Good != 1 {
+		t.Errorf("Report() = total %d, crc %d, squelched %d, no match %d, good %d; want 5, 2, 1, 1, 1",
+			r.Total, r.CRCFail, r.Squelched, r.NoMatch, r.Good)
+	}
+	if r.FalseRatio != 0.8 {
+		t.Errorf("FalseRatio = %v, want 0.8", r.FalseRatio)
+	}
+}
@@ -0,0 +1,49 @@
+package rxstream
+
+import (
+	"github.com/herlein/gocat/pkg/coding"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Process applies the software stages enabled in opts to a raw packet
+func Process(raw []byte, opts *Options) *Packet {
+	pkt := &Packet{
+		Raw:       raw,
+		Processed: raw,
+	}
+	if opts == nil {
+		return pkt
+	}
+
+	data := raw
+	if opts.Manchester {
+		data, pkt.ManchesterErrors = coding.ManchesterDecode(data)
+	}
+	if opts.Dewhiten {
+		data = coding.Dewhiten(data)
+	}
+	if opts.SoftCRC {
+		pkt.CRCChecked = true
+		data, pkt.CRCOk = coding.CheckCRC16(data)
+	}
+
+	pkt.Processed = data
+	return pkt
+}
+
+// Enabled returns true if any software stage is enabled
+func (o *Options) Enabled() bool {
+	return o != nil && (o.Manchester || o.Dewhiten || o.SoftCRC)
+}
+
+// ReadStatus sets RSSI from the status bytes the packet engine appends to
+// Raw under packet format f, and reports whether there were any. Nothing
+// is appended in infinite length mode or without APPEND_STATUS
+func (p *Packet) ReadStatus(f *yardstick.PacketFormat) bool {
+	if f == nil || !f.AppendStatus || f.LengthMode&0x03 == yardstick.LengthInfinite || len(p.Raw) < 2 {
+		return false
+	}
+	p.RSSI = yardstick.RSSIToDBm(p.Raw[len(p.Raw)-2])
+	p.RSSIValid = true
+	return true
+}
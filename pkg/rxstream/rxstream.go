@@ -0,0 +1,304 @@
+// Package rxstream provides a continuous receive stream for YardStick One
+// with optional software post-processing of each packet
+package rxstream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Options controls how received packets are processed
+//
+// The software stages stand in for packet engine features that are disabled
+// on the RX profile, typically because the profile is tuned to sniff another
+// system's traffic. They run in transmit-inverse order: Manchester decode,
+// then de-whitening, then CRC check.
+type Options struct {
+	Manchester bool // Manchester decode the raw bytes
+	Dewhiten   bool // Remove PN9 data whitening
+	SoftCRC    bool // Verify and strip a trailing CRC16
+
+	// Dedupe drops repeats of a frame within this window (0 = off),
+	// compared on the processed bytes
+	Dedupe time.Duration
+
+	// Squelch drops packets whose RSSI is below SquelchMin or above
+	// SquelchMax dBm; both 0 disables the squelch. The RSSI is the packet's
+	// own status byte, or a reading right after receive for profiles that
+	// don't append status
+	// Useful for no-sync OOK profiles where noise triggers the demodulator
+	SquelchMin int
+	SquelchMax int
+
+	// BurstGap groups packets closer together than this into one burst
+	// (default DefaultBurstGap)
+	BurstGap time.Duration
+
+	// Drift reads the frequency offset of every packet and, with an
+	// Action, follows a signal that drifts towards the filter edge
+	// (nil = off)
+	Drift *DriftOptions
+
+	Timeout   time.Duration // Per-receive timeout (default 200ms)
+	BlockSize uint16        // Receive block size (0 = firmware default)
+}
+
+// Packet is a single received packet with raw and processed views
+type Packet struct {
+	Timestamp time.Time
+	Raw       []byte // Bytes exactly as returned by the radio
+	Processed []byte // Bytes after the enabled software stages
+
+	CRCChecked       bool // SoftCRC was applied
+	CRCOk            bool // Software CRC matched (only valid if CRCChecked)
+	ManchesterErrors int  // Invalid symbol pairs seen during Manchester decode
+
+	RSSI      int  // Signal strength in dBm when RSSIValid
+	RSSIValid bool // RSSI was measured for this packet
+
+	FreqOffsetHz    float64 // Offset from the tuned frequency when FreqOffsetValid
+	FreqOffsetValid bool    // FREQEST was read for this packet
+
+	// Receive timing, filled in by a Timing tracker
+	Delta      time.Duration // Time since the previous packet (0 for the first)
+	Burst      int           // Burst number, starting at 1 (0 = not tracked)
+	BurstIndex int           // Position within the burst, starting at 0
+
+	rejected bool // Already counted as noise by a NoiseStats
+}
+
+// Stream receives packets from a device in the background
+type Stream struct {
+	device *yardstick.Device
+	opts   Options
+
+	mu         sync.Mutex
+	running    bool
+	lease      *yardstick.Lease
+	stopChan   chan struct{}
+	dataChan   chan *Packet
+	dedupe     *Deduper
+	duplicates int
+	squelched  int
+	timing     *Timing
+	noise      *NoiseStats
+	drift      *Drift
+}
+
+// New creates a receive stream; opts may be nil for no processing
+func New(device *yardstick.Device, opts *Options) *Stream {
+	s := &Stream{
+		device:   device,
+		dataChan: make(chan *Packet, 10),
+		stopChan: make(chan struct{}),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Timeout == 0 {
+		s.opts.Timeout = 200 * time.Millisecond
+	}
+	if s.opts.Dedupe > 0 {
+		s.dedupe = NewDeduper(s.opts.Dedupe)
+	}
+	s.timing = NewTiming(s.opts.BurstGap)
+	s.noise = NewNoiseStats("")
+	if s.opts.Drift != nil {
+		s.drift = NewDrift(device, s.opts.Drift)
+	}
+	return s
+}
+
+// Start puts the radio in RX and begins receiving
+func (s *Stream) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return fmt.Errorf("already running")
+	}
+
+	lease, err := s.device.Acquire(yardstick.ModeRX, "rxstream")
+	if err != nil {
+		return err
+	}
+	if err := lease.Device().SetModeRX(); err != nil {
+		lease.Release()
+		return fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+	if s.drift != nil {
+		// Following drift retunes, which only the lease holder may do
+		s.drift.device = lease.Device()
+	}
+
+	s.running = true
+	s.lease = lease
+	s.stopChan = make(chan struct{})
+	s.dataChan = make(chan *Packet, 10)
+
+	go s.receiveLoop()
+
+	return nil
+}
+
+// Stop halts the receive loop and returns the radio to IDLE
+func (s *Stream) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.lease.Release()
+	s.lease = nil
+}
+
+// IsRunning returns true if the stream is receiving
+func (s *Stream) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Duplicates returns how many repeated frames the dedupe filter dropped
+func (s *Stream) Duplicates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duplicates
+}
+
+// NoiseStats returns the noise counters the stream is recording into
+func (s *Stream) NoiseStats() *NoiseStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.noise
+}
+
+// SetNoiseStats switches noise counting to n, e.g. when the profile changes
+func (s *Stream) SetNoiseStats(n *NoiseStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noise = n
+}
+
+// Drift returns the drift tracker, or nil if Options.Drift was not set
+func (s *Stream) Drift() *Drift {
+	return s.drift
+}
+
+// Squelched returns how many packets the RSSI squelch dropped
+func (s *Stream) Squelched() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.squelched
+}
+
+// Squelch returns the RSSI squelch window in dBm
+func (s *Stream) Squelch() (minDBm, maxDBm int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.SquelchMin, s.opts.SquelchMax
+}
+
+// SetSquelch changes the RSSI squelch window, taking effect from the next
+// packet; both 0 disables the squelch
+func (s *Stream) SetSquelch(minDBm, maxDBm int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.SquelchMin, s.opts.SquelchMax = minDBm, maxDBm
+}
+
+// SquelchEnabled returns true if an RSSI window is configured
+func (o *Options) SquelchEnabled() bool {
+	return o != nil && (o.SquelchMin != 0 || o.SquelchMax != 0)
+}
+
+// PassSquelch reports whether a packet's RSSI is inside the squelch window
+// Packets without an RSSI reading are passed
+func (o *Options) PassSquelch(pkt *Packet) bool {
+	if !o.SquelchEnabled() || !pkt.RSSIValid {
+		return true
+	}
+	if o.SquelchMin != 0 && pkt.RSSI < o.SquelchMin {
+		return false
+	}
+	if o.SquelchMax != 0 && pkt.RSSI > o.SquelchMax {
+		return false
+	}
+	return true
+}
+
+// Packets returns a channel that receives packets; it is closed when the stream stops
+func (s *Stream) Packets() <-chan *Packet {
+	return s.dataChan
+}
+
+// receiveLoop continuously receives packets from the radio
+func (s *Stream) receiveLoop() {
+	defer close(s.dataChan)
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		data, err := s.device.RFRecv(s.opts.Timeout, s.opts.BlockSize)
+		if err != nil || len(data) == 0 {
+			// Timeout is normal
+			continue
+		}
+
+		pkt := Process(data, &s.opts)
+		pkt.Timestamp = time.Now()
+
+		noise := s.NoiseStats()
+		noise.Received(pkt)
+
+		pkt.ReadStatus(s.device.PacketFormat())
+		s.mu.Lock()
+		squelch := Options{SquelchMin: s.opts.SquelchMin, SquelchMax: s.opts.SquelchMax}
+		s.mu.Unlock()
+		if squelch.SquelchEnabled() {
+			if !pkt.RSSIValid {
+				if rssi, err := s.device.GetRSSI(); err == nil {
+					pkt.RSSI = yardstick.RSSIToDBm(rssi)
+					pkt.RSSIValid = true
+				}
+			}
+			if !squelch.PassSquelch(pkt) {
+				s.mu.Lock()
+				s.squelched++
+				s.mu.Unlock()
+				noise.Squelched(pkt)
+				continue
+			}
+		}
+
+		if s.drift != nil {
+			// An error only loses this packet's sample
+			s.drift.Observe(pkt)
+		}
+
+		if s.dedupe != nil && s.dedupe.Duplicate(pkt.Processed, pkt.Timestamp) {
+			s.mu.Lock()
+			s.duplicates++
+			s.mu.Unlock()
+			continue
+		}
+		s.timing.Mark(pkt)
+
+		// Non-blocking send
+		select {
+		case s.dataChan <- pkt:
+		default:
+			// Drop if channel full
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package rxstream
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBurstGap separates bursts when no gap is configured
+// Repeats of one button press are typically 10-50ms apart
+const DefaultBurstGap = 100 * time.Millisecond
+
+// Timing computes inter-packet deltas and groups packets into bursts:
+// packets closer together than Gap belong to the same burst
+type Timing struct {
+	Gap time.Duration
+
+	mu    sync.Mutex
+	last  time.Time
+	burst int
+	index int
+}
+
+// NewTiming creates a tracker; gap 0 uses DefaultBurstGap
+func NewTiming(gap time.Duration) *Timing {
+	if gap <= 0 {
+		gap = DefaultBurstGap
+	}
+	return &Timing{Gap: gap}
+}
+
+// Mark fills in the timing metadata of a packet from its Timestamp
+// Packets must be marked in receive order
+func (t *Timing) Mark(pkt *Packet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.last.IsZero() {
+		t.burst = 1
+		t.index = 0
+	} else {
+		pkt.Delta = pkt.Timestamp.Sub(t.last)
+		if pkt.Delta > t.Gap {
+			t.burst++
+			t.index = 0
+		} else {
+			t.index++
+		}
+	}
+	t.last = pkt.Timestamp
+	pkt.Burst = t.burst
+	pkt.BurstIndex = t.index
+}
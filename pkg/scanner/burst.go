@@ -0,0 +1,401 @@
+// Package scanner is the scanner logic on top of spectrum sweeps.
+//
+// A Calibrator sets each channel's detection threshold from its measured
+// noise floor and a ScanConfig drops detections on ignored frequencies or
+// outside the ranges of interest. A Classifier takes a closer look at a
+// detected signal for its modulation, bandwidth and burst length, and a
+// Capturer switches the radio to a receive profile for it, captures a
+// burst of its traffic to a file and hands the radio back to the sweep.
+// A HopperDetector groups short bursts across channels into frequency
+// hoppers. Scanner is the Flipper Zero's two-stage scan, a coarse pass
+// over a list of frequencies and tuned RSSI steps around the strongest,
+// and MultiScanner runs one per device over a share of the list. Config
+// reads the etc/scanner configurations they are set up from.
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/capture"
+	"github.com/herlein/gocat/pkg/capture/sigmf"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Burst capture defaults
+const (
+	DefaultBurstPackets    = 10
+	DefaultBurstTime       = 2 * time.Second
+	DefaultHoldoff         = 30 * time.Second
+	DefaultHoldoffSpanHz   = 100000
+	DefaultBurstFormat     = capture.FormatNative
+	defaultBurstModulation = profiles.ModASKOOK
+)
+
+// burstExt is the file extension each writable packet format is saved with
+var burstExt = map[string]string{
+	capture.FormatNative: ".jsonl",
+	capture.FormatHex:    ".hex",
+	capture.FormatPcap:   ".pcap",
+	capture.FormatSigMF:  sigmf.MetaExt,
+}
+
+// BandProfile is the receive profile used for detections in a band
+type BandProfile struct {
+	LowHz   uint32
+	HighHz  uint32
+	Profile string // Built-in profile name or profile configuration file
+}
+
+// ParseBandProfiles parses a comma-separated list of "low-high:profile"
+// with frequencies in MHz, e.g. "433-434.8:etc/433-tx.json,868-870:fsk-868"
+func ParseBandProfiles(s string) ([]BandProfile, error) {
+	var bands []BandProfile
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		span, profile, found := strings.Cut(item, ":")
+		lo, hi, found2 := strings.Cut(span, "-")
+		if !found || !found2 || profile == "" {
+			return nil, fmt.Errorf("invalid band profile '%s': want low-high:profile in MHz", item)
+		}
+		low, err1 := strconv.ParseFloat(lo, 64)
+		high, err2 := strconv.ParseFloat(hi, 64)
+		if err1 != nil || err2 != nil || low <= 0 || high < low {
+			return nil, fmt.Errorf("invalid band '%s' in '%s'", span, item)
+		}
+		bands = append(bands, BandProfile{LowHz: uint32(low * 1e6), HighHz: uint32(high * 1e6), Profile: profile})
+	}
+	return bands, nil
+}
+
+// Detection is a signal a sweep found
+type Detection struct {
+	Time        time.Time
+	FrequencyHz uint32
+	BandwidthHz uint32 // Estimated occupied bandwidth (0 = unknown)
+	RSSI        float32
+}
+
+// Burst is the outcome of one capture
+type Burst struct {
+	Detection
+	Profile  string        // Profile the radio received with
+	Path     string        // Capture file ("" when nothing was received)
+	Packets  int           // Packets saved
+	Duration time.Duration // Time spent receiving
+}
+
+// Capturer records a short burst of traffic at each detection. The
+// caller owns the sweep: it stops the analyzer, calls Capture and starts
+// the analyzer again, on the registers Capture put back
+type Capturer struct {
+	Packets  int           // Stop after this many packets (0 = only the time limit)
+	Duration time.Duration // Stop after this long (default DefaultBurstTime)
+	Dir      string        // Where capture files are created
+	Format   string        // Capture format (default DefaultBurstFormat)
+	Tool     string        // Recorded in each capture header
+
+	// Bands pick the receive profile for a detection; the first band
+	// containing its frequency wins. Elsewhere a listen-only profile is
+	// derived from the detection with Modulation and SymbolRateBaud
+	Bands          []BandProfile
+	Modulation     uint8
+	SymbolRateBaud float64
+
+	// Holdoff skips detections within HoldoffSpanHz of a frequency
+	// captured less than this long ago, so one busy channel doesn't
+	// keep the scan paused
+	Holdoff       time.Duration
+	HoldoffSpanHz uint32
+
+	captured holdoffs
+}
+
+// NewCapturer creates a capturer writing to dir with the defaults
+func NewCapturer(dir string) *Capturer {
+	return &Capturer{
+		Packets:       DefaultBurstPackets,
+		Duration:      DefaultBurstTime,
+		Dir:           dir,
+		Format:        DefaultBurstFormat,
+		Modulation:    defaultBurstModulation,
+		Holdoff:       DefaultHoldoff,
+		HoldoffSpanHz: DefaultHoldoffSpanHz,
+	}
+}
+
+// Validate checks the format and the directory, creating it if needed
+func (c *Capturer) Validate() error {
+	if _, ok := burstExt[c.format()]; !ok {
+		return fmt.Errorf("burst captures can't be written as '%s' (use native, hex, pcap or sigmf)", c.Format)
+	}
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0755); err != nil {
+			return fmt.Errorf("failed to create capture directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// Due reports whether d is far enough, in frequency or time, from the
+// previous captures to be captured itself
+func (c *Capturer) Due(d *Detection) bool {
+	return c.captured.due(d, c.Holdoff, c.HoldoffSpanHz)
+}
+
+// Capture switches the radio to the receive profile for d, tunes to its
+// frequency and saves packets until the packet or time limit or ctx ends
+// the burst, then puts the registers back as they were. The analyzer must
+// already be stopped
+func (c *Capturer) Capture(ctx context.Context, device *yardstick.Device, d *Detection) (b *Burst, err error) {
+	err = registers.WithTemporaryRegisters(device, nil, func() error {
+		profile, err := c.apply(device, d)
+		if err != nil {
+			return err
+		}
+		b, err = c.Record(ctx, device, d, profile)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Record captures d like Capture, but with the receive profile the radio
+// already has, named profile in the Burst and capture header. It only
+// retunes the radio
+func (c *Capturer) Record(ctx context.Context, device *yardstick.Device, d *Detection, profile string) (*Burst, error) {
+	c.captured.mark(d)
+
+	b := &Burst{Detection: *d, Profile: profile}
+	if err := device.Retune(d.FrequencyHz); err != nil {
+		return nil, fmt.Errorf("failed to tune to %.3f MHz: %w", float64(d.FrequencyHz)/1e6, err)
+	}
+	// Best effort: not every firmware build has the amplifier control
+	device.EnableAmplifier()
+
+	hdr, err := c.header(device, b)
+	if err != nil {
+		return nil, err
+	}
+	format := c.format()
+	path := filepath.Join(c.Dir, fmt.Sprintf("%s-%.3fMHz%s", d.Time.Format("20060102-150405"), float64(d.FrequencyHz)/1e6, burstExt[format]))
+	w, err := capture.Create(path, format, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Packets, b.Duration, err = c.receive(ctx, device, w, d.FrequencyHz)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.Packets == 0 {
+		removeCapture(path, format)
+		return b, nil
+	}
+	b.Path = path
+	return b, nil
+}
+
+// receive saves packets to w until the burst ends
+func (c *Capturer) receive(ctx context.Context, device *yardstick.Device, w capture.Writer, freqHz uint32) (int, time.Duration, error) {
+	limit := c.Duration
+	if limit <= 0 {
+		limit = DefaultBurstTime
+	}
+	stream := rxstream.New(device, nil)
+	if err := stream.Start(); err != nil {
+		return 0, 0, err
+	}
+	defer stream.Stop()
+
+	start := time.Now()
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	count := 0
+	for c.Packets <= 0 || count < c.Packets {
+		select {
+		case <-ctx.Done():
+			return count, time.Since(start), nil
+		case <-timer.C:
+			return count, time.Since(start), nil
+		case pkt, ok := <-stream.Packets():
+			if !ok {
+				return count, time.Since(start), nil
+			}
+			rec := &capture.Packet{Timestamp: pkt.Timestamp, Data: pkt.Raw, Frequency: freqHz}
+			if pkt.RSSIValid {
+				rec.RSSI = pkt.RSSI
+			}
+			if err := w.Write(rec); err != nil {
+				return count, time.Since(start), err
+			}
+			count++
+		}
+	}
+	return count, time.Since(start), nil
+}
+
+// Band returns the band whose profile receives frequency freqHz, or nil
+func (c *Capturer) Band(freqHz uint32) *BandProfile {
+	for i, band := range c.Bands {
+		if freqHz >= band.LowHz && freqHz <= band.HighHz {
+			return &c.Bands[i]
+		}
+	}
+	return nil
+}
+
+// Prepare sets a radio up to Record with: the named profile, or with ""
+// a listen-only one for signals of unknown bandwidth at freqHz. It returns
+// the profile's name
+func (c *Capturer) Prepare(device *yardstick.Device, profile string, freqHz uint32) (string, error) {
+	if err := device.StrobeModeIDLE(); err != nil {
+		return "", fmt.Errorf("failed to strobe IDLE: %w", err)
+	}
+	if profile != "" {
+		return ApplyProfile(device, profile)
+	}
+	return c.listenOnly(device, &Detection{FrequencyHz: freqHz})
+}
+
+// apply configures the receive profile for d and returns its name
+func (c *Capturer) apply(device *yardstick.Device, d *Detection) (string, error) {
+	if err := device.StrobeModeIDLE(); err != nil {
+		return "", fmt.Errorf("failed to strobe IDLE: %w", err)
+	}
+	if band := c.Band(d.FrequencyHz); band != nil {
+		return ApplyProfile(device, band.Profile)
+	}
+	return c.listenOnly(device, d)
+}
+
+// listenOnly applies a promiscuous profile derived from d
+func (c *Capturer) listenOnly(device *yardstick.Device, d *Detection) (string, error) {
+	p := profiles.NewPromiscuous(profiles.SignalEstimate{
+		FrequencyHz:    float64(d.FrequencyHz),
+		BandwidthHz:    float64(d.BandwidthHz),
+		SymbolRateBaud: c.SymbolRateBaud,
+		Modulation:     c.Modulation,
+	})
+	if err := config.ApplyProfile(device, p); err != nil {
+		return "", fmt.Errorf("failed to apply capture profile: %w", err)
+	}
+	return p.Name, nil
+}
+
+// ApplyProfile applies a built-in profile by name or a profile
+// configuration file and returns the profile's name
+func ApplyProfile(device *yardstick.Device, profile string) (string, error) {
+	if p := profiles.Find(profile); p != nil {
+		if err := config.ApplyProfile(device, p); err != nil {
+			return "", fmt.Errorf("failed to apply profile %s: %w", p.Name, err)
+		}
+		return p.Name, nil
+	}
+	pc, err := profiles.LoadProfileFromFile(profile)
+	if err != nil {
+		return "", fmt.Errorf("unknown profile '%s': %w", profile, err)
+	}
+	if err := config.ApplyToDevice(device, &config.DeviceConfig{Serial: device.Serial, Registers: pc.Registers}); err != nil {
+		return "", fmt.Errorf("failed to apply profile %s: %w", profile, err)
+	}
+	return pc.Profile.Name, nil
+}
+
+// header describes the radio setup of a burst, with a register snapshot
+// send-recv -replay can apply
+func (c *Capturer) header(device *yardstick.Device, b *Burst) (*capture.Header, error) {
+	regs, err := config.Current(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registers for the capture header: %w", err)
+	}
+	cfg := &config.DeviceConfig{Registers: *regs}
+
+	hdr := capture.NewHeader()
+	hdr.Profile = b.Profile
+	hdr.FrequencyHz = b.FrequencyHz
+	hdr.DataRate = cfg.GetDataRateBaud()
+	hdr.Modulation = cfg.GetModulationString()
+	hdr.Tool = c.Tool
+	build, _ := device.GetBuildType()
+	hdr.Device = &capture.DeviceInfo{Serial: device.Serial, Product: device.Product, Build: build}
+	if hdr.Registers, err = json.Marshal(regs); err != nil {
+		return nil, err
+	}
+	return hdr, nil
+}
+
+func (c *Capturer) format() string {
+	if c.Format == "" {
+		return DefaultBurstFormat
+	}
+	return c.Format
+}
+
+// removeCapture deletes an empty capture, both files of a SigMF pair
+func removeCapture(path, format string) {
+	os.Remove(path)
+	if format == capture.FormatSigMF {
+		os.Remove(strings.TrimSuffix(path, sigmf.MetaExt) + sigmf.DataExt)
+	}
+}
+
+// holdoffs remembers when each frequency was last handled. Safe for
+// concurrent use, as Due may run beside a capture on another radio
+type holdoffs struct {
+	mu sync.Mutex
+	at map[uint32]time.Time
+}
+
+// due reports whether d is more than span away from every frequency
+// handled within holdoff of it, forgetting the older ones
+func (h *holdoffs) due(d *Detection, holdoff time.Duration, span uint32) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for freq, at := range h.at {
+		if d.Time.Sub(at) >= holdoff {
+			delete(h.at, freq)
+			continue
+		}
+		if absDiff(freq, d.FrequencyHz) <= span {
+			return false
+		}
+	}
+	return true
+}
+
+// mark records d as handled
+func (h *holdoffs) mark(d *Detection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.at == nil {
+		h.at = make(map[uint32]time.Time)
+	}
+	h.at[d.FrequencyHz] = d.Time
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// Calibration defaults
+const (
+	DefaultCalibrationSweeps = 20
+	DefaultMarginDB          = 10
+)
+
+// Calibrator replaces a fixed detection threshold with one per channel,
+// at the channel's noise floor plus MarginDB. It measures the floor over
+// the first Sweeps sweeps, again whenever the frequency plan changes and,
+// with a Refresh interval, periodically; the old thresholds stay in use
+// while a refresh is measured. Until the first measurement, and for a
+// plan it has no floor for, the fixed threshold applies
+type Calibrator struct {
+	Sweeps   int
+	MarginDB float32
+	Refresh  time.Duration // 0 = measure once
+
+	floor      *specan.NoiseFloor
+	thresholds []float32
+	pending    []*specan.Frame
+}
+
+// NewCalibrator creates a calibrator with the defaults and no floor
+func NewCalibrator() *Calibrator {
+	return &Calibrator{Sweeps: DefaultCalibrationSweeps, MarginDB: DefaultMarginDB}
+}
+
+// NewCalibratorFromConfig creates a calibrator from an etc/scanner
+// calibration section, starting from its stored noise floor, if any
+func NewCalibratorFromConfig(cfg *CalibrationConfig) *Calibrator {
+	c := NewCalibrator()
+	if cfg.Sweeps > 0 {
+		c.Sweeps = cfg.Sweeps
+	}
+	if cfg.MarginDB > 0 {
+		c.MarginDB = cfg.MarginDB
+	}
+	c.Refresh = time.Duration(cfg.RefreshIntervalMs) * time.Millisecond
+	c.SetFloor(cfg.NoiseFloor)
+	return c
+}
+
+// SetFloor uses a floor measured earlier
+func (c *Calibrator) SetFloor(floor *specan.NoiseFloor) {
+	c.floor = floor
+	c.thresholds = nil
+	if floor != nil {
+		c.thresholds = floor.Thresholds(c.MarginDB)
+	}
+}
+
+// Floor returns the noise floor in use, or nil before the first
+// measurement
+func (c *Calibrator) Floor() *specan.NoiseFloor {
+	return c.floor
+}
+
+// Calibrating reports whether the calibrator is collecting sweeps for a
+// measurement
+func (c *Calibrator) Calibrating() bool {
+	return len(c.pending) > 0 || c.floor == nil
+}
+
+// Add folds a sweep into the measurement in progress, starting one if
+// the floor is missing, stale or for another plan. It returns the new
+// floor when the sweep completes a measurement, else nil
+func (c *Calibrator) Add(frame *specan.Frame) *specan.NoiseFloor {
+	due := c.floor == nil || !c.floor.Matches(frame) ||
+		(c.Refresh > 0 && frame.Timestamp.Sub(c.floor.Measured) >= c.Refresh)
+	if !due && len(c.pending) == 0 {
+		return nil
+	}
+	if len(c.pending) > 0 {
+		last := c.pending[len(c.pending)-1]
+		if last.BaseFreq != frame.BaseFreq || last.ChanSpacing != frame.ChanSpacing || len(last.RSSI) != len(frame.RSSI) {
+			// The plan changed part way: start over
+			c.pending = nil
+		}
+	}
+	c.pending = append(c.pending, frame)
+	if len(c.pending) < max(1, c.Sweeps) {
+		return nil
+	}
+
+	floor, err := specan.MeasureNoiseFloor(c.pending)
+	c.pending = nil
+	if err != nil {
+		return nil
+	}
+	c.SetFloor(floor)
+	return floor
+}
+
+// Peaks finds the channels at or above their threshold, or above
+// fallbackDBm where there is no floor for frame's plan
+func (c *Calibrator) Peaks(frame *specan.Frame, fallbackDBm float32) []specan.Peak {
+	if c.floor == nil || !c.floor.Matches(frame) {
+		return specan.FindPeaks(frame, fallbackDBm)
+	}
+	return specan.FindPeaksAbove(frame, c.thresholds)
+}
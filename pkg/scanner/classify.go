@@ -0,0 +1,271 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Modulations a SignalClass can report
+const (
+	ModulationOOK     = "OOK"
+	ModulationFSK     = "FSK"
+	ModulationUnknown = "unknown"
+)
+
+// Classifier defaults
+const (
+	DefaultFineSpanHz      = 500000
+	DefaultFineChans       = 21
+	DefaultEnvelopeTime    = 300 * time.Millisecond
+	DefaultBurstGap        = 20 * time.Millisecond
+	DefaultOOKGapRatio     = 0.25
+	DefaultFSKSpreadHz     = 20000
+	DefaultClassifyHoldoff = time.Minute
+	minEnvelopeDB          = 6 // Swing below which the envelope shows no signal
+)
+
+// SignalClass is what a characterization pass found out about a signal.
+// The modulation is a heuristic: OOK keys the carrier on and off, so
+// inside a burst the envelope keeps dropping to the noise, while FSK
+// holds it steady and the demodulator's frequency estimate agrees from
+// packet to packet
+type SignalClass struct {
+	Modulation   string           `json:"modulation"`
+	FrequencyHz  uint32           `json:"frequency_hz"`   // Strongest channel of the fine sweep
+	BandwidthHz  uint32           `json:"bandwidth_hz"`   // -6 dB width in the fine sweep
+	BurstMs      float64          `json:"burst_ms"`       // Longest burst in the envelope (0 = none seen)
+	GapRatio     float32          `json:"gap_ratio"`      // Share of samples in bursts below the on level
+	FreqOffsetHz float64          `json:"freq_offset_hz"` // Median FREQEST in bursts
+	FreqSpreadHz float64          `json:"freq_spread_hz"` // FREQEST range in bursts
+	Shape        *specan.Snapshot `json:"shape,omitempty"`
+}
+
+func (c *SignalClass) String() string {
+	s := fmt.Sprintf("%s, ~%.0f kHz wide", c.Modulation, float64(c.BandwidthHz)/1e3)
+	if c.BurstMs > 0 {
+		s += fmt.Sprintf(", bursts of %.0f ms", c.BurstMs)
+	}
+	return s
+}
+
+// Classifier characterizes detected signals in a pass of its own: a fine
+// sweep across the signal for its shape and bandwidth, then the RSSI
+// envelope and frequency estimate sampled in receive mode for the
+// modulation and burst length. Like a Capturer, it needs the radio to
+// itself and puts the registers back afterwards
+type Classifier struct {
+	FineSpanHz   uint32        // Width of the fine sweep
+	FineChans    int           // Channels in the fine sweep
+	EnvelopeTime time.Duration // How long the envelope is sampled
+	BurstGap     time.Duration // Gaps shorter than this are inside a burst
+	OOKGapRatio  float32       // GapRatio at or above which a signal is OOK
+	FSKSpreadHz  float64       // FREQEST spread at or below which a steady signal is FSK
+
+	// Holdoff skips detections within HoldoffSpanHz of a frequency
+	// classified less than this long ago
+	Holdoff       time.Duration
+	HoldoffSpanHz uint32
+
+	classified holdoffs
+}
+
+// NewClassifier creates a classifier with the defaults
+func NewClassifier() *Classifier {
+	return &Classifier{
+		FineSpanHz:    DefaultFineSpanHz,
+		FineChans:     DefaultFineChans,
+		EnvelopeTime:  DefaultEnvelopeTime,
+		BurstGap:      DefaultBurstGap,
+		OOKGapRatio:   DefaultOOKGapRatio,
+		FSKSpreadHz:   DefaultFSKSpreadHz,
+		Holdoff:       DefaultClassifyHoldoff,
+		HoldoffSpanHz: DefaultHoldoffSpanHz,
+	}
+}
+
+// Due reports whether d is far enough, in frequency or time, from the
+// signals classified before to be classified itself
+func (c *Classifier) Due(d *Detection) bool {
+	return c.classified.due(d, c.Holdoff, c.HoldoffSpanHz)
+}
+
+// Classify characterizes the signal at d. The analyzer must not be
+// running; it is left stopped and has to be configured again
+func (c *Classifier) Classify(ctx context.Context, sa *specan.SpecAn, device *yardstick.Device, d *Detection) (class *SignalClass, err error) {
+	c.classified.mark(d)
+
+	err = registers.WithTemporaryRegisters(device, nil, func() error {
+		var err error
+		class, err = c.fineSweep(ctx, sa, d)
+		if err != nil {
+			return fmt.Errorf("fine sweep failed: %w", err)
+		}
+		samples, err := c.envelope(ctx, device, class)
+		if err != nil {
+			return fmt.Errorf("envelope sampling failed: %w", err)
+		}
+		c.analyze(class, samples)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+// fineSweep sweeps FineSpanHz around d at fine resolution for the
+// signal's center, bandwidth and shape
+func (c *Classifier) fineSweep(ctx context.Context, sa *specan.SpecAn, d *Detection) (*SignalClass, error) {
+	chans := max(3, c.FineChans)
+	spacing := max(specan.MinChanSpacingHz, c.FineSpanHz/uint32(chans))
+	half := spacing * uint32(chans/2)
+	plan, err := specan.NewSweepPlan(d.FrequencyHz-half, d.FrequencyHz-half+spacing*uint32(chans), spacing)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := plan.Sweep(ctx, sa)
+	if err != nil {
+		return nil, err
+	}
+	idx, freq, _ := specan.MaxRSSI(frame)
+	return &SignalClass{
+		Modulation:  ModulationUnknown,
+		FrequencyHz: freq,
+		BandwidthHz: specan.PeakBandwidth(frame, idx, 6),
+		Shape:       &specan.Snapshot{StartHz: frame.BaseFreq, SpacingHz: frame.ChanSpacing, RSSI: frame.RSSI},
+	}, nil
+}
+
+// envelopeSample is one reading of the receiver during envelope sampling
+type envelopeSample struct {
+	at       time.Duration // Since sampling started
+	rssi     int           // dBm
+	freqEst  float64       // Hz
+	validEst bool
+}
+
+// envelope samples RSSI and FREQEST at the signal's center, with a
+// listen-only FSK profile so the demodulator estimates the frequency
+func (c *Classifier) envelope(ctx context.Context, device *yardstick.Device, class *SignalClass) ([]envelopeSample, error) {
+	if err := device.StrobeModeIDLE(); err != nil {
+		return nil, fmt.Errorf("failed to strobe IDLE: %w", err)
+	}
+	p := profiles.NewPromiscuous(profiles.SignalEstimate{
+		FrequencyHz: float64(class.FrequencyHz),
+		BandwidthHz: float64(class.BandwidthHz),
+		Modulation:  profiles.Mod2FSK,
+	})
+	if err := config.ApplyProfile(device, p); err != nil {
+		return nil, err
+	}
+	if err := device.Retune(class.FrequencyHz); err != nil {
+		return nil, err
+	}
+
+	lease, err := device.Acquire(yardstick.ModeRX, "classify")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	device = lease.Device()
+	if err := device.SetModeRX(); err != nil {
+		return nil, fmt.Errorf("failed to enter RX mode: %w", err)
+	}
+
+	limit := c.EnvelopeTime
+	if limit <= 0 {
+		limit = DefaultEnvelopeTime
+	}
+	var samples []envelopeSample
+	start := time.Now()
+	for time.Since(start) < limit && ctx.Err() == nil {
+		raw, err := device.GetRSSI()
+		if err != nil {
+			return nil, err
+		}
+		s := envelopeSample{at: time.Since(start), rssi: yardstick.RSSIToDBm(raw)}
+		if est, err := device.GetFreqEst(); err == nil {
+			s.freqEst, s.validEst = est, true
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// analyze derives the burst length and modulation from the envelope
+func (c *Classifier) analyze(class *SignalClass, samples []envelopeSample) {
+	if len(samples) == 0 {
+		return
+	}
+	low, high := samples[0].rssi, samples[0].rssi
+	for _, s := range samples {
+		low, high = min(low, s.rssi), max(high, s.rssi)
+	}
+	if high-low < minEnvelopeDB {
+		// Flat: the signal was gone, or never stopped
+		return
+	}
+	on := (low + high) / 2
+
+	// Bursts are runs of on samples with no gap as long as BurstGap
+	gap := c.BurstGap
+	if gap <= 0 {
+		gap = DefaultBurstGap
+	}
+	var inBurst, offInBurst int
+	var ests []float64
+	burstStart, lastOn := -1, -1
+	endBurst := func(last int) {
+		if burstStart < 0 {
+			return
+		}
+		ms := float64(samples[last].at-samples[burstStart].at) / float64(time.Millisecond)
+		class.BurstMs = max(class.BurstMs, ms)
+		for _, s := range samples[burstStart : last+1] {
+			inBurst++
+			if s.rssi < on {
+				offInBurst++
+			} else if s.validEst {
+				ests = append(ests, s.freqEst)
+			}
+		}
+	}
+	for i, s := range samples {
+		if s.rssi < on {
+			continue
+		}
+		if lastOn >= 0 && s.at-samples[lastOn].at >= gap {
+			endBurst(lastOn)
+			burstStart = -1
+		}
+		if burstStart < 0 {
+			burstStart = i
+		}
+		lastOn = i
+	}
+	endBurst(lastOn)
+	if inBurst == 0 {
+		return
+	}
+	class.GapRatio = float32(offInBurst) / float32(inBurst)
+
+	if len(ests) > 0 {
+		sort.Float64s(ests)
+		class.FreqOffsetHz = ests[len(ests)/2]
+		class.FreqSpreadHz = ests[len(ests)-1] - ests[0]
+	}
+	switch {
+	case class.GapRatio >= c.OOKGapRatio:
+		class.Modulation = ModulationOOK
+	case len(ests) > 0 && class.FreqSpreadHz <= c.FSKSpreadHz:
+		class.Modulation = ModulationFSK
+	}
+}
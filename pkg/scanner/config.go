@@ -0,0 +1,183 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// OutputConfig is the "output" section of an etc/scanner configuration
+type OutputConfig struct {
+	LogSignals bool   `json:"log_signals"`
+	LogPath    string `json:"log_path,omitempty"`
+	LogFormat  string `json:"log_format,omitempty"` // csv, json or sqlite
+}
+
+// CalibrationConfig is the "calibration" section of an etc/scanner
+// configuration. NoiseFloor is the last measurement, written back by
+// SaveNoiseFloor
+type CalibrationConfig struct {
+	Enabled           bool               `json:"enabled"`
+	Sweeps            int                `json:"sweeps"`
+	MarginDB          float32            `json:"margin_db"`
+	RefreshIntervalMs int                `json:"refresh_interval_ms"` // 0 = never
+	NoiseFloor        *specan.NoiseFloor `json:"noise_floor,omitempty"`
+}
+
+// BandConfig is a frequency band of an etc/scanner configuration, which
+// stands for a coarse frequency every StepHz
+type BandConfig struct {
+	Name    string `json:"name"`
+	StartHz uint32 `json:"start_hz"`
+	EndHz   uint32 `json:"end_hz"`
+	StepHz  uint32 `json:"step_hz"`
+	Enabled bool   `json:"enabled"`
+}
+
+// FrequencyConfig is the "frequencies" section of an etc/scanner
+// configuration. Hopper is the Flipper's quick-hop subset of Coarse
+type FrequencyConfig struct {
+	Coarse []uint32     `json:"coarse"`
+	Hopper []uint32     `json:"hopper,omitempty"`
+	Bands  []BandConfig `json:"bands,omitempty"`
+}
+
+// RadioPresets is the "radio_presets" section of an etc/scanner
+// configuration, the receivers of the two-stage Scanner
+type RadioPresets struct {
+	Coarse RadioPreset `json:"coarse,omitempty"`
+	Fine   RadioPreset `json:"fine,omitempty"`
+}
+
+// Config is the part of an etc/scanner configuration the scanners read
+type Config struct {
+	Frequencies    FrequencyConfig `json:"frequencies"`
+	ScanParameters ScanConfig      `json:"scan_parameters"`
+	SignalTracking struct {
+		LostThreshold         int    `json:"lost_threshold"`
+		FrequencyResolutionHz uint32 `json:"frequency_resolution_hz"`
+	} `json:"signal_tracking"`
+	Calibration     CalibrationConfig `json:"calibration"`
+	HopperDetection HopperConfig      `json:"hopper_detection"`
+	RadioPresets    RadioPresets      `json:"radio_presets"`
+	Output          OutputConfig      `json:"output"`
+}
+
+// CoarseFrequencies returns the coarse frequencies, or those of the
+// enabled bands if there are none, or else DefaultFrequencies
+func (c *Config) CoarseFrequencies() []uint32 {
+	if len(c.Frequencies.Coarse) > 0 {
+		return c.Frequencies.Coarse
+	}
+	var freqs []uint32
+	for _, b := range c.Frequencies.Bands {
+		if !b.Enabled || b.StepHz == 0 {
+			continue
+		}
+		for f := b.StartHz; f <= b.EndHz; f += b.StepHz {
+			freqs = append(freqs, f)
+		}
+	}
+	if len(freqs) == 0 {
+		return DefaultFrequencies
+	}
+	return freqs
+}
+
+// LoadConfig reads an etc/scanner configuration
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scanner config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// SaveNoiseFloor stores floor as calibration.noise_floor in the
+// configuration at path. Every other setting is kept, in its order
+func SaveNoiseFloor(path string, floor *specan.NoiseFloor) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	value, err := json.Marshal(floor)
+	if err != nil {
+		return err
+	}
+
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to unmarshal scanner config: %w", err)
+	}
+	section := root["calibration"]
+	if len(section) == 0 || string(section) == "null" {
+		section = json.RawMessage("{}")
+	}
+	if section, err = setKey(section, "noise_floor", value); err != nil {
+		return fmt.Errorf("invalid calibration section: %w", err)
+	}
+	if data, err = setKey(data, "calibration", section); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// setKey sets key in the JSON object obj to value, keeping the order of
+// the other keys; a new key goes last
+func setKey(obj []byte, key string, value json.RawMessage) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	found := false
+	write := func(k string, v json.RawMessage) {
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(k)
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(v)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, _ := t.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if k == key {
+			v, found = value, true
+		}
+		write(k, v)
+	}
+	if !found {
+		write(key, value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
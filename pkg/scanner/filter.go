@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// DefaultIgnoreToleranceHz is how far from an ignored frequency a
+// detection is still ignored, enough for a transmitter's drift and the
+// width of its peak
+const DefaultIgnoreToleranceHz = 50000
+
+// FrequencyRange is an inclusive range of frequencies
+type FrequencyRange struct {
+	StartHz uint32 `json:"start_hz"`
+	EndHz   uint32 `json:"end_hz"`
+	Name    string `json:"name,omitempty"`
+}
+
+// Contains reports whether freqHz is in the range
+func (r FrequencyRange) Contains(freqHz uint32) bool {
+	return freqHz >= r.StartHz && freqHz <= r.EndHz
+}
+
+func (r FrequencyRange) String() string {
+	return fmt.Sprintf("%.3f-%.3f MHz", float64(r.StartHz)/1e6, float64(r.EndHz)/1e6)
+}
+
+// ScanConfig is the "scan_parameters" section of an etc/scanner
+// configuration: the two-stage Scanner's threshold and fine scan, and
+// which detections are reported. Ignored frequencies and ranges, such as
+// a neighbour's weather station, are never reported; with AllowRanges,
+// only detections inside one of them are
+type ScanConfig struct {
+	RSSIThresholdDBm float32 `json:"rssi_threshold_dbm,omitempty"`
+	FineScanRangeHz  uint32  `json:"fine_scan_range_hz,omitempty"`
+	FineScanStepHz   uint32  `json:"fine_scan_step_hz,omitempty"`
+	DwellTimeMs      int     `json:"dwell_time_ms,omitempty"`
+	ScanIntervalMs   int     `json:"scan_interval_ms,omitempty"`
+
+	IgnoreFrequencies []uint32         `json:"ignore_frequencies,omitempty"` // Hz
+	IgnoreRanges      []FrequencyRange `json:"ignore_ranges,omitempty"`
+	AllowRanges       []FrequencyRange `json:"allow_ranges,omitempty"`
+
+	// IgnoreToleranceHz widens each ignored frequency to a range of
+	// +/- this much (0 = DefaultIgnoreToleranceHz)
+	IgnoreToleranceHz uint32 `json:"ignore_tolerance_hz,omitempty"`
+}
+
+// Filters reports whether the configuration drops any detections
+func (c *ScanConfig) Filters() bool {
+	return len(c.IgnoreFrequencies) > 0 || len(c.IgnoreRanges) > 0 || len(c.AllowRanges) > 0
+}
+
+// Allowed reports whether a detection at freqHz is to be reported
+func (c *ScanConfig) Allowed(freqHz uint32) bool {
+	tolerance := c.IgnoreToleranceHz
+	if tolerance == 0 {
+		tolerance = DefaultIgnoreToleranceHz
+	}
+	for _, f := range c.IgnoreFrequencies {
+		if absDiff(f, freqHz) <= tolerance {
+			return false
+		}
+	}
+	for _, r := range c.IgnoreRanges {
+		if r.Contains(freqHz) {
+			return false
+		}
+	}
+	if len(c.AllowRanges) == 0 {
+		return true
+	}
+	for _, r := range c.AllowRanges {
+		if r.Contains(freqHz) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the peaks that are Allowed, in order
+func (c *ScanConfig) Filter(peaks []specan.Peak) []specan.Peak {
+	if !c.Filters() {
+		return peaks
+	}
+	var out []specan.Peak
+	for _, p := range peaks {
+		if c.Allowed(p.FrequencyHz) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ParseFrequencies parses a comma-separated list of frequencies and
+// "low-high" ranges in MHz, e.g. "433.92,434.0-434.2"
+func ParseFrequencies(s string) ([]uint32, []FrequencyRange, error) {
+	var freqs []uint32
+	var ranges []FrequencyRange
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(item, "-")
+		low, err := strconv.ParseFloat(lo, 64)
+		if err != nil || low <= 0 {
+			return nil, nil, fmt.Errorf("invalid frequency '%s': want MHz or low-high in MHz", item)
+		}
+		if !isRange {
+			freqs = append(freqs, uint32(low*1e6))
+			continue
+		}
+		high, err := strconv.ParseFloat(hi, 64)
+		if err != nil || high < low {
+			return nil, nil, fmt.Errorf("invalid range '%s': want low-high in MHz", item)
+		}
+		ranges = append(ranges, FrequencyRange{StartHz: uint32(low * 1e6), EndHz: uint32(high * 1e6)})
+	}
+	return freqs, ranges, nil
+}
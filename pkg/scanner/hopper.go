@@ -0,0 +1,229 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// Hopper detection defaults
+const (
+	DefaultHopperWindow    = 5 * time.Second
+	DefaultHopperChannels  = 5
+	DefaultHopperHops      = 8
+	DefaultHopperDwell     = 2
+	DefaultHopperChannelHz = 50000
+)
+
+// Hop is a short burst on one channel
+type Hop struct {
+	Time        time.Time `json:"time"`
+	FrequencyHz uint32    `json:"frequency_hz"`
+	RSSI        float32   `json:"rssi_dbm"`
+}
+
+// FHSSSignal is a frequency hopper: short bursts on many channels within
+// one window, taken for one transmitter. The hop rate is the rate the
+// sweeps caught hops at, a lower bound when the hopper is faster than a
+// sweep
+type FHSSSignal struct {
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Hops       int       `json:"hops"`
+	HopRateHz  float64   `json:"hop_rate_hz"`
+	Channels   []uint32  `json:"channels_hz"`
+	SpacingHz  uint32    `json:"spacing_hz"` // Smallest gap between channels
+	RSSI       float32   `json:"rssi_dbm"`   // Strongest hop
+	LowHz      uint32    `json:"low_hz"`
+	HighHz     uint32    `json:"high_hz"`
+	CenterHz   uint32    `json:"center_hz"`
+	WindowSecs float64   `json:"window_s"`
+}
+
+func (f *FHSSSignal) String() string {
+	return fmt.Sprintf("%d channels %.3f-%.3f MHz, %.0f kHz apart, %d hops at %.1f/s",
+		len(f.Channels), float64(f.LowHz)/1e6, float64(f.HighHz)/1e6, float64(f.SpacingHz)/1e3, f.Hops, f.HopRateHz)
+}
+
+// HopperConfig is the "hopper_detection" section of an etc/scanner
+// configuration
+type HopperConfig struct {
+	Enabled        bool   `json:"enabled"`
+	WindowMs       int    `json:"window_ms"`
+	MinChannels    int    `json:"min_channels"`
+	MinHops        int    `json:"min_hops"`
+	MaxDwellSweeps int    `json:"max_dwell_sweeps"`
+	ChannelHz      uint32 `json:"channel_hz"`
+}
+
+// burstRun is a channel's current run of sweeps with a detection
+type burstRun struct {
+	Hop
+	sweeps int
+	seen   bool
+}
+
+// HopperDetector finds frequency hoppers among the detections of a
+// sweep scanner. A detection that is gone again within MaxDwellSweeps
+// sweeps is a hop; a steady carrier is not. When the hops of the last
+// Window fall on at least MinChannels channels and number at least
+// MinHops, they are reported as one FHSSSignal, at most once a Window.
+// It wants the detections before any sweep-to-sweep confirmation, which
+// drops exactly the short bursts it looks for
+type HopperDetector struct {
+	Window         time.Duration
+	MinChannels    int
+	MinHops        int
+	MaxDwellSweeps int
+	ChannelHz      uint32 // Detections this close are one channel
+
+	runs     map[uint32]*burstRun // Keyed by channel
+	hops     []Hop
+	reported time.Time
+}
+
+// NewHopperDetector creates a detector with the defaults
+func NewHopperDetector() *HopperDetector {
+	return &HopperDetector{
+		Window:         DefaultHopperWindow,
+		MinChannels:    DefaultHopperChannels,
+		MinHops:        DefaultHopperHops,
+		MaxDwellSweeps: DefaultHopperDwell,
+		ChannelHz:      DefaultHopperChannelHz,
+	}
+}
+
+// NewHopperDetectorFromConfig creates a detector from an etc/scanner
+// hopper_detection section
+func NewHopperDetectorFromConfig(cfg *HopperConfig) *HopperDetector {
+	h := NewHopperDetector()
+	if cfg.WindowMs > 0 {
+		h.Window = time.Duration(cfg.WindowMs) * time.Millisecond
+	}
+	if cfg.MinChannels > 0 {
+		h.MinChannels = cfg.MinChannels
+	}
+	if cfg.MinHops > 0 {
+		h.MinHops = cfg.MinHops
+	}
+	if cfg.MaxDwellSweeps > 0 {
+		h.MaxDwellSweeps = cfg.MaxDwellSweeps
+	}
+	if cfg.ChannelHz > 0 {
+		h.ChannelHz = cfg.ChannelHz
+	}
+	return h
+}
+
+// Sweep takes the peaks of a sweep at time at. It returns the hopper
+// when this sweep completes one, else nil
+func (h *HopperDetector) Sweep(at time.Time, peaks []specan.Peak) *FHSSSignal {
+	if h.runs == nil {
+		h.runs = make(map[uint32]*burstRun)
+	}
+	for _, r := range h.runs {
+		r.seen = false
+	}
+	for _, p := range peaks {
+		r := h.run(p.FrequencyHz)
+		if r == nil {
+			r = &burstRun{Hop: Hop{Time: at, FrequencyHz: p.FrequencyHz, RSSI: p.RSSI}}
+			h.runs[p.FrequencyHz] = r
+		}
+		if !r.seen {
+			r.seen = true
+			r.sweeps++
+		}
+		r.RSSI = max(r.RSSI, p.RSSI)
+	}
+
+	// A run that ended short is a hop
+	for freq, r := range h.runs {
+		if r.seen {
+			continue
+		}
+		delete(h.runs, freq)
+		if r.sweeps <= max(1, h.MaxDwellSweeps) {
+			h.hops = append(h.hops, r.Hop)
+		}
+	}
+
+	kept := h.hops[:0]
+	for _, hop := range h.hops {
+		if at.Sub(hop.Time) <= h.Window {
+			kept = append(kept, hop)
+		}
+	}
+	h.hops = kept
+
+	if !h.reported.IsZero() && at.Sub(h.reported) < h.Window {
+		return nil
+	}
+	f := h.hopper()
+	if f != nil {
+		h.reported = at
+	}
+	return f
+}
+
+// run returns the ongoing run within ChannelHz of freqHz
+func (h *HopperDetector) run(freqHz uint32) *burstRun {
+	for freq, r := range h.runs {
+		if absDiff(freq, freqHz) <= h.ChannelHz {
+			return r
+		}
+	}
+	return nil
+}
+
+// hopper sums up the hops in the window; nil if they don't make a hopper
+func (h *HopperDetector) hopper() *FHSSSignal {
+	if len(h.hops) < max(2, h.MinHops) {
+		return nil
+	}
+	hops := make([]Hop, len(h.hops))
+	copy(hops, h.hops)
+	sort.Slice(hops, func(i, j int) bool { return hops[i].FrequencyHz < hops[j].FrequencyHz })
+
+	// Channels are clusters of hops within ChannelHz of their first
+	var channels []uint32
+	var rssi float32 = hops[0].RSSI
+	first, last := hops[0].Time, hops[0].Time
+	for _, hop := range hops {
+		if len(channels) == 0 || hop.FrequencyHz-channels[len(channels)-1] > h.ChannelHz {
+			channels = append(channels, hop.FrequencyHz)
+		}
+		rssi = max(rssi, hop.RSSI)
+		if hop.Time.Before(first) {
+			first = hop.Time
+		}
+		if hop.Time.After(last) {
+			last = hop.Time
+		}
+	}
+	if len(channels) < max(2, h.MinChannels) {
+		return nil
+	}
+
+	f := &FHSSSignal{
+		FirstSeen:  first,
+		LastSeen:   last,
+		Hops:       len(hops),
+		Channels:   channels,
+		RSSI:       rssi,
+		LowHz:      channels[0],
+		HighHz:     channels[len(channels)-1],
+		WindowSecs: h.Window.Seconds(),
+	}
+	f.CenterHz = f.LowHz + (f.HighHz-f.LowHz)/2
+	f.SpacingHz = f.HighHz - f.LowHz
+	for i := 1; i < len(channels); i++ {
+		f.SpacingHz = min(f.SpacingHz, channels[i]-channels[i-1])
+	}
+	if span := last.Sub(first).Seconds(); span > 0 {
+		f.HopRateHz = float64(len(hops)-1) / span
+	}
+	return f
+}
@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// RadioBands are the ranges the CC1111 tunes, which PartitionFrequencies
+// keeps together
+var RadioBands = []FrequencyRange{
+	{StartHz: 300000000, EndHz: 348000000, Name: "300MHz"},
+	{StartHz: 387000000, EndHz: 464000000, Name: "400MHz"},
+	{StartHz: 779000000, EndHz: 928000000, Name: "800MHz"},
+}
+
+// bandOf returns the index of the radio band freqHz is in, or -1
+func bandOf(freqHz uint32) int {
+	for i, b := range RadioBands {
+		if freqHz >= b.StartHz && freqHz <= b.EndHz {
+			return i
+		}
+	}
+	return -1
+}
+
+// PartitionFrequencies splits frequencies between n devices, a radio
+// band each where that works out. With more devices than bands the
+// largest share is halved until every device has one; with fewer, whole
+// bands go to the device with the fewest frequencies so far. There are
+// fewer than n shares when there are fewer than n frequencies
+func PartitionFrequencies(frequencies []uint32, n int) [][]uint32 {
+	if n < 1 || len(frequencies) == 0 {
+		return nil
+	}
+	sorted := append([]uint32(nil), frequencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var groups [][]uint32
+	band := -2
+	for _, f := range sorted {
+		if b := bandOf(f); b != band || len(groups) == 0 {
+			groups = append(groups, nil)
+			band = b
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], f)
+	}
+
+	for len(groups) < n {
+		i := largest(groups)
+		g := groups[i]
+		if len(g) < 2 {
+			break
+		}
+		half := len(g) / 2
+		groups = append(groups[:i+1], groups[i:]...)
+		groups[i], groups[i+1] = g[:half:half], g[half:]
+	}
+
+	if len(groups) > n {
+		sort.SliceStable(groups, func(i, j int) bool { return len(groups[i]) > len(groups[j]) })
+		shares := make([][]uint32, n)
+		for _, g := range groups {
+			i := 0
+			for j := range shares {
+				if len(shares[j]) < len(shares[i]) {
+					i = j
+				}
+			}
+			shares[i] = append(shares[i], g...)
+		}
+		for _, s := range shares {
+			sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		}
+		groups = shares
+	}
+	return groups
+}
+
+// largest returns the index of the longest group
+func largest(groups [][]uint32) int {
+	best := 0
+	for i, g := range groups {
+		if len(g) > len(groups[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// MultiScanner runs a two-stage Scanner on each of several devices, each
+// over its share of the coarse frequencies, and merges their results
+// into one stream
+type MultiScanner struct {
+	Scanners []*Scanner
+}
+
+// NewMultiScanner partitions frequencies between devices and creates a
+// scanner with the defaults for each share. Devices left without a share
+// are not used
+func NewMultiScanner(devices []*yardstick.Device, frequencies []uint32) (*MultiScanner, error) {
+	return newMultiScanner(devices, frequencies, func(device *yardstick.Device) (*Scanner, error) {
+		return NewScanner(device, nil), nil
+	})
+}
+
+// NewMultiScannerFromConfig partitions the coarse frequencies of an
+// etc/scanner configuration between devices and creates a scanner from
+// the configuration for each share
+func NewMultiScannerFromConfig(devices []*yardstick.Device, cfg *Config) (*MultiScanner, error) {
+	return newMultiScanner(devices, cfg.CoarseFrequencies(), func(device *yardstick.Device) (*Scanner, error) {
+		return NewScannerFromConfig(device, cfg)
+	})
+}
+
+func newMultiScanner(devices []*yardstick.Device, frequencies []uint32, create func(*yardstick.Device) (*Scanner, error)) (*MultiScanner, error) {
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices to scan with")
+	}
+	m := &MultiScanner{}
+	for i, share := range PartitionFrequencies(frequencies, len(devices)) {
+		s, err := create(devices[i])
+		if err != nil {
+			return nil, err
+		}
+		s.Frequencies = share
+		m.Scanners = append(m.Scanners, s)
+	}
+	return m, m.Validate()
+}
+
+// Validate checks every scanner's settings
+func (m *MultiScanner) Validate() error {
+	if len(m.Scanners) == 0 {
+		return fmt.Errorf("no coarse frequencies to scan")
+	}
+	for _, s := range m.Scanners {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", s.device.Serial, err)
+		}
+	}
+	return nil
+}
+
+// Run runs every scanner in its own goroutine until ctx is done or one
+// of them fails, and passes their results to fn one at a time as they
+// arrive, so fn needs no locking. The first error stops them all
+func (m *MultiScanner) Run(ctx context.Context, fn func(*ScanResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan *ScanResult)
+	errs := make(chan error, len(m.Scanners))
+	for _, s := range m.Scanners {
+		go func(s *Scanner) {
+			err := s.Run(ctx, func(r *ScanResult) error {
+				select {
+				case results <- r:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				errs <- fmt.Errorf("%s: %w", s.device.Serial, err)
+				return
+			}
+			errs <- nil
+		}(s)
+	}
+
+	var first error
+	for running := len(m.Scanners); running > 0; {
+		select {
+		case r := <-results:
+			if first != nil {
+				continue
+			}
+			if err := fn(r); err != nil {
+				first = err
+				cancel()
+			}
+		case err := <-errs:
+			running--
+			if err != nil && first == nil {
+				first = err
+				cancel()
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,89 @@
+// Package orchestrator coordinates a scanner built from two radios: one
+// sweeps without pause while the other, already set up to receive, is
+// tuned to each detection the sweep hands over and records its traffic.
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Orchestrator drives the capture radio. The scanning side calls Offer
+// with its detections; Run, in its own goroutine, records each one it
+// takes on the capture radio and passes the result to Bursts. A
+// detection arriving while the capture radio is busy is dropped rather
+// than queued, since by the time the radio is free it would be stale
+type Orchestrator struct {
+	Device   *yardstick.Device // The capture radio
+	Capturer *scanner.Capturer
+	Profile  string // Name of the profile Device was set up with
+
+	pending chan *scanner.Detection
+	bursts  chan *scanner.Burst
+}
+
+// New creates an orchestrator recording on device with c. device must
+// already be set up to receive, as Capturer.Prepare does; detections in
+// one of c's Bands switch to the band's profile for their capture
+func New(device *yardstick.Device, c *scanner.Capturer, profile string) *Orchestrator {
+	return &Orchestrator{
+		Device:   device,
+		Capturer: c,
+		Profile:  profile,
+		pending:  make(chan *scanner.Detection),
+		bursts:   make(chan *scanner.Burst, 16),
+	}
+}
+
+// Offer hands a detection to the capture radio. It returns false,
+// without waiting, if the radio is busy recording or the capturer's
+// holdoff skips the detection
+func (o *Orchestrator) Offer(d *scanner.Detection) bool {
+	if !o.Capturer.Due(d) {
+		return false
+	}
+	select {
+	case o.pending <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// Bursts delivers the result of every capture; it is closed when Run
+// returns
+func (o *Orchestrator) Bursts() <-chan *scanner.Burst {
+	return o.bursts
+}
+
+// Run records offered detections until ctx is done or a capture fails
+func (o *Orchestrator) Run(ctx context.Context) error {
+	defer close(o.bursts)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d := <-o.pending:
+			b, err := o.record(ctx, d)
+			if err != nil {
+				return fmt.Errorf("capture at %.3f MHz on %s failed: %w", float64(d.FrequencyHz)/1e6, o.Device.Serial, err)
+			}
+			select {
+			case o.bursts <- b:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// record captures d with its band's profile, or the one Device is set up with
+func (o *Orchestrator) record(ctx context.Context, d *scanner.Detection) (*scanner.Burst, error) {
+	if o.Capturer.Band(d.FrequencyHz) != nil {
+		return o.Capturer.Capture(ctx, o.Device, d)
+	}
+	return o.Capturer.Record(ctx, o.Device, d, o.Profile)
+}
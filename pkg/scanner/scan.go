@@ -0,0 +1,380 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/herlein/gocat/pkg/registers"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Coarse stage backends
+const (
+	// BackendSpecan sweeps the coarse frequencies with the firmware
+	// spectrum analyzer, hundreds of channels per sweep
+	BackendSpecan = "specan"
+	// BackendRSSI tunes to each coarse frequency in turn and reads RSSI,
+	// as the Flipper scanner does; a few ms per frequency
+	BackendRSSI = "rssi"
+)
+
+// Two-stage scan defaults
+const (
+	DefaultRSSIThreshold   = -93.0
+	DefaultFineScanRangeHz = 300000
+	DefaultFineScanStepHz  = 20000
+	DefaultDwellTime       = 2 * time.Millisecond
+	DefaultCoarseSpacingHz = 100000
+
+	coarseMarginHz = 300000  // Half the coarse preset's bandwidth, swept either side of the list
+	coarseGapHz    = 5000000 // Frequencies further apart are swept separately
+)
+
+// DefaultFrequencies are the coarse frequencies of the Flipper scanner:
+// the common sub-GHz ISM and license-free channels
+var DefaultFrequencies = []uint32{
+	300000000, 303875000, 304250000, 310000000, 315000000, 318000000,
+	390000000, 418000000, 433075000, 433420000, 433920000, 434420000, 434775000, 438900000,
+	868350000, 915000000, 925000000,
+}
+
+// RadioPreset overrides radio registers by name, e.g. "mdmcfg4"
+type RadioPreset map[string]uint8
+
+// Radio presets of the Flipper scanner
+var (
+	// CoarsePreset is a ~600 kHz ASK receiver, to catch energy anywhere
+	// near a coarse frequency
+	CoarsePreset = RadioPreset{
+		"mdmcfg4": 0x1F, "mdmcfg3": 0x7F, "mdmcfg2": 0x30,
+		"agcctrl2": 0x07, "agcctrl1": 0x00, "agcctrl0": 0x91,
+		"frend1": 0xB6, "frend0": 0x10,
+	}
+	// FinePreset is a ~58 kHz ASK receiver, to place the signal
+	FinePreset = RadioPreset{
+		"mdmcfg4": 0xF7, "mdmcfg3": 0x7F, "mdmcfg2": 0x30,
+		"agcctrl2": 0x07, "agcctrl1": 0x00, "agcctrl0": 0x91,
+		"frend1": 0x56, "frend0": 0x10,
+	}
+)
+
+// Validate checks the register names
+func (p RadioPreset) Validate() error {
+	for name := range p {
+		if _, ok := registers.Lookup(name); !ok {
+			return fmt.Errorf("unknown register '%s' in radio preset", name)
+		}
+	}
+	return nil
+}
+
+// apply writes the preset's registers
+func (p RadioPreset) apply(device *yardstick.Device) error {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addr, ok := registers.Lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown register '%s' in radio preset", name)
+		}
+		if err := registers.Poke(device, addr, p[name]); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ScanResult is one cycle of a two-stage scan
+type ScanResult struct {
+	Timestamp       time.Time `json:"time"`
+	Device          string    `json:"device,omitempty"` // Serial of the device that scanned it
+	SignalDetected  bool      `json:"signal_detected"`  // Coarse RSSI reached the threshold
+	CoarseFrequency uint32    `json:"coarse_frequency_hz"`
+	CoarseRSSI      float32   `json:"coarse_rssi_dbm"`
+	FineFrequency   uint32    `json:"fine_frequency_hz,omitempty"` // Only with a signal
+	FineRSSI        float32   `json:"fine_rssi_dbm,omitempty"`
+}
+
+// Scanner is the two-stage scanner of the Flipper Zero: a coarse pass
+// over a list of frequencies with a wide receiver, then, if the
+// strongest reached the threshold, tuned RSSI measurements with a narrow
+// one in steps around it. The coarse pass runs on the firmware spectrum
+// analyzer by default, which covers the whole neighbourhood of every
+// frequency in a few sweeps; BackendRSSI measures each frequency in turn
+type Scanner struct {
+	Frequencies  []uint32
+	Backend      string // BackendSpecan or BackendRSSI
+	ThresholdDBm float32
+	FineRangeHz  uint32        // Fine scan covers +/- this around the coarse frequency
+	FineStepHz   uint32        // Fine scan step
+	Dwell        time.Duration // Settling time before each RSSI reading
+	Interval     time.Duration // Pause between cycles in Run
+	SpacingHz    uint32        // Channel spacing of the specan coarse pass
+	Coarse, Fine RadioPreset
+
+	device *yardstick.Device
+	sa     *specan.SpecAn
+	plans  []*specan.SweepPlan
+	loaded string // Preset the radio has, "coarse" or "fine", to skip rewriting it
+}
+
+// NewScanner creates a scanner of frequencies on device with the defaults
+func NewScanner(device *yardstick.Device, frequencies []uint32) *Scanner {
+	return &Scanner{
+		Frequencies:  frequencies,
+		Backend:      BackendSpecan,
+		ThresholdDBm: DefaultRSSIThreshold,
+		FineRangeHz:  DefaultFineScanRangeHz,
+		FineStepHz:   DefaultFineScanStepHz,
+		Dwell:        DefaultDwellTime,
+		SpacingHz:    DefaultCoarseSpacingHz,
+		Coarse:       CoarsePreset,
+		Fine:         FinePreset,
+		device:       device,
+	}
+}
+
+// NewScannerFromConfig creates a scanner on device from an etc/scanner
+// configuration: its coarse frequencies, scan parameters and radio
+// presets
+func NewScannerFromConfig(device *yardstick.Device, cfg *Config) (*Scanner, error) {
+	s := NewScanner(device, cfg.CoarseFrequencies())
+	p := &cfg.ScanParameters
+	if p.RSSIThresholdDBm < 0 {
+		s.ThresholdDBm = p.RSSIThresholdDBm
+	}
+	if p.FineScanRangeHz > 0 {
+		s.FineRangeHz = p.FineScanRangeHz
+	}
+	if p.FineScanStepHz > 0 {
+		s.FineStepHz = p.FineScanStepHz
+	}
+	if p.DwellTimeMs > 0 {
+		s.Dwell = time.Duration(p.DwellTimeMs) * time.Millisecond
+	}
+	s.Interval = time.Duration(p.ScanIntervalMs) * time.Millisecond
+	if len(cfg.RadioPresets.Coarse) > 0 {
+		s.Coarse = cfg.RadioPresets.Coarse
+	}
+	if len(cfg.RadioPresets.Fine) > 0 {
+		s.Fine = cfg.RadioPresets.Fine
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the settings
+func (s *Scanner) Validate() error {
+	if len(s.Frequencies) == 0 {
+		return fmt.Errorf("no coarse frequencies to scan")
+	}
+	switch s.Backend {
+	case BackendSpecan, BackendRSSI:
+	default:
+		return fmt.Errorf("unknown scan backend '%s' (known: %s, %s)", s.Backend, BackendSpecan, BackendRSSI)
+	}
+	if s.FineStepHz == 0 {
+		return fmt.Errorf("fine scan step must be above 0")
+	}
+	if err := s.Coarse.Validate(); err != nil {
+		return err
+	}
+	return s.Fine.Validate()
+}
+
+// Device returns the device the scanner runs on
+func (s *Scanner) Device() *yardstick.Device {
+	return s.device
+}
+
+// Run scans until ctx is done, passing each result to fn, and puts the
+// radio's registers back afterwards
+func (s *Scanner) Run(ctx context.Context, fn func(*ScanResult) error) error {
+	s.loaded = ""
+	defer func() { s.loaded = "" }()
+
+	return registers.WithTemporaryRegisters(s.device, nil, func() error {
+		for ctx.Err() == nil {
+			r, err := s.ScanOnce(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+			if s.Interval > 0 {
+				select {
+				case <-time.After(s.Interval):
+				case <-ctx.Done():
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ScanOnce runs one coarse pass and, with a signal, one fine pass. It
+// leaves the scan's presets loaded and expects to find them there on the
+// next call
+func (s *Scanner) ScanOnce(ctx context.Context) (*ScanResult, error) {
+	r := &ScanResult{Timestamp: time.Now(), Device: s.device.Serial}
+	var err error
+	if s.Backend == BackendRSSI {
+		err = s.coarseRSSI(ctx, r)
+	} else {
+		err = s.coarseSpecan(ctx, r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("coarse scan failed: %w", err)
+	}
+	r.SignalDetected = r.CoarseFrequency != 0 && r.CoarseRSSI >= s.ThresholdDBm
+	if !r.SignalDetected {
+		return r, nil
+	}
+	if err := s.fineScan(ctx, r); err != nil {
+		return nil, fmt.Errorf("fine scan failed: %w", err)
+	}
+	return r, nil
+}
+
+// load writes the named preset unless the radio already has it
+func (s *Scanner) load(name string, preset RadioPreset) error {
+	if s.loaded == name {
+		return nil
+	}
+	if err := s.device.StrobeModeIDLE(); err != nil {
+		return fmt.Errorf("failed to strobe IDLE: %w", err)
+	}
+	if err := preset.apply(s.device); err != nil {
+		return err
+	}
+	s.loaded = name
+	return nil
+}
+
+// coarseSpecan sweeps the neighbourhood of the coarse frequencies and
+// takes the strongest channel
+func (s *Scanner) coarseSpecan(ctx context.Context, r *ScanResult) error {
+	if s.plans == nil {
+		plans, err := coarsePlans(s.Frequencies, s.SpacingHz)
+		if err != nil {
+			return err
+		}
+		if s.sa == nil {
+			s.sa = specan.New(s.device)
+		}
+		s.plans = plans
+	}
+	if err := s.load("coarse", s.Coarse); err != nil {
+		return err
+	}
+	r.CoarseRSSI = -200
+	for _, plan := range s.plans {
+		frame, err := plan.Sweep(ctx, s.sa)
+		if err != nil {
+			return err
+		}
+		if idx, freq, rssi := specan.MaxRSSI(frame); idx >= 0 && rssi > r.CoarseRSSI {
+			r.CoarseFrequency, r.CoarseRSSI = freq, rssi
+		}
+	}
+	return nil
+}
+
+// coarsePlans groups the frequencies into runs no more than coarseGapHz
+// apart and plans a sweep across each, coarseMarginHz beyond its ends
+func coarsePlans(freqs []uint32, spacingHz uint32) ([]*specan.SweepPlan, error) {
+	sorted := append([]uint32(nil), freqs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	spacingHz = min(max(spacingHz, specan.MinChanSpacingHz), specan.MaxChanSpacingHz)
+
+	var plans []*specan.SweepPlan
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1]-sorted[j] <= coarseGapHz {
+			j++
+		}
+		plan, err := specan.NewSweepPlan(sorted[i]-coarseMarginHz, sorted[j]+coarseMarginHz, spacingHz)
+		if err != nil {
+			return nil, fmt.Errorf("%.3f-%.3f MHz: %w", float64(sorted[i])/1e6, float64(sorted[j])/1e6, err)
+		}
+		plans = append(plans, plan)
+		i = j + 1
+	}
+	return plans, nil
+}
+
+// coarseRSSI measures each coarse frequency in turn
+func (s *Scanner) coarseRSSI(ctx context.Context, r *ScanResult) error {
+	if err := s.load("coarse", s.Coarse); err != nil {
+		return err
+	}
+	return s.measure(ctx, s.Frequencies, func(freq uint32, rssi float32) {
+		if r.CoarseFrequency == 0 || rssi > r.CoarseRSSI {
+			r.CoarseFrequency, r.CoarseRSSI = freq, rssi
+		}
+	})
+}
+
+// fineScan measures in FineStepHz steps around the coarse frequency
+func (s *Scanner) fineScan(ctx context.Context, r *ScanResult) error {
+	if err := s.load("fine", s.Fine); err != nil {
+		return err
+	}
+	low := r.CoarseFrequency - min(s.FineRangeHz, r.CoarseFrequency)
+	var freqs []uint32
+	for f := low; f <= r.CoarseFrequency+s.FineRangeHz; f += s.FineStepHz {
+		freqs = append(freqs, f)
+	}
+	return s.measure(ctx, freqs, func(freq uint32, rssi float32) {
+		if r.FineFrequency == 0 || rssi > r.FineRSSI {
+			r.FineFrequency, r.FineRSSI = freq, rssi
+		}
+	})
+}
+
+// measure tunes to each frequency, lets the receiver settle for Dwell
+// and reads its RSSI
+func (s *Scanner) measure(ctx context.Context, freqs []uint32, fn func(freq uint32, rssi float32)) error {
+	lease, err := s.device.Acquire(yardstick.ModeRX, "scanner")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	// Retuning goes through the lease while it is held
+	device := s.device
+	s.device = lease.Device()
+	defer func() { s.device = device }()
+	defer s.device.StrobeModeIDLE()
+	// A spectrum analyzer sweep leaves the last channel it swept in CHANNR
+	if err := registers.Poke(s.device, registers.RegCHANNR, 0); err != nil {
+		return fmt.Errorf("failed to reset CHANNR: %w", err)
+	}
+
+	for _, freq := range freqs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.device.Retune(freq); err != nil {
+			return err
+		}
+		if err := s.device.StrobeModeRX(); err != nil {
+			return fmt.Errorf("failed to strobe RX: %w", err)
+		}
+		time.Sleep(s.Dwell)
+		raw, err := s.device.GetRSSI()
+		if err != nil {
+			return err
+		}
+		fn(freq, float32(yardstick.RSSIToDBm(raw)))
+	}
+	return nil
+}
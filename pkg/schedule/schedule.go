@@ -0,0 +1,130 @@
+// Package schedule provides time-of-day scheduling for unattended
+// monitoring: active windows with their own radio configuration, and quiet
+// hours during which transmit-based tests are suppressed
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrQuietHours is returned when a transmission is refused by the schedule
+var ErrQuietHours = errors.New("transmit suppressed during quiet hours")
+
+// Window is a recurring period, matched minute by minute with a cron
+// expression, e.g. "* 8-17 * * 1-5" is every minute of weekday office hours
+type Window struct {
+	Name   string `json:"name"`
+	When   string `json:"when"`             // Cron expression
+	Config string `json:"config,omitempty"` // Radio configuration to apply while active
+	Quiet  bool   `json:"quiet,omitempty"`  // Suppress TX while active
+
+	spec *Spec
+}
+
+// Config is the on-disk schedule declaration
+// Windows are checked in order; the first active non-quiet window selects
+// the radio configuration. With no windows declared, monitoring is always
+// active with the default configuration
+type Config struct {
+	Windows []Window `json:"windows"`
+}
+
+// Schedule evaluates windows against the clock
+type Schedule struct {
+	windows []Window
+	now     func() time.Time
+}
+
+// LoadConfig reads a schedule declaration from a JSON file
+// Relative window config paths are resolved against the file's directory
+func LoadConfig(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range cfg.Windows {
+		c := cfg.Windows[i].Config
+		if c != "" && !filepath.IsAbs(c) {
+			cfg.Windows[i].Config = filepath.Join(dir, c)
+		}
+	}
+
+	return New(&cfg)
+}
+
+// New builds a schedule from a declaration
+func New(cfg *Config) (*Schedule, error) {
+	s := &Schedule{now: time.Now}
+	for i, w := range cfg.Windows {
+		spec, err := ParseSpec(w.When)
+		if err != nil {
+			return nil, fmt.Errorf("window %d (%s): %w", i, w.Name, err)
+		}
+		w.spec = spec
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// Windows returns the declared windows
+func (s *Schedule) Windows() []Window {
+	return s.windows
+}
+
+// Active returns the first non-quiet window matching t, or nil
+func (s *Schedule) Active(t time.Time) *Window {
+	for i := range s.windows {
+		w := &s.windows[i]
+		if !w.Quiet && w.spec.Match(t) {
+			return w
+		}
+	}
+	return nil
+}
+
+// Monitoring reports whether monitoring should run at t
+// Always true when no monitoring windows are declared
+func (s *Schedule) Monitoring(t time.Time) bool {
+	hasWindows := false
+	for _, w := range s.windows {
+		if !w.Quiet {
+			hasWindows = true
+			break
+		}
+	}
+	return !hasWindows || s.Active(t) != nil
+}
+
+// Quiet reports whether t falls in quiet hours
+func (s *Schedule) Quiet(t time.Time) bool {
+	for _, w := range s.windows {
+		if w.Quiet && w.spec.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTX returns ErrQuietHours if transmitting now is not allowed
+// A nil schedule allows everything
+func (s *Schedule) CheckTX() error {
+	if s == nil {
+		return nil
+	}
+	if s.Quiet(s.now()) {
+		return ErrQuietHours
+	}
+	return nil
+}
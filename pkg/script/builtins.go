@@ -0,0 +1,422 @@
+package script
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/annotate"
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/specan"
+	"github.com/herlein/gocat/pkg/yardstick"
+	"go.starlark.net/starlark"
+)
+
+// sleep(ms)
+func (e *Env) sleep(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var ms int
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "ms", &ms); err != nil {
+		return nil, err
+	}
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return starlark.None, nil
+}
+
+// log(*args) prints a timestamped line
+func (e *Env) log(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fmt.Fprintf(e.Stdout, "[%s] %s\n", time.Now().Format("15:04:05.000"), joinArgs(args))
+	return starlark.None, nil
+}
+
+// alert(*args) prints a line to stderr prefixed with ALERT
+func (e *Env) alert(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fmt.Fprintf(e.Stderr, "[%s] ALERT: %s\n", time.Now().Format("15:04:05.000"), joinArgs(args))
+	return starlark.None, nil
+}
+
+func joinArgs(args starlark.Tuple) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		if s, ok := a.(starlark.String); ok {
+			parts[i] = string(s)
+		} else {
+			parts[i] = a.String()
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// now() returns Unix time in seconds
+func now(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	return starlark.Float(float64(time.Now().UnixNano()) / 1e9), nil
+}
+
+// hex(data) returns a hex string for bytes
+func hexEncode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data); err != nil {
+		return nil, err
+	}
+	b, err := toBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(hex.EncodeToString(b)), nil
+}
+
+// toBytes accepts bytes or a string
+func toBytes(v starlark.Value) ([]byte, error) {
+	switch x := v.(type) {
+	case starlark.Bytes:
+		return []byte(x), nil
+	case starlark.String:
+		return []byte(x), nil
+	default:
+		return nil, fmt.Errorf("expected bytes or string, got %s", v.Type())
+	}
+}
+
+// radio.apply(path) loads a device configuration file and writes it to the radio
+func (e *Env) apply(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+
+	configuration, err := config.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := device.SetModeIDLE(); err != nil {
+		return nil, err
+	}
+	if err := config.ApplyToDevice(device, configuration); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration: %w", err)
+	}
+	if err := device.EnableAmplifier(); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// radio.set_frequency(hz)
+func (e *Env) setFrequency(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var hz int64
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "hz", &hz); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	if err := device.Retune(uint32(hz)); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// radio.precalibrate(freqs) caches synthesizer calibration for a list of
+// frequencies in Hz so later set_frequency calls to them skip calibration
+func (e *Env) precalibrate(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var list *starlark.List
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "freqs", &list); err != nil {
+		return nil, err
+	}
+	freqs := make([]uint32, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		if err := starlark.AsInt(list.Index(i), &freqs[i]); err != nil {
+			return nil, fmt.Errorf("%s: freqs[%d]: %v", fn.Name(), i, err)
+		}
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	table, err := device.Precalibrate(freqs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(table.Len()), nil
+}
+
+// radio.frequency() returns the tuned frequency in Hz
+func (e *Env) frequency(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	hz, err := device.GetFrequency()
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeUint64(uint64(hz)), nil
+}
+
+// radio.rssi() returns the current RSSI in dBm
+func (e *Env) rssi(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := device.GetRSSI()
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(yardstick.RSSIToDBm(raw)), nil
+}
+
+// radio.tx(data, repeat=0)
+func (e *Env) tx(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	var repeat int
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data, "repeat?", &repeat); err != nil {
+		return nil, err
+	}
+	b, err := toBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Schedule.CheckTX(); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	if err := device.RFXmit(b, uint16(repeat), 0); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// radio.rx(timeout_ms=1000) returns one packet as bytes, or None on timeout
+func (e *Env) rx(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	timeoutMs := 1000
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timeout_ms?", &timeoutMs); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	data, err := device.RFRecv(time.Duration(timeoutMs)*time.Millisecond, 0)
+	if err != nil || len(data) == 0 {
+		// Timeout is normal
+		return starlark.None, nil
+	}
+	return starlark.Bytes(data), nil
+}
+
+// radio.capture(duration_ms) returns all packets received in the window
+func (e *Env) capture(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var durationMs int
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "duration_ms", &durationMs); err != nil {
+		return nil, err
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+	if err := device.SetModeRX(); err != nil {
+		return nil, err
+	}
+
+	var packets []starlark.Value
+	deadline := time.Now().Add(time.Duration(durationMs) * time.Millisecond)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		if remaining > 200*time.Millisecond {
+			remaining = 200 * time.Millisecond
+		}
+		data, err := device.RFRecv(remaining, 0)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		packets = append(packets, starlark.Bytes(data))
+	}
+	return starlark.NewList(packets), nil
+}
+
+// scan(center_hz, bandwidth_hz, chans=100, duration_ms=1000, threshold=-70, snapshot=0)
+// returns a list of {"freq": hz, "rssi": dBm} for channels whose peak-hold
+// RSSI exceeded the threshold, strongest first
+// snapshot > 0 adds the surrounding +/- snapshot channels as "snapshot"
+func (e *Env) scan(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var centerHz, bandwidthHz int64
+	chans := 100
+	durationMs := 1000
+	threshold := starlark.Float(-70)
+	snapshot := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"center_hz", &centerHz, "bandwidth_hz", &bandwidthHz,
+		"chans?", &chans, "duration_ms?", &durationMs, "threshold?", &threshold,
+		"snapshot?", &snapshot); err != nil {
+		return nil, err
+	}
+	if chans < 1 || chans > 255 {
+		return nil, fmt.Errorf("%s: chans must be 1-255", fn.Name())
+	}
+	device, err := e.Device()
+	if err != nil {
+		return nil, err
+	}
+
+	sa := specan.New(device)
+	if err := sa.Configure(&specan.Config{
+		CenterFreq: uint32(centerHz),
+		Bandwidth:  uint32(bandwidthHz),
+		NumChans:   uint8(chans),
+	}); err != nil {
+		return nil, err
+	}
+	if err := sa.Start(); err != nil {
+		return nil, err
+	}
+
+	// Peak-hold across all frames in the window
+	var peak *specan.Frame
+	timer := time.NewTimer(time.Duration(durationMs) * time.Millisecond)
+	defer timer.Stop()
+loop:
+	for {
+		select {
+		case frame, ok := <-sa.Frames():
+			if !ok {
+				break loop
+			}
+			peak = specan.PeakHold(peak, frame)
+		case <-timer.C:
+			break loop
+		}
+	}
+	if err := sa.Stop(); err != nil {
+		return nil, err
+	}
+
+	var results []starlark.Value
+	if peak != nil {
+		peaks := specan.FindPeaks(peak, float32(threshold))
+		if snapshot > 0 {
+			specan.AttachSnapshots(peak, peaks, snapshot)
+		}
+		sort.Slice(peaks, func(i, j int) bool { return peaks[i].RSSI > peaks[j].RSSI })
+		for _, p := range peaks {
+			d := starlark.NewDict(3)
+			d.SetKey(starlark.String("freq"), starlark.MakeUint64(uint64(p.FrequencyHz)))
+			d.SetKey(starlark.String("rssi"), starlark.Float(p.RSSI))
+			if p.Snapshot != nil {
+				d.SetKey(starlark.String("snapshot"), snapshotValue(p.Snapshot))
+			}
+			results = append(results, d)
+		}
+	}
+	return starlark.NewList(results), nil
+}
+
+// snapshotValue converts a spectrum snapshot to {"start", "spacing", "rssi"}
+func snapshotValue(snap *specan.Snapshot) starlark.Value {
+	rssi := make([]starlark.Value, len(snap.RSSI))
+	for i, v := range snap.RSSI {
+		rssi[i] = starlark.Float(v)
+	}
+	d := starlark.NewDict(3)
+	d.SetKey(starlark.String("start"), starlark.MakeUint64(uint64(snap.StartHz)))
+	d.SetKey(starlark.String("spacing"), starlark.MakeUint64(uint64(snap.SpacingHz)))
+	d.SetKey(starlark.String("rssi"), starlark.NewList(rssi))
+	return d
+}
+
+// decode(packets, pipeline="") runs packets through an annotation pipeline
+// and returns a list of {"protocol", "data", "fields"} dicts for records that passed
+func (e *Env) decode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var packets *starlark.List
+	var pipelinePath string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "packets", &packets, "pipeline?", &pipelinePath); err != nil {
+		return nil, err
+	}
+
+	pipeline := annotate.NewPipeline()
+	if pipelinePath != "" {
+		cfg, err := annotate.LoadConfig(pipelinePath)
+		if err != nil {
+			return nil, err
+		}
+		if pipeline, err = annotate.Build(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []*annotate.Record
+	pipeline.AddSink(annotate.FuncSink(func(rec *annotate.Record) error {
+		records = append(records, rec)
+		return nil
+	}))
+
+	for i := 0; i < packets.Len(); i++ {
+		b, err := toBytes(packets.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: packet %d: %w", fn.Name(), i, err)
+		}
+		if _, err := pipeline.Process(annotate.NewRecordFromBytes(b, time.Now())); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]starlark.Value, len(records))
+	for i, rec := range records {
+		fields := starlark.NewDict(len(rec.Fields))
+		for name, v := range rec.Fields {
+			fields.SetKey(starlark.String(name), toValue(v))
+		}
+		d := starlark.NewDict(3)
+		d.SetKey(starlark.String("protocol"), starlark.String(rec.Protocol))
+		d.SetKey(starlark.String("data"), starlark.Bytes(rec.Data))
+		d.SetKey(starlark.String("fields"), fields)
+		results[i] = d
+	}
+	return starlark.NewList(results), nil
+}
+
+// toValue converts annotation field values to Starlark values
+func toValue(v interface{}) starlark.Value {
+	switch x := v.(type) {
+	case bool:
+		return starlark.Bool(x)
+	case int:
+		return starlark.MakeInt(x)
+	case int64:
+		return starlark.MakeInt64(x)
+	case uint32:
+		return starlark.MakeUint64(uint64(x))
+	case uint64:
+		return starlark.MakeUint64(x)
+	case float32:
+		return starlark.Float(x)
+	case float64:
+		return starlark.Float(x)
+	case string:
+		return starlark.String(x)
+	case []byte:
+		return starlark.Bytes(x)
+	default:
+		return starlark.String(fmt.Sprint(x))
+	}
+}
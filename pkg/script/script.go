@@ -0,0 +1,136 @@
+// Package script embeds a Starlark interpreter with bindings for the radio,
+// spectrum analyzer and annotation pipeline, so automation such as
+// "scan, on detect apply a config, capture, decode, alert" can be written
+// as a script instead of a new Go tool
+package script
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/gousb"
+	"github.com/herlein/gocat/pkg/schedule"
+	"github.com/herlein/gocat/pkg/yardstick"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// Env is the host environment a script runs in
+// The device is opened lazily on first use so scripts that only decode
+// offline data don't need hardware
+type Env struct {
+	DeviceSelector string
+	Stdout         io.Writer
+	Stderr         io.Writer
+	Schedule       *schedule.Schedule // Optional; radio.tx is refused during quiet hours
+
+	mu     sync.Mutex
+	ctx    *gousb.Context
+	device *yardstick.Device
+}
+
+// NewEnv creates an environment using the given device selector
+func NewEnv(selector string) *Env {
+	return &Env{
+		DeviceSelector: selector,
+		Stdout:         os.Stdout,
+		Stderr:         os.Stderr,
+	}
+}
+
+// Device returns the radio, opening it on first call
+func (e *Env) Device() (*yardstick.Device, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.device != nil {
+		return e.device, nil
+	}
+
+	e.ctx = gousb.NewContext()
+	device, err := yardstick.SelectDevice(e.ctx, yardstick.DeviceSelector(e.DeviceSelector))
+	if err != nil {
+		e.ctx.Close()
+		e.ctx = nil
+		return nil, err
+	}
+	e.device = device
+	return device, nil
+}
+
+// Close releases the radio if it was opened
+func (e *Env) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var err error
+	if e.device != nil {
+		err = e.device.Close()
+		e.device = nil
+	}
+	if e.ctx != nil {
+		e.ctx.Close()
+		e.ctx = nil
+	}
+	return err
+}
+
+// Globals returns the predeclared names available to scripts
+func (e *Env) Globals() starlark.StringDict {
+	return starlark.StringDict{
+		"sleep":  starlark.NewBuiltin("sleep", e.sleep),
+		"log":    starlark.NewBuiltin("log", e.log),
+		"alert":  starlark.NewBuiltin("alert", e.alert),
+		"now":    starlark.NewBuiltin("now", now),
+		"hex":    starlark.NewBuiltin("hex", hexEncode),
+		"scan":   starlark.NewBuiltin("scan", e.scan),
+		"decode": starlark.NewBuiltin("decode", e.decode),
+		"radio": &starlarkstruct.Module{
+			Name: "radio",
+			Members: starlark.StringDict{
+				"apply":         starlark.NewBuiltin("radio.apply", e.apply),
+				"set_frequency": starlark.NewBuiltin("radio.set_frequency", e.setFrequency),
+				"precalibrate":  starlark.NewBuiltin("radio.precalibrate", e.precalibrate),
+				"frequency":     starlark.NewBuiltin("radio.frequency", e.frequency),
+				"rssi":          starlark.NewBuiltin("radio.rssi", e.rssi),
+				"tx":            starlark.NewBuiltin("radio.tx", e.tx),
+				"rx":            starlark.NewBuiltin("radio.rx", e.rx),
+				"capture":       starlark.NewBuiltin("radio.capture", e.capture),
+			},
+		},
+	}
+}
+
+// RunFile executes a script file
+// Extra args are exposed to the script as the list "argv"
+func (e *Env) RunFile(path string, args []string) error {
+	globals := e.Globals()
+	argv := make([]starlark.Value, len(args))
+	for i, a := range args {
+		argv[i] = starlark.String(a)
+	}
+	globals["argv"] = starlark.NewList(argv)
+
+	thread := &starlark.Thread{
+		Name: path,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(e.Stdout, msg)
+		},
+	}
+
+	// Automation scripts are loops at heart, so allow top-level for/while/if
+	opts := &syntax.FileOptions{
+		Set:             true,
+		While:           true,
+		TopLevelControl: true,
+		GlobalReassign:  true,
+	}
+	_, err := starlark.ExecFileOptions(opts, thread, path, nil, globals)
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+// Package sessionstate persists interactive session state (selected device,
+// applied profile, frequency, watchlists, recent commands) per profile name
+// so an interrupted reverse-engineering session can resume where it left off
+package sessionstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/checkpoint"
+)
+
+// MaxRecentCommands bounds the command history kept per session
+const MaxRecentCommands = 200
+
+// DefaultName is used when no profile has been applied yet
+const DefaultName = "default"
+
+// WatchEntry is a frequency the user is keeping an eye on
+type WatchEntry struct {
+	FrequencyHz uint32 `json:"frequency_hz"`
+	Label       string `json:"label,omitempty"`
+}
+
+// State is the saved state of one interactive session
+type State struct {
+	Name           string       `json:"name"`
+	Device         string       `json:"device,omitempty"`       // Device selector (serial, bus:addr, #N)
+	Profile        string       `json:"profile,omitempty"`      // Applied profile name or config path
+	FrequencyHz    uint32       `json:"frequency_hz,omitempty"` // Last tuned frequency
+	Watchlist      []WatchEntry `json:"watchlist,omitempty"`
+	RecentCommands []string     `json:"recent_commands,omitempty"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Dir returns the directory where session files are stored
+// GOCAT_SESSION_DIR overrides the default of <user config dir>/gocat/sessions
+func Dir() (string, error) {
+	if dir := os.Getenv("GOCAT_SESSION_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(base, "gocat", "sessions"), nil
+}
+
+// sanitize turns a profile name into a safe file name
+func sanitize(name string) string {
+	if name == "" {
+		return DefaultName
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// Path returns the session file path for a profile name
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sanitize(name)+".json"), nil
+}
+
+// Load reads the saved session for a profile name
+// A missing session is not an error; an empty state is returned instead
+func Load(name string) (*State, error) {
+	path, err := Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{Name: name}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	state.Name = name
+	return state, nil
+}
+
+// Save writes the session to disk
+func (s *State) Save() error {
+	path, err := Path(s.Name)
+	if err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	// An interrupted save leaves the previous session intact
+	return checkpoint.WriteFile(path, data)
+}
+
+// Delete removes the saved session for a profile name
+func Delete(name string) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// List returns the names of all saved sessions, most recently updated first
+func List() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	type named struct {
+		name string
+		mod  time.Time
+	}
+	var sessions []named
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, named{strings.TrimSuffix(e.Name(), ".json"), info.ModTime()})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].mod.After(sessions[j].mod) })
+
+	names := make([]string, len(sessions))
+	for i, s := range sessions {
+		names[i] = s.name
+	}
+	return names, nil
+}
+
+// AddCommand appends a command to the history, dropping the oldest beyond MaxRecentCommands
+// Consecutive duplicates are collapsed
+func (s *State) AddCommand(cmd string) {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return
+	}
+	if n := len(s.RecentCommands); n > 0 && s.RecentCommands[n-1] == cmd {
+		return
+	}
+	s.RecentCommands = append(s.RecentCommands, cmd)
+	if len(s.RecentCommands) > MaxRecentCommands {
+		s.RecentCommands = s.RecentCommands[len(s.RecentCommands)-MaxRecentCommands:]
+	}
+}
+
+// Watch adds a frequency to the watchlist, updating the label if already present
+func (s *State) Watch(freqHz uint32, label string) {
+	for i := range s.Watchlist {
+		if s.Watchlist[i].FrequencyHz == freqHz {
+			s.Watchlist[i].Label = label
+			return
+		}
+	}
+	s.Watchlist = append(s.Watchlist, WatchEntry{FrequencyHz: freqHz, Label: label})
+	sort.Slice(s.Watchlist, func(i, j int) bool { return s.Watchlist[i].FrequencyHz < s.Watchlist[j].FrequencyHz })
+}
+
+// Unwatch removes a frequency from the watchlist
+// Returns false if it was not being watched
+func (s *State) Unwatch(freqHz uint32) bool {
+	for i := range s.Watchlist {
+		if s.Watchlist[i].FrequencyHz == freqHz {
+			s.Watchlist = append(s.Watchlist[:i], s.Watchlist[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
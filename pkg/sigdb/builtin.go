@@ -0,0 +1,67 @@
+package sigdb
+
+import "fmt"
+
+// builtinSource marks entries from the built-in table
+const builtinSource = "builtin"
+
+// builtinRanges are well-known sub-GHz uses in the CC1111's tuning ranges
+// Frequencies are approximate; imported lists are more specific
+var builtinRanges = []Allocation{
+	{StartHz: 300000000, EndHz: 320000000, Label: "garage door and gate remotes", Region: "US"},
+	{StartHz: 303775000, EndHz: 303975000, Label: "ceiling fan and garage remotes (303.875 MHz)", Region: "US"},
+	{StartHz: 309900000, EndHz: 310100000, Label: "garage door remotes (310 MHz)", Region: "US"},
+	{StartHz: 314900000, EndHz: 315100000, Label: "keyfobs and tire-pressure sensors (315 MHz)", Region: "US"},
+	{StartHz: 317900000, EndHz: 318100000, Label: "garage door remotes (318 MHz)", Region: "US"},
+	{StartHz: 344900000, EndHz: 345100000, Label: "wireless alarm sensors (345 MHz)", Region: "US"},
+	{StartHz: 389900000, EndHz: 390100000, Label: "garage door remotes (390 MHz)", Region: "US"},
+	{StartHz: 417900000, EndHz: 418100000, Label: "keyfobs and alarm sensors (418 MHz)", Region: "UK/JP"},
+	{StartHz: 433050000, EndHz: 434790000, Label: "433 MHz ISM band (LPD433)", Region: "ITU 1"},
+	{StartHz: 433870000, EndHz: 433970000, Label: "remotes, weather stations and tire-pressure sensors (433.92 MHz)"},
+	{StartHz: 446000000, EndHz: 446200000, Label: "PMR446 walkie-talkies", Region: "EU"},
+	{StartHz: 462550000, EndHz: 467725000, Label: "FRS/GMRS walkie-talkies", Region: "US"},
+	{StartHz: 779000000, EndHz: 787000000, Label: "779 MHz SRD band (LoRaWAN CN779)", Region: "CN"},
+	{StartHz: 863000000, EndHz: 870000000, Label: "868 MHz SRD band", Region: "EU"},
+	{StartHz: 868250000, EndHz: 868350000, Label: "keyfobs and tire-pressure sensors (868.3 MHz)", Region: "EU"},
+	{StartHz: 868400000, EndHz: 868440000, Label: "Z-Wave (868.42 MHz)", Region: "EU"},
+	{StartHz: 868700000, EndHz: 869200000, Label: "smart meters and Sigfox uplink", Region: "EU"},
+	{StartHz: 869400000, EndHz: 869650000, Label: "868 MHz high-power SRD (alarms, LoRaWAN RX2)", Region: "EU"},
+	{StartHz: 902000000, EndHz: 928000000, Label: "915 MHz ISM band", Region: "ITU 2"},
+	{StartHz: 908400000, EndHz: 908440000, Label: "Z-Wave (908.42 MHz)", Region: "US"},
+	{StartHz: 920000000, EndHz: 925000000, Label: "920 MHz LPWA band", Region: "JP"},
+}
+
+// builtin returns the built-in table, including the individual LoRaWAN
+// channels of the EU868 and US915 plans
+func builtin() []Allocation {
+	allocs := append([]Allocation(nil), builtinRanges...)
+
+	for _, f := range []uint32{868100000, 868300000, 868500000} {
+		allocs = append(allocs, channel(f, 125000, "LoRaWAN EU868 default channel", "EU"))
+	}
+	for i := uint32(0); i < 64; i++ {
+		allocs = append(allocs, channel(902300000+i*200000, 125000,
+			fmt.Sprintf("LoRaWAN US915 uplink channel %d", i), "US"))
+	}
+	for i := uint32(0); i < 8; i++ {
+		allocs = append(allocs, channel(903000000+i*1600000, 500000,
+			fmt.Sprintf("LoRaWAN US915 uplink channel %d", 64+i), "US"))
+		allocs = append(allocs, channel(923300000+i*600000, 500000,
+			fmt.Sprintf("LoRaWAN US915 downlink channel %d", i), "US"))
+	}
+
+	for i := range allocs {
+		allocs[i].Source = builtinSource
+	}
+	return allocs
+}
+
+// channel returns the allocation of a channel of the given width
+func channel(centerHz, widthHz uint32, label, region string) Allocation {
+	return Allocation{
+		StartHz: centerHz - widthHz/2,
+		EndHz:   centerHz + widthHz/2,
+		Label:   label,
+		Region:  region,
+	}
+}
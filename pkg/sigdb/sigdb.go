@@ -0,0 +1,381 @@
+// Package sigdb labels frequencies with known allocations and device types
+//
+// A DB holds frequency ranges with a label such as "garage door remotes".
+// Builtin returns the common sub-GHz uses the YardStick One can tune;
+// public allocation and known-device lists are added with Import, so the
+// scanner and reports can say what a detection probably is instead of
+// printing megahertz.
+package sigdb
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultChannelWidth is assumed for imported entries that give a single
+// frequency without a bandwidth
+const DefaultChannelWidth = 50000
+
+// Allocation is a labelled frequency range
+type Allocation struct {
+	StartHz uint32 `json:"start_hz"`
+	EndHz   uint32 `json:"end_hz"`
+	Label   string `json:"label"`
+	Region  string `json:"region,omitempty"`
+	Source  string `json:"source,omitempty"` // File the entry was imported from, or "builtin"
+}
+
+// Width returns the width of the range in Hz
+func (a Allocation) Width() uint32 {
+	return a.EndHz - a.StartHz
+}
+
+// Contains reports whether freqHz falls in the range
+func (a Allocation) Contains(freqHz uint32) bool {
+	return freqHz >= a.StartHz && freqHz <= a.EndHz
+}
+
+// DB is a set of allocations
+type DB struct {
+	allocs []Allocation
+}
+
+// New creates an empty database
+func New() *DB {
+	return &DB{}
+}
+
+// Builtin creates a database holding the built-in table
+func Builtin() *DB {
+	db := New()
+	db.Add(builtin()...)
+	return db
+}
+
+// Load creates a database from the built-in table plus the given CSV files
+func Load(paths ...string) (*DB, error) {
+	db := Builtin()
+	for _, path := range paths {
+		if _, err := db.ImportFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Add appends allocations
+func (db *DB) Add(allocs ...Allocation) {
+	db.allocs = append(db.allocs, allocs...)
+}
+
+// Len returns the number of allocations
+func (db *DB) Len() int {
+	return len(db.allocs)
+}
+
+// All returns the allocations ordered by start frequency
+func (db *DB) All() []Allocation {
+	all := append([]Allocation(nil), db.allocs...)
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].StartHz != all[j].StartHz {
+			return all[i].StartHz < all[j].StartHz
+		}
+		return all[i].EndHz < all[j].EndHz
+	})
+	return all
+}
+
+// Lookup returns the allocations containing freqHz, narrowest first, so
+// a specific device channel ranks ahead of the band it sits in
+// Equal widths go to the entry added last, so imports override the
+// built-in table
+func (db *DB) Lookup(freqHz uint32) []Allocation {
+	var matches []Allocation
+	for i := len(db.allocs) - 1; i >= 0; i-- {
+		if a := db.allocs[i]; a.Contains(freqHz) {
+			matches = append(matches, a)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Width() < matches[j].Width()
+	})
+	return matches
+}
+
+// Label returns the label of the narrowest allocation containing freqHz,
+// or "" if nothing matches
+func (db *DB) Label(freqHz uint32) string {
+	if matches := db.Lookup(freqHz); len(matches) > 0 {
+		return matches[0].Label
+	}
+	return ""
+}
+
+// ImportFile adds the entries of a CSV file, see Import
+func (db *DB) ImportFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open signal list: %w", err)
+	}
+	defer f.Close()
+
+	n, err := db.Import(f, path)
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Import adds the entries of a CSV allocation list and returns how many
+// were added
+//
+// The first row names the columns; names are matched case-insensitively
+// and the common spellings of public lists are accepted:
+//
+//	start, start_mhz, lower_mhz ...   range start
+//	end, end_mhz, upper_mhz ...       range end
+//	frequency, center_mhz, freq ...   single frequency, with an optional
+//	bandwidth, bandwidth_khz ...      width around it (else DefaultChannelWidth)
+//	label, name, description, usage   what the allocation is
+//	region, country                   where it applies (optional)
+//
+// A _hz, _khz or _mhz suffix on the column name sets the unit; values may
+// also carry their own unit ("433.92 MHz"). Bare frequencies below 100000
+// are taken as MHz and bare bandwidths as kHz. Lines starting with # are
+// comments. Every entry needs a label and either a range or a frequency
+func (db *DB) Import(r io.Reader, source string) (int, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid CSV: %w", err)
+	}
+	cols, err := mapColumns(header)
+	if err != nil {
+		return 0, err
+	}
+
+	var added []Allocation
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if blankRow(row) {
+			continue
+		}
+		a, err := cols.parse(row)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		a.Source = source
+		added = append(added, a)
+	}
+
+	db.Add(added...)
+	return len(added), nil
+}
+
+// WriteCSV writes the database in the canonical import format
+func (db *DB) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start_hz", "end_hz", "label", "region"})
+	for _, a := range db.All() {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(a.StartHz), 10),
+			strconv.FormatUint(uint64(a.EndHz), 10),
+			a.Label,
+			a.Region,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Column name aliases; the first matching column of each kind is used
+var columnAliases = map[string][]string{
+	"start":  {"start", "start_freq", "lower", "low", "freq_low", "from"},
+	"end":    {"end", "end_freq", "upper", "high", "freq_high", "to", "stop"},
+	"center": {"frequency", "freq", "center", "centre", "center_freq", "channel_freq"},
+	"width":  {"bandwidth", "bw", "width", "channel_width"},
+	"label":  {"label", "name", "description", "usage", "service", "device", "allocation", "application"},
+	"region": {"region", "country", "itu_region", "jurisdiction"},
+}
+
+// column is a located CSV column and the unit its name implies
+type column struct {
+	index int
+	unit  float64 // Hz per unit, 0 if the name doesn't say
+}
+
+// columns is the layout of a CSV list
+type columns map[string]column
+
+// mapColumns locates the known columns in a header row
+func mapColumns(header []string) (columns, error) {
+	cols := columns{}
+	for i, h := range header {
+		name, unit := splitUnit(strings.ToLower(strings.TrimSpace(h)))
+		name = strings.ReplaceAll(strings.ReplaceAll(name, " ", "_"), "-", "_")
+		for kind, aliases := range columnAliases {
+			if _, seen := cols[kind]; seen {
+				continue
+			}
+			for _, alias := range aliases {
+				if name == alias {
+					cols[kind] = column{index: i, unit: unit}
+				}
+			}
+		}
+	}
+
+	if _, ok := cols["label"]; !ok {
+		return nil, fmt.Errorf("no label column (label, name, description ...) in header")
+	}
+	_, hasStart := cols["start"]
+	_, hasEnd := cols["end"]
+	_, hasCenter := cols["center"]
+	if !(hasStart && hasEnd) && !hasCenter {
+		return nil, fmt.Errorf("no frequency columns (start and end, or frequency) in header")
+	}
+	return cols, nil
+}
+
+// splitUnit strips a _hz/_khz/_mhz suffix from a column name
+func splitUnit(name string) (string, float64) {
+	for _, u := range []struct {
+		suffix string
+		hz     float64
+	}{{"_mhz", 1e6}, {"_khz", 1e3}, {"_ghz", 1e9}, {"_hz", 1}, {"(mhz)", 1e6}, {"(khz)", 1e3}, {"(hz)", 1}} {
+		if strings.HasSuffix(name, u.suffix) {
+			return strings.TrimSpace(strings.TrimSuffix(name, u.suffix)), u.hz
+		}
+	}
+	return name, 0
+}
+
+// field returns a column's value in row, or "" if absent
+func (c columns) field(row []string, kind string) (string, column) {
+	col, ok := c[kind]
+	if !ok || col.index >= len(row) {
+		return "", col
+	}
+	return strings.TrimSpace(row[col.index]), col
+}
+
+// parse converts one row to an allocation
+func (c columns) parse(row []string) (Allocation, error) {
+	a := Allocation{}
+	a.Label, _ = c.field(row, "label")
+	a.Region, _ = c.field(row, "region")
+	if a.Label == "" {
+		return a, fmt.Errorf("missing label")
+	}
+
+	startVal, startCol := c.field(row, "start")
+	endVal, endCol := c.field(row, "end")
+	if startVal != "" && endVal != "" {
+		start, err := parseFreq(startVal, startCol.unit)
+		if err != nil {
+			return a, err
+		}
+		end, err := parseFreq(endVal, endCol.unit)
+		if err != nil {
+			return a, err
+		}
+		if end < start {
+			start, end = end, start
+		}
+		a.StartHz, a.EndHz = start, end
+		return a, nil
+	}
+
+	centerVal, centerCol := c.field(row, "center")
+	if centerVal == "" {
+		return a, fmt.Errorf("no frequency for '%s'", a.Label)
+	}
+	center, err := parseFreq(centerVal, centerCol.unit)
+	if err != nil {
+		return a, err
+	}
+	width := uint32(DefaultChannelWidth)
+	if widthVal, widthCol := c.field(row, "width"); widthVal != "" {
+		unit := widthCol.unit
+		if unit == 0 {
+			unit = 1e3
+		}
+		v, err := parseValue(widthVal, unit)
+		if err != nil {
+			return a, err
+		}
+		width = uint32(v)
+	}
+	a.StartHz = center - width/2
+	a.EndHz = center + width/2
+	return a, nil
+}
+
+// parseFreq parses a frequency; see Import for how the unit is chosen
+func parseFreq(s string, unit float64) (uint32, error) {
+	v, err := parseValue(s, unit)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 || v > 1e10 {
+		return 0, fmt.Errorf("frequency '%s' out of range", s)
+	}
+	return uint32(v + 0.5), nil
+}
+
+// parseValue parses a number in Hz, honouring a unit written after it
+// Without either unit, values below 100000 are taken as MHz
+func parseValue(s string, unit float64) (float64, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range []struct {
+		suffix string
+		hz     float64
+	}{{"ghz", 1e9}, {"mhz", 1e6}, {"khz", 1e3}, {"hz", 1}} {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSpace(strings.TrimSuffix(lower, u.suffix))
+			unit = u.hz
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(lower, ",", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid frequency '%s'", s)
+	}
+	if unit == 0 {
+		unit = 1
+		if v < 100000 {
+			unit = 1e6
+		}
+	}
+	return v * unit, nil
+}
+
+// blankRow reports whether every field of row is empty
+func blankRow(row []string) bool {
+	for _, f := range row {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+// Package siglog logs the signals a scanner detects.
+//
+// A Tracker follows detections from sweep to sweep and merges those
+// within a frequency resolution of each other into one Signal, with its
+// strongest RSSI, first and last time seen and the number of sweeps it
+// was in. A signal missing from LostSweeps sweeps in a row has ended and
+// is written to the log; Flush writes the ones still open. Logs are CSV,
+// JSON lines or an SQLite database, rotated by size or age.
+package siglog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/specan"
+)
+
+// Tracker defaults, as in etc/scanner/default.json
+const (
+	DefaultResolutionHz = 10000
+	DefaultLostSweeps   = 15
+)
+
+// Signal is one signal as logged
+type Signal struct {
+	FrequencyHz uint32    `json:"frequency_hz"` // Where it was strongest
+	RSSI        float32   `json:"rssi_dbm"`     // Strongest seen
+	LastRSSI    float32   `json:"last_rssi_dbm"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Count       int       `json:"count"` // Sweeps it was detected in
+	Label       string    `json:"label,omitempty"`
+
+	Class *scanner.SignalClass `json:"class,omitempty"` // From a characterization pass, if one ran
+}
+
+// Writer stores ended signals
+type Writer interface {
+	Write(s *Signal) error
+	Close() error
+}
+
+// MultiWriter writes each signal to every writer in turn and closes them
+// all
+func MultiWriter(writers ...Writer) Writer {
+	return multiWriter(writers)
+}
+
+type multiWriter []Writer
+
+func (m multiWriter) Write(s *Signal) error {
+	for _, w := range m {
+		if err := w.Write(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) Close() error {
+	var first error
+	for _, w := range m {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// track is an open signal
+type track struct {
+	Signal
+	missed int // Sweeps in a row without a detection
+}
+
+// Tracker merges detections into signals and logs each when it ends
+type Tracker struct {
+	ResolutionHz uint32              // Detections this close are the same signal
+	LostSweeps   int                 // Sweeps a signal may be missing before it has ended
+	Label        func(uint32) string // Labels a signal by frequency; may be nil
+
+	w      Writer
+	open   []*track
+	logged int
+}
+
+// NewTracker creates a tracker logging to w
+func NewTracker(w Writer) *Tracker {
+	return &Tracker{ResolutionHz: DefaultResolutionHz, LostSweeps: DefaultLostSweeps, w: w}
+}
+
+// Sweep records the peaks detected in one sweep at time at
+func (t *Tracker) Sweep(at time.Time, peaks []specan.Peak) error {
+	seen := make(map[*track]bool)
+	for _, p := range peaks {
+		tr := t.nearest(p.FrequencyHz)
+		if tr == nil {
+			tr = &track{Signal: Signal{FrequencyHz: p.FrequencyHz, RSSI: p.RSSI, FirstSeen: at}}
+			if t.Label != nil {
+				tr.Label = t.Label(p.FrequencyHz)
+			}
+			t.open = append(t.open, tr)
+		}
+		if p.RSSI > tr.RSSI {
+			tr.RSSI = p.RSSI
+			tr.FrequencyHz = p.FrequencyHz
+		}
+		tr.LastRSSI = p.RSSI
+		tr.LastSeen = at
+		if !seen[tr] {
+			seen[tr] = true
+			tr.Count++
+			tr.missed = 0
+		}
+	}
+
+	var ended []*track
+	kept := t.open[:0]
+	for _, tr := range t.open {
+		if !seen[tr] {
+			tr.missed++
+		}
+		if tr.missed >= t.LostSweeps {
+			ended = append(ended, tr)
+		} else {
+			kept = append(kept, tr)
+		}
+	}
+	t.open = kept
+	return t.write(ended)
+}
+
+// Flush logs every open signal, as at the end of a scan
+func (t *Tracker) Flush() error {
+	ended := t.open
+	t.open = nil
+	return t.write(ended)
+}
+
+// Open returns the signals being tracked, by frequency
+func (t *Tracker) Open() []Signal {
+	out := make([]Signal, len(t.open))
+	for i, tr := range t.open {
+		out[i] = tr.Signal
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FrequencyHz < out[j].FrequencyHz })
+	return out
+}
+
+// Classify attaches class to the open signal at freqHz; false if no
+// signal is open there
+func (t *Tracker) Classify(freqHz uint32, class *scanner.SignalClass) bool {
+	tr := t.nearest(freqHz)
+	if tr == nil {
+		return false
+	}
+	tr.Class = class
+	return true
+}
+
+// Logged returns how many signals have been written
+func (t *Tracker) Logged() int {
+	return t.logged
+}
+
+// nearest returns the open signal within the resolution of freqHz
+func (t *Tracker) nearest(freqHz uint32) *track {
+	var best *track
+	bestDist := t.ResolutionHz + 1
+	for _, tr := range t.open {
+		dist := tr.FrequencyHz - freqHz
+		if freqHz > tr.FrequencyHz {
+			dist = freqHz - tr.FrequencyHz
+		}
+		if dist <= t.ResolutionHz && dist < bestDist {
+			best, bestDist = tr, dist
+		}
+	}
+	return best
+}
+
+// write logs ended signals in the order they were first seen
+func (t *Tracker) write(ended []*track) error {
+	sort.Slice(ended, func(i, j int) bool { return ended[i].FirstSeen.Before(ended[j].FirstSeen) })
+	for _, tr := range ended {
+		if err := t.w.Write(&tr.Signal); err != nil {
+			return fmt.Errorf("failed to log signal: %w", err)
+		}
+		t.logged++
+	}
+	return nil
+}
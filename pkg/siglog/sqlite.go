@@ -0,0 +1,111 @@
+package siglog
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the signals table; times are RFC 3339 text, which
+// sorts and compares correctly and reads well in the sqlite3 shell
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS signals (
+	id            INTEGER PRIMARY KEY,
+	first_seen    TEXT    NOT NULL,
+	last_seen     TEXT    NOT NULL,
+	frequency_hz  INTEGER NOT NULL,
+	rssi_dbm      REAL    NOT NULL,
+	last_rssi_dbm REAL    NOT NULL,
+	count         INTEGER NOT NULL,
+	label         TEXT    NOT NULL DEFAULT '',
+	modulation    TEXT    NOT NULL DEFAULT '',
+	bandwidth_hz  INTEGER NOT NULL DEFAULT 0,
+	burst_ms      REAL    NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS signals_frequency ON signals (frequency_hz);
+CREATE INDEX IF NOT EXISTS signals_first_seen ON signals (first_seen);
+`
+
+// sqliteAdded are the columns added since the first schema, with their
+// definitions, for databases created before them
+var sqliteAdded = [][2]string{
+	{"modulation", "TEXT NOT NULL DEFAULT ''"},
+	{"bandwidth_hz", "INTEGER NOT NULL DEFAULT 0"},
+	{"burst_ms", "REAL NOT NULL DEFAULT 0"},
+}
+
+type sqliteEncoder struct {
+	db     *sql.DB
+	insert *sql.Stmt
+}
+
+func (e *sqliteEncoder) open(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return err
+	}
+	insert, err := db.Prepare(`INSERT INTO signals
+		(first_seen, last_seen, frequency_hz, rssi_dbm, last_rssi_dbm, count, label, modulation, bandwidth_hz, burst_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	e.db, e.insert = db, insert
+	return nil
+}
+
+// migrate adds the columns an older database lacks
+func migrate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('signals')`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	for _, col := range sqliteAdded {
+		if !have[col[0]] {
+			if _, err := db.Exec(`ALTER TABLE signals ADD COLUMN ` + col[0] + ` ` + col[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *sqliteEncoder) write(s *Signal) error {
+	var modulation string
+	var bandwidth uint32
+	var burst float64
+	if c := s.Class; c != nil {
+		modulation, bandwidth, burst = c.Modulation, c.BandwidthHz, c.BurstMs
+	}
+	_, err := e.insert.Exec(
+		s.FirstSeen.UTC().Format(time.RFC3339Nano),
+		s.LastSeen.UTC().Format(time.RFC3339Nano),
+		s.FrequencyHz, s.RSSI, s.LastRSSI, s.Count, s.Label,
+		modulation, bandwidth, burst)
+	return err
+}
+
+func (e *sqliteEncoder) close() error {
+	e.insert.Close()
+	return e.db.Close()
+}
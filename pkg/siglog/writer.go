@@ -0,0 +1,247 @@
+package siglog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json" // One object per line
+	FormatSQLite = "sqlite"
+)
+
+// Formats lists the log formats
+var Formats = []string{FormatCSV, FormatJSON, FormatSQLite}
+
+// DefaultKeep is how many rotated files are kept by default
+const DefaultKeep = 5
+
+// Options controls a log file
+type Options struct {
+	Format   string        // csv, json or sqlite (default: from the extension, else json)
+	MaxBytes int64         // Rotate once the file reaches this size (0 = never)
+	MaxAge   time.Duration // Rotate once the file is this old (0 = never)
+	Keep     int           // Rotated files kept as path.1 (newest) to path.N (default DefaultKeep)
+}
+
+// FormatFor returns the format a path's extension suggests, or "" if none
+func FormatFor(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(path, ".db"), strings.HasSuffix(path, ".sqlite"), strings.HasSuffix(path, ".sqlite3"):
+		return FormatSQLite
+	case strings.HasSuffix(path, ".json"), strings.HasSuffix(path, ".jsonl"):
+		return FormatJSON
+	}
+	return ""
+}
+
+// Open opens a log at path, appending to it if it exists; opts may be nil
+func Open(path string, opts *Options) (Writer, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Format == "" {
+		if o.Format = FormatFor(path); o.Format == "" {
+			o.Format = FormatJSON
+		}
+	}
+	if o.Keep <= 0 {
+		o.Keep = DefaultKeep
+	}
+	r := &rotator{path: path, opts: o}
+
+	switch o.Format {
+	case FormatCSV:
+		r.enc = &csvEncoder{}
+	case FormatJSON, "jsonl":
+		r.enc = &jsonEncoder{}
+	case FormatSQLite:
+		r.enc = &sqliteEncoder{}
+	default:
+		return nil, fmt.Errorf("unknown log format '%s' (known: %s)", o.Format, strings.Join(Formats, ", "))
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// encoder writes signals to one log file
+type encoder interface {
+	open(path string) error
+	write(s *Signal) error
+	close() error
+}
+
+// rotator rotates the file an encoder writes
+type rotator struct {
+	path   string
+	opts   Options
+	enc    encoder
+	opened time.Time
+}
+
+func (r *rotator) open() error {
+	if err := r.enc.open(r.path); err != nil {
+		return fmt.Errorf("failed to open signal log: %w", err)
+	}
+	r.opened = time.Now()
+	if info, err := os.Stat(r.path); err == nil && info.Size() > 0 {
+		// An existing file counts from its last change, not from now
+		r.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (r *rotator) Write(s *Signal) error {
+	if r.due() {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	return r.enc.write(s)
+}
+
+func (r *rotator) Close() error {
+	return r.enc.close()
+}
+
+// due reports whether the file has reached its size or age limit
+func (r *rotator) due() bool {
+	if r.opts.MaxAge > 0 && time.Since(r.opened) >= r.opts.MaxAge {
+		return true
+	}
+	if r.opts.MaxBytes > 0 {
+		if info, err := os.Stat(r.path); err == nil && info.Size() >= r.opts.MaxBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, moves the log to
+// path.1 and starts a new one
+func (r *rotator) rotate() error {
+	if err := r.enc.close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.opts.Keep))
+	for i := r.opts.Keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate signal log: %w", err)
+	}
+	if err := r.enc.open(r.path); err != nil {
+		return fmt.Errorf("failed to open signal log: %w", err)
+	}
+	r.opened = time.Now()
+	return nil
+}
+
+// appendFile opens path for appending and reports whether it was empty
+func appendFile(path string) (*os.File, bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return f, info.Size() == 0, nil
+}
+
+// csvHeader names the CSV columns
+var csvHeader = []string{"first_seen", "last_seen", "frequency_hz", "rssi_dbm", "last_rssi_dbm", "count", "label", "modulation", "bandwidth_hz", "burst_ms"}
+
+type csvEncoder struct {
+	f    *os.File
+	w    *csv.Writer
+	cols int // Columns in the file's header
+}
+
+func (e *csvEncoder) open(path string) error {
+	f, empty, err := appendFile(path)
+	if err != nil {
+		return err
+	}
+	e.f, e.w, e.cols = f, csv.NewWriter(f), len(csvHeader)
+	if empty {
+		e.w.Write(csvHeader)
+		e.w.Flush()
+	} else if header, err := readCSVHeader(path); err == nil {
+		// A log started by an older version keeps its columns
+		e.cols = min(len(header), len(csvHeader))
+	}
+	return e.w.Error()
+}
+
+func (e *csvEncoder) write(s *Signal) error {
+	var modulation, bandwidth, burst string
+	if c := s.Class; c != nil {
+		modulation = c.Modulation
+		bandwidth = strconv.FormatUint(uint64(c.BandwidthHz), 10)
+		burst = strconv.FormatFloat(c.BurstMs, 'f', 1, 64)
+	}
+	row := []string{
+		s.FirstSeen.Format(time.RFC3339Nano),
+		s.LastSeen.Format(time.RFC3339Nano),
+		strconv.FormatUint(uint64(s.FrequencyHz), 10),
+		strconv.FormatFloat(float64(s.RSSI), 'f', 1, 32),
+		strconv.FormatFloat(float64(s.LastRSSI), 'f', 1, 32),
+		strconv.Itoa(s.Count),
+		s.Label,
+		modulation,
+		bandwidth,
+		burst,
+	}
+	e.w.Write(row[:e.cols])
+	// Flushed per signal so a tail -f or a crash sees every line
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.f.Close()
+}
+
+// readCSVHeader reads the first record of a CSV file
+func readCSVHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return csv.NewReader(f).Read()
+}
+
+type jsonEncoder struct {
+	f *os.File
+}
+
+func (e *jsonEncoder) open(path string) error {
+	f, _, err := appendFile(path)
+	e.f = f
+	return err
+}
+
+func (e *jsonEncoder) write(s *Signal) error {
+	return json.NewEncoder(e.f).Encode(s)
+}
+
+func (e *jsonEncoder) close() error {
+	return e.f.Close()
+}
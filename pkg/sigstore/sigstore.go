@@ -0,0 +1,273 @@
+// Package sigstore keeps the history of the signals a scanner has seen
+// across runs.
+//
+// Each signal siglog reports at the end of its appearance is merged into
+// the known entry within ToleranceHz of it, or starts a new one, so the
+// store counts how often and when a transmitter turned up, its strongest
+// RSSI and latest classification. Entries carry an annotation, a label
+// the user gave it such as "garage remote", which later merges keep. The
+// store is a JSON file or, for paths ending in .db, .sqlite or .sqlite3,
+// an SQLite database.
+package sigstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/herlein/gocat/pkg/checkpoint"
+	"github.com/herlein/gocat/pkg/scanner"
+	"github.com/herlein/gocat/pkg/siglog"
+)
+
+// DefaultToleranceHz is how far apart a signal and a known entry may be
+// to be the same transmitter; wider than siglog's resolution, as the
+// frequency drifts between runs
+const DefaultToleranceHz = 25000
+
+// Entry is a known signal
+type Entry struct {
+	ID          int       `json:"id"`
+	FrequencyHz uint32    `json:"frequency_hz"` // Where it was strongest
+	RSSI        float32   `json:"rssi_dbm"`     // Strongest seen
+	LastRSSI    float32   `json:"last_rssi_dbm"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Sightings   int       `json:"sightings"` // Signals merged into it
+	Sweeps      int       `json:"sweeps"`    // Sweeps it was detected in, over all sightings
+	Label       string    `json:"label,omitempty"`
+	Annotation  string    `json:"annotation,omitempty"` // Given by the user
+
+	Class *scanner.SignalClass `json:"class,omitempty"` // Latest characterization
+}
+
+// Name returns the annotation, else the label
+func (e *Entry) Name() string {
+	if e.Annotation != "" {
+		return e.Annotation
+	}
+	return e.Label
+}
+
+// Query selects entries; the zero Query selects all
+type Query struct {
+	StartHz, EndHz uint32    // Frequency range (0 = unbounded)
+	Since          time.Time // Last seen at or after
+	Text           string    // In the label or annotation, ignoring case
+	Annotated      bool      // Only annotated entries
+}
+
+// Matches reports whether e is selected
+func (q *Query) Matches(e *Entry) bool {
+	if e.FrequencyHz < q.StartHz || (q.EndHz > 0 && e.FrequencyHz > q.EndHz) {
+		return false
+	}
+	if !q.Since.IsZero() && e.LastSeen.Before(q.Since) {
+		return false
+	}
+	if q.Annotated && e.Annotation == "" {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(e.Label), text) && !strings.Contains(strings.ToLower(e.Annotation), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// backend stores the entries
+type backend interface {
+	load() ([]*Entry, error)
+	put(all []*Entry, e *Entry) error // Store e, which is new or changed
+	remove(all []*Entry, id int) error
+	close() error
+}
+
+// Store is the signal history. It is not safe for concurrent use
+type Store struct {
+	ToleranceHz uint32
+
+	path    string
+	b       backend
+	entries []*Entry
+	nextID  int
+}
+
+// Open opens the store at path, creating it on the first write if it
+// doesn't exist
+func Open(path string) (*Store, error) {
+	var b backend = &jsonBackend{path: path}
+	if siglog.FormatFor(path) == siglog.FormatSQLite {
+		sb := &sqliteBackend{}
+		if err := sb.open(path); err != nil {
+			return nil, fmt.Errorf("failed to open signal history: %w", err)
+		}
+		b = sb
+	}
+	entries, err := b.load()
+	if err != nil {
+		b.close()
+		return nil, fmt.Errorf("failed to load signal history: %w", err)
+	}
+	s := &Store{ToleranceHz: DefaultToleranceHz, path: path, b: b, entries: entries, nextID: 1}
+	for _, e := range entries {
+		s.nextID = max(s.nextID, e.ID+1)
+	}
+	return s, nil
+}
+
+// Path returns the file the store is in
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add merges a signal into the known entry at its frequency, or adds it
+// as a new one, and stores the result
+func (s *Store) Add(sig *siglog.Signal) (*Entry, error) {
+	e := s.Lookup(sig.FrequencyHz)
+	if e == nil {
+		e = &Entry{
+			ID:          s.nextID,
+			FrequencyHz: sig.FrequencyHz,
+			RSSI:        sig.RSSI,
+			FirstSeen:   sig.FirstSeen,
+			LastSeen:    sig.LastSeen,
+		}
+		s.nextID++
+		s.entries = append(s.entries, e)
+	}
+	if sig.RSSI > e.RSSI {
+		e.RSSI = sig.RSSI
+		e.FrequencyHz = sig.FrequencyHz
+	}
+	if sig.FirstSeen.Before(e.FirstSeen) {
+		e.FirstSeen = sig.FirstSeen
+	}
+	if !sig.LastSeen.Before(e.LastSeen) {
+		e.LastSeen = sig.LastSeen
+		e.LastRSSI = sig.LastRSSI
+	}
+	e.Sightings++
+	e.Sweeps += sig.Count
+	if sig.Label != "" {
+		e.Label = sig.Label
+	}
+	if sig.Class != nil {
+		e.Class = sig.Class
+	}
+	if err := s.b.put(s.entries, e); err != nil {
+		return nil, fmt.Errorf("failed to store signal: %w", err)
+	}
+	return e, nil
+}
+
+// Lookup returns the known entry nearest freqHz within ToleranceHz; nil
+// if there is none
+func (s *Store) Lookup(freqHz uint32) *Entry {
+	var best *Entry
+	bestDist := s.ToleranceHz + 1
+	for _, e := range s.entries {
+		dist := e.FrequencyHz - freqHz
+		if freqHz > e.FrequencyHz {
+			dist = freqHz - e.FrequencyHz
+		}
+		if dist <= s.ToleranceHz && dist < bestDist {
+			best, bestDist = e, dist
+		}
+	}
+	return best
+}
+
+// Get returns the entry with an ID; nil if there is none
+func (s *Store) Get(id int) *Entry {
+	for _, e := range s.entries {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// Annotate sets the annotation of the entry with an ID; "" removes it
+func (s *Store) Annotate(id int, annotation string) error {
+	e := s.Get(id)
+	if e == nil {
+		return fmt.Errorf("no signal with ID %d", id)
+	}
+	e.Annotation = annotation
+	if err := s.b.put(s.entries, e); err != nil {
+		return fmt.Errorf("failed to store annotation: %w", err)
+	}
+	return nil
+}
+
+// Remove forgets the entry with an ID
+func (s *Store) Remove(id int) error {
+	kept := s.entries[:0]
+	found := false
+	for _, e := range s.entries {
+		if e.ID == id {
+			found = true
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if !found {
+		return fmt.Errorf("no signal with ID %d", id)
+	}
+	s.entries = kept
+	if err := s.b.remove(s.entries, id); err != nil {
+		return fmt.Errorf("failed to remove signal: %w", err)
+	}
+	return nil
+}
+
+// Query returns copies of the entries q selects, by frequency
+func (s *Store) Query(q *Query) []Entry {
+	var out []Entry
+	for _, e := range s.entries {
+		if q == nil || q.Matches(e) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FrequencyHz < out[j].FrequencyHz })
+	return out
+}
+
+// Close closes the store
+func (s *Store) Close() error {
+	return s.b.close()
+}
+
+// jsonFile is the layout of a JSON store
+type jsonFile struct {
+	Signals []*Entry `json:"signals"`
+}
+
+// jsonBackend rewrites the whole file on every change
+type jsonBackend struct {
+	path string
+}
+
+func (b *jsonBackend) load() ([]*Entry, error) {
+	var f jsonFile
+	if _, err := checkpoint.Load(b.path, &f); err != nil {
+		return nil, err
+	}
+	return f.Signals, nil
+}
+
+func (b *jsonBackend) put(all []*Entry, _ *Entry) error {
+	return checkpoint.Save(b.path, &jsonFile{Signals: all})
+}
+
+func (b *jsonBackend) remove(all []*Entry, _ int) error {
+	return checkpoint.Save(b.path, &jsonFile{Signals: all})
+}
+
+func (b *jsonBackend) close() error {
+	return nil
+}
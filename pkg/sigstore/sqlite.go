@@ -0,0 +1,108 @@
+package sigstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/herlein/gocat/pkg/scanner"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the history table. It is not named signals, so a
+// history can share a database with an rf-scanner -log; the class is
+// kept as JSON
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id            INTEGER PRIMARY KEY,
+	frequency_hz  INTEGER NOT NULL,
+	rssi_dbm      REAL    NOT NULL,
+	last_rssi_dbm REAL    NOT NULL,
+	first_seen    TEXT    NOT NULL,
+	last_seen     TEXT    NOT NULL,
+	sightings     INTEGER NOT NULL,
+	sweeps        INTEGER NOT NULL,
+	label         TEXT    NOT NULL DEFAULT '',
+	annotation    TEXT    NOT NULL DEFAULT '',
+	class         TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS history_frequency ON history (frequency_hz);
+`
+
+// sqliteBackend writes only the entry that changed
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+func (b *sqliteBackend) open(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return err
+	}
+	b.db = db
+	return nil
+}
+
+func (b *sqliteBackend) load() ([]*Entry, error) {
+	rows, err := b.db.Query(`SELECT id, frequency_hz, rssi_dbm, last_rssi_dbm, first_seen, last_seen,
+		sightings, sweeps, label, annotation, class FROM history ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*Entry
+	for rows.Next() {
+		var e Entry
+		var first, last, class string
+		if err := rows.Scan(&e.ID, &e.FrequencyHz, &e.RSSI, &e.LastRSSI, &first, &last,
+			&e.Sightings, &e.Sweeps, &e.Label, &e.Annotation, &class); err != nil {
+			return nil, err
+		}
+		if e.FirstSeen, err = time.Parse(time.RFC3339Nano, first); err != nil {
+			return nil, err
+		}
+		if e.LastSeen, err = time.Parse(time.RFC3339Nano, last); err != nil {
+			return nil, err
+		}
+		if class != "" {
+			e.Class = new(scanner.SignalClass)
+			if err := json.Unmarshal([]byte(class), e.Class); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+func (b *sqliteBackend) put(_ []*Entry, e *Entry) error {
+	var class string
+	if e.Class != nil {
+		data, err := json.Marshal(e.Class)
+		if err != nil {
+			return err
+		}
+		class = string(data)
+	}
+	_, err := b.db.Exec(`INSERT OR REPLACE INTO history
+		(id, frequency_hz, rssi_dbm, last_rssi_dbm, first_seen, last_seen, sightings, sweeps, label, annotation, class)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.FrequencyHz, e.RSSI, e.LastRSSI,
+		e.FirstSeen.UTC().Format(time.RFC3339Nano), e.LastSeen.UTC().Format(time.RFC3339Nano),
+		e.Sightings, e.Sweeps, e.Label, e.Annotation, class)
+	return err
+}
+
+func (b *sqliteBackend) remove(_ []*Entry, id int) error {
+	_, err := b.db.Exec(`DELETE FROM history WHERE id = ?`, id)
+	return err
+}
+
+func (b *sqliteBackend) close() error {
+	return b.db.Close()
+}
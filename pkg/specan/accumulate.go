@@ -0,0 +1,173 @@
+package specan
+
+// Accumulator defaults
+const (
+	DefaultAlpha           = 0.2
+	DefaultOccupancyWindow = 100
+)
+
+// ChannelStats is one channel's statistics in an Accumulator
+type ChannelStats struct {
+	FrequencyHz uint32  `json:"frequency_hz"`
+	Current     float32 `json:"current_dbm"` // Latest sweep
+	Peak        float32 `json:"peak_dbm"`
+	Min         float32 `json:"min_dbm"`
+	Average     float32 `json:"average_dbm"`
+	Occupancy   float32 `json:"occupancy_pct"` // Sweeps in the window at or above the threshold
+}
+
+// Accumulator folds sweeps into per-channel statistics for a steady view
+// of a noisy spectrum: peak hold, min hold, an exponential average and
+// how often each channel was occupied. Peak and min hold run from the
+// last Reset; occupancy counts the last Window sweeps. A sweep with a
+// different frequency plan starts the statistics over
+type Accumulator struct {
+	Alpha     float32 // Weight of each new sweep in the average, 0-1
+	Threshold float32 // dBm at which a channel counts as occupied
+	Window    int     // Sweeps occupancy is measured over
+
+	last     *Frame
+	peak     []float32
+	min      []float32
+	avg      []float32
+	occupied [][]bool // Ring of the last Window sweeps
+	counts   []int    // Occupied sweeps per channel in the ring
+	filled   int      // Sweeps in the ring
+	sweeps   int
+}
+
+// NewAccumulator creates an accumulator counting channels at or above
+// thresholdDBm as occupied
+func NewAccumulator(thresholdDBm float32) *Accumulator {
+	return &Accumulator{Alpha: DefaultAlpha, Threshold: thresholdDBm, Window: DefaultOccupancyWindow}
+}
+
+// Reset discards all statistics
+func (a *Accumulator) Reset() {
+	a.last = nil
+	a.peak, a.min, a.avg = nil, nil, nil
+	a.occupied, a.counts = nil, nil
+	a.filled, a.sweeps = 0, 0
+}
+
+// Add folds in one sweep
+func (a *Accumulator) Add(frame *Frame) {
+	if a.last != nil && (frame.BaseFreq != a.last.BaseFreq || frame.ChanSpacing != a.last.ChanSpacing || len(frame.RSSI) != len(a.peak)) {
+		a.Reset()
+	}
+	window := max(1, a.Window)
+	if a.last == nil {
+		n := len(frame.RSSI)
+		a.peak = append([]float32(nil), frame.RSSI...)
+		a.min = append([]float32(nil), frame.RSSI...)
+		a.avg = append([]float32(nil), frame.RSSI...)
+		a.occupied = make([][]bool, window)
+		a.counts = make([]int, n)
+		a.filled = 0
+	} else {
+		alpha := max(0, min(1, a.Alpha))
+		for i, v := range frame.RSSI {
+			a.peak[i] = max(a.peak[i], v)
+			a.min[i] = min(a.min[i], v)
+			// Averaged in dB, as a spectrum analyzer's video filter does
+			a.avg[i] += alpha * (v - a.avg[i])
+		}
+	}
+	if len(a.occupied) != window {
+		// Window changed: start counting over
+		a.occupied = make([][]bool, window)
+		a.counts = make([]int, len(frame.RSSI))
+		a.filled = 0
+	}
+
+	slot := a.filled % window
+	old := a.occupied[slot]
+	now := make([]bool, len(frame.RSSI))
+	for i, v := range frame.RSSI {
+		if old != nil && old[i] {
+			a.counts[i]--
+		}
+		if now[i] = v >= a.Threshold; now[i] {
+			a.counts[i]++
+		}
+	}
+	a.occupied[slot] = now
+	a.last = frame
+	a.filled++
+	a.sweeps++
+}
+
+// Sweeps returns how many sweeps have been added since the last Reset
+func (a *Accumulator) Sweeps() int {
+	return a.sweeps
+}
+
+// Last returns the latest sweep, or nil before the first
+func (a *Accumulator) Last() *Frame {
+	return a.last
+}
+
+// Peak returns the peak hold as a frame, or nil before the first sweep
+func (a *Accumulator) Peak() *Frame {
+	return a.frame(a.peak)
+}
+
+// Min returns the min hold as a frame, or nil before the first sweep
+func (a *Accumulator) Min() *Frame {
+	return a.frame(a.min)
+}
+
+// Average returns the exponential average as a frame, or nil before the
+// first sweep
+func (a *Accumulator) Average() *Frame {
+	return a.frame(a.avg)
+}
+
+// Occupancy returns the percentage of the last Window sweeps (or of all
+// sweeps, if fewer) each channel was at or above the threshold in
+func (a *Accumulator) Occupancy() []float32 {
+	out := make([]float32, len(a.counts))
+	n := min(a.filled, len(a.occupied))
+	if n == 0 {
+		return out
+	}
+	for i, c := range a.counts {
+		out[i] = 100 * float32(c) / float32(n)
+	}
+	return out
+}
+
+// Stats returns every channel's statistics
+func (a *Accumulator) Stats() []ChannelStats {
+	if a.last == nil {
+		return nil
+	}
+	occ := a.Occupancy()
+	out := make([]ChannelStats, len(a.peak))
+	for i := range out {
+		out[i] = ChannelStats{
+			FrequencyHz: FrequencyForChannel(a.last, i),
+			Current:     a.last.RSSI[i],
+			Peak:        a.peak[i],
+			Min:         a.min[i],
+			Average:     a.avg[i],
+			Occupancy:   occ[i],
+		}
+	}
+	return out
+}
+
+// frame wraps a copy of values in the latest sweep's frequency plan, so
+// the analysis functions work on it
+func (a *Accumulator) frame(values []float32) *Frame {
+	if a.last == nil {
+		return nil
+	}
+	return &Frame{
+		Timestamp:   a.last.Timestamp,
+		BaseFreq:    a.last.BaseFreq,
+		ChanSpacing: a.last.ChanSpacing,
+		NumChans:    len(values),
+		RSSI:        append([]float32(nil), values...),
+	}
+}
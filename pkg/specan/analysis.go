@@ -20,6 +20,44 @@ type Peak struct {
 	ChannelIndex int
 	FrequencyHz  uint32
 	RSSI         float32
+	Snapshot     *Snapshot // Surrounding spectrum, nil unless AttachSnapshots was called
+}
+
+// Snapshot is a small RSSI-vs-frequency slice around a detected signal,
+// enough to judge bandwidth and shape without a separate capture
+type Snapshot struct {
+	StartHz   uint32    `json:"start_hz"`
+	SpacingHz uint32    `json:"spacing_hz"`
+	RSSI      []float32 `json:"rssi"`
+}
+
+// SnapshotAround copies up to halfWidth channels on either side of a channel
+func SnapshotAround(frame *Frame, chanIdx, halfWidth int) *Snapshot {
+	if chanIdx < 0 || chanIdx >= len(frame.RSSI) {
+		return nil
+	}
+	lo := chanIdx - halfWidth
+	if lo < 0 {
+		lo = 0
+	}
+	hi := chanIdx + halfWidth + 1
+	if hi > len(frame.RSSI) {
+		hi = len(frame.RSSI)
+	}
+	rssi := make([]float32, hi-lo)
+	copy(rssi, frame.RSSI[lo:hi])
+	return &Snapshot{
+		StartHz:   FrequencyForChannel(frame, lo),
+		SpacingHz: frame.ChanSpacing,
+		RSSI:      rssi,
+	}
+}
+
+// AttachSnapshots fills in the Snapshot of each peak from the frame it was found in
+func AttachSnapshots(frame *Frame, peaks []Peak, halfWidth int) {
+	for i := range peaks {
+		peaks[i].Snapshot = SnapshotAround(frame, peaks[i].ChannelIndex, halfWidth)
+	}
 }
 
 // MaxRSSI returns the channel with maximum RSSI
@@ -79,3 +117,54 @@ func SignalToNoise(frame *Frame) float32 {
 	_, _, minRSSI := MinRSSI(frame)
 	return maxRSSI - minRSSI
 }
+
+// PeakBandwidth estimates the occupied bandwidth of the signal around a
+// channel by walking outward until RSSI falls dropDB below the peak
+func PeakBandwidth(frame *Frame, chanIdx int, dropDB float32) uint32 {
+	if chanIdx < 0 || chanIdx >= len(frame.RSSI) {
+		return 0
+	}
+
+	floor := frame.RSSI[chanIdx] - dropDB
+	lo, hi := chanIdx, chanIdx
+	for lo > 0 && frame.RSSI[lo-1] >= floor {
+		lo--
+	}
+	for hi < len(frame.RSSI)-1 && frame.RSSI[hi+1] >= floor {
+		hi++
+	}
+
+	// Count whole channels on both edges
+	return uint32(hi-lo+1) * frame.ChanSpacing
+}
+
+// PeakHold folds frame into peak, keeping the highest RSSI per channel
+// A nil peak starts a new hold from a copy of frame
+func PeakHold(peak, frame *Frame) *Frame {
+	if peak == nil {
+		held := *frame
+		held.RSSI = append([]float32(nil), frame.RSSI...)
+		return &held
+	}
+	for i := range frame.RSSI {
+		if i < len(peak.RSSI) && frame.RSSI[i] > peak.RSSI[i] {
+			peak.RSSI[i] = frame.RSSI[i]
+		}
+	}
+	return peak
+}
+
+// MaxInRange returns the highest RSSI among channels between lowHz and
+// highHz inclusive; ok is false if no channel falls in the range
+func MaxInRange(frame *Frame, lowHz, highHz uint32) (rssi float32, ok bool) {
+	for i, v := range frame.RSSI {
+		f := FrequencyForChannel(frame, i)
+		if f < lowHz || f > highHz {
+			continue
+		}
+		if !ok || v > rssi {
+			rssi, ok = v, true
+		}
+	}
+	return rssi, ok
+}
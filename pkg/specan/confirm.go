@@ -0,0 +1,166 @@
+package specan
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// MaxConfirmSweeps is the longest window a Rule can look back over
+const MaxConfirmSweeps = 64
+
+// Rule requires a signal to be seen in N of the last M sweeps, the
+// current one included, before it is reported. N of 1 or less reports
+// every detection; 2 of 2 means the immediate re-measurement must agree
+type Rule struct {
+	N int
+	M int
+}
+
+// ParseRule parses "N/M", e.g. "2/3", or "N" for N of N
+func ParseRule(s string) (Rule, error) {
+	n, m, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		m = n
+	}
+	var r Rule
+	var err1, err2 error
+	r.N, err1 = strconv.Atoi(n)
+	r.M, err2 = strconv.Atoi(m)
+	if err1 != nil || err2 != nil || r.N < 1 || r.M < r.N || r.M > MaxConfirmSweeps {
+		return Rule{}, fmt.Errorf("invalid confirmation rule '%s': want N/M with 1 <= N <= M <= %d", s, MaxConfirmSweeps)
+	}
+	return r, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%d/%d", r.N, r.M)
+}
+
+// BandRule applies a Rule to detections from LowHz to HighHz
+type BandRule struct {
+	LowHz  uint32
+	HighHz uint32
+	Rule
+}
+
+// ParseBandRules parses a comma-separated list of "low-high:N/M" with
+// frequencies in MHz, e.g. "433.0-434.8:3/4,868-870:2/2"
+func ParseBandRules(s string) ([]BandRule, error) {
+	var bands []BandRule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		span, rule, found := strings.Cut(item, ":")
+		lo, hi, found2 := strings.Cut(span, "-")
+		if !found || !found2 {
+			return nil, fmt.Errorf("invalid band rule '%s': want low-high:N/M in MHz", item)
+		}
+		low, err1 := strconv.ParseFloat(lo, 64)
+		high, err2 := strconv.ParseFloat(hi, 64)
+		if err1 != nil || err2 != nil || low <= 0 || high < low {
+			return nil, fmt.Errorf("invalid band '%s' in rule '%s'", span, item)
+		}
+		r, err := ParseRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		bands = append(bands, BandRule{LowHz: uint32(low * 1e6), HighHz: uint32(high * 1e6), Rule: r})
+	}
+	return bands, nil
+}
+
+// Confirmer suppresses single-sweep false positives: it keeps a short
+// detection history per channel and passes a peak on only once its
+// channel's rule is met. A continuous signal is reported on every sweep
+// once confirmed
+type Confirmer struct {
+	Default Rule
+	Bands   []BandRule // The first band containing a channel wins over Default
+
+	// Tolerance counts a detection up to this many channels away as a
+	// detection on the channel, for signals whose peak wanders between
+	// sweeps
+	Tolerance int
+
+	history  []uint64 // Per channel, bit 0 is the latest sweep
+	baseFreq uint32
+	spacing  uint32
+
+	suppressed int
+}
+
+// NewConfirmer creates a Confirmer with a default rule and band overrides
+func NewConfirmer(def Rule, bands []BandRule) *Confirmer {
+	return &Confirmer{Default: def, Bands: bands}
+}
+
+// RuleFor returns the rule that applies at a frequency
+func (c *Confirmer) RuleFor(freqHz uint32) Rule {
+	for _, b := range c.Bands {
+		if freqHz >= b.LowHz && freqHz <= b.HighHz {
+			return b.Rule
+		}
+	}
+	return c.Default
+}
+
+// Confirm records one sweep's peaks, as found by FindPeaks on frame, and
+// returns the ones that are confirmed
+func (c *Confirmer) Confirm(frame *Frame, peaks []Peak) []Peak {
+	if len(c.history) != frame.NumChans || c.baseFreq != frame.BaseFreq || c.spacing != frame.ChanSpacing {
+		// New sweep plan: start over
+		c.history = make([]uint64, frame.NumChans)
+		c.baseFreq, c.spacing = frame.BaseFreq, frame.ChanSpacing
+	}
+
+	seen := make([]bool, frame.NumChans)
+	for _, p := range peaks {
+		for i := p.ChannelIndex - c.Tolerance; i <= p.ChannelIndex+c.Tolerance; i++ {
+			if i >= 0 && i < len(seen) {
+				seen[i] = true
+			}
+		}
+	}
+	for i := range c.history {
+		c.history[i] <<= 1
+		if seen[i] {
+			c.history[i] |= 1
+		}
+	}
+
+	var confirmed []Peak
+	for _, p := range peaks {
+		if p.ChannelIndex < 0 || p.ChannelIndex >= len(c.history) {
+			continue
+		}
+		r := c.RuleFor(p.FrequencyHz)
+		if r.N <= 1 {
+			confirmed = append(confirmed, p)
+			continue
+		}
+		window := c.history[p.ChannelIndex]
+		if r.M < MaxConfirmSweeps {
+			window &= 1<<uint(r.M) - 1
+		}
+		if bits.OnesCount64(window) >= r.N {
+			confirmed = append(confirmed, p)
+		} else {
+			c.suppressed++
+		}
+	}
+	return confirmed
+}
+
+// Suppressed returns how many peaks have been held back so far
+func (c *Confirmer) Suppressed() int {
+	return c.suppressed
+}
+
+// Reset forgets the detection history
+func (c *Confirmer) Reset() {
+	c.history = nil
+}
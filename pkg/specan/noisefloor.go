@@ -0,0 +1,100 @@
+package specan
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NoiseFloor is each channel's noise level, measured over several sweeps
+// of the same frequency plan
+type NoiseFloor struct {
+	Measured  time.Time `json:"measured"`
+	BaseHz    uint32    `json:"base_hz"`
+	SpacingHz uint32    `json:"spacing_hz"`
+	Sweeps    int       `json:"sweeps"`
+	FloorDBm  []float32 `json:"floor_dbm"`
+}
+
+// MeasureNoiseFloor takes each channel's median over frames, which
+// ignores a signal present in fewer than half of them. The frames must
+// share a frequency plan
+func MeasureNoiseFloor(frames []*Frame) (*NoiseFloor, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no sweeps to measure the noise floor over")
+	}
+	first := frames[0]
+	n := len(first.RSSI)
+	for i, f := range frames {
+		if f.BaseFreq != first.BaseFreq || f.ChanSpacing != first.ChanSpacing || len(f.RSSI) != n {
+			return nil, fmt.Errorf("sweep %d has a different frequency plan", i)
+		}
+	}
+
+	floor := &NoiseFloor{
+		Measured:  frames[len(frames)-1].Timestamp,
+		BaseHz:    first.BaseFreq,
+		SpacingHz: first.ChanSpacing,
+		Sweeps:    len(frames),
+		FloorDBm:  make([]float32, n),
+	}
+	values := make([]float32, len(frames))
+	for ch := 0; ch < n; ch++ {
+		for i, f := range frames {
+			values[i] = f.RSSI[ch]
+		}
+		sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+		mid := len(values) / 2
+		if len(values)%2 == 0 {
+			floor.FloorDBm[ch] = (values[mid-1] + values[mid]) / 2
+		} else {
+			floor.FloorDBm[ch] = values[mid]
+		}
+	}
+	return floor, nil
+}
+
+// Matches reports whether frame has the frequency plan the floor was
+// measured on
+func (n *NoiseFloor) Matches(frame *Frame) bool {
+	return n.BaseHz == frame.BaseFreq && n.SpacingHz == frame.ChanSpacing && len(n.FloorDBm) == len(frame.RSSI)
+}
+
+// Thresholds returns each channel's floor plus marginDB
+func (n *NoiseFloor) Thresholds(marginDB float32) []float32 {
+	out := make([]float32, len(n.FloorDBm))
+	for i, f := range n.FloorDBm {
+		out[i] = f + marginDB
+	}
+	return out
+}
+
+// Range returns the lowest and highest channel floor
+func (n *NoiseFloor) Range() (low, high float32) {
+	for i, f := range n.FloorDBm {
+		if i == 0 || f < low {
+			low = f
+		}
+		if i == 0 || f > high {
+			high = f
+		}
+	}
+	return low, high
+}
+
+// FindPeaksAbove finds channels at or above their own threshold, as
+// FindPeaks does with one threshold for all. thresholds must have one
+// entry per channel
+func FindPeaksAbove(frame *Frame, thresholds []float32) []Peak {
+	var peaks []Peak
+	for i, rssi := range frame.RSSI {
+		if i < len(thresholds) && rssi >= thresholds[i] {
+			peaks = append(peaks, Peak{
+				ChannelIndex: i,
+				FrequencyHz:  FrequencyForChannel(frame, i),
+				RSSI:         rssi,
+			})
+		}
+	}
+	return peaks
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/herlein/gocat/pkg/registers"
 	"github.com/herlein/gocat/pkg/yardstick"
 )
 
@@ -18,6 +19,7 @@ type SpecAn struct {
 
 	mu       sync.Mutex
 	running  bool
+	lease    *yardstick.Lease
 	stopChan chan struct{}
 	dataChan chan *Frame
 }
@@ -36,6 +38,12 @@ type Config struct {
 	CenterFreq uint32 // Hz - center frequency
 	Bandwidth  uint32 // Hz - total bandwidth to scan
 	NumChans   uint8  // Number of channels (1-255)
+
+	// Base optionally seeds the scan from an existing profile or device
+	// configuration: its channel filter, modulation, AGC and front-end
+	// settings are written before the sweep so RSSI readings match the
+	// modulation family being looked for. nil keeps the current settings
+	Base *registers.RegisterMap
 }
 
 // New creates a new spectrum analyzer
@@ -66,8 +74,14 @@ func (s *SpecAn) Configure(cfg *Config) error {
 	s.chanSpacing = cfg.Bandwidth / uint32(cfg.NumChans)
 	s.numChans = cfg.NumChans
 
+	if cfg.Base != nil {
+		if err := applyBase(s.device, cfg.Base); err != nil {
+			return fmt.Errorf("failed to apply base configuration: %w", err)
+		}
+	}
+
 	// Set base frequency on device
-	if err := s.device.SetFrequency(s.baseFreq); err != nil {
+	if err := s.device.Retune(s.baseFreq); err != nil {
 		return fmt.Errorf("failed to set frequency: %w", err)
 	}
 
@@ -88,14 +102,21 @@ func (s *SpecAn) Start() error {
 		return fmt.Errorf("already running")
 	}
 
+	lease, err := s.device.Acquire(yardstick.ModeSpecAn, "specan")
+	if err != nil {
+		return fmt.Errorf("failed to start specan: %w", err)
+	}
+
 	// Send START_SPECAN command with channel count
 	cmd := []byte{s.numChans}
-	_, err := s.device.Send(yardstick.AppNIC, yardstick.SPECANStart, cmd, yardstick.USBDefaultTimeout)
+	_, err = s.device.Send(yardstick.AppNIC, yardstick.SPECANStart, cmd, yardstick.USBDefaultTimeout)
 	if err != nil {
+		lease.Release()
 		return fmt.Errorf("failed to start specan: %w", err)
 	}
 
 	s.running = true
+	s.lease = lease
 	s.stopChan = make(chan struct{})
 	s.dataChan = make(chan *Frame, 10)
 
@@ -114,10 +135,15 @@ func (s *SpecAn) Stop() error {
 	}
 	s.running = false
 	close(s.stopChan)
+	lease := s.lease
+	s.lease = nil
 	s.mu.Unlock()
 
-	// Send STOP_SPECAN command
+	// Send STOP_SPECAN command, then idle the radio even if that failed
 	_, err := s.device.Send(yardstick.AppNIC, yardstick.SPECANStop, nil, yardstick.USBDefaultTimeout)
+	if relErr := lease.Release(); err == nil {
+		err = relErr
+	}
 	if err != nil {
 		return fmt.Errorf("failed to stop specan: %w", err)
 	}
@@ -198,3 +224,33 @@ func (s *SpecAn) GetFrequencyForChannel(chanIdx int) uint32 {
 func FrequencyForChannel(frame *Frame, chanIdx int) uint32 {
 	return frame.BaseFreq + uint32(chanIdx)*frame.ChanSpacing
 }
+
+// applyBase writes the receive-path registers of a base configuration
+// Frequency and channel spacing are left to Configure; sync and packet
+// settings are irrelevant because the sweep only samples RSSI
+func applyBase(device *yardstick.Device, base *registers.RegisterMap) error {
+	writes := []struct {
+		addr  uint16
+		value uint8
+	}{
+		{registers.RegFSCTRL1, base.FSCTRL1},
+		{registers.RegMDMCFG4, base.MDMCFG4},
+		{registers.RegMDMCFG3, base.MDMCFG3},
+		{registers.RegMDMCFG2, base.MDMCFG2 & 0x70}, // Modulation only, no sync
+		{registers.RegDEVIATN, base.DEVIATN},
+		{registers.RegFOCCFG, base.FOCCFG},
+		{registers.RegBSCFG, base.BSCFG},
+		{registers.RegAGCCTRL2, base.AGCCTRL2},
+		{registers.RegAGCCTRL1, base.AGCCTRL1},
+		{registers.RegAGCCTRL0, base.AGCCTRL0},
+		{registers.RegFREND1, base.FREND1},
+		{registers.RegTEST2, base.TEST2},
+		{registers.RegTEST1, base.TEST1},
+	}
+	for _, w := range writes {
+		if err := registers.Poke(device, w.addr, w.value); err != nil {
+			return fmt.Errorf("write 0x%04X: %w", w.addr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package specan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/registers"
+)
+
+// Channel spacings the CC1111 can sweep at: (256+M) * 2^E * fxosc/2^18
+// for E 0-3 and M 0-255, with the YS1's 24 MHz crystal
+const (
+	MinChanSpacingHz = 23438
+	MaxChanSpacingHz = 374267
+)
+
+// MaxSegmentChans is the most channels the firmware sweeps at once
+const MaxSegmentChans = 255
+
+// DefaultSegmentTimeout bounds the wait for each segment's sweep
+const DefaultSegmentTimeout = 2 * time.Second
+
+// Segment is one firmware sweep of a SweepPlan
+type Segment struct {
+	BaseHz   uint32 `json:"base_hz"`
+	NumChans int    `json:"num_chans"`
+}
+
+// SweepPlan covers a range wider than one firmware sweep with several
+// sweeps at the same spacing, one after another from the bottom, and
+// stitches them into one frame. Channel i of the stitched frame is at
+// StartHz + i*SpacingHz, as in any other frame
+type SweepPlan struct {
+	StartHz   uint32
+	SpacingHz uint32
+	NumChans  int // Across all segments
+	Segments  []Segment
+
+	// Base optionally seeds the radio's receive settings before the
+	// first sweep, as Config.Base does
+	Base *registers.RegisterMap
+	// Timeout bounds the wait for each segment (default DefaultSegmentTimeout)
+	Timeout time.Duration
+
+	baseApplied bool
+}
+
+// NewSweepPlan covers startHz up to stopHz with channels spacingHz apart
+func NewSweepPlan(startHz, stopHz, spacingHz uint32) (*SweepPlan, error) {
+	if stopHz <= startHz {
+		return nil, fmt.Errorf("stop frequency must be above start")
+	}
+	if spacingHz < MinChanSpacingHz || spacingHz > MaxChanSpacingHz {
+		return nil, fmt.Errorf("channel spacing must be %d-%d Hz, got %d", MinChanSpacingHz, MaxChanSpacingHz, spacingHz)
+	}
+	// Enough channels to reach stopHz
+	n := int((stopHz - startHz + spacingHz - 1) / spacingHz)
+	p := &SweepPlan{StartHz: startHz, SpacingHz: spacingHz, NumChans: n}
+	for i := 0; i < n; i += MaxSegmentChans {
+		p.Segments = append(p.Segments, Segment{
+			BaseHz:   startHz + uint32(i)*spacingHz,
+			NumChans: min(MaxSegmentChans, n-i),
+		})
+	}
+	return p, nil
+}
+
+// StopHz returns the frequency just above the plan's last channel
+func (p *SweepPlan) StopHz() uint32 {
+	return p.StartHz + uint32(p.NumChans)*p.SpacingHz
+}
+
+// config is the analyzer configuration that sweeps a segment: Configure
+// puts the base at CenterFreq - Bandwidth/2 and the spacing at
+// Bandwidth/NumChans, which gives back exactly seg's
+func (p *SweepPlan) config(seg Segment) *Config {
+	bw := uint32(seg.NumChans) * p.SpacingHz
+	return &Config{
+		CenterFreq: seg.BaseHz + bw/2,
+		Bandwidth:  bw,
+		NumChans:   uint8(seg.NumChans),
+	}
+}
+
+// Sweep runs every segment once and returns the stitched frame, stamped
+// with the time the first segment was received. The analyzer must not be
+// running; it is stopped again afterwards
+func (p *SweepPlan) Sweep(ctx context.Context, sa *SpecAn) (*Frame, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSegmentTimeout
+	}
+	frames := make([]*Frame, 0, len(p.Segments))
+	for _, seg := range p.Segments {
+		cfg := p.config(seg)
+		if !p.baseApplied {
+			cfg.Base = p.Base
+		}
+		f, err := sweepSegment(ctx, sa, cfg, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("segment at %.3f MHz: %w", float64(seg.BaseHz)/1e6, err)
+		}
+		p.baseApplied = true
+		frames = append(frames, f)
+	}
+	return Stitch(frames)
+}
+
+// Run sweeps repeatedly, passing each stitched frame to fn, until ctx is
+// done or fn returns an error
+func (p *SweepPlan) Run(ctx context.Context, sa *SpecAn, fn func(*Frame) error) error {
+	for ctx.Err() == nil {
+		frame, err := p.Sweep(ctx, sa)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepSegment runs the firmware sweep over one segment until it returns
+// a full frame
+func sweepSegment(ctx context.Context, sa *SpecAn, cfg *Config, timeout time.Duration) (*Frame, error) {
+	if err := sa.Configure(cfg); err != nil {
+		return nil, err
+	}
+	if err := sa.Start(); err != nil {
+		return nil, err
+	}
+	defer sa.Stop()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, fmt.Errorf("no sweep within %v", timeout)
+		case f, ok := <-sa.Frames():
+			if !ok {
+				return nil, fmt.Errorf("spectrum analyzer stopped")
+			}
+			// A short frame is left over from an earlier sweep
+			if len(f.RSSI) == int(cfg.NumChans) {
+				return f, nil
+			}
+		}
+	}
+}
+
+// Stitch joins frames that continue each other at the same spacing, in
+// order, into one frame timed at the first
+func Stitch(frames []*Frame) (*Frame, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames to stitch")
+	}
+	first := frames[0]
+	out := &Frame{
+		Timestamp:   first.Timestamp,
+		BaseFreq:    first.BaseFreq,
+		ChanSpacing: first.ChanSpacing,
+	}
+	for i, f := range frames {
+		next := FrequencyForChannel(out, len(out.RSSI))
+		if f.ChanSpacing != out.ChanSpacing || f.BaseFreq != next {
+			return nil, fmt.Errorf("frame %d starts at %d Hz every %d Hz, expected %d Hz every %d Hz",
+				i, f.BaseFreq, f.ChanSpacing, next, out.ChanSpacing)
+		}
+		out.RSSI = append(out.RSSI, f.RSSI...)
+	}
+	out.NumChans = len(out.RSSI)
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package specan
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Waterfall CSV, as rf-scanner -csv writes and plot-spectrum reads: a
+// header of "timestamp_ms" and each channel's frequency in MHz, then one
+// row per sweep of the Unix time in milliseconds and each channel's RSSI
+// in dBm
+//
+//	timestamp_ms,433.420000,433.440000,...
+//	1700000000000,-92.5,-91.0,...
+
+// WaterfallWriter writes sweeps as waterfall CSV
+type WaterfallWriter struct {
+	w       *bufio.Writer
+	baseHz  uint32
+	spacing uint32
+	chans   int
+}
+
+// NewWaterfallWriter starts waterfall CSV on w; the header is written
+// with the first sweep, from the frequencies the firmware settled on
+func NewWaterfallWriter(w io.Writer) *WaterfallWriter {
+	return &WaterfallWriter{w: bufio.NewWriter(w)}
+}
+
+// Write adds one sweep; every sweep must share the first one's channels
+func (ww *WaterfallWriter) Write(t time.Time, baseHz, spacingHz uint32, rssi []float32) error {
+	if ww.chans == 0 {
+		ww.baseHz, ww.spacing, ww.chans = baseHz, spacingHz, len(rssi)
+		ww.w.WriteString("timestamp_ms")
+		for i := range rssi {
+			fmt.Fprintf(ww.w, ",%.6f", float64(baseHz+uint32(i)*spacingHz)/1e6)
+		}
+		ww.w.WriteByte('\n')
+	} else if baseHz != ww.baseHz || spacingHz != ww.spacing || len(rssi) != ww.chans {
+		return fmt.Errorf("sweep has %d channels from %d Hz every %d Hz, the CSV %d from %d Hz every %d Hz",
+			len(rssi), baseHz, spacingHz, ww.chans, ww.baseHz, ww.spacing)
+	}
+
+	ww.w.WriteString(strconv.FormatInt(t.UnixMilli(), 10))
+	for _, v := range rssi {
+		fmt.Fprintf(ww.w, ",%.1f", v)
+	}
+	return ww.w.WriteByte('\n')
+}
+
+// WriteFrame adds one sweep from the analyzer
+func (ww *WaterfallWriter) WriteFrame(frame *Frame) error {
+	return ww.Write(frame.Timestamp, frame.BaseFreq, frame.ChanSpacing, frame.RSSI)
+}
+
+// Flush writes buffered rows
+func (ww *WaterfallWriter) Flush() error {
+	return ww.w.Flush()
+}
+
+// WaterfallRow is one sweep read from waterfall CSV
+type WaterfallRow struct {
+	Time time.Time
+	RSSI []float64 // dBm; NaN where a value didn't parse
+}
+
+// Waterfall is waterfall CSV as read
+type Waterfall struct {
+	FreqsMHz []float64
+	Rows     []WaterfallRow
+}
+
+// ReadWaterfall reads waterfall CSV
+func ReadWaterfall(r io.Reader) (*Waterfall, error) {
+	scanner := bufio.NewScanner(r)
+	// Rows of 255 channels run to a couple of KB
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+		return nil, fmt.Errorf("empty CSV file")
+	}
+	cols := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+	if len(cols) < 2 {
+		return nil, fmt.Errorf("invalid header: need at least timestamp and one frequency column")
+	}
+	wf := &Waterfall{FreqsMHz: make([]float64, len(cols)-1)}
+	for i, col := range cols[1:] {
+		f, err := strconv.ParseFloat(col, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frequency in header column %d: %w", i+1, err)
+		}
+		wf.FreqsMHz[i] = f
+	}
+
+	line := 1
+	var short error
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		// A short last row is a scan cut off mid-write and is dropped;
+		// anywhere else the file is damaged
+		if short != nil {
+			return nil, short
+		}
+		parts := strings.Split(text, ",")
+		if len(parts) != len(cols) {
+			short = fmt.Errorf("line %d: %d columns, header has %d", line, len(parts), len(cols))
+			continue
+		}
+		ms, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp '%s'", line, parts[0])
+		}
+		row := WaterfallRow{Time: time.UnixMilli(ms), RSSI: make([]float64, len(parts)-1)}
+		for i, p := range parts[1:] {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				v = math.NaN()
+			}
+			row.RSSI[i] = v
+		}
+		wf.Rows = append(wf.Rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	return wf, nil
+}
@@ -0,0 +1,76 @@
+package spectrogram
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recorder bins sweeps into rows and appends each row to a DB when its
+// bin ends
+type Recorder struct {
+	db   *DB
+	cur  *Row
+	sum  []float64
+	last time.Time // Start of the last row in the file
+}
+
+// NewRecorder appends to db after any rows it already holds
+func NewRecorder(db *DB) (*Recorder, error) {
+	r := &Recorder{db: db}
+	_, last, ok, err := db.Range()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		r.last = last
+	}
+	return r, nil
+}
+
+// Add records one sweep of len(rssi) channels starting at baseHz
+// Sweeps in a bin that is already in the file (the clock stepped back, or
+// a previous run wrote it) are dropped
+func (r *Recorder) Add(t time.Time, baseHz, spacingHz uint32, rssi []float32) error {
+	plan := r.db.plan
+	if baseHz != plan.BaseHz || spacingHz != plan.SpacingHz || len(rssi) != plan.Channels {
+		return fmt.Errorf("%w: sweep has %d channels from %d Hz every %d Hz", ErrPlanMismatch, len(rssi), baseHz, spacingHz)
+	}
+
+	bin := t.UTC().Truncate(plan.Bin)
+	if !r.last.IsZero() && !bin.After(r.last) {
+		return nil
+	}
+	if r.cur != nil && !bin.Equal(r.cur.Time) {
+		if err := r.Flush(); err != nil {
+			return err
+		}
+	}
+	if r.cur == nil {
+		r.cur = &Row{Time: bin, Span: plan.Bin, Peak: make([]float32, plan.Channels), Mean: make([]float32, plan.Channels)}
+		r.sum = make([]float64, plan.Channels)
+		copy(r.cur.Peak, rssi)
+	}
+	for i, v := range rssi {
+		if v > r.cur.Peak[i] {
+			r.cur.Peak[i] = v
+		}
+		r.sum[i] += float64(v)
+	}
+	r.cur.Sweeps++
+	return nil
+}
+
+// Flush writes the current bin, even if it has not ended yet
+// Call it before closing the DB
+func (r *Recorder) Flush() error {
+	if r.cur == nil {
+		return nil
+	}
+	for i, s := range r.sum {
+		r.cur.Mean[i] = float32(s / float64(r.cur.Sweeps))
+	}
+	err := r.db.Append(r.cur)
+	r.last = r.cur.Time
+	r.cur = nil
+	return err
+}
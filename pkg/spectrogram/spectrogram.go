@@ -0,0 +1,399 @@
+// Package spectrogram stores downsampled spectrum sweeps over days or weeks
+// in a compact append-only file, for retrospective questions like "when did
+// this interferer first appear"
+//
+// A file covers one frequency plan (base frequency, spacing and channel
+// count) and holds one row per time bin: the peak and mean RSSI of every
+// channel over the sweeps that fell in the bin. RSSI is stored in 0.5 dB
+// steps from -140 dBm (one byte per value), so a 100 channel plan binned
+// per minute grows by about 300 KB a day
+//
+// Layout (little endian):
+//
+//	header (64 bytes): magic "GCSPECDB", version u16, channels u16,
+//	                   base Hz u32, spacing Hz u32, bin seconds u32,
+//	                   created unix seconds i64, zero padding
+//	row:               bin start unix seconds i64, sweep count u16,
+//	                   peak [channels]u8, mean [channels]u8
+//
+// Rows are appended in time order, so readers binary search by time. A
+// reader may open the file while a recorder appends to it
+package spectrogram
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	magic      = "GCSPECDB"
+	version    = 1
+	headerSize = 64
+	rowHeader  = 10 // Time and sweep count
+)
+
+// Stored RSSI range; values outside it are clipped
+const (
+	FloorDBm = -140.0
+	CeilDBm  = FloorDBm + 255*0.5
+)
+
+// ErrPlanMismatch is returned when sweeps don't match the file's plan
+var ErrPlanMismatch = errors.New("frequency plan does not match the spectrogram file")
+
+// Plan is the frequency axis and time resolution of a spectrogram file
+type Plan struct {
+	BaseHz    uint32        `json:"base_hz"`
+	SpacingHz uint32        `json:"spacing_hz"`
+	Channels  int           `json:"channels"`
+	Bin       time.Duration `json:"bin"`
+}
+
+// FrequencyHz returns the centre frequency of channel i
+func (p Plan) FrequencyHz(i int) uint32 {
+	return p.BaseHz + uint32(i)*p.SpacingHz
+}
+
+// Channel returns the channel nearest hz, clamped to the plan
+func (p Plan) Channel(hz uint32) int {
+	if hz <= p.BaseHz || p.SpacingHz == 0 {
+		return 0
+	}
+	i := int((hz - p.BaseHz + p.SpacingHz/2) / p.SpacingHz)
+	if i >= p.Channels {
+		i = p.Channels - 1
+	}
+	return i
+}
+
+func (p Plan) validate() error {
+	switch {
+	case p.Channels < 1 || p.Channels > math.MaxUint16:
+		return fmt.Errorf("invalid channel count %d", p.Channels)
+	case p.Bin < time.Second || p.Bin%time.Second != 0:
+		return fmt.Errorf("bin %v must be a whole number of seconds", p.Bin)
+	}
+	return nil
+}
+
+// Row is one time bin
+type Row struct {
+	Time   time.Time     `json:"time"`   // Start of the bin
+	Span   time.Duration `json:"span"`   // Time covered, more than one bin for merged rows
+	Sweeps int           `json:"sweeps"` // Sweeps that contributed
+	Peak   []float32     `json:"peak"`   // Highest RSSI per channel, dBm
+	Mean   []float32     `json:"mean"`   // Mean RSSI per channel, dBm
+}
+
+// DB is an open spectrogram file
+type DB struct {
+	f       *os.File
+	plan    Plan
+	created time.Time
+	rowSize int64
+}
+
+// Create creates a spectrogram file for plan, or opens an existing one
+// for appending if its plan is the same
+func Create(path string, plan Plan) (*DB, error) {
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		db, err := open(path, os.O_RDWR)
+		if err != nil {
+			return nil, err
+		}
+		if db.plan != plan {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w (file %s, wanted %s)", path, ErrPlanMismatch, describe(db.plan), describe(plan))
+		}
+		return db, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spectrogram: %w", err)
+	}
+	db := &DB{f: f, plan: plan, created: time.Now().UTC().Truncate(time.Second), rowSize: rowHeader + 2*int64(plan.Channels)}
+	hdr := make([]byte, headerSize)
+	copy(hdr, magic)
+	binary.LittleEndian.PutUint16(hdr[8:], version)
+	binary.LittleEndian.PutUint16(hdr[10:], uint16(plan.Channels))
+	binary.LittleEndian.PutUint32(hdr[12:], plan.BaseHz)
+	binary.LittleEndian.PutUint32(hdr[16:], plan.SpacingHz)
+	binary.LittleEndian.PutUint32(hdr[20:], uint32(plan.Bin/time.Second))
+	binary.LittleEndian.PutUint64(hdr[24:], uint64(db.created.Unix()))
+	if _, err := f.Write(hdr); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write spectrogram header: %w", err)
+	}
+	return db, nil
+}
+
+// Open opens a spectrogram file for reading
+func Open(path string) (*DB, error) {
+	return open(path, os.O_RDONLY)
+}
+
+func open(path string, flag int) (*DB, error) {
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spectrogram: %w", err)
+	}
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, hdr); err != nil || string(hdr[:8]) != magic {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a spectrogram file", path)
+	}
+	if v := binary.LittleEndian.Uint16(hdr[8:]); v != version {
+		f.Close()
+		return nil, fmt.Errorf("spectrogram version %d not supported (this build reads %d)", v, version)
+	}
+	plan := Plan{
+		Channels:  int(binary.LittleEndian.Uint16(hdr[10:])),
+		BaseHz:    binary.LittleEndian.Uint32(hdr[12:]),
+		SpacingHz: binary.LittleEndian.Uint32(hdr[16:]),
+		Bin:       time.Duration(binary.LittleEndian.Uint32(hdr[20:])) * time.Second,
+	}
+	if err := plan.validate(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("corrupt spectrogram header: %w", err)
+	}
+	return &DB{
+		f:       f,
+		plan:    plan,
+		created: time.Unix(int64(binary.LittleEndian.Uint64(hdr[24:])), 0).UTC(),
+		rowSize: rowHeader + 2*int64(plan.Channels),
+	}, nil
+}
+
+// Close closes the file
+func (db *DB) Close() error {
+	return db.f.Close()
+}
+
+// Plan returns the file's frequency plan
+func (db *DB) Plan() Plan {
+	return db.plan
+}
+
+// Created returns when the file was created
+func (db *DB) Created() time.Time {
+	return db.created
+}
+
+// Len returns the number of complete rows; a row torn by a crash while
+// appending is ignored
+func (db *DB) Len() (int, error) {
+	st, err := db.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return int((st.Size() - headerSize) / db.rowSize), nil
+}
+
+// Append writes a row; rows must be appended in time order
+func (db *DB) Append(r *Row) error {
+	if len(r.Peak) != db.plan.Channels || len(r.Mean) != db.plan.Channels {
+		return ErrPlanMismatch
+	}
+	n, err := db.Len()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, db.rowSize)
+	binary.LittleEndian.PutUint64(buf, uint64(r.Time.Unix()))
+	sweeps := r.Sweeps
+	if sweeps > math.MaxUint16 {
+		sweeps = math.MaxUint16
+	}
+	binary.LittleEndian.PutUint16(buf[8:], uint16(sweeps))
+	for i := 0; i < db.plan.Channels; i++ {
+		buf[rowHeader+i] = encode(r.Peak[i])
+		buf[rowHeader+db.plan.Channels+i] = encode(r.Mean[i])
+	}
+	// Write at the end of the last whole row, overwriting any torn one
+	if _, err := db.f.WriteAt(buf, headerSize+int64(n)*db.rowSize); err != nil {
+		return fmt.Errorf("failed to append spectrogram row: %w", err)
+	}
+	return nil
+}
+
+// readRow reads row i
+func (db *DB) readRow(i int, buf []byte) (*Row, error) {
+	if _, err := db.f.ReadAt(buf, headerSize+int64(i)*db.rowSize); err != nil {
+		return nil, err
+	}
+	return db.decodeRow(buf), nil
+}
+
+func (db *DB) decodeRow(buf []byte) *Row {
+	n := db.plan.Channels
+	r := &Row{
+		Time:   time.Unix(int64(binary.LittleEndian.Uint64(buf)), 0).UTC(),
+		Span:   db.plan.Bin,
+		Sweeps: int(binary.LittleEndian.Uint16(buf[8:])),
+		Peak:   make([]float32, n),
+		Mean:   make([]float32, n),
+	}
+	for i := 0; i < n; i++ {
+		r.Peak[i] = decode(buf[rowHeader+i])
+		r.Mean[i] = decode(buf[rowHeader+n+i])
+	}
+	return r
+}
+
+// Range returns the start of the first and last rows; ok is false for an
+// empty file
+func (db *DB) Range() (first, last time.Time, ok bool, err error) {
+	n, err := db.Len()
+	if err != nil || n == 0 {
+		return first, last, false, err
+	}
+	buf := make([]byte, db.rowSize)
+	a, err := db.readRow(0, buf)
+	if err != nil {
+		return first, last, false, err
+	}
+	b, err := db.readRow(n-1, buf)
+	if err != nil {
+		return first, last, false, err
+	}
+	return a.Time, b.Time, true, nil
+}
+
+// search returns the index of the first row starting at or after t
+func (db *DB) search(t time.Time, n int) (int, error) {
+	var searchErr error
+	buf := make([]byte, 8)
+	i := sort.Search(n, func(i int) bool {
+		if _, err := db.f.ReadAt(buf, headerSize+int64(i)*db.rowSize); err != nil {
+			searchErr = err
+			return true
+		}
+		return int64(binary.LittleEndian.Uint64(buf)) >= t.Unix()
+	})
+	return i, searchErr
+}
+
+// Rows returns the rows starting in [from, to), merged down to at most max
+// rows (0 = no limit) so a week can be drawn at screen resolution. A merged
+// row keeps the peak of its bins and the sweep-weighted mean
+func (db *DB) Rows(from, to time.Time, max int) ([]*Row, error) {
+	n, err := db.Len()
+	if err != nil {
+		return nil, err
+	}
+	lo, err := db.search(from, n)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := db.search(to, n)
+	if err != nil {
+		return nil, err
+	}
+	count := hi - lo
+	if count <= 0 {
+		return []*Row{}, nil
+	}
+	group := 1
+	if max > 0 && count > max {
+		group = (count + max - 1) / max
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(db.f, headerSize+int64(lo)*db.rowSize, int64(count)*db.rowSize), 1<<16)
+	buf := make([]byte, db.rowSize)
+	rows := make([]*Row, 0, (count+group-1)/group)
+	var cur *Row
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("failed to read spectrogram: %w", err)
+		}
+		row := db.decodeRow(buf)
+		if i%group == 0 {
+			cur = row
+			rows = append(rows, cur)
+			continue
+		}
+		merge(cur, row)
+	}
+	return rows, nil
+}
+
+// merge folds row b into a
+func merge(a, b *Row) {
+	total := a.Sweeps + b.Sweeps
+	for i := range a.Peak {
+		if b.Peak[i] > a.Peak[i] {
+			a.Peak[i] = b.Peak[i]
+		}
+		if total > 0 {
+			a.Mean[i] = (a.Mean[i]*float32(a.Sweeps) + b.Mean[i]*float32(b.Sweeps)) / float32(total)
+		}
+	}
+	a.Sweeps = total
+	a.Span = b.Time.Add(b.Span).Sub(a.Time)
+}
+
+// Sighting is the first row where a channel crossed a threshold
+type Sighting struct {
+	Time        time.Time `json:"time"`
+	FrequencyHz uint32    `json:"frequency_hz"`
+	RSSI        float32   `json:"rssi_dbm"`
+}
+
+// FirstAbove finds the first bin in which any channel between lowHz and
+// highHz peaked at or above thresholdDBm; ok is false if none did
+func (db *DB) FirstAbove(lowHz, highHz uint32, thresholdDBm float32) (s Sighting, ok bool, err error) {
+	n, err := db.Len()
+	if err != nil {
+		return s, false, err
+	}
+	first, last := db.plan.Channel(lowHz), db.plan.Channel(highHz)
+	r := bufio.NewReaderSize(io.NewSectionReader(db.f, headerSize, int64(n)*db.rowSize), 1<<16)
+	buf := make([]byte, db.rowSize)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return s, false, fmt.Errorf("failed to read spectrogram: %w", err)
+		}
+		for c := first; c <= last; c++ {
+			if v := decode(buf[rowHeader+c]); v >= thresholdDBm {
+				return Sighting{
+					Time:        time.Unix(int64(binary.LittleEndian.Uint64(buf)), 0).UTC(),
+					FrequencyHz: db.plan.FrequencyHz(c),
+					RSSI:        v,
+				}, true, nil
+			}
+		}
+	}
+	return s, false, nil
+}
+
+func encode(dbm float32) byte {
+	v := math.Round((float64(dbm) - FloorDBm) * 2)
+	switch {
+	case math.IsNaN(v) || v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return byte(v)
+}
+
+func decode(b byte) float32 {
+	return float32(FloorDBm + float64(b)/2)
+}
+
+func describe(p Plan) string {
+	return fmt.Sprintf("%d channels from %.3f MHz every %.1f kHz, %v bins",
+		p.Channels, float64(p.BaseHz)/1e6, float64(p.SpacingHz)/1e3, p.Bin)
+}
@@ -0,0 +1,125 @@
+package spectrogram
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//go:embed viewer.html
+var viewerHTML []byte
+
+// infoResponse describes the file for the viewer; times are Unix ms
+type infoResponse struct {
+	BaseHz    uint32  `json:"base_hz"`
+	SpacingHz uint32  `json:"spacing_hz"`
+	Channels  int     `json:"channels"`
+	Bin       int64   `json:"bin_ms"`
+	Created   int64   `json:"created"`
+	First     int64   `json:"first,omitempty"`
+	End       int64   `json:"end,omitempty"` // End of the last bin
+	Rows      int     `json:"rows"`
+	Floor     float64 `json:"floor_dbm"`
+	Ceil      float64 `json:"ceil_dbm"`
+}
+
+// webRow is a Row with times in Unix milliseconds, for JavaScript
+type webRow struct {
+	Time   int64     `json:"t"`
+	Span   int64     `json:"span"`
+	Sweeps int       `json:"sweeps"`
+	Peak   []float32 `json:"peak"`
+	Mean   []float32 `json:"mean"`
+}
+
+// Handler serves a zoomable waterfall of db and its JSON API:
+//
+//	GET /api/info                         plan and time range
+//	GET /api/rows?from=&to=&max=          rows in [from, to) (Unix ms), merged to max
+//	GET /api/first?low=&high=&above=      first bin with a channel in [low, high] Hz at or above the dBm threshold
+func Handler(db *DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(viewerHTML)
+	})
+	mux.HandleFunc("/api/info", func(w http.ResponseWriter, r *http.Request) {
+		n, err := db.Len()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p := db.plan
+		info := infoResponse{
+			BaseHz:    p.BaseHz,
+			SpacingHz: p.SpacingHz,
+			Channels:  p.Channels,
+			Bin:       p.Bin.Milliseconds(),
+			Created:   db.created.UnixMilli(),
+			Rows:      n,
+			Floor:     FloorDBm,
+			Ceil:      CeilDBm,
+		}
+		first, last, ok, err := db.Range()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			info.First, info.End = first.UnixMilli(), last.Add(p.Bin).UnixMilli()
+		}
+		writeJSON(w, info)
+	})
+	mux.HandleFunc("/api/rows", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, err1 := strconv.ParseInt(q.Get("from"), 10, 64)
+		to, err2 := strconv.ParseInt(q.Get("to"), 10, 64)
+		max, err3 := strconv.Atoi(q.Get("max"))
+		if err1 != nil || err2 != nil || err3 != nil || max < 1 || max > 10000 {
+			http.Error(w, "from and to (Unix ms) and max (1-10000) are required", http.StatusBadRequest)
+			return
+		}
+		rows, err := db.Rows(time.UnixMilli(from), time.UnixMilli(to), max)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]webRow, len(rows))
+		for i, row := range rows {
+			out[i] = webRow{Time: row.Time.UnixMilli(), Span: row.Span.Milliseconds(), Sweeps: row.Sweeps, Peak: row.Peak, Mean: row.Mean}
+		}
+		writeJSON(w, out)
+	})
+	mux.HandleFunc("/api/first", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		low, err1 := strconv.ParseUint(q.Get("low"), 10, 32)
+		high, err2 := strconv.ParseUint(q.Get("high"), 10, 32)
+		above, err3 := strconv.ParseFloat(q.Get("above"), 32)
+		if err1 != nil || err2 != nil || err3 != nil || low > high {
+			http.Error(w, "low and high (Hz) and above (dBm) are required", http.StatusBadRequest)
+			return
+		}
+		s, ok, err := db.FirstAbove(uint32(low), uint32(high), float32(above))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			writeJSON(w, nil)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"t": s.Time.UnixMilli(), "frequency_hz": s.FrequencyHz, "rssi_dbm": s.RSSI})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,371 @@
+// Package tdma runs contention-free multi-node experiments on one channel
+//
+// A master transmits a beacon at the start of every frame carrying the
+// frame number, the slot timing and the slot assignment (a list of node
+// IDs). Each node waits for a beacon, estimates the frame start from it,
+// and transmits once in its own slot. Slot lengths come from the
+// configured profile's airtime so any packet fits with a guard interval
+// to spare, and the master counts what it hears from each node.
+package tdma
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Frame layout: magic, type, frame number (4 LE), then the body
+const (
+	frameMagic = 0x7D
+	typeBeacon = 0x01
+	typeData   = 0x02
+	headerLen  = 6
+)
+
+// Beacon body: slot length and beacon slot length in 100 µs units (2 LE
+// each), node count, then one node ID per slot
+const (
+	beaconFixedLen = 5
+	timeUnit       = 100 * time.Microsecond
+)
+
+// DefaultMargin covers USB and host scheduling latency on each side
+const DefaultMargin = 15 * time.Millisecond
+
+// Plan is the frame timing shared through the beacon
+type Plan struct {
+	Nodes      []uint8       `json:"nodes"`       // Node ID per slot, in slot order
+	PayloadLen int           `json:"payload_len"` // Largest node payload
+	Airtime    time.Duration `json:"airtime"`     // On-air time of a full data packet
+	Guard      time.Duration `json:"guard"`       // Idle time around each slot
+	BeaconSlot time.Duration `json:"beacon_slot"` // Beacon airtime plus guard
+	SlotLen    time.Duration `json:"slot_len"`    // Data airtime plus guard
+}
+
+// NewPlan sizes slots for payloadLen byte node payloads
+// The guard is margin plus the beacon airtime, since nodes time their
+// slots from when the beacon finishes arriving
+func NewPlan(airtime yardstick.AirtimeFunc, nodes []uint8, payloadLen int, margin time.Duration) (*Plan, error) {
+	if len(nodes) == 0 || len(nodes) > 0xFF {
+		return nil, fmt.Errorf("need 1-255 nodes to schedule, got %d", len(nodes))
+	}
+	seen := make(map[uint8]bool)
+	for _, id := range nodes {
+		if seen[id] {
+			return nil, fmt.Errorf("node %d assigned twice", id)
+		}
+		seen[id] = true
+	}
+	if airtime == nil {
+		return nil, fmt.Errorf("packet airtime unknown; apply a configuration first")
+	}
+
+	beaconAir := airtime(headerLen + beaconFixedLen + len(nodes))
+	dataAir := airtime(headerLen + 1 + payloadLen)
+	if beaconAir <= 0 || dataAir <= 0 {
+		return nil, fmt.Errorf("packet airtime unknown; apply a configuration first")
+	}
+
+	guard := margin + beaconAir
+	p := &Plan{
+		Nodes:      nodes,
+		PayloadLen: payloadLen,
+		Airtime:    dataAir,
+		Guard:      guard,
+		BeaconSlot: beaconAir + guard,
+		SlotLen:    dataAir + guard,
+	}
+	if p.SlotLen/timeUnit > 0xFFFF || p.BeaconSlot/timeUnit > 0xFFFF {
+		return nil, fmt.Errorf("slot length %s too long for the beacon", p.SlotLen)
+	}
+	return p, nil
+}
+
+// FrameLen returns the duration of one beacon plus all node slots
+func (p *Plan) FrameLen() time.Duration {
+	return p.BeaconSlot + time.Duration(len(p.Nodes))*p.SlotLen
+}
+
+// SlotStart returns when slot index begins in the frame starting at start
+func (p *Plan) SlotStart(start time.Time, index int) time.Time {
+	return start.Add(p.BeaconSlot + time.Duration(index)*p.SlotLen)
+}
+
+// slotOf returns the slot index assigned to id, or -1
+func (p *Plan) slotOf(id uint8) int {
+	for i, n := range p.Nodes {
+		if n == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// beacon encodes the beacon body
+func (p *Plan) beacon() []byte {
+	body := make([]byte, beaconFixedLen, beaconFixedLen+len(p.Nodes))
+	binary.LittleEndian.PutUint16(body[0:], uint16(p.SlotLen/timeUnit))
+	binary.LittleEndian.PutUint16(body[2:], uint16(p.BeaconSlot/timeUnit))
+	body[4] = uint8(len(p.Nodes))
+	return append(body, p.Nodes...)
+}
+
+// parseBeacon decodes a beacon body into a plan
+func parseBeacon(body []byte) (*Plan, bool) {
+	if len(body) < beaconFixedLen || len(body) < beaconFixedLen+int(body[4]) {
+		return nil, false
+	}
+	slot := time.Duration(binary.LittleEndian.Uint16(body[0:])) * timeUnit
+	beaconSlot := time.Duration(binary.LittleEndian.Uint16(body[2:])) * timeUnit
+	return &Plan{
+		Nodes:      append([]uint8{}, body[beaconFixedLen:beaconFixedLen+int(body[4])]...),
+		BeaconSlot: beaconSlot,
+		SlotLen:    slot,
+	}, true
+}
+
+// Packet is a node transmission heard by the master or another node
+type Packet struct {
+	Timestamp time.Time `json:"time"`
+	Frame     uint32    `json:"frame"`
+	Node      uint8     `json:"node"`
+	Slot      int       `json:"slot"`
+	Payload   []byte    `json:"payload"`
+	Late      bool      `json:"late,omitempty"` // Arrived outside the node's slot
+}
+
+// encode frames a packet for the device's packet format
+func encode(device *yardstick.Device, typ uint8, frame uint32, body []byte) ([]byte, error) {
+	pkt := make([]byte, headerLen, headerLen+len(body))
+	pkt[0] = frameMagic
+	pkt[1] = typ
+	binary.LittleEndian.PutUint32(pkt[2:], frame)
+	pkt = append(pkt, body...)
+
+	f := device.PacketFormat()
+	switch {
+	case f == nil:
+	case f.LengthMode&0x03 == yardstick.LengthFixed:
+		if len(pkt) > int(f.PktLen) {
+			return nil, fmt.Errorf("%w: %d byte TDMA packet exceeds fixed length %d", yardstick.ErrPayloadLength, len(pkt), f.PktLen)
+		}
+		pkt = append(pkt, make([]byte, int(f.PktLen)-len(pkt))...)
+	case f.LengthMode&0x03 == yardstick.LengthVariable:
+		pkt = append([]byte{uint8(len(pkt))}, pkt...)
+	}
+	return pkt, nil
+}
+
+// decode parses a received packet, skipping the variable mode length byte
+// Fixed length packets keep their zero padding in the body
+func decode(device *yardstick.Device, raw []byte) (uint8, uint32, []byte, bool) {
+	if f := device.PacketFormat(); f != nil && f.LengthMode&0x03 == yardstick.LengthVariable && len(raw) > 0 {
+		n := int(raw[0])
+		raw = raw[1:]
+		if n < len(raw) {
+			raw = raw[:n]
+		}
+	}
+	if len(raw) < headerLen || raw[0] != frameMagic {
+		return 0, 0, nil, false
+	}
+	return raw[1], binary.LittleEndian.Uint32(raw[2:]), raw[headerLen:], true
+}
+
+// NodeStats counts one node's packets as seen by the master
+type NodeStats struct {
+	Node     uint8   `json:"node"`
+	Slot     int     `json:"slot"`
+	Received int     `json:"received"`
+	Late     int     `json:"late"`
+	PER      float64 `json:"per"`
+}
+
+// MasterStats summarises a master run
+type MasterStats struct {
+	Frames int          `json:"frames"`
+	Plan   *Plan        `json:"plan"`
+	Nodes  []*NodeStats `json:"nodes"`
+	Other  int          `json:"other"` // Packets from unassigned nodes or corrupt frames
+}
+
+// RunMaster transmits beacons and listens to the node slots for frames
+// frames (0 = until ctx is cancelled); onPacket, if set, sees each packet
+func RunMaster(ctx context.Context, device *yardstick.Device, plan *Plan, frames int, onPacket func(*Packet)) (*MasterStats, error) {
+	lease, err := device.Acquire(yardstick.ModeRX, "tdma")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	device = lease.Device()
+
+	stats := &MasterStats{Plan: plan}
+	for i, id := range plan.Nodes {
+		stats.Nodes = append(stats.Nodes, &NodeStats{Node: id, Slot: i})
+	}
+
+	beaconBody := plan.beacon()
+	for frame := uint32(0); frames == 0 || int(frame) < frames; frame++ {
+		if ctx.Err() != nil {
+			break
+		}
+		start := time.Now()
+		beacon, err := encode(device, typeBeacon, frame, beaconBody)
+		if err != nil {
+			return stats, err
+		}
+		if err := device.RFXmitCtx(ctx, beacon, 0, 0); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return stats, fmt.Errorf("frame %d: beacon failed: %w", frame, err)
+		}
+		if err := device.SetModeRX(); err != nil {
+			return stats, fmt.Errorf("failed to enter RX mode: %w", err)
+		}
+		stats.Frames++
+
+		end := start.Add(plan.FrameLen())
+		frameCtx, cancel := context.WithDeadline(ctx, end)
+		for frameCtx.Err() == nil {
+			raw, err := device.RFRecvCtx(frameCtx, 0)
+			if err != nil || len(raw) == 0 {
+				continue
+			}
+			now := time.Now()
+			typ, pf, body, ok := decode(device, raw)
+			if !ok || typ != typeData || len(body) < 1 {
+				stats.Other++
+				continue
+			}
+			slot := plan.slotOf(body[0])
+			if slot < 0 {
+				stats.Other++
+				continue
+			}
+			pkt := &Packet{Timestamp: now, Frame: pf, Node: body[0], Slot: slot, Payload: body[1:]}
+			// The packet is delivered after its airtime; allow the guard either side
+			slotEnd := plan.SlotStart(start, slot+1).Add(plan.Guard)
+			slotBegin := plan.SlotStart(start, slot).Add(-plan.Guard)
+			pkt.Late = pf != frame || now.Before(slotBegin) || now.After(slotEnd)
+			ns := stats.Nodes[slot]
+			ns.Received++
+			if pkt.Late {
+				ns.Late++
+			}
+			if onPacket != nil {
+				onPacket(pkt)
+			}
+		}
+		cancel()
+	}
+
+	for _, ns := range stats.Nodes {
+		if stats.Frames > 0 {
+			ns.PER = 1 - float64(ns.Received)/float64(stats.Frames)
+			if ns.PER < 0 {
+				ns.PER = 0
+			}
+		}
+	}
+	return stats, nil
+}
+
+// NodeResult summarises a node run
+type NodeResult struct {
+	Node    uint8 `json:"node"`
+	Slot    int   `json:"slot"`
+	Beacons int   `json:"beacons"`
+	Sent    int   `json:"sent"`
+	Missed  int   `json:"missed"` // Frames skipped because the beacon was not heard
+	Plan    *Plan `json:"plan,omitempty"`
+}
+
+// RunNode follows the master's beacons and transmits payload(frame) in
+// the slot assigned to id, for frames frames (0 = until ctx is
+// cancelled). It fails if no beacon is heard within wait
+func RunNode(ctx context.Context, device *yardstick.Device, id uint8, frames int, wait time.Duration, payload func(frame uint32) []byte) (*NodeResult, error) {
+	lease, err := device.Acquire(yardstick.ModeRX, "tdma")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	device = lease.Device()
+
+	result := &NodeResult{Node: id, Slot: -1}
+	var lastFrame uint32
+	for frames == 0 || result.Sent < frames {
+		if err := device.SetModeRX(); err != nil {
+			return result, fmt.Errorf("failed to enter RX mode: %w", err)
+		}
+
+		beaconCtx, cancel := context.WithTimeout(ctx, wait)
+		plan, frame, heard, err := waitBeacon(beaconCtx, device)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return result, nil
+		case err != nil:
+			return result, err
+		}
+
+		if result.Beacons > 0 && frame > lastFrame+1 {
+			result.Missed += int(frame - lastFrame - 1)
+		}
+		result.Beacons++
+		lastFrame = frame
+		result.Plan = plan
+
+		slot := plan.slotOf(id)
+		if slot < 0 {
+			return result, fmt.Errorf("node %d has no slot (assigned: %v)", id, plan.Nodes)
+		}
+		result.Slot = slot
+
+		// The beacon finished arriving about BeaconSlot minus the guard
+		// after the frame started
+		start := heard.Add(-(plan.BeaconSlot - plan.Guard))
+		data, err := encode(device, typeData, frame, append([]byte{id}, payload(frame)...))
+		if err != nil {
+			return result, err
+		}
+		txAt := plan.SlotStart(start, slot).Add(plan.Guard / 2)
+		select {
+		case <-ctx.Done():
+			return result, nil
+		case <-time.After(time.Until(txAt)):
+		}
+		if err := device.RFXmitCtx(ctx, data, 0, 0); err != nil {
+			if ctx.Err() != nil {
+				return result, nil
+			}
+			return result, fmt.Errorf("frame %d: transmit failed: %w", frame, err)
+		}
+		result.Sent++
+	}
+	return result, nil
+}
+
+// waitBeacon receives until a beacon arrives or ctx ends
+func waitBeacon(ctx context.Context, device *yardstick.Device) (*Plan, uint32, time.Time, error) {
+	for {
+		raw, err := device.RFRecvCtx(ctx, 0)
+		if ctx.Err() != nil {
+			return nil, 0, time.Time{}, fmt.Errorf("no beacon heard: %w", ctx.Err())
+		}
+		if err != nil || len(raw) == 0 {
+			continue
+		}
+		heard := time.Now()
+		typ, frame, body, ok := decode(device, raw)
+		if !ok || typ != typeBeacon {
+			continue
+		}
+		if plan, ok := parseBeacon(body); ok {
+			return plan, frame, heard, nil
+		}
+	}
+}
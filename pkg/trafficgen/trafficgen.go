@@ -0,0 +1,419 @@
+// Package trafficgen stress-tests one device's receive pipeline with
+// synthetic traffic from another: a mix of frame sizes, rates and bursts,
+// with frames carrying a corrupted CRC, sent on the wrong sync word or
+// repeated mixed in, and a report comparing offered with received load
+//
+// Every frame carries a marker, its kind, a sequence number and its length
+// ahead of the payload, and a software CRC16 after it, so the receiver can
+// tell which frames arrived, which were lost and which should never have
+// made it through. Both devices must already be configured with the same
+// profile; the receiver runs an rxstream.Stream, so its dedupe, squelch
+// and FIFO handling are what is being tested.
+package trafficgen
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/coding"
+	"github.com/herlein/gocat/pkg/rxstream"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Kind is what a frame is meant to test
+type Kind string
+
+// Frame kinds
+const (
+	Good      Kind = "good"       // Should be delivered once
+	BadCRC    Kind = "bad-crc"    // CRC corrupted: should be delivered flagged, or dropped
+	WrongSync Kind = "wrong-sync" // Sent on the inverted sync word: should not be heard
+	Repeat    Kind = "repeat"     // Copy of the last good frame: should be deduped
+)
+
+// Kinds lists the frame kinds in report order
+var Kinds = []Kind{Good, BadCRC, WrongSync, Repeat}
+
+var kindCodes = map[Kind]byte{Good: 'G', BadCRC: 'C', WrongSync: 'S', Repeat: 'R'}
+
+// Frame layout: marker, kind, sequence number, frame length, payload, CRC16
+var marker = []byte{0xFA, 0x7C}
+
+const (
+	headerLen = 2 + 1 + 4 + 1
+	crcLen    = 2
+
+	// MinFrame is the smallest frame: header and CRC with no payload
+	MinFrame = headerLen + crcLen
+)
+
+// Defaults
+const (
+	DefaultFrames = 100
+	DefaultRate   = 10 // Frames per second
+	DefaultSize   = 16
+	DefaultSettle = 500 * time.Millisecond
+)
+
+// rxSettle lets the receiver reach RX before the first frame is sent
+const rxSettle = 200 * time.Millisecond
+
+// Mix is the fraction of frames of each kind other than Good, 0 to 1
+type Mix struct {
+	BadCRC    float64 `json:"bad_crc,omitempty"`
+	WrongSync float64 `json:"wrong_sync,omitempty"`
+	Repeat    float64 `json:"repeat,omitempty"`
+}
+
+// Options configures a run
+type Options struct {
+	Frames   int           // Frames to offer (default DefaultFrames)
+	Duration time.Duration // Stop offering after this long instead (0 = send Frames)
+	Rate     float64       // Mean frames per second (default DefaultRate)
+	Burst    int           // Frames sent back-to-back, then a pause keeping the mean rate (default 1)
+	MinSize  int           // Frame size range in bytes, header and CRC included (default DefaultSize)
+	MaxSize  int           // Clamped to the packet format of the transmitter
+	Mix      Mix
+	Seed     int64         // Random source for sizes and kinds (0 = time based)
+	Settle   time.Duration // Listening time after the last frame (default DefaultSettle)
+
+	// Receive configures the receiver's pipeline. SoftCRC is ignored: the
+	// generator checks its own CRC on the raw bytes
+	Receive rxstream.Options
+
+	variable bool // Variable length packets: a length byte leads each frame
+}
+
+// KindStats counts one kind of frame
+type KindStats struct {
+	Offered  int `json:"offered"`
+	Bytes    int `json:"bytes"`
+	Received int `json:"received"` // Copies that came out of the receive pipeline
+}
+
+// Report compares offered with received load
+type Report struct {
+	DurationMS int64 `json:"duration_ms"`
+
+	Offered      int     `json:"offered"`
+	OfferedBytes int     `json:"offered_bytes"`
+	OfferedRate  float64 `json:"offered_rate"` // Frames per second
+	OfferedBps   float64 `json:"offered_bps"`  // Bytes per second
+	TxErrors     int     `json:"tx_errors,omitempty"`
+
+	Received      int     `json:"received"` // Generator frames out of the pipeline, any kind
+	ReceivedBytes int     `json:"received_bytes"`
+	ReceivedRate  float64 `json:"received_rate"`
+	ReceivedBps   float64 `json:"received_bps"`
+
+	Kinds map[Kind]*KindStats `json:"kinds"`
+
+	Delivered  int     `json:"delivered"`      // Good frames received intact at least once
+	Lost       int     `json:"lost"`           // Good frames never received intact
+	Delivery   float64 `json:"delivery_ratio"` // Delivered / good frames offered
+	Corrupted  int     `json:"corrupted"`      // Good frames that arrived with a bad CRC
+	Duplicates int     `json:"duplicates"`     // Extra copies of a frame that got through
+	Reordered  int     `json:"reordered"`      // Frames that arrived after a later one
+	Leaked     int     `json:"leaked"`         // Wrong sync word frames that were heard
+	Foreign    int     `json:"foreign"`        // Packets that were not generator frames
+
+	DedupeDropped int `json:"dedupe_dropped"` // Copies the receiver's dedupe filter dropped
+	Squelched     int `json:"squelched"`      // Packets the receiver's squelch dropped
+}
+
+// sent is what the receiver needs to know about an offered frame
+type sent struct {
+	kind   Kind
+	length int
+}
+
+// Run offers traffic from tx to rx until the frames are sent, the
+// duration passes or ctx is cancelled, then reports. rx must not be in
+// use; tx is leased for transmit for the whole run
+func Run(ctx context.Context, tx, rx *yardstick.Device, opts *Options) (*Report, error) {
+	o := *opts
+	if err := o.defaults(tx); err != nil {
+		return nil, err
+	}
+
+	lease, err := tx.Acquire(yardstick.ModeTX, "trafficgen")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	tx = lease.Device()
+
+	syncWord, err := tx.GetSyncWord()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.SetSyncWord(syncWord)
+
+	recvOpts := o.Receive
+	recvOpts.SoftCRC = false
+	stream := rxstream.New(rx, &recvOpts)
+	if err := stream.Start(); err != nil {
+		return nil, fmt.Errorf("receiver: %w", err)
+	}
+	time.Sleep(rxSettle)
+
+	rep := &Report{Kinds: make(map[Kind]*KindStats)}
+	for _, k := range Kinds {
+		rep.Kinds[k] = &KindStats{}
+	}
+	var mu sync.Mutex
+	offered := make(map[uint32]sent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := newReceiver(o.variable)
+		for pkt := range stream.Packets() {
+			mu.Lock()
+			r.add(pkt.Raw, offered, rep)
+			mu.Unlock()
+		}
+	}()
+
+	rng := rand.New(rand.NewSource(o.Seed))
+	start := time.Now()
+	interval := time.Duration(float64(o.Burst) / o.Rate * float64(time.Second))
+	next := start
+	var last []byte
+	var seq uint32
+	for n := 0; ; {
+		if o.Duration > 0 && time.Since(start) >= o.Duration || o.Duration == 0 && n >= o.Frames {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		for i := 0; i < o.Burst && (o.Duration > 0 || n < o.Frames); i++ {
+			kind := o.pick(rng, last != nil)
+			var frame []byte
+			if kind == Repeat {
+				frame = last
+			} else {
+				seq++
+				frame = build(kind, seq, o.size(rng), rng)
+				if kind == Good {
+					last = frame
+				}
+			}
+			mu.Lock()
+			if kind != Repeat {
+				offered[seq] = sent{kind: kind, length: len(frame)}
+			}
+			k := rep.Kinds[kind]
+			k.Offered++
+			k.Bytes += len(frame)
+			rep.Offered++
+			rep.OfferedBytes += len(frame)
+			mu.Unlock()
+
+			if err := send(tx, frame, kind == WrongSync, syncWord, o.variable); err != nil {
+				rep.TxErrors++
+			}
+			n++
+		}
+		next = next.Add(interval)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(next)):
+		}
+	}
+	offeredFor := time.Since(start)
+
+	// Give the last frames time to arrive
+	select {
+	case <-ctx.Done():
+	case <-time.After(o.Settle):
+	}
+	stream.Stop()
+	<-done
+
+	rep.DurationMS = offeredFor.Milliseconds()
+	rep.DedupeDropped = stream.Duplicates()
+	rep.Squelched = stream.Squelched()
+	rep.finish(offeredFor)
+	return rep, nil
+}
+
+// defaults fills in zero options and fits sizes to the packet format
+func (o *Options) defaults(tx *yardstick.Device) error {
+	if o.Frames <= 0 {
+		o.Frames = DefaultFrames
+	}
+	if o.Rate <= 0 {
+		o.Rate = DefaultRate
+	}
+	if o.Burst <= 0 {
+		o.Burst = 1
+	}
+	if o.Settle <= 0 {
+		o.Settle = DefaultSettle
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	if o.MinSize <= 0 {
+		o.MinSize = DefaultSize
+	}
+	if o.MaxSize < o.MinSize {
+		o.MaxSize = o.MinSize
+	}
+	if o.Mix.BadCRC < 0 || o.Mix.WrongSync < 0 || o.Mix.Repeat < 0 || o.Mix.BadCRC+o.Mix.WrongSync+o.Mix.Repeat > 1 {
+		return fmt.Errorf("invalid traffic mix: fractions must be 0-1 and add up to at most 1")
+	}
+
+	max := yardstick.RFMaxTXBlock
+	if f := tx.PacketFormat(); f != nil {
+		switch f.LengthMode {
+		case yardstick.LengthFixed:
+			// Every frame is the packet length
+			o.MinSize, o.MaxSize = int(f.PktLen), int(f.PktLen)
+		case yardstick.LengthVariable:
+			o.variable = true
+			max = int(f.PktLen)
+		}
+	}
+	if o.MaxSize > max {
+		o.MaxSize = max
+	}
+	if o.MinSize > o.MaxSize {
+		o.MinSize = o.MaxSize
+	}
+	if o.MinSize < MinFrame {
+		return fmt.Errorf("frames of %d bytes are too short; at least %d are needed", o.MinSize, MinFrame)
+	}
+	return nil
+}
+
+// pick chooses the next frame's kind; a repeat needs a good frame before it
+func (o *Options) pick(rng *rand.Rand, canRepeat bool) Kind {
+	x := rng.Float64()
+	switch {
+	case x < o.Mix.BadCRC:
+		return BadCRC
+	case x < o.Mix.BadCRC+o.Mix.WrongSync:
+		return WrongSync
+	case x < o.Mix.BadCRC+o.Mix.WrongSync+o.Mix.Repeat && canRepeat:
+		return Repeat
+	}
+	return Good
+}
+
+func (o *Options) size(rng *rand.Rand) int {
+	return o.MinSize + rng.Intn(o.MaxSize-o.MinSize+1)
+}
+
+// build makes one frame of n bytes
+func build(kind Kind, seq uint32, n int, rng *rand.Rand) []byte {
+	body := make([]byte, n-crcLen)
+	copy(body, marker)
+	body[2] = kindCodes[kind]
+	binary.LittleEndian.PutUint32(body[3:7], seq)
+	body[7] = byte(n)
+	rng.Read(body[headerLen:])
+	frame := coding.AppendCRC16(body)
+	if kind == BadCRC {
+		frame[len(frame)-1] ^= 0xFF
+	}
+	return frame
+}
+
+// send transmits a frame, on the inverted sync word if wrongSync. In
+// variable length mode the packet engine's length byte goes first
+func send(tx *yardstick.Device, frame []byte, wrongSync bool, syncWord uint16, variable bool) error {
+	if wrongSync {
+		if err := tx.SetSyncWord(^syncWord); err != nil {
+			return err
+		}
+		defer tx.SetSyncWord(syncWord)
+	}
+	if variable {
+		frame = append([]byte{byte(len(frame))}, frame...)
+	}
+	return tx.RFXmit(frame, 0, 0)
+}
+
+// receiver matches received packets to offered frames
+type receiver struct {
+	variable bool
+	copies   map[uint32]int // Intact copies received per sequence number
+	highest  uint32
+}
+
+func newReceiver(variable bool) *receiver {
+	return &receiver{variable: variable, copies: make(map[uint32]int)}
+}
+
+// add accounts for one packet out of the receive pipeline
+func (r *receiver) add(data []byte, offered map[uint32]sent, rep *Report) {
+	if r.variable && len(data) > 0 {
+		data = data[1:]
+	}
+	if len(data) < headerLen || data[0] != marker[0] || data[1] != marker[1] {
+		rep.Foreign++
+		return
+	}
+	seq := binary.LittleEndian.Uint32(data[3:7])
+	s, ok := offered[seq]
+	if !ok || kindCodes[s.kind] != data[2] {
+		rep.Foreign++
+		return
+	}
+	rep.Received++
+	rep.ReceivedBytes += s.length
+	intact := len(data) >= s.length
+	if intact {
+		_, intact = coding.CheckCRC16(data[:s.length])
+	}
+
+	switch s.kind {
+	case Good:
+		switch {
+		case !intact:
+			rep.Corrupted++
+		case r.copies[seq] > 0:
+			// A repeat, or the radio heard the frame twice
+			rep.Duplicates++
+			rep.Kinds[Repeat].Received++
+		default:
+			rep.Delivered++
+			rep.Kinds[Good].Received++
+			if seq < r.highest {
+				rep.Reordered++
+			}
+		}
+		if intact {
+			r.copies[seq]++
+		}
+	case WrongSync:
+		rep.Leaked++
+		rep.Kinds[WrongSync].Received++
+	default:
+		rep.Kinds[s.kind].Received++
+	}
+	if seq > r.highest {
+		r.highest = seq
+	}
+}
+
+// finish derives the totals and rates
+func (rep *Report) finish(elapsed time.Duration) {
+	good := rep.Kinds[Good].Offered
+	rep.Lost = good - rep.Delivered
+	if good > 0 {
+		rep.Delivery = float64(rep.Delivered) / float64(good)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		rep.OfferedRate = float64(rep.Offered) / secs
+		rep.OfferedBps = float64(rep.OfferedBytes) / secs
+		rep.ReceivedRate = float64(rep.Received) / secs
+		rep.ReceivedBps = float64(rep.ReceivedBytes) / secs
+	}
+}
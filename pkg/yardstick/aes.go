@@ -1,6 +1,14 @@
 package yardstick
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
+
+// AESBlockSize is the CC1111 AES coprocessor block size; with crypto
+// enabled the firmware processes packets in whole blocks, so payloads
+// must be padded to a multiple of it (see AESPad)
+const AESBlockSize = 16
 
 // AESConfig holds AES encryption configuration
 type AESConfig struct {
@@ -69,3 +77,38 @@ func (d *Device) ConfigureAES(cfg *AESConfig) error {
 func (d *Device) DisableAES() error {
 	return d.SetAESMode(AESCryptoNone)
 }
+
+// EnableEncryptedLink sets up AES-CBC so transmitted packets are
+// encrypted and received packets decrypted in firmware. Configure both
+// ends with the same key and IV. The mode is read back to confirm the
+// firmware accepted it
+func (d *Device) EnableEncryptedLink(key, iv [16]byte) error {
+	err := d.ConfigureAES(&AESConfig{
+		Mode:      AESModeCBC,
+		Key:       key,
+		IV:        iv,
+		EncryptTX: true,
+		DecryptRX: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure AES: %w", err)
+	}
+
+	mode, err := d.GetAESMode()
+	if err != nil {
+		return fmt.Errorf("failed to read back AES mode: %w", err)
+	}
+	if mode != AESCryptoDefault {
+		return fmt.Errorf("AES mode readback 0x%02X, expected 0x%02X", mode, AESCryptoDefault)
+	}
+	return nil
+}
+
+// AESPad zero-pads data to a whole number of AES blocks
+func AESPad(data []byte) []byte {
+	n := (len(data) + AESBlockSize - 1) / AESBlockSize * AESBlockSize
+	if n == 0 {
+		n = AESBlockSize
+	}
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{0}, n-len(data))...)
+}
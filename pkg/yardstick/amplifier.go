@@ -1,7 +1,12 @@
 package yardstick
 
 // EnableAmplifier enables the external TX/RX amplifier (YardStick One)
+// On boards without one it does nothing, so callers can use it on any
+// dongle
 func (d *Device) EnableAmplifier() error {
+	if !d.Capabilities().Amplifier {
+		return nil
+	}
 	return d.SetAmpMode(AmpModeOn)
 }
 
@@ -0,0 +1,154 @@
+package yardstick
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RadioMode identifies what a lease holder is using the radio for
+type RadioMode uint8
+
+// Radio modes
+const (
+	ModeRX RadioMode = iota + 1
+	ModeTX
+	ModeSpecAn // Firmware spectrum analyzer, exclusive
+	ModeFHSS   // Firmware frequency hopping, allows RX/TX
+)
+
+// String returns the mode name
+func (m RadioMode) String() string {
+	switch m {
+	case ModeRX:
+		return "rx"
+	case ModeTX:
+		return "tx"
+	case ModeSpecAn:
+		return "specan"
+	case ModeFHSS:
+		return "fhss"
+	default:
+		return fmt.Sprintf("mode(%d)", uint8(m))
+	}
+}
+
+// ErrRadioBusy is matched by errors.Is when the radio is leased to
+// another user; use errors.As with *BusyError for the holder
+var ErrRadioBusy = errors.New("radio busy")
+
+// BusyError reports a request that conflicts with the current lease
+type BusyError struct {
+	Requested RadioMode // Zero for a configuration change
+	Mode      RadioMode // Mode of the current lease
+	Holder    string
+	Since     time.Time
+}
+
+func (e *BusyError) Error() string {
+	if e.Requested == 0 {
+		return fmt.Sprintf("radio busy: leased for %s by %s since %s",
+			e.Mode, e.Holder, e.Since.Format(time.TimeOnly))
+	}
+	return fmt.Sprintf("radio busy: %s requested, leased for %s by %s since %s",
+		e.Requested, e.Mode, e.Holder, e.Since.Format(time.TimeOnly))
+}
+
+// Is makes errors.Is(err, ErrRadioBusy) match
+func (e *BusyError) Is(target error) bool {
+	return target == ErrRadioBusy
+}
+
+// Lease is exclusive use of the radio in one mode
+// Only one lease is held per device at a time. The holder changes the
+// radio through the handle from Device; other handles get BusyError
+type Lease struct {
+	device *Device
+	handle *Device
+	mode   RadioMode
+	holder string
+	since  time.Time
+	once   sync.Once
+	err    error
+}
+
+// Acquire leases the radio for mode. holder names the user in BusyError
+// so a conflicting caller can report who has the radio
+func (d *Device) Acquire(mode RadioMode, holder string) (*Lease, error) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	if l := d.lease; l != nil {
+		return nil, &BusyError{Requested: mode, Mode: l.mode, Holder: l.holder, Since: l.since}
+	}
+	l := &Lease{device: d, mode: mode, holder: holder, since: time.Now()}
+	l.handle = &Device{dongle: d.dongle, holder: l}
+	d.lease = l
+	return l, nil
+}
+
+// CurrentLease returns the lease currently held, or nil
+func (d *Device) CurrentLease() *Lease {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.lease
+}
+
+// Release returns the radio to IDLE and frees the lease
+// The lease is held until the radio is idle, so the next holder never
+// sees it still receiving or transmitting. Calling Release more than once
+// is safe and returns the first result
+func (l *Lease) Release() error {
+	l.once.Do(func() {
+		d := l.device
+		if d.CurrentLease() != l {
+			return
+		}
+		l.err = l.handle.SetModeIDLE()
+
+		d.stateMu.Lock()
+		if d.lease == l {
+			d.lease = nil
+		}
+		d.stateMu.Unlock()
+	})
+	return l.err
+}
+
+// Device returns the holder's handle on the leased device
+// It shares everything with the handle Acquire was called on, but may
+// change the radio while the lease is held; once the lease is released
+// it behaves like any other handle
+func (l *Lease) Device() *Device {
+	return l.handle
+}
+
+// Mode returns the leased mode
+func (l *Lease) Mode() RadioMode {
+	return l.mode
+}
+
+// Holder returns the name given to Acquire
+func (l *Lease) Holder() string {
+	return l.holder
+}
+
+// Since returns when the lease was acquired
+func (l *Lease) Since() time.Time {
+	return l.since
+}
+
+// checkMode rejects calls that change the radio unless they come from
+// the lease holder's handle. mode is what the call does with the radio,
+// or zero for register writes and other configuration
+func (d *Device) checkMode(mode RadioMode) error {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	l := d.lease
+	if l == nil || l == d.holder {
+		return nil
+	}
+	return &BusyError{Requested: mode, Mode: l.mode, Holder: l.holder, Since: l.since}
+}
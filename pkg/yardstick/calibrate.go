@@ -0,0 +1,174 @@
+package yardstick
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Calibration registers
+const (
+	RegMCSM0  = 0xDF14 // Main radio control state machine (FS_AUTOCAL in bits 5:4)
+	RegFSCAL3 = 0xDF1C // Frequency synthesizer calibration
+	RegFSCAL2 = 0xDF1D
+	RegFSCAL1 = 0xDF1E
+)
+
+// MCSM0 FS_AUTOCAL field
+const mcsm0AutocalMask = 0x30
+
+// CalEntry holds the synthesizer calibration result for one frequency
+type CalEntry struct {
+	FreqHz uint32 `json:"freq_hz"`
+	FSCAL3 uint8  `json:"fscal3"`
+	FSCAL2 uint8  `json:"fscal2"`
+	FSCAL1 uint8  `json:"fscal1"`
+}
+
+// CalTable caches calibration results by frequency
+// Results are only valid for the device, temperature and supply voltage
+// they were measured at
+type CalTable struct {
+	mu      sync.RWMutex
+	entries map[uint32]CalEntry
+}
+
+// NewCalTable creates an empty calibration table
+func NewCalTable() *CalTable {
+	return &CalTable{entries: make(map[uint32]CalEntry)}
+}
+
+// Get returns the cached calibration for a frequency
+func (t *CalTable) Get(freqHz uint32) (CalEntry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	e, ok := t.entries[freqHz]
+	return e, ok
+}
+
+// Put stores a calibration result
+func (t *CalTable) Put(e CalEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[e.FreqHz] = e
+}
+
+// Entries returns all cached results sorted by frequency
+func (t *CalTable) Entries() []CalEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]CalEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FreqHz < out[j].FreqHz })
+	return out
+}
+
+// Len returns the number of cached frequencies
+func (t *CalTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.entries)
+}
+
+// Precalibrate runs a manual calibration on each frequency and caches the
+// FSCAL3-1 results on the device. Subsequent Retune calls to a cached
+// frequency write the stored values instead of recalibrating, and automatic
+// calibration on IDLE->RX/TX is disabled so the values are not overwritten
+func (d *Device) Precalibrate(freqs []uint32) (*CalTable, error) {
+	table := d.calTable
+	if table == nil {
+		table = NewCalTable()
+	}
+
+	// Measure with the cache detached so Retune really calibrates
+	d.calTable = nil
+	defer func() { d.calTable = table }()
+
+	for _, f := range freqs {
+		if err := d.Retune(f); err != nil {
+			return table, fmt.Errorf("calibrate %d Hz: %w", f, err)
+		}
+		e, err := d.readCal(f)
+		if err != nil {
+			return table, err
+		}
+		table.Put(e)
+	}
+
+	return table, nil
+}
+
+// SetCalTable attaches a calibration table to the device, e.g. one
+// restored from disk. nil detaches it and re-enables automatic calibration
+func (d *Device) SetCalTable(t *CalTable) error {
+	d.calTable = t
+	if t == nil {
+		return d.setAutocal(true)
+	}
+	return nil
+}
+
+// CalTable returns the device's calibration table, or nil
+func (d *Device) CalTable() *CalTable {
+	return d.calTable
+}
+
+// readCal reads the current synthesizer calibration
+func (d *Device) readCal(freqHz uint32) (CalEntry, error) {
+	e := CalEntry{FreqHz: freqHz}
+	var err error
+	if e.FSCAL3, err = d.PeekByte(RegFSCAL3); err != nil {
+		return e, fmt.Errorf("failed to read FSCAL3: %w", err)
+	}
+	if e.FSCAL2, err = d.PeekByte(RegFSCAL2); err != nil {
+		return e, fmt.Errorf("failed to read FSCAL2: %w", err)
+	}
+	if e.FSCAL1, err = d.PeekByte(RegFSCAL1); err != nil {
+		return e, fmt.Errorf("failed to read FSCAL1: %w", err)
+	}
+	return e, nil
+}
+
+// writeCal restores a cached synthesizer calibration
+func (d *Device) writeCal(e CalEntry) error {
+	if err := d.PokeByte(RegFSCAL3, e.FSCAL3); err != nil {
+		return fmt.Errorf("failed to write FSCAL3: %w", err)
+	}
+	if err := d.PokeByte(RegFSCAL2, e.FSCAL2); err != nil {
+		return fmt.Errorf("failed to write FSCAL2: %w", err)
+	}
+	if err := d.PokeByte(RegFSCAL1, e.FSCAL1); err != nil {
+		return fmt.Errorf("failed to write FSCAL1: %w", err)
+	}
+	return nil
+}
+
+// setAutocal enables or disables calibration on IDLE->RX/TX transitions
+// Enabling restores the usual "calibrate when going from IDLE" setting
+func (d *Device) setAutocal(enable bool) error {
+	mcsm0, err := d.PeekByte(RegMCSM0)
+	if err != nil {
+		return fmt.Errorf("failed to read MCSM0: %w", err)
+	}
+	want := mcsm0 &^ mcsm0AutocalMask
+	if enable {
+		want |= 0x10
+	}
+	if want == mcsm0 {
+		return nil
+	}
+	if err := d.PokeByte(RegMCSM0, want); err != nil {
+		return fmt.Errorf("failed to write MCSM0: %w", err)
+	}
+	return nil
+}
+
+// cachedCal looks up a precalibrated frequency
+func (d *Device) cachedCal(freqHz uint32) (CalEntry, bool) {
+	if d.calTable == nil {
+		return CalEntry{}, false
+	}
+	return d.calTable.Get(freqHz)
+}
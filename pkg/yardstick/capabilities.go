@@ -0,0 +1,48 @@
+package yardstick
+
+import "errors"
+
+// ErrNoAmplifier is returned by SetAmpMode on boards without front-end
+// amplifiers
+var ErrNoAmplifier = errors.New("device has no front-end amplifier")
+
+// Capabilities describe what a dongle's board adds to its radio chip
+type Capabilities struct {
+	Model       string  `json:"model"`
+	Amplifier   bool    `json:"amplifier"`     // TX/RX front-end amplifiers switched by SetAmpMode
+	AmpGainDB   float64 `json:"amp_gain_db"`   // TX gain of the amplifier when enabled
+	MaxPowerDBm float64 `json:"max_power_dbm"` // Highest output at the antenna port
+}
+
+// SupportedProductIDs are the RfCat application firmware product IDs
+// FindAllDevices and OpenDevice open, YardStick One first
+var SupportedProductIDs = []uint16{ProductID, ProductIDDonsDongle, ProductIDChronosDongle, ProductIDSRFStick}
+
+// boards are the capabilities of each supported product ID. Only the
+// YardStick One has amplifiers; the others run the CC1111 PA alone
+var boards = map[uint16]Capabilities{
+	ProductID:              {Model: "YardStick One", Amplifier: true, AmpGainDB: 10, MaxPowerDBm: 20},
+	ProductIDDonsDongle:    {Model: "Dons dongle", MaxPowerDBm: 10},
+	ProductIDChronosDongle: {Model: "Chronos dongle", MaxPowerDBm: 10},
+	ProductIDSRFStick:      {Model: "SRF stick", MaxPowerDBm: 10},
+}
+
+// IsSupported reports whether a product ID is a dongle gocat can drive
+func IsSupported(product uint16) bool {
+	_, ok := boards[product]
+	return ok
+}
+
+// CapabilitiesFor returns the capabilities of a supported product ID
+func CapabilitiesFor(product uint16) (Capabilities, bool) {
+	caps, ok := boards[product]
+	return caps, ok
+}
+
+// Capabilities returns the capabilities of the device's board
+func (d *Device) Capabilities() Capabilities {
+	if caps, ok := boards[d.ProductID]; ok {
+		return caps
+	}
+	return boards[ProductID]
+}
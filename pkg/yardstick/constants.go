@@ -33,6 +33,14 @@ const (
 	USBDefaultTimeout = 1000 * time.Millisecond
 	USBRXWaitTimeout  = 1000 * time.Millisecond
 	USBTXWaitTimeout  = 10000 * time.Millisecond
+
+	// Host-side EP5 read slices used while waiting in Recv. The firmware
+	// has no receive window to configure: the radio stays in RX and
+	// packets queue for EP5, so these only set how often the host wakes
+	// to check its deadline. Short waits read in HostReadSliceMin slices;
+	// long waits grow toward HostReadSliceMax
+	HostReadSliceMin = 100 * time.Millisecond
+	HostReadSliceMax = 1000 * time.Millisecond
 )
 
 // Application IDs for EP5 protocol
@@ -139,6 +147,9 @@ const (
 	RFMaxRXBlock = 512   // Maximum RX block size
 )
 
+// RFXmit repeat count the firmware treats as transmit until stopped
+const RepeatForever = 0xFFFF
+
 // Error/Return Codes
 const (
 	RCNoError                    = 0x00
@@ -1,63 +1,144 @@
 package yardstick
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gousb"
 )
 
-// Device represents a YardStick One USB device
+// Device represents a YardStick One or other RfCat USB dongle
+// While the radio is leased, Lease.Device returns the holder's handle on
+// the same dongle; calls that change the radio fail with BusyError on
+// every other handle
 type Device struct {
-	usbDevice    *gousb.Device
-	usbConfig    *gousb.Config
-	usbInterface *gousb.Interface
-	epIn         *gousb.InEndpoint
-	epOut        *gousb.OutEndpoint
+	*dongle
+	holder *Lease // Lease this handle acts for, see Lease.Device
+}
+
+// dongle is the state shared by every handle on one dongle
+type dongle struct {
+	transport    DeviceIO // nil while disconnected; swapped under recvMu and ioMu
 	Serial       string
 	Manufacturer string
 	Product      string
+	ProductID    uint16 // USB product ID, see Capabilities
 	Bus          int
 	Address      int
 	recvBuf      []byte
 	recvMu       sync.Mutex
+	ioMu         sync.RWMutex // Read-held to use transport outside recvMu
+	txLimiter    *TxLimiter
+	airtimeFn    AirtimeFunc
+	calTable     *CalTable
+	pktFormat    *PacketFormat
+	stateMu      sync.Mutex
+	applied      interface{}   // Last applied configuration, see SetApplied
+	lease        *Lease        // Current radio lease, see Acquire
+	cache        stateCache    // Frequency, modulation and mode, see CurrentState
+	crystalHz    atomic.Uint32 // Crystal frequency once the part number is known, see CrystalHz
 }
 
-// FindAllDevices finds all connected YardStick One devices
+// FindAllDevices finds all connected YardStick One and other RfCat
+// dongles (SupportedProductIDs)
+// Devices that fail to open are skipped; if none could be opened the
+// error explains why (see OpenError), including dongles found only in
+// bootloader mode
 func FindAllDevices(context *gousb.Context) ([]*Device, error) {
 	devices := []*Device{}
 
+	var seen, bootloaders []*gousb.DeviceDesc
 	usbDevices, err := context.OpenDevices(func(descriptor *gousb.DeviceDesc) bool {
-		return descriptor.Vendor == gousb.ID(VendorID) && descriptor.Product == gousb.ID(ProductID)
+		if descriptor.Vendor != gousb.ID(VendorID) {
+			return false
+		}
+		if IsBootloader(uint16(descriptor.Product)) {
+			bootloaders = append(bootloaders, descriptor)
+		}
+		if !IsSupported(uint16(descriptor.Product)) {
+			return false
+		}
+		seen = append(seen, descriptor)
+		return true
 	})
+
+	// gousb reports only the last open failure; blame a device that
+	// did not open
+	var openErr error
 	if err != nil {
-		return nil, fmt.Errorf("failed to enumerate devices: %w", err)
+		openErr = classifyOpenError(unopened(seen, usbDevices), fmt.Errorf("failed to open device: %w", err))
 	}
 
 	for _, usbDev := range usbDevices {
 		device, err := wrapDevice(usbDev)
 		if err != nil {
 			usbDev.Close()
+			if openErr == nil {
+				openErr = err
+			}
 			continue
 		}
 		devices = append(devices, device)
 	}
 
+	if len(devices) == 0 {
+		if openErr != nil {
+			return nil, openErr
+		}
+		if len(bootloaders) > 0 {
+			desc := bootloaders[0]
+			return nil, &OpenError{
+				Bus:     desc.Bus,
+				Address: desc.Address,
+				Class:   ErrBootloader,
+				Err:     fmt.Errorf("found product ID 0x%04X", uint16(desc.Product)),
+			}
+		}
+	}
+
 	return devices, nil
 }
 
-// OpenDevice opens a specific YardStick One device by serial number
+// unopened returns the first descriptor with no opened device, or nil
+func unopened(seen []*gousb.DeviceDesc, opened []*gousb.Device) *gousb.DeviceDesc {
+	for _, desc := range seen {
+		found := false
+		for _, dev := range opened {
+			if dev.Desc != nil && dev.Desc.Bus == desc.Bus && dev.Desc.Address == desc.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return desc
+		}
+	}
+	return nil
+}
+
+// OpenDevice opens a specific dongle by serial number, trying the first
+// device of each supported product ID in turn
 func OpenDevice(context *gousb.Context, serial string) (*Device, error) {
-	usbDev, err := context.OpenDeviceWithVIDPID(gousb.ID(VendorID), gousb.ID(ProductID))
-	if err != nil {
-		return nil, fmt.Errorf("failed to open device: %w", err)
+	var usbDev *gousb.Device
+	var err error
+	for _, product := range SupportedProductIDs {
+		usbDev, err = context.OpenDeviceWithVIDPID(gousb.ID(VendorID), gousb.ID(product))
+		if usbDev != nil || err != nil {
+			break
+		}
+	}
+	if err != nil && usbDev == nil {
+		return nil, classifyOpenError(nil, fmt.Errorf("failed to open device: %w", err))
 	}
 	if usbDev == nil {
-		return nil, fmt.Errorf("device not found")
+		return nil, ErrDeviceNotFound
 	}
 
 	device, err := wrapDevice(usbDev)
@@ -83,13 +164,13 @@ func wrapDevice(usbDev *gousb.Device) (*Device, error) {
 
 	config, err := usbDev.Config(1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get configuration: %w", err)
+		return nil, classifyOpenError(usbDev.Desc, fmt.Errorf("failed to get configuration: %w", err))
 	}
 
 	iface, err := config.Interface(0, 0)
 	if err != nil {
 		config.Close()
-		return nil, fmt.Errorf("failed to claim interface: %w", err)
+		return nil, classifyOpenError(usbDev.Desc, fmt.Errorf("failed to claim interface: %w", err))
 	}
 
 	// Get EP5 IN endpoint (0x85)
@@ -97,7 +178,7 @@ func wrapDevice(usbDev *gousb.Device) (*Device, error) {
 	if err != nil {
 		iface.Close()
 		config.Close()
-		return nil, fmt.Errorf("failed to get IN endpoint: %w", err)
+		return nil, usbErr(fmt.Errorf("failed to get IN endpoint: %w", err))
 	}
 
 	// Get EP5 OUT endpoint (0x05)
@@ -105,23 +186,23 @@ func wrapDevice(usbDev *gousb.Device) (*Device, error) {
 	if err != nil {
 		iface.Close()
 		config.Close()
-		return nil, fmt.Errorf("failed to get OUT endpoint: %w", err)
+		return nil, usbErr(fmt.Errorf("failed to get OUT endpoint: %w", err))
 	}
 
 	desc := usbDev.Desc
-	device := &Device{
-		usbDevice:    usbDev,
-		usbConfig:    config,
-		usbInterface: iface,
-		epIn:         epIn,
-		epOut:        epOut,
-		Serial:       serial,
-		Manufacturer: manufacturer,
-		Product:      product,
-		Bus:          desc.Bus,
-		Address:      desc.Address,
-		recvBuf:      make([]byte, 0, EP5OutBufferSize),
-	}
+	device := NewDevice(&usbIO{
+		dev:    usbDev,
+		config: config,
+		iface:  iface,
+		epIn:   epIn,
+		epOut:  epOut,
+	})
+	device.Serial = serial
+	device.Manufacturer = manufacturer
+	device.Product = product
+	device.ProductID = uint16(desc.Product)
+	device.Bus = desc.Bus
+	device.Address = desc.Address
 
 	// Drain any stale data from the receive endpoint
 	device.drainReceiveBuffer()
@@ -129,27 +210,49 @@ func wrapDevice(usbDev *gousb.Device) (*Device, error) {
 	return device, nil
 }
 
+// NewDevice creates a Device on top of a transport
+// FindAllDevices and OpenDevice do this for USB dongles; tests use it with
+// a simulated dongle from pkg/yardstick/mock. The device is taken to be a
+// YardStick One until ProductID says otherwise
+func NewDevice(transport DeviceIO) *Device {
+	return &Device{dongle: &dongle{
+		transport: transport,
+		ProductID: ProductID,
+		recvBuf:   make([]byte, 0, EP5OutBufferSize),
+	}}
+}
+
 // Control performs a USB control transfer (for EP0 vendor commands)
 func (d *Device) Control(requestType uint8, request uint8, value uint16, index uint16, data []byte) (int, error) {
-	return d.usbDevice.Control(requestType, request, value, index, data)
+	d.ioMu.RLock()
+	defer d.ioMu.RUnlock()
+	if d.transport == nil {
+		return 0, usbErr(ErrDisconnected)
+	}
+	n, err := d.transport.Control(requestType, request, value, index, data)
+	if isNoDevice(err) {
+		err = usbErr(err)
+	}
+	return n, err
 }
 
 // Close closes the device and releases all resources
 func (d *Device) Close() error {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
 	// Try to put radio back to IDLE state before closing
 	// This ensures the device is in a known state for next use
-	if d.epOut != nil {
+	if d.transport != nil {
 		d.setRadioIDLE()
 	}
+	d.InvalidateState()
+	d.stateMu.Lock()
+	d.lease = nil
+	d.stateMu.Unlock()
 
-	if d.usbInterface != nil {
-		d.usbInterface.Close()
-	}
-	if d.usbConfig != nil {
-		d.usbConfig.Close()
-	}
-	if d.usbDevice != nil {
-		return d.usbDevice.Close()
+	if d.transport != nil {
+		return d.transport.Close()
 	}
 	return nil
 }
@@ -161,7 +264,7 @@ func (d *Device) drainReceiveBuffer() {
 	// Do a few quick reads with very short timeout to clear any pending data
 	for i := 0; i < 5; i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
-		n, err := d.epIn.ReadContext(ctx, buf)
+		n, err := d.transport.ReadContext(ctx, buf)
 		cancel()
 		if err != nil || n == 0 {
 			break // No more data or error, we're done
@@ -177,6 +280,13 @@ func (d *Device) RecoverUSB() error {
 	d.recvMu.Lock()
 	defer d.recvMu.Unlock()
 
+	if d.transport == nil {
+		return usbErr(ErrDisconnected)
+	}
+
+	// The firmware may have been reset; don't trust the recorded configuration
+	d.InvalidateState()
+
 	// Wait a bit to let any pending transfers complete/timeout
 	time.Sleep(50 * time.Millisecond)
 
@@ -184,7 +294,7 @@ func (d *Device) RecoverUSB() error {
 	buf := make([]byte, 512)
 	for i := 0; i < 10; i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
-		_, err := d.epIn.ReadContext(ctx, buf)
+		_, err := d.transport.ReadContext(ctx, buf)
 		cancel()
 		if err != nil {
 			break
@@ -224,7 +334,7 @@ func (d *Device) setRadioIDLE() {
 	// Send without waiting for response (best effort during cleanup)
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
-	d.epOut.WriteContext(ctx, packet)
+	d.transport.WriteContext(ctx, packet)
 }
 
 // String returns a human-readable description of the device
@@ -235,10 +345,14 @@ func (d *Device) String() string {
 // Send sends a command to the device via EP5 and waits for response
 // Protocol: app(1) + cmd(1) + length(2 LE) + payload
 func (d *Device) Send(app uint8, cmd uint8, payload []byte, timeout time.Duration) ([]byte, error) {
-	if timeout == 0 {
-		timeout = USBDefaultTimeout
-	}
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+	return d.SendCtx(ctx, app, cmd, payload)
+}
 
+// SendCtx is Send bounded by ctx instead of a timeout, so a caller can
+// abandon the exchange early by cancelling ctx
+func (d *Device) SendCtx(ctx context.Context, app uint8, cmd uint8, payload []byte) ([]byte, error) {
 	// Build the command packet
 	packet := make([]byte, 4+len(payload))
 	packet[0] = app
@@ -248,246 +362,240 @@ func (d *Device) Send(app uint8, cmd uint8, payload []byte, timeout time.Duratio
 		copy(packet[4:], payload)
 	}
 
-	// Send the packet with timeout
-	writeCtx, writeCancel := context.WithTimeout(context.Background(), timeout)
-	n, err := d.epOut.WriteContext(writeCtx, packet)
-	writeCancel()
+	// Send the packet
+	n, err := d.writeEP5(ctx, packet)
+	if errors.Is(err, ErrDisconnected) {
+		return nil, err
+	}
 	if err != nil {
 		// Check if it was a timeout/cancellation
-		if writeCtx.Err() != nil {
-			return nil, fmt.Errorf("write timeout: %w", err)
+		if ctx.Err() == context.Canceled {
+			return nil, fmt.Errorf("write canceled: %w", ctx.Err())
+		}
+		if ctx.Err() != nil {
+			return nil, usbErr(fmt.Errorf("write timeout: %w", err))
 		}
 		errStr := strings.ToLower(err.Error())
 		if strings.Contains(errStr, "cancel") || strings.Contains(errStr, "timeout") {
-			return nil, fmt.Errorf("write timeout: %w", err)
+			return nil, usbErr(fmt.Errorf("write timeout: %w", err))
 		}
-		return nil, fmt.Errorf("failed to write to EP5: %w", err)
+		return nil, usbErr(fmt.Errorf("failed to write to EP5: %w", err))
 	}
 	if n != len(packet) {
-		return nil, fmt.Errorf("short write: wrote %d of %d bytes", n, len(packet))
+		return nil, usbErr(fmt.Errorf("short write: wrote %d of %d bytes", n, len(packet)))
 	}
 
 	// Read the response
-	return d.Recv(app, cmd, timeout)
+	return d.RecvCtx(ctx, app, cmd)
+}
+
+// writeEP5 writes one EP5 OUT transfer, holding the transport so a
+// detach can't take it away mid-write
+func (d *Device) writeEP5(ctx context.Context, packet []byte) (int, error) {
+	d.ioMu.RLock()
+	defer d.ioMu.RUnlock()
+	if d.transport == nil {
+		return 0, usbErr(ErrDisconnected)
+	}
+	n, err := d.transport.WriteContext(ctx, packet)
+	if isNoDevice(err) {
+		err = usbErr(fmt.Errorf("failed to write to EP5: %w", err))
+	}
+	return n, err
+}
+
+// sendWithin is SendCtx limited to timeout on top of ctx
+func (d *Device) sendWithin(ctx context.Context, app uint8, cmd uint8, payload []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return d.SendCtx(ctx, app, cmd, payload)
 }
 
 // Recv reads a response from the device via EP5
 // Response format: '@'(1) + app(1) + cmd(1) + length(2 LE) + payload
 func (d *Device) Recv(expectedApp uint8, expectedCmd uint8, timeout time.Duration) ([]byte, error) {
-	d.recvMu.Lock()
-	defer d.recvMu.Unlock()
-
-	if timeout == 0 {
-		timeout = USBDefaultTimeout
-	}
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+	return d.RecvCtx(ctx, expectedApp, expectedCmd)
+}
 
-	deadline := time.Now().Add(timeout)
+// RecvCtx is Recv bounded by ctx; without a deadline it waits until ctx
+// is cancelled
+func (d *Device) RecvCtx(ctx context.Context, expectedApp uint8, expectedCmd uint8) ([]byte, error) {
 	buf := make([]byte, 512) // Match Python's buffer size
-
 	for {
-		if time.Now().After(deadline) {
-			return nil, fmt.Errorf("timeout waiting for response")
+		response, done, err := d.recvSlice(ctx, buf, expectedApp, expectedCmd, "timeout waiting for response")
+		if done {
+			return response, err
 		}
+	}
+}
 
-		// First check if we already have a complete response buffered
-		response, remaining, err := d.parseResponse(expectedApp, expectedCmd)
-		if err == nil {
-			d.recvBuf = remaining
-			return response, nil
-		}
+// recvSlice looks for the app/cmd response in the receive buffer and,
+// if it isn't there yet, reads EP5 for one host read slice. recvMu is
+// held for the slice only, not the whole wait: a receive with no
+// deadline must not hold up every other call on the device, and a
+// response read by one waiter is buffered for the one it belongs to
+// done is false when the caller should try again
+func (d *Device) recvSlice(ctx context.Context, buf []byte, app, cmd uint8, timeoutMsg string) (response []byte, done bool, err error) {
+	d.recvMu.Lock()
+	defer d.recvMu.Unlock()
 
-		// Calculate remaining time for this read operation
-		remaining_time := time.Until(deadline)
-		if remaining_time <= 0 {
-			return nil, fmt.Errorf("timeout waiting for response")
-		}
+	if d.transport == nil {
+		return nil, true, usbErr(ErrDisconnected)
+	}
+	if err := waitErr(ctx, timeoutMsg); err != nil {
+		return nil, true, err
+	}
 
-		// Use a shorter read timeout (100ms) to allow periodic deadline checks
-		readTimeout := 100 * time.Millisecond
-		if remaining_time < readTimeout {
-			readTimeout = remaining_time
+	// First check if we already have a complete response buffered
+	response, remaining, err := d.parseResponse(app, cmd)
+	if err == nil {
+		d.recvBuf = remaining
+		return response, true, nil
+	}
+
+	// Size the read slice from the remaining deadline to allow periodic
+	// deadline checks without constant poll churn on long waits
+	readTimeout := HostReadSliceMax
+	if deadline, ok := ctx.Deadline(); ok {
+		remainingTime := time.Until(deadline)
+		if remainingTime <= 0 {
+			return nil, true, waitErr(ctx, timeoutMsg)
 		}
+		readTimeout = hostReadSlice(remainingTime)
+	}
 
-		// Read from EP5 with context timeout
-		ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
-		n, err := d.epIn.ReadContext(ctx, buf)
-		cancel()
+	// Read from EP5 with a slice timeout; cancelling ctx ends the read early
+	readCtx, cancel := context.WithTimeout(ctx, readTimeout)
+	n, err := d.transport.ReadContext(readCtx, buf)
+	cancel()
 
-		if err != nil {
-			// Check if it's a timeout/canceled error (normal, just retry)
-			if ctx.Err() != nil {
-				// Context was canceled or timed out, this is expected
-				continue
-			}
-			errStr := strings.ToLower(err.Error())
-			if strings.Contains(errStr, "timeout") ||
-				strings.Contains(errStr, "timed out") ||
-				strings.Contains(errStr, "canceled") ||
-				strings.Contains(errStr, "context") ||
-				strings.Contains(errStr, "libusb") {
-				continue
-			}
-			return nil, fmt.Errorf("failed to read from EP5: %w", err)
+	if err != nil {
+		if isNoDevice(err) {
+			return nil, true, usbErr(fmt.Errorf("failed to read from EP5: %w", err))
 		}
-
-		if n == 0 {
-			continue
+		// Check if it's a timeout/canceled error (normal, just retry)
+		if readCtx.Err() != nil {
+			// Context was canceled or timed out, this is expected
+			return nil, false, nil
+		}
+		errStr := strings.ToLower(err.Error())
+		if strings.Contains(errStr, "timeout") ||
+			strings.Contains(errStr, "timed out") ||
+			strings.Contains(errStr, "canceled") ||
+			strings.Contains(errStr, "context") ||
+			strings.Contains(errStr, "libusb") {
+			return nil, false, nil
 		}
+		return nil, true, usbErr(fmt.Errorf("failed to read from EP5: %w", err))
+	}
 
-		// Append to receive buffer
-		d.recvBuf = append(d.recvBuf, buf[:n]...)
+	// Append to receive buffer
+	if n > 0 {
+		d.bufferRead(buf[:n])
 	}
+	return nil, false, nil
 }
 
-// parseResponse attempts to parse a complete response from the buffer
-func (d *Device) parseResponse(expectedApp uint8, expectedCmd uint8) ([]byte, []byte, error) {
-	// Find the response marker '@'
-	markerIdx := -1
-	for i, b := range d.recvBuf {
-		if b == ResponseMarker {
-			markerIdx = i
+// recvBufMax bounds the receive buffer, which holds responses for other
+// commands until a Recv asks for them; past it the oldest are dropped so
+// packets nobody reads can't grow it without limit
+const recvBufMax = 64 * 1024
+
+// bufferRead appends data read from EP5 to the receive buffer, dropping
+// whole frames from the front while it is over recvBufMax
+func (d *Device) bufferRead(data []byte) {
+	d.recvBuf = append(d.recvBuf, data...)
+	if len(d.recvBuf) <= recvBufMax {
+		return
+	}
+	i := bytes.IndexByte(d.recvBuf, ResponseMarker)
+	if i == -1 {
+		i = len(d.recvBuf)
+	}
+	for len(d.recvBuf)-i > recvBufMax && len(d.recvBuf)-i >= 5 {
+		next := i + 5 + int(binary.LittleEndian.Uint16(d.recvBuf[i+3:i+5]))
+		if next > len(d.recvBuf) {
 			break
 		}
+		i = next
 	}
+	d.recvBuf = append(make([]byte, 0, EP5OutBufferSize), d.recvBuf[i:]...)
+}
 
+// parseResponse takes the first complete response from expectedApp and
+// expectedCmd out of the buffer. Frames for other commands ahead of it,
+// such as a packet received while a command was in flight, stay buffered
+// for the Recv that wants them instead of hiding the response
+func (d *Device) parseResponse(expectedApp uint8, expectedCmd uint8) ([]byte, []byte, error) {
+	// Find the response marker '@'
+	markerIdx := bytes.IndexByte(d.recvBuf, ResponseMarker)
 	if markerIdx == -1 {
 		return nil, d.recvBuf, fmt.Errorf("no response marker found")
 	}
 
 	// Discard any data before the marker
-	data := d.recvBuf[markerIdx:]
+	buf := d.recvBuf[markerIdx:]
 
-	// Need at least 5 bytes for header: marker + app + cmd + length(2)
-	if len(data) < 5 {
-		return nil, d.recvBuf, fmt.Errorf("incomplete header")
-	}
+	for i := 0; ; {
+		data := buf[i:]
 
-	// Parse header
-	app := data[1]
-	cmd := data[2]
-	length := binary.LittleEndian.Uint16(data[3:5])
+		// Need at least 5 bytes for header: marker + app + cmd + length(2)
+		if len(data) < 5 {
+			return nil, d.recvBuf, fmt.Errorf("incomplete header")
+		}
 
-	// Check if we have the complete payload
-	totalLen := 5 + int(length)
-	if len(data) < totalLen {
-		return nil, d.recvBuf, fmt.Errorf("incomplete payload: have %d, need %d", len(data), totalLen)
-	}
+		// Parse header
+		app := data[1]
+		cmd := data[2]
+		length := binary.LittleEndian.Uint16(data[3:5])
 
-	// Verify app and cmd match (optional, but useful for debugging)
-	if app != expectedApp || cmd != expectedCmd {
-		// This might be a different response, skip it and look for another
-		return nil, d.recvBuf[markerIdx+1:], fmt.Errorf("response mismatch: got app=0x%02X cmd=0x%02X, expected app=0x%02X cmd=0x%02X",
-			app, cmd, expectedApp, expectedCmd)
-	}
+		// Check if we have the complete payload
+		totalLen := 5 + int(length)
+		if len(data) < totalLen {
+			return nil, d.recvBuf, fmt.Errorf("incomplete payload: have %d, need %d", len(data), totalLen)
+		}
+
+		if app != expectedApp || cmd != expectedCmd {
+			// A different response; look for ours after it
+			next := bytes.IndexByte(data[totalLen:], ResponseMarker)
+			if next == -1 {
+				return nil, d.recvBuf, fmt.Errorf("response mismatch: got app=0x%02X cmd=0x%02X, expected app=0x%02X cmd=0x%02X",
+					app, cmd, expectedApp, expectedCmd)
+			}
+			i += totalLen + next
+			continue
+		}
 
-	// Extract payload
-	payload := make([]byte, length)
-	copy(payload, data[5:totalLen])
+		// Extract payload
+		payload := make([]byte, length)
+		copy(payload, data[5:totalLen])
 
-	// Return remaining data
-	remaining := data[totalLen:]
-	return payload, remaining, nil
+		// Return remaining data, with the frames skipped over kept in order
+		remaining := append(append([]byte(nil), buf[:i]...), data[totalLen:]...)
+		return payload, remaining, nil
+	}
 }
 
 // RecvFromApp receives data from a specific application and queue
 // This is used for spectrum analyzer data which comes from APP_SPECAN
 func (d *Device) RecvFromApp(app uint8, queue uint8, timeout time.Duration) ([]byte, error) {
-	d.recvMu.Lock()
-	defer d.recvMu.Unlock()
-
-	if timeout == 0 {
-		timeout = USBDefaultTimeout
-	}
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+	return d.RecvFromAppCtx(ctx, app, queue)
+}
 
-	deadline := time.Now().Add(timeout)
+// RecvFromAppCtx is RecvFromApp bounded by ctx
+func (d *Device) RecvFromAppCtx(ctx context.Context, app uint8, queue uint8) ([]byte, error) {
 	buf := make([]byte, 512)
-
+	timeoutMsg := fmt.Sprintf("timeout waiting for app 0x%02X data", app)
 	for {
-		if time.Now().After(deadline) {
-			return nil, fmt.Errorf("timeout waiting for app 0x%02X data", app)
-		}
-
-		// Check if we already have a matching response buffered
-		response, remaining, err := d.parseResponseFromApp(app, queue)
-		if err == nil {
-			d.recvBuf = remaining
-			return response, nil
-		}
-
-		// Calculate remaining time
-		remainingTime := time.Until(deadline)
-		if remainingTime <= 0 {
-			return nil, fmt.Errorf("timeout waiting for app 0x%02X data", app)
-		}
-
-		readTimeout := 100 * time.Millisecond
-		if remainingTime < readTimeout {
-			readTimeout = remainingTime
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
-		n, err := d.epIn.ReadContext(ctx, buf)
-		cancel()
-
-		if err != nil {
-			if ctx.Err() != nil {
-				continue
-			}
-			errStr := strings.ToLower(err.Error())
-			if strings.Contains(errStr, "timeout") || strings.Contains(errStr, "canceled") {
-				continue
-			}
-			return nil, fmt.Errorf("failed to read from EP5: %w", err)
+		response, done, err := d.recvSlice(ctx, buf, app, queue, timeoutMsg)
+		if done {
+			return response, err
 		}
-
-		if n > 0 {
-			d.recvBuf = append(d.recvBuf, buf[:n]...)
-		}
-	}
-}
-
-// parseResponseFromApp parses a response for a specific app/queue
-func (d *Device) parseResponseFromApp(app uint8, queue uint8) ([]byte, []byte, error) {
-	// Find the response marker '@'
-	markerIdx := -1
-	for i, b := range d.recvBuf {
-		if b == ResponseMarker {
-			markerIdx = i
-			break
-		}
-	}
-
-	if markerIdx == -1 {
-		return nil, d.recvBuf, fmt.Errorf("no response marker found")
-	}
-
-	data := d.recvBuf[markerIdx:]
-
-	// Need at least 5 bytes for header: marker + app + cmd + length(2)
-	if len(data) < 5 {
-		return nil, d.recvBuf, fmt.Errorf("incomplete header")
-	}
-
-	respApp := data[1]
-	respQueue := data[2]
-	length := binary.LittleEndian.Uint16(data[3:5])
-
-	totalLen := 5 + int(length)
-	if len(data) < totalLen {
-		return nil, d.recvBuf, fmt.Errorf("incomplete payload")
-	}
-
-	// Check if this matches what we're looking for
-	if respApp != app || respQueue != queue {
-		// Skip this response and look for another
-		return nil, d.recvBuf[markerIdx+1:], fmt.Errorf("app/queue mismatch")
 	}
-
-	payload := make([]byte, length)
-	copy(payload, data[5:totalLen])
-
-	remaining := data[totalLen:]
-	return payload, remaining, nil
 }
 
 // Ping sends a ping command and verifies the response
@@ -521,6 +629,7 @@ func (d *Device) Peek(address uint16, length uint16) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("peek failed at 0x%04X: %w", address, err)
 	}
+	d.cache.observe(address, response, false)
 
 	return response, nil
 }
@@ -539,11 +648,18 @@ func (d *Device) PeekByte(address uint16) (uint8, error) {
 
 // Poke writes bytes to device memory using EP5 protocol
 func (d *Device) Poke(address uint16, data []byte) error {
+	if err := d.checkMode(0); err != nil {
+		return fmt.Errorf("poke failed at 0x%04X: %w", address, err)
+	}
+
 	// Payload: address(2 LE) + data
 	payload := make([]byte, 2+len(data))
 	binary.LittleEndian.PutUint16(payload[0:2], address)
 	copy(payload[2:], data)
 
+	// Even a failed poke may have reached the radio
+	d.trackPoke(address, data)
+
 	response, err := d.Send(AppSystem, SysCmdPoke, payload, USBDefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("poke failed at 0x%04X: %w", address, err)
@@ -556,6 +672,7 @@ func (d *Device) Poke(address uint16, data []byte) error {
 			return fmt.Errorf("poke incomplete: %d bytes left", bytesLeft)
 		}
 	}
+	d.cache.observe(address, data, true)
 
 	return nil
 }
@@ -611,6 +728,9 @@ func (d *Device) GetCompiler() (string, error) {
 
 // SetRFMode sets the radio mode (RX, TX, IDLE)
 func (d *Device) SetRFMode(mode uint8) error {
+	if err := d.checkMode(0); err != nil {
+		return fmt.Errorf("failed to set RF mode: %w", err)
+	}
 	_, err := d.Send(AppSystem, SysCmdRFMode, []byte{mode}, USBDefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to set RF mode: %w", err)
@@ -634,15 +754,21 @@ func (d *Device) EP0PeekX(address uint16, length uint16) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("EP0 peek failed at 0x%04X: %w", address, err)
 	}
+	d.cache.observe(address, data, false)
 	return data, nil
 }
 
 // EP0PokeX writes to XDATA memory using EP0 control transfer (alternative method)
 func (d *Device) EP0PokeX(address uint16, data []byte) error {
+	if err := d.checkMode(0); err != nil {
+		return fmt.Errorf("EP0 poke failed at 0x%04X: %w", address, err)
+	}
+	d.trackPoke(address, data)
 	_, err := d.Control(RequestTypeVendorOut, EP0CmdPokeX, address, 0, data)
 	if err != nil {
 		return fmt.Errorf("EP0 poke failed at 0x%04X: %w", address, err)
 	}
+	d.cache.observe(address, data, true)
 	return nil
 }
 
@@ -655,3 +781,106 @@ func (d *Device) GetDebugCodes() (uint8, uint8, error) {
 	}
 	return data[0], data[1], nil
 }
+
+// ClearDebugCodes resets the firmware's last debug/error codes
+func (d *Device) ClearDebugCodes() error {
+	_, err := d.Send(AppSystem, SysCmdClearCodes, []byte{0x00, 0x00}, USBDefaultTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to clear debug codes: %w", err)
+	}
+	return nil
+}
+
+// WriteRaw writes bytes to EP5 exactly as given, without adding the protocol header
+// Intended for protocol testing; normal callers should use Send
+func (d *Device) WriteRaw(packet []byte, timeout time.Duration) (int, error) {
+	if timeout == 0 {
+		timeout = USBDefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	n, err := d.writeEP5(ctx, packet)
+	if errors.Is(err, ErrDisconnected) {
+		return n, err
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return n, usbErr(fmt.Errorf("write timeout: %w", err))
+		}
+		return n, usbErr(fmt.Errorf("failed to write to EP5: %w", err))
+	}
+	return n, nil
+}
+
+// ReadRaw collects whatever the device sends on EP5 until timeout elapses
+// Any partially parsed responses in the internal buffer are returned first and discarded
+func (d *Device) ReadRaw(timeout time.Duration) ([]byte, error) {
+	d.recvMu.Lock()
+	defer d.recvMu.Unlock()
+
+	if d.transport == nil {
+		return nil, usbErr(ErrDisconnected)
+	}
+	out := append([]byte(nil), d.recvBuf...)
+	d.recvBuf = d.recvBuf[:0]
+
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 512)
+	for time.Now().Before(deadline) {
+		readTimeout := hostReadSlice(time.Until(deadline))
+
+		ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
+		n, err := d.transport.ReadContext(ctx, buf)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil && !isNoDevice(err) {
+				continue
+			}
+			return out, usbErr(fmt.Errorf("failed to read from EP5: %w", err))
+		}
+		out = append(out, buf[:n]...)
+	}
+	return out, nil
+}
+
+// timeoutContext returns a context for the blocking calls that take a
+// timeout, with 0 meaning USBDefaultTimeout
+func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = USBDefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// waitErr returns nil while ctx is live, msg wrapping the deadline error
+// once it expires, or the cancellation error
+func waitErr(ctx context.Context, msg string) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%s: %w", msg, ctx.Err())
+	default:
+		return fmt.Errorf("receive canceled: %w", ctx.Err())
+	}
+}
+
+// hostReadSlice splits the remaining receive deadline into host EP5 read
+// slices; nothing about it reaches the firmware
+// A bulk read returns as soon as data arrives, so longer slices only cost
+// responsiveness to the deadline itself; a quarter of the remaining time
+// keeps the final timeout accurate while idle listeners wake up rarely
+func hostReadSlice(remaining time.Duration) time.Duration {
+	slice := remaining / 4
+	if slice < HostReadSliceMin {
+		slice = HostReadSliceMin
+	}
+	if slice > HostReadSliceMax {
+		slice = HostReadSliceMax
+	}
+	if remaining < slice {
+		slice = remaining
+	}
+	return slice
+}
@@ -0,0 +1,50 @@
+package yardstick
+
+import (
+	"context"
+
+	"github.com/google/gousb"
+)
+
+// DeviceIO is the transport under a Device: bulk transfers on EP5 and
+// vendor control transfers on EP0
+// Framing, response parsing and everything above it stay in Device, so a
+// transport only moves bytes. pkg/yardstick/mock simulates a dongle here
+type DeviceIO interface {
+	// ReadContext reads what the dongle has sent on EP5 IN, blocking
+	// until data arrives or ctx is done
+	ReadContext(ctx context.Context, buf []byte) (int, error)
+	// WriteContext writes an EP5 OUT transfer
+	WriteContext(ctx context.Context, buf []byte) (int, error)
+	// Control performs an EP0 control transfer
+	Control(requestType uint8, request uint8, value uint16, index uint16, data []byte) (int, error)
+	// Close releases the transport
+	Close() error
+}
+
+// usbIO is the DeviceIO of a dongle opened through gousb
+type usbIO struct {
+	dev    *gousb.Device
+	config *gousb.Config
+	iface  *gousb.Interface
+	epIn   *gousb.InEndpoint
+	epOut  *gousb.OutEndpoint
+}
+
+func (u *usbIO) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	return u.epIn.ReadContext(ctx, buf)
+}
+
+func (u *usbIO) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	return u.epOut.WriteContext(ctx, buf)
+}
+
+func (u *usbIO) Control(requestType uint8, request uint8, value uint16, index uint16, data []byte) (int, error) {
+	return u.dev.Control(requestType, request, value, index, data)
+}
+
+func (u *usbIO) Close() error {
+	u.iface.Close()
+	u.config.Close()
+	return u.dev.Close()
+}
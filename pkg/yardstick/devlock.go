@@ -0,0 +1,157 @@
+package yardstick
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrDeviceLocked is matched by errors.Is when another process holds the
+// device lock; use errors.As with *LockedError for the owner
+var ErrDeviceLocked = errors.New("device locked")
+
+// LockedError reports a device reserved by another process
+type LockedError struct {
+	Device string
+	PID    int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID <= 0 {
+		return fmt.Sprintf("device %s locked", e.Device)
+	}
+	return fmt.Sprintf("device %s locked by process %d", e.Device, e.PID)
+}
+
+// Is makes errors.Is(err, ErrDeviceLocked) match
+func (e *LockedError) Is(target error) bool {
+	return target == ErrDeviceLocked
+}
+
+// DeviceLock is an advisory cross-process reservation of one dongle
+// Unlike a Lease it is visible to other gocat processes, so test
+// harnesses sharing a host can split the attached devices between them
+type DeviceLock struct {
+	Device string
+	path   string
+}
+
+// LockDir returns the directory holding device lock files
+// GOCAT_LOCK_DIR overrides the default of <temp dir>/gocat-locks
+func LockDir() string {
+	if dir := os.Getenv("GOCAT_LOCK_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "gocat-locks")
+}
+
+// LockID returns the name a device is locked under: its serial number,
+// or bus:address when it has none
+func (d *Device) LockID() string {
+	if d.Serial != "" {
+		return d.Serial
+	}
+	return fmt.Sprintf("%d:%d", d.Bus, d.Address)
+}
+
+// Lock reserves the device for this process
+func (d *Device) Lock() (*DeviceLock, error) {
+	return LockDevice(d.LockID())
+}
+
+// LockDevice reserves the device with the given lock ID for this process
+// A lock left behind by a process that has exited is taken over
+func LockDevice(id string) (*DeviceLock, error) {
+	dir := LockDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	path := filepath.Join(dir, strings.NewReplacer("/", "_", ":", "-").Replace(id)+".lock")
+
+	// One retry after clearing a stale lock
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return &DeviceLock{Device: id, path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		// An unreadable PID may be a lock still being written
+		pid := lockOwner(path)
+		if pid <= 0 || processAlive(pid) {
+			return nil, &LockedError{Device: id, PID: pid}
+		}
+		os.Remove(path)
+	}
+	return nil, &LockedError{Device: id, PID: lockOwner(path)}
+}
+
+// Unlock releases the reservation
+func (l *DeviceLock) Unlock() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// lockOwner returns the PID recorded in a lock file, or 0
+func lockOwner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// LockInfo describes a lock file in LockDir
+type LockInfo struct {
+	Device string `json:"device"` // Lock file name without the extension
+	PID    int    `json:"pid"`
+	Stale  bool   `json:"stale,omitempty"` // Owner has exited; the next LockDevice takes it over
+}
+
+// ListLocks returns the lock files in LockDir
+func ListLocks() ([]LockInfo, error) {
+	entries, err := os.ReadDir(LockDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock directory: %w", err)
+	}
+	var locks []LockInfo
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".lock")
+		if !ok {
+			continue
+		}
+		pid := lockOwner(filepath.Join(LockDir(), e.Name()))
+		locks = append(locks, LockInfo{Device: name, PID: pid, Stale: pid > 0 && !processAlive(pid)})
+	}
+	return locks, nil
+}
@@ -0,0 +1,67 @@
+package yardstick
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/gousb"
+)
+
+// Error classes, for errors.Is
+var (
+	// ErrDeviceNotFound means no device matched the selector
+	ErrDeviceNotFound = errors.New("no YardStick One devices found")
+
+	// ErrUSB means a USB open, claim or transfer failed
+	ErrUSB = errors.New("USB error")
+
+	// ErrDisconnected means the device was unplugged and has not been
+	// reopened by a Monitor yet; it also matches ErrUSB
+	ErrDisconnected = errors.New("device disconnected")
+
+	// ErrPermission means the USB device node is not accessible to this
+	// user, usually because the udev rule is missing; it also matches ErrUSB
+	ErrPermission = errors.New("USB permission denied")
+
+	// ErrKernelDriver means a kernel driver is bound to the interface and
+	// could not be detached; it also matches ErrUSB
+	ErrKernelDriver = errors.New("kernel driver attached")
+
+	// ErrDeviceBusy means another program has claimed the interface; it
+	// also matches ErrUSB
+	ErrDeviceBusy = errors.New("device busy")
+
+	// ErrBootloader means the only dongles found are running their
+	// bootloader; it also matches ErrDeviceNotFound
+	ErrBootloader = errors.New("device in bootloader mode")
+)
+
+// usbError marks an error as ErrUSB without changing its message
+type usbError struct {
+	err error
+}
+
+func (e *usbError) Error() string { return e.err.Error() }
+
+func (e *usbError) Unwrap() error { return e.err }
+
+func (e *usbError) Is(target error) bool { return target == ErrUSB }
+
+// usbErr wraps err as an ErrUSB, and also as ErrDisconnected when libusb
+// says the dongle has left the bus
+func usbErr(err error) error {
+	if isNoDevice(err) && !errors.Is(err, ErrDisconnected) {
+		err = fmt.Errorf("%w: %w", ErrDisconnected, err)
+	}
+	return &usbError{err}
+}
+
+// isNoDevice reports whether a transfer failed because the dongle is gone
+func isNoDevice(err error) bool {
+	var code gousb.Error
+	if errors.As(err, &code) && code == gousb.ErrorNoDevice {
+		return true
+	}
+	var status gousb.TransferStatus
+	return errors.As(err, &status) && status == gousb.TransferNoDevice
+}
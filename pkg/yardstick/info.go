@@ -0,0 +1,91 @@
+package yardstick
+
+// DeviceInfo describes a connected device for listings
+type DeviceInfo struct {
+	Serial       string       `json:"serial"`
+	Bus          int          `json:"bus"`
+	Address      int          `json:"address"`
+	Manufacturer string       `json:"manufacturer"`
+	Product      string       `json:"product"`
+	ProductID    uint16       `json:"product_id"`
+	Capabilities Capabilities `json:"capabilities"`
+	Firmware     string       `json:"firmware,omitempty"`
+	PartNum      uint8        `json:"part_num,omitempty"`
+	Chip         string       `json:"chip,omitempty"`
+}
+
+// Info returns the USB descriptor details and board capabilities of the
+// device. With query set it also asks the firmware for its build and
+// chip; fields it can't read are left empty
+func (d *Device) Info(query bool) DeviceInfo {
+	info := DeviceInfo{
+		Serial:       d.Serial,
+		Bus:          d.Bus,
+		Address:      d.Address,
+		Manufacturer: d.Manufacturer,
+		Product:      d.Product,
+		ProductID:    d.ProductID,
+		Capabilities: d.Capabilities(),
+	}
+	if !query {
+		return info
+	}
+	if build, err := d.GetBuildType(); err == nil {
+		info.Firmware = build
+	}
+	if partNum, err := d.GetPartNum(); err == nil {
+		info.PartNum = partNum
+		info.Chip = ChipName(partNum)
+	}
+	return info
+}
+
+// ChipName returns the chip name for a PARTNUM value
+func ChipName(partNum uint8) string {
+	switch partNum {
+	case PartNumCC1110:
+		return "CC1110"
+	case PartNumCC1111:
+		return "CC1111"
+	case PartNumCC2510:
+		return "CC2510"
+	case PartNumCC2511:
+		return "CC2511"
+	}
+	return "Unknown"
+}
+
+// CrystalHzFor returns the crystal frequency of a PARTNUM value: 26 MHz
+// for the 2.4 GHz CC2510/CC2511, 24 MHz otherwise
+func CrystalHzFor(partNum uint8) uint32 {
+	switch partNum {
+	case PartNumCC2510, PartNumCC2511:
+		return CrystalFreqHz2511
+	}
+	return CrystalFreqHz
+}
+
+// CrystalHz returns the crystal frequency of the device's chip, which
+// all frequency, data rate and bandwidth register math scales with.
+// The part number is read on first use; CrystalFreqHz is assumed while
+// it can't be
+func (d *Device) CrystalHz() uint32 {
+	if hz := d.crystalHz.Load(); hz != 0 {
+		return hz
+	}
+	partNum, err := d.GetPartNum()
+	if err != nil {
+		return CrystalFreqHz
+	}
+	hz := CrystalHzFor(partNum)
+	d.crystalHz.Store(hz)
+	return hz
+}
+
+// knownCrystalHz is CrystalHz without USB traffic, for cached state
+func (d *Device) knownCrystalHz() uint32 {
+	if hz := d.crystalHz.Load(); hz != 0 {
+		return hz
+	}
+	return CrystalFreqHz
+}
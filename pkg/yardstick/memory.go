@@ -0,0 +1,73 @@
+package yardstick
+
+import "fmt"
+
+// Largest single EP5 peek/poke transfers. A poke carries the 4-byte
+// command header and 2-byte address in the firmware's OUT buffer
+const (
+	PeekMaxChunk = 512
+	PokeMaxChunk = EP5OutBufferSize - 4 - 2
+)
+
+// ProgressFunc is called after each chunk of a range transfer
+type ProgressFunc func(done, total int)
+
+// PeekRange reads length bytes starting at address, split into
+// PeekMaxChunk transfers. progress may be nil
+func (d *Device) PeekRange(address uint16, length int, progress ProgressFunc) ([]byte, error) {
+	if err := checkRange(address, length); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		n := length - len(out)
+		if n > PeekMaxChunk {
+			n = PeekMaxChunk
+		}
+		addr := address + uint16(len(out))
+		chunk, err := d.Peek(addr, uint16(n))
+		if err != nil {
+			return out, err
+		}
+		if len(chunk) < n {
+			return out, fmt.Errorf("short peek at 0x%04X: got %d of %d bytes", addr, len(chunk), n)
+		}
+		out = append(out, chunk[:n]...)
+		if progress != nil {
+			progress(len(out), length)
+		}
+	}
+	return out, nil
+}
+
+// PokeRange writes data starting at address, split into PokeMaxChunk
+// transfers. progress may be nil
+func (d *Device) PokeRange(address uint16, data []byte, progress ProgressFunc) error {
+	if err := checkRange(address, len(data)); err != nil {
+		return err
+	}
+
+	for done := 0; done < len(data); {
+		n := len(data) - done
+		if n > PokeMaxChunk {
+			n = PokeMaxChunk
+		}
+		if err := d.Poke(address+uint16(done), data[done:done+n]); err != nil {
+			return err
+		}
+		done += n
+		if progress != nil {
+			progress(done, len(data))
+		}
+	}
+	return nil
+}
+
+// checkRange rejects ranges that would run past the 64K XDATA space
+func checkRange(address uint16, length int) error {
+	if length < 0 || int(address)+length > 0x10000 {
+		return fmt.Errorf("range 0x%04X+%d exceeds 64K address space", address, length)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/pkg/config"
+	"github.com/herlein/gocat/pkg/profiles"
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+func TestRecvWithoutDeadlineLeavesDeviceUsable(t *testing.T) {
+	_, b := Pair()
+	defer b.Close()
+	listen(t, b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.RFRecvCtx(ctx, 0)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := b.PeekByte(yardstick.RegMARCSTATE); err != nil {
+		t.Fatalf("peek during receive: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("peek during receive took %v", d)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("receive returned %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("receive did not return after cancel")
+	}
+}
+
+func TestCancelledTxBudgetWaitRefunds(t *testing.T) {
+	_, b := Pair()
+	defer b.Close()
+	l, err := yardstick.NewTxLimiter(yardstick.TxLimitConfig{PacketsPerSec: 1, PacketBurst: 1, Block: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetTxLimiter(l)
+
+	if err := b.RFXmit([]byte{1, 2, 3}, 0, 0); err != nil {
+		t.Fatalf("first transmit: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = b.RFXmitCtx(ctx, []byte{1, 2, 3}, 0, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("transmit returned %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("cancelled transmit took %v", d)
+	}
+	if st := l.State(); st.PacketTokens < 0 {
+		t.Errorf("packet tokens %.2f after cancel, want the reservation refunded", st.PacketTokens)
+	}
+}
+
+func TestLeaseRejectsOtherHandles(t *testing.T) {
+	_, b := Pair()
+	defer b.Close()
+
+	lease, err := b.Acquire(yardstick.ModeRX, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var busy *yardstick.BusyError
+	if err := b.RFXmit([]byte{1, 2, 3}, 0, 0); !errors.As(err, &busy) || busy.Holder != "test" {
+		t.Errorf("transmit under another's lease returned %v, want BusyError", err)
+	}
+	if err := b.SetFrequency(433920000); !errors.Is(err, yardstick.ErrRadioBusy) {
+		t.Errorf("SetFrequency under another's lease returned %v, want ErrRadioBusy", err)
+	}
+	if err := b.PokeByte(yardstick.RegRFST, 0x04); !errors.Is(err, yardstick.ErrRadioBusy) {
+		t.Errorf("poke under another's lease returned %v, want ErrRadioBusy", err)
+	}
+
+	holder := lease.Device()
+	if err := holder.SetFrequency(433920000); err != nil {
+		t.Errorf("SetFrequency by the holder: %v", err)
+	}
+	if err := holder.RFXmit([]byte{1, 2, 3}, 0, 0); err != nil {
+		t.Errorf("transmit by the holder: %v", err)
+	}
+
+	if err := lease.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetFrequency(433920000); err != nil {
+		t.Errorf("SetFrequency after release: %v", err)
+	}
+}
+
+func TestSettersKeepAirtimeAndPacketFormatCurrent(t *testing.T) {
+	_, b := Pair()
+	defer b.Close()
+	if err := config.ApplyProfile(b, profiles.New433GFSKCRC(38400, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	before := b.Airtime(32)
+	if err := b.SetDataRate(9600); err != nil {
+		t.Fatal(err)
+	}
+	if after := b.Airtime(32); after < 3*before {
+		t.Errorf("airtime at 9600 baud is %v, was %v at 38400", after, before)
+	}
+
+	if err := b.PokeByte(0xDF02, 20); err != nil { // PKTLEN
+		t.Fatal(err)
+	}
+	if f := b.PacketFormat(); f == nil || f.PktLen != 20 {
+		t.Errorf("packet format after PKTLEN poke is %+v, want PktLen 20", f)
+	}
+}
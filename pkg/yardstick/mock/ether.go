@@ -0,0 +1,68 @@
+package mock
+
+import (
+	"sync"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// Ether is the shared medium between dongles
+// A transmitted packet reaches every other attached dongle that is in RX
+// on the same frequency, channel and sync word
+type Ether struct {
+	// Drop, if set, decides whether a packet is lost on its way from one
+	// dongle to another; use it to simulate packet loss
+	Drop func(from, to *Dongle, data []byte) bool
+
+	mu      sync.Mutex
+	dongles []*Dongle
+}
+
+// NewEther creates an empty medium
+func NewEther() *Ether {
+	return &Ether{}
+}
+
+// Attach connects a dongle to the medium
+func (e *Ether) Attach(m *Dongle) {
+	e.mu.Lock()
+	e.dongles = append(e.dongles, m)
+	e.mu.Unlock()
+
+	m.mu.Lock()
+	m.ether = e
+	m.mu.Unlock()
+}
+
+// transmit delivers a packet from one dongle to the listening others
+func (e *Ether) transmit(from *Dongle, data []byte) {
+	from.mu.Lock()
+	ch := from.channel()
+	from.mu.Unlock()
+
+	e.mu.Lock()
+	dongles := append([]*Dongle(nil), e.dongles...)
+	drop := e.Drop
+	e.mu.Unlock()
+
+	for _, to := range dongles {
+		if to == from || (drop != nil && drop(from, to, data)) {
+			continue
+		}
+		to.mu.Lock()
+		if to.channel() == ch {
+			to.receive(data)
+		}
+		to.mu.Unlock()
+	}
+}
+
+// Pair returns two opened devices on a shared Ether, for loopback tests
+func Pair() (*yardstick.Device, *yardstick.Device) {
+	ether := NewEther()
+	a := NewDongle("MOCK0001")
+	b := NewDongle("MOCK0002")
+	ether.Attach(a)
+	ether.Attach(b)
+	return a.Open(), b.Open()
+}
@@ -0,0 +1,155 @@
+package mock
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// listen puts a device in RX
+func listen(t *testing.T, d *yardstick.Device) {
+	t.Helper()
+	if err := d.SetModeRX(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recv returns the next packet, or nil if none arrives in timeout
+func recv(d *yardstick.Device, timeout time.Duration) []byte {
+	data, err := d.RFRecv(timeout, 0)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func TestPairBothWays(t *testing.T) {
+	a, b := Pair()
+	defer a.Close()
+	defer b.Close()
+
+	listen(t, b)
+	if err := a.RFXmit([]byte("ping"), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(b, time.Second); !bytes.Equal(got, []byte("ping")) {
+		t.Fatalf("b received %q, want %q", got, "ping")
+	}
+
+	listen(t, a)
+	if err := b.RFXmit([]byte("pong"), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(a, time.Second); !bytes.Equal(got, []byte("pong")) {
+		t.Fatalf("a received %q, want %q", got, "pong")
+	}
+}
+
+func TestEtherSkipsSender(t *testing.T) {
+	ether := NewEther()
+	a, b := NewDongle("A"), NewDongle("B")
+	ether.Attach(a)
+	ether.Attach(b)
+	da, db := a.Open(), b.Open()
+	listen(t, da)
+	listen(t, db)
+
+	if err := da.RFXmit([]byte{1, 2, 3}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(db, time.Second); !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("b received %v", got)
+	}
+	if got := recv(da, 50*time.Millisecond); got != nil {
+		t.Errorf("sender heard its own packet %v", got)
+	}
+	if sent := a.Sent(); len(sent) != 1 || !bytes.Equal(sent[0], []byte{1, 2, 3}) {
+		t.Errorf("a.Sent() = %v", sent)
+	}
+}
+
+func TestEtherChannelFiltering(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		addr uint16
+		v    uint8
+	}{
+		{"frequency", yardstick.RegFREQ0, 0x55},
+		{"channel", regCHANNR, 3},
+		{"sync word", regSYNC0, 0x12},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := Pair()
+			listen(t, b)
+			if err := b.PokeByte(tc.addr, tc.v); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.RFXmit([]byte("x"), 0, 0); err != nil {
+				t.Fatal(err)
+			}
+			if got := recv(b, 50*time.Millisecond); got != nil {
+				t.Errorf("received %q across a different %s", got, tc.name)
+			}
+
+			// Matching the sender again restores delivery
+			if err := a.PokeByte(tc.addr, tc.v); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.RFXmit([]byte("y"), 0, 0); err != nil {
+				t.Fatal(err)
+			}
+			if got := recv(b, time.Second); !bytes.Equal(got, []byte("y")) {
+				t.Errorf("received %q on the same %s, want %q", got, tc.name, "y")
+			}
+		})
+	}
+}
+
+func TestEtherNeedsRX(t *testing.T) {
+	a, b := Pair()
+	if err := a.RFXmit([]byte("lost"), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	listen(t, b)
+	if got := recv(b, 50*time.Millisecond); got != nil {
+		t.Errorf("idle receiver got %q", got)
+	}
+}
+
+func TestEtherDrop(t *testing.T) {
+	ether := NewEther()
+	a, b := NewDongle("A"), NewDongle("B")
+	ether.Attach(a)
+	ether.Attach(b)
+	ether.Drop = func(from, to *Dongle, data []byte) bool {
+		return data[0] == 0
+	}
+	da, db := a.Open(), b.Open()
+	listen(t, db)
+
+	for _, v := range []byte{0, 1} {
+		if err := da.RFXmit([]byte{v}, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := recv(db, time.Second); !bytes.Equal(got, []byte{1}) {
+		t.Errorf("received %v, want only the packet Drop kept", got)
+	}
+}
+
+func TestInject(t *testing.T) {
+	m := NewDongle("A")
+	d := m.Open()
+	if m.Inject([]byte("early")) {
+		t.Error("Inject delivered to an idle radio")
+	}
+	listen(t, d)
+	if !m.Inject([]byte("hello")) {
+		t.Fatal("Inject dropped a packet in RX")
+	}
+	if got := recv(d, time.Second); !bytes.Equal(got, []byte("hello")) {
+		t.Errorf("received %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package mock
+
+import (
+	"encoding/binary"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// fhssState is the firmware's MAC data as far as the host can see it
+// Hopping is not timed; the channel only changes on NextChannel and
+// ChangeChannel
+type fhssState struct {
+	channels  []uint8
+	idx       uint16
+	state     uint8
+	hopping   bool
+	hops      uint16
+	threshold uint32
+	period    uint16
+}
+
+// fhssCommand handles the FHSS commands on APP_NIC
+// ok is false for commands that are not FHSS commands
+func (m *Dongle) fhssCommand(cmd uint8, payload []byte) (resp []byte, tx [][]byte, ok bool) {
+	f := &m.fhss
+	switch cmd {
+	case yardstick.FHSSSetChannels:
+		if len(payload) >= 2 {
+			n := int(binary.LittleEndian.Uint16(payload[0:2]))
+			if n > len(payload)-2 {
+				n = len(payload) - 2
+			}
+			f.channels = append([]uint8(nil), payload[2:2+n]...)
+			f.idx = 0
+		}
+	case yardstick.FHSSGetChannels:
+		resp = append([]byte(nil), f.channels...)
+	case yardstick.FHSSNextChannel:
+		if len(f.channels) > 0 {
+			m.hop((f.idx + 1) % uint16(len(f.channels)))
+		}
+		resp = []byte{m.mem[regCHANNR]}
+	case yardstick.FHSSChangeChannel:
+		if len(payload) > 0 {
+			if int(payload[0]) < len(f.channels) {
+				m.hop(uint16(payload[0]))
+			} else {
+				m.mem[regCHANNR] = payload[0]
+			}
+		}
+	case yardstick.FHSSStartHopping:
+		f.hopping = true
+	case yardstick.FHSSStopHopping:
+		f.hopping = false
+	case yardstick.FHSSGetState:
+		resp = []byte{f.state}
+	case yardstick.FHSSSetState:
+		if len(payload) > 0 {
+			f.state = payload[0]
+		}
+	case yardstick.FHSSStartSync:
+		f.state = yardstick.MACStateSynching
+	case yardstick.FHSSXmit:
+		if len(payload) > 0 {
+			n := int(payload[0])
+			if n > len(payload)-1 {
+				n = len(payload) - 1
+			}
+			tx = [][]byte{m.transmit(payload[1 : 1+n])}
+		}
+	case yardstick.FHSSGetMACData:
+		// MAC_DATA_t, see fhss.MACData
+		resp = make([]byte, 27)
+		resp[0] = f.state
+		binary.LittleEndian.PutUint16(resp[3:5], f.idx)
+		binary.LittleEndian.PutUint16(resp[5:7], uint16(len(f.channels)))
+		binary.LittleEndian.PutUint16(resp[7:9], f.hops)
+		binary.LittleEndian.PutUint32(resp[15:19], f.threshold)
+	case yardstick.FHSSSetMACData:
+		if len(payload) >= 19 {
+			f.state = payload[0]
+			if idx := binary.LittleEndian.Uint16(payload[3:5]); int(idx) < len(f.channels) {
+				f.idx = idx
+				m.mem[regCHANNR] = f.channels[idx]
+			}
+			f.hops = binary.LittleEndian.Uint16(payload[7:9])
+			f.threshold = binary.LittleEndian.Uint32(payload[15:19])
+		}
+	case yardstick.FHSSSetMACThreshold:
+		if len(payload) >= 4 {
+			f.threshold = binary.LittleEndian.Uint32(payload)
+		}
+	case yardstick.FHSSGetMACThreshold:
+		resp = binary.LittleEndian.AppendUint32(nil, f.threshold)
+	case yardstick.FHSSSetMACPeriod:
+		if len(payload) >= 2 {
+			f.period = binary.LittleEndian.Uint16(payload)
+		}
+	default:
+		return nil, nil, false
+	}
+	return resp, tx, true
+}
+
+// hop moves to an index of the hop sequence
+func (m *Dongle) hop(idx uint16) {
+	m.fhss.idx = idx
+	m.fhss.hops++
+	m.mem[regCHANNR] = m.fhss.channels[idx]
+}
@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/herlein/gocat/pkg/fhss"
+)
+
+func TestFHSSTransmitFollowsHop(t *testing.T) {
+	a, b := Pair()
+	fa, fb := fhss.New(a), fhss.New(b)
+	channels := []uint8{4, 9, 2}
+	for _, f := range []*fhss.FHSS{fa, fb} {
+		if err := f.SetChannels(channels); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.ChangeChannel(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listen(t, b)
+
+	// In step: both on channel 4
+	if err := fa.Transmit([]byte("hop0")); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(b, time.Second); !bytes.Equal(got, []byte("hop0")) {
+		t.Fatalf("received %q, want %q", got, "hop0")
+	}
+
+	// a hops to channel 9 and b doesn't: nothing gets through
+	ch, err := fa.NextChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch != channels[1] {
+		t.Errorf("NextChannel = %d, want %d", ch, channels[1])
+	}
+	if err := fa.Transmit([]byte("hop1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(b, 50*time.Millisecond); got != nil {
+		t.Errorf("received %q on a different hop channel", got)
+	}
+
+	// b catches up
+	if _, err := fb.NextChannel(); err != nil {
+		t.Fatal(err)
+	}
+	listen(t, b)
+	if err := fa.Transmit([]byte("hop1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(b, time.Second); !bytes.Equal(got, []byte("hop1")) {
+		t.Errorf("received %q, want %q", got, "hop1")
+	}
+}
+
+func TestFHSSChannelsAndMACData(t *testing.T) {
+	a, _ := Pair()
+	f := fhss.New(a)
+	channels := []uint8{1, 5, 7, 3}
+	if err := f.SetChannels(channels); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.GetChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, channels) {
+		t.Errorf("GetChannels = %v, want %v", got, channels)
+	}
+
+	// NextChannel wraps around the sequence
+	for i := 1; i <= len(channels); i++ {
+		ch, err := f.NextChannel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := channels[i%len(channels)]; ch != want {
+			t.Errorf("hop %d on channel %d, want %d", i, ch, want)
+		}
+	}
+	md, err := f.GetMACData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.NumChannels != uint16(len(channels)) || md.NumChannelHops != uint16(len(channels)) {
+		t.Errorf("MAC data = %+v", md)
+	}
+}
@@ -0,0 +1,410 @@
+// Package mock simulates a YardStick One behind yardstick.DeviceIO so code
+// built on *yardstick.Device can run without hardware
+//
+// A Dongle speaks the EP5 protocol: it parses command frames, answers with
+// '@'-framed responses, keeps XDATA memory with the radio registers at
+// 0xDF00, moves MARCSTATE on RFST strobes and RFMODE commands, and hands
+// transmitted packets to the other dongles on its Ether. Packets arrive
+// instantly and bit-exact; there is no modulation, noise or airtime.
+//
+//	a, b := mock.Pair()
+//	b.SetModeRX()
+//	a.RFXmit([]byte("hello"), 0, 0)
+//	data, _ := b.RFRecv(time.Second, 0)
+package mock
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/herlein/gocat/pkg/yardstick"
+)
+
+// ErrClosed is returned by transfers on a closed dongle
+var ErrClosed = errors.New("mock dongle closed")
+
+// DefaultBuild is the firmware build string a Dongle reports
+const DefaultBuild = "YARDSTICKONE r0543"
+
+// Register addresses the simulation acts on
+const (
+	regSYNC1     = 0xDF00
+	regSYNC0     = 0xDF01
+	regCHANNR    = 0xDF06
+	regPARTNUM   = 0xDF36
+	regLQI       = 0xDF39
+	regRSSI      = 0xDF3A
+	regPKTSTATUS = 0xDF3C
+)
+
+// marcStateFSTXON is MARCSTATE after an SFSTXON strobe
+const marcStateFSTXON = 0x12
+
+// resetRegisters are the CC1111 power-on values of 0xDF00-0xDF3D
+var resetRegisters = [...]uint8{
+	0xD3, 0x91, 0xFF, 0x04, 0x45, 0x00, 0x00, 0x0F, // SYNC1 .. FSCTRL0
+	0x00, 0x5E, 0xC4, 0xEC, 0x8C, 0x22, 0x02, 0x22, // FREQ2 .. MDMCFG1
+	0xF8, 0x47, 0x07, 0x30, 0x04, 0x36, 0x6C, 0x03, // MDMCFG0 .. AGCCTRL2
+	0x40, 0x91, 0x56, 0x10, 0xA9, 0x0A, 0x20, 0x0D, // AGCCTRL1 .. FSCAL0
+	0x00, 0x00, 0x00, 0x88, 0x31, 0x0B, 0x00, 0x00, // reserved, TEST2 .. PA_TABLE7
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // PA_TABLE6 .. IOCFG2
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x11, 0x03, // IOCFG1 .. VERSION
+	0x00, 0x00, 0x80, yardstick.MarcStateIdle, 0x00, 0x00, // FREQEST .. VCO_VC_DAC
+}
+
+// Dongle is a simulated YardStick One; it implements yardstick.DeviceIO
+type Dongle struct {
+	Serial string
+	Build  string
+	// RSSI is the raw RSSI register value reported for received packets
+	RSSI uint8
+
+	mu      sync.Mutex
+	mem     [0x10000]byte
+	in      []byte        // Partial EP5 OUT frame
+	out     []byte        // EP5 IN bytes not yet read
+	ready   chan struct{} // Signalled when out grows
+	closed  bool
+	ether   *Ether
+	aesMode uint8
+	ampMode uint8
+	longBuf []byte // RFXmitLong data being assembled
+	longLen int
+	sent    [][]byte
+	fhss    fhssState
+}
+
+// NewDongle creates a dongle with power-on register values
+func NewDongle(serial string) *Dongle {
+	m := &Dongle{
+		Serial: serial,
+		Build:  DefaultBuild,
+		RSSI:   0x40,
+		ready:  make(chan struct{}, 1),
+	}
+	copy(m.mem[regSYNC1:], resetRegisters[:])
+	return m
+}
+
+// Open returns a Device talking to the dongle
+func (m *Dongle) Open() *yardstick.Device {
+	d := yardstick.NewDevice(m)
+	d.Serial = m.Serial
+	d.Manufacturer = "Great Scott Gadgets"
+	d.Product = "YARD Stick One (mock)"
+	return d
+}
+
+// Register returns the byte at an XDATA address
+func (m *Dongle) Register(addr uint16) uint8 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mem[addr]
+}
+
+// SetRegister writes an XDATA address without going through the protocol
+func (m *Dongle) SetRegister(addr uint16, v uint8) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mem[addr] = v
+}
+
+// MARCSTATE returns the simulated radio state
+func (m *Dongle) MARCSTATE() uint8 {
+	return m.Register(yardstick.RegMARCSTATE)
+}
+
+// Sent returns the packets the dongle has transmitted
+func (m *Dongle) Sent() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]byte(nil), m.sent...)
+}
+
+// Inject queues a packet as if it had been received over the air
+// It is dropped, and false returned, unless the radio is in RX
+func (m *Dongle) Inject(data []byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.receive(data)
+}
+
+// ReadContext implements yardstick.DeviceIO
+func (m *Dongle) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return 0, ErrClosed
+		}
+		if len(m.out) > 0 {
+			n := copy(buf, m.out)
+			m.out = m.out[n:]
+			m.mu.Unlock()
+			return n, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.ready:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// WriteContext implements yardstick.DeviceIO; each complete command frame
+// is executed as soon as it arrives
+func (m *Dongle) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return 0, ErrClosed
+	}
+	m.in = append(m.in, buf...)
+
+	var tx [][]byte
+	for len(m.in) >= 4 {
+		n := 4 + int(binary.LittleEndian.Uint16(m.in[2:4]))
+		if len(m.in) < n {
+			break
+		}
+		frame := m.in[:n]
+		m.in = m.in[n:]
+		if data := m.execute(frame[0], frame[1], frame[4:]); data != nil {
+			tx = append(tx, data...)
+		}
+	}
+	ether := m.ether
+	m.mu.Unlock()
+
+	// Deliver outside the lock; receivers take their own
+	if ether != nil {
+		for _, data := range tx {
+			ether.transmit(m, data)
+		}
+	}
+	return len(buf), nil
+}
+
+// Control implements yardstick.DeviceIO for the EP0 vendor requests
+func (m *Dongle) Control(requestType uint8, request uint8, value uint16, index uint16, data []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	switch request {
+	case yardstick.EP0CmdPeekX:
+		return copy(data, m.mem[value:]), nil
+	case yardstick.EP0CmdPokeX:
+		for i, b := range data {
+			m.poke(value+uint16(i), b)
+		}
+		return len(data), nil
+	case yardstick.EP0CmdGetDebugCodes:
+		for i := range data {
+			data[i] = 0
+		}
+		return len(data), nil
+	}
+	return len(data), nil
+}
+
+// Close implements yardstick.DeviceIO
+func (m *Dongle) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.notify()
+	return nil
+}
+
+// execute runs one command frame and queues its response
+// It returns the packets the command put on air
+func (m *Dongle) execute(app, cmd uint8, payload []byte) [][]byte {
+	switch app {
+	case yardstick.AppSystem:
+		m.respond(app, cmd, m.system(cmd, payload))
+	case yardstick.AppNIC:
+		resp, tx := m.nic(cmd, payload)
+		m.respond(app, cmd, resp)
+		return tx
+	default:
+		m.respond(app, cmd, nil)
+	}
+	return nil
+}
+
+// system handles APP_SYSTEM commands
+func (m *Dongle) system(cmd uint8, payload []byte) []byte {
+	switch cmd {
+	case yardstick.SysCmdPeek:
+		if len(payload) < 4 {
+			return nil
+		}
+		n := int(binary.LittleEndian.Uint16(payload[0:2]))
+		addr := int(binary.LittleEndian.Uint16(payload[2:4]))
+		if addr+n > len(m.mem) {
+			n = len(m.mem) - addr
+		}
+		return append([]byte(nil), m.mem[addr:addr+n]...)
+	case yardstick.SysCmdPoke, yardstick.SysCmdPokeReg:
+		if len(payload) < 2 {
+			return []byte{0, 0}
+		}
+		addr := binary.LittleEndian.Uint16(payload[0:2])
+		for i, b := range payload[2:] {
+			m.poke(addr+uint16(i), b)
+		}
+		return []byte{0, 0}
+	case yardstick.SysCmdRFMode:
+		if len(payload) > 0 {
+			m.strobe(payload[0])
+		}
+		return payload
+	case yardstick.SysCmdBuildType:
+		return append([]byte(m.Build), 0)
+	case yardstick.SysCmdCompiler:
+		return append([]byte("SDCCv350"), 0)
+	case yardstick.SysCmdPartNum:
+		return []byte{m.mem[regPARTNUM]}
+	case yardstick.SysCmdDeviceSerialNum:
+		return []byte(m.Serial)
+	default:
+		// Ping, LED mode, clear codes and the rest echo their payload
+		return payload
+	}
+}
+
+// nic handles APP_NIC commands other than FHSS
+func (m *Dongle) nic(cmd uint8, payload []byte) ([]byte, [][]byte) {
+	switch cmd {
+	case yardstick.NICXmit:
+		if len(payload) < 6 {
+			return []byte{0}, nil
+		}
+		n := int(binary.LittleEndian.Uint16(payload[0:2]))
+		if n > len(payload)-6 {
+			n = len(payload) - 6
+		}
+		return []byte{1}, [][]byte{m.transmit(payload[6 : 6+n])}
+	case yardstick.NICLongXmit:
+		if len(payload) < 3 {
+			return []byte{yardstick.RCErrBufferSizeExceeded}, nil
+		}
+		m.longLen = int(binary.LittleEndian.Uint16(payload[0:2]))
+		m.longBuf = append(m.longBuf[:0], payload[3:]...)
+		return []byte{0}, nil
+	case yardstick.NICLongXmitMore:
+		if len(payload) < 1 {
+			return []byte{yardstick.RCErrBufferSizeExceeded}, nil
+		}
+		if payload[0] != 0 {
+			m.longBuf = append(m.longBuf, payload[1:]...)
+			return []byte{0}, nil
+		}
+		data := m.longBuf
+		if len(data) > m.longLen {
+			data = data[:m.longLen]
+		}
+		m.longBuf = nil
+		return []byte{0}, [][]byte{m.transmit(data)}
+	case yardstick.NICSetAESMode:
+		if len(payload) > 0 {
+			m.aesMode = payload[0]
+		}
+		return nil, nil
+	case yardstick.NICGetAESMode:
+		return []byte{m.aesMode}, nil
+	case yardstick.NICSetAmpMode:
+		if len(payload) > 0 {
+			m.ampMode = payload[0]
+		}
+		return nil, nil
+	case yardstick.NICGetAmpMode:
+		return []byte{m.ampMode}, nil
+	}
+	if resp, tx, ok := m.fhssCommand(cmd, payload); ok {
+		return resp, tx
+	}
+	return nil, nil
+}
+
+// transmit records a packet going on air
+// Transmission takes no time, so TX is never observed: the radio ends in
+// RX if it was receiving and IDLE otherwise, as the firmware leaves it
+func (m *Dongle) transmit(data []byte) []byte {
+	pkt := append([]byte(nil), data...)
+	m.sent = append(m.sent, pkt)
+	if m.mem[yardstick.RegMARCSTATE] != yardstick.MarcStateRX {
+		m.mem[yardstick.RegMARCSTATE] = yardstick.MarcStateIdle
+	}
+	return pkt
+}
+
+// receive queues a packet for the host if the radio is listening
+func (m *Dongle) receive(data []byte) bool {
+	if m.closed || m.mem[yardstick.RegMARCSTATE] != yardstick.MarcStateRX {
+		return false
+	}
+	m.mem[regRSSI] = m.RSSI
+	m.mem[regLQI] = 0x80 | 0x10 // CRC OK, good link quality
+	m.mem[regPKTSTATUS] = 0x80
+	m.respond(yardstick.AppNIC, yardstick.NICRecv, data)
+	return true
+}
+
+// poke writes one byte of XDATA; writes to RFST are strobes
+func (m *Dongle) poke(addr uint16, v uint8) {
+	m.mem[addr] = v
+	if addr == yardstick.RegRFST {
+		m.strobe(v)
+	}
+}
+
+// strobe applies an RFST command strobe to MARCSTATE
+func (m *Dongle) strobe(s uint8) {
+	switch s {
+	case yardstick.RFSTSrx:
+		m.mem[yardstick.RegMARCSTATE] = yardstick.MarcStateRX
+	case yardstick.RFSTStx:
+		m.mem[yardstick.RegMARCSTATE] = yardstick.MarcStateTX
+	case yardstick.RFSTSfstxon:
+		m.mem[yardstick.RegMARCSTATE] = marcStateFSTXON
+	case yardstick.RFSTSidle, yardstick.RFSTScal:
+		m.mem[yardstick.RegMARCSTATE] = yardstick.MarcStateIdle
+	}
+}
+
+// respond queues an '@'-framed EP5 IN response
+func (m *Dongle) respond(app, cmd uint8, payload []byte) {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = yardstick.ResponseMarker
+	frame[1] = app
+	frame[2] = cmd
+	binary.LittleEndian.PutUint16(frame[3:5], uint16(len(payload)))
+	copy(frame[5:], payload)
+	m.out = append(m.out, frame...)
+	m.notify()
+}
+
+// notify wakes a blocked ReadContext
+func (m *Dongle) notify() {
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+// channel returns what a receiver must share with a sender to hear it:
+// the frequency word, channel number and sync word
+func (m *Dongle) channel() [6]uint8 {
+	return [6]uint8{
+		m.mem[yardstick.RegFREQ2], m.mem[yardstick.RegFREQ1], m.mem[yardstick.RegFREQ0],
+		m.mem[regCHANNR], m.mem[regSYNC1], m.mem[regSYNC0],
+	}
+}
@@ -0,0 +1,253 @@
+package yardstick
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gousb"
+)
+
+// DefaultMonitorInterval is how often a Monitor enumerates the bus
+const DefaultMonitorInterval = time.Second
+
+// ReplayFunc restores a configuration recorded with SetApplied onto a
+// reopened device; pkg/config provides config.Replay
+type ReplayFunc func(d *Device, applied interface{}) error
+
+// Monitor keeps a Device usable across unplug and replug
+//
+// gousb has no hotplug events, so the monitor enumerates the bus every
+// interval. When the device's bus address disappears, OnDisconnect is
+// called; when a device with the same serial number shows up again it is
+// reopened into the same *Device, so callers keep their pointer, the last
+// applied configuration is replayed and OnConnect is called. Operations
+// in flight during the gap fail with an error matching ErrDisconnected,
+// which also matches ErrUSB.
+type Monitor struct {
+	ctx      *gousb.Context
+	selector DeviceSelector
+	interval time.Duration
+
+	// Replay restores the radio configuration after a reconnect; nil
+	// leaves the radio at its power-on defaults
+	Replay ReplayFunc
+	// OnConnect is called after the device is opened or reopened, with
+	// the result of the replay
+	OnConnect func(d *Device, replayErr error)
+	// OnDisconnect is called when the device disappears from the bus
+	OnDisconnect func(d *Device)
+
+	mu        sync.Mutex
+	device    *Device
+	connected bool
+	applied   interface{}
+	running   bool
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+}
+
+// NewMonitor creates a monitor for the device matching selector
+func NewMonitor(ctx *gousb.Context, selector DeviceSelector, interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	return &Monitor{
+		ctx:      ctx,
+		selector: selector,
+		interval: interval,
+	}
+}
+
+// Start opens the device and begins watching for removal
+// The device must be present when Start is called
+func (m *Monitor) Start() (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return nil, fmt.Errorf("already running")
+	}
+
+	device, err := SelectDevice(m.ctx, m.selector)
+	if err != nil {
+		return nil, err
+	}
+
+	m.device = device
+	m.connected = true
+	m.running = true
+	m.stopChan = make(chan struct{})
+	m.doneChan = make(chan struct{})
+
+	if m.OnConnect != nil {
+		m.OnConnect(device, nil)
+	}
+
+	go m.watchLoop()
+
+	return device, nil
+}
+
+// Stop ends monitoring; the device stays open and is closed by the caller
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	done := m.doneChan
+	m.mu.Unlock()
+
+	<-done
+}
+
+// Device returns the monitored device
+func (m *Monitor) Device() *Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.device
+}
+
+// Connected reports whether the device is currently on the bus
+func (m *Monitor) Connected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connected
+}
+
+// watchLoop polls the bus until stopped
+func (m *Monitor) watchLoop() {
+	defer close(m.doneChan)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		connected := m.connected
+		m.mu.Unlock()
+
+		if connected {
+			m.checkPresent()
+		} else {
+			m.tryReconnect()
+		}
+	}
+}
+
+// checkPresent notices the device leaving the bus
+func (m *Monitor) checkPresent() {
+	d := m.device
+	present, err := busHasDevice(m.ctx, d.Bus, d.Address)
+	if err != nil || present {
+		return
+	}
+
+	// Remember the configuration before the stale handles are dropped
+	applied := d.Applied()
+	d.detach()
+
+	m.mu.Lock()
+	m.connected = false
+	m.applied = applied
+	m.mu.Unlock()
+
+	if m.OnDisconnect != nil {
+		m.OnDisconnect(d)
+	}
+}
+
+// tryReconnect reopens the device once it is back on the bus
+func (m *Monitor) tryReconnect() {
+	d := m.device
+	sel := m.selector
+	if d.Serial != "" {
+		sel = DeviceSelector(d.Serial)
+	}
+	fresh, err := SelectDevice(m.ctx, sel)
+	if err != nil {
+		return
+	}
+	d.attach(fresh)
+
+	var replayErr error
+	m.mu.Lock()
+	applied := m.applied
+	m.applied = nil
+	m.connected = true
+	m.mu.Unlock()
+	if m.Replay != nil && applied != nil {
+		// Only the holder may configure a leased radio
+		target := d
+		if l := d.CurrentLease(); l != nil {
+			target = l.Device()
+		}
+		replayErr = m.Replay(target, applied)
+	}
+
+	if m.OnConnect != nil {
+		m.OnConnect(d, replayErr)
+	}
+}
+
+// busHasDevice reports whether a supported dongle is enumerated at bus:addr
+// Nothing is opened; the filter only inspects descriptors
+func busHasDevice(ctx *gousb.Context, bus, addr int) (bool, error) {
+	found := false
+	_, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		if desc.Vendor == gousb.ID(VendorID) && IsSupported(uint16(desc.Product)) &&
+			desc.Bus == bus && desc.Address == addr {
+			found = true
+		}
+		return false
+	})
+	if err != nil {
+		return false, usbErr(fmt.Errorf("failed to enumerate devices: %w", err))
+	}
+	return found, nil
+}
+
+// detach releases the USB handles of a device that has gone away
+// The Device stays valid; calls fail until attach gives it new handles
+func (d *Device) detach() {
+	d.recvMu.Lock()
+	defer d.recvMu.Unlock()
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	// Like InvalidateState, but the packet format stays: it describes the
+	// configuration the monitor replays once the device is back. The
+	// lease stays too; it is the host's, and its holder carries on after
+	// the gap
+	d.stateMu.Lock()
+	d.applied = nil
+	d.stateMu.Unlock()
+	d.cache.reset()
+
+	if d.transport != nil {
+		d.transport.Close()
+	}
+	d.transport = nil
+}
+
+// attach moves the USB handles of a freshly opened device into d
+func (d *Device) attach(fresh *Device) {
+	d.recvMu.Lock()
+	defer d.recvMu.Unlock()
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	d.transport = fresh.transport
+	d.Bus = fresh.Bus
+	d.Address = fresh.Address
+	d.recvBuf = fresh.recvBuf
+}
@@ -0,0 +1,146 @@
+package yardstick
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// UdevRulesPath is where the udev rules are usually installed on Linux
+const UdevRulesPath = "/etc/udev/rules.d/99-yardstick.rules"
+
+// UdevRule gives users in the plugdev group access to a YardStick One
+const UdevRule = `SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="605b", MODE="0660", GROUP="plugdev"`
+
+// UdevRules is the full rules file: the YardStick One and other RfCat
+// dongles, and their bootloaders
+const UdevRules = UdevRule + `
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="6048", MODE="0660", GROUP="plugdev"
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="6047", MODE="0660", GROUP="plugdev"
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="ecc1", MODE="0660", GROUP="plugdev"
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="6049", MODE="0660", GROUP="plugdev"
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="604a", MODE="0660", GROUP="plugdev"
+SUBSYSTEMS=="usb", ATTRS{idVendor}=="1d50", ATTRS{idProduct}=="ecc0", MODE="0660", GROUP="plugdev"
+`
+
+// OpenError is a failed open with a known cause
+// errors.Is matches its Class, and ErrUSB (ErrDeviceNotFound for
+// ErrBootloader); Hint says how to fix it
+type OpenError struct {
+	Bus     int
+	Address int
+	Class   error // ErrPermission, ErrKernelDriver, ErrDeviceBusy or ErrBootloader
+	Err     error
+}
+
+func (e *OpenError) Error() string {
+	if e.Bus == 0 {
+		return fmt.Sprintf("%v: %v; %s", e.Class, e.Err, e.Hint())
+	}
+	return fmt.Sprintf("%v: device at bus %d address %d: %v; %s", e.Class, e.Bus, e.Address, e.Err, e.Hint())
+}
+
+func (e *OpenError) Unwrap() error { return e.Err }
+
+// Is makes errors.Is match the class and the broader error category
+func (e *OpenError) Is(target error) bool {
+	if target == e.Class {
+		return true
+	}
+	if e.Class == ErrBootloader {
+		return target == ErrDeviceNotFound
+	}
+	return target == ErrUSB
+}
+
+// Hint returns the fix for the error class
+func (e *OpenError) Hint() string {
+	switch e.Class {
+	case ErrPermission:
+		return fmt.Sprintf("add the udev rule '%s' to %s, run 'sudo udevadm control --reload-rules && sudo udevadm trigger' and replug, or run as root", UdevRule, UdevRulesPath)
+	case ErrKernelDriver:
+		return "a kernel driver holds the interface and could not be detached; unbind it or run as root"
+	case ErrDeviceBusy:
+		return "another program (rfcat, another gocat) has the device open; close it or select a different device with -d"
+	case ErrBootloader:
+		return "flash the application firmware with rfcat_bootloader, or replug the dongle to leave the bootloader"
+	}
+	return "run 'gocat doctor' to diagnose the USB setup"
+}
+
+// classifyOpenError turns a libusb failure into an OpenError when the
+// cause is recognised, or an ErrUSB otherwise
+// gousb formats most claim and detach errors with %v, so the libusb
+// message text is matched as well as the error value
+func classifyOpenError(desc *gousb.DeviceDesc, err error) error {
+	var class error
+	msg := err.Error()
+	var usbCode gousb.Error
+	switch {
+	case strings.Contains(msg, "detach kernel driver"):
+		class = ErrKernelDriver
+	case errors.As(err, &usbCode) && usbCode == gousb.ErrorAccess, strings.Contains(msg, "bad access"):
+		class = ErrPermission
+	case errors.As(err, &usbCode) && usbCode == gousb.ErrorBusy, strings.Contains(msg, "resource busy"), strings.Contains(msg, "already claimed"):
+		class = ErrDeviceBusy
+	default:
+		return usbErr(err)
+	}
+
+	e := &OpenError{Class: class, Err: err}
+	if desc != nil {
+		e.Bus, e.Address = desc.Bus, desc.Address
+	}
+	return e
+}
+
+// IsBootloader reports whether a product ID is one of the RfCat bootloaders
+func IsBootloader(product uint16) bool {
+	switch product {
+	case ProductIDBootloader, ProductIDBootloaderAlt, ProductIDBootloaderAlt2:
+		return true
+	}
+	return false
+}
+
+// USBDevice is an RfCat-family device seen on the bus, without opening it
+type USBDevice struct {
+	Bus       int    `json:"bus"`
+	Address   int    `json:"address"`
+	ProductID uint16 `json:"product_id"`
+	Kind      string `json:"kind"`
+}
+
+// Enumerate lists the RfCat-family devices on the bus (YardStick One,
+// other dongles and bootloaders) from their descriptors alone, so it works
+// even when the devices cannot be opened
+func Enumerate(context *gousb.Context) ([]USBDevice, error) {
+	var found []USBDevice
+	_, err := context.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		if desc.Vendor != gousb.ID(VendorID) {
+			return false
+		}
+		kind := productKind(uint16(desc.Product))
+		if kind != "" {
+			found = append(found, USBDevice{Bus: desc.Bus, Address: desc.Address, ProductID: uint16(desc.Product), Kind: kind})
+		}
+		return false
+	})
+	if err != nil {
+		return found, usbErr(fmt.Errorf("failed to enumerate devices: %w", err))
+	}
+	return found, nil
+}
+
+// productKind names an RfCat-family product ID, or returns ""
+func productKind(product uint16) string {
+	if caps, ok := CapabilitiesFor(product); ok {
+		return caps.Model
+	}
+	if IsBootloader(product) {
+		return "bootloader"
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package yardstick
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPayloadLength is returned when a transmit payload doesn't fit the
+// configured packet format
+var ErrPayloadLength = errors.New("payload does not fit packet format")
+
+// Packet length modes (PKTCTRL0 LENGTH_CONFIG)
+const (
+	LengthFixed    = 0x00
+	LengthVariable = 0x01
+	LengthInfinite = 0x02
+)
+
+// Packet format registers
+const (
+	regPKTLEN   = 0xDF02
+	regPKTCTRL1 = 0xDF03
+	regPKTCTRL0 = 0xDF04
+)
+
+// PacketFormat is the packet engine length configuration the radio was
+// last configured with
+type PacketFormat struct {
+	LengthMode   uint8 // LengthFixed, LengthVariable or LengthInfinite
+	PktLen       uint8 // Fixed length, or maximum length in variable mode
+	AppendStatus bool  // Received packets end with RSSI and LQI/CRC_OK status bytes
+}
+
+// SetPacketFormat records the active packet length configuration so
+// RFXmit can reject payloads that don't fit before touching the radio
+// nil disables the check
+func (d *Device) SetPacketFormat(f *PacketFormat) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	d.pktFormat = f
+}
+
+// PacketFormat returns the recorded packet length configuration, or nil
+func (d *Device) PacketFormat() *PacketFormat {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.pktFormat
+}
+
+// withPoke returns a copy of the format with data written at address
+func (f PacketFormat) withPoke(address uint16, data []byte) *PacketFormat {
+	for i, b := range data {
+		switch int(address) + i {
+		case regPKTLEN:
+			f.PktLen = b
+		case regPKTCTRL1:
+			f.AppendStatus = b&0x04 != 0
+		case regPKTCTRL0:
+			f.LengthMode = b & 0x03
+		}
+	}
+	return &f
+}
+
+// checkPayload validates a payload length against the packet format
+// long is true for RFXmitLong, whose length the firmware handles itself,
+// so only short packets are held to PKTLEN
+func (d *Device) checkPayload(n int, long bool) error {
+	f := d.PacketFormat()
+	if f == nil || long {
+		return nil
+	}
+
+	switch f.LengthMode & 0x03 {
+	case LengthFixed:
+		if n > int(f.PktLen) {
+			return fmt.Errorf("%w: %d bytes exceeds fixed packet length %d (PKTLEN)", ErrPayloadLength, n, f.PktLen)
+		}
+	case LengthVariable:
+		// The leading length byte is not counted by PKTLEN
+		if n > int(f.PktLen)+1 {
+			return fmt.Errorf("%w: %d bytes exceeds variable packet maximum %d (PKTLEN) plus length byte", ErrPayloadLength, n, f.PktLen)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package yardstick
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"time"
@@ -27,6 +28,9 @@ const (
 // Crystal frequency for YardStick One (CC1111)
 const CrystalFreqHz = 24000000
 
+// Crystal frequency for CC2510/CC2511 dongles, such as the IMME
+const CrystalFreqHz2511 = 26000000
+
 // MARCSTATE values
 const (
 	MarcStateIdle = 0x01
@@ -37,6 +41,10 @@ const (
 // SetModeRX puts the radio into receive mode
 // This issues the SYS_CMD_RFMODE command which calls firmware RxMode()
 func (d *Device) SetModeRX() error {
+	if err := d.checkMode(ModeRX); err != nil {
+		return err
+	}
+
 	// First ensure we're in IDLE state for clean transition
 	// This resets any previous RF state and clears the firmware's rf_status
 	_, err := d.Send(AppSystem, SysCmdRFMode, []byte{RFSTSidle}, USBDefaultTimeout)
@@ -70,22 +78,32 @@ func (d *Device) SetModeRX() error {
 // SetModeTX puts the radio into transmit mode
 // Note: Normal transmit is done via RFXmit, not by setting TX mode directly
 func (d *Device) SetModeTX() error {
+	if err := d.checkMode(ModeTX); err != nil {
+		return err
+	}
+
 	// Issue RFMODE command to enter TX - firmware handles MCSM1 and strobe
 	_, err := d.Send(AppSystem, SysCmdRFMode, []byte{RFSTStx}, USBDefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to set TX mode: %w", err)
 	}
+	d.cache.setMode(MarcStateTX, true)
 
 	return nil
 }
 
 // SetModeIDLE puts the radio into idle mode
 func (d *Device) SetModeIDLE() error {
+	if err := d.checkMode(0); err != nil {
+		return err
+	}
+
 	// Issue RFMODE command to enter IDLE - firmware handles the strobe
 	_, err := d.Send(AppSystem, SysCmdRFMode, []byte{RFSTSidle}, USBDefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to set IDLE mode: %w", err)
 	}
+	d.cache.setMode(MarcStateIdle, true)
 
 	return nil
 }
@@ -128,16 +146,40 @@ func (d *Device) WaitForState(state uint8, timeout time.Duration) error {
 
 // RFXmit transmits RF data
 // data: the RF payload to transmit (max 255 bytes for standard, use RFXmitLong for larger)
-// repeat: number of times to repeat (0 = once, 65535 = forever)
+// repeat: number of times to repeat (0 = once, RepeatForever = until stopped)
 // offset: start offset within data for repeat transmissions
 func (d *Device) RFXmit(data []byte, repeat uint16, offset uint16) error {
+	return d.RFXmitCtx(context.Background(), data, repeat, offset)
+}
+
+// RFXmitCtx is RFXmit that gives up waiting for the firmware when ctx
+// is cancelled; the radio may still finish sending what it was given
+func (d *Device) RFXmitCtx(ctx context.Context, data []byte, repeat uint16, offset uint16) (err error) {
 	if len(data) > RFMaxTXBlock {
 		if repeat > 0 || offset > 0 {
 			return fmt.Errorf("repeat/offset not supported for long transmit")
 		}
-		return d.RFXmitLong(data)
+		return d.RFXmitLongCtx(ctx, data)
 	}
 
+	if err := d.checkMode(ModeTX); err != nil {
+		return fmt.Errorf("transmit failed: %w", err)
+	}
+	if err := d.checkPayload(len(data), false); err != nil {
+		return fmt.Errorf("transmit failed: %w", err)
+	}
+
+	// Hardware repeats go on air too, so they count against the budget;
+	// a transmit that never ends can't be budgeted
+	if repeat == RepeatForever && d.txLimiter != nil {
+		return fmt.Errorf("transmit failed: %w: repeat forever with a transmit limit", ErrTxRateLimited)
+	}
+	if err := d.waitTxBudget(ctx, int(repeat)+1, len(data)); err != nil {
+		return fmt.Errorf("transmit failed: %w", err)
+	}
+	start := time.Now()
+	defer func() { d.auditTx("xmit", data, repeat, start, err) }()
+
 	// Build NIC_XMIT payload:
 	// Bytes 0-1: data_len (little-endian)
 	// Bytes 2-3: repeat count
@@ -155,8 +197,14 @@ func (d *Device) RFXmit(data []byte, repeat uint16, offset uint16) error {
 		waitLen += int(repeat) * (len(data) - int(offset))
 	}
 	waitTime := USBTXWaitTimeout * time.Duration((waitLen/RFMaxTXBlock)+1)
+	if airtime := d.Airtime(waitLen); airtime > 0 {
+		// Known on-air time: allow double for calibration/settling plus USB overhead
+		waitTime = 2*airtime + USBDefaultTimeout
+	}
 
-	response, err := d.Send(AppNIC, NICXmit, payload, waitTime)
+	// The radio returns to RX or IDLE on its own after the transmit
+	d.cache.setMode(0, false)
+	response, err := d.sendWithin(ctx, AppNIC, NICXmit, payload, waitTime)
 	if err != nil {
 		return fmt.Errorf("transmit failed: %w", err)
 	}
@@ -177,10 +225,29 @@ func (d *Device) RFXmit(data []byte, repeat uint16, offset uint16) error {
 
 // RFXmitLong transmits RF data larger than 255 bytes using chunked transfer
 func (d *Device) RFXmitLong(data []byte) error {
+	return d.RFXmitLongCtx(context.Background(), data)
+}
+
+// RFXmitLongCtx is RFXmitLong that stops feeding chunks when ctx is
+// cancelled
+func (d *Device) RFXmitLongCtx(ctx context.Context, data []byte) (err error) {
 	if len(data) > RFMaxTXLong {
 		return fmt.Errorf("data too large: %d bytes exceeds maximum %d", len(data), RFMaxTXLong)
 	}
 
+	if err := d.checkMode(ModeTX); err != nil {
+		return fmt.Errorf("long transmit failed: %w", err)
+	}
+	if err := d.checkPayload(len(data), true); err != nil {
+		return fmt.Errorf("long transmit failed: %w", err)
+	}
+
+	if err := d.waitTxBudget(ctx, 1, len(data)); err != nil {
+		return fmt.Errorf("long transmit failed: %w", err)
+	}
+	start := time.Now()
+	defer func() { d.auditTx("long", data, 0, start, err) }()
+
 	dataLen := len(data)
 
 	// Split data into chunks
@@ -211,7 +278,8 @@ func (d *Device) RFXmitLong(data []byte) error {
 
 	// Send initial long transmit command
 	waitTime := USBTXWaitTimeout * time.Duration(preload)
-	response, err := d.Send(AppNIC, NICLongXmit, initialData, waitTime)
+	d.cache.setMode(0, false)
+	response, err := d.sendWithin(ctx, AppNIC, NICLongXmit, initialData, waitTime)
 	if err != nil {
 		return fmt.Errorf("long transmit init failed: %w", err)
 	}
@@ -230,13 +298,16 @@ func (d *Device) RFXmitLong(data []byte) error {
 			payload[0] = byte(len(chunk))
 			copy(payload[1:], chunk)
 
-			response, err = d.Send(AppNIC, NICLongXmitMore, payload, USBTXWaitTimeout)
+			response, err = d.sendWithin(ctx, AppNIC, NICLongXmitMore, payload, USBTXWaitTimeout)
 			if err != nil {
 				return fmt.Errorf("long transmit chunk %d failed: %w", chIdx, err)
 			}
 
 			if len(response) > 0 {
 				if response[0] == RCTempErrBufferNotAvailable {
+					if err := ctx.Err(); err != nil {
+						return fmt.Errorf("long transmit chunk %d: %w", chIdx, err)
+					}
 					time.Sleep(1 * time.Millisecond)
 					continue
 				}
@@ -248,7 +319,8 @@ func (d *Device) RFXmitLong(data []byte) error {
 		}
 	}
 
-	// Signal completion with zero-length chunk
+	// Signal completion with zero-length chunk, even if ctx was cancelled
+	// meanwhile, so the firmware isn't left waiting for more data
 	response, err = d.Send(AppNIC, NICLongXmitMore, []byte{0}, USBTXWaitTimeout)
 	if err != nil {
 		return fmt.Errorf("long transmit completion failed: %w", err)
@@ -264,7 +336,17 @@ func (d *Device) RFXmitLong(data []byte) error {
 // RFRecv receives RF data with timeout
 // Returns the received data and any error
 // Set blocksize > 255 for large packet mode (max 512)
+// The firmware queues received packets for EP5 on its own, so the whole
+// timeout is spent in host reads sized by hostReadSlice
 func (d *Device) RFRecv(timeout time.Duration, blocksize uint16) ([]byte, error) {
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+	return d.RFRecvCtx(ctx, blocksize)
+}
+
+// RFRecvCtx is RFRecv bounded by ctx instead of a timeout; without a
+// deadline it waits for a packet until ctx is cancelled
+func (d *Device) RFRecvCtx(ctx context.Context, blocksize uint16) ([]byte, error) {
 	// Configure large block receive if needed
 	if blocksize > 255 {
 		if blocksize > RFMaxRXBlock {
@@ -272,14 +354,14 @@ func (d *Device) RFRecv(timeout time.Duration, blocksize uint16) ([]byte, error)
 		}
 		payload := make([]byte, 2)
 		binary.LittleEndian.PutUint16(payload, blocksize)
-		_, err := d.Send(AppNIC, NICSetRecvLarge, payload, USBDefaultTimeout)
+		_, err := d.sendWithin(ctx, AppNIC, NICSetRecvLarge, payload, USBDefaultTimeout)
 		if err != nil {
 			return nil, fmt.Errorf("failed to set large receive mode: %w", err)
 		}
 	}
 
 	// Receive packet from NIC
-	data, err := d.Recv(AppNIC, NICRecv, timeout)
+	data, err := d.RecvCtx(ctx, AppNIC, NICRecv)
 	if err != nil {
 		return nil, err
 	}
@@ -331,7 +413,18 @@ func (d *Device) SetRecvLargeMode(blocksize uint16) error {
 // mode: 0 = amplifiers bypassed (lower power/sensitivity)
 //       1 = amplifiers enabled (full power/sensitivity)
 // The YS1 has separate TX and RX amplifiers that significantly improve range
+// Other boards have none: bypassing them succeeds, enabling them returns
+// ErrNoAmplifier
 func (d *Device) SetAmpMode(mode uint8) error {
+	if !d.Capabilities().Amplifier {
+		if mode == AmpModeOff {
+			return nil
+		}
+		return fmt.Errorf("failed to set amplifier mode: %w", ErrNoAmplifier)
+	}
+	if err := d.checkMode(0); err != nil {
+		return fmt.Errorf("failed to set amplifier mode: %w", err)
+	}
 	_, err := d.Send(AppNIC, NICSetAmpMode, []byte{mode}, USBDefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to set amplifier mode: %w", err)
@@ -340,7 +433,11 @@ func (d *Device) SetAmpMode(mode uint8) error {
 }
 
 // GetAmpMode returns the current amplifier mode (0=bypassed, 1=enabled)
+// Boards without amplifiers always report 0
 func (d *Device) GetAmpMode() (uint8, error) {
+	if !d.Capabilities().Amplifier {
+		return AmpModeOff, nil
+	}
 	response, err := d.Send(AppNIC, NICGetAmpMode, nil, USBDefaultTimeout)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get amplifier mode: %w", err)
@@ -424,11 +521,12 @@ func (d *Device) GetRadioStatus() (*RadioStatus, error) {
 }
 
 // SetFrequency sets the radio frequency in Hz
-// Uses the CC1111's 24 MHz crystal reference
+// Uses the crystal reference of the device's chip (see CrystalHz)
+// Only the FREQ registers are written; use Retune to also calibrate
 func (d *Device) SetFrequency(freqHz uint32) error {
-	// Calculate FREQ registers for 24 MHz crystal
-	// FREQ = (freq_hz * 65536) / 24000000
-	freq := uint32((uint64(freqHz) * 65536) / CrystalFreqHz)
+	// FREQ = (freq_hz * 65536) / Fxtal, rounded so a frequency read back
+	// with GetFrequency sets the same register value again
+	freq := uint32((uint64(freqHz)*65536 + uint64(d.CrystalHz())/2) / uint64(d.CrystalHz()))
 
 	freq2 := uint8((freq >> 16) & 0xFF)
 	freq1 := uint8((freq >> 8) & 0xFF)
@@ -448,6 +546,61 @@ func (d *Device) SetFrequency(freqHz uint32) error {
 	return nil
 }
 
+// Retune changes frequency without a full reconfigure
+// The radio is taken to IDLE, FREQ2-0 are written, the synthesizer is
+// calibrated with SCAL (or loaded from the Precalibrate cache), and an RX
+// state is restored afterwards
+// SetFrequency alone only writes the registers and skips calibration
+func (d *Device) Retune(freqHz uint32) error {
+	state, err := d.GetMARCSTATE()
+	if err != nil {
+		return fmt.Errorf("failed to read MARCSTATE: %w", err)
+	}
+
+	if state != MarcStateIdle {
+		if err := d.StrobeModeIDLE(); err != nil {
+			return fmt.Errorf("failed to strobe IDLE: %w", err)
+		}
+		if err := d.WaitForState(MarcStateIdle, 10*time.Millisecond); err != nil {
+			return err
+		}
+	}
+
+	if err := d.SetFrequency(freqHz); err != nil {
+		return err
+	}
+
+	if cal, ok := d.cachedCal(freqHz); ok {
+		// Precalibrated: write the stored result and keep autocal off
+		if err := d.writeCal(cal); err != nil {
+			return err
+		}
+		if err := d.setAutocal(false); err != nil {
+			return err
+		}
+	} else {
+		// Manual calibration returns to IDLE when done (~720us)
+		if err := d.PokeByte(RegRFST, RFSTScal); err != nil {
+			return fmt.Errorf("failed to strobe SCAL: %w", err)
+		}
+		if err := d.WaitForState(MarcStateIdle, 10*time.Millisecond); err != nil {
+			return fmt.Errorf("calibration did not complete: %w", err)
+		}
+	}
+
+	// TX is never resumed; a pending transmit would go out on the new frequency
+	if state == MarcStateRX {
+		if err := d.StrobeModeRX(); err != nil {
+			return fmt.Errorf("failed to restore RX: %w", err)
+		}
+		if err := d.WaitForState(MarcStateRX, 10*time.Millisecond); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetFrequency returns the current radio frequency in Hz
 func (d *Device) GetFrequency() (uint32, error) {
 	freq2, err := d.PeekByte(RegFREQ2)
@@ -464,8 +617,8 @@ func (d *Device) GetFrequency() (uint32, error) {
 	}
 
 	freq := uint32(freq2)<<16 | uint32(freq1)<<8 | uint32(freq0)
-	// Convert back to Hz: freq_hz = (FREQ * 24000000) / 65536
-	freqHz := (uint64(freq) * CrystalFreqHz) / 65536
+	// Convert back to Hz: freq_hz = (FREQ * Fxtal) / 65536
+	freqHz := (uint64(freq) * uint64(d.CrystalHz())) / 65536
 	return uint32(freqHz), nil
 }
 
@@ -475,7 +628,7 @@ func (d *Device) GetFrequency() (uint32, error) {
 // For 24 MHz crystal: spacing = 91.552734 * (256 + M) * 2^E
 func (d *Device) SetChannelSpacing(spacingHz uint32) error {
 	// Find E and M that give closest match
-	fxtal := float64(CrystalFreqHz)
+	fxtal := float64(d.CrystalHz())
 	target := float64(spacingHz)
 
 	var bestE, bestM uint8
@@ -536,8 +689,8 @@ func (d *Device) GetChannelSpacing() (uint32, error) {
 	chanspcE := mdmcfg1 & 0x03
 	chanspcM := mdmcfg0
 
-	// spacing = (24e6 / 2^18) * (256 + M) * 2^E
-	fxtal := float64(CrystalFreqHz)
+	// spacing = (Fxtal / 2^18) * (256 + M) * 2^E
+	fxtal := float64(d.CrystalHz())
 	spacing := (fxtal / float64(uint32(1)<<18)) * (256 + float64(chanspcM)) * float64(uint32(1)<<chanspcE)
 	return uint32(spacing), nil
 }
@@ -0,0 +1,309 @@
+package yardstick
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+)
+
+// The setters in this file change one radio parameter at a time with a
+// read-modify-write of the registers involved, so they can be applied on
+// top of a profile or configuration file. The register math matches
+// pkg/profiles
+
+// Radio configuration register addresses
+const (
+	RegSYNC1    = 0xDF00
+	RegSYNC0    = 0xDF01
+	RegMDMCFG4  = 0xDF0C // CHANBW_E, CHANBW_M, DRATE_E
+	RegMDMCFG3  = 0xDF0D // DRATE_M
+	RegMDMCFG2  = 0xDF0E // MOD_FORMAT, SYNC_MODE
+	RegDEVIATN  = 0xDF11
+	RegFREND0   = 0xDF1B // PA_POWER selects the PA_TABLE entry used for TX
+	RegPATABLE1 = 0xDF2D
+	RegPATABLE0 = 0xDF2E
+	RegFREQEST  = 0xDF38 // Status: demodulator frequency offset estimate
+)
+
+// FreqEstStepHz returns the resolution of FREQEST, Fxtal / 2^14
+func FreqEstStepHz(crystalHz uint32) float64 {
+	return float64(crystalHz) / (1 << 14)
+}
+
+// modFormatMsk selects MOD_FORMAT in MDMCFG2
+const modFormatMsk = 0x70
+
+// Modulation formats (MDMCFG2 MOD_FORMAT)
+const (
+	Mod2FSK   = 0x00
+	ModGFSK   = 0x10
+	ModASKOOK = 0x30
+	Mod4FSK   = 0x40
+	ModMSK    = 0x70
+)
+
+// SetModulation sets MDMCFG2 MOD_FORMAT to one of the Mod* values
+// ASK/OOK transmits PA_TABLE1 for a one and PA_TABLE0 (off) for a zero,
+// so the PA table and FREND0 are rearranged to keep the output power
+func (d *Device) SetModulation(mod uint8) error {
+	switch mod {
+	case Mod2FSK, ModGFSK, ModASKOOK, Mod4FSK, ModMSK:
+	default:
+		return fmt.Errorf("invalid modulation 0x%02X", mod)
+	}
+
+	mdmcfg2, err := d.PeekByte(RegMDMCFG2)
+	if err != nil {
+		return fmt.Errorf("failed to read MDMCFG2: %w", err)
+	}
+	power, err := d.txPower()
+	if err != nil {
+		return err
+	}
+
+	if err := d.PokeByte(RegMDMCFG2, (mdmcfg2&^modFormatMsk)|mod); err != nil {
+		return fmt.Errorf("failed to set MDMCFG2: %w", err)
+	}
+
+	pa0, pa1, paPower := power, uint8(0), uint8(0)
+	if mod == ModASKOOK {
+		pa0, pa1, paPower = 0x00, power, 1
+	}
+	if err := d.PokeByte(RegPATABLE0, pa0); err != nil {
+		return fmt.Errorf("failed to set PA_TABLE0: %w", err)
+	}
+	if err := d.PokeByte(RegPATABLE1, pa1); err != nil {
+		return fmt.Errorf("failed to set PA_TABLE1: %w", err)
+	}
+	return d.setPAPower(paPower)
+}
+
+// GetModulation returns the MDMCFG2 MOD_FORMAT value
+func (d *Device) GetModulation() (uint8, error) {
+	mdmcfg2, err := d.PeekByte(RegMDMCFG2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MDMCFG2: %w", err)
+	}
+	return mdmcfg2 & modFormatMsk, nil
+}
+
+// SetDataRate sets the symbol rate in baud (MDMCFG4 DRATE_E, MDMCFG3)
+// rate = (256 + DRATE_M) * 2^DRATE_E * Fxtal / 2^28
+func (d *Device) SetDataRate(baud float64) error {
+	fxtal := float64(d.CrystalHz())
+	if baud < fxtal/(1<<28)*256 || baud > fxtal/(1<<28)*511*(1<<15) {
+		return fmt.Errorf("data rate %.0f baud out of range", baud)
+	}
+
+	var drateE, drateM uint8 = 15, 255
+	for e := 0; e < 16; e++ {
+		m := int(baud*(1<<28)/(math.Pow(2, float64(e))*fxtal) - 256 + 0.5)
+		if m >= 0 && m < 256 {
+			drateE, drateM = uint8(e), uint8(m)
+			break
+		}
+	}
+
+	mdmcfg4, err := d.PeekByte(RegMDMCFG4)
+	if err != nil {
+		return fmt.Errorf("failed to read MDMCFG4: %w", err)
+	}
+	if err := d.PokeByte(RegMDMCFG4, (mdmcfg4&0xF0)|drateE); err != nil {
+		return fmt.Errorf("failed to set MDMCFG4: %w", err)
+	}
+	if err := d.PokeByte(RegMDMCFG3, drateM); err != nil {
+		return fmt.Errorf("failed to set MDMCFG3: %w", err)
+	}
+	return nil
+}
+
+// GetDataRate returns the symbol rate in baud
+func (d *Device) GetDataRate() (float64, error) {
+	mdmcfg4, err := d.PeekByte(RegMDMCFG4)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MDMCFG4: %w", err)
+	}
+	mdmcfg3, err := d.PeekByte(RegMDMCFG3)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MDMCFG3: %w", err)
+	}
+	e := float64(mdmcfg4 & 0x0F)
+	return (256 + float64(mdmcfg3)) * math.Pow(2, e) * float64(d.CrystalHz()) / (1 << 28), nil
+}
+
+// SetChannelBW sets the receive channel filter bandwidth (MDMCFG4 CHANBW)
+// The narrowest filter at least bwHz wide is chosen
+// BW = Fxtal / (8 * (4 + CHANBW_M) * 2^CHANBW_E)
+func (d *Device) SetChannelBW(bwHz float64) error {
+	fxtal := float64(d.CrystalHz())
+	maxBW := fxtal / (8 * 4)
+	if bwHz <= 0 || bwHz > maxBW {
+		return fmt.Errorf("channel bandwidth %.0f Hz out of range (max %.0f)", bwHz, maxBW)
+	}
+
+	mdmcfg4, err := d.PeekByte(RegMDMCFG4)
+	if err != nil {
+		return fmt.Errorf("failed to read MDMCFG4: %w", err)
+	}
+	if err := d.PokeByte(RegMDMCFG4, (mdmcfg4&0x0F)|chanBWBits(bwHz, fxtal)); err != nil {
+		return fmt.Errorf("failed to set MDMCFG4: %w", err)
+	}
+	return nil
+}
+
+// chanBWBits returns MDMCFG4[7:4] for the narrowest filter at least bwHz
+// wide with crystal fxtal. E=3, M=3 is the narrowest, so walk from there
+// to the widest
+func chanBWBits(bwHz, fxtal float64) uint8 {
+	for e := 3; e >= 0; e-- {
+		for m := 3; m >= 0; m-- {
+			if fxtal/(8*float64(4+m)*float64(int(1)<<e)) >= bwHz {
+				return uint8(e<<6 | m<<4)
+			}
+		}
+	}
+	return 0
+}
+
+// GetChannelBW returns the receive channel filter bandwidth in Hz
+func (d *Device) GetChannelBW() (float64, error) {
+	mdmcfg4, err := d.PeekByte(RegMDMCFG4)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read MDMCFG4: %w", err)
+	}
+	e := int(mdmcfg4 >> 6)
+	m := float64((mdmcfg4 >> 4) & 0x03)
+	return float64(d.CrystalHz()) / (8 * (4 + m) * float64(int(1)<<e)), nil
+}
+
+// WiderChannelBW returns the narrowest receive filter wider than bwHz
+// with the given crystal, or 0 if bwHz is already the widest
+func WiderChannelBW(bwHz float64, crystalHz uint32) float64 {
+	for e := 3; e >= 0; e-- {
+		for m := 3; m >= 0; m-- {
+			if bw := float64(crystalHz) / (8 * float64(4+m) * float64(int(1)<<e)); bw > bwHz+1 {
+				return bw
+			}
+		}
+	}
+	return 0
+}
+
+// GetFreqEst returns the demodulator's estimate of how far the last
+// received signal was from the tuned frequency, in Hz (FREQEST). It is
+// updated on each received packet and is only meaningful for FSK
+func (d *Device) GetFreqEst() (float64, error) {
+	v, err := d.PeekByte(RegFREQEST)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read FREQEST: %w", err)
+	}
+	return float64(int8(v)) * FreqEstStepHz(d.CrystalHz()), nil
+}
+
+// SetDeviation sets the FSK frequency deviation (DEVIATN)
+// dev = Fxtal / 2^17 * (8 + DEVIATION_M) * 2^DEVIATION_E
+func (d *Device) SetDeviation(devHz float64) error {
+	fxtal := float64(d.CrystalHz())
+	for e := 0; e < 8; e++ {
+		m := int(devHz*(1<<17)/(math.Pow(2, float64(e))*fxtal) - 8 + 0.5)
+		if m >= 0 && m < 8 {
+			if err := d.PokeByte(RegDEVIATN, uint8(e<<4|m)); err != nil {
+				return fmt.Errorf("failed to set DEVIATN: %w", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("deviation %.0f Hz out of range", devHz)
+}
+
+// GetDeviation returns the FSK frequency deviation in Hz
+func (d *Device) GetDeviation() (float64, error) {
+	deviatn, err := d.PeekByte(RegDEVIATN)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read DEVIATN: %w", err)
+	}
+	e := float64((deviatn >> 4) & 0x07)
+	m := float64(deviatn & 0x07)
+	return float64(d.CrystalHz()) / (1 << 17) * (8 + m) * math.Pow(2, e), nil
+}
+
+// SetSyncWord sets the 16-bit sync word (SYNC1, SYNC0)
+func (d *Device) SetSyncWord(sync uint16) error {
+	if err := d.PokeByte(RegSYNC1, uint8(sync>>8)); err != nil {
+		return fmt.Errorf("failed to set SYNC1: %w", err)
+	}
+	if err := d.PokeByte(RegSYNC0, uint8(sync)); err != nil {
+		return fmt.Errorf("failed to set SYNC0: %w", err)
+	}
+	return nil
+}
+
+// GetSyncWord returns the 16-bit sync word
+func (d *Device) GetSyncWord() (uint16, error) {
+	sync, err := d.Peek(RegSYNC1, 2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read sync word: %w", err)
+	}
+	if len(sync) < 2 {
+		return 0, fmt.Errorf("short sync word read: %d bytes", len(sync))
+	}
+	return uint16(sync[0])<<8 | uint16(sync[1]), nil
+}
+
+// SetTXPowerDBm sets the transmit power for the current frequency band
+// The highest table setting not above dBm is used; the chosen power is
+// returned. The PA_TABLE entry selected by FREND0 is written, so this
+// works for ASK/OOK as well as FSK
+func (d *Device) SetTXPowerDBm(dBm float64) (float64, error) {
+	freq, err := d.GetFrequency()
+	if err != nil {
+		return 0, err
+	}
+
+	value, chosen, err := cc1111.PATableValue(freq, dBm)
+	if err != nil {
+		return 0, err
+	}
+
+	frend0, err := d.PeekByte(RegFREND0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read FREND0: %w", err)
+	}
+	reg := uint16(RegPATABLE0)
+	if frend0&0x07 == 1 {
+		reg = RegPATABLE1
+	}
+	if err := d.PokeByte(reg, value); err != nil {
+		return 0, fmt.Errorf("failed to set PA table: %w", err)
+	}
+	return chosen, nil
+}
+
+// txPower returns the PA_TABLE value currently used for a transmitted one
+func (d *Device) txPower() (uint8, error) {
+	pa, err := d.Peek(RegPATABLE1, 2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PA table: %w", err)
+	}
+	if len(pa) < 2 {
+		return 0, fmt.Errorf("short PA table read: %d bytes", len(pa))
+	}
+	// pa[0] is PA_TABLE1, pa[1] is PA_TABLE0
+	if pa[1] != 0 {
+		return pa[1], nil
+	}
+	return pa[0], nil
+}
+
+// setPAPower sets FREND0 PA_POWER, the PA_TABLE index used for TX
+func (d *Device) setPAPower(index uint8) error {
+	frend0, err := d.PeekByte(RegFREND0)
+	if err != nil {
+		return fmt.Errorf("failed to read FREND0: %w", err)
+	}
+	if err := d.PokeByte(RegFREND0, (frend0&^0x07)|index); err != nil {
+		return fmt.Errorf("failed to set FREND0: %w", err)
+	}
+	return nil
+}
@@ -63,7 +63,7 @@ func openFirstDevice(context *gousb.Context) (*Device, error) {
 		return nil, err
 	}
 	if len(devices) == 0 {
-		return nil, fmt.Errorf("no YardStick One devices found")
+		return nil, ErrDeviceNotFound
 	}
 
 	// Close all except the first
@@ -81,14 +81,14 @@ func openDeviceByIndex(context *gousb.Context, index int) (*Device, error) {
 		return nil, err
 	}
 	if len(devices) == 0 {
-		return nil, fmt.Errorf("no YardStick One devices found")
+		return nil, ErrDeviceNotFound
 	}
 	if index < 0 || index >= len(devices) {
 		// Close all devices
 		for _, d := range devices {
 			d.Close()
 		}
-		return nil, fmt.Errorf("device index %d out of range (found %d devices)", index, len(devices))
+		return nil, fmt.Errorf("%w: device index %d out of range (found %d devices)", ErrDeviceNotFound, index, len(devices))
 	}
 
 	// Close all except the selected one
@@ -108,7 +108,7 @@ func openDeviceByBusAddr(context *gousb.Context, bus, addr int) (*Device, error)
 		return nil, err
 	}
 	if len(devices) == 0 {
-		return nil, fmt.Errorf("no YardStick One devices found")
+		return nil, ErrDeviceNotFound
 	}
 
 	var selected *Device
@@ -121,7 +121,7 @@ func openDeviceByBusAddr(context *gousb.Context, bus, addr int) (*Device, error)
 	}
 
 	if selected == nil {
-		return nil, fmt.Errorf("no YardStick One found at bus %d address %d", bus, addr)
+		return nil, fmt.Errorf("%w at bus %d address %d", ErrDeviceNotFound, bus, addr)
 	}
 
 	return selected, nil
@@ -134,7 +134,7 @@ func openDeviceBySerial(context *gousb.Context, serial string) (*Device, error)
 		return nil, err
 	}
 	if len(devices) == 0 {
-		return nil, fmt.Errorf("no YardStick One devices found")
+		return nil, ErrDeviceNotFound
 	}
 
 	var matches []*Device
@@ -147,7 +147,7 @@ func openDeviceBySerial(context *gousb.Context, serial string) (*Device, error)
 	}
 
 	if len(matches) == 0 {
-		return nil, fmt.Errorf("no YardStick One found with serial %s", serial)
+		return nil, fmt.Errorf("%w with serial %s", ErrDeviceNotFound, serial)
 	}
 
 	if len(matches) > 1 {
@@ -0,0 +1,68 @@
+package yardstick
+
+// Radio configuration registers live in XDATA 0xDF00-0xDF3D
+const (
+	radioRegFirst = 0xDF00
+	radioRegLast  = 0xDF3D
+)
+
+// SetApplied records the configuration last written to the radio so it
+// can be answered from host memory instead of a register dump
+// The value is opaque here; pkg/config stores a RegisterMap
+func (d *Device) SetApplied(v interface{}) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	d.applied = v
+}
+
+// Applied returns the recorded configuration, or nil if none has been
+// recorded or it was invalidated by USB recovery or a register poke it
+// can't follow (see PokeTracker)
+func (d *Device) Applied() interface{} {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.applied
+}
+
+// InvalidateState drops the recorded configuration, packet format and
+// cached radio state
+// Call after anything that may have changed the radio behind the host's back
+func (d *Device) InvalidateState() {
+	d.stateMu.Lock()
+	d.applied = nil
+	d.pktFormat = nil
+	d.stateMu.Unlock()
+	d.cache.reset()
+}
+
+// PokeTracker is implemented by recorded configurations that can follow
+// register writes, so setters that poke single registers keep them
+// current instead of dropping them; pkg/registers' RegisterMap does
+type PokeTracker interface {
+	// WithPoke returns a copy with data written at address, or false if
+	// the write touches something the configuration doesn't hold
+	WithPoke(address uint16, data []byte) (interface{}, bool)
+}
+
+// trackPoke updates the recorded configuration and packet format for a
+// write to the radio configuration registers, or drops the configuration
+// if it can't follow the write
+func (d *Device) trackPoke(address uint16, data []byte) {
+	d.cache.forget(address, len(data))
+	end := int(address) + len(data) - 1
+	if end < radioRegFirst || int(address) > radioRegLast {
+		return
+	}
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	if d.pktFormat != nil {
+		d.pktFormat = d.pktFormat.withPoke(address, data)
+	}
+	if t, ok := d.applied.(PokeTracker); ok {
+		if next, ok := t.WithPoke(address, data); ok {
+			d.applied = next
+			return
+		}
+	}
+	d.applied = nil
+}
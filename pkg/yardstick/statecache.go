@@ -0,0 +1,196 @@
+package yardstick
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The state cache mirrors FREQ2..MDMCFG2 (contiguous in XDATA) and
+// MARCSTATE, which is all the getters below need
+const (
+	cacheFirst = RegFREQ2
+	cacheLast  = RegMDMCFG2
+)
+
+// stateCache holds the last known frequency, modulation and radio state
+// It is filled by every peek and poke that touches the mirrored registers
+// and by RefreshState, so readers never touch USB
+type stateCache struct {
+	mu        sync.RWMutex
+	regs      [cacheLast - cacheFirst + 1]byte
+	valid     [cacheLast - cacheFirst + 1]bool
+	marc      uint8
+	marcValid bool
+	updated   time.Time
+}
+
+// StateSnapshot is the cached radio state at one moment
+// Each Has* field is false until the value has been read or written
+// through the Device since it was opened or last invalidated
+type StateSnapshot struct {
+	FrequencyHz   uint32    `json:"frequency_hz"`
+	HasFrequency  bool      `json:"has_frequency"`
+	Modulation    uint8     `json:"modulation"`
+	HasModulation bool      `json:"has_modulation"`
+	MARCSTATE     uint8     `json:"marcstate"`
+	HasMode       bool      `json:"has_mode"`
+	Updated       time.Time `json:"updated"`
+}
+
+// observe records register bytes seen in a peek or poke
+// MARCSTATE is read-only, so only reads update it
+func (c *stateCache) observe(address uint16, data []byte, write bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	touched := false
+	for i, b := range data {
+		addr := int(address) + i
+		switch {
+		case addr >= cacheFirst && addr <= cacheLast:
+			c.regs[addr-cacheFirst] = b
+			c.valid[addr-cacheFirst] = true
+			touched = true
+		case addr == RegMARCSTATE && !write:
+			c.marc = b
+			c.marcValid = true
+			touched = true
+		case addr == RegRFST && write:
+			c.marc, c.marcValid = strobeState(b)
+			touched = true
+		}
+	}
+	if touched {
+		c.updated = time.Now()
+	}
+}
+
+// forget drops the cached bytes a write is about to change, so a write
+// that fails part way does not leave a stale value behind
+func (c *stateCache) forget(address uint16, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr := int(address); addr < int(address)+n; addr++ {
+		switch {
+		case addr >= cacheFirst && addr <= cacheLast:
+			c.valid[addr-cacheFirst] = false
+		case addr == RegRFST:
+			c.marcValid = false
+		}
+	}
+}
+
+// setMode records a radio state reached by a command rather than a read
+func (c *stateCache) setMode(marc uint8, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marc, c.marcValid = marc, ok
+	c.updated = time.Now()
+}
+
+func (c *stateCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.regs, c.valid = [cacheLast - cacheFirst + 1]byte{}, [cacheLast - cacheFirst + 1]bool{}
+	c.marc, c.marcValid = 0, false
+	c.updated = time.Time{}
+}
+
+func (c *stateCache) snapshot(crystalHz uint32) StateSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := StateSnapshot{MARCSTATE: c.marc, HasMode: c.marcValid, Updated: c.updated}
+	f := RegFREQ2 - cacheFirst
+	if c.valid[f] && c.valid[f+1] && c.valid[f+2] {
+		word := uint64(c.regs[f])<<16 | uint64(c.regs[f+1])<<8 | uint64(c.regs[f+2])
+		s.FrequencyHz = uint32(word * uint64(crystalHz) / 65536)
+		s.HasFrequency = true
+	}
+	if m := RegMDMCFG2 - cacheFirst; c.valid[m] {
+		s.Modulation = c.regs[m] & modFormatMsk
+		s.HasModulation = true
+	}
+	return s
+}
+
+// strobeState is the state an RFST strobe settles into; any other strobe
+// (calibrate, power down) leaves the state unknown
+func strobeState(strobe uint8) (uint8, bool) {
+	switch strobe {
+	case RFSTSrx:
+		return MarcStateRX, true
+	case RFSTStx:
+		return MarcStateTX, true
+	case RFSTSidle:
+		return MarcStateIdle, true
+	}
+	return 0, false
+}
+
+// CurrentFrequency returns the cached carrier frequency in Hz without
+// touching USB; ok is false until FREQ2..FREQ0 have been read or written
+func (d *Device) CurrentFrequency() (hz uint32, ok bool) {
+	s := d.cache.snapshot(d.knownCrystalHz())
+	return s.FrequencyHz, s.HasFrequency
+}
+
+// CurrentModulation returns the cached MDMCFG2 MOD_FORMAT value (one of
+// the Mod* constants) without touching USB
+func (d *Device) CurrentModulation() (mod uint8, ok bool) {
+	s := d.cache.snapshot(d.knownCrystalHz())
+	return s.Modulation, s.HasModulation
+}
+
+// CurrentMode returns the cached MARCSTATE without touching USB
+// It follows mode changes made through this Device and is refreshed by
+// RefreshState; after a transmit it is unknown until the next refresh
+func (d *Device) CurrentMode() (marc uint8, ok bool) {
+	s := d.cache.snapshot(d.knownCrystalHz())
+	return s.MARCSTATE, s.HasMode
+}
+
+// CurrentState returns all cached values at once, consistently
+func (d *Device) CurrentState() StateSnapshot {
+	return d.cache.snapshot(d.knownCrystalHz())
+}
+
+// RefreshState reads the cached registers from the radio in two peeks
+func (d *Device) RefreshState() error {
+	if _, err := d.Peek(cacheFirst, cacheLast-cacheFirst+1); err != nil {
+		return fmt.Errorf("failed to refresh radio state: %w", err)
+	}
+	if _, err := d.PeekByte(RegMARCSTATE); err != nil {
+		return fmt.Errorf("failed to refresh radio state: %w", err)
+	}
+	return nil
+}
+
+// StartStateRefresh calls RefreshState every interval in the background
+// so the Current* getters also pick up changes made behind the host's
+// back (another tool, firmware timeouts). Errors are skipped; a device
+// that is disconnected simply stops refreshing until it comes back.
+// Call stop to end the refresh; it waits for a refresh in progress
+func (d *Device) StartStateRefresh(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.RefreshState()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
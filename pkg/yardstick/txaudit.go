@@ -0,0 +1,188 @@
+package yardstick
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herlein/gocat/pkg/cc1111"
+)
+
+// AuditOff as GOCAT_AUDIT_LOG disables the transmit audit log
+const AuditOff = "off"
+
+// TxRecord is one transmission in the audit log
+type TxRecord struct {
+	Time        time.Time `json:"time"` // When the transmit started
+	Serial      string    `json:"serial"`
+	FrequencyHz uint32    `json:"frequency_hz,omitempty"` // 0 when not known
+	PA          uint8     `json:"pa,omitempty"`           // PA_TABLE value in use, 0 when not read
+	PowerDBm    *float64  `json:"power_dbm,omitempty"`    // Set when PA is a SetTXPowerDBm table setting
+	Bytes       int       `json:"bytes"`
+	Repeat      int       `json:"repeat,omitempty"` // Hardware repeats after the first send
+	SHA256      string    `json:"sha256"`           // Hash of the payload, which isn't kept
+	DurationUs  int64     `json:"duration_us"`      // Time the transmit call took
+	AirtimeUs   int64     `json:"airtime_us,omitempty"`
+	Kind        string    `json:"kind"` // xmit, long or fhss
+	Command     string    `json:"command"`
+	PID         int       `json:"pid"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// The audit log is shared by every device in the process and opened on
+// the first transmit
+var audit struct {
+	mu      sync.Mutex
+	path    string // Overrides AuditLogPath when set
+	off     bool
+	f       *os.File
+	command string
+	err     error
+}
+
+// AuditLogPath returns the transmit audit log file
+// GOCAT_AUDIT_LOG overrides the default of <user config dir>/gocat/audit.jsonl;
+// setting it to "off" disables the log and returns ""
+func AuditLogPath() (string, error) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	return auditPathLocked()
+}
+
+func auditPathLocked() (string, error) {
+	if audit.off {
+		return "", nil
+	}
+	if audit.path != "" {
+		return audit.path, nil
+	}
+	if path := os.Getenv("GOCAT_AUDIT_LOG"); path != "" {
+		if path == AuditOff {
+			return "", nil
+		}
+		return path, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(base, "gocat", "audit.jsonl"), nil
+}
+
+// SetAuditLog redirects the transmit audit log of this process to path,
+// or disables it when path is "off". An empty path restores the default
+func SetAuditLog(path string) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if audit.f != nil {
+		audit.f.Close()
+		audit.f = nil
+	}
+	audit.off = path == AuditOff
+	audit.path = ""
+	if !audit.off {
+		audit.path = path
+	}
+	audit.err = nil
+}
+
+// SetAuditCommand sets the invoking command recorded with each
+// transmission; the default is the process's command line
+func SetAuditCommand(command string) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	audit.command = command
+}
+
+// AuditErr returns the last error writing the audit log, if any
+// Transmits never fail because the log can't be written
+func AuditErr() error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	return audit.err
+}
+
+// ReportTx records a transmission made outside RFXmit, such as an FHSS
+// message queued with FHSS_XMIT, in the audit log
+func (d *Device) ReportTx(kind string, data []byte, start time.Time, err error) {
+	d.auditTx(kind, data, 0, start, err)
+}
+
+// auditTx appends one record to the audit log. The PA table is read back
+// for the power, so it runs after the transmit rather than delaying it
+func (d *Device) auditTx(kind string, data []byte, repeat uint16, start time.Time, txErr error) {
+	elapsed := time.Since(start)
+	if path, err := AuditLogPath(); err == nil && path == "" {
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	rec := &TxRecord{
+		Time:       start,
+		Serial:     d.LockID(),
+		Bytes:      len(data),
+		Repeat:     int(repeat),
+		SHA256:     hex.EncodeToString(sum[:]),
+		DurationUs: elapsed.Microseconds(),
+		Kind:       kind,
+		PID:        os.Getpid(),
+	}
+	if txErr != nil {
+		rec.Error = txErr.Error()
+	}
+	if airtime := d.Airtime(len(data) * (int(repeat) + 1)); airtime > 0 {
+		rec.AirtimeUs = airtime.Microseconds()
+	}
+	if hz, ok := d.CurrentFrequency(); ok {
+		rec.FrequencyHz = hz
+	}
+	if pa, err := d.txPower(); err == nil {
+		rec.PA = pa
+		if dBm, ok := cc1111.PATableDBm(rec.FrequencyHz, pa); ok {
+			rec.PowerDBm = &dBm
+		}
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	audit.err = writeAuditLocked(rec)
+}
+
+// writeAuditLocked appends one record, opening the log on first use
+func writeAuditLocked(rec *TxRecord) error {
+	if audit.f == nil {
+		path, err := auditPathLocked()
+		if err != nil || path == "" {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		audit.f = f
+	}
+	if audit.command == "" {
+		audit.command = strings.Join(os.Args, " ")
+	}
+	rec.Command = audit.command
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	// One write per record, so processes appending to the same log don't
+	// interleave lines
+	if _, err := audit.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
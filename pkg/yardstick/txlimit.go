@@ -0,0 +1,265 @@
+package yardstick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrTxRateLimited is returned when a transmit would exceed the limiter's budget
+// and the limiter is configured not to block
+var ErrTxRateLimited = errors.New("transmit rate limit exceeded")
+
+// TxLimitConfig configures a TxLimiter
+// A zero rate disables that bucket
+type TxLimitConfig struct {
+	PacketsPerSec float64 // Sustained packet rate
+	PacketBurst   int     // Packets allowed back-to-back (default: max(1, PacketsPerSec))
+
+	DutyCycle    float64       // Fraction of time allowed on air (0.01 = 1%)
+	AirtimeBurst time.Duration // Airtime allowed back-to-back (default: DutyCycle * 1s, at least one max packet)
+	BitRate      float64       // Data rate in baud, used to estimate airtime (required with DutyCycle)
+	MaxAirtime   time.Duration // Longest single transmit, repeats included (0 = no limit)
+
+	Block bool // Wait for budget instead of returning ErrTxRateLimited
+}
+
+// TxLimiter is a token bucket limiting packets/sec and airtime/sec
+// Attach one to a Device with SetTxLimiter to enforce limits at RFXmit,
+// the single choke point all transmit paths go through
+type TxLimiter struct {
+	cfg TxLimitConfig
+
+	mu            sync.Mutex
+	packetTokens  float64
+	airtimeTokens float64 // seconds
+	packetBurst   float64
+	airtimeBurst  float64 // seconds
+	last          time.Time
+}
+
+// NewTxLimiter creates a limiter with full buckets
+func NewTxLimiter(cfg TxLimitConfig) (*TxLimiter, error) {
+	if cfg.PacketsPerSec < 0 || cfg.DutyCycle < 0 || cfg.DutyCycle > 1 || cfg.MaxAirtime < 0 {
+		return nil, fmt.Errorf("invalid transmit limits: %.3f pkt/s, duty cycle %.3f", cfg.PacketsPerSec, cfg.DutyCycle)
+	}
+	if cfg.DutyCycle > 0 && cfg.BitRate <= 0 {
+		return nil, fmt.Errorf("duty cycle limit requires a bit rate")
+	}
+
+	l := &TxLimiter{cfg: cfg, last: time.Now()}
+
+	l.packetBurst = float64(cfg.PacketBurst)
+	if l.packetBurst <= 0 {
+		l.packetBurst = math.Max(1, cfg.PacketsPerSec)
+	}
+
+	l.airtimeBurst = cfg.AirtimeBurst.Seconds()
+	if l.airtimeBurst <= 0 {
+		l.airtimeBurst = cfg.DutyCycle
+	}
+	if cfg.DutyCycle > 0 {
+		// Always allow at least one maximum-size packet through
+		l.airtimeBurst = math.Max(l.airtimeBurst, l.EstimateAirtime(RFMaxTXBlock).Seconds())
+	}
+
+	l.packetTokens = l.packetBurst
+	l.airtimeTokens = l.airtimeBurst
+	return l, nil
+}
+
+// EstimateAirtime returns the on-air time for n payload bytes at the configured bit rate
+// Returns 0 if no bit rate is configured
+func (l *TxLimiter) EstimateAirtime(n int) time.Duration {
+	if l.cfg.BitRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n*8) / l.cfg.BitRate * float64(time.Second))
+}
+
+// refill adds tokens for the time elapsed since the last call
+func (l *TxLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if l.cfg.PacketsPerSec > 0 {
+		l.packetTokens = math.Min(l.packetBurst, l.packetTokens+elapsed*l.cfg.PacketsPerSec)
+	}
+	if l.cfg.DutyCycle > 0 {
+		l.airtimeTokens = math.Min(l.airtimeBurst, l.airtimeTokens+elapsed*l.cfg.DutyCycle)
+	}
+}
+
+// Reserve takes budget for packets totalling airtime and returns how long the
+// caller must wait before transmitting
+// If the limiter does not block and a wait would be needed, nothing is taken
+// and ErrTxRateLimited is returned
+func (l *TxLimiter) Reserve(packets int, airtime time.Duration) (time.Duration, error) {
+	return l.reserve(packets, airtime, l.cfg.Block)
+}
+
+func (l *TxLimiter) reserve(packets int, airtime time.Duration, block bool) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+
+	if l.cfg.MaxAirtime > 0 && airtime > l.cfg.MaxAirtime {
+		return 0, fmt.Errorf("%w: %v airtime exceeds the %v transmit limit", ErrTxRateLimited, airtime, l.cfg.MaxAirtime)
+	}
+
+	// The caller waits for the whole deficit, so a transmit bigger than the
+	// burst, such as a long run of hardware repeats, pays for itself before
+	// going out rather than leaving the debt to later transmits
+	var wait float64
+	if l.cfg.PacketsPerSec > 0 {
+		if deficit := float64(packets) - l.packetTokens; deficit > 0 {
+			wait = math.Max(wait, deficit/l.cfg.PacketsPerSec)
+		}
+	}
+	if l.cfg.DutyCycle > 0 {
+		if deficit := airtime.Seconds() - l.airtimeTokens; deficit > 0 {
+			wait = math.Max(wait, deficit/l.cfg.DutyCycle)
+		}
+	}
+
+	if wait > 0 && !block {
+		return 0, ErrTxRateLimited
+	}
+
+	// Tokens go negative until the wait is over; a caller arriving during
+	// it waits for this reservation too
+	if l.cfg.PacketsPerSec > 0 {
+		l.packetTokens -= float64(packets)
+	}
+	if l.cfg.DutyCycle > 0 {
+		l.airtimeTokens -= airtime.Seconds()
+	}
+
+	return time.Duration(wait * float64(time.Second)), nil
+}
+
+// Wait reserves budget and sleeps until it is available
+func (l *TxLimiter) Wait(packets int, airtime time.Duration) error {
+	return l.WaitCtx(context.Background(), packets, airtime)
+}
+
+// WaitCtx is Wait that gives up when ctx is done, handing the reserved
+// budget back so a cancelled transmit doesn't count against later ones
+func (l *TxLimiter) WaitCtx(ctx context.Context, packets int, airtime time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wait, err := l.Reserve(packets, airtime)
+	if err != nil || wait <= 0 {
+		return err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.refund(packets, airtime)
+		return ctx.Err()
+	}
+}
+
+// refund returns budget taken by a reservation that was not used
+func (l *TxLimiter) refund(packets int, airtime time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if l.cfg.PacketsPerSec > 0 {
+		l.packetTokens = math.Min(l.packetBurst, l.packetTokens+float64(packets))
+	}
+	if l.cfg.DutyCycle > 0 {
+		l.airtimeTokens = math.Min(l.airtimeBurst, l.airtimeTokens+airtime.Seconds())
+	}
+}
+
+// Allow reports whether a transmit fits in the budget right now, taking it if so
+func (l *TxLimiter) Allow(packets int, airtime time.Duration) bool {
+	_, err := l.reserve(packets, airtime, false)
+	return err == nil
+}
+
+// SetTxLimiter attaches a transmit limiter to the device; nil removes it
+func (d *Device) SetTxLimiter(l *TxLimiter) {
+	d.txLimiter = l
+}
+
+// TxLimiter returns the attached transmit limiter, if any
+func (d *Device) TxLimiter() *TxLimiter {
+	return d.txLimiter
+}
+
+// waitTxBudget applies the device's limiter to a transmit of packets
+// copies of n bytes, giving up when ctx is done
+func (d *Device) waitTxBudget(ctx context.Context, packets int, n int) error {
+	if d.txLimiter == nil {
+		return ctx.Err()
+	}
+	airtime := d.Airtime(n) * time.Duration(packets)
+	return d.txLimiter.WaitCtx(ctx, packets, airtime)
+}
+
+// AirtimeFunc returns the on-air duration of one packet with n payload bytes
+type AirtimeFunc func(n int) time.Duration
+
+// SetAirtimeFunc tells the device how long packets take on air under the
+// current configuration, used for transmit timeouts and limiter budgets
+// nil reverts to the block-count heuristic
+func (d *Device) SetAirtimeFunc(fn AirtimeFunc) {
+	d.airtimeFn = fn
+}
+
+// AirtimeFunc returns the function set with SetAirtimeFunc, or nil
+func (d *Device) AirtimeFunc() AirtimeFunc {
+	return d.airtimeFn
+}
+
+// Airtime returns the on-air duration of one packet with n payload bytes,
+// or 0 if unknown
+func (d *Device) Airtime(n int) time.Duration {
+	if d.airtimeFn != nil {
+		return d.airtimeFn(n)
+	}
+	if d.txLimiter != nil {
+		return d.txLimiter.EstimateAirtime(n)
+	}
+	return 0
+}
+
+// TxLimiterState is a snapshot of a limiter's remaining budget, for
+// persisting duty-cycle accounting across restarts
+type TxLimiterState struct {
+	PacketTokens  float64   `json:"packet_tokens"`
+	AirtimeTokens float64   `json:"airtime_tokens"` // seconds
+	At            time.Time `json:"at"`
+}
+
+// State returns the current remaining budget
+func (l *TxLimiter) State() TxLimiterState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	return TxLimiterState{PacketTokens: l.packetTokens, AirtimeTokens: l.airtimeTokens, At: l.last}
+}
+
+// Restore resumes from a saved budget; tokens refill for the time since
+// the snapshot was taken, so a restart can't be used to reset the budget
+func (l *TxLimiter) Restore(st TxLimiterState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st.At.IsZero() || st.At.After(time.Now()) {
+		return
+	}
+	l.packetTokens = math.Min(l.packetBurst, st.PacketTokens)
+	l.airtimeTokens = math.Min(l.airtimeBurst, st.AirtimeTokens)
+	l.last = st.At
+	l.refill(time.Now())
+}